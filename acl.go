@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	xmlrpc "github.com/ochinchina/gorilla-xmlrpc/xml"
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/faults"
+	"github.com/ochinchina/supervisord/process"
+)
+
+// AuthUser the user authenticated by the http server
+type AuthUser struct {
+	Name  string
+	Teams []string
+	// the user of http server can control all the programs and supervisord itself
+	Admin bool
+	// the user can stop the locked programs with the force flag
+	ForceLocked bool
+}
+
+// the user defined in the [user:<name>] section
+type aclUser struct {
+	password    string
+	teams       []string
+	forceLocked bool
+}
+
+type authUserKey struct{}
+
+// load the users from the [user:<name>] sections
+func loadACLUsers(cfg *config.Config) map[string]*aclUser {
+	users := make(map[string]*aclUser)
+	for _, entry := range cfg.GetEntries(func(entry *config.Entry) bool { return strings.HasPrefix(entry.Name, "user:") }) {
+		name := entry.Name[len("user:"):]
+		password := entry.GetString("password", "")
+		if name == "" || password == "" {
+			continue
+		}
+		users[name] = &aclUser{password: password, teams: splitList(entry.GetString("teams", "")), forceLocked: entry.GetBool("force_locked", false)}
+	}
+	return users
+}
+
+// attach the authenticated user to the request
+func withAuthUser(r *http.Request, user *AuthUser) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), authUserKey{}, user))
+}
+
+// get the authenticated user of request, nil if the request is not
+// authenticated because the authentication is not required or the request is
+// made by supervisord itself
+func getAuthUser(r *http.Request) *AuthUser {
+	if r == nil {
+		return nil
+	}
+	user, _ := r.Context().Value(authUserKey{}).(*AuthUser)
+	return user
+}
+
+// check if the user is one of the owners or in one of the owner teams
+func (u *AuthUser) isOwner(owners []string) bool {
+	for _, owner := range owners {
+		if owner == u.Name {
+			return true
+		}
+		for _, team := range u.Teams {
+			if owner == team {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func notAuthorized(user *AuthUser, action string) error {
+	return faults.NewFault(faults.NotAuthorized, fmt.Sprintf("NOT_AUTHORIZED: user %s is not allowed to %s", user.Name, action))
+}
+
+// check if the error is the fault of a user who is not allowed to do an action
+func isNotAuthorized(err error) bool {
+	fault, ok := err.(*xmlrpc.Fault)
+	return ok && fault.Code == faults.NotAuthorized
+}
+
+// checkAdmin check if the request is allowed to control supervisord itself or all the programs
+func (s *Supervisor) checkAdmin(r *http.Request, action string) error {
+	if user := getAuthUser(r); user != nil && !user.Admin {
+		return notAuthorized(user, action)
+	}
+	return nil
+}
+
+// canAccess check if the request is allowed to control the process, only the
+// admin, the owners and the members of owner teams of the program are allowed
+func (s *Supervisor) canAccess(r *http.Request, proc *process.Process) bool {
+	return s.canAccessProgram(r, proc.GetName())
+}
+
+// canAccessProgram check if the request is allowed to control the program by its name
+func (s *Supervisor) canAccessProgram(r *http.Request, name string) bool {
+	user := getAuthUser(r)
+	if user == nil || user.Admin {
+		return true
+	}
+	entry := s.config.GetProgram(name)
+	return entry != nil && user.isOwner(splitList(entry.GetString("owners", "")))
+}
+
+// checkProcessAccess check if the request is allowed to control all the processes
+func (s *Supervisor) checkProcessAccess(r *http.Request, procs ...*process.Process) error {
+	for _, proc := range procs {
+		if !s.canAccess(r, proc) {
+			return notAuthorized(getAuthUser(r), "control "+proc.GetName())
+		}
+	}
+	return nil
+}
+
+// checkNameAccess check if the request is allowed to control the program or
+// the "group:name" programs, only the admin can control the programs of the child nodes
+func (s *Supervisor) checkNameAccess(r *http.Request, name string) error {
+	if _, _, ok := s.splitNodeName(name); ok {
+		return s.checkAdmin(r, "control "+name)
+	}
+	return s.checkProcessAccess(r, s.findMatch(name)...)
+}
+
+// checkLocked check if the processes can be stopped, the locked programs
+// (locked=true) can only be stopped with the force flag by the admin and the
+// users with the force_locked permission
+func (s *Supervisor) checkLocked(r *http.Request, force bool, procs ...*process.Process) error {
+	user := getAuthUser(r)
+	for _, proc := range procs {
+		entry := s.config.GetProgram(proc.GetName())
+		if entry == nil || !entry.GetBool("locked", false) {
+			continue
+		}
+		if !force {
+			return faults.NewFault(faults.Locked, "LOCKED: "+proc.GetName())
+		}
+		if user != nil && !user.Admin && !user.ForceLocked {
+			return notAuthorized(user, "force the locked program "+proc.GetName())
+		}
+	}
+	return nil
+}
+
+// checkGroupAccess check if the request is allowed to control all the processes in the group
+func (s *Supervisor) checkGroupAccess(r *http.Request, group string) error {
+	if _, _, ok := s.splitNodeName(group); ok {
+		return s.checkAdmin(r, "control "+group)
+	}
+	return s.checkProcessAccess(r, s.getGroupProcesses(group)...)
+}
+
+// adminOnly create a handler which rejects the requests of the users except the admin
+func adminOnly(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := getAuthUser(r); user != nil && !user.Admin {
+			http.Error(w, "NOT_AUTHORIZED", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// check if the user is allowed to call the RPC method, only the admin can call
+// the methods of extensions since only the methods in the "supervisor"
+// namespace check the owners of programs. The introspection methods in the
+// "system" namespace are allowed for all the users
+func isRPCMethodAllowed(user *AuthUser, method string) bool {
+	method = strings.ToLower(method)
+	return user == nil || user.Admin || strings.HasPrefix(method, "supervisor.") || strings.HasPrefix(method, "system.")
+}
+
+// restrictRPCExtensions create a handler which rejects the XML-RPC methods of
+// the extensions called by the users except the admin
+func restrictRPCExtensions(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := getAuthUser(r); user != nil && !user.Admin {
+			b, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "not a valid request", http.StatusBadRequest)
+				return
+			}
+			call := struct {
+				MethodName string `xml:"methodName"`
+			}{}
+			xml.Unmarshal(b, &call)
+			if !isRPCMethodAllowed(user, call.MethodName) {
+				http.Error(w, "NOT_AUTHORIZED", http.StatusForbidden)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,141 @@
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"supervisord/internal/testutil"
+
+	"github.com/ochinchina/supervisord/process"
+	"github.com/ochinchina/supervisord/types"
+)
+
+func startACLTestSupervisor(t *testing.T) *Supervisor {
+	dir := testutil.TempDir(t)
+	command := testutil.FakeProgram(t, dir, testutil.Sleep)
+	content := fmt.Sprintf("[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\n\n"+
+		"[user:alice]\npassword=123\nteams=web\n\n[user:bob]\npassword={SHA}40bd001563085fc35165329ea1ff5c5ecbdbbeef\n\n"+
+		"[program:web]\ncommand=%[2]s\nautostart=false\nowners=web\n\n"+
+		"[program:db]\ncommand=%[2]s\nautostart=false\nowners=bob\n",
+		dir, command)
+	s := NewSupervisor(testutil.WriteFile(t, dir, "supervisord.conf", content))
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to start supervisord: %v", err)
+	}
+	t.Cleanup(func() { s.GetManager().StopAllProcesses() })
+	return s
+}
+
+func TestAuthenticateACLUsers(t *testing.T) {
+	s := startACLTestSupervisor(t)
+	auth := newAuthenticator("admin", "admin", loadACLUsers(s.config))
+
+	if user, ok := auth.authenticate("admin", "admin"); !ok || !user.Admin {
+		t.Error("fail to authenticate the admin")
+	}
+	if user, ok := auth.authenticate("alice", "123"); !ok || user.Admin || len(user.Teams) != 1 || user.Teams[0] != "web" {
+		t.Error("fail to authenticate the user with teams")
+	}
+	if user, ok := auth.authenticate("bob", "123"); !ok || user.Admin {
+		t.Error("fail to authenticate the user with hashed password")
+	}
+	if _, ok := auth.authenticate("alice", "admin"); ok {
+		t.Error("fail to reject the wrong password")
+	}
+}
+
+func TestProgramOwners(t *testing.T) {
+	s := startACLTestSupervisor(t)
+	alice := withAuthUser(httptest.NewRequest("POST", "/RPC2", nil), &AuthUser{Name: "alice", Teams: []string{"web"}})
+	admin := withAuthUser(httptest.NewRequest("POST", "/RPC2", nil), &AuthUser{Name: "admin", Admin: true})
+
+	infos := struct{ AllProcessInfo []types.ProcessInfo }{}
+	s.GetAllProcessInfo(alice, nil, &infos)
+	if len(infos.AllProcessInfo) != 1 || infos.AllProcessInfo[0].Name != "web" {
+		t.Error("fail to list only the owned programs")
+	}
+	result := struct{ Success interface{} }{}
+	if err := s.StartProcess(alice, &StartProcessArgs{Name: "web", DryRun: true}, &result); err != nil {
+		t.Error("fail to allow the team member to start the program")
+	}
+	if err := s.StartProcess(alice, &StartProcessArgs{Name: "db", DryRun: true}, &result); err == nil || !strings.Contains(err.Error(), "NOT_AUTHORIZED") {
+		t.Error("fail to reject starting the program of other owner")
+	}
+	if err := s.StopProcessGroup(alice, &StartProcessArgs{Name: "db", DryRun: true}, &struct{ AllProcessInfo interface{} }{}); err == nil {
+		t.Error("fail to reject stopping the group of other owner")
+	}
+	if err := s.StopAllProcesses(alice, &StartAllProcessesArgs{DryRun: true}, &struct{ RPCTaskResults interface{} }{}); err == nil {
+		t.Error("fail to reject stopping all the programs by user")
+	}
+	if err := s.StopAllProcesses(admin, &StartAllProcessesArgs{DryRun: true}, &struct{ RPCTaskResults interface{} }{}); err != nil {
+		t.Error("fail to allow the admin to stop all the programs")
+	}
+}
+
+// start a supervisord with the running locked program db owned by the team
+// infra of alice and oncall, oncall is allowed to force the locked programs
+func startLockedTestSupervisor(t *testing.T) (*Supervisor, *http.Request, *http.Request) {
+	dir := testutil.TempDir(t)
+	command := testutil.FakeProgram(t, dir, testutil.Sleep)
+	content := fmt.Sprintf("[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\n\n"+
+		"[user:alice]\npassword=123\nteams=infra\n\n[user:oncall]\npassword=123\nteams=infra\nforce_locked=true\n\n"+
+		"[program:db]\ncommand=%[2]s\nstartsecs=0\nowners=infra\nlocked=true\n",
+		dir, command)
+	s := NewSupervisor(testutil.WriteFile(t, dir, "supervisord.conf", content))
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to start supervisord: %v", err)
+	}
+	t.Cleanup(func() { s.GetManager().StopAllProcesses() })
+	if !testutil.WaitFor(5*time.Second, func() bool { return s.GetManager().Find("db").GetState() == process.Running }) {
+		t.Fatal("fail to start the locked program")
+	}
+	users := loadACLUsers(s.config)
+	alice := withAuthUser(httptest.NewRequest("POST", "/RPC2", nil), &AuthUser{Name: "alice", Teams: users["alice"].teams})
+	oncall := withAuthUser(httptest.NewRequest("POST", "/RPC2", nil), &AuthUser{Name: "oncall", Teams: users["oncall"].teams, ForceLocked: users["oncall"].forceLocked})
+	return s, alice, oncall
+}
+
+func TestLockedPrograms(t *testing.T) {
+	s, alice, oncall := startLockedTestSupervisor(t)
+
+	result := struct{ Success interface{} }{}
+	if err := s.StopProcess(oncall, &StartProcessArgs{Name: "db", Wait: true}, &result); err == nil || !strings.Contains(err.Error(), "LOCKED") {
+		t.Errorf("fail to refuse stopping the locked program without force: %v", err)
+	}
+	if err := s.StopAllProcesses(nil, &StartAllProcessesArgs{Wait: true}, &struct{ RPCTaskResults interface{} }{}); err == nil {
+		t.Error("fail to refuse stopping all the programs with a locked one without force")
+	}
+	if err := s.StopProcess(alice, &StartProcessArgs{Name: "db", Wait: true, Force: true}, &result); err == nil || !strings.Contains(err.Error(), "NOT_AUTHORIZED") {
+		t.Errorf("fail to refuse forcing the locked program without permission: %v", err)
+	}
+	if err := s.StopProcess(alice, &StartProcessArgs{Name: "db", DryRun: true}, &result); err != nil {
+		t.Errorf("fail to plan stopping the locked program: %v", err)
+	}
+}
+
+func TestRestrictRPCExtensions(t *testing.T) {
+	called := false
+	handler := restrictRPCExtensions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+	call := func(method string, user *AuthUser) int {
+		called = false
+		body := "<?xml version=\"1.0\"?><methodCall><methodName>" + method + "</methodName><params></params></methodCall>"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, withAuthUser(httptest.NewRequest("POST", "/RPC2", strings.NewReader(body)), user))
+		return w.Code
+	}
+	if call("supervisor.getAllProcessInfo", &AuthUser{Name: "alice"}) != http.StatusOK || !called {
+		t.Error("fail to allow the supervisor methods")
+	}
+	if call("ext.restart", &AuthUser{Name: "alice"}) != http.StatusForbidden || called {
+		t.Error("fail to reject the extension methods")
+	}
+	if call("ext.restart", &AuthUser{Name: "admin", Admin: true}) != http.StatusOK || !called {
+		t.Error("fail to allow the admin to call the extension methods")
+	}
+}
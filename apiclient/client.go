@@ -0,0 +1,94 @@
+// Package apiclient is the typed Go client of the REST API of supervisord, its
+// types and methods are generated from openapi.json by "go generate"
+package apiclient
+
+//go:generate go run ./gen -spec openapi.json -o client_gen.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client the client of the REST API of a supervisord
+type Client struct {
+	// the url of the http server of supervisord, for example http://localhost:9001
+	BaseURL string
+	// the user and the password of the basic authentication, no authentication if the user is empty
+	User     string
+	Password string
+	// the http client sending the requests, http.DefaultClient if it is nil
+	HTTPClient *http.Client
+}
+
+// NewClient create the client of the supervisord at the url
+func NewClient(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// Error the error replied by supervisord
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("supervisord: %s (%d)", e.Message, e.StatusCode)
+}
+
+// send the request with the json body and decode the json reply in the
+// result, or read the text reply if the result is a *string
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.User != "" {
+		req.SetBasicAuth(c.User, c.Password)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+	}
+	switch r := result.(type) {
+	case nil:
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+	case *string:
+		var b []byte
+		b, err = ioutil.ReadAll(resp.Body)
+		*r = string(b)
+	default:
+		err = json.NewDecoder(resp.Body).Decode(result)
+	}
+	return err
+}
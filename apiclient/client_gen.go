@@ -0,0 +1,382 @@
+// Code generated by apiclient/gen from openapi.json. DO NOT EDIT.
+
+package apiclient
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// ConfigInfo the configuration summary of a program
+type ConfigInfo struct {
+	Name           string `json:"name,omitempty"`
+	Group          string `json:"group,omitempty"`
+	GroupPrio      int    `json:"group_prio,omitempty"`
+	ProcessPrio    int    `json:"process_prio,omitempty"`
+	RedirectStderr bool   `json:"redirect_stderr,omitempty"`
+	StdoutLogfile  string `json:"stdout_logfile,omitempty"`
+	StderrLogfile  string `json:"stderr_logfile,omitempty"`
+	Inuse          bool   `json:"inuse,omitempty"`
+	Autostart      bool   `json:"autostart,omitempty"`
+	Autorestart    string `json:"autorestart,omitempty"`
+	Command        string `json:"command,omitempty"`
+	Directory      string `json:"directory,omitempty"`
+	Exitcodes      []int  `json:"exitcodes,omitempty"`
+	Startsecs      int    `json:"startsecs,omitempty"`
+	Startretries   int    `json:"startretries,omitempty"`
+	Stopsignal     int    `json:"stopsignal,omitempty"`
+	Stopasgroup    bool   `json:"stopasgroup,omitempty"`
+	Killasgroup    bool   `json:"killasgroup,omitempty"`
+	Stopwaitsecs   int    `json:"stopwaitsecs,omitempty"`
+}
+
+// Job an asynchronous job starting, stopping or restarting programs
+type Job struct {
+	ID       string          `json:"id,omitempty"`
+	Action   string          `json:"action,omitempty"`
+	Programs []string        `json:"programs,omitempty"`
+	State    string          `json:"state,omitempty"`
+	Done     int             `json:"done,omitempty"`
+	Total    int             `json:"total,omitempty"`
+	Result   map[string]bool `json:"result,omitempty"`
+	Errors   []string        `json:"errors,omitempty"`
+	Created  int64           `json:"created,omitempty"`
+	Finished int64           `json:"finished,omitempty"`
+}
+
+// ProcessConfig the resolved configuration used to spawn a program
+type ProcessConfig struct {
+	Name      string   `json:"name,omitempty"`
+	Group     string   `json:"group,omitempty"`
+	Spawned   bool     `json:"spawned,omitempty"`
+	SpawnTime int      `json:"spawn_time,omitempty"`
+	Command   []string `json:"command,omitempty"`
+	// the key=value environment with the secrets masked
+	Environment    []string `json:"environment,omitempty"`
+	User           string   `json:"user,omitempty"`
+	Directory      string   `json:"directory,omitempty"`
+	StdoutLogfile  string   `json:"stdout_logfile,omitempty"`
+	StderrLogfile  string   `json:"stderr_logfile,omitempty"`
+	RedirectStderr bool     `json:"redirect_stderr,omitempty"`
+}
+
+// ProcessInfo the state of a program
+type ProcessInfo struct {
+	Name        string `json:"name,omitempty"`
+	Group       string `json:"group,omitempty"`
+	Description string `json:"description,omitempty"`
+	// the unix time the program was started
+	Start int `json:"start,omitempty"`
+	// the unix time the program was stopped
+	Stop          int    `json:"stop,omitempty"`
+	Now           int    `json:"now,omitempty"`
+	State         int    `json:"state,omitempty"`
+	Statename     string `json:"statename,omitempty"`
+	Spawnerr      string `json:"spawnerr,omitempty"`
+	Exitstatus    int    `json:"exitstatus,omitempty"`
+	Logfile       string `json:"logfile,omitempty"`
+	StdoutLogfile string `json:"stdout_logfile,omitempty"`
+	StderrLogfile string `json:"stderr_logfile,omitempty"`
+	Pid           int    `json:"pid,omitempty"`
+	// the comma separated key=value labels of the program
+	Labels        string  `json:"labels,omitempty"`
+	Restarts      int     `json:"restarts,omitempty"`
+	Failures      int     `json:"failures,omitempty"`
+	Uptime        int     `json:"uptime,omitempty"`
+	CurrentUptime int     `json:"current_uptime,omitempty"`
+	Mtbf          int     `json:"mtbf,omitempty"`
+	Cputime       float64 `json:"cputime,omitempty"`
+	Rss           int     `json:"rss,omitempty"`
+}
+
+// Reliability the start, restart and failure statistics of a program
+type Reliability struct {
+	Name        string `json:"name,omitempty"`
+	Group       string `json:"group,omitempty"`
+	Starts      int    `json:"starts,omitempty"`
+	Restarts    int    `json:"restarts,omitempty"`
+	Failures    int    `json:"failures,omitempty"`
+	Uptime      int64  `json:"uptime,omitempty"`
+	Mtbf        int64  `json:"mtbf,omitempty"`
+	LastFailure int64  `json:"last_failure,omitempty"`
+}
+
+// RunRequest the ad-hoc command run once under supervision
+type RunRequest struct {
+	Command   string `json:"command,omitempty"`
+	Directory string `json:"directory,omitempty"`
+	// the seconds the finished program is kept, 0 for run_ttl_secs
+	TTL    int      `json:"ttl,omitempty"`
+	Reason string   `json:"reason,omitempty"`
+	Env    []string `json:"env,omitempty"`
+}
+
+// RunResult the program running the ad-hoc command
+type RunResult struct {
+	Name string `json:"name,omitempty"`
+}
+
+// Success the result of an action on a program
+type Success struct {
+	Success bool `json:"success,omitempty"`
+}
+
+// ThrottleResult the end of the throttling of a program
+type ThrottleResult struct {
+	Name           string    `json:"name,omitempty"`
+	ThrottledUntil time.Time `json:"throttledUntil,omitempty"`
+}
+
+// GetJobParams the query parameters of GetJob
+type GetJobParams struct {
+	Wait int
+}
+
+// GetJob get the state of the asynchronous job, waiting at most wait seconds for it to be finished
+func (c *Client) GetJob(ctx context.Context, id string, params *GetJobParams) (*Job, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Wait != 0 {
+			query.Set("wait", fmt.Sprint(params.Wait))
+		}
+	}
+	result := &Job{}
+	if err := c.do(ctx, "GET", "/jobs/"+url.PathEscape(id), query, nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetProgramConfig get the resolved configuration used to spawn the program
+func (c *Client) GetProgramConfig(ctx context.Context, name string) (*ProcessConfig, error) {
+	query := url.Values{}
+	result := &ProcessConfig{}
+	if err := c.do(ctx, "GET", "/program/config/"+url.PathEscape(name), query, nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ListConfigInfo list the configuration summary of the programs
+func (c *Client) ListConfigInfo(ctx context.Context) ([]ConfigInfo, error) {
+	query := url.Values{}
+	var result []ConfigInfo
+	err := c.do(ctx, "GET", "/program/configInfo", query, nil, &result)
+	return result, err
+}
+
+// GetLastOutput get the last output of the program kept in memory
+func (c *Client) GetLastOutput(ctx context.Context, name string) (string, error) {
+	query := url.Values{}
+	var result string
+	err := c.do(ctx, "GET", "/program/lastOutput/"+url.PathEscape(name), query, nil, &result)
+	return result, err
+}
+
+// ListProgramsParams the query parameters of ListPrograms
+type ListProgramsParams struct {
+	Label []string
+}
+
+// ListPrograms list the state of the programs, only the programs with all the labels if labels are given
+func (c *Client) ListPrograms(ctx context.Context, params *ListProgramsParams) ([]ProcessInfo, error) {
+	query := url.Values{}
+	if params != nil {
+		for _, value := range params.Label {
+			query.Add("label", fmt.Sprint(value))
+		}
+	}
+	var result []ProcessInfo
+	err := c.do(ctx, "GET", "/program/list", query, nil, &result)
+	return result, err
+}
+
+// ListReliabilityParams the query parameters of ListReliability
+type ListReliabilityParams struct {
+	Label []string
+}
+
+// ListReliability list the start, restart and failure statistics of the programs
+func (c *Client) ListReliability(ctx context.Context, params *ListReliabilityParams) ([]Reliability, error) {
+	query := url.Values{}
+	if params != nil {
+		for _, value := range params.Label {
+			query.Add("label", fmt.Sprint(value))
+		}
+	}
+	var result []Reliability
+	err := c.do(ctx, "GET", "/program/reliability", query, nil, &result)
+	return result, err
+}
+
+// RestartProgramParams the query parameters of RestartProgram
+type RestartProgramParams struct {
+	Force bool
+}
+
+// RestartProgram stop the program if it is running and start it again
+func (c *Client) RestartProgram(ctx context.Context, name string, params *RestartProgramParams) (*Success, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Force {
+			query.Set("force", "true")
+		}
+	}
+	result := &Success{}
+	if err := c.do(ctx, "POST", "/program/restart/"+url.PathEscape(name), query, nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RunProgram run the ad-hoc command once under supervision, admin only
+func (c *Client) RunProgram(ctx context.Context, body *RunRequest) (*RunResult, error) {
+	query := url.Values{}
+	result := &RunResult{}
+	if err := c.do(ctx, "POST", "/program/run", query, body, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// StartProgramParams the query parameters of StartProgram
+type StartProgramParams struct {
+	Env []string
+}
+
+// StartProgram start the program and wait for it, the env overrides the environment of this start only
+func (c *Client) StartProgram(ctx context.Context, name string, params *StartProgramParams) (*Success, error) {
+	query := url.Values{}
+	if params != nil {
+		for _, value := range params.Env {
+			query.Add("env", fmt.Sprint(value))
+		}
+	}
+	result := &Success{}
+	if err := c.do(ctx, "POST", "/program/start/"+url.PathEscape(name), query, nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// StartPrograms start the programs one after the other
+func (c *Client) StartPrograms(ctx context.Context, body []string) error {
+	query := url.Values{}
+	return c.do(ctx, "POST", "/program/startPrograms", query, body, nil)
+}
+
+// StopProgramParams the query parameters of StopProgram
+type StopProgramParams struct {
+	Force bool
+}
+
+// StopProgram stop the program and wait for it, a locked program is only stopped with force
+func (c *Client) StopProgram(ctx context.Context, name string, params *StopProgramParams) (*Success, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Force {
+			query.Set("force", "true")
+		}
+	}
+	result := &Success{}
+	if err := c.do(ctx, "POST", "/program/stop/"+url.PathEscape(name), query, nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// StopProgramsParams the query parameters of StopPrograms
+type StopProgramsParams struct {
+	Force  bool
+	Reason string
+}
+
+// StopPrograms stop the programs one after the other, the reason is required with require_reason
+func (c *Client) StopPrograms(ctx context.Context, params *StopProgramsParams, body []string) error {
+	query := url.Values{}
+	if params != nil {
+		if params.Force {
+			query.Set("force", "true")
+		}
+		if params.Reason != "" {
+			query.Set("reason", params.Reason)
+		}
+	}
+	return c.do(ctx, "POST", "/program/stopPrograms", query, body, nil)
+}
+
+// UnthrottleProgramParams the query parameters of UnthrottleProgram
+type UnthrottleProgramParams struct {
+	Reason string
+}
+
+// UnthrottleProgram stop the throttling of the program and thaw it
+func (c *Client) UnthrottleProgram(ctx context.Context, name string, params *UnthrottleProgramParams) (*Success, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Reason != "" {
+			query.Set("reason", params.Reason)
+		}
+	}
+	result := &Success{}
+	if err := c.do(ctx, "DELETE", "/program/throttle/"+url.PathEscape(name), query, nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ThrottleProgramParams the query parameters of ThrottleProgram
+type ThrottleProgramParams struct {
+	Duration string
+	Duty     int
+	Reason   string
+}
+
+// ThrottleProgram freeze and thaw the running program in pulses for the duration (a Go duration) with the program running duty percent of the time
+func (c *Client) ThrottleProgram(ctx context.Context, name string, params *ThrottleProgramParams) (*ThrottleResult, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Duration != "" {
+			query.Set("duration", params.Duration)
+		}
+		if params.Duty != 0 {
+			query.Set("duty", fmt.Sprint(params.Duty))
+		}
+		if params.Reason != "" {
+			query.Set("reason", params.Reason)
+		}
+	}
+	result := &ThrottleResult{}
+	if err := c.do(ctx, "POST", "/program/throttle/"+url.PathEscape(name), query, nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Reload reload the configuration file, admin only
+func (c *Client) Reload(ctx context.Context) (*Success, error) {
+	query := url.Values{}
+	result := &Success{}
+	if err := c.do(ctx, "POST", "/supervisor/reload", query, nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ShutdownParams the query parameters of Shutdown
+type ShutdownParams struct {
+	Reason string
+}
+
+// Shutdown shutdown supervisord, admin only, the reason is required with require_reason
+func (c *Client) Shutdown(ctx context.Context, params *ShutdownParams) error {
+	query := url.Values{}
+	if params != nil {
+		if params.Reason != "" {
+			query.Set("reason", params.Reason)
+		}
+	}
+	return c.do(ctx, "POST", "/supervisor/shutdown", query, nil, nil)
+}
@@ -0,0 +1,316 @@
+// The gen command generates the typed Go client of the REST API from its
+// OpenAPI definition, run by "go generate" in the apiclient package
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// schema the subset of the OpenAPI schema used by the definition
+type schema struct {
+	Ref                  string     `json:"$ref"`
+	Type                 string     `json:"type"`
+	Format               string     `json:"format"`
+	Description          string     `json:"description"`
+	Items                *schema    `json:"items"`
+	Properties           properties `json:"properties"`
+	AdditionalProperties *schema    `json:"additionalProperties"`
+}
+
+// a property of an object schema
+type property struct {
+	name   string
+	schema *schema
+}
+
+// properties the properties of an object schema in the order of the definition
+type properties []property
+
+func (p *properties) UnmarshalJSON(b []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		prop := property{name: token.(string), schema: &schema{}}
+		if err := decoder.Decode(prop.schema); err != nil {
+			return err
+		}
+		*p = append(*p, prop)
+	}
+	return nil
+}
+
+type parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type body struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content"`
+}
+
+type operation struct {
+	OperationID string          `json:"operationId"`
+	Description string          `json:"description"`
+	Parameters  []parameter     `json:"parameters"`
+	RequestBody *body           `json:"requestBody"`
+	Responses   map[string]body `json:"responses"`
+}
+
+type definition struct {
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+	Paths map[string]map[string]*operation `json:"paths"`
+}
+
+// the Go name of the json name "stdout_logfile" or "operationId"
+func goName(name string) string {
+	words := strings.Split(name, "_")
+	for i, word := range words {
+		if word == "id" || word == "ttl" {
+			words[i] = strings.ToUpper(word)
+		} else if word != "" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, "")
+}
+
+// the Go type of the schema
+func goType(s *schema) string {
+	if s.Ref != "" {
+		return s.Ref[strings.LastIndex(s.Ref, "/")+1:]
+	}
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			return "time.Time"
+		}
+		return "string"
+	case "integer":
+		if s.Format == "int64" {
+			return "int64"
+		}
+		return "int"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + goType(s.Items)
+	case "object":
+		if s.AdditionalProperties != nil {
+			return "map[string]" + goType(s.AdditionalProperties)
+		}
+	}
+	return "interface{}"
+}
+
+// write the description as a comment starting with the name
+func comment(out *bytes.Buffer, name string, description string) {
+	if description != "" {
+		fmt.Fprintf(out, "// %s %s\n", name, description)
+	}
+}
+
+func generateSchemas(out *bytes.Buffer, def *definition) {
+	names := make([]string, 0)
+	for name := range def.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := def.Components.Schemas[name]
+		comment(out, name, s.Description)
+		fmt.Fprintf(out, "type %s struct {\n", name)
+		for _, prop := range s.Properties {
+			if prop.schema.Description != "" {
+				fmt.Fprintf(out, "\t// %s\n", prop.schema.Description)
+			}
+			fmt.Fprintf(out, "\t%s %s `json:\"%s,omitempty\"`\n", goName(prop.name), goType(prop.schema), prop.name)
+		}
+		fmt.Fprintf(out, "}\n\n")
+	}
+}
+
+// the schema and the media type of the successful response, nil if it has no content
+func getResponse(op *operation) (*schema, string) {
+	codes := make([]string, 0)
+	for code := range op.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		if !strings.HasPrefix(code, "2") {
+			continue
+		}
+		for _, media := range []string{"application/json", "text/plain"} {
+			if content, ok := op.Responses[code].Content[media]; ok {
+				return content.Schema, media
+			}
+		}
+	}
+	return nil, ""
+}
+
+// the statement adding the query parameter to the url.Values query
+func queryStatement(param parameter) string {
+	field := "params." + goName(param.Name)
+	switch goType(param.Schema) {
+	case "string":
+		return fmt.Sprintf("if %s != \"\" {\nquery.Set(%q, %s)\n}\n", field, param.Name, field)
+	case "bool":
+		return fmt.Sprintf("if %s {\nquery.Set(%q, \"true\")\n}\n", field, param.Name)
+	case "int", "int64":
+		return fmt.Sprintf("if %s != 0 {\nquery.Set(%q, fmt.Sprint(%s))\n}\n", field, param.Name, field)
+	default:
+		return fmt.Sprintf("for _, value := range %s {\nquery.Add(%q, fmt.Sprint(value))\n}\n", field, param.Name)
+	}
+}
+
+func generateOperation(out *bytes.Buffer, path string, method string, op *operation) {
+	name := goName(op.OperationID)
+	args := []string{"ctx context.Context"}
+	urlPath := fmt.Sprintf("%q", path)
+	queryParams := make([]parameter, 0)
+	for _, param := range op.Parameters {
+		switch param.In {
+		case "path":
+			arg := strings.ToLower(param.Name[:1]) + param.Name[1:]
+			args = append(args, arg+" "+goType(param.Schema))
+			urlPath = strings.Replace(urlPath, "{"+param.Name+"}", "\"+url.PathEscape("+arg+")+\"", 1)
+		case "query":
+			queryParams = append(queryParams, param)
+		}
+	}
+	urlPath = strings.TrimSuffix(strings.Replace(urlPath, "+\"\"", "", -1), "+\"\"")
+	if len(queryParams) > 0 {
+		comment(out, name+"Params", "the query parameters of "+name)
+		fmt.Fprintf(out, "type %sParams struct {\n", name)
+		for _, param := range queryParams {
+			fmt.Fprintf(out, "\t%s %s\n", goName(param.Name), goType(param.Schema))
+		}
+		fmt.Fprintf(out, "}\n\n")
+		args = append(args, "params *"+name+"Params")
+	}
+	bodyArg := "nil"
+	if op.RequestBody != nil {
+		bodyType := goType(op.RequestBody.Content["application/json"].Schema)
+		if !strings.HasPrefix(bodyType, "[]") {
+			bodyType = "*" + bodyType
+		}
+		args = append(args, "body "+bodyType)
+		bodyArg = "body"
+	}
+	result, media := getResponse(op)
+	resultType := ""
+	if result != nil {
+		resultType = goType(result)
+		if media == "application/json" && !strings.HasPrefix(resultType, "[]") {
+			resultType = "*" + resultType
+		}
+	}
+
+	comment(out, name, op.Description)
+	if resultType == "" {
+		fmt.Fprintf(out, "func (c *Client) %s(%s) error {\n", name, strings.Join(args, ", "))
+	} else {
+		fmt.Fprintf(out, "func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(args, ", "), resultType)
+	}
+	fmt.Fprintf(out, "query := url.Values{}\n")
+	if len(queryParams) > 0 {
+		fmt.Fprintf(out, "if params != nil {\n")
+		for _, param := range queryParams {
+			fmt.Fprint(out, queryStatement(param))
+		}
+		fmt.Fprintf(out, "}\n")
+	}
+	switch {
+	case resultType == "":
+		fmt.Fprintf(out, "return c.do(ctx, %q, %s, query, %s, nil)\n", strings.ToUpper(method), urlPath, bodyArg)
+	case strings.HasPrefix(resultType, "*"):
+		fmt.Fprintf(out, "result := &%s{}\n", resultType[1:])
+		fmt.Fprintf(out, "if err := c.do(ctx, %q, %s, query, %s, result); err != nil {\nreturn nil, err\n}\nreturn result, nil\n", strings.ToUpper(method), urlPath, bodyArg)
+	default:
+		fmt.Fprintf(out, "var result %s\n", resultType)
+		fmt.Fprintf(out, "err := c.do(ctx, %q, %s, query, %s, &result)\nreturn result, err\n", strings.ToUpper(method), urlPath, bodyArg)
+	}
+	fmt.Fprintf(out, "}\n\n")
+}
+
+// generate the source of the client from the OpenAPI definition
+func generate(spec []byte) ([]byte, error) {
+	def := &definition{}
+	if err := json.Unmarshal(spec, def); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI definition: %v", err)
+	}
+	out := &bytes.Buffer{}
+	generateSchemas(out, def)
+
+	paths := make([]string, 0)
+	for path := range def.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		methods := make([]string, 0)
+		for method := range def.Paths[path] {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			op := def.Paths[path][method]
+			if op.OperationID == "" {
+				return nil, fmt.Errorf("no operationId for %s %s", method, path)
+			}
+			generateOperation(out, path, method, op)
+		}
+	}
+	// only the packages used by the generated code are imported
+	imports := make([]string, 0)
+	for _, pkg := range [][2]string{{"context", "context.Context"}, {"fmt", "fmt.Sprint"}, {"net/url", "url."}, {"time", "time.Time"}} {
+		if strings.Contains(out.String(), pkg[1]) {
+			imports = append(imports, fmt.Sprintf("%q", pkg[0]))
+		}
+	}
+	header := "// Code generated by apiclient/gen from openapi.json. DO NOT EDIT.\n\npackage apiclient\n\nimport (\n" + strings.Join(imports, "\n") + "\n)\n\n"
+	return format.Source(append([]byte(header), out.Bytes()...))
+}
+
+func main() {
+	spec := flag.String("spec", "openapi.json", "the OpenAPI definition")
+	output := flag.String("o", "client_gen.go", "the generated Go file")
+	flag.Parse()
+	b, err := ioutil.ReadFile(*spec)
+	if err == nil {
+		b, err = generate(b)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(*output, b, 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestGeneratedClientUpToDate(t *testing.T) {
+	spec, err := ioutil.ReadFile("../openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := generate(spec)
+	if err != nil {
+		t.Fatalf("fail to generate the client: %v", err)
+	}
+	current, _ := ioutil.ReadFile("../client_gen.go")
+	if !bytes.Equal(generated, current) {
+		t.Error("client_gen.go is not generated from openapi.json, run go generate ./apiclient")
+	}
+}
@@ -0,0 +1,76 @@
+// +build !windows,!nohttp
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"supervisord/internal/testutil"
+
+	"github.com/gorilla/mux"
+	"github.com/ochinchina/supervisord/apiclient"
+)
+
+// create the router of the REST interface described by apiclient/openapi.json
+func createRESTRouter(s *Supervisor) *mux.Router {
+	sr := NewSupervisorRestful(s)
+	sr.CreateProgramHandler()
+	sr.CreateJobHandler()
+	return sr.CreateSupervisorHandler().(*mux.Router)
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	b, err := ioutil.ReadFile("apiclient/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}{}
+	if err := json.Unmarshal(b, &spec); err != nil {
+		t.Fatalf("invalid OpenAPI definition: %v", err)
+	}
+	dir := testutil.TempDir(t)
+	router := createRESTRouter(startConfSupervisor(t, dir, fmt.Sprintf(testSupervisordSection, dir)))
+	for path, methods := range spec.Paths {
+		for method := range methods {
+			url := strings.NewReplacer("{name}", "web", "{id}", "1").Replace(path)
+			if !router.Match(httptest.NewRequest(strings.ToUpper(method), url, nil), &mux.RouteMatch{}) {
+				t.Errorf("no REST handler of %s %s", method, path)
+			}
+		}
+	}
+}
+
+func TestAPIClient(t *testing.T) {
+	dir := testutil.TempDir(t)
+	content := fmt.Sprintf(testSupervisordSection+"\n"+
+		"[program:web]\ncommand=%[2]s\nautostart=false\nstartsecs=0\nlabels=team=web\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n", dir, testutil.FakeProgram(t, dir, testutil.Sleep))
+	server := httptest.NewServer(createRESTRouter(startConfSupervisor(t, dir, content)))
+	defer server.Close()
+	client := apiclient.NewClient(server.URL)
+	ctx := context.Background()
+
+	if result, err := client.StartProgram(ctx, "web", nil); err != nil || !result.Success {
+		t.Fatalf("fail to start the program: %v %v", result, err)
+	}
+	programs, err := client.ListPrograms(ctx, &apiclient.ListProgramsParams{Label: []string{"team=web"}})
+	if err != nil || len(programs) != 1 || programs[0].Name != "web" || programs[0].Statename != "Running" || programs[0].Pid == 0 {
+		t.Errorf("fail to list the programs with the label: %+v %v", programs, err)
+	}
+	if config, err := client.GetProgramConfig(ctx, "web"); err != nil || !config.Spawned || len(config.Command) == 0 {
+		t.Errorf("fail to get the config of the program: %+v %v", config, err)
+	}
+	if result, err := client.StopProgram(ctx, "web", &apiclient.StopProgramParams{Force: true}); err != nil || !result.Success {
+		t.Errorf("fail to stop the program: %v %v", result, err)
+	}
+	if _, err := client.GetProgramConfig(ctx, "none"); err == nil || err.(*apiclient.Error).StatusCode != 404 {
+		t.Errorf("fail to return the error of the unknown program: %v", err)
+	}
+}
@@ -1,4 +1,4 @@
-// +build !release
+// +build !release,!nogui,!nohttp
 //go:generate go run github.com/UnnoTed/fileb0x b0x.yaml
 
 package main
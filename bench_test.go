@@ -0,0 +1,159 @@
+// +build !windows,!nohttp
+
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ochinchina/supervisord/logger"
+	"github.com/ochinchina/supervisord/types"
+	"supervisord/internal/testutil"
+)
+
+// the number of programs of the benchmarks simulating a big host
+const benchPrograms = 1000
+
+// boot a supervisord with benchPrograms programs which are not started, the
+// programs of the odd index are owned by the team "web"
+func startBenchSupervisor(b *testing.B) *Supervisor {
+	dir := testutil.TempDir(b)
+	var content strings.Builder
+	fmt.Fprintf(&content, "[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\n\n", dir)
+	for i := 0; i < benchPrograms; i++ {
+		fmt.Fprintf(&content, "[program:prog%04d]\ncommand=/bin/sleep 3600\nautostart=false\nstdout_logfile=%s/prog%04d.log\n", i, dir, i)
+		if i%2 == 1 {
+			content.WriteString("owners=web\n")
+		}
+	}
+	s := NewSupervisor(testutil.WriteFile(b, dir, "supervisord.conf", content.String()))
+	if _, _, _, err := s.Reload(); err != nil {
+		b.Fatalf("fail to start supervisord: %v", err)
+	}
+	return s
+}
+
+func BenchmarkGetAllProcessInfo(b *testing.B) {
+	s := startBenchSupervisor(b)
+	admin := withAuthUser(httptest.NewRequest("POST", "/RPC2", nil), &AuthUser{Name: "admin", Admin: true})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reply := struct{ AllProcessInfo []types.ProcessInfo }{}
+		s.GetAllProcessInfo(admin, nil, &reply)
+		if len(reply.AllProcessInfo) != benchPrograms {
+			b.Fatal("fail to get all the process info")
+		}
+	}
+}
+
+// the programs are filtered by the owners for the user who isn't admin
+func BenchmarkGetAllProcessInfoOwners(b *testing.B) {
+	s := startBenchSupervisor(b)
+	alice := withAuthUser(httptest.NewRequest("POST", "/RPC2", nil), &AuthUser{Name: "alice", Teams: []string{"web"}})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reply := struct{ AllProcessInfo []types.ProcessInfo }{}
+		s.GetAllProcessInfo(alice, nil, &reply)
+		if len(reply.AllProcessInfo) != benchPrograms/2 {
+			b.Fatal("fail to get the process info of the owned programs")
+		}
+	}
+}
+
+// many clients query the state of single programs in parallel
+func BenchmarkGetProcessInfoParallel(b *testing.B) {
+	s := startBenchSupervisor(b)
+	admin := withAuthUser(httptest.NewRequest("POST", "/RPC2", nil), &AuthUser{Name: "admin", Admin: true})
+	var n uint64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			name := fmt.Sprintf("prog%04d", atomic.AddUint64(&n, 1)%benchPrograms)
+			reply := struct{ ProcInfo types.ProcessInfo }{}
+			if err := s.GetProcessInfo(admin, &struct{ Name string }{name}, &reply); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// the monitoring systems scrape the state of all the programs by /program/list
+func BenchmarkListProgram(b *testing.B) {
+	s := startBenchSupervisor(b)
+	handler := NewSupervisorRestful(s).CreateProgramHandler()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/program/list", nil))
+		if w.Code != 200 {
+			b.Fatal("fail to list the programs")
+		}
+	}
+}
+
+// the programs write their logs to their own log files in parallel
+func BenchmarkLogWriteParallel(b *testing.B) {
+	dir := testutil.TempDir(b)
+	loggers := make([]logger.Logger, benchPrograms)
+	for i := range loggers {
+		loggers[i] = logger.NewLogger(fmt.Sprintf("prog%04d", i), filepath.Join(dir, fmt.Sprintf("prog%04d.log", i)),
+			logger.NewNullLocker(), 50*1024*1024, 1, logger.NewNullLogEventEmitter())
+	}
+	defer func() {
+		for _, l := range loggers {
+			l.Close()
+		}
+	}()
+	line := []byte("this is a line of the program output for the benchmark\n")
+	var n uint64
+	b.SetBytes(int64(len(line)))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		l := loggers[atomic.AddUint64(&n, 1)%benchPrograms]
+		for pb.Next() {
+			l.Write(line)
+		}
+	})
+}
+
+// reload the unchanged configuration
+func BenchmarkReload(b *testing.B) {
+	s := startBenchSupervisor(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := s.Reload(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// the XML-RPC encoding and decoding of all the process info
+func BenchmarkXMLRPCGetAllProcessInfo(b *testing.B) {
+	s := startBenchSupervisor(b)
+	rpcc := NewXMLRPC().NewInMemoryClient(s)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reply, err := rpcc.GetAllProcessInfo()
+		if err != nil || len(reply.Value) != benchPrograms {
+			b.Fatalf("fail to get all the process info: %v", err)
+		}
+	}
+}
+
+func TestLoadTestCommand(t *testing.T) {
+	command := &LoadTestCommand{User: "admin", Password: "admin", Programs: 10, Clients: 2, Duration: 200 * time.Millisecond, Method: "getProcessInfo"}
+	if err := command.run(); err != nil {
+		t.Errorf("fail to run the load test: %v", err)
+	}
+}
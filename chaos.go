@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/faults"
+	"github.com/ochinchina/supervisord/process"
+	"github.com/ochinchina/supervisord/signals"
+	"github.com/ochinchina/supervisord/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// the actions of the chaos drills
+const (
+	chaosKill  = "kill"
+	chaosDelay = "delay"
+)
+
+// the default seconds the processes are paused by the delay action
+const defaultChaosDelaySecs = 10
+
+// the [chaos] section enabling the chaos drills
+type chaosConfig struct {
+	// the patterns of the programs which can be targeted
+	programs            []string
+	maxActionsPerMinute int
+	maxDelay            time.Duration
+}
+
+// ChaosDrills kill or delay the supervised processes picked randomly for the
+// resilience drills, within the rate limit of the [chaos] section
+type ChaosDrills struct {
+	lock sync.Mutex
+	// the times of the actions in the last minute
+	actions []time.Time
+	rand    *rand.Rand
+}
+
+// NewChaosDrills create a ChaosDrills without action
+func NewChaosDrills() *ChaosDrills {
+	return &ChaosDrills{actions: make([]time.Time, 0), rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// parse the [chaos] section, nil if the chaos drills are not enabled
+func parseChaosConfig(cfg *config.Config) *chaosConfig {
+	entries := cfg.GetEntries(func(entry *config.Entry) bool { return entry.Name == "chaos" })
+	if len(entries) == 0 || !entries[0].GetBool("enabled", false) {
+		return nil
+	}
+	entry := entries[0]
+	return &chaosConfig{programs: splitList(entry.GetString("programs", "")),
+		maxActionsPerMinute: entry.GetInt("max_actions_per_minute", 1),
+		maxDelay:            time.Duration(entry.GetInt("max_delay_secs", 60)) * time.Second}
+}
+
+// check if the process is matched by the pattern of its name or of its
+// group and name, like "web_*" or "db:*"
+func matchChaosTarget(pattern string, proc *process.Process) bool {
+	for _, name := range []string{proc.GetName(), proc.GetGroup() + ":" + proc.GetName()} {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// record n actions if the rate limit isn't reached
+func (c *ChaosDrills) reserve(n int, maxActionsPerMinute int, now time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	recent := make([]time.Time, 0, len(c.actions))
+	for _, t := range c.actions {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	c.actions = recent
+	if len(c.actions)+n > maxActionsPerMinute {
+		return fmt.Errorf("the rate limit of %d chaos actions per minute is reached", maxActionsPerMinute)
+	}
+	for i := 0; i < n; i++ {
+		c.actions = append(c.actions, now)
+	}
+	return nil
+}
+
+// pick count processes randomly
+func (c *ChaosDrills) pick(procs []*process.Process, count int) []*process.Process {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.rand.Shuffle(len(procs), func(i, j int) { procs[i], procs[j] = procs[j], procs[i] })
+	if count < len(procs) {
+		procs = procs[0:count]
+	}
+	return procs
+}
+
+// Chaos kill or delay (pause with SIGSTOP and resume with SIGCONT) the
+// running processes picked randomly among the targets of the [chaos] section
+// for the resilience drills. The drills must be enabled in the configuration,
+// they are limited by max_actions_per_minute and every action is logged
+func (s *Supervisor) Chaos(r *http.Request, args *types.ChaosArgs, reply *struct{ Actions []types.ChaosAction }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "chaos"); err != nil {
+		return err
+	}
+	cfg := parseChaosConfig(s.config)
+	if cfg == nil {
+		return faults.NewFault(faults.Failed, "FAILED: the chaos drills are not enabled in the [chaos] section")
+	}
+	if args.Action != chaosKill && args.Action != chaosDelay {
+		return faults.NewFault(faults.BadArguments, fmt.Sprintf("BAD_ARGUMENTS: unknown chaos action %q, kill or delay", args.Action))
+	}
+	count := args.Count
+	if count <= 0 {
+		count = 1
+	}
+	delay := time.Duration(args.Duration) * time.Second
+	if delay <= 0 {
+		delay = defaultChaosDelaySecs * time.Second
+	}
+	if args.Action == chaosDelay && delay > cfg.maxDelay {
+		return faults.NewFault(faults.BadArguments, fmt.Sprintf("BAD_ARGUMENTS: the delay is longer than the max_delay_secs %d", int(cfg.maxDelay.Seconds())))
+	}
+
+	targets := make([]*process.Process, 0)
+	s.procMgr.ForEachProcess(func(proc *process.Process) {
+		if proc.GetState() != process.Running || (args.Name != "" && !matchChaosTarget(args.Name, proc)) {
+			return
+		}
+		for _, pattern := range cfg.programs {
+			if matchChaosTarget(pattern, proc) {
+				targets = append(targets, proc)
+				return
+			}
+		}
+	})
+	if len(targets) == 0 {
+		return faults.NewFault(faults.BadName, "BAD_NAME: no running program targeted by the chaos drills matches "+args.Name)
+	}
+	targets = s.chaos.pick(targets, count)
+	if err := s.chaos.reserve(len(targets), cfg.maxActionsPerMinute, time.Now()); err != nil {
+		return faults.NewFault(faults.Failed, "FAILED: "+err.Error())
+	}
+
+	userName := ""
+	if user := getAuthUser(r); user != nil {
+		userName = user.Name
+	}
+	names := make([]string, 0, len(targets))
+	for _, proc := range targets {
+		action := types.ChaosAction{Action: args.Action, Name: proc.GetName(), Group: proc.GetGroup(), Pid: proc.GetPid()}
+		fields := log.Fields{"action": args.Action, "program": proc.GetName(), "pid": action.Pid, "user": userName, "reason": args.Reason}
+		if err := s.chaosAction(proc, args.Action, delay); err != nil {
+			fields[log.ErrorKey] = err
+			log.WithFields(fields).Error("fail to run the chaos action")
+			continue
+		}
+		if args.Action == chaosDelay {
+			fields["duration"] = delay.String()
+		}
+		log.WithFields(fields).Warn("chaos action")
+		reply.Actions = append(reply.Actions, action)
+		names = append(names, proc.GetName())
+	}
+	s.recordAction(r, "chaos-"+args.Action, names, args.Reason)
+	return nil
+}
+
+// kill the process, or pause it and resume it after the delay
+func (s *Supervisor) chaosAction(proc *process.Process, action string, delay time.Duration) error {
+	if action == chaosKill {
+		sig, err := signals.ToSignal("KILL")
+		if err != nil {
+			return err
+		}
+		return proc.Signal(sig, false)
+	}
+	stop, err := signals.ToSignal("STOP")
+	if err != nil {
+		return err
+	}
+	cont, err := signals.ToSignal("CONT")
+	if err != nil {
+		return err
+	}
+	if err = proc.Signal(stop, false); err != nil {
+		return err
+	}
+	time.AfterFunc(delay, func() {
+		if err := proc.Signal(cont, false); err != nil {
+			log.WithFields(log.Fields{"program": proc.GetName(), log.ErrorKey: err}).Error("fail to resume the delayed program")
+		} else {
+			log.WithFields(log.Fields{"program": proc.GetName()}).Info("the delayed program is resumed")
+		}
+	})
+	return nil
+}
@@ -0,0 +1,89 @@
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"supervisord/internal/testutil"
+
+	"github.com/ochinchina/supervisord/events"
+	"github.com/ochinchina/supervisord/process"
+	"github.com/ochinchina/supervisord/types"
+)
+
+func TestChaosDrills(t *testing.T) {
+	dir := testutil.TempDir(t)
+	program := "command=%[2]s\nautostart=false\nstartsecs=0\nautorestart=false\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n"
+	content := testSupervisordSection + "\n" +
+		"[program:web]\n" + program + "\n[program:db]\n" + program
+	s := startConfSupervisor(t, dir, fmt.Sprintf(content, dir, testutil.FakeProgram(t, dir, testutil.Sleep)))
+	web, db := s.GetManager().Find("web"), s.GetManager().Find("db")
+	web.Start(true)
+	db.Start(true)
+	ctlCommand.rpcc = s.xmlRPC.NewInMemoryClient(s)
+	defer func() { ctlCommand.rpcc = nil }()
+	rpcc := ctlCommand.createRPCClient()
+
+	if _, err := rpcc.Chaos(types.ChaosArgs{Action: "kill", Name: "web"}); err == nil || !strings.Contains(err.Error(), "not enabled") {
+		t.Errorf("fail to refuse the chaos drill without [chaos] section: %v", err)
+	}
+	configFile := s.GetConfig().GetConfigFile()
+	config, _ := ioutil.ReadFile(configFile)
+	ioutil.WriteFile(configFile, append(config, []byte("\n[chaos]\nenabled=true\nprograms=web*\nmax_actions_per_minute=1\nmax_delay_secs=5\n")...), 0644)
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to reload supervisord: %v", err)
+	}
+
+	if _, err := rpcc.Chaos(types.ChaosArgs{Action: "kill", Name: "db"}); err == nil {
+		t.Error("fail to refuse the program out of the targets")
+	}
+	if _, err := rpcc.Chaos(types.ChaosArgs{Action: "delay", Duration: 60}); err == nil {
+		t.Error("fail to refuse the delay longer than max_delay_secs")
+	}
+	if _, err := rpcc.Chaos(types.ChaosArgs{Action: "crash"}); err == nil {
+		t.Error("fail to refuse the unknown action")
+	}
+
+	chaosCommand = ChaosCommand{Action: "delay", Count: 1, Duration: time.Second}
+	defer func() { chaosCommand = ChaosCommand{} }()
+	output := captureOutput(t, func() { chaosCommand.Execute(nil) })
+	if output != fmt.Sprintf("web (pid %d): paused for 1s\n", web.GetPid()) {
+		t.Errorf("fail to delay the program: %q", output)
+	}
+	output = captureOutput(t, func() { chaosCommand.Execute(nil) })
+	if !strings.Contains(output, "rate limit") {
+		t.Errorf("fail to refuse the drill over the rate limit: %q", output)
+	}
+	if web.GetState() != process.Running {
+		t.Errorf("fail to keep the delayed program running: %v", web.GetState())
+	}
+
+	actions := make(chan string, 10)
+	events.Subscribe("test-chaos", []string{"OPERATOR_ACTION"}, func(event events.Event) { actions <- event.GetBody() })
+	defer events.Unsubscribe("test-chaos")
+	s.chaos.actions = nil
+	pid := web.GetPid()
+	result, err := rpcc.Chaos(types.ChaosArgs{Action: "kill", Name: "web", Reason: "drill"})
+	if err != nil || len(result) != 1 || result[0].Name != "web" || result[0].Pid != pid {
+		t.Fatalf("fail to kill the program: %v %v", result, err)
+	}
+	if !testutil.WaitFor(5*time.Second, func() bool { return web.GetState() == process.Exited }) {
+		t.Errorf("fail to kill the program: %v", web.GetState())
+	}
+	select {
+	case body := <-actions:
+		if body != "action:chaos-kill user: programs:web\ndrill" {
+			t.Errorf("fail to record the chaos action: %q", body)
+		}
+	case <-time.After(time.Second):
+		t.Error("fail to emit the operator action event")
+	}
+	if db.GetState() != process.Running {
+		t.Error("fail to spare the program out of the targets")
+	}
+}
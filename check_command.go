@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ochinchina/supervisord/types"
+	"github.com/ochinchina/supervisord/xmlrpcclient"
+)
+
+// the exit codes of the Nagios plugins
+const (
+	checkOK       = 0
+	checkWarning  = 1
+	checkCritical = 2
+	checkUnknown  = 3
+)
+
+var checkStatusNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// CheckCommand check the state of the programs like a Nagios/Icinga plugin
+type CheckCommand struct {
+	ServerURL      string        `short:"s" long:"serverurl" description:"URL on which supervisord server is listening"`
+	User           string        `short:"u" long:"user" description:"the user name"`
+	Password       string        `short:"P" long:"password" description:"the password"`
+	Programs       []string      `short:"p" long:"program" description:"the program (name or group:name) to check, can be repeated, all the programs if not set"`
+	CriticalStates string        `long:"critical-states" default:"FATAL,EXITED,UNKNOWN" description:"the states of the programs (separated by \",\") raising a CRITICAL status"`
+	WarningStates  string        `long:"warning-states" default:"BACKOFF,STOPPED" description:"the states of the programs (separated by \",\") raising a WARNING status"`
+	Timeout        time.Duration `long:"timeout" default:"10s" description:"the timeout of the connection to supervisord"`
+}
+
+var checkCommand CheckCommand
+
+// check if the state name is in the list of states
+func hasState(states string, stateName string) bool {
+	for _, state := range splitList(states) {
+		if strings.EqualFold(state, stateName) {
+			return true
+		}
+	}
+	return false
+}
+
+// check the programs, return the status code and the plugin output with
+// the perfdata after "|"
+func (cc *CheckCommand) check(rpcc *xmlrpcclient.XMLRPCClient) (int, string) {
+	reply, err := rpcc.GetAllProcessInfo()
+	if err != nil {
+		return checkUnknown, fmt.Sprintf("fail to get the state of the programs from %s: %v", rpcc.URL(), err)
+	}
+	infos := make(map[string]types.ProcessInfo)
+	for _, info := range reply.Value {
+		infos[info.Name] = info
+		infos[info.GetFullName()] = info
+	}
+	names := cc.Programs
+	if len(names) == 0 {
+		for _, info := range reply.Value {
+			if info.Group == info.Name {
+				names = append(names, info.Name)
+			} else {
+				names = append(names, info.GetFullName())
+			}
+		}
+	}
+	sort.Strings(names)
+
+	status := checkOK
+	problems := make([]string, 0)
+	perfdata := make([]string, 0)
+	running := 0
+	for _, name := range names {
+		info, ok := infos[name]
+		if !ok {
+			return checkUnknown, fmt.Sprintf("no program %s", name)
+		}
+		stateName := strings.ToUpper(info.Statename)
+		programStatus := checkOK
+		if hasState(cc.CriticalStates, stateName) {
+			programStatus = checkCritical
+		} else if hasState(cc.WarningStates, stateName) {
+			programStatus = checkWarning
+		}
+		if programStatus != checkOK {
+			problems = append(problems, fmt.Sprintf("%s %s", name, stateName))
+		}
+		if programStatus > status {
+			status = programStatus
+		}
+		if stateName == "RUNNING" {
+			running++
+		}
+		perfdata = append(perfdata, fmt.Sprintf("'%s_uptime'=%ds", name, info.CurrentUptime), fmt.Sprintf("'%s_restarts'=%dc", name, info.Restarts))
+	}
+	message := fmt.Sprintf("%d of %d programs running", running, len(names))
+	if len(problems) > 0 {
+		message = strings.Join(problems, ", ") + "; " + message
+	}
+	perfdata = append([]string{fmt.Sprintf("running=%d;;;0;%d", running, len(names))}, perfdata...)
+	return status, message + " | " + strings.Join(perfdata, " ")
+}
+
+// Execute print the result of the check and exit with the Nagios code
+func (cc *CheckCommand) Execute(args []string) error {
+	ctl := CtlCommand{ServerURL: cc.ServerURL, User: cc.User, Password: cc.Password}
+	rpcc := ctl.createRPCClient()
+	rpcc.SetTimeout(cc.Timeout)
+	status, output := cc.check(rpcc)
+	fmt.Printf("SUPERVISORD %s - %s\n", checkStatusNames[status], output)
+	os.Exit(status)
+	return nil
+}
+
+func init() {
+	parser.AddCommand("check",
+		"check the programs like a Nagios plugin",
+		"The check subcommand gets the state of the programs from the supervisord at the serverurl and exits with the codes of the Nagios and Icinga plugins (0 OK, 1 WARNING, 2 CRITICAL, 3 UNKNOWN), printing the status with the uptime and restarts of the programs as perfdata",
+		&checkCommand)
+}
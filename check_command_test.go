@@ -0,0 +1,48 @@
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"supervisord/internal/testutil"
+
+	"github.com/ochinchina/supervisord/xmlrpcclient"
+)
+
+func TestCheckCommand(t *testing.T) {
+	dir := testutil.TempDir(t)
+	program := "command=%[2]s\nautostart=false\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n"
+	content := testSupervisordSection + "\n" +
+		"[program:web]\n" + program + "\n[program:db]\n" + program
+	s := startConfSupervisor(t, dir, fmt.Sprintf(content, dir, testutil.FakeProgram(t, dir, testutil.Sleep)))
+	s.GetManager().Find("web").Start(true)
+	rpcc := s.xmlRPC.NewInMemoryClient(s)
+
+	cc := CheckCommand{Programs: []string{"web"}, CriticalStates: "FATAL,EXITED", WarningStates: "BACKOFF,STOPPED"}
+	status, output := cc.check(rpcc)
+	if status != checkOK || !strings.HasPrefix(output, "1 of 1 programs running | running=1;;;0;1 'web_uptime'=") || !strings.Contains(output, " 'web_restarts'=") {
+		t.Errorf("fail to check the running program: %d %q", status, output)
+	}
+	cc.Programs = nil
+	if status, output = cc.check(rpcc); status != checkWarning || !strings.HasPrefix(output, "db STOPPED; 1 of 2 programs running | running=1;;;0;2") {
+		t.Errorf("fail to warn about the stopped program: %d %q", status, output)
+	}
+	cc.CriticalStates = "stopped"
+	if status, output = cc.check(rpcc); status != checkCritical {
+		t.Errorf("fail to raise the critical status: %d %q", status, output)
+	}
+	cc.Programs = []string{"db:db", "cache"}
+	if status, output = cc.check(rpcc); status != checkUnknown || output != "no program cache" {
+		t.Errorf("fail to report the unknown program: %d %q", status, output)
+	}
+
+	unreachable := xmlrpcclient.NewXMLRPCClient("http://127.0.0.1:1", false)
+	unreachable.SetTimeout(time.Second)
+	if status, _ = cc.check(unreachable); status != checkUnknown {
+		t.Errorf("fail to report the unreachable supervisord: %d", status)
+	}
+}
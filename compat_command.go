@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ochinchina/supervisord/config"
+)
+
+// CheckCompatCommand implements flags.Commander interface
+type CheckCompatCommand struct {
+}
+
+var checkCompatCommand CheckCompatCommand
+
+// Execute report the options of the Python Supervisor configuration which
+// are not supported or behave differently, exit with 1 if there are any
+func (cc *CheckCompatCommand) Execute(args []string) error {
+	if len(args) != 1 {
+		return exitOnError(fmt.Errorf("usage: supervisord check-compat supervisord.conf"))
+	}
+	issues, err := config.CheckCompat(args[0])
+	if err != nil {
+		return exitOnError(err)
+	}
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	if len(issues) > 0 {
+		return exitOnError(fmt.Errorf("options of %s not fully compatible: %d", args[0], len(issues)))
+	}
+	fmt.Printf("all the options of %s are compatible\n", args[0])
+	return nil
+}
+
+func init() {
+	parser.AddCommand("check-compat",
+		"check the options of a Python Supervisor configuration",
+		"The check-compat subcommand reports the options of the Python Supervisor configuration file which are unsupported, partially supported or behave differently, with their suggested equivalents",
+		&checkCompatCommand)
+}
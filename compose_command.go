@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ochinchina/supervisord/config"
+)
+
+// ImportComposeCommand implements flags.Commander interface
+type ImportComposeCommand struct {
+	OutFile string `short:"o" long:"output" description:"the output configuration file, stdout by default"`
+}
+
+var importComposeCommand ImportComposeCommand
+
+// Execute convert the services of the docker-compose file to the program sections
+func (ic *ImportComposeCommand) Execute(args []string) error {
+	if len(args) > 1 {
+		return exitOnError(fmt.Errorf("usage: supervisord import-compose [-o supervisord.conf] [docker-compose.yml]"))
+	}
+	fileName := "docker-compose.yml"
+	if len(args) == 1 {
+		fileName = args[0]
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return exitOnError(err)
+	}
+	defer f.Close()
+	compose, err := config.ParseCompose(f)
+	if err != nil {
+		return exitOnError(fmt.Errorf("invalid docker-compose file %s: %v", fileName, err))
+	}
+	out, err := createOutput(ic.OutFile)
+	if err != nil {
+		return exitOnError(err)
+	}
+	defer out.Close()
+	return exitOnError(config.ComposeToIni(compose, out))
+}
+
+func init() {
+	parser.AddCommand("import-compose",
+		"convert the services of a docker-compose file to the program sections",
+		"The import-compose subcommand writes a program section for each service of the docker-compose file (docker-compose.yml by default) with its command, environment, depends_on and restart policy",
+		&importComposeCommand)
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	ini "github.com/ochinchina/go-ini"
+)
+
+// the levels of the compatibility issues
+const (
+	// CompatUnsupported the option is ignored
+	CompatUnsupported = "unsupported"
+	// CompatPartial the option is supported with some values only
+	CompatPartial = "partial"
+	// CompatDifferent the option is supported but behaves differently
+	CompatDifferent = "different"
+)
+
+// CompatIssue an option of the Python Supervisor configuration which is not
+// supported or behaves differently, with the suggested equivalent
+type CompatIssue struct {
+	Section    string
+	Key        string
+	Level      string
+	Message    string
+	Suggestion string
+}
+
+func (issue CompatIssue) String() string {
+	where := fmt.Sprintf("[%s]", issue.Section)
+	if issue.Key != "" {
+		where += " " + issue.Key
+	}
+	s := fmt.Sprintf("%s: %s: %s", where, issue.Level, issue.Message)
+	if issue.Suggestion != "" {
+		s += ", " + issue.Suggestion
+	}
+	return s
+}
+
+// the compatibility of an option, check returns false if the value of the
+// option is supported, nil check reports the option whatever its value
+type compatRule struct {
+	level      string
+	message    string
+	suggestion string
+	check      func(value string) bool
+}
+
+// the log files handled by Python Supervisor only
+func isSpecialLogFile(value string) bool {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	return value == "AUTO" || value == "NONE"
+}
+
+// the options of Python Supervisor without the same behaviour, by section type
+var compatRules = map[string]map[string]compatRule{
+	"supervisord": {
+		"logfile_maxbytes": {level: CompatUnsupported, message: "the log of supervisord is always rotated at 50MB"},
+		"logfile_backups":  {level: CompatUnsupported, message: "10 rotated logs of supervisord are always kept"},
+		"loglevel": {level: CompatDifferent, message: "trace and blather are logged as debug",
+			check: func(value string) bool { return value == "trace" || value == "blather" }},
+		"umask":    {level: CompatUnsupported, message: "the umask is inherited", suggestion: "set it before starting supervisord (umask in the shell or the container entrypoint)"},
+		"nodaemon": {level: CompatUnsupported, message: "supervisord runs in the foreground unless it is started with the -d option"},
+		"silent": {level: CompatDifferent, message: "the log is written to the logfile only, like silent=true", suggestion: "set logfile=/dev/stdout to see it in the foreground",
+			check: func(value string) bool { return value == "false" }},
+		"nocleanup":   {level: CompatUnsupported, message: "there are no AUTO child logs to clean up"},
+		"childlogdir": {level: CompatUnsupported, message: "there are no AUTO child logs", suggestion: "set the stdout_logfile and stderr_logfile of the programs"},
+		"user":        {level: CompatUnsupported, message: "supervisord does not switch to another user", suggestion: "start it as this user or set the user of the programs"},
+		"directory":   {level: CompatUnsupported, message: "supervisord does not change its directory", suggestion: "set the directory of the programs"},
+		"strip_ansi":  {level: CompatUnsupported, message: "the escape sequences are kept in the logs"},
+		"environment": {level: CompatUnsupported, message: "the environment is not passed to the programs", suggestion: "set it in the environment of the [program-default] section or use --env-file"},
+	},
+	"program": {
+		"umask":          {level: CompatUnsupported, message: "the umask of supervisord is inherited"},
+		"serverurl":      {level: CompatUnsupported, message: "SUPERVISOR_SERVER_URL is not set in the environment of the program"},
+		"stdout_syslog":  {level: CompatUnsupported, message: "the output is not sent to syslog", suggestion: "set stdout_logfile=syslog"},
+		"stderr_syslog":  {level: CompatUnsupported, message: "the output is not sent to syslog", suggestion: "set stderr_logfile=syslog"},
+		"stdout_logfile": {level: CompatPartial, message: "AUTO and NONE are taken as file names", suggestion: "set a file name or /dev/null", check: isSpecialLogFile},
+		"stderr_logfile": {level: CompatPartial, message: "AUTO and NONE are taken as file names", suggestion: "set a file name or /dev/null", check: isSpecialLogFile},
+	},
+	"eventlistener": {
+		"result_handler": {level: CompatUnsupported, message: "only the default handler of the OK and FAIL results is available"},
+		"umask":          {level: CompatUnsupported, message: "the umask of supervisord is inherited"},
+		"stdout_syslog":  {level: CompatUnsupported, message: "the output is not sent to syslog"},
+		"stderr_syslog":  {level: CompatUnsupported, message: "the output is not sent to syslog", suggestion: "set stderr_logfile=syslog"},
+	},
+	"unix_http_server": {
+		"chmod": {level: CompatUnsupported, message: "the socket is created with the default mode", suggestion: "restrict the directory of the socket or set a username and password"},
+		"chown": {level: CompatUnsupported, message: "the socket is owned by the user of supervisord"},
+	},
+	"inet_http_server": {
+		"port": {level: CompatPartial, message: "the \"*\" host is not accepted", suggestion: "write \":port\" to listen on all the interfaces",
+			check: func(value string) bool { return strings.HasPrefix(value, "*:") }},
+	},
+	"supervisorctl": {
+		"prompt":       {level: CompatUnsupported, message: "supervisord ctl has no interactive shell"},
+		"history_file": {level: CompatUnsupported, message: "supervisord ctl has no interactive shell"},
+	},
+}
+
+// the sections of Python Supervisor without equivalent
+var compatSections = map[string]CompatIssue{
+	"fcgi-program": {Level: CompatUnsupported, Message: "the FastCGI programs are not supported", Suggestion: "run the FastCGI server as a program listening on its own socket"},
+	"rpcinterface": {Level: CompatUnsupported, Message: "the RPC interface plugins are not loaded, the supervisor and system namespaces are built in"},
+}
+
+// get the type of the section, like "program" for "program:x"
+func sectionType(name string) string {
+	if i := strings.Index(name, ":"); i != -1 {
+		return name[:i]
+	}
+	return name
+}
+
+// CheckCompat report the options of the Python Supervisor configuration file
+// which are not supported, partially supported or behave differently. The
+// included files are checked too and the options are reported in the order
+// of the section names and of their names
+func CheckCompat(fileName string) ([]CompatIssue, error) {
+	cfg := ini.NewIni()
+	cfg.LoadFile(fileName)
+	for _, f := range NewConfig(fileName).getIncludeFiles(cfg) {
+		cfg.LoadFile(f)
+	}
+	sections := cfg.Sections()
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("no section in %s", fileName)
+	}
+	sort.Slice(sections, func(i, j int) bool { return sections[i].Name < sections[j].Name })
+	issues := make([]CompatIssue, 0)
+	for _, section := range sections {
+		typ := sectionType(section.Name)
+		if issue, ok := compatSections[typ]; ok {
+			issue.Section = section.Name
+			issues = append(issues, issue)
+			continue
+		}
+		rules := compatRules[typ]
+		keys := section.Keys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Name() < keys[j].Name() })
+		for _, key := range keys {
+			rule, ok := rules[key.Name()]
+			if !ok {
+				continue
+			}
+			value, _ := key.Value()
+			if rule.check != nil && !rule.check(strings.TrimSpace(value)) {
+				continue
+			}
+			issues = append(issues, CompatIssue{Section: section.Name, Key: key.Name(), Level: rule.level, Message: rule.message, Suggestion: rule.suggestion})
+		}
+	}
+	return issues, nil
+}
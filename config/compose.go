@@ -0,0 +1,213 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ComposeService a service of the docker-compose file, only the fields
+// converted to the program sections are decoded
+type ComposeService struct {
+	Image       string      `yaml:"image"`
+	Command     interface{} `yaml:"command"`
+	Entrypoint  interface{} `yaml:"entrypoint"`
+	Environment interface{} `yaml:"environment"`
+	DependsOn   interface{} `yaml:"depends_on"`
+	Restart     string      `yaml:"restart"`
+	WorkingDir  string      `yaml:"working_dir"`
+	User        string      `yaml:"user"`
+}
+
+// ComposeFile the services of the docker-compose file
+type ComposeFile struct {
+	Services map[string]ComposeService `yaml:"services"`
+}
+
+// ParseCompose parse the services of the docker-compose file
+func ParseCompose(reader io.Reader) (*ComposeFile, error) {
+	b, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	compose := &ComposeFile{}
+	if err = yaml.Unmarshal(b, compose); err != nil {
+		return nil, err
+	}
+	if len(compose.Services) == 0 {
+		return nil, fmt.Errorf("no services defined")
+	}
+	return compose, nil
+}
+
+// ComposeToIni convert the services to program sections in the order of
+// their names. The services without command nor entrypoint are skipped
+// with a comment because the default command of their image is unknown
+func ComposeToIni(compose *ComposeFile, writer io.Writer) error {
+	names := make([]string, 0, len(compose.Services))
+	for name := range compose.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	converted := make(map[string]bool)
+	sections := make(map[string]string)
+	for _, name := range names {
+		section, err := composeServiceToIni(name, compose.Services[name])
+		if err != nil {
+			return fmt.Errorf("service %s: %v", name, err)
+		}
+		if section != "" {
+			converted[name] = true
+			sections[name] = section
+		}
+	}
+	for _, name := range names {
+		service := compose.Services[name]
+		if !converted[name] {
+			fmt.Fprintf(writer, "; the service %s (image %s) has no command nor entrypoint, it is skipped\n\n", name, service.Image)
+			continue
+		}
+		dependsOn := make([]string, 0)
+		for _, dep := range composeStrings(service.DependsOn) {
+			if converted[dep] {
+				dependsOn = append(dependsOn, dep)
+			}
+		}
+		fmt.Fprint(writer, sections[name])
+		if len(dependsOn) > 0 {
+			fmt.Fprintf(writer, "depends_on=%s\n", strings.Join(dependsOn, ","))
+		}
+		fmt.Fprintln(writer)
+	}
+	return nil
+}
+
+// convert the service to the program section without its depends_on, an
+// empty section is returned if the service has no command
+func composeServiceToIni(name string, service ComposeService) (string, error) {
+	command, err := composeCommand(service.Entrypoint, service.Command)
+	if err != nil || command == "" {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[program:%s]\ncommand=%s\n", name, command)
+	if service.WorkingDir != "" {
+		fmt.Fprintf(&b, "directory=%s\n", service.WorkingDir)
+	}
+	if service.User != "" {
+		fmt.Fprintf(&b, "user=%s\n", service.User)
+	}
+	env, err := composeEnvironment(service.Environment)
+	if err != nil {
+		return "", err
+	}
+	if len(env) > 0 {
+		fmt.Fprintf(&b, "environment=%s\n", formatEnv(env))
+	}
+	// the restart policy of docker: "no" (default), "always",
+	// "unless-stopped" or "on-failure[:max-retries]"
+	switch restart := service.Restart; {
+	case restart == "" || restart == "no":
+		b.WriteString("autorestart=false\n")
+	case restart == "always" || restart == "unless-stopped":
+		b.WriteString("autorestart=true\n")
+	case restart == "on-failure":
+		b.WriteString("autorestart=unexpected\n")
+	case strings.HasPrefix(restart, "on-failure:"):
+		fmt.Fprintf(&b, "autorestart=unexpected\nstartretries=%s\n", strings.TrimPrefix(restart, "on-failure:"))
+	default:
+		return "", fmt.Errorf("unknown restart policy %s", restart)
+	}
+	return b.String(), nil
+}
+
+// get the command line of the entrypoint followed by the command, each of
+// them is a string split like a shell or a list of arguments
+func composeCommand(entrypoint interface{}, command interface{}) (string, error) {
+	parts := make([]string, 0)
+	for _, value := range []interface{}{entrypoint, command} {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			if strings.TrimSpace(v) != "" {
+				parts = append(parts, strings.TrimSpace(v))
+			}
+		case []interface{}:
+			for _, arg := range v {
+				quoted, err := quoteArgument(fmt.Sprint(arg))
+				if err != nil {
+					return "", err
+				}
+				parts = append(parts, quoted)
+			}
+		default:
+			return "", fmt.Errorf("invalid command %v", value)
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// quote the argument of the command line if it contains spaces or quotes
+func quoteArgument(arg string) (string, error) {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\") {
+		return arg, nil
+	}
+	return quoteShellCommand(arg)
+}
+
+// get the environment given as a list of "KEY=value" or as a map, the
+// variables without value are taken from the environment of supervisord
+func composeEnvironment(value interface{}) (map[string]string, error) {
+	env := make(map[string]string)
+	switch v := value.(type) {
+	case nil:
+	case []interface{}:
+		for _, item := range v {
+			kv := strings.SplitN(fmt.Sprint(item), "=", 2)
+			if len(kv) == 2 {
+				env[kv[0]] = kv[1]
+			} else {
+				env[kv[0]] = fmt.Sprintf("%%(ENV_%s)s", kv[0])
+			}
+		}
+	case map[interface{}]interface{}:
+		for k, item := range v {
+			key := fmt.Sprint(k)
+			if item == nil {
+				env[key] = fmt.Sprintf("%%(ENV_%s)s", key)
+			} else {
+				env[key] = fmt.Sprint(item)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid environment %v", value)
+	}
+	for k, v := range env {
+		if strings.Contains(v, "\"") {
+			return nil, fmt.Errorf("the value of the environment variable %s contains double quotes", k)
+		}
+	}
+	return env, nil
+}
+
+// get the strings of a list or the keys of a map, like the depends_on
+// short and long syntaxes
+func composeStrings(value interface{}) []string {
+	result := make([]string, 0)
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			result = append(result, fmt.Sprint(item))
+		}
+	case map[interface{}]interface{}:
+		for k := range v {
+			result = append(result, fmt.Sprint(k))
+		}
+		sort.Strings(result)
+	}
+	return result
+}
@@ -2,15 +2,17 @@ package config
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
 	ini "github.com/ochinchina/go-ini"
+	"github.com/ochinchina/supervisord/secret"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -19,6 +21,9 @@ type Entry struct {
 	ConfigDir string
 	Group     string
 	Name      string
+	// the name of the section of the entry, "program:x" for the processes
+	// x_00 and x_01 of a program with numprocs
+	Section   string
 	keyValues map[string]string
 }
 
@@ -61,6 +66,19 @@ func (c *Entry) GetGroupName() string {
 	return ""
 }
 
+// IsNode return true if this section is a child supervisord node
+func (c *Entry) IsNode() bool {
+	return strings.HasPrefix(c.Name, "node:")
+}
+
+// GetNodeName get the name of the child supervisord node
+func (c *Entry) GetNodeName() string {
+	if strings.HasPrefix(c.Name, "node:") {
+		return c.Name[len("node:"):]
+	}
+	return ""
+}
+
 // GetPrograms get the programs from the group
 func (c *Entry) GetPrograms() []string {
 	if c.IsGroup() {
@@ -87,6 +105,17 @@ func (c *Entry) String() string {
 
 }
 
+// SectionError the error of a section in the configuration file
+type SectionError struct {
+	Section string
+	Err     error
+}
+
+// Error implements error interface
+func (e *SectionError) Error() string {
+	return fmt.Sprintf("[%s]: %v", e.Section, e.Err)
+}
+
 // Config memory reprentations of supervisor configuration file
 type Config struct {
 	configFile string
@@ -98,7 +127,7 @@ type Config struct {
 
 // NewEntry create a configuration entry
 func NewEntry(configDir string) *Entry {
-	return &Entry{configDir, "", "", make(map[string]string)}
+	return &Entry{configDir, "", "", "", make(map[string]string)}
 }
 
 // NewConfig create Config object
@@ -120,17 +149,97 @@ func (c *Config) createEntry(name string, configDir string) *Entry {
 //
 // Load load the configuration and return the loaded programs
 func (c *Config) Load() ([]string, error) {
-	ini := ini.NewIni()
+	cfg, err := c.loadIni("", nil)
+	if err != nil {
+		return nil, err
+	}
 	c.ProgramGroup = NewProcessGroup()
-	log.WithFields(log.Fields{"file": c.configFile}).Info("load configuration from file")
-	ini.LoadFile(c.configFile)
-
-	includeFiles := c.getIncludeFiles(ini)
-	for _, f := range includeFiles {
+	return c.parse(cfg)
+}
+
+// load the configuration file and its include files, the content is loaded
+// instead of the file fileName (or in addition to the files if fileName is a
+// new file) if it is not nil
+func (c *Config) loadIni(fileName string, content []byte) (*ini.Ini, error) {
+	cfg := ini.NewIni()
+	loadFile := func(f string) {
+		if content != nil && isSameFile(f, fileName) {
+			cfg.LoadBytes(content)
+			return
+		}
 		log.WithFields(log.Fields{"file": f}).Info("load configuration from file")
-		ini.LoadFile(f)
+		cfg.LoadFile(f)
+	}
+	// the values of the defaults file are overridden by the configuration files
+	if defaultsFile := getDefaultsFile(c.configFile); defaultsFile != "" {
+		log.WithFields(log.Fields{"file": defaultsFile}).Info("load the defaults from file")
+		cfg.LoadFile(defaultsFile)
+	}
+	if IsProcfile(c.configFile) {
+		log.WithFields(log.Fields{"file": c.configFile}).Info("load configuration from file")
+		content, err := loadProcfile(c.configFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.LoadString(content)
+	} else {
+		loadFile(c.configFile)
+	}
+
+	loaded := content == nil || isSameFile(c.configFile, fileName)
+	for _, f := range c.getIncludeFiles(cfg) {
+		loaded = loaded || isSameFile(f, fileName)
+		loadFile(f)
 	}
-	return c.parse(ini), nil
+	// the file to be created
+	if !loaded {
+		cfg.LoadBytes(content)
+	}
+	if err := c.decryptValues(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// decrypt the encrypted values "enc:..." with the key file set by the
+// secret_key_file in [supervisord] section
+func (c *Config) decryptValues(cfg *ini.Ini) error {
+	var key *secret.Key
+	for _, section := range cfg.Sections() {
+		for _, k := range section.Keys() {
+			value := k.ValueWithDefault("")
+			if !secret.IsEncrypted(value) {
+				continue
+			}
+			if key == nil {
+				var err error
+				if key, err = c.loadSecretKey(cfg); err != nil {
+					return &SectionError{Section: section.Name, Err: err}
+				}
+			}
+			decrypted, err := key.DecryptText(value)
+			if err != nil {
+				return &SectionError{Section: section.Name, Err: fmt.Errorf("fail to decrypt %s: %v", k.Name(), err)}
+			}
+			section.Add(k.Name(), decrypted)
+		}
+	}
+	return nil
+}
+
+func (c *Config) loadSecretKey(cfg *ini.Ini) (*secret.Key, error) {
+	keyFile := ""
+	if section, err := cfg.GetSection("supervisord"); err == nil {
+		keyFile = section.GetValueWithDefault("secret_key_file", "")
+	}
+	if keyFile == "" {
+		return nil, errors.New("there are encrypted values but no secret_key_file in [supervisord]")
+	}
+	keyFile, err := NewStringExpression("here", c.GetConfigFileDir()).Eval(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return secret.LoadKeyFile(keyFile)
 }
 
 func (c *Config) getIncludeFiles(cfg *ini.Ini) []string {
@@ -168,10 +277,16 @@ func (c *Config) getIncludeFiles(cfg *ini.Ini) []string {
 
 }
 
-func (c *Config) parse(cfg *ini.Ini) []string {
+func (c *Config) parse(cfg *ini.Ini) ([]string, error) {
+	if err := c.parseGroup(cfg); err != nil {
+		return nil, err
+	}
+	c.setGroupEnvironment(cfg)
 	c.setProgramDefaultParams(cfg)
-	c.parseGroup(cfg)
-	loadedPrograms := c.parseProgram(cfg)
+	loadedPrograms, err := c.parseProgram(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	//parse non-group,non-program and non-eventlistener sections
 	for _, section := range cfg.Sections() {
@@ -181,7 +296,7 @@ func (c *Config) parse(cfg *ini.Ini) []string {
 			entry.parse(section)
 		}
 	}
-	return loadedPrograms
+	return loadedPrograms, nil
 }
 
 // set the default parameteres of programs
@@ -202,6 +317,52 @@ func (c *Config) setProgramDefaultParams(cfg *ini.Ini) {
 	}
 }
 
+// merge the environment of the group section into the environment of its
+// programs, the variables of the program win. The environment of the
+// program-default section is used for the programs without environment
+func (c *Config) setGroupEnvironment(cfg *ini.Ini) {
+	groupEnvs := make(map[string]map[string]string)
+	for _, section := range cfg.Sections() {
+		if strings.HasPrefix(section.Name, "group:") && section.HasKey("environment") {
+			groupEnvs[section.Name[len("group:"):]] = *parseEnv(section.GetValueWithDefault("environment", ""))
+		}
+	}
+	if len(groupEnvs) == 0 {
+		return
+	}
+	defaultEnv := ""
+	if defaultSection, err := cfg.GetSection("program-default"); err == nil {
+		defaultEnv = defaultSection.GetValueWithDefault("environment", "")
+	}
+	for _, section := range cfg.Sections() {
+		programOrEventListener, prefix := c.isProgramOrEventListener(section)
+		if !programOrEventListener {
+			continue
+		}
+		programName := section.Name[len(prefix):]
+		env := make(map[string]string)
+		for group, groupEnv := range groupEnvs {
+			if c.ProgramGroup.InGroup(programName, group) {
+				for k, v := range groupEnv {
+					env[k] = v
+				}
+			}
+		}
+		if len(env) == 0 {
+			continue
+		}
+		for k, v := range *parseEnv(section.GetValueWithDefault("environment", defaultEnv)) {
+			env[k] = v
+		}
+		section.Add("environment", formatEnv(env))
+	}
+}
+
+// GetConfigFile get the path of supervisor configuration file
+func (c *Config) GetConfigFile() string {
+	return c.configFile
+}
+
 // GetConfigFileDir get the directory of supervisor configuration file
 func (c *Config) GetConfigFileDir() string {
 	return filepath.Dir(c.configFile)
@@ -211,10 +372,10 @@ func (c *Config) GetConfigFileDir() string {
 func toRegexp(pattern string) string {
 	tmp := strings.Split(pattern, ".")
 	for i, t := range tmp {
-		s := strings.Replace(t, "*", ".*", -1)
-		tmp[i] = strings.Replace(s, "?", ".", -1)
+		s := strings.Replace(regexp.QuoteMeta(t), "\\*", ".*", -1)
+		tmp[i] = strings.Replace(s, "\\?", ".", -1)
 	}
-	return strings.Join(tmp, "\\.")
+	return "^" + strings.Join(tmp, "\\.") + "$"
 }
 
 // GetUnixHTTPServer get the unix_http_server section
@@ -278,6 +439,13 @@ func (c *Config) GetEventListeners() []*Entry {
 	return eventListeners
 }
 
+// GetNodes get the child supervisord nodes
+func (c *Config) GetNodes() []*Entry {
+	return c.GetEntries(func(entry *Entry) bool {
+		return entry.IsNode()
+	})
+}
+
 // GetProgramNames get all the program names
 func (c *Config) GetProgramNames() []string {
 	result := make([]string, 0)
@@ -292,6 +460,10 @@ func (c *Config) GetProgramNames() []string {
 
 // GetProgram return the proram configure entry or nil
 func (c *Config) GetProgram(name string) *Entry {
+	// the program entries are stored by the program name
+	if entry, ok := c.entries[name]; ok && entry.IsProgram() && entry.GetProgramName() == name {
+		return entry
+	}
 	for _, entry := range c.entries {
 		if entry.IsProgram() && entry.GetProgramName() == name {
 			return entry
@@ -319,9 +491,12 @@ func (c *Entry) HasParameter(key string) bool {
 	return ok
 }
 
+const maxInt = int(^uint(0) >> 1)
+
 func toInt(s string, factor int, defValue int) int {
 	i, err := strconv.Atoi(s)
-	if err == nil {
+	// the value out of range is invalid
+	if err == nil && i <= maxInt/factor && i >= -maxInt/factor {
 		return i * factor
 	}
 	return defValue
@@ -341,42 +516,55 @@ func parseEnv(s string) *map[string]string {
 	result := make(map[string]string)
 	start := 0
 	n := len(s)
-	var i int
-	for {
-		for i = start; i < n && s[i] != '='; {
-			i++
+	for start < n {
+		i := strings.IndexByte(s[start:], '=')
+		// no more key=value
+		if i == -1 {
+			break
 		}
-		key := s[start:i]
-		start = i + 1
-		if s[start] == '"' {
-			for i = start + 1; i < n && s[i] != '"'; {
-				i++
-			}
-			if i < n {
-				result[strings.TrimSpace(key)] = strings.TrimSpace(s[start+1 : i])
+		key := strings.TrimSpace(s[start : start+i])
+		start += i + 1
+		if start < n && s[start] == '"' {
+			end := strings.IndexByte(s[start+1:], '"')
+			// the quoted value is not closed
+			if end == -1 {
+				break
 			}
-			if i+1 < n && s[i+1] == ',' {
-				start = i + 2
+			result[key] = strings.TrimSpace(s[start+1 : start+1+end])
+			start += end + 2
+			if start < n && s[start] == ',' {
+				start++
 			} else {
 				break
 			}
 		} else {
-			for i = start; i < n && s[i] != ','; {
-				i++
-			}
-			if i < n {
-				result[strings.TrimSpace(key)] = strings.TrimSpace(s[start:i])
-				start = i + 1
-			} else {
-				result[strings.TrimSpace(key)] = strings.TrimSpace(s[start:])
+			end := strings.IndexByte(s[start:], ',')
+			if end == -1 {
+				result[key] = strings.TrimSpace(s[start:])
 				break
 			}
+			result[key] = strings.TrimSpace(s[start : start+end])
+			start += end + 1
 		}
 	}
 
 	return &result
 }
 
+// formatEnv convert the environment to the string parsed by parseEnv, the
+// values are quoted
+func formatEnv(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = fmt.Sprintf("%s=\"%s\"", k, env[k])
+	}
+	return strings.Join(keys, ",")
+}
+
 // GetEnv get the value of key as environment setting. An environment string example:
 //  environment = A="env 1",B="this is a test"
 func (c *Entry) GetEnv(key string) []string {
@@ -384,7 +572,14 @@ func (c *Entry) GetEnv(key string) []string {
 	result := make([]string, 0)
 
 	if ok {
-		for k, v := range *parseEnv(value) {
+		env := *parseEnv(value)
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := env[k]
 			tmp, err := NewStringExpression("program_name", c.GetProgramName(),
 				"process_num", c.GetString("process_num", "0"),
 				"group_name", c.GetGroupName(),
@@ -424,15 +619,12 @@ func (c *Entry) GetStringExpression(key string, defValue string) string {
 		return ""
 	}
 
-	hostName, err := os.Hostname()
-	if err != nil {
-		hostName = "Unknown"
-	}
+	// the host name is looked up only if it is used, "Unknown" if it can't be got
 	result, err := NewStringExpression("program_name", c.GetProgramName(),
 		"process_num", c.GetString("process_num", "0"),
 		"group_name", c.GetGroupName(),
 		"here", c.ConfigDir,
-		"host_node_name", hostName).Eval(s)
+		"host_node_name", "Unknown").Eval(s)
 
 	if err != nil {
 		log.WithFields(log.Fields{
@@ -484,12 +676,21 @@ func (c *Entry) GetBytes(key string, defValue int) int {
 
 func (c *Entry) parse(section *ini.Section) {
 	c.Name = section.Name
+	c.Section = section.Name
 	for _, key := range section.Keys() {
 		c.keyValues[key.Name()] = strings.TrimSpace(key.ValueWithDefault(""))
 	}
 }
 
-func (c *Config) parseGroup(cfg *ini.Ini) {
+// parse the groups, a name in the programs of a group is a nested group if
+// there is a group section with this name
+func (c *Config) parseGroup(cfg *ini.Ini) error {
+	groups := make(map[string]bool)
+	for _, section := range cfg.Sections() {
+		if strings.HasPrefix(section.Name, "group:") {
+			groups[section.Name[len("group:"):]] = true
+		}
+	}
 
 	//parse the group at first
 	for _, section := range cfg.Sections() {
@@ -499,10 +700,18 @@ func (c *Config) parseGroup(cfg *ini.Ini) {
 			groupName := entry.GetGroupName()
 			programs := entry.GetPrograms()
 			for _, program := range programs {
-				c.ProgramGroup.Add(groupName, program)
+				if program != groupName && groups[program] {
+					c.ProgramGroup.AddSubGroup(groupName, program)
+				} else {
+					c.ProgramGroup.Add(groupName, program)
+				}
 			}
 		}
 	}
+	if cycle := c.ProgramGroup.FindCycle(); cycle != nil {
+		return &SectionError{Section: "group:" + cycle[0], Err: fmt.Errorf("the groups reference each other: %s", strings.Join(cycle, " -> "))}
+	}
+	return nil
 }
 
 func (c *Config) isProgramOrEventListener(section *ini.Section) (bool, string) {
@@ -520,14 +729,27 @@ func (c *Config) isProgramOrEventListener(section *ini.Section) (bool, string) {
 
 // parse the sections starts with "program:" prefix.
 //
-// Return all the parsed program names in the ini
-func (c *Config) parseProgram(cfg *ini.Ini) []string {
+// Return all the parsed program names in the ini, the programs disabled by
+// their enable_if are skipped
+func (c *Config) parseProgram(cfg *ini.Ini) ([]string, error) {
 	loadedPrograms := make([]string, 0)
 	for _, section := range cfg.Sections() {
 		programOrEventListener, prefix := c.isProgramOrEventListener(section)
 
 		//if it is program or event listener
 		if programOrEventListener {
+			enabled, err := evalEnableIf(section.GetValueWithDefault("enable_if", ""))
+			if err != nil {
+				return nil, &SectionError{Section: section.Name, Err: err}
+			}
+			if !enabled {
+				log.WithFields(log.Fields{"section": section.Name}).Info("the program is disabled by its enable_if")
+				continue
+			}
+			if !inActiveProfiles(section.GetValueWithDefault("profiles", "")) {
+				log.WithFields(log.Fields{"section": section.Name}).Info("the program is not in the selected profiles")
+				continue
+			}
 			//get the number of processes
 			numProcs, err := section.GetInt("numprocs")
 			programName := section.Name[len(prefix):]
@@ -592,7 +814,7 @@ func (c *Config) parseProgram(cfg *ini.Ini) []string {
 			}
 		}
 	}
-	return loadedPrograms
+	return loadedPrograms, nil
 }
 
 // String convert the configuration to string represents
@@ -610,3 +832,24 @@ func (c *Config) RemoveProgram(programName string) {
 	delete(c.entries, programName)
 	c.ProgramGroup.Remove(programName)
 }
+
+// AddGroup add the programs of the group, and the section of the group, from
+// the other configuration and return the names of the added programs
+func (c *Config) AddGroup(other *Config, group string) []string {
+	added := make([]string, 0)
+	for name, entry := range other.entries {
+		if entry.IsProgram() && entry.Group == group {
+			c.entries[name] = entry
+			added = append(added, entry.GetProgramName())
+		} else if entry.IsGroup() && entry.GetGroupName() == group {
+			c.entries[name] = entry
+		}
+	}
+	other.ProgramGroup.ForEachProcess(func(groupName string, procName string) {
+		if groupName == group {
+			c.ProgramGroup.Add(groupName, procName)
+		}
+	})
+	sort.Strings(added)
+	return added
+}
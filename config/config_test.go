@@ -1,12 +1,18 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"strings"
 	"testing"
+	"testing/quick"
+
+	"github.com/ochinchina/supervisord/secret"
 )
 
 func createTmpFile() (string, error) {
@@ -131,6 +137,236 @@ func TestProgramInGroup(t *testing.T) {
 	}
 }
 
+func TestGroupEnvironment(t *testing.T) {
+	config, _ := parse([]byte("[program-default]\nenvironment=C=default\n[group:workers]\nprograms=worker1,worker2\nenvironment=A=group,B=\"group, shared\"\n[program:worker1]\nenvironment=A=program\n[program:worker2]\n[program:web]\n"))
+	envs := config.GetProgram("worker1").GetEnv("environment")
+	if len(envs) != 2 || envs[0] != "A=program" || envs[1] != "B=group, shared" {
+		t.Error("fail to merge the group environment with the program environment")
+	}
+	envs = config.GetProgram("worker2").GetEnv("environment")
+	if len(envs) != 3 || envs[0] != "A=group" || envs[1] != "B=group, shared" || envs[2] != "C=default" {
+		t.Error("fail to merge the group environment with the default environment")
+	}
+	envs = config.GetProgram("web").GetEnv("environment")
+	if len(envs) != 1 || envs[0] != "C=default" {
+		t.Error("the group environment should not apply to the programs out of the group")
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	content := []byte("[program:web]\nprofiles=frontend\n[program:api]\nprofiles=backend, frontend\n[program:db]\nprofiles=backend\n[program:cron]\n")
+	defer SetActiveProfiles(nil)
+	SetActiveProfiles([]string{"frontend"})
+	config, _ := parse(content)
+	if config.GetProgram("web") == nil || config.GetProgram("api") == nil || config.GetProgram("cron") == nil || config.GetProgram("db") != nil {
+		t.Error("fail to load the programs of the profile")
+	}
+	SetActiveProfiles([]string{"x", "backend"})
+	config, _ = parse(content)
+	if config.GetProgram("web") != nil || config.GetProgram("db") == nil {
+		t.Error("fail to load the programs of the profiles")
+	}
+	SetActiveProfiles(nil)
+	config, _ = parse(content)
+	if len(config.GetProgramNames()) != 4 {
+		t.Error("fail to load all the programs without profile")
+	}
+}
+
+func TestProcfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "procfile")
+	if err != nil {
+		t.Fatal("fail to create temporary directory")
+	}
+	defer os.RemoveAll(dir)
+	procfile := filepath.Join(dir, "Procfile.dev")
+	ioutil.WriteFile(procfile, []byte("# the web server\nweb: bundle exec rails s -p $PORT\n\nworker: echo \"hello\"\n"), 0644)
+	config := NewConfig(procfile)
+	if _, err := config.Load(); err != nil {
+		t.Fatalf("fail to load the Procfile: %v", err)
+	}
+	web, worker := config.GetProgram("web"), config.GetProgram("worker")
+	if web == nil || worker == nil || len(config.GetProgramNames()) != 2 {
+		t.Fatal("fail to load the processes of the Procfile")
+	}
+	if web.GetString("command", "") != "/bin/sh -c \"bundle exec rails s -p $PORT\"" || worker.GetString("command", "") != "/bin/sh -c 'echo \"hello\"'" {
+		t.Errorf("fail to get the commands of the Procfile: %s %s", web.GetString("command", ""), worker.GetString("command", ""))
+	}
+	if envs := worker.GetEnv("environment"); len(envs) != 1 || envs[0] != "PORT=5100" || worker.GetString("directory", "") != dir {
+		t.Errorf("fail to set the environment and the directory of the Procfile process: %v", envs)
+	}
+
+	if _, err := ParseProcfile(strings.NewReader("web: a\nweb: b\n")); err == nil {
+		t.Error("the processes defined twice should be rejected")
+	}
+	if _, err := ParseProcfile(strings.NewReader("web a\n")); err == nil {
+		t.Error("the invalid lines should be rejected")
+	}
+}
+
+func TestCompose(t *testing.T) {
+	compose, err := ParseCompose(strings.NewReader(`
+version: "3"
+services:
+  db:
+    image: postgres
+  api:
+    image: api
+    entrypoint: ["/app/api", "--name", "my api"]
+    command: serve
+    environment:
+      - LEVEL=debug
+      - HOME
+    depends_on:
+      - db
+      - cache
+    restart: on-failure:3
+    working_dir: /app
+  cache:
+    command: redis-server --port 6380
+    environment:
+      MODE: "fast"
+    depends_on:
+      db:
+        condition: service_started
+    restart: always
+    user: redis
+`))
+	if err != nil {
+		t.Fatalf("fail to parse the docker-compose file: %v", err)
+	}
+	buf := &strings.Builder{}
+	if err = ComposeToIni(compose, buf); err != nil {
+		t.Fatalf("fail to convert the docker-compose file: %v", err)
+	}
+	fileName, err := createTmpFile()
+	if err != nil {
+		t.Fatal("fail to create temporary file")
+	}
+	defer os.Remove(fileName)
+	ioutil.WriteFile(fileName, []byte(buf.String()), 0644)
+	config := NewConfig(fileName)
+	if _, err = config.Load(); err != nil {
+		t.Fatalf("fail to load the converted services: %v", err)
+	}
+	api, cache := config.GetProgram("api"), config.GetProgram("cache")
+	if api == nil || cache == nil || config.GetProgram("db") != nil {
+		t.Fatalf("fail to convert the services:\n%s", buf.String())
+	}
+	if api.GetString("command", "") != "/app/api --name \"my api\" serve" || api.GetString("directory", "") != "/app" {
+		t.Errorf("fail to convert the command of the service: %s", api.GetString("command", ""))
+	}
+	if api.GetString("autorestart", "") != "unexpected" || api.GetInt("startretries", 0) != 3 || api.GetString("depends_on", "") != "cache" {
+		t.Errorf("fail to convert the restart policy and the dependencies of the service:\n%s", buf.String())
+	}
+	if envs := api.GetEnv("environment"); len(envs) != 2 || envs[1] != "LEVEL=debug" {
+		t.Errorf("fail to convert the environment of the service: %v", envs)
+	}
+	if cache.GetString("autorestart", "") != "true" || cache.GetString("user", "") != "redis" || cache.GetString("command", "") != "redis-server --port 6380" {
+		t.Errorf("fail to convert the service:\n%s", buf.String())
+	}
+
+	if _, err := ParseCompose(strings.NewReader("version: \"3\"\n")); err == nil {
+		t.Error("the docker-compose file without services should be rejected")
+	}
+}
+
+func TestSystemdUnit(t *testing.T) {
+	unit, err := ParseSystemdUnit(strings.NewReader(`[Unit]
+Description=The API server
+After=network.target
+
+[Service]
+# the command of the server
+ExecStart=-/usr/bin/api \
+  --port 8080
+Environment="LEVEL=debug" "NAME=my api"
+Environment=MODE=fast
+User=api
+Group=www
+WorkingDirectory=-/srv/api
+Restart=on-failure
+ExecReload=/bin/kill -HUP $MAINPID
+`))
+	if err != nil {
+		t.Fatalf("fail to parse the unit file: %v", err)
+	}
+	buf := &strings.Builder{}
+	if err = SystemdUnitToIni("api", unit, buf); err != nil {
+		t.Fatalf("fail to convert the unit file: %v", err)
+	}
+	fileName, err := createTmpFile()
+	if err != nil {
+		t.Fatal("fail to create temporary file")
+	}
+	defer os.Remove(fileName)
+	ioutil.WriteFile(fileName, []byte(buf.String()), 0644)
+	config := NewConfig(fileName)
+	if _, err = config.Load(); err != nil {
+		t.Fatalf("fail to load the converted unit: %v", err)
+	}
+	api := config.GetProgram("api")
+	if api == nil || api.GetString("command", "") != "/usr/bin/api --port 8080" || api.GetString("directory", "") != "/srv/api" {
+		t.Fatalf("fail to convert the unit:\n%s", buf.String())
+	}
+	if api.GetString("user", "") != "api:www" || api.GetString("autorestart", "") != "unexpected" {
+		t.Errorf("fail to convert the user and the restart policy:\n%s", buf.String())
+	}
+	if envs := api.GetEnv("environment"); len(envs) != 3 || envs[2] != "NAME=my api" {
+		t.Errorf("fail to convert the environment: %v", envs)
+	}
+	if !strings.Contains(buf.String(), "; not converted: ExecReload=/bin/kill -HUP $MAINPID") {
+		t.Errorf("the directives without equivalent should be written as comments:\n%s", buf.String())
+	}
+
+	if unit, _ := ParseSystemdUnit(strings.NewReader("[Service]\nType=oneshot\n")); SystemdUnitToIni("x", unit, buf) == nil {
+		t.Error("the unit without ExecStart should be rejected")
+	}
+	if stripExecPrefixes("@/bin/sh login -l") != "/bin/sh -l" {
+		t.Error("fail to strip the argv[0] of the command")
+	}
+}
+
+func TestCheckCompat(t *testing.T) {
+	fileName, err := createTmpFile()
+	if err != nil {
+		t.Fatal("fail to create temporary file")
+	}
+	defer os.Remove(fileName)
+	ioutil.WriteFile(fileName, []byte(`[supervisord]
+logfile=/tmp/supervisord.log
+loglevel=info
+umask=022
+
+[inet_http_server]
+port=*:9001
+
+[program:web]
+command=/usr/bin/web
+stdout_logfile=AUTO
+stderr_logfile=/tmp/web.err
+
+[fcgi-program:php]
+command=/usr/bin/php-cgi
+`), 0644)
+	issues, err := CheckCompat(fileName)
+	if err != nil {
+		t.Fatalf("fail to check the configuration: %v", err)
+	}
+	expected := []string{"fcgi-program:php ", "inet_http_server port", "program:web stdout_logfile", "supervisord umask"}
+	if len(issues) != len(expected) {
+		t.Fatalf("fail to report the incompatible options: %v", issues)
+	}
+	for i, issue := range issues {
+		if issue.Section+" "+issue.Key != expected[i] {
+			t.Errorf("expected the option %s, got %v", expected[i], issue)
+		}
+	}
+	if issues[1].Level != CompatPartial || !strings.Contains(issues[1].String(), "\":port\"") {
+		t.Errorf("fail to suggest the equivalent option: %v", issues[1])
+	}
+}
+
 func TestToRegex(t *testing.T) {
 	pattern := toRegexp("/an/absolute/*.conf")
 	matched, err := regexp.MatchString(pattern, "/an/absolute/ab.conf")
@@ -201,3 +437,334 @@ func TestDefaultParams(t *testing.T) {
 	}
 
 }
+
+func TestNodeConfig(t *testing.T) {
+	config, _ := parse([]byte("[node:node1]\nserverurl=http://localhost:9001\n[program:test]\ncommand=/bin/ls"))
+	nodes := config.GetNodes()
+	if len(nodes) != 1 || nodes[0].GetNodeName() != "node1" || nodes[0].GetString("serverurl", "") != "http://localhost:9001" {
+		t.Error("fail to get the node")
+	}
+}
+
+func TestParseEnvMalformed(t *testing.T) {
+	for _, s := range []string{"A", "A=1,B", "A=\"1", "A=", "=,", ""} {
+		parseEnv(s)
+	}
+	env := *parseEnv("A=1,B")
+	if len(env) != 1 || env["A"] != "1" {
+		t.Error("fail to parse the environment without value")
+	}
+}
+
+func TestParseEnvProperty(t *testing.T) {
+	clean := func(s string) string {
+		return strings.TrimSpace(strings.Map(func(r rune) rune {
+			if r == '"' || r == ',' || r == '=' {
+				return -1
+			}
+			return r
+		}, s))
+	}
+	f := func(keys []string, values []string) bool {
+		expected := make(map[string]string)
+		items := make([]string, 0)
+		for i := 0; i < len(keys) && i < len(values); i++ {
+			key, value := clean(keys[i]), clean(values[i])
+			expected[key] = value
+			items = append(items, fmt.Sprintf("%s=\"%s\"", key, value))
+		}
+		env := *parseEnv(strings.Join(items, ","))
+		if len(env) != len(expected) {
+			return false
+		}
+		for k, v := range expected {
+			if env[k] != v {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error("fail to parse the quoted environment:", err)
+	}
+}
+
+func TestGetBytesOverflow(t *testing.T) {
+	entry := NewEntry(".")
+	entry.keyValues["size"] = "99999999999999GB"
+	if entry.GetBytes("size", 10) != 10 {
+		t.Error("fail to reject the too large bytes")
+	}
+}
+
+func TestToRegexAnchored(t *testing.T) {
+	pattern := toRegexp("??.conf")
+	if matched, _ := regexp.MatchString(pattern, "abc.conf"); matched {
+		t.Error("fail to match the whole file name")
+	}
+	if matched, _ := regexp.MatchString(toRegexp("[a].conf"), "[a].conf"); !matched {
+		t.Error("fail to match the file name with special characters")
+	}
+}
+
+func TestEncryptedValues(t *testing.T) {
+	key, _ := secret.GenerateKey()
+	keyFile, _ := saveToTmpFile([]byte("# comment\n" + key.String() + "\n"))
+	defer os.Remove(keyFile)
+	password, _ := secret.Encrypt(key.PublicKey(), "123")
+	dbPassword, _ := secret.Encrypt(key.PublicKey(), "456")
+
+	config, err := parse([]byte(fmt.Sprintf("[supervisord]\nsecret_key_file=%s\n[inet_http_server]\npassword=%s\n[program:test]\ncommand=/bin/ls\nenvironment=DB_PASSWORD=\"%s\"\n",
+		keyFile, password, dbPassword)))
+	if err != nil {
+		t.Error("fail to load the encrypted values")
+		return
+	}
+	entry, _ := config.GetInetHTTPServer()
+	if entry.GetString("password", "") != "123" {
+		t.Error("fail to decrypt the password")
+	}
+	env := config.GetProgram("test").GetEnv("environment")
+	if len(env) != 1 || env[0] != "DB_PASSWORD=456" {
+		t.Error("fail to decrypt the environment")
+	}
+
+	_, err = parse([]byte(fmt.Sprintf("[inet_http_server]\npassword=%s\n", password)))
+	if err == nil {
+		t.Error("fail to report the missing key file")
+	}
+}
+
+func TestNestedGroups(t *testing.T) {
+	config, err := parse([]byte("[program:web]\ncommand=/bin/ls\n\n[program:api]\ncommand=/bin/ls\n\n[program:worker]\ncommand=/bin/ls\n\n" +
+		"[group:frontend]\nprograms=web,api\n\n[group:customer-facing]\nprograms=frontend,worker\n"))
+	if err != nil {
+		t.Fatalf("fail to parse the nested groups: %v", err)
+	}
+	if !config.ProgramGroup.InGroup("web", "frontend") || !config.ProgramGroup.InGroup("worker", "customer-facing") {
+		t.Error("fail to add the programs to their groups")
+	}
+	if groups := config.ProgramGroup.ExpandGroup("customer-facing"); len(groups) != 2 || groups[0] != "customer-facing" || groups[1] != "frontend" {
+		t.Errorf("fail to expand the nested groups: %v", groups)
+	}
+
+	_, err = parse([]byte("[program:web]\ncommand=/bin/ls\n\n[group:a]\nprograms=b,web\n\n[group:b]\nprograms=c\n\n[group:c]\nprograms=b\n"))
+	var sectionErr *SectionError
+	if !errors.As(err, &sectionErr) || sectionErr.Section != "group:b" || !strings.Contains(err.Error(), "b -> c -> b") {
+		t.Errorf("fail to detect the groups referencing each other: %v", err)
+	}
+}
+
+func TestEnableIf(t *testing.T) {
+	getHostname = func() (string, error) { return "web-01", nil }
+	defer func() { getHostname = os.Hostname }()
+	os.Setenv("ENABLE_IF_TEST", "yes")
+	defer os.Unsetenv("ENABLE_IF_TEST")
+
+	tests := []struct {
+		expr    string
+		enabled bool
+	}{
+		{"", true},
+		{"hostname=web-*", true},
+		{"hostname=db-*", false},
+		{"!hostname=db-*", true},
+		{"env=ENABLE_IF_TEST", true},
+		{"env=ENABLE_IF_TEST=no", false},
+		{"env=ENABLE_IF_UNSET_VAR", false},
+		{"file=" + os.TempDir(), true},
+		{"file=/not/exist/file", false},
+		{"goos=" + runtime.GOOS, true},
+		{"hostname=web-*, env=ENABLE_IF_TEST=no", false},
+	}
+	for _, test := range tests {
+		enabled, err := evalEnableIf(test.expr)
+		if err != nil || enabled != test.enabled {
+			t.Errorf("fail to evaluate the enable_if %q: %v %v", test.expr, enabled, err)
+		}
+	}
+	for _, expr := range []string{"hostname", "cpu=amd64", "hostname=["} {
+		if _, err := evalEnableIf(expr); err == nil {
+			t.Errorf("fail to refuse the invalid enable_if %q", expr)
+		}
+	}
+
+	config, err := parse([]byte("[program:web]\ncommand=/bin/ls\nenable_if=hostname=web-*\n\n[program:db]\ncommand=/bin/ls\nenable_if=hostname=db-*\n"))
+	if err != nil {
+		t.Fatalf("fail to parse the programs with enable_if: %v", err)
+	}
+	if names := config.GetProgramNames(); len(names) != 1 || names[0] != "web" {
+		t.Errorf("fail to skip the programs disabled by enable_if: %v", names)
+	}
+	_, err = parse([]byte("[program:web]\ncommand=/bin/ls\nenable_if=arch=amd64\n"))
+	var sectionErr *SectionError
+	if !errors.As(err, &sectionErr) || sectionErr.Section != "program:web" {
+		t.Errorf("fail to report the invalid enable_if: %v", err)
+	}
+}
+
+func TestEditProgramFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "edit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "conf.d"), 0755)
+	configFile := filepath.Join(dir, "supervisord.conf")
+	ioutil.WriteFile(configFile, []byte("[include]\nfiles=conf.d/*.conf\n\n[program:web]\ncommand=/bin/ls\n"), 0644)
+	apiFile := filepath.Join(dir, "conf.d", "api.conf")
+	ioutil.WriteFile(apiFile, []byte("[program:api]\ncommand=/bin/ls\n"), 0600)
+	config := NewConfig(configFile)
+
+	if f, err := config.FindProgramFile("api"); err != nil || f != apiFile {
+		t.Errorf("fail to find the include file of the program: %s %v", f, err)
+	}
+	if f, err := config.FindProgramFile("web"); err != nil || f != configFile {
+		t.Errorf("fail to find the configuration file of the program: %s %v", f, err)
+	}
+	if _, err := config.FindProgramFile("db"); err == nil {
+		t.Error("fail to report the program without file")
+	}
+
+	if err := config.ValidateFile(apiFile, []byte("[program:api]\ncommand=/bin/ls -l\n")); err != nil {
+		t.Errorf("fail to validate the configuration: %v", err)
+	}
+	err = config.ValidateFile(apiFile, []byte("[program:api]\ndirectory=/tmp\n"))
+	var sectionErr *SectionError
+	if !errors.As(err, &sectionErr) || sectionErr.Section != "program:api" {
+		t.Errorf("fail to refuse the program without command: %v", err)
+	}
+	err = config.ValidateFile(apiFile, []byte("[program:api]\ncommand=/bin/ls\n\n[group:a]\nprograms=b\n\n[group:b]\nprograms=a\n"))
+	if !errors.As(err, &sectionErr) {
+		t.Errorf("fail to refuse the groups referencing each other: %v", err)
+	}
+
+	ioutil.WriteFile(apiFile, []byte("[program:api]\ncommand=/bin/ls -l\n"), 0600)
+	if _, err := config.Load(); err != nil || config.GetProgram("api").GetString("command", "") != "/bin/ls -l" {
+		t.Error("fail to load the written file")
+	}
+}
+
+func TestNewProgram(t *testing.T) {
+	if names, err := ParseProgramFragment([]byte("[program:web]\ncommand=/bin/ls\n\n[program:api]\ncommand=/bin/ls\n")); err != nil || len(names) != 2 || names[0] != "api" || names[1] != "web" {
+		t.Errorf("fail to get the programs of the fragment: %v %v", names, err)
+	}
+	for _, fragment := range []string{"", "[supervisord]\nnodaemon=true\n", "command=/bin/ls\n", "[program:../web]\ncommand=/bin/ls\n"} {
+		if _, err := ParseProgramFragment([]byte(fragment)); err == nil {
+			t.Errorf("fail to refuse the fragment %q", fragment)
+		}
+	}
+
+	content, err := ProgramToIni([]byte(`{"name": "web", "command": "/bin/ls -l", "autostart": false, "startsecs": 0, "environment": {"A": "1"}}`))
+	if err != nil || string(content) != "[program:web]\nautostart=false\ncommand=/bin/ls -l\nenvironment=A=\"1\"\nstartsecs=0\n" {
+		t.Errorf("fail to convert the json definition: %q %v", content, err)
+	}
+	for _, definition := range []string{`{"command": "/bin/ls"}`, `{"name": "a/b", "command": "/bin/ls"}`, `{"name": "web", "command": "/bin/ls\n[program:x]"}`, `{"name": "web", "command": ["/bin/ls"]}`, `[]`} {
+		if _, err := ProgramToIni([]byte(definition)); err == nil {
+			t.Errorf("fail to refuse the definition %s", definition)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "supervisord.conf")
+	ioutil.WriteFile(configFile, []byte("[include]\nfiles=/etc/supervisor/base.ini %(here)s/conf.d/*.ini\n"), 0644)
+	if f, err := NewConfig(configFile).NewProgramFile("web"); err != nil || f != filepath.Join(dir, "conf.d", "web.ini") {
+		t.Errorf("fail to get the file of the new program: %s %v", f, err)
+	}
+	ioutil.WriteFile(configFile, []byte("[program:web]\ncommand=/bin/ls\n"), 0644)
+	if _, err := NewConfig(configFile).NewProgramFile("web"); err == nil {
+		t.Error("fail to refuse the new program without [include]")
+	}
+}
+
+func TestReplaceSection(t *testing.T) {
+	content := []byte("; servers\n[program:web]\ncommand=/bin/ls\n\n[program:api]\ncommand=/bin/ls\n")
+	if section := GetSection(content, "program:web"); string(section) != "[program:web]\ncommand=/bin/ls\n\n" {
+		t.Errorf("fail to get the section: %q", section)
+	}
+	if section := GetSection(content, "program:api"); string(section) != "[program:api]\ncommand=/bin/ls\n" {
+		t.Errorf("fail to get the last section: %q", section)
+	}
+	if GetSection(content, "program:db") != nil {
+		t.Error("fail to report the missing section")
+	}
+	replaced, err := ReplaceSection(content, "program:web", []byte("[program:web]\ncommand=/bin/ls -l"))
+	if err != nil || string(replaced) != "; servers\n[program:web]\ncommand=/bin/ls -l\n[program:api]\ncommand=/bin/ls\n" {
+		t.Errorf("fail to replace the section: %q %v", replaced, err)
+	}
+	if _, err := ReplaceSection(content, "program:db", nil); err == nil {
+		t.Error("fail to refuse the missing section")
+	}
+
+	dir, err := ioutil.TempDir("", "sections")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "supervisord.conf")
+	ioutil.WriteFile(configFile, []byte("[include]\nfiles=*.ini\n\n[program:web]\ncommand=/bin/ls\nnumprocs=2\nprocess_name=web_%(process_num)d\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "api.ini"), []byte("[program:api]\ncommand=/bin/ls\n"), 0644)
+	config := NewConfig(configFile)
+	if _, err := config.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if files, err := config.ReadFiles(); err != nil || len(files) != 2 || string(files[filepath.Join(dir, "api.ini")]) != "[program:api]\ncommand=/bin/ls\n" {
+		t.Errorf("fail to read the configuration files: %v", err)
+	}
+	settings := config.ProgramSettings()
+	if len(settings) != 3 || !strings.HasPrefix(settings["api"], "command=/bin/ls\n") || settings["web_1"] == settings["web_2"] {
+		t.Errorf("fail to get the settings of the programs: %v", settings)
+	}
+	if config.GetProgram("web_2").Section != "program:web" {
+		t.Error("fail to keep the section of the process")
+	}
+}
+
+func TestDefaultsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "defaults")
+	if err != nil {
+		t.Fatal("fail to create temporary directory")
+	}
+	defer os.RemoveAll(dir)
+	defaults := filepath.Join(dir, "defaults.conf")
+	ioutil.WriteFile(defaults, []byte("[supervisord]\nloglevel=warn\nlogfile_maxbytes=10MB\n[inet_http_server]\nport=:9001\n"), 0644)
+	defer SetDefaultsFile("/etc/supervisord/defaults.conf")
+	SetDefaultsFile(defaults)
+
+	confFile := filepath.Join(dir, "supervisord.conf")
+	ioutil.WriteFile(confFile, []byte("[supervisord]\nloglevel=debug\n[program:web]\ncommand=web\n"), 0644)
+	config := NewConfig(confFile)
+	if _, err := config.Load(); err != nil {
+		t.Fatalf("fail to load the configuration: %v", err)
+	}
+	supervisord, _ := config.GetSupervisord()
+	if supervisord.GetString("loglevel", "") != "debug" || supervisord.GetString("logfile_maxbytes", "") != "10MB" {
+		t.Error("fail to merge the defaults under the configuration")
+	}
+	if _, ok := config.GetInetHTTPServer(); !ok || config.GetProgram("web") == nil {
+		t.Error("fail to load the sections of the defaults and the configuration")
+	}
+
+	sources, err := config.GetValueSources()
+	if err != nil || len(sources) != 4 {
+		t.Fatalf("fail to get the sources of the values: %v %v", sources, err)
+	}
+	if s := sources[3]; s.Key != "loglevel" || s.Value != "debug" || s.File != confFile || len(s.Overridden) != 1 || s.Overridden[0] != defaults {
+		t.Errorf("fail to report the overridden default: %v", s)
+	}
+	if s := sources[2]; s.Key != "logfile_maxbytes" || s.File != defaults || len(s.Overridden) != 0 {
+		t.Errorf("fail to report the default value: %v", s)
+	}
+}
+
+func TestRedactSection(t *testing.T) {
+	section := "[program:web]\ncommand=web --port 80\nenvironment=A=1,\n  DB_PASSWORD=x\napi_token: abc\n; password=comment\nautostart=false"
+	expect := "[program:web]\ncommand=web --port 80\nenvironment=******\napi_token=******\n; password=comment\nautostart=false"
+	if redacted := string(RedactSection([]byte(section))); redacted != expect {
+		t.Errorf("fail to redact the section: %q", redacted)
+	}
+}
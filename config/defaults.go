@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"sync"
+
+	ini "github.com/ochinchina/go-ini"
+)
+
+// the machine-level defaults file merged under any loaded configuration
+var defaultsFile = "/etc/supervisord/defaults.conf"
+var defaultsFileLock sync.RWMutex
+
+// SetDefaultsFile set the machine-level defaults file, its sections are
+// loaded before the configuration file so that the organization-wide
+// settings (log policies, authentication, metrics...) apply to every
+// configuration which doesn't set them
+func SetDefaultsFile(fileName string) {
+	defaultsFileLock.Lock()
+	defer defaultsFileLock.Unlock()
+	defaultsFile = fileName
+}
+
+// get the defaults file merged under the configuration file, empty if it
+// doesn't exist or it is the configuration file itself
+func getDefaultsFile(configFile string) string {
+	defaultsFileLock.RLock()
+	fileName := defaultsFile
+	defaultsFileLock.RUnlock()
+	if fileName == "" || isSameFile(fileName, configFile) {
+		return ""
+	}
+	if _, err := os.Stat(fileName); err != nil {
+		return ""
+	}
+	return fileName
+}
+
+// ValueSource a value of the configuration with the file setting it and the
+// files whose values of the same key are overridden, in the loading order
+type ValueSource struct {
+	Section    string
+	Key        string
+	Value      string
+	File       string
+	Overridden []string
+}
+
+// GetValueSources get the values of the defaults file, the configuration
+// file and its include files with the file each value comes from, sorted by
+// section and key. The values are not decrypted
+func (c *Config) GetValueSources() ([]ValueSource, error) {
+	cfg, err := c.loadIni("", nil)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	if fileName := getDefaultsFile(c.configFile); fileName != "" {
+		files = append(files, fileName)
+	}
+	files = append(append(files, c.configFile), c.getIncludeFiles(cfg)...)
+
+	sources := make(map[string]map[string]*ValueSource)
+	for _, fileName := range files {
+		fileCfg := ini.NewIni()
+		if IsProcfile(fileName) {
+			content, err := loadProcfile(fileName)
+			if err != nil {
+				return nil, err
+			}
+			fileCfg.LoadString(content)
+		} else {
+			fileCfg.LoadFile(fileName)
+		}
+		for _, section := range fileCfg.Sections() {
+			if sources[section.Name] == nil {
+				sources[section.Name] = make(map[string]*ValueSource)
+			}
+			for _, key := range section.Keys() {
+				value := key.ValueWithDefault("")
+				if source, ok := sources[section.Name][key.Name()]; ok {
+					source.Overridden = append(source.Overridden, source.File)
+					source.Value, source.File = value, fileName
+				} else {
+					sources[section.Name][key.Name()] = &ValueSource{Section: section.Name, Key: key.Name(), Value: value, File: fileName}
+				}
+			}
+		}
+	}
+
+	result := make([]ValueSource, 0)
+	for _, keys := range sources {
+		for _, source := range keys {
+			result = append(result, *source)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Section != result[j].Section {
+			return result[i].Section < result[j].Section
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result, nil
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ini "github.com/ochinchina/go-ini"
+	"github.com/ochinchina/supervisord/secret"
+)
+
+// FindProgramFile get the file with the [program:x] section of the program,
+// the configuration file or one of its include files
+func (c *Config) FindProgramFile(programName string) (string, error) {
+	if IsProcfile(c.configFile) {
+		return "", fmt.Errorf("the programs of the Procfile %s can't be edited", c.configFile)
+	}
+	cfg := ini.NewIni()
+	cfg.LoadFile(c.configFile)
+	files := append([]string{c.configFile}, c.getIncludeFiles(cfg)...)
+	for _, f := range files {
+		fileCfg := ini.NewIni()
+		fileCfg.LoadFile(f)
+		if fileCfg.HasSection("program:" + programName) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("no configuration file defines the program %s", programName)
+}
+
+// ValidateFile check the configuration if the file fileName, the
+// configuration file or one of its include files, had the content. The
+// programs and event listeners must have a command
+func (c *Config) ValidateFile(fileName string, content []byte) error {
+	validated := NewConfig(c.configFile)
+	cfg, err := validated.loadIni(fileName, content)
+	if err != nil {
+		return err
+	}
+	if _, err = validated.parse(cfg); err != nil {
+		return err
+	}
+	for _, entry := range validated.GetEntries(func(entry *Entry) bool {
+		return entry.IsProgram() || entry.IsEventListener()
+	}) {
+		if strings.TrimSpace(entry.GetString("command", "")) == "" {
+			return &SectionError{Section: entry.Name, Err: fmt.Errorf("no command")}
+		}
+	}
+	return nil
+}
+
+// check if the two paths are the same file
+func isSameFile(file1 string, file2 string) bool {
+	if abs, err := filepath.Abs(file1); err == nil {
+		file1 = abs
+	}
+	if abs, err := filepath.Abs(file2); err == nil {
+		file2 = abs
+	}
+	return file1 == file2
+}
+
+// ReadFiles read the configuration file and its include files, by file name
+func (c *Config) ReadFiles() (map[string][]byte, error) {
+	cfg := ini.NewIni()
+	cfg.LoadFile(c.configFile)
+	result := make(map[string][]byte)
+	for _, f := range append([]string{c.configFile}, c.getIncludeFiles(cfg)...) {
+		content, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		result[f] = content
+	}
+	return result, nil
+}
+
+// ProgramSettings get the settings of the loaded programs by program name, the
+// key=value lines sorted by key, to find the programs changed by a reload
+func (c *Config) ProgramSettings() map[string]string {
+	result := make(map[string]string)
+	for _, entry := range c.GetPrograms() {
+		lines := make([]string, 0, len(entry.keyValues))
+		for k, v := range entry.keyValues {
+			lines = append(lines, k+"="+v)
+		}
+		sort.Strings(lines)
+		result[entry.GetProgramName()] = strings.Join(lines, "\n")
+	}
+	return result
+}
+
+// check if the line is the header of a section, like "[program:x]"
+func sectionHeader(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+		return strings.TrimSpace(line[1 : len(line)-1]), true
+	}
+	return "", false
+}
+
+// find the lines of the section, from its header to the next section
+func findSection(lines []string, name string) (int, int, bool) {
+	start := -1
+	for i, line := range lines {
+		header, ok := sectionHeader(line)
+		if !ok {
+			continue
+		}
+		if start != -1 {
+			return start, i, true
+		}
+		if header == name {
+			start = i
+		}
+	}
+	return start, len(lines), start != -1
+}
+
+// GetSection get the text of the section, like "program:x", in the content
+// of a configuration file, nil if the content has no such section
+func GetSection(content []byte, name string) []byte {
+	lines := strings.SplitAfter(string(content), "\n")
+	start, end, ok := findSection(lines, name)
+	if !ok {
+		return nil
+	}
+	return []byte(strings.Join(lines[start:end], ""))
+}
+
+// RedactSection mask the values of the environment and of the secret keys
+// (password, token...) in the text of a section, with their continuation lines
+func RedactSection(section []byte) []byte {
+	lines := strings.SplitAfter(string(section), "\n")
+	masking := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if masking && trimmed != "" && line[0] != trimmed[0] {
+			// continuation line of the masked value
+			lines[i] = ""
+			continue
+		}
+		masking = false
+		pos := strings.IndexAny(trimmed, "=:")
+		if pos <= 0 || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		key := strings.TrimSpace(trimmed[0:pos])
+		if key == "environment" || secret.IsSecretKey(key) {
+			masking = true
+			lines[i] = line[0:strings.Index(line, trimmed)] + key + "=" + secret.Mask
+			if strings.HasSuffix(line, "\n") {
+				lines[i] += "\n"
+			}
+		}
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// ReplaceSection replace the text of the section in the content of a
+// configuration file with the text of another version of the section
+func ReplaceSection(content []byte, name string, section []byte) ([]byte, error) {
+	lines := strings.SplitAfter(string(content), "\n")
+	start, end, ok := findSection(lines, name)
+	if !ok {
+		return nil, fmt.Errorf("no section %s", name)
+	}
+	text := string(section)
+	if end < len(lines) && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return []byte(strings.Join(lines[0:start], "") + text + strings.Join(lines[end:], "")), nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// the hostname used to evaluate the enable_if conditions, replaced in the tests
+var getHostname = os.Hostname
+
+// evalEnableIf evaluate the conditions (separated by ",") of enable_if, the
+// program is enabled only if all the conditions are true:
+//
+//	hostname=<glob>    the hostname of the machine matches the glob pattern
+//	env=<NAME>         the environment variable is set
+//	env=<NAME>=<value> the environment variable is set to the value
+//	file=<path>        the file or directory exists
+//	goos=<glob>        the operating system (linux, darwin, windows...) matches the glob pattern
+//
+// A condition starting with "!" is negated
+func evalEnableIf(expr string) (bool, error) {
+	for _, cond := range strings.Split(expr, ",") {
+		cond = strings.TrimSpace(cond)
+		if cond == "" {
+			continue
+		}
+		negate := strings.HasPrefix(cond, "!")
+		if negate {
+			cond = strings.TrimSpace(cond[1:])
+		}
+		ok, err := evalCondition(cond)
+		if err != nil {
+			return false, err
+		}
+		if ok == negate {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func evalCondition(cond string) (bool, error) {
+	pos := strings.Index(cond, "=")
+	if pos <= 0 || pos == len(cond)-1 {
+		return false, fmt.Errorf("invalid enable_if condition %q", cond)
+	}
+	kind, value := strings.TrimSpace(cond[:pos]), strings.TrimSpace(cond[pos+1:])
+	switch kind {
+	case "hostname":
+		hostname, err := getHostname()
+		if err != nil {
+			return false, fmt.Errorf("fail to get the hostname: %v", err)
+		}
+		return matchGlob(value, hostname)
+	case "env":
+		name, expected, hasValue := value, "", false
+		if pos := strings.Index(value, "="); pos >= 0 {
+			name, expected, hasValue = value[:pos], value[pos+1:], true
+		}
+		v, ok := os.LookupEnv(name)
+		return ok && (!hasValue || v == expected), nil
+	case "file":
+		_, err := os.Stat(value)
+		return err == nil, nil
+	case "goos":
+		return matchGlob(value, runtime.GOOS)
+	}
+	return false, fmt.Errorf("unknown enable_if condition %q", kind)
+}
+
+func matchGlob(pattern string, s string) (bool, error) {
+	ok, err := filepath.Match(pattern, s)
+	if err != nil {
+		return false, fmt.Errorf("invalid enable_if pattern %q: %v", pattern, err)
+	}
+	return ok, nil
+}
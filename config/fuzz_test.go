@@ -0,0 +1,78 @@
+// +build go1.18
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ini "github.com/ochinchina/go-ini"
+)
+
+func FuzzParseEnv(f *testing.F) {
+	f.Add(`A="env 1",B="this is a test"`)
+	f.Add(`A=1,B=2`)
+	f.Add(`A`)
+	f.Add(`A="unclosed`)
+	f.Add(`=,=,"`)
+	f.Fuzz(func(t *testing.T, s string) {
+		for k, v := range *parseEnv(s) {
+			if k != strings.TrimSpace(k) || v != strings.TrimSpace(v) {
+				t.Errorf("fail to trim the environment %q=%q", k, v)
+			}
+		}
+	})
+}
+
+func FuzzStringExpressionEval(f *testing.F) {
+	f.Add("%(var1)s_test_%(var2)02d")
+	f.Add("%(var1)")
+	f.Add("%(self)s")
+	f.Add("%(var2)999999999d")
+	f.Add("%(%(var1)s)s")
+	se := NewStringExpression("var1", "ok", "var2", "2", "self", "%(self)s")
+	f.Fuzz(func(t *testing.T, s string) {
+		r, err := se.Eval(s)
+		if !strings.Contains(s, "%(") && (err != nil || r != s) {
+			t.Errorf("fail to keep the string %q without expression", s)
+		}
+	})
+}
+
+func FuzzGetBytes(f *testing.F) {
+	f.Add("1KB")
+	f.Add("50MB")
+	f.Add("99999999999999GB")
+	f.Add("-1MB")
+	f.Add("KB")
+	entry := NewEntry(".")
+	f.Fuzz(func(t *testing.T, s string) {
+		entry.keyValues["size"] = s
+		entry.GetBytes("size", 10)
+	})
+}
+
+func FuzzIncludeFiles(f *testing.F) {
+	dir, err := ioutil.TempDir("", "include")
+	if err != nil {
+		f.Fatal("fail to create temp directory")
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.conf", "ab.conf", "b.ini", "c.conf.bak"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(""), 0644)
+	}
+	f.Add("*.conf")
+	f.Add("??.conf b.ini")
+	f.Add("[a-.conf %(here)s/*.ini")
+	f.Add("../*")
+	f.Add("%(here")
+	config := NewConfig(filepath.Join(dir, "supervisord.conf"))
+	f.Fuzz(func(t *testing.T, files string) {
+		cfg := ini.NewIni()
+		cfg.NewSection("include").Add("files", files)
+		config.getIncludeFiles(cfg)
+	})
+}
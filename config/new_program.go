@@ -0,0 +1,147 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	ini "github.com/ochinchina/go-ini"
+)
+
+// the program names allowed for the new programs, they are used as file name
+var programNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ValidateProgramName check if the program name can be used as the name of
+// its configuration file
+func ValidateProgramName(name string) error {
+	if !programNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid program name %q, only letters, digits, '_', '.' and '-' are allowed", name)
+	}
+	return nil
+}
+
+// ParseProgramFragment get the names of the programs defined in the ini
+// fragment, which must only have [program:x] sections
+func ParseProgramFragment(content []byte) ([]string, error) {
+	cfg := ini.NewIni()
+	cfg.LoadBytes(content)
+	names := make([]string, 0)
+	for _, section := range cfg.Sections() {
+		if !strings.HasPrefix(section.Name, "program:") {
+			return nil, fmt.Errorf("only [program:x] sections are allowed, not [%s]", section.Name)
+		}
+		name := section.Name[len("program:"):]
+		if err := ValidateProgramName(name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no [program:x] section")
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ProgramToIni convert the json definition of a program, an object with the
+// name and the settings of the program like {"name": "web", "command":
+// "...", "autostart": false}, to a [program:x] section. The environment can
+// be an object
+func ProgramToIni(definition []byte) ([]byte, error) {
+	settings := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(definition))
+	decoder.UseNumber()
+	if err := decoder.Decode(&settings); err != nil {
+		return nil, fmt.Errorf("invalid program definition: %v", err)
+	}
+	name, ok := settings["name"].(string)
+	if !ok {
+		return nil, errors.New("no name in the program definition")
+	}
+	if err := ValidateProgramName(name); err != nil {
+		return nil, err
+	}
+	delete(settings, "name")
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	buf := bytes.NewBuffer(make([]byte, 0))
+	fmt.Fprintf(buf, "[program:%s]\n", name)
+	for _, key := range keys {
+		var value string
+		switch v := settings[key].(type) {
+		case string:
+			value = v
+		case bool, json.Number:
+			value = fmt.Sprint(v)
+		case map[string]interface{}:
+			if key != "environment" {
+				return nil, fmt.Errorf("the value of %s must not be an object", key)
+			}
+			env := make(map[string]string)
+			for k, envValue := range v {
+				env[k] = fmt.Sprint(envValue)
+			}
+			value = formatEnv(env)
+		default:
+			return nil, fmt.Errorf("invalid value of %s: %v", key, v)
+		}
+		if strings.ContainsAny(key, "=[]\n") || strings.Contains(value, "\n") {
+			return nil, fmt.Errorf("invalid setting %s", key)
+		}
+		fmt.Fprintf(buf, "%s=%s\n", key, value)
+	}
+	return buf.Bytes(), nil
+}
+
+// NewProgramFile get the file to add the program to the configuration, the
+// file <name> with the extension of the first pattern of the [include] files
+// which matches it, for example conf.d/web.conf for "conf.d/*.conf"
+func (c *Config) NewProgramFile(programName string) (string, error) {
+	if err := ValidateProgramName(programName); err != nil {
+		return "", err
+	}
+	cfg := ini.NewIni()
+	cfg.LoadFile(c.configFile)
+	files, err := cfg.GetValue("include", "files")
+	if err != nil {
+		return "", errors.New("no [include] files to add the programs")
+	}
+	env := NewStringExpression("here", c.GetConfigFileDir())
+	for _, pattern := range strings.Fields(files) {
+		f, err := env.Eval(pattern)
+		if err != nil {
+			continue
+		}
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(c.GetConfigFileDir(), f)
+		}
+		fileName := filepath.Join(filepath.Dir(f), programName+filepath.Ext(f))
+		if matched, err := regexp.MatchString(toRegexp(filepath.Base(f)), filepath.Base(fileName)); matched && err == nil {
+			return fileName, nil
+		}
+	}
+	return "", fmt.Errorf("no [include] files pattern matches the file of the program %s", programName)
+}
+
+// NewProgramEntry create the entry of a program which is not in the
+// configuration files, like the ad-hoc programs run once. The program is its
+// own group
+func NewProgramEntry(name string, configDir string, settings map[string]string) *Entry {
+	entry := NewEntry(configDir)
+	entry.Name = "program:" + name
+	entry.Section = entry.Name
+	entry.Group = name
+	for key, value := range settings {
+		entry.keyValues[key] = value
+	}
+	return entry
+}
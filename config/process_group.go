@@ -3,6 +3,7 @@ package config
 import (
 	"bytes"
 	"github.com/ochinchina/supervisord/util"
+	"sort"
 	"strings"
 )
 
@@ -10,11 +11,13 @@ import (
 type ProcessGroup struct {
 	//mapping between the program and its group
 	processGroup map[string]string
+	//the nested groups referenced in the programs of a group
+	subGroups map[string][]string
 }
 
 // NewProcessGroup create a ProcessGroup object
 func NewProcessGroup() *ProcessGroup {
-	return &ProcessGroup{processGroup: make(map[string]string)}
+	return &ProcessGroup{processGroup: make(map[string]string), subGroups: make(map[string][]string)}
 }
 
 // Clone clone the process group
@@ -23,6 +26,9 @@ func (pg *ProcessGroup) Clone() *ProcessGroup {
 	for k, v := range pg.processGroup {
 		newPg.processGroup[k] = v
 	}
+	for k, v := range pg.subGroups {
+		newPg.subGroups[k] = append([]string(nil), v...)
+	}
 	return newPg
 }
 
@@ -34,16 +40,26 @@ func (pg *ProcessGroup) Sub(other *ProcessGroup) (added []string, changed []stri
 	changed = make([]string, 0)
 	removed = util.Sub(otherGroup, thisGroup)
 
-	for _, group := range thisGroup {
-		proc1 := pg.GetAllProcess(group)
-		proc2 := other.GetAllProcess(group)
-		if len(proc2) > 0 && !util.IsSameStringArray(proc1, proc2) {
+	thisProcs := pg.getGroupProcesses()
+	otherProcs := other.getGroupProcesses()
+	for _, group := range util.Sub(thisGroup, added) {
+		if !util.IsSameStringArray(thisProcs[group], otherProcs[group]) ||
+			!util.IsSameStringArray(pg.subGroups[group], other.subGroups[group]) {
 			changed = append(changed, group)
 		}
 	}
 	return
 }
 
+// get the processes of all the groups in one pass
+func (pg *ProcessGroup) getGroupProcesses() map[string][]string {
+	result := make(map[string][]string)
+	for procName, groupName := range pg.processGroup {
+		result[groupName] = append(result[groupName], procName)
+	}
+	return result
+}
+
 //Add add a process to a group
 func (pg *ProcessGroup) Add(group string, procName string) {
 	pg.processGroup[procName] = group
@@ -54,12 +70,77 @@ func (pg *ProcessGroup) Remove(procName string) {
 	delete(pg.processGroup, procName)
 }
 
+// AddSubGroup add a nested group to a group
+func (pg *ProcessGroup) AddSubGroup(group string, subGroup string) {
+	pg.subGroups[group] = append(pg.subGroups[group], subGroup)
+}
+
+// ExpandGroup get the group and all its nested groups, the groups referenced
+// more than once are returned once
+func (pg *ProcessGroup) ExpandGroup(group string) []string {
+	visited := make(map[string]bool)
+	result := make([]string, 0)
+	var expand func(group string)
+	expand = func(group string) {
+		if visited[group] {
+			return
+		}
+		visited[group] = true
+		result = append(result, group)
+		for _, subGroup := range pg.subGroups[group] {
+			expand(subGroup)
+		}
+	}
+	expand(group)
+	return result
+}
+
+// FindCycle find the nested groups referencing each other, the returned path
+// starts and ends with the same group. nil is returned if there is no cycle
+func (pg *ProcessGroup) FindCycle() []string {
+	// 1: the group is being checked, 2: the group and its nested groups have no cycle
+	states := make(map[string]int)
+	var find func(group string, path []string) []string
+	find = func(group string, path []string) []string {
+		path = append(path, group)
+		switch states[group] {
+		case 1:
+			for i, g := range path {
+				if g == group {
+					return path[i:]
+				}
+			}
+		case 2:
+			return nil
+		}
+		states[group] = 1
+		for _, subGroup := range pg.subGroups[group] {
+			if cycle := find(subGroup, path); cycle != nil {
+				return cycle
+			}
+		}
+		states[group] = 2
+		return nil
+	}
+	groups := pg.GetAllGroup()
+	sort.Strings(groups)
+	for _, group := range groups {
+		if cycle := find(group, nil); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
 //GetAllGroup get all the groups
 func (pg *ProcessGroup) GetAllGroup() []string {
 	groups := make(map[string]bool)
 	for _, group := range pg.processGroup {
 		groups[group] = true
 	}
+	for group := range pg.subGroups {
+		groups[group] = true
+	}
 
 	result := make([]string, 0)
 	for group := range groups {
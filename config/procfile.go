@@ -0,0 +1,126 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// the first port set to the PORT environment variable of the Procfile
+// processes, incremented by 100 for each process like foreman
+const procfileBasePort = 5000
+
+var procfileLinePattern = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.+)$`)
+
+// the files loaded as Procfile whatever their names, set by SetProcfile
+var procfiles = make(map[string]bool)
+var procfilesLock sync.Mutex
+
+// ProcfileEntry a process type of the Procfile
+type ProcfileEntry struct {
+	Name    string
+	Command string
+}
+
+// SetProcfile load the configuration file as a Procfile, the files named
+// "Procfile" or "Procfile.*" are always loaded as Procfile
+func SetProcfile(fileName string) {
+	procfilesLock.Lock()
+	defer procfilesLock.Unlock()
+	if absFile, err := filepath.Abs(fileName); err == nil {
+		fileName = absFile
+	}
+	procfiles[fileName] = true
+}
+
+// IsProcfile check if the configuration file is a Procfile
+func IsProcfile(fileName string) bool {
+	name := filepath.Base(fileName)
+	if name == "Procfile" || strings.HasPrefix(name, "Procfile.") {
+		return true
+	}
+	procfilesLock.Lock()
+	defer procfilesLock.Unlock()
+	if absFile, err := filepath.Abs(fileName); err == nil {
+		fileName = absFile
+	}
+	return procfiles[fileName]
+}
+
+// ParseProcfile parse the "<name>: <command>" lines of the Procfile, the
+// empty lines and the comments starting with "#" are ignored
+func ParseProcfile(reader io.Reader) ([]ProcfileEntry, error) {
+	entries := make([]ProcfileEntry, 0)
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(reader)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		match := procfileLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("line %d: not a \"<name>: <command>\" line", lineNo)
+		}
+		if names[match[1]] {
+			return nil, fmt.Errorf("line %d: the process %s is already defined", lineNo, match[1])
+		}
+		names[match[1]] = true
+		entries = append(entries, ProcfileEntry{Name: match[1], Command: match[2]})
+	}
+	return entries, scanner.Err()
+}
+
+// ProcfileToIni convert the Procfile entries to program sections. The commands
+// are run by /bin/sh in the directory like foreman, with the PORT environment
+// variable, and are stopped with their child processes
+func ProcfileToIni(entries []ProcfileEntry, dir string, writer io.Writer) error {
+	for i, entry := range entries {
+		command, err := quoteShellCommand(entry.Command)
+		if err != nil {
+			return fmt.Errorf("process %s: %v", entry.Name, err)
+		}
+		fmt.Fprintf(writer, "[program:%s]\ncommand=/bin/sh -c %s\ndirectory=%s\nenvironment=PORT=\"%d\"\nstopasgroup=true\nkillasgroup=true\n\n",
+			entry.Name, command, dir, procfileBasePort+100*i)
+	}
+	return nil
+}
+
+// quote the command as one argument of the program command line
+func quoteShellCommand(command string) (string, error) {
+	if !strings.Contains(command, "\"") {
+		return "\"" + command + "\"", nil
+	}
+	if !strings.Contains(command, "'") {
+		return "'" + command + "'", nil
+	}
+	return "", fmt.Errorf("the command contains both single and double quotes")
+}
+
+// load the Procfile as the program sections
+func loadProcfile(fileName string) (string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	entries, err := ParseProcfile(f)
+	if err != nil {
+		return "", fmt.Errorf("invalid Procfile %s: %v", fileName, err)
+	}
+	dir, err := filepath.Abs(filepath.Dir(fileName))
+	if err != nil {
+		return "", err
+	}
+	buf := bytes.NewBuffer(nil)
+	if err = ProcfileToIni(entries, dir, buf); err != nil {
+		return "", fmt.Errorf("invalid Procfile %s: %v", fileName, err)
+	}
+	return buf.String(), nil
+}
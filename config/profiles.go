@@ -0,0 +1,45 @@
+package config
+
+import (
+	"strings"
+	"sync"
+)
+
+// the profiles selected on the command line, all the programs are loaded if
+// no profile is selected
+var activeProfiles []string
+var activeProfilesLock sync.RWMutex
+
+// SetActiveProfiles select the profiles of the programs loaded from the
+// configuration. A program with profiles is loaded only if one of its
+// profiles is selected, the programs without profiles are always loaded
+func SetActiveProfiles(profiles []string) {
+	activeProfilesLock.Lock()
+	defer activeProfilesLock.Unlock()
+	activeProfiles = nil
+	for _, profile := range profiles {
+		for _, name := range strings.Split(profile, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				activeProfiles = append(activeProfiles, name)
+			}
+		}
+	}
+}
+
+// inActiveProfiles check if one of the profiles (separated by ",") of a
+// program is selected
+func inActiveProfiles(profiles string) bool {
+	activeProfilesLock.RLock()
+	defer activeProfilesLock.RUnlock()
+	if len(activeProfiles) == 0 || strings.TrimSpace(profiles) == "" {
+		return true
+	}
+	for _, profile := range strings.Split(profiles, ",") {
+		for _, active := range activeProfiles {
+			if strings.TrimSpace(profile) == active {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -12,24 +13,16 @@ type StringExpression struct {
 	env map[string]string // the environment variable used to replace the var in the python expression
 }
 
-// NewStringExpression create a new StringExpression with the environment variables
+// NewStringExpression create a new StringExpression with the environment
+// variables, the process environment variables are available as "ENV_<name>"
+// and the host name as "host_node_name"
 func NewStringExpression(envs ...string) *StringExpression {
-	se := &StringExpression{env: make(map[string]string)}
+	se := &StringExpression{env: make(map[string]string, len(envs)/2)}
 
-	for _, env := range os.Environ() {
-		t := strings.Split(env, "=")
-		se.env["ENV_"+t[0]] = t[1]
-	}
 	n := len(envs)
 	for i := 0; i+1 < n; i += 2 {
 		se.env[envs[i]] = envs[i+1]
 	}
-
-	hostname, err := os.Hostname()
-	if err == nil {
-		se.env["host_node_name"] = hostname
-	}
-
 	return se
 
 }
@@ -40,14 +33,20 @@ func (se *StringExpression) Add(key string, value string) *StringExpression {
 	return se
 }
 
-// Eval evaluate the expression include "%(var)s"  and return the string after replacing the var
+// the flags and width of the integer format, the width is limited
+var intFormatRegexp = regexp.MustCompile(`^[-+ #0]*[0-9]{0,4}$`)
+
+// Eval evaluate the expression include "%(var)s"  and return the string after replacing the var.
+// The replaced values are not evaluated again
 func (se *StringExpression) Eval(s string) (string, error) {
+	var result strings.Builder
 	for {
 		//find variable start indicator
 		start := strings.Index(s, "%(")
 
 		if start == -1 {
-			return s, nil
+			result.WriteString(s)
+			return result.String(), nil
 		}
 
 		end := start + 1
@@ -68,25 +67,47 @@ func (se *StringExpression) Eval(s string) (string, error) {
 		if typ < n {
 			varName := s[start+2 : end]
 
-			varValue, ok := se.env[varName]
+			varValue, ok := se.lookup(varName)
 
 			if !ok {
 				return "", fmt.Errorf("fail to find the environment variable %s", varName)
 			}
+			result.WriteString(s[0:start])
 			if s[typ] == 'd' {
 				i, err := strconv.Atoi(varValue)
 				if err != nil {
 					return "", fmt.Errorf("can't convert %s to integer", varValue)
 				}
-				s = s[0:start] + fmt.Sprintf("%"+s[end+1:typ+1], i) + s[typ+1:]
+				if !intFormatRegexp.MatchString(s[end+1 : typ]) {
+					return "", fmt.Errorf("invalid integer format %s", s[end+1:typ])
+				}
+				result.WriteString(fmt.Sprintf("%"+s[end+1:typ+1], i))
 			} else if s[typ] == 's' {
-				s = s[0:start] + varValue + s[typ+1:]
+				result.WriteString(varValue)
 			} else {
 				return "", fmt.Errorf("not implement type:%v", s[typ])
 			}
+			s = s[typ+1:]
 		} else {
 			return "", fmt.Errorf("invalid string expression format")
 		}
 	}
 
 }
+
+// get the value of the variable, the process environment variables and the host
+// name are looked up when they are used since most of the expressions don't use them
+func (se *StringExpression) lookup(name string) (string, bool) {
+	if name == "host_node_name" {
+		if hostname, err := os.Hostname(); err == nil {
+			return hostname, true
+		}
+	}
+	if value, ok := se.env[name]; ok {
+		return value, true
+	}
+	if strings.HasPrefix(name, "ENV_") {
+		return os.LookupEnv(name[len("ENV_"):])
+	}
+	return "", false
+}
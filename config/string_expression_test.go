@@ -1,7 +1,9 @@
 package config
 
 import (
+	"strings"
 	"testing"
+	"testing/quick"
 )
 
 func TestEval(t *testing.T) {
@@ -15,3 +17,29 @@ func TestEval(t *testing.T) {
 		t.Error("fail to replace the environment")
 	}
 }
+
+func TestEvalNotReplaceAgain(t *testing.T) {
+	se := NewStringExpression("self", "%(self)s", "width", "1")
+
+	r, err := se.Eval("%(self)s")
+	if err != nil || r != "%(self)s" {
+		t.Error("fail to evaluate the value only once")
+	}
+	if _, err = se.Eval("%(width)999999999d"); err == nil {
+		t.Error("fail to reject the too large width")
+	}
+}
+
+func TestEvalWithoutExpression(t *testing.T) {
+	se := NewStringExpression()
+	f := func(s string) bool {
+		if strings.Contains(s, "%(") {
+			return true
+		}
+		r, err := se.Eval(s)
+		return err == nil && r == s
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error("fail to keep the string without expression:", err)
+	}
+}
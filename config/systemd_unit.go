@@ -0,0 +1,200 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// UnitDirective a "Key=value" line of a section of the systemd unit file
+type UnitDirective struct {
+	Key   string
+	Value string
+}
+
+// SystemdUnit the directives of the systemd unit file by section name
+type SystemdUnit map[string][]UnitDirective
+
+// ParseSystemdUnit parse the sections of the systemd unit file, the lines
+// ending with "\" are continued on the next line and the comments start
+// with "#" or ";"
+func ParseSystemdUnit(reader io.Reader) (SystemdUnit, error) {
+	unit := make(SystemdUnit)
+	section := ""
+	scanner := bufio.NewScanner(reader)
+	line := ""
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		text := strings.TrimSpace(scanner.Text())
+		if line == "" && (strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";")) {
+			continue
+		}
+		if strings.HasSuffix(text, "\\") {
+			line += strings.TrimSpace(strings.TrimSuffix(text, "\\")) + " "
+			continue
+		}
+		line, text = "", line+text
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			section = text[1 : len(text)-1]
+			continue
+		}
+		kv := strings.SplitN(text, "=", 2)
+		if len(kv) != 2 || section == "" {
+			return nil, fmt.Errorf("line %d: not a \"Key=value\" line of a section", lineNo)
+		}
+		unit[section] = append(unit[section], UnitDirective{Key: strings.TrimSpace(kv[0]), Value: strings.TrimSpace(kv[1])})
+	}
+	return unit, scanner.Err()
+}
+
+// SystemdUnitToIni convert the [Service] section of the unit to the program
+// section, the directives without equivalent are written as comments
+func SystemdUnitToIni(name string, unit SystemdUnit, writer io.Writer) error {
+	var command, user, group, directory, restart string
+	env := make(map[string]string)
+	notConverted := make([]string, 0)
+	for _, directive := range unit["Service"] {
+		value := directive.Value
+		switch directive.Key {
+		case "ExecStart":
+			// an empty value resets the previous ExecStart, only oneshot
+			// services may have several commands
+			if value != "" && command != "" {
+				return fmt.Errorf("several ExecStart commands are not supported")
+			}
+			command = stripExecPrefixes(value)
+		case "Environment":
+			// an empty value resets the previous assignments
+			if value == "" {
+				env = make(map[string]string)
+			}
+			for _, word := range splitUnitWords(value) {
+				kv := strings.SplitN(word, "=", 2)
+				if len(kv) != 2 {
+					return fmt.Errorf("invalid environment assignment %s", word)
+				}
+				if strings.Contains(kv[1], "\"") {
+					return fmt.Errorf("the value of the environment variable %s contains double quotes", kv[0])
+				}
+				env[kv[0]] = kv[1]
+			}
+		case "User":
+			user = value
+		case "Group":
+			group = value
+		case "WorkingDirectory":
+			// "-" ignores a missing directory and "~" is the home directory of the user
+			directory = strings.TrimPrefix(value, "-")
+		case "Restart":
+			restart = value
+		case "Type":
+			if value != "simple" && value != "exec" && value != "notify" {
+				notConverted = append(notConverted, fmt.Sprintf("%s=%s (the program must run in the foreground)", directive.Key, value))
+			}
+		default:
+			notConverted = append(notConverted, directive.Key+"="+value)
+		}
+	}
+	if command == "" {
+		return fmt.Errorf("no ExecStart in the [Service] section")
+	}
+	for _, directive := range unit["Unit"] {
+		if directive.Key == "Description" {
+			fmt.Fprintf(writer, "; %s\n", directive.Value)
+		}
+	}
+	fmt.Fprintf(writer, "[program:%s]\ncommand=%s\n", name, command)
+	if directory != "" {
+		fmt.Fprintf(writer, "directory=%s\n", directory)
+	}
+	if user != "" && group != "" {
+		fmt.Fprintf(writer, "user=%s:%s\n", user, group)
+	} else if user != "" {
+		fmt.Fprintf(writer, "user=%s\n", user)
+	} else if group != "" {
+		notConverted = append(notConverted, "Group="+group+" (without User)")
+	}
+	if len(env) > 0 {
+		fmt.Fprintf(writer, "environment=%s\n", formatEnv(env))
+	}
+	// the restart policy of systemd: "no" (default), "always", "on-success",
+	// "on-failure", "on-abnormal", "on-abort" or "on-watchdog"
+	switch restart {
+	case "", "no":
+		fmt.Fprintln(writer, "autorestart=false")
+	case "always":
+		fmt.Fprintln(writer, "autorestart=true")
+	case "on-failure", "on-abnormal", "on-abort", "on-watchdog":
+		fmt.Fprintln(writer, "autorestart=unexpected")
+	default:
+		fmt.Fprintln(writer, "autorestart=false")
+		notConverted = append(notConverted, "Restart="+restart)
+	}
+	for _, directive := range notConverted {
+		fmt.Fprintf(writer, "; not converted: %s\n", directive)
+	}
+	return nil
+}
+
+// strip the special prefixes of the ExecStart command: "-", ":", "+", "!",
+// "!!" change how the command is run by systemd and "@" passes the second
+// word as argv[0], which is dropped
+func stripExecPrefixes(command string) string {
+	prefixes := strings.IndexFunc(command, func(r rune) bool {
+		return !strings.ContainsRune("-@:+!", r)
+	})
+	if prefixes <= 0 {
+		return command
+	}
+	hasArgv0 := strings.Contains(command[:prefixes], "@")
+	command = command[prefixes:]
+	if hasArgv0 {
+		words := strings.Fields(command)
+		if len(words) >= 2 {
+			command = strings.Join(append(words[:1], words[2:]...), " ")
+		}
+	}
+	return command
+}
+
+// split the value in words separated by spaces, the quoted words may
+// contain spaces and the quotes are removed
+func splitUnitWords(value string) []string {
+	words := make([]string, 0)
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range value {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
@@ -0,0 +1,196 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fault the XML-RPC fault returned by the server
+type Fault struct {
+	Code   int
+	String string
+}
+
+// Error implements error interface
+func (f *Fault) Error() string {
+	return fmt.Sprintf("%d: %s", f.Code, f.String)
+}
+
+// Client call the XML-RPC methods with any params and decode any result to
+// the generic values: int, bool, string, float64, []interface{} and map[string]interface{}
+type Client struct {
+	URL      string
+	User     string
+	Password string
+	client   *http.Client
+}
+
+// NewClient create a Client calling the methods at url like "http://127.0.0.1:9001/RPC2"
+func NewClient(url string, user string, password string) *Client {
+	return &Client{URL: url, User: user, Password: password, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+type xmlValue struct {
+	Array    *[]xmlValue `xml:"array>data>value"`
+	Struct   []xmlMember `xml:"struct>member"`
+	String   *string     `xml:"string"`
+	Int      *string     `xml:"int"`
+	I4       *string     `xml:"i4"`
+	Boolean  *string     `xml:"boolean"`
+	Double   *string     `xml:"double"`
+	DateTime *string     `xml:"dateTime.iso8601"`
+	Base64   *string     `xml:"base64"`
+	Raw      string      `xml:",chardata"`
+}
+
+type xmlMember struct {
+	Name  string   `xml:"name"`
+	Value xmlValue `xml:"value"`
+}
+
+type xmlResponse struct {
+	Params []xmlValue `xml:"params>param>value"`
+	Fault  *xmlValue  `xml:"fault>value"`
+}
+
+// Call call the method with params, the error is a *Fault if the server returns a fault
+func (c *Client) Call(method string, params ...interface{}) (interface{}, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0"?><methodCall><methodName>`)
+	xml.EscapeText(&buf, []byte(method))
+	buf.WriteString("</methodName><params>")
+	for _, param := range params {
+		buf.WriteString("<param>")
+		if err := encodeValue(&buf, param); err != nil {
+			return nil, err
+		}
+		buf.WriteString("</param>")
+	}
+	buf.WriteString("</params></methodCall>")
+
+	req, err := http.NewRequest("POST", c.URL, &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	if c.User != "" {
+		req.SetBasicAuth(c.User, c.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	response := xmlResponse{}
+	if err = xml.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("not a valid XML-RPC response: %v", err)
+	}
+	if response.Fault != nil {
+		fault, _ := decodeValue(*response.Fault).(map[string]interface{})
+		code, _ := fault["faultCode"].(int)
+		desc, _ := fault["faultString"].(string)
+		return nil, &Fault{Code: code, String: desc}
+	}
+	if len(response.Params) == 0 {
+		return nil, nil
+	}
+	return decodeValue(response.Params[0]), nil
+}
+
+func encodeValue(buf *bytes.Buffer, value interface{}) error {
+	buf.WriteString("<value>")
+	switch v := value.(type) {
+	case string:
+		buf.WriteString("<string>")
+		xml.EscapeText(buf, []byte(v))
+		buf.WriteString("</string>")
+	case int:
+		fmt.Fprintf(buf, "<int>%d</int>", v)
+	case bool:
+		if v {
+			buf.WriteString("<boolean>1</boolean>")
+		} else {
+			buf.WriteString("<boolean>0</boolean>")
+		}
+	case []interface{}:
+		buf.WriteString("<array><data>")
+		for _, item := range v {
+			if err := encodeValue(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("</data></array>")
+	case map[string]interface{}:
+		names := make([]string, 0)
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		buf.WriteString("<struct>")
+		for _, name := range names {
+			buf.WriteString("<member><name>")
+			xml.EscapeText(buf, []byte(name))
+			buf.WriteString("</name>")
+			if err := encodeValue(buf, v[name]); err != nil {
+				return err
+			}
+			buf.WriteString("</member>")
+		}
+		buf.WriteString("</struct>")
+	default:
+		return fmt.Errorf("unsupported XML-RPC param %v", value)
+	}
+	buf.WriteString("</value>")
+	return nil
+}
+
+func decodeValue(value xmlValue) interface{} {
+	switch {
+	case value.Array != nil:
+		result := make([]interface{}, 0)
+		for _, item := range *value.Array {
+			result = append(result, decodeValue(item))
+		}
+		return result
+	case value.Struct != nil:
+		result := make(map[string]interface{})
+		for _, member := range value.Struct {
+			result[member.Name] = decodeValue(member.Value)
+		}
+		return result
+	case value.Int != nil || value.I4 != nil:
+		s := value.Int
+		if s == nil {
+			s = value.I4
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(*s))
+		return n
+	case value.Boolean != nil:
+		return strings.TrimSpace(*value.Boolean) == "1"
+	case value.Double != nil:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(*value.Double), 64)
+		return f
+	case value.String != nil:
+		return *value.String
+	case value.DateTime != nil:
+		return *value.DateTime
+	case value.Base64 != nil:
+		return *value.Base64
+	}
+	// the value without type is a string
+	return value.Raw
+}
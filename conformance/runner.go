@@ -0,0 +1,137 @@
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// the status of a vector in the report
+const (
+	StatusPass = "PASS"
+	StatusFail = "FAIL"
+	StatusSkip = "SKIP"
+)
+
+// Result the result of one vector
+type Result struct {
+	Name   string
+	Method string
+	Status string
+	Detail string
+}
+
+// Report the results of all the vectors in order
+type Report struct {
+	Results []Result
+}
+
+// CtlVector one python supervisorctl command and the expected output
+type CtlVector struct {
+	Name   string
+	Args   []string
+	Output string
+}
+
+// CtlVectors the test vectors of python supervisorctl, they are run after the
+// XML-RPC vectors and start from the stopped programs
+var CtlVectors = []CtlVector{
+	{Name: "status", Args: []string{"status", sleeperProgram}, Output: "STOPPED"},
+	{Name: "start", Args: []string{"start", sleeperProgram}, Output: sleeperProgram + ": started"},
+	{Name: "start already started", Args: []string{"start", sleeperProgram}, Output: sleeperProgram + ": ERROR (already started)"},
+	{Name: "status running", Args: []string{"status", sleeperProgram}, Output: "RUNNING"},
+	{Name: "stop", Args: []string{"stop", sleeperProgram}, Output: sleeperProgram + ": stopped"},
+	{Name: "stop not running", Args: []string{"stop", sleeperProgram}, Output: sleeperProgram + ": ERROR (not running)"},
+	{Name: "start bad name", Args: []string{"start", unknownName}, Output: unknownName + ": ERROR (no such process)"},
+	{Name: "start spawn error", Args: []string{"start", failingProgram}, Output: failingProgram + ": ERROR (spawn error)"},
+}
+
+// Config create the supervisord configuration with the programs used by the
+// vectors, the server listens on the address like "127.0.0.1:9001"
+func Config(address string, user string, password string) string {
+	return fmt.Sprintf(`[inet_http_server]
+port=%s
+username=%s
+password=%s
+
+[program:%s]
+command=/bin/sleep 3600
+autostart=false
+startsecs=1
+stopwaitsecs=3
+
+[program:%s]
+command=/bin/false
+autostart=false
+autorestart=false
+startsecs=1
+startretries=0
+`, address, user, password, sleeperProgram, failingProgram)
+}
+
+// Run run the XML-RPC vectors against the server at serverURL like
+// "http://127.0.0.1:9001" and then the supervisorctl vectors if the path of
+// python supervisorctl is not empty
+func Run(serverURL string, user string, password string, supervisorctl string) *Report {
+	report := &Report{}
+	client := NewClient(strings.TrimSuffix(serverURL, "/")+"/RPC2", user, password)
+	for i := range Vectors {
+		report.Results = append(report.Results, Vectors[i].Run(client))
+	}
+	for i := range CtlVectors {
+		vector := &CtlVectors[i]
+		if supervisorctl == "" {
+			report.Results = append(report.Results, Result{Name: vector.Name, Method: "supervisorctl " + vector.Args[0], Status: StatusSkip, Detail: "python supervisorctl is not found"})
+			continue
+		}
+		report.Results = append(report.Results, vector.Run(supervisorctl, serverURL, user, password))
+	}
+	return report
+}
+
+// Run run the supervisorctl command and check its output
+func (v *CtlVector) Run(supervisorctl string, serverURL string, user string, password string) Result {
+	result := Result{Name: v.Name, Method: "supervisorctl " + v.Args[0], Status: StatusPass}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	args := []string{"-s", serverURL}
+	if user != "" {
+		args = append(args, "-u", user, "-p", password)
+	}
+	// supervisorctl exits with non-zero status on the errors, only the output is checked
+	output, err := exec.CommandContext(ctx, supervisorctl, append(args, v.Args...)...).CombinedOutput()
+	if err != nil && len(output) == 0 {
+		result.Status = StatusFail
+		result.Detail = err.Error()
+	} else if !strings.Contains(strings.ToLower(string(output)), strings.ToLower(v.Output)) {
+		result.Status = StatusFail
+		result.Detail = fmt.Sprintf("expect %q in the output %q", v.Output, strings.TrimSpace(string(output)))
+	}
+	return result
+}
+
+// Failed get the number of failed vectors
+func (r *Report) Failed() int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Status == StatusFail {
+			n++
+		}
+	}
+	return n
+}
+
+// Write write the report in lines like "PASS supervisor.getState getState"
+func (r *Report) Write(w io.Writer) {
+	for _, result := range r.Results {
+		if result.Detail == "" {
+			fmt.Fprintf(w, "%s %-32s %s\n", result.Status, result.Method, result.Name)
+		} else {
+			fmt.Fprintf(w, "%s %-32s %s: %s\n", result.Status, result.Method, result.Name, result.Detail)
+		}
+	}
+	fmt.Fprintf(w, "%d vectors, %d failed\n", len(r.Results), r.Failed())
+}
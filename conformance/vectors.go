@@ -0,0 +1,176 @@
+package conformance
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the fault codes defined by supervisor.xmlrpc.Faults
+const (
+	faultBadName        = 10
+	faultBadSignal      = 11
+	faultSpawnError     = 50
+	faultAlreadyStarted = 60
+	faultNotRunning     = 70
+)
+
+// the programs used by the vectors, see Config
+const (
+	sleeperProgram = "sleeper"
+	failingProgram = "failing"
+	unknownName    = "nosuchprogram"
+)
+
+// Vector one XML-RPC call and the result expected by supervisor.rpcinterface.
+// The vectors are run in order and some of them depend on the state left by
+// the previous vectors
+type Vector struct {
+	Name   string
+	Method string
+	Params []interface{}
+	// the expected fault code, 0 if the call should succeed
+	Fault int
+	// check the result of successful call
+	Check func(result interface{}) error
+}
+
+// the keys of the struct returned by supervisor.getProcessInfo
+var processInfoKeys = []string{"name", "group", "description", "start", "stop", "now", "state",
+	"statename", "spawnerr", "exitstatus", "logfile", "stdout_logfile", "stderr_logfile", "pid"}
+
+// Vectors the test vectors of supervisor.rpcinterface
+var Vectors = []Vector{
+	{Name: "getAPIVersion", Method: "supervisor.getAPIVersion", Check: equals("3.0")},
+	{Name: "getIdentification", Method: "supervisor.getIdentification", Check: equals("supervisor")},
+	{Name: "getState", Method: "supervisor.getState", Check: hasFields(map[string]interface{}{"statecode": 1, "statename": "RUNNING"})},
+	{Name: "getPID", Method: "supervisor.getPID", Check: positive},
+	{Name: "getAllProcessInfo", Method: "supervisor.getAllProcessInfo", Check: allProcessInfo},
+	{Name: "getProcessInfo", Method: "supervisor.getProcessInfo", Params: params(sleeperProgram), Check: processInfo(sleeperProgram, "STOPPED")},
+	{Name: "getProcessInfo bad name", Method: "supervisor.getProcessInfo", Params: params(unknownName), Fault: faultBadName},
+	{Name: "startProcess", Method: "supervisor.startProcess", Params: params(sleeperProgram, true), Check: equals(true)},
+	{Name: "startProcess already started", Method: "supervisor.startProcess", Params: params(sleeperProgram, true), Fault: faultAlreadyStarted},
+	{Name: "getProcessInfo running", Method: "supervisor.getProcessInfo", Params: params(sleeperProgram), Check: processInfo(sleeperProgram, "RUNNING")},
+	{Name: "startProcess bad name", Method: "supervisor.startProcess", Params: params(unknownName, true), Fault: faultBadName},
+	{Name: "startProcessGroup bad name", Method: "supervisor.startProcessGroup", Params: params(unknownName, true), Fault: faultBadName},
+	{Name: "signalProcess bad signal", Method: "supervisor.signalProcess", Params: params(sleeperProgram, "NOSUCHSIGNAL"), Fault: faultBadSignal},
+	{Name: "signalProcess bad name", Method: "supervisor.signalProcess", Params: params(unknownName, "HUP"), Fault: faultBadName},
+	{Name: "signalAllProcesses bad signal", Method: "supervisor.signalAllProcesses", Params: params("NOSUCHSIGNAL"), Fault: faultBadSignal},
+	{Name: "sendProcessStdin bad name", Method: "supervisor.sendProcessStdin", Params: params(unknownName, "hello\n"), Fault: faultBadName},
+	{Name: "readProcessStdoutLog bad name", Method: "supervisor.readProcessStdoutLog", Params: params(unknownName, 0, 100), Fault: faultBadName},
+	{Name: "stopProcess", Method: "supervisor.stopProcess", Params: params(sleeperProgram, true), Check: equals(true)},
+	{Name: "stopProcess not running", Method: "supervisor.stopProcess", Params: params(sleeperProgram, true), Fault: faultNotRunning},
+	{Name: "stopProcess bad name", Method: "supervisor.stopProcess", Params: params(unknownName, true), Fault: faultBadName},
+	{Name: "signalProcess not running", Method: "supervisor.signalProcess", Params: params(sleeperProgram, "HUP"), Fault: faultNotRunning},
+	{Name: "sendProcessStdin not running", Method: "supervisor.sendProcessStdin", Params: params(sleeperProgram, "hello\n"), Fault: faultNotRunning},
+	{Name: "startProcess spawn error", Method: "supervisor.startProcess", Params: params(failingProgram, true), Fault: faultSpawnError},
+}
+
+func params(values ...interface{}) []interface{} {
+	return values
+}
+
+// Run call the vector and compare the result with the expectation
+func (v *Vector) Run(client *Client) Result {
+	result, err := client.Call(v.Method, v.Params...)
+	if err != nil {
+		fault, ok := err.(*Fault)
+		if !ok {
+			return Result{Name: v.Name, Method: v.Method, Status: StatusFail, Detail: err.Error()}
+		}
+		if v.Fault == 0 {
+			return Result{Name: v.Name, Method: v.Method, Status: StatusFail, Detail: fmt.Sprintf("unexpected fault %s", fault)}
+		}
+		if fault.Code != v.Fault {
+			return Result{Name: v.Name, Method: v.Method, Status: StatusFail, Detail: fmt.Sprintf("expect fault %d, got %s", v.Fault, fault)}
+		}
+		return Result{Name: v.Name, Method: v.Method, Status: StatusPass}
+	}
+	if v.Fault != 0 {
+		return Result{Name: v.Name, Method: v.Method, Status: StatusFail, Detail: fmt.Sprintf("expect fault %d, got %v", v.Fault, result)}
+	}
+	if v.Check != nil {
+		if err = v.Check(result); err != nil {
+			return Result{Name: v.Name, Method: v.Method, Status: StatusFail, Detail: err.Error()}
+		}
+	}
+	return Result{Name: v.Name, Method: v.Method, Status: StatusPass}
+}
+
+func equals(expected interface{}) func(interface{}) error {
+	return func(result interface{}) error {
+		if result != expected {
+			return fmt.Errorf("expect %v, got %v", expected, result)
+		}
+		return nil
+	}
+}
+
+func positive(result interface{}) error {
+	if n, ok := result.(int); !ok || n <= 0 {
+		return fmt.Errorf("expect a positive int, got %v", result)
+	}
+	return nil
+}
+
+// check the fields of the struct, the string fields are compared case-insensitively
+func hasFields(fields map[string]interface{}) func(interface{}) error {
+	return func(result interface{}) error {
+		m, ok := result.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expect a struct, got %v", result)
+		}
+		for key, expected := range fields {
+			value, ok := m[key]
+			if !ok {
+				return fmt.Errorf("missing member %s", key)
+			}
+			s, isString := expected.(string)
+			if isString && strings.EqualFold(fmt.Sprint(value), s) {
+				continue
+			}
+			if value != expected {
+				return fmt.Errorf("expect %s=%v, got %v", key, expected, value)
+			}
+		}
+		return nil
+	}
+}
+
+func hasKeys(result interface{}, keys []string) error {
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("expect a struct, got %v", result)
+	}
+	for _, key := range keys {
+		if _, ok := m[key]; !ok {
+			return fmt.Errorf("missing member %s", key)
+		}
+	}
+	return nil
+}
+
+func processInfo(name string, statename string) func(interface{}) error {
+	check := hasFields(map[string]interface{}{"name": name, "group": name, "statename": statename})
+	return func(result interface{}) error {
+		if err := hasKeys(result, processInfoKeys); err != nil {
+			return err
+		}
+		return check(result)
+	}
+}
+
+func allProcessInfo(result interface{}) error {
+	infos, ok := result.([]interface{})
+	if !ok {
+		return fmt.Errorf("expect an array, got %v", result)
+	}
+	if len(infos) != 2 {
+		return fmt.Errorf("expect the info of 2 programs, got %d", len(infos))
+	}
+	for _, info := range infos {
+		if err := hasKeys(info, processInfoKeys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
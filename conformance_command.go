@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/ochinchina/supervisord/conformance"
+)
+
+// ConformanceCommand implements flags.Commander interface
+type ConformanceCommand struct {
+	ServerURL     string `short:"s" long:"serverurl" description:"the supervisord server to test, an embedded supervisord is started if it is empty"`
+	User          string `short:"u" long:"user" description:"the user name" default:"admin"`
+	Password      string `short:"P" long:"password" description:"the password" default:"admin"`
+	Supervisorctl string `long:"supervisorctl" description:"the path of python supervisorctl, found in PATH if it is empty"`
+}
+
+var conformanceCommand ConformanceCommand
+
+// Execute run the conformance vectors and exit with error if any of them fails
+func (x *ConformanceCommand) Execute(args []string) error {
+	return exitOnError(x.run())
+}
+
+func (x *ConformanceCommand) run() error {
+	supervisorctl := x.Supervisorctl
+	if supervisorctl == "" {
+		supervisorctl, _ = exec.LookPath("supervisorctl")
+	}
+	serverURL := x.ServerURL
+	if serverURL == "" {
+		s, url, err := startEmbeddedSupervisor("supervisord-conformance", func(address string) string {
+			return conformance.Config(address, x.User, x.Password)
+		})
+		if err != nil {
+			return err
+		}
+		defer s.GetManager().StopAllProcesses()
+		serverURL = url
+	}
+	report := conformance.Run(serverURL, x.User, x.Password, supervisorctl)
+	report.Write(os.Stdout)
+	if report.Failed() > 0 {
+		return fmt.Errorf("%d vectors deviate from python supervisord", report.Failed())
+	}
+	return nil
+}
+
+// start supervisord on a free local port with the configuration created by
+// config, the configuration must contain the inet_http_server on the address
+func startEmbeddedSupervisor(name string, config func(address string) string) (*Supervisor, string, error) {
+	dir, err := ioutil.TempDir("", name)
+	if err != nil {
+		return nil, "", err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", err
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	content := fmt.Sprintf("[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\n\n%[2]s",
+		dir, config(address))
+	configFile := filepath.Join(dir, "supervisord.conf")
+	if err = ioutil.WriteFile(configFile, []byte(content), 0600); err != nil {
+		return nil, "", err
+	}
+	s := NewSupervisor(configFile)
+	if _, _, _, err = s.Reload(); err != nil {
+		return nil, "", err
+	}
+	// the http server is started in background
+	for i := 0; i < 50; i++ {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			conn.Close()
+			return s, "http://" + address, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil, "", errors.New("fail to start the embedded supervisord")
+}
+
+func init() {
+	parser.AddCommand("conformance",
+		"check the conformance with python supervisord",
+		"The conformance subcommand runs the supervisor.rpcinterface and supervisorctl test vectors and reports the XML-RPC methods and faults deviating from python supervisord",
+		&conformanceCommand)
+}
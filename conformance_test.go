@@ -0,0 +1,27 @@
+// +build !windows,!nohttp
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ochinchina/supervisord/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	s, serverURL, err := startEmbeddedSupervisor("supervisord-conformance", func(address string) string {
+		return conformance.Config(address, "admin", "admin")
+	})
+	if err != nil {
+		t.Fatalf("fail to start the embedded supervisord: %v", err)
+	}
+	defer s.GetManager().StopAllProcesses()
+
+	report := conformance.Run(serverURL, "admin", "admin", "")
+	if report.Failed() > 0 {
+		var buf bytes.Buffer
+		report.Write(&buf)
+		t.Errorf("fail to conform to python supervisord:\n%s", buf.String())
+	}
+}
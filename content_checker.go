@@ -7,6 +7,8 @@ import (
 	"os/exec"
 	"strings"
 	"time"
+
+	"github.com/ochinchina/supervisord/process"
 )
 
 // ContentChecker define the check interface
@@ -86,7 +88,7 @@ func (sc *ScriptChecker) Check() bool {
 	if len(sc.args) > 1 {
 		cmd.Args = sc.args
 	}
-	err := cmd.Run()
+	err := process.RunCommand(cmd)
 	return err == nil && cmd.ProcessState != nil && cmd.ProcessState.Success()
 }
 
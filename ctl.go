@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"github.com/jessevdk/go-flags"
 	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/process"
 	"github.com/ochinchina/supervisord/types"
 	"github.com/ochinchina/supervisord/xmlrpcclient"
+	"io"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 )
 
 // CtlCommand the entry of ctl command
@@ -17,22 +20,43 @@ type CtlCommand struct {
 	User      string `short:"u" long:"user" description:"the user name"`
 	Password  string `short:"P" long:"password" description:"the password"`
 	Verbose   bool   `short:"v" long:"verbose" description:"Show verbose debug information"`
+	Curl      bool   `long:"curl" description:"print the equivalent REST call as a curl command instead of executing it"`
+
+	rpcc *xmlrpcclient.XMLRPCClient // the client used instead of connecting to ServerURL if not nil
 }
 
 // StatusCommand get the status of all supervisor managed programs
 type StatusCommand struct {
+	WaitFor string        `long:"wait-for" description:"wait until the programs are in the state, e.g. RUNNING"`
+	Timeout time.Duration `long:"timeout" default:"60s" description:"the maximum time to wait for the state, 0 to wait forever"`
 }
 
+// the exit code of "status --wait-for" if the programs are not in the state
+// before timeout, same as the timeout command
+const waitForTimeoutExitCode = 124
+
+// the interval to check the state of programs in "status --wait-for"
+const waitForInterval = 500 * time.Millisecond
+
+// the interval to show the progress of the starting programs in "start --wait"
+const startProgressInterval = 200 * time.Millisecond
+
 // StartCommand start the given program
 type StartCommand struct {
+	DryRun  bool          `long:"dry-run" description:"show the ordered actions without starting the programs"`
+	Wait    bool          `long:"wait" description:"show the progress until the programs are running or fail to start"`
+	Timeout time.Duration `long:"timeout" description:"the maximum time to wait for the programs started with --wait"`
+	Env     []string      `long:"env" description:"override the environment of this start only with KEY=VALUE, repeatable"`
 }
 
 // StopCommand stop the given program
 type StopCommand struct {
+	DryRun bool `long:"dry-run" description:"show the ordered actions without stopping the programs"`
 }
 
 // RestartCommand restart the given program
 type RestartCommand struct {
+	DryRun bool `long:"dry-run" description:"show the ordered actions without restarting the programs"`
 }
 
 // ShutdownCommand shutdown the supervisor
@@ -51,6 +75,12 @@ type PidCommand struct {
 type SignalCommand struct {
 }
 
+// MaintailCommand show the end of the supervisord log and follow it through http interface
+type MaintailCommand struct {
+	Follow bool `short:"f" long:"follow" description:"follow the supervisord log through http interface"`
+	Bytes  int  `long:"bytes" default:"1600" description:"the number of bytes to show from the end of the log"`
+}
+
 // LogtailCommand tail the stdout/stderr log of program through http interface
 type LogtailCommand struct {
 }
@@ -68,15 +98,16 @@ type CmdCheckWrapperCommand struct {
 }
 
 var ctlCommand CtlCommand
-var statusCommand = CmdCheckWrapperCommand{&StatusCommand{}, 0, ""}
-var startCommand = CmdCheckWrapperCommand{&StartCommand{}, 0, ""}
-var stopCommand = CmdCheckWrapperCommand{&StopCommand{}, 0, ""}
-var restartCommand = CmdCheckWrapperCommand{&RestartCommand{}, 0, ""}
+var statusCommand StatusCommand
+var startCommand StartCommand
+var stopCommand StopCommand
+var restartCommand RestartCommand
 var shutdownCommand = CmdCheckWrapperCommand{&ShutdownCommand{}, 0, ""}
 var reloadCommand = CmdCheckWrapperCommand{&ReloadCommand{}, 0, ""}
 var pidCommand = CmdCheckWrapperCommand{&PidCommand{}, 1, "pid <program>"}
 var signalCommand = CmdCheckWrapperCommand{&SignalCommand{}, 2, "signal <signal_name> <program>[...]"}
 var logtailCommand = CmdCheckWrapperCommand{&LogtailCommand{}, 1, "logtail <program>"}
+var maintailCommand MaintailCommand
 
 func (x *CtlCommand) getServerURL() string {
 	options.Configuration, _ = findSupervisordConf()
@@ -129,6 +160,9 @@ func (x *CtlCommand) getPassword() string {
 }
 
 func (x *CtlCommand) createRPCClient() *xmlrpcclient.XMLRPCClient {
+	if x.rpcc != nil {
+		return x.rpcc
+	}
 	rpcc := xmlrpcclient.NewXMLRPCClient(x.getServerURL(), x.Verbose)
 	rpcc.SetUser(x.getUser())
 	rpcc.SetPassword(x.getPassword())
@@ -188,6 +222,66 @@ func (x *CtlCommand) status(rpcc *xmlrpcclient.XMLRPCClient, processes []string)
 	} else {
 		os.Exit(1)
 	}
+	if reply, err := rpcc.GetState(); err == nil {
+		if reply.Value.Since > 0 {
+			since := time.Unix(int64(reply.Value.Since), 0)
+			fmt.Printf("supervisord is running %s since %s\n", reply.Value.Operation, since.Format("2006-01-02 15:04:05"))
+		}
+		if reply.Value.Statename == "DEGRADED" {
+			fmt.Printf("supervisord is DEGRADED, the configuration can't be loaded: %s\n", reply.Value.Error)
+		}
+	}
+}
+
+// wait until all the processes are in the state, return false if timeout.
+// All the processes are waited if no process is specified
+func (x *CtlCommand) waitForState(rpcc *xmlrpcclient.XMLRPCClient, processes []string, state string, timeout time.Duration) bool {
+	processesMap := make(map[string]bool)
+	for _, name := range processes {
+		processesMap[name] = true
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		reply, err := rpcc.GetAllProcessInfo()
+		if err != nil {
+			fmt.Printf("Fail to get the process status: %v\n", err)
+			os.Exit(1)
+		}
+		if x.inState(&reply, processesMap, state) {
+			x.showProcessInfo(&reply, processesMap)
+			return true
+		}
+		if timeout > 0 && time.Now().After(deadline) {
+			x.showProcessInfo(&reply, processesMap)
+			return false
+		}
+		time.Sleep(waitForInterval)
+	}
+}
+
+// check if all the selected processes are in the state, false if no process is selected
+func (x *CtlCommand) inState(reply *xmlrpcclient.AllProcessInfoReply, processesMap map[string]bool, state string) bool {
+	found := false
+	for _, pinfo := range reply.Value {
+		if x.inProcessMap(&pinfo, processesMap) {
+			if !strings.EqualFold(pinfo.Statename, state) {
+				return false
+			}
+			found = true
+		}
+	}
+	return found
+}
+
+// check if the name is one of the process states, case insensitive
+func isProcessStateName(name string) bool {
+	for _, state := range []process.State{process.Stopped, process.Spawning, process.Starting, process.Running,
+		process.Backoff, process.Stopping, process.Exited, process.Fatal, process.Unknown} {
+		if strings.EqualFold(state.String(), name) {
+			return true
+		}
+	}
+	return false
 }
 
 // start or stop the processes
@@ -231,8 +325,141 @@ func (x *CtlCommand) _startStopProcesses(rpcc *xmlrpcclient.XMLRPCClient, verb s
 	}
 }
 
+// start the processes one by one and show their state changes until they are
+// running or fail to start, return the exit code of the command
+func (x *CtlCommand) startWithProgress(rpcc *xmlrpcclient.XMLRPCClient, processes []string, timeout time.Duration, env ...string) int {
+	if len(processes) <= 0 {
+		fmt.Printf("Please specify process for start\n")
+		return 1
+	}
+	if timeout > 0 {
+		// supervisord stops waiting after timeout, leave a margin for the response
+		rpcc.SetTimeout(timeout + 5*time.Second)
+	}
+	for _, pname := range processes {
+		processesMap := make(map[string]bool)
+		if pname != "all" {
+			processesMap[pname] = true
+		}
+		done := make(chan error, 1)
+		go func(pname string) {
+			done <- rpcc.StartProcessWait(pname, timeout, env...)
+		}(pname)
+
+		states := make(map[string]string)
+		var err error
+		for finished := false; !finished; {
+			select {
+			case err = <-done:
+				finished = true
+			case <-time.After(startProgressInterval):
+			}
+			x.showProgress(rpcc, processesMap, states)
+		}
+		if err != nil {
+			if strings.Contains(err.Error(), "STILL_RUNNING") {
+				fmt.Printf("%s: timeout to wait for the program started\n", pname)
+				return waitForTimeoutExitCode
+			}
+			fmt.Printf("%s: failed [%v]\n", pname, err)
+			return 1
+		}
+		for _, state := range states {
+			if state != process.State(process.Running).String() {
+				fmt.Printf("%s: not started\n", pname)
+				return 1
+			}
+		}
+		fmt.Printf("%s: started\n", pname)
+	}
+	return 0
+}
+
+// start the processes with the environment overrides of this start only
+func (x *CtlCommand) startWithEnv(rpcc *xmlrpcclient.XMLRPCClient, processes []string, env []string) {
+	if len(processes) <= 0 {
+		fmt.Printf("Please specify process for start\n")
+	}
+	for _, pname := range processes {
+		if err := rpcc.StartProcessWait(pname, 0, env...); err != nil {
+			fmt.Printf("%s: failed [%v]\n", pname, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: started\n", pname)
+	}
+}
+
+// print the processes whose state is changed since the last call, the states
+// are updated with the current ones
+func (x *CtlCommand) showProgress(rpcc *xmlrpcclient.XMLRPCClient, processesMap map[string]bool, states map[string]string) {
+	reply, err := rpcc.GetAllProcessInfo()
+	if err != nil {
+		return
+	}
+	for _, pinfo := range reply.Value {
+		if !x.inProcessMap(&pinfo, processesMap) {
+			continue
+		}
+		processName := pinfo.GetFullName()
+		if states[processName] == pinfo.Statename {
+			continue
+		}
+		states[processName] = pinfo.Statename
+		if !x.showGroupName() {
+			processName = pinfo.Name
+		}
+		// the description of running process has its pid and uptime
+		if pinfo.Statename == process.State(process.Running).String() {
+			fmt.Printf("%s: %s (%s)\n", processName, pinfo.Statename, pinfo.Description)
+		} else {
+			fmt.Printf("%s: %s\n", processName, pinfo.Statename)
+		}
+	}
+}
+
+// show the ordered actions of the verbs on the processes without executing them
+func (x *CtlCommand) showPlan(rpcc *xmlrpcclient.XMLRPCClient, verbs []string, processes []string) {
+	if len(processes) <= 0 {
+		fmt.Printf("Please specify process for %s\n", strings.Join(verbs, "/"))
+	}
+	step := 0
+	stopped := make(map[string]bool)
+	for _, verb := range verbs {
+		for _, pname := range processes {
+			plan, err := rpcc.PlanProcessState(verb, pname)
+			if err != nil {
+				fmt.Printf("%s: failed [%v]\n", pname, err)
+				os.Exit(1)
+			}
+			for _, action := range plan {
+				step++
+				if action.Action == "stop" {
+					stopped[action.Name] = true
+				} else if action.Action == "skip" && verb == "start" && stopped[action.Name] {
+					// the process is stopped by the previous verb
+					action.Action = "start"
+					action.Description = "to be started"
+				}
+				name := action.Name
+				if action.Group != "" && action.Group != action.Name {
+					name = action.Group + ":" + action.Name
+				}
+				fmt.Printf("%-4d%-6s%-33s%-10s%-10d%s\n", step, action.Action, name, action.Statename, action.Priority, action.Description)
+			}
+		}
+	}
+}
+
 func (x *CtlCommand) restartProcesses(rpcc *xmlrpcclient.XMLRPCClient, processes []string) {
-	x._startStopProcesses(rpcc, "stop", processes, "stopped", false)
+	for _, pname := range processes {
+		if pname == "all" {
+			rpcc.ChangeAllProcessState("stop")
+		} else if _, err := rpcc.ChangeProcessState("stop", pname); err != nil && !strings.Contains(err.Error(), "NOT_RUNNING") {
+			// the program which is not running is started directly
+			fmt.Printf("%s: failed [%v]\n", pname, err)
+			os.Exit(1)
+		}
+	}
 	x._startStopProcesses(rpcc, "start", processes, "restarted", true)
 }
 
@@ -369,42 +596,104 @@ func (x *CtlCommand) getANSIColor(statename string) string {
 
 // Execute implements flags.Commander interface to get status of program
 func (sc *StatusCommand) Execute(args []string) error {
-	ctlCommand.status(ctlCommand.createRPCClient(), args)
+	if ctlCommand.printCurl("status", args, false) {
+		return nil
+	}
+	if sc.WaitFor == "" {
+		ctlCommand.status(ctlCommand.createRPCClient(), args)
+		return nil
+	}
+	if !isProcessStateName(sc.WaitFor) {
+		fmt.Printf("Unknown process state %s\n", sc.WaitFor)
+		os.Exit(1)
+	}
+	if !ctlCommand.waitForState(ctlCommand.createRPCClient(), args, sc.WaitFor, sc.Timeout) {
+		fmt.Printf("Timeout to wait for the programs to be %s\n", strings.ToUpper(sc.WaitFor))
+		os.Exit(waitForTimeoutExitCode)
+	}
 	return nil
 }
 
 // Execute start the given programs
 func (sc *StartCommand) Execute(args []string) error {
+	if ctlCommand.printCurl("start", args, sc.DryRun, sc.Env...) {
+		return nil
+	}
+	if sc.DryRun {
+		ctlCommand.showPlan(ctlCommand.createRPCClient(), []string{"start"}, args)
+		return nil
+	}
+	if len(sc.Env) > 0 {
+		for _, pname := range args {
+			if pname == "all" {
+				fmt.Println("The environment overrides can't be applied to all the programs")
+				os.Exit(1)
+			}
+		}
+	}
+	if sc.Wait {
+		if code := ctlCommand.startWithProgress(ctlCommand.createRPCClient(), args, sc.Timeout, sc.Env...); code != 0 {
+			os.Exit(code)
+		}
+		return nil
+	}
+	if len(sc.Env) > 0 {
+		ctlCommand.startWithEnv(ctlCommand.createRPCClient(), args, sc.Env)
+		return nil
+	}
 	ctlCommand.startStopProcesses(ctlCommand.createRPCClient(), "start", args)
 	return nil
 }
 
 // Execute stop the given programs
 func (sc *StopCommand) Execute(args []string) error {
+	if ctlCommand.printCurl("stop", args, sc.DryRun) {
+		return nil
+	}
+	if sc.DryRun {
+		ctlCommand.showPlan(ctlCommand.createRPCClient(), []string{"stop"}, args)
+		return nil
+	}
 	ctlCommand.startStopProcesses(ctlCommand.createRPCClient(), "stop", args)
 	return nil
 }
 
 // Execute restart the programs
 func (rc *RestartCommand) Execute(args []string) error {
+	if ctlCommand.printCurl("restart", args, rc.DryRun) {
+		return nil
+	}
+	if rc.DryRun {
+		ctlCommand.showPlan(ctlCommand.createRPCClient(), []string{"stop", "start"}, args)
+		return nil
+	}
 	ctlCommand.restartProcesses(ctlCommand.createRPCClient(), args)
 	return nil
 }
 
 // Execute shutdown the supervisor
 func (sc *ShutdownCommand) Execute(args []string) error {
+	if ctlCommand.printCurl("shutdown", args, false) {
+		return nil
+	}
 	ctlCommand.shutdown(ctlCommand.createRPCClient())
 	return nil
 }
 
 // Execute stop the running programs and reload the supervisor configuration
 func (rc *ReloadCommand) Execute(args []string) error {
+	if ctlCommand.printCurl("reload", args, false) {
+		return nil
+	}
 	ctlCommand.reload(ctlCommand.createRPCClient())
 	return nil
 }
 
 // Execute send signal to program
 func (rc *SignalCommand) Execute(args []string) error {
+	if ctlCommand.printCurl("signal", args, false) {
+		return nil
+	}
 	sigName, processes := args[0], args[1:]
 	ctlCommand.signal(ctlCommand.createRPCClient(), sigName, processes)
 	return nil
@@ -412,12 +701,18 @@ func (rc *SignalCommand) Execute(args []string) error {
 
 // Execute get the pid of program
 func (pc *PidCommand) Execute(args []string) error {
+	if ctlCommand.printCurl("pid", args, false) {
+		return nil
+	}
 	ctlCommand.getPid(ctlCommand.createRPCClient(), args[0])
 	return nil
 }
 
 // Execute tail the stdout/stderr of a program through http interrface
 func (lc *LogtailCommand) Execute(args []string) error {
+	if ctlCommand.printCurl("logtail", args, false) {
+		return nil
+	}
 	program := args[0]
 	go func() {
 		lc.tailLog(program, "stderr")
@@ -432,6 +727,31 @@ func (lc *LogtailCommand) tailLog(program string, dev string) error {
 		return err
 	}
 	url := fmt.Sprintf("%s/logtail/%s/%s", ctlCommand.getServerURL(), program, dev)
+	if dev == "stdout" {
+		return tailHTTPLog(url, os.Stdout)
+	}
+	return tailHTTPLog(url, os.Stderr)
+}
+
+// Execute show the end of the supervisord log and follow it with -f
+func (mc *MaintailCommand) Execute(args []string) error {
+	if ctlCommand.printCurl("maintail", args, false) {
+		return nil
+	}
+	data, err := ctlCommand.createRPCClient().ReadLog(-mc.Bytes, 0)
+	if err != nil {
+		fmt.Printf("Fail to read the supervisord log: %v\n", err)
+		return err
+	}
+	fmt.Print(data)
+	if !mc.Follow {
+		return nil
+	}
+	return tailHTTPLog(ctlCommand.getServerURL()+"/mainlogtail", os.Stdout)
+}
+
+// tailHTTPLog write the log streamed by the logtail url to out until the connection is closed
+func tailHTTPLog(url string, out io.Writer) error {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return err
@@ -442,19 +762,20 @@ func (lc *LogtailCommand) tailLog(program string, dev string) error {
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("fail to tail the log: %s", resp.Status)
+		fmt.Println(err)
+		return err
+	}
 	buf := make([]byte, 10240)
 	for {
 		n, err := resp.Body.Read(buf)
+		out.Write(buf[0:n])
 		if err != nil {
 			return err
 		}
-		if dev == "stdout" {
-			os.Stdout.Write(buf[0:n])
-		} else {
-			os.Stderr.Write(buf[0:n])
-		}
 	}
-	return nil
 }
 
 // Execute check if the number of arguments is ok
@@ -496,6 +817,30 @@ func init() {
 		"reload the programs",
 		"reload the programs",
 		&reloadCommand)
+	ctlCmd.AddCommand("reread",
+		"show the groups changed in the configuration file",
+		"show the groups added, changed or removed in the configuration file without applying them",
+		&rereadCommand)
+	ctlCmd.AddCommand("avail",
+		"show the programs of the configuration file",
+		"show the programs of the configuration file and if they are in service",
+		&availCommand)
+	ctlCmd.AddCommand("add",
+		"bring groups into service",
+		"bring the groups of the configuration file into service and start their autostart programs",
+		&addCommand)
+	ctlCmd.AddCommand("remove",
+		"take groups out of service",
+		"take the stopped groups out of service until they are added again or the configuration is reloaded",
+		&removeCommand)
+	ctlCmd.AddCommand("run",
+		"run an ad-hoc command once",
+		"run an ad-hoc command once under supervision and print the name of its program, the handle of its state and its log",
+		&runCommand)
+	ctlCmd.AddCommand("exec",
+		"run a command in the context of a program",
+		"run a command with the user, the environment, the working directory and the cgroup of a program without affecting it, print its output and exit with its exit status",
+		&execCommand)
 	ctlCmd.AddCommand("signal",
 		"send signal to program",
 		"send signal to program",
@@ -508,5 +853,33 @@ func init() {
 		"get the standard output&standard error of the program",
 		"get the standard output&standard error of the program",
 		&logtailCommand)
-
+	ctlCmd.AddCommand("maintail",
+		"show the end of the supervisord log",
+		"show the last bytes of the supervisord log and follow it with -f",
+		&maintailCommand)
+	ctlCmd.AddCommand("watch",
+		"show the state changes of programs",
+		"show the state changes of all or some programs and raise alerts on the failures, with the terminal bell or desktop notifications",
+		&watchCommand)
+	ctlCmd.AddCommand("limit",
+		"change the resource limits of a running program",
+		"change the cgroup memory and CPU limits or the nice value of a running program without restarting it, until the next reload",
+		&limitCommand)
+	snapshotCmd, _ := ctlCmd.AddCommand("snapshot",
+		"save or restore the runtime state of the programs",
+		"save the runtime state of the programs (running or stopped, resource limits changed at runtime) to a JSON file and restore it after a reprovisioning or on another identical host",
+		&snapshotCommand)
+	snapshotCmd.AddCommand("save",
+		"save the runtime state to a JSON file",
+		"save the runtime state of the programs to the JSON file argument, or print it without argument",
+		&snapshotSaveCommand)
+	snapshotCmd.AddCommand("restore",
+		"restore the runtime state from a JSON file",
+		"start or stop the programs as in the snapshot file argument and change their resource limits again, the programs not in the snapshot are unchanged",
+		&snapshotRestoreCommand)
+	chaosCmd, _ := ctlCmd.AddCommand("chaos",
+		"kill or delay programs for resilience drills",
+		"kill or pause (SIGSTOP then SIGCONT) running programs picked randomly among the targets of the [chaos] section, which must be enabled",
+		&chaosCommand)
+	chaosCmd.Hidden = true
 }
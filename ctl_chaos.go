@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ochinchina/supervisord/types"
+)
+
+// ChaosCommand kill or delay the programs picked randomly for a resilience drill
+type ChaosCommand struct {
+	Action   string        `long:"action" default:"kill" choice:"kill" choice:"delay" description:"kill the processes or pause them for the duration"`
+	Count    int           `long:"count" default:"1" description:"the number of processes picked randomly"`
+	Duration time.Duration `long:"duration" default:"10s" description:"the time the processes are paused by the delay action"`
+	Reason   string        `long:"reason" description:"the reason recorded in the audit log"`
+}
+
+var chaosCommand ChaosCommand
+
+// Execute run the chaos drill on the programs matching the pattern argument,
+// or on all the targets of the [chaos] section without argument
+func (cc *ChaosCommand) Execute(args []string) error {
+	// the empty string isn't sent as is by the xml codec
+	name := "*"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	actions, err := ctlCommand.createRPCClient().Chaos(types.ChaosArgs{Action: cc.Action,
+		Name:     name,
+		Count:    cc.Count,
+		Duration: int(cc.Duration.Seconds()),
+		Reason:   cc.Reason})
+	if err != nil {
+		fmt.Printf("Fail to run the chaos drill: %v\n", err)
+		return err
+	}
+	fmt.Println(formatChaosActions(actions, cc.Duration))
+	return nil
+}
+
+// format the processes hit by a chaos drill, one per line
+func formatChaosActions(actions []types.ChaosAction, delay time.Duration) string {
+	lines := make([]string, 0, len(actions))
+	for _, action := range actions {
+		result := "killed"
+		if action.Action == chaosDelay {
+			result = fmt.Sprintf("paused for %s", delay)
+		}
+		lines = append(lines, fmt.Sprintf("%s (pid %d): %s", action.Name, action.Pid, result))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// a REST call of the http interface equivalent to a ctl command
+type restCall struct {
+	method string
+	path   string
+	// the JSON body, empty if the call has no body
+	body string
+}
+
+// get the REST call equivalent to the ctl command verb with its arguments and
+// the environment overrides of start, an error if the http interface has no
+// equivalent
+func getRESTCall(verb string, args []string, dryRun bool, env ...string) (restCall, error) {
+	noEquivalent := fmt.Errorf("the REST interface has no equivalent of ctl %s", strings.Join(append([]string{verb}, args...), " "))
+	for _, name := range args {
+		if name == "all" && verb != "status" {
+			return restCall{}, noEquivalent
+		}
+	}
+	switch verb {
+	case "status":
+		return restCall{method: "GET", path: "/program/list"}, nil
+	case "start", "stop", "restart":
+		if len(args) == 0 {
+			return restCall{}, fmt.Errorf("Please specify process for %s", verb)
+		}
+		if len(args) == 1 {
+			query := url.Values{}
+			if dryRun {
+				query.Set("dryRun", "true")
+			}
+			if verb == "start" && len(env) > 0 {
+				query["env"] = env
+			}
+			call := restCall{method: "POST", path: "/program/" + verb + "/" + url.PathEscape(args[0])}
+			if len(query) > 0 {
+				call.path += "?" + query.Encode()
+			}
+			return call, nil
+		}
+		// the programs are changed together only by startPrograms and stopPrograms
+		if verb == "restart" || dryRun || len(env) > 0 {
+			return restCall{}, noEquivalent
+		}
+		body, err := json.Marshal(args)
+		if err != nil {
+			return restCall{}, err
+		}
+		return restCall{method: "POST", path: "/program/" + verb + "Programs", body: string(body)}, nil
+	case "shutdown", "reload":
+		return restCall{method: "POST", path: "/supervisor/" + verb}, nil
+	case "logtail":
+		if len(args) != 1 {
+			return restCall{}, noEquivalent
+		}
+		return restCall{method: "GET", path: "/logtail/" + url.PathEscape(args[0]) + "/stdout"}, nil
+	case "maintail":
+		return restCall{method: "GET", path: "/mainlogtail"}, nil
+	}
+	return restCall{}, noEquivalent
+}
+
+// quote the word for the shell
+func shellQuote(word string) string {
+	return "'" + strings.Replace(word, "'", `'\''`, -1) + "'"
+}
+
+// format the curl command of the REST call. The password is not printed,
+// curl asks for it if a user is given
+func (call restCall) curl(serverURL string, user string) string {
+	words := []string{"curl"}
+	if call.method != "GET" {
+		words = append(words, "-X", call.method)
+	}
+	if user != "" {
+		words = append(words, "-u", shellQuote(user))
+	}
+	if call.body != "" {
+		words = append(words, "-H", shellQuote("Content-Type: application/json"), "-d", shellQuote(call.body))
+	}
+	return strings.Join(append(words, shellQuote(strings.TrimRight(serverURL, "/")+call.path)), " ")
+}
+
+// print the curl command equivalent to the ctl command instead of executing
+// it if --curl is set, return false if the command must be executed
+func (x *CtlCommand) printCurl(verb string, args []string, dryRun bool, env ...string) bool {
+	if !x.Curl {
+		return false
+	}
+	call, err := getRESTCall(verb, args, dryRun, env...)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println(call.curl(x.getServerURL(), x.getUser()))
+	return true
+}
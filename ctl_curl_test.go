@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCtlCurl(t *testing.T) {
+	for _, test := range []struct {
+		verb   string
+		args   []string
+		dryRun bool
+		user   string
+		curl   string
+		env    []string
+	}{
+		{"status", nil, false, "", "curl 'http://localhost:9001/program/list'", nil},
+		{"start", []string{"web"}, false, "admin", "curl -X POST -u 'admin' 'http://localhost:9001/program/start/web'", nil},
+		{"stop", []string{"web"}, true, "", "curl -X POST 'http://localhost:9001/program/stop/web?dryRun=true'", nil},
+		{"start", []string{"web"}, false, "", "curl -X POST 'http://localhost:9001/program/start/web?env=DEBUG%3D1'", []string{"DEBUG=1"}},
+		{"stop", []string{"web", "db"}, false, "", `curl -X POST -H 'Content-Type: application/json' -d '["web","db"]' 'http://localhost:9001/program/stopPrograms'`, nil},
+		{"reload", nil, false, "o'neil", `curl -X POST -u 'o'\''neil' 'http://localhost:9001/supervisor/reload'`, nil},
+		{"logtail", []string{"web"}, false, "", "curl 'http://localhost:9001/logtail/web/stdout'", nil},
+	} {
+		call, err := getRESTCall(test.verb, test.args, test.dryRun, test.env...)
+		if err != nil {
+			t.Errorf("fail to get the REST call of %s %v: %v", test.verb, test.args, err)
+		} else if curl := call.curl("http://localhost:9001/", test.user); curl != test.curl {
+			t.Errorf("the curl command of %s %v is %s", test.verb, test.args, curl)
+		}
+	}
+
+	for _, args := range [][]string{{"signal", "HUP", "web"}, {"start", "all"}, {"restart", "web", "db"}} {
+		if _, err := getRESTCall(args[0], args[1:], false); err == nil {
+			t.Errorf("the REST interface has no equivalent of %v", args)
+		}
+	}
+}
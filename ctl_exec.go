@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ochinchina/supervisord/types"
+)
+
+// ExecCommand run a command in the context of a program
+type ExecCommand struct {
+	Timeout time.Duration `long:"timeout" default:"60s" description:"the command is killed after the timeout, 0 for the max_operation_secs"`
+	Reason  string        `long:"reason" description:"the reason recorded in the audit log"`
+}
+
+var execCommand ExecCommand
+
+// Execute run the command with the user, the environment, the working
+// directory and the cgroup of the program, print its output and exit with
+// its exit status
+func (ec *ExecCommand) Execute(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: exec <program> -- <command> <arg>...")
+	}
+	words := make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		words = append(words, quoteRunArgument(arg))
+	}
+	timeout := int((ec.Timeout + time.Second - 1) / time.Second)
+	rpcc := ctlCommand.createRPCClient()
+	if timeout > 0 {
+		// the command is killed after timeout, leave a margin for the response
+		rpcc.SetTimeout(ec.Timeout + 5*time.Second)
+	}
+	result, err := rpcc.ExecInProcessContext(types.ExecArgs{Name: args[0],
+		Command: strings.Join(words, " "),
+		Timeout: timeout,
+		Reason:  ec.Reason})
+	if err != nil {
+		fmt.Printf("Fail to run the command in the context of %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+	fmt.Print(result.Output)
+	if result.ExitStatus != 0 {
+		os.Exit(result.ExitStatus)
+	}
+	return nil
+}
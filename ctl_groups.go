@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ochinchina/supervisord/types"
+	"github.com/ochinchina/supervisord/xmlrpcclient"
+)
+
+// RereadCommand show the groups changed in the configuration file without applying them
+type RereadCommand struct {
+}
+
+// AvailCommand show the programs of the configuration file and if they are in service
+type AvailCommand struct {
+}
+
+// AddCommand bring the groups of the configuration file into service
+type AddCommand struct {
+}
+
+// RemoveCommand take the stopped groups out of service
+type RemoveCommand struct {
+}
+
+var rereadCommand RereadCommand
+var availCommand AvailCommand
+var addCommand = CmdCheckWrapperCommand{&AddCommand{}, 1, "add <group>[...]"}
+var removeCommand = CmdCheckWrapperCommand{&RemoveCommand{}, 1, "remove <group>[...]"}
+
+// Execute print the added, changed and removed groups like supervisorctl reread
+func (rc *RereadCommand) Execute(args []string) error {
+	reply, err := ctlCommand.createRPCClient().RereadConfig()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	if len(reply.AddedGroup)+len(reply.ChangedGroup)+len(reply.RemovedGroup) == 0 {
+		fmt.Println("No config updates to processes")
+	}
+	for _, group := range reply.AddedGroup {
+		fmt.Printf("%s: available\n", group)
+	}
+	for _, group := range reply.ChangedGroup {
+		fmt.Printf("%s: changed\n", group)
+	}
+	for _, group := range reply.RemovedGroup {
+		fmt.Printf("%s: disappeared\n", group)
+	}
+	return nil
+}
+
+// Execute print the programs with "in use" or "avail" like supervisorctl avail
+func (ac *AvailCommand) Execute(args []string) error {
+	infos, err := ctlCommand.createRPCClient().GetAllConfigInfo()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	for _, info := range infos {
+		inuse, autostart := "avail", "manual"
+		if info.Inuse {
+			inuse = "in use"
+		}
+		if info.Autostart {
+			autostart = "auto"
+		}
+		name := info.Name
+		if info.Group != "" && info.Group != info.Name {
+			name = info.Group + ":" + info.Name
+		}
+		fmt.Printf("%-32s %-12s %s\n", name, inuse, autostart)
+	}
+	return nil
+}
+
+// Execute add the group arguments
+func (ac *AddCommand) Execute(args []string) error {
+	return changeProcessGroups(args, "added", (*xmlrpcclient.XMLRPCClient).AddProcessGroup)
+}
+
+// Execute remove the group arguments
+func (rc *RemoveCommand) Execute(args []string) error {
+	return changeProcessGroups(args, "removed", (*xmlrpcclient.XMLRPCClient).RemoveProcessGroup)
+}
+
+// add or remove the groups one by one and print the result of each one, the
+// command fails if a group can't be changed
+func changeProcessGroups(groups []string, action string, change func(*xmlrpcclient.XMLRPCClient, string) (types.BooleanReply, error)) error {
+	rpcc := ctlCommand.createRPCClient()
+	failed := false
+	for _, group := range groups {
+		if _, err := change(rpcc, group); err != nil {
+			fmt.Printf("ERROR: %s: %s\n", group, strings.TrimSpace(err.Error()))
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: %s process group\n", group, action)
+	}
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// +build !windows
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	xmlrpc "github.com/ochinchina/gorilla-xmlrpc/xml"
+	"github.com/ochinchina/supervisord/faults"
+)
+
+func TestCtlGroups(t *testing.T) {
+	s := startCtlTestSupervisor(t)
+	reply := struct{ Success bool }{}
+
+	s.GetManager().Find("sleeper").Start(true)
+	err := s.RemoveProcessGroup(nil, &struct{ Name string }{"sleeper"}, &reply)
+	if fault, ok := err.(*xmlrpc.Fault); !ok || fault.Code != faults.StillRunning {
+		t.Errorf("fail to refuse to remove the running group: %v", err)
+	}
+	s.GetManager().Find("sleeper").Stop(true)
+
+	if output := captureOutput(t, func() { removeCommand.Execute([]string{"sleeper"}) }); output != "sleeper: removed process group\n" {
+		t.Errorf("fail to remove the group: %q", output)
+	}
+	if s.GetManager().Find("sleeper") != nil || s.config.GetProgram("sleeper") != nil {
+		t.Errorf("the removed program is still in service")
+	}
+	if output := captureOutput(t, func() { rereadCommand.Execute(nil) }); output != "sleeper: available\n" {
+		t.Errorf("fail to show the available group: %q", output)
+	}
+	if output := captureOutput(t, func() { availCommand.Execute(nil) }); !strings.Contains(output, "sleeper") || !strings.Contains(output, "avail ") {
+		t.Errorf("fail to show the program not in service: %q", output)
+	}
+
+	if output := captureOutput(t, func() { addCommand.Execute([]string{"sleeper"}) }); output != "sleeper: added process group\n" {
+		t.Errorf("fail to add the group: %q", output)
+	}
+	if s.GetManager().Find("sleeper") == nil {
+		t.Errorf("the added program is not in service")
+	}
+	if output := captureOutput(t, func() { availCommand.Execute(nil) }); !strings.Contains(output, "in use") || strings.Contains(output, "avail ") {
+		t.Errorf("fail to show the program in service: %q", output)
+	}
+	if output := captureOutput(t, func() { rereadCommand.Execute(nil) }); output != "No config updates to processes\n" {
+		t.Errorf("fail to show the unchanged configuration: %q", output)
+	}
+	err = s.AddProcessGroup(nil, &struct{ Name string }{"sleeper"}, &reply)
+	if fault, ok := err.(*xmlrpc.Fault); !ok || fault.Code != faults.AlreadyAdded {
+		t.Errorf("fail to refuse to add the group in service: %v", err)
+	}
+	err = s.AddProcessGroup(nil, &struct{ Name string }{"missing"}, &reply)
+	if fault, ok := err.(*xmlrpc.Fault); !ok || fault.Code != faults.BadName {
+		t.Errorf("fail to refuse to add the unknown group: %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ochinchina/supervisord/types"
+)
+
+// LimitCommand change the resource limits of a running program until the next reload
+type LimitCommand struct {
+	Memory string `long:"memory" description:"the memory limit of the cgroup of the program, like 512MB or max"`
+	CPU    string `long:"cpu" description:"the CPU limit of the cgroup of the program in percent of a CPU, like 150 or max"`
+	Nice   string `long:"nice" description:"the nice value of the program, from -20 to 19"`
+	Reason string `long:"reason" description:"the reason recorded in the audit log"`
+}
+
+var limitCommand LimitCommand
+
+// Execute change the limits of the program argument and print its limits
+func (lc *LimitCommand) Execute(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("the program name is required")
+	}
+	limits, err := ctlCommand.createRPCClient().SetProcessResourceLimits(types.ResourceLimitsArgs{Name: args[0],
+		Memory: lc.Memory,
+		CPU:    lc.CPU,
+		Nice:   lc.Nice,
+		Reason: lc.Reason})
+	if err != nil {
+		fmt.Printf("Fail to change the resource limits: %v\n", err)
+		return err
+	}
+	fmt.Printf("%s: memory=%s cpu=%s nice=%s\n", args[0], limits.Memory, limits.CPU, limits.Nice)
+	return nil
+}
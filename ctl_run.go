@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ochinchina/supervisord/process"
+	"github.com/ochinchina/supervisord/types"
+	"github.com/ochinchina/supervisord/xmlrpcclient"
+)
+
+// RunCommand run an ad-hoc command once under supervision
+type RunCommand struct {
+	Directory string        `long:"directory" description:"the working directory of the command"`
+	Env       []string      `long:"env" description:"the KEY=VALUE environment of the command, repeatable"`
+	TTL       time.Duration `long:"ttl" description:"the time the finished program is kept, defaults to run_ttl_secs"`
+	Reason    string        `long:"reason" description:"the reason recorded in the audit log"`
+	Wait      bool          `long:"wait" description:"wait until the command finishes and exit with its exit status"`
+}
+
+var runCommand RunCommand
+
+// quote the argument of the command if it has spaces or quotes, like the
+// command of a program is split
+func quoteRunArgument(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\") {
+		return arg
+	}
+	if !strings.Contains(arg, "'") {
+		return "'" + arg + "'"
+	}
+	return "\"" + strings.Replace(arg, "\"", "\\\"", -1) + "\""
+}
+
+// Execute run the command of the arguments and print the name of its program
+func (rc *RunCommand) Execute(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("the command to run is required")
+	}
+	words := make([]string, 0, len(args))
+	for _, arg := range args {
+		words = append(words, quoteRunArgument(arg))
+	}
+	rpcc := ctlCommand.createRPCClient()
+	name, err := rpcc.RunProgram(types.RunArgs{Command: strings.Join(words, " "),
+		Directory: rc.Directory,
+		Env:       rc.Env,
+		TTL:       int((rc.TTL + time.Second - 1) / time.Second),
+		Reason:    rc.Reason})
+	if err != nil {
+		fmt.Printf("Fail to run the command: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(name)
+	if rc.Wait {
+		os.Exit(waitForRun(rpcc, name))
+	}
+	return nil
+}
+
+// wait until the ad-hoc program finishes, print its final state and return
+// its exit status (1 if it failed to start)
+func waitForRun(rpcc *xmlrpcclient.XMLRPCClient, name string) int {
+	for {
+		info, err := rpcc.GetProcessInfo(name)
+		if err != nil {
+			fmt.Printf("Fail to get the state of %s: %v\n", name, err)
+			return 1
+		}
+		switch info.Statename {
+		case process.State(process.Exited).String(), process.State(process.Stopped).String():
+			fmt.Printf("%s: %s (exit status %d)\n", name, info.Statename, info.Exitstatus)
+			return info.Exitstatus
+		case process.State(process.Fatal).String(), process.State(process.Unknown).String():
+			fmt.Printf("%s: %s\n", name, info.Statename)
+			return 1
+		}
+		time.Sleep(waitForInterval)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/ochinchina/supervisord/process"
+	"github.com/ochinchina/supervisord/types"
+)
+
+// the version of the format of the runtime snapshots
+const snapshotVersion = 1
+
+// runtimeSnapshot the runtime state of the programs saved to a JSON file
+type runtimeSnapshot struct {
+	Version  int                     `json:"version"`
+	Host     string                  `json:"host"`
+	Time     time.Time               `json:"time"`
+	Programs []types.ProgramSnapshot `json:"programs"`
+}
+
+// SnapshotCommand save and restore the runtime state of the programs
+type SnapshotCommand struct{}
+
+// SnapshotSaveCommand save the runtime state of the programs to a JSON file
+type SnapshotSaveCommand struct{}
+
+// SnapshotRestoreCommand restore the runtime state of the programs from a JSON file
+type SnapshotRestoreCommand struct {
+	Reason string `long:"reason" description:"the reason recorded in the audit log"`
+}
+
+var snapshotCommand SnapshotCommand
+var snapshotSaveCommand SnapshotSaveCommand
+var snapshotRestoreCommand SnapshotRestoreCommand
+
+// Execute save the snapshot to the file argument, or print it without argument
+func (sc *SnapshotSaveCommand) Execute(args []string) error {
+	programs, err := ctlCommand.createRPCClient().GetRuntimeSnapshot()
+	if err != nil {
+		fmt.Printf("Fail to get the runtime state: %v\n", err)
+		return err
+	}
+	snapshot := runtimeSnapshot{Version: snapshotVersion, Time: time.Now(), Programs: make([]types.ProgramSnapshot, 0, len(programs))}
+	snapshot.Host, _ = os.Hostname()
+	for _, program := range programs {
+		program.Group = rpcString(program.Group)
+		program.Limits = types.ResourceLimits{Memory: rpcString(program.Limits.Memory), CPU: rpcString(program.Limits.CPU), Nice: rpcString(program.Limits.Nice)}
+		snapshot.Programs = append(snapshot.Programs, program)
+	}
+	b, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		fmt.Println(string(b))
+		return nil
+	}
+	if err = ioutil.WriteFile(args[0], append(b, '\n'), 0644); err != nil {
+		fmt.Printf("Fail to save the snapshot: %v\n", err)
+		return err
+	}
+	fmt.Printf("Saved the state of %d programs to %s\n", len(snapshot.Programs), args[0])
+	return nil
+}
+
+// read the snapshot file
+func readSnapshot(fileName string) (*runtimeSnapshot, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &runtimeSnapshot{}
+	if err = json.Unmarshal(b, snapshot); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %v", fileName, err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+	return snapshot, nil
+}
+
+// Execute restore the snapshot of the file argument: the programs are
+// started or stopped as in the snapshot and their changed resource limits are
+// changed again. The programs not in the snapshot are unchanged
+func (rc *SnapshotRestoreCommand) Execute(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("the snapshot file is required")
+	}
+	snapshot, err := readSnapshot(args[0])
+	if err != nil {
+		fmt.Printf("Fail to restore the snapshot: %v\n", err)
+		return err
+	}
+	rpcc := ctlCommand.createRPCClient()
+	reply, err := rpcc.GetAllProcessInfo()
+	if err != nil {
+		fmt.Printf("Fail to get the state of the programs: %v\n", err)
+		return err
+	}
+	running := make(map[string]bool)
+	for _, info := range reply.Value {
+		running[info.Name] = isRunningState(process.State(info.State))
+	}
+	reason := rc.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("restore the snapshot of %s at %s", snapshot.Host, snapshot.Time.Format(time.RFC3339))
+	}
+	failures := 0
+	for _, program := range snapshot.Programs {
+		isRunning, ok := running[program.Name]
+		if !ok {
+			fmt.Printf("%s: not found\n", program.Name)
+			failures++
+			continue
+		}
+		// the limits are changed first so the started program gets them
+		if program.Limits != (types.ResourceLimits{}) {
+			if _, err = rpcc.SetProcessResourceLimits(types.ResourceLimitsArgs{Name: program.Name,
+				Memory: program.Limits.Memory,
+				CPU:    program.Limits.CPU,
+				Nice:   program.Limits.Nice,
+				Reason: reason}); err != nil {
+				fmt.Printf("%s: fail to change the resource limits [%v]\n", program.Name, err)
+				failures++
+			}
+		}
+		result := "unchanged"
+		if program.Running && !isRunning {
+			result = "started"
+			_, err = rpcc.ChangeProcessState("start", program.Name)
+		} else if !program.Running && isRunning {
+			result = "stopped"
+			_, err = rpcc.ChangeProcessState("stop", program.Name)
+		}
+		if err != nil {
+			fmt.Printf("%s: failed [%v]\n", program.Name, err)
+			failures++
+			continue
+		}
+		fmt.Printf("%s: %s\n", program.Name, result)
+	}
+	if failures > 0 {
+		return fmt.Errorf("fail to restore %d programs", failures)
+	}
+	return nil
+}
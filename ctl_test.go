@@ -0,0 +1,98 @@
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"supervisord/internal/testutil"
+)
+
+// create a supervisord without http server and let the ctl commands call it
+// through the in-memory transport
+func startCtlTestSupervisor(t *testing.T) *Supervisor {
+	dir := testutil.TempDir(t)
+	content := fmt.Sprintf("[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\n\n"+
+		"[program:sleeper]\ncommand=%[2]s\nautostart=false\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n",
+		dir, testutil.FakeProgram(t, dir, testutil.Sleep))
+	s := NewSupervisor(testutil.WriteFile(t, dir, "supervisord.conf", content))
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to start supervisord: %v", err)
+	}
+	ctlCommand.rpcc = s.xmlRPC.NewInMemoryClient(s)
+	t.Cleanup(func() {
+		ctlCommand.rpcc = nil
+		s.GetManager().StopAllProcesses()
+	})
+	return s
+}
+
+// run the command and return what it prints to stdout
+func captureOutput(t *testing.T, run func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal("fail to create pipe")
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	run()
+	os.Stdout = stdout
+	w.Close()
+	b, _ := ioutil.ReadAll(r)
+	return string(b)
+}
+
+func TestCtlCommandsInMemory(t *testing.T) {
+	startCtlTestSupervisor(t)
+
+	output := captureOutput(t, func() { statusCommand.Execute(nil) })
+	if !strings.Contains(output, "sleeper") || !strings.Contains(output, "Stopped") {
+		t.Errorf("fail to show the status: %q", output)
+	}
+	output = captureOutput(t, func() { startCommand.Execute([]string{"sleeper"}) })
+	if output != "sleeper: started\n" {
+		t.Errorf("fail to start the program: %q", output)
+	}
+	output = captureOutput(t, func() { statusCommand.Execute([]string{"sleeper"}) })
+	if !strings.Contains(output, "Running") {
+		t.Errorf("fail to show the running program: %q", output)
+	}
+	output = captureOutput(t, func() { stopCommand.Execute([]string{"sleeper"}) })
+	if output != "sleeper: stopped\n" {
+		t.Errorf("fail to stop the program: %q", output)
+	}
+}
+
+func TestCtlStatusWaitFor(t *testing.T) {
+	startCtlTestSupervisor(t)
+	rpcc := ctlCommand.createRPCClient()
+
+	var reached bool
+	captureOutput(t, func() { reached = ctlCommand.waitForState(rpcc, []string{"sleeper"}, "RUNNING", 100*time.Millisecond) })
+	if reached {
+		t.Error("fail to time out waiting for the stopped program")
+	}
+	go rpcc.ChangeProcessState("start", "sleeper")
+	output := captureOutput(t, func() { reached = ctlCommand.waitForState(rpcc, nil, "running", 5*time.Second) })
+	if !reached || !strings.Contains(output, "Running") {
+		t.Errorf("fail to wait for the program to be running: %q", output)
+	}
+	if !isProcessStateName("fatal") || isProcessStateName("RUNING") {
+		t.Error("fail to check the process state name")
+	}
+}
+
+func TestCtlStartWithProgress(t *testing.T) {
+	startCtlTestSupervisor(t)
+
+	var code int
+	output := captureOutput(t, func() { code = ctlCommand.startWithProgress(ctlCommand.createRPCClient(), []string{"sleeper"}, 5*time.Second) })
+	if code != 0 || !strings.Contains(output, "sleeper: Running (pid") || !strings.HasSuffix(output, "sleeper: started\n") {
+		t.Errorf("fail to show the progress of starting program: %d %q", code, output)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/ochinchina/supervisord/events"
+	"github.com/ochinchina/supervisord/types"
+)
+
+// WatchCommand show the state changes of the programs and raise alerts on some of them
+type WatchCommand struct {
+	Events string `long:"events" default:"PROCESS_STATE" description:"the state events to show, like PROCESS_STATE_EXITED,PROCESS_STATE_FATAL or PROCESS_STATE_*"`
+	Alert  string `long:"alert" default:"PROCESS_STATE_EXITED,PROCESS_STATE_BACKOFF,PROCESS_STATE_FATAL" description:"the shown state events raising an alert"`
+	Notify bool   `long:"notify" description:"raise the alerts as desktop notifications instead of ringing the terminal bell"`
+}
+
+var watchCommand WatchCommand
+
+// the interval to subscribe again after the connection to supervisord is lost
+const watchReconnectInterval = 2 * time.Second
+
+const watchQuery = `subscription($events: String) { processStateChanged(events: $events) { name group statename fromState pid } }`
+
+// the state change of a program received by the watch command
+type watchStateChange struct {
+	Name      string `json:"name"`
+	Group     string `json:"group"`
+	Statename string `json:"statename"`
+	FromState string `json:"fromState"`
+	Pid       int    `json:"pid"`
+}
+
+// the server-sent event of the processStateChanged subscription
+type watchEvent struct {
+	Data struct {
+		ProcessStateChanged *watchStateChange `json:"processStateChanged"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// Execute show the state changes of the given programs, or all the programs,
+// until the command is interrupted
+func (wc *WatchCommand) Execute(args []string) error {
+	processesMap := make(map[string]bool)
+	for _, process := range args {
+		processesMap[process] = true
+	}
+	url := ctlCommand.getServerURL() + "/graphql"
+	for {
+		err := wc.watch(url, processesMap, os.Stdout)
+		fmt.Printf("the connection to supervisord is lost: %v, subscribe again in %v\n", err, watchReconnectInterval)
+		time.Sleep(watchReconnectInterval)
+	}
+}
+
+// watch subscribe the state changes and write them to out until the
+// connection is closed
+func (wc *WatchCommand) watch(url string, processesMap map[string]bool, out io.Writer) error {
+	body, _ := json.Marshal(map[string]interface{}{"query": watchQuery,
+		"variables": map[string]interface{}{"events": wc.Events}})
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	req.SetBasicAuth(ctlCommand.getUser(), ctlCommand.getPassword())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	alert := events.NewEventMatcher(splitList(wc.Alert))
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		event := watchEvent{}
+		if err := json.Unmarshal([]byte(line[len("data: "):]), &event); err != nil {
+			continue
+		}
+		if len(event.Errors) > 0 {
+			return fmt.Errorf("%s", event.Errors[0].Message)
+		}
+		change := event.Data.ProcessStateChanged
+		if change == nil || !ctlCommand.inProcessMap(&types.ProcessInfo{Name: change.Name, Group: change.Group}, processesMap) {
+			continue
+		}
+		statename := strings.ToUpper(change.Statename)
+		bell := ""
+		if alert.Match("PROCESS_STATE_"+statename) && !wc.notify(change, statename, out) {
+			bell = "\a"
+		}
+		fmt.Fprintf(out, "%s%s %s%-33s%-10s%s(from %s, pid %d)\n", bell, time.Now().Format("15:04:05"),
+			ctlCommand.getANSIColor(statename), change.Name, statename, "\x1b[0m", change.FromState, change.Pid)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// notify show a desktop notification if --notify is set, return false if the
+// alert is not raised, the terminal bell is rung instead
+func (wc *WatchCommand) notify(change *watchStateChange, statename string, out io.Writer) bool {
+	if !wc.Notify {
+		return false
+	}
+	err := notifyDesktop("supervisord", fmt.Sprintf("%s is %s", change.Name, statename))
+	if err != nil {
+		fmt.Fprintf(out, "fail to raise the desktop notification, ring the bell instead: %v\n", err)
+		wc.Notify = false
+	}
+	return err == nil
+}
+
+// notifyDesktop show a notification with the tool of the desktop
+func notifyDesktop(title string, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("osascript", "-e", fmt.Sprintf("display notification %q with title %q", message, title))
+	case "windows":
+		cmd = exec.Command("msg", "*", fmt.Sprintf("%s: %s", title, message))
+	default:
+		cmd = exec.Command("notify-send", title, message)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -25,3 +25,16 @@ func Deamonize(proc func()) {
 	defer context.Release()
 	proc()
 }
+
+// runForegroundHidden there is no console to detach from except on Windows,
+// proc runs in the foreground
+func runForegroundHidden(proc func()) {
+	log.Warn("--foreground-hidden only applies to Windows, run in the foreground")
+	proc()
+}
+
+// runsAsService the service managers other than the Windows one run
+// supervisord as a normal process
+func runsAsService() bool {
+	return false
+}
@@ -2,6 +2,35 @@
 
 package main
 
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/kardianos/service"
+	log "github.com/sirupsen/logrus"
+)
+
+var freeConsole = syscall.NewLazyDLL("kernel32.dll").NewProc("FreeConsole")
+
+// Deamonize the daemon mode is not supported on Windows, supervisord runs in
+// background as a Windows service
 func Deamonize(proc func()) {
+	fmt.Fprintln(os.Stderr, "the daemon mode (-d) is not supported on Windows: install and start supervisord as a Windows service with \"supervisord service install\" and \"supervisord service start\", or run it without console with --foreground-hidden")
+	os.Exit(1)
+}
+
+// runForegroundHidden detach this process from its console and run proc, so
+// closing the console doesn't stop supervisord. The log is only written to
+// the logfile of the supervisord section
+func runForegroundHidden(proc func()) {
+	if r, _, err := freeConsole.Call(); r == 0 {
+		log.WithFields(log.Fields{log.ErrorKey: err}).Fatal("fail to detach from the console")
+	}
 	proc()
 }
+
+// runsAsService return true if supervisord is started by the Windows service manager
+func runsAsService() bool {
+	return !service.Interactive()
+}
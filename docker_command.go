@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+
+	"github.com/ochinchina/supervisord/dockerrun"
+)
+
+// DockerRunCommand implements flags.Commander interface, it runs the command of
+// a program with the docker runner in a container by the Docker Engine API
+type DockerRunCommand struct {
+	Host    string   `long:"host" description:"the Docker Engine API host, unix:///path or tcp://host:port"`
+	Name    string   `long:"name" description:"the name of the container" required:"true"`
+	Image   string   `long:"image" description:"the image of the container" required:"true"`
+	Volumes []string `long:"volume" description:"the volume mounted in the container, src:dst or src:dst:ro"`
+	Env     []string `long:"env" description:"the name of the environment variable passed to the container"`
+}
+
+var dockerRunCommand DockerRunCommand
+
+// Execute implement Execute() method defined in flags.Commander interface, executes the given command
+func (dc DockerRunCommand) Execute(args []string) error {
+	env := make([]string, 0)
+	for _, name := range dc.Env {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	code, err := dockerrun.Run(dockerrun.Options{Host: dc.Host,
+		Name:    dc.Name,
+		Image:   dc.Image,
+		Command: args,
+		Env:     env,
+		Volumes: dc.Volumes,
+		Signals: notifyForwardedSignals(),
+		Stdin:   os.Stdin,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr})
+	exitOnError(err)
+	os.Exit(code)
+	return nil
+}
+
+func init() {
+	cmd, _ := parser.AddCommand("docker-run",
+		"run a command in a docker container",
+		"The docker-run subcommand runs the command of a program with the docker runner in a container by the Docker Engine API",
+		&dockerRunCommand)
+	cmd.Hidden = true
+}
@@ -0,0 +1,356 @@
+// Package dockerrun runs the command of the programs with the docker runner in
+// a container managed by the Docker Engine API
+package dockerrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// the version of the Engine API, supported since docker 19.03
+	apiVersion = "v1.40"
+	// the Engine API host used if the host and DOCKER_HOST are empty
+	defaultHost = "unix:///var/run/docker.sock"
+	// the time to receive the rest of the output once the container exits
+	outputTimeout = 5 * time.Second
+	// the timeout of the removal of a container
+	removeTimeout = 10 * time.Second
+)
+
+// Options the options of the container running the command
+type Options struct {
+	// the Engine API host "unix:///path" or "tcp://host:port", DOCKER_HOST or
+	// the default socket if it is empty
+	Host string
+	// the name of the container
+	Name  string
+	Image string
+	// the command run in the container, the default command of the image if it is empty
+	Command []string
+	// the "key=value" environment of the container
+	Env []string
+	// the volumes "src:dst" or "src:dst:ro" mounted in the container
+	Volumes []string
+	// the names of the signals (TERM, HUP...) forwarded to the container
+	Signals <-chan string
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+}
+
+// Client the client of the Docker Engine API
+type Client struct {
+	http *http.Client
+	// the url of the API with its version
+	base string
+}
+
+// NewClient create the client of the Engine API of the host "unix:///path" or
+// "tcp://host:port", DOCKER_HOST or the default socket if it is empty
+func NewClient(host string) (*Client, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = defaultHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %s: %v", host, err)
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		}}
+		return &Client{http: &http.Client{Transport: transport}, base: "http://docker/" + apiVersion}, nil
+	case "tcp", "http":
+		return &Client{http: &http.Client{}, base: "http://" + u.Host + "/" + apiVersion}, nil
+	default:
+		return nil, fmt.Errorf("unsupported docker host %s", host)
+	}
+}
+
+// the error replied by the Engine API
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("docker: %s (%d)", e.message, e.status)
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*apiError)
+	return ok && e.status == http.StatusNotFound
+}
+
+// send the request to the Engine API, the response is returned only if the
+// request is successful
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if strings.HasSuffix(path, "/attach") {
+		// the connection is hijacked to stream the stdin and the output
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "tcp")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		reply := struct{ Message string }{}
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if json.Unmarshal(b, &reply) != nil || reply.Message == "" {
+			reply.Message = strings.TrimSpace(string(b))
+		}
+		return nil, &apiError{status: resp.StatusCode, message: reply.Message}
+	}
+	return resp, nil
+}
+
+// send the request and discard the reply
+func (c *Client) call(ctx context.Context, method string, path string, query url.Values, body interface{}) error {
+	resp, err := c.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+type hostConfig struct {
+	Binds      []string `json:",omitempty"`
+	AutoRemove bool
+}
+
+type containerConfig struct {
+	Image        string
+	Cmd          []string `json:",omitempty"`
+	Env          []string `json:",omitempty"`
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+	OpenStdin    bool
+	HostConfig   hostConfig
+}
+
+// create the container removed by docker once it exits, like "docker run --rm -i"
+func (c *Client) create(ctx context.Context, options Options) (string, error) {
+	config := containerConfig{Image: options.Image,
+		Cmd:          options.Command,
+		Env:          options.Env,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		OpenStdin:    true,
+		HostConfig:   hostConfig{Binds: options.Volumes, AutoRemove: true}}
+	resp, err := c.do(ctx, "POST", "/containers/create", url.Values{"name": {options.Name}}, &config)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	reply := struct{ ID string }{}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return "", fmt.Errorf("fail to create the container: %v", err)
+	}
+	return reply.ID, nil
+}
+
+// split the image into its name and its tag, the tag is "latest" if the image
+// has neither tag nor digest
+func splitImage(image string) (string, string) {
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+	if pos := strings.LastIndex(image, ":"); pos > strings.LastIndex(image, "/") {
+		return image[:pos], image[pos+1:]
+	}
+	return image, "latest"
+}
+
+// pull the image like "docker run" if it is not found
+func (c *Client) pull(ctx context.Context, image string) error {
+	name, tag := splitImage(image)
+	query := url.Values{"fromImage": {name}}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	resp, err := c.do(ctx, "POST", "/images/create", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// the progress is streamed until the image is pulled or an error occurs
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		progress := struct{ Error string }{}
+		if err := decoder.Decode(&progress); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("fail to pull the image %s: %v", image, err)
+		}
+		if progress.Error != "" {
+			return fmt.Errorf("fail to pull the image %s: %s", image, progress.Error)
+		}
+	}
+}
+
+// attach to the stdin, stdout and stderr of the container
+func (c *Client) attach(ctx context.Context, id string) (io.ReadWriteCloser, error) {
+	query := url.Values{"stream": {"1"}, "stdin": {"1"}, "stdout": {"1"}, "stderr": {"1"}}
+	resp, err := c.do(ctx, "POST", "/containers/"+id+"/attach", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok || resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fail to attach to the container: %s", resp.Status)
+	}
+	return conn, nil
+}
+
+// copy the multiplexed stdout and stderr of the container without tty
+func demux(stream io.Reader, stdout io.Writer, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(stream, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		if _, err := io.CopyN(w, stream, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+	}
+}
+
+// Run run the command in a new container until it exits and return its exit
+// code, 128 + the signal number if it is killed by a signal
+func Run(options Options) (int, error) {
+	client, err := NewClient(options.Host)
+	if err != nil {
+		return 0, err
+	}
+	ctx := context.Background()
+	id, err := client.create(ctx, options)
+	if isNotFound(err) {
+		if err = client.pull(ctx, options.Image); err == nil {
+			id, err = client.create(ctx, options)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	conn, err := client.attach(ctx, id)
+	if err != nil {
+		client.remove(ctx, id)
+		return 0, err
+	}
+	defer conn.Close()
+	// the exit of the container removed once it exits is only known if the
+	// wait is requested before it is started
+	wait, err := client.do(ctx, "POST", "/containers/"+id+"/wait", url.Values{"condition": {"removed"}}, nil)
+	if err != nil {
+		client.remove(ctx, id)
+		return 0, err
+	}
+	defer wait.Body.Close()
+	if err := client.call(ctx, "POST", "/containers/"+id+"/start", nil, nil); err != nil {
+		client.remove(ctx, id)
+		return 0, err
+	}
+
+	output := make(chan error, 1)
+	go func() { output <- demux(conn, options.Stdout, options.Stderr) }()
+	if options.Stdin != nil {
+		go io.Copy(conn, options.Stdin)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case name := <-options.Signals:
+				client.call(ctx, "POST", "/containers/"+id+"/kill", url.Values{"signal": {name}}, nil)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	result := struct {
+		StatusCode int
+		Error      *struct{ Message string }
+	}{}
+	if err := json.NewDecoder(wait.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("fail to wait for the container: %v", err)
+	}
+	if result.Error != nil && result.Error.Message != "" {
+		return 0, fmt.Errorf("fail to wait for the container: %s", result.Error.Message)
+	}
+	select {
+	case <-output:
+	case <-time.After(outputTimeout):
+	}
+	return result.StatusCode, nil
+}
+
+// remove the container even if it is running
+func (c *Client) remove(ctx context.Context, name string) error {
+	err := c.call(ctx, "DELETE", "/containers/"+name, url.Values{"force": {"1"}}, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Remove remove the container left running with the name, nothing is done if
+// there is no such container
+func Remove(host string, name string) error {
+	client, err := NewClient(host)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), removeTimeout)
+	defer cancel()
+	return client.remove(ctx, name)
+}
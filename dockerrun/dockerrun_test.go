@@ -0,0 +1,155 @@
+package dockerrun
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// the fake Engine API running a single container, the command "echo" prints
+// to stdout and stderr and exits with the status 3, the command "wait" waits
+// for a signal and exits with 128 + its number
+type testEngine struct {
+	sync.Mutex
+	pulled bool
+	pull   string
+	config containerConfig
+	stream net.Conn
+	exit   chan int
+}
+
+// write the frame of the multiplexed output
+func writeFrame(conn net.Conn, stream byte, data string) {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+	conn.Write(append(header, data...))
+}
+
+func (e *testEngine) exited(code int) {
+	e.Lock()
+	e.stream.Close()
+	e.Unlock()
+	e.exit <- code
+}
+
+func (e *testEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch path := strings.TrimPrefix(r.URL.Path, "/v1.40"); path {
+	case "/images/create":
+		e.pulled = true
+		e.pull = r.URL.RawQuery
+		fmt.Fprint(w, `{"status":"Pulling"}{"status":"Downloaded"}`)
+	case "/containers/create":
+		if !e.pulled {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"No such image"}`)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&e.config)
+		fmt.Fprint(w, `{"Id":"c1"}`)
+	case "/containers/c1/attach":
+		conn, buf, _ := w.(http.Hijacker).Hijack()
+		buf.WriteString("HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		buf.Flush()
+		e.Lock()
+		e.stream = conn
+		e.Unlock()
+	case "/containers/c1/wait":
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		fmt.Fprintf(w, `{"StatusCode":%d}`, <-e.exit)
+	case "/containers/c1/start":
+		w.WriteHeader(http.StatusNoContent)
+		if e.config.Cmd[0] == "echo" {
+			e.Lock()
+			writeFrame(e.stream, 1, "out\n")
+			writeFrame(e.stream, 2, "err\n")
+			e.Unlock()
+			go e.exited(3)
+		}
+	case "/containers/c1/kill":
+		w.WriteHeader(http.StatusNoContent)
+		if r.URL.Query().Get("signal") == "TERM" {
+			go e.exited(143)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"message":"No such container: %s"}`, path)
+	}
+}
+
+func startTestEngine(t *testing.T) (*testEngine, string) {
+	engine := &testEngine{exit: make(chan int, 1)}
+	server := httptest.NewServer(engine)
+	t.Cleanup(server.Close)
+	return engine, "tcp://" + server.Listener.Addr().String()
+}
+
+func TestRun(t *testing.T) {
+	engine, host := startTestEngine(t)
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	code, err := Run(Options{Host: host,
+		Name:    "supervisord-web",
+		Image:   "nginx",
+		Command: []string{"echo", "hello"},
+		Env:     []string{"MODE=prod"},
+		Volumes: []string{"/srv/www:/www:ro"},
+		Stdout:  &stdout,
+		Stderr:  &stderr})
+	if err != nil || code != 3 {
+		t.Fatalf("fail to get the exit code of the container: %d %v", code, err)
+	}
+	if stdout.String() != "out\n" || stderr.String() != "err\n" {
+		t.Errorf("fail to demultiplex the output: %q %q", stdout.String(), stderr.String())
+	}
+	if engine.pull != "fromImage=nginx&tag=latest" {
+		t.Errorf("fail to pull the missing image: %s", engine.pull)
+	}
+	config := engine.config
+	if strings.Join(config.Env, " ") != "MODE=prod" || strings.Join(config.HostConfig.Binds, " ") != "/srv/www:/www:ro" ||
+		!config.HostConfig.AutoRemove || !config.OpenStdin {
+		t.Errorf("fail to create the container: %+v", config)
+	}
+}
+
+func TestRunSignal(t *testing.T) {
+	engine, host := startTestEngine(t)
+	engine.pulled = true
+	signals := make(chan string, 1)
+	signals <- "TERM"
+	code, err := Run(Options{Host: host,
+		Name:    "supervisord-web",
+		Image:   "nginx:1.25",
+		Command: []string{"wait"},
+		Signals: signals,
+		Stdout:  &bytes.Buffer{},
+		Stderr:  &bytes.Buffer{}})
+	if err != nil || code != 143 {
+		t.Errorf("fail to forward the signal to the container: %d %v", code, err)
+	}
+	if err := Remove(host, "supervisord-web"); err != nil {
+		t.Errorf("fail to ignore the container already removed: %v", err)
+	}
+}
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct{ image, name, tag string }{
+		{"nginx", "nginx", "latest"},
+		{"nginx:1.25", "nginx", "1.25"},
+		{"registry:5000/team/app", "registry:5000/team/app", "latest"},
+		{"registry:5000/team/app:v2", "registry:5000/team/app", "v2"},
+		{"nginx@sha256:abcd", "nginx@sha256:abcd", ""},
+	}
+	for _, test := range tests {
+		if name, tag := splitImage(test.image); name != test.name || tag != test.tag {
+			t.Errorf("fail to split the image %s: %s %s", test.image, name, tag)
+		}
+	}
+}
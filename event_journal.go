@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/ochinchina/supervisord/events"
+	log "github.com/sirupsen/logrus"
+)
+
+// the events persisted in the journal by default, the lifecycle events
+const defaultJournalEvents = "PROCESS_STATE,PROCESS_COREDUMP,PROCESS_GROUP,OPERATOR_ACTION,ROLLBACK,SUPERVISOR_STATE_CHANGE"
+
+// the default maximum size of the event journal
+const defaultJournalMaxBytes = 10 * 1024 * 1024
+
+// open the event journal set by event_journal in the supervisord section and
+// persist the events of event_journal_events to it, the journal of the
+// previous configuration is closed if it is changed
+func (s *Supervisor) loadJournal() {
+	fileName, maxBytes, journalEvents := "", int64(defaultJournalMaxBytes), defaultJournalEvents
+	if supervisordConf, ok := s.config.GetSupervisord(); ok {
+		fileName = supervisordConf.GetStringExpression("event_journal", "")
+		maxBytes = int64(supervisordConf.GetBytes("event_journal_maxbytes", defaultJournalMaxBytes))
+		journalEvents = supervisordConf.GetString("event_journal_events", defaultJournalEvents)
+	}
+	s.journalLock.Lock()
+	defer s.journalLock.Unlock()
+	if s.journal != nil && (s.journal.GetFileName() != fileName || fileName == "") {
+		events.Unsubscribe("event-journal")
+		s.journal.Close()
+		s.journal = nil
+	}
+	if fileName == "" {
+		return
+	}
+	if s.journal == nil {
+		journal, err := events.OpenJournal(fileName, maxBytes)
+		if err != nil {
+			log.WithFields(log.Fields{"file": fileName, log.ErrorKey: err}).Error("fail to open the event journal")
+			return
+		}
+		log.WithFields(log.Fields{"file": fileName, "seq": journal.LastSeq()}).Info("persist the events to the journal")
+		s.journal = journal
+	}
+	journal := s.journal
+	events.Subscribe("event-journal", splitList(journalEvents), func(event events.Event) {
+		if _, err := journal.Append(event); err != nil {
+			log.WithFields(log.Fields{"file": fileName, "event": event.GetType(), log.ErrorKey: err}).Error("fail to persist the event to the journal")
+		}
+	})
+}
+
+// get the event journal, nil if it is not enabled
+func (s *Supervisor) getJournal() *events.Journal {
+	s.journalLock.Lock()
+	defer s.journalLock.Unlock()
+	return s.journal
+}
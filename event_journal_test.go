@@ -0,0 +1,59 @@
+// +build !windows,!nohttp
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"supervisord/internal/testutil"
+
+	"github.com/ochinchina/supervisord/events"
+)
+
+func TestEventJournal(t *testing.T) {
+	dir := testutil.TempDir(t)
+	journalFile := filepath.Join(dir, "journal", "events.log")
+	content := testSupervisordSection + "event_journal=%[3]s\nevent_journal_events=PROCESS_STATE\n\n" +
+		"[program:web]\ncommand=%[2]s\nautostart=false\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n"
+	s := startConfSupervisor(t, dir, fmt.Sprintf(content, dir, testutil.FakeProgram(t, dir, testutil.Sleep), journalFile))
+	t.Cleanup(func() {
+		events.Unsubscribe("event-journal")
+		s.getJournal().Close()
+	})
+	s.GetManager().Find("web").Start(true)
+
+	router := NewSupervisorRestful(s).CreateSupervisorHandler()
+	type journalReply struct {
+		Events    []events.JournalEntry `json:"events"`
+		LastSeq   uint64                `json:"last_seq"`
+		Truncated bool                  `json:"truncated"`
+	}
+	list := func(url string, user *AuthUser) (int, journalReply) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withAuthUser(httptest.NewRequest("GET", url, nil), user))
+		reply := journalReply{}
+		json.NewDecoder(w.Body).Decode(&reply)
+		return w.Code, reply
+	}
+	admin := &AuthUser{Name: "admin", Admin: true}
+
+	if code, _ := list("/supervisor/events", &AuthUser{Name: "alice"}); code != http.StatusForbidden {
+		t.Errorf("fail to refuse the journal to the user not admin: %d", code)
+	}
+	if code, _ := list("/supervisor/events?after=x", admin); code != http.StatusBadRequest {
+		t.Errorf("fail to refuse the invalid sequence: %d", code)
+	}
+	code, reply := list("/supervisor/events", admin)
+	if code != http.StatusOK || len(reply.Events) != 2 || reply.LastSeq != 2 || reply.Events[0].Type != "PROCESS_STATE_STARTING" || reply.Events[1].Type != "PROCESS_STATE_RUNNING" {
+		t.Fatalf("fail to list the journal: %d %v", code, reply)
+	}
+	s.GetManager().Find("web").Stop(true)
+	if _, reply = list("/supervisor/events?after=2&limit=1", admin); len(reply.Events) != 1 || reply.Events[0].Seq != 3 || reply.Events[0].Type != "PROCESS_STATE_STOPPING" || reply.LastSeq != 4 {
+		t.Errorf("fail to catch up after a sequence: %v", reply)
+	}
+}
@@ -0,0 +1,183 @@
+package events
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the kinds of the queued events in the order they are dropped by the compaction
+const (
+	logEvents = iota
+	tickEvents
+	otherEvents
+	// the state transitions are kept as long as possible
+	stateEvents
+	eventKinds
+)
+
+var eventKindNames = [eventKinds]string{"log", "tick", "other", "state"}
+
+// queuedEvent the encoded event waiting to be sent to the event listener
+type queuedEvent struct {
+	data      []byte
+	kind      int
+	eventType string
+	// the number of times the event is rejected by the listeners of the pool
+	retries int
+}
+
+func getEventKind(eventType string) int {
+	switch {
+	case strings.HasPrefix(eventType, "PROCESS_LOG_"), strings.HasPrefix(eventType, "PROCESS_COMMUNICATION_"):
+		return logEvents
+	case strings.HasPrefix(eventType, "TICK_"):
+		return tickEvents
+	case strings.HasPrefix(eventType, "PROCESS_STATE_"), strings.HasPrefix(eventType, "SUPERVISOR_STATE_CHANGE_"):
+		return stateEvents
+	}
+	return otherEvents
+}
+
+// MemoryUsage the memory used by the events queued for the event listeners
+type MemoryUsage struct {
+	// the memory budget in bytes, 0 if it is unlimited
+	MaxBytes           int
+	QueuedBytes        int
+	QueuedEvents       int
+	DroppedLogEvents   int
+	DroppedTickEvents  int
+	DroppedOtherEvents int
+	DroppedStateEvents int
+}
+
+// eventBudget limit the memory of the events queued for all the event listeners
+type eventBudget struct {
+	maxBytes int64
+	bytes    int64
+	events   int64
+	dropped  [eventKinds]uint64
+	// serialize the compactions
+	compactLock sync.Mutex
+	lock        sync.Mutex
+	listeners   map[*EventListener]bool
+}
+
+var budget = &eventBudget{listeners: make(map[*EventListener]bool)}
+
+// SetMemoryBudget set the max bytes of the events queued for all the event
+// listeners, 0 for unlimited. If the budget is exceeded, the queued events are
+// dropped from the oldest one: the process log events first, then the tick
+// events and the other events, the state transitions last
+func SetMemoryBudget(maxBytes int64) {
+	atomic.StoreInt64(&budget.maxBytes, maxBytes)
+	budget.compact()
+}
+
+// GetMemoryUsage get the memory used by the queued events and the number of the dropped events
+func GetMemoryUsage() MemoryUsage {
+	return MemoryUsage{MaxBytes: int(atomic.LoadInt64(&budget.maxBytes)),
+		QueuedBytes:        int(atomic.LoadInt64(&budget.bytes)),
+		QueuedEvents:       int(atomic.LoadInt64(&budget.events)),
+		DroppedLogEvents:   int(atomic.LoadUint64(&budget.dropped[logEvents])),
+		DroppedTickEvents:  int(atomic.LoadUint64(&budget.dropped[tickEvents])),
+		DroppedOtherEvents: int(atomic.LoadUint64(&budget.dropped[otherEvents])),
+		DroppedStateEvents: int(atomic.LoadUint64(&budget.dropped[stateEvents]))}
+}
+
+func (b *eventBudget) add(event *queuedEvent) {
+	atomic.AddInt64(&b.bytes, int64(len(event.data)))
+	atomic.AddInt64(&b.events, 1)
+}
+
+func (b *eventBudget) remove(event *queuedEvent) {
+	atomic.AddInt64(&b.bytes, -int64(len(event.data)))
+	atomic.AddInt64(&b.events, -1)
+}
+
+func (b *eventBudget) exceeded(maxBytes int64) bool {
+	return maxBytes > 0 && atomic.LoadInt64(&b.bytes) > maxBytes
+}
+
+func (b *eventBudget) addListener(listener *EventListener) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.listeners[listener] = true
+}
+
+func (b *eventBudget) removeListener(listener *EventListener) {
+	b.lock.Lock()
+	delete(b.listeners, listener)
+	b.lock.Unlock()
+	listener.clear()
+}
+
+func (b *eventBudget) getListeners() []*EventListener {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	listeners := make([]*EventListener, 0, len(b.listeners))
+	for listener := range b.listeners {
+		listeners = append(listeners, listener)
+	}
+	return listeners
+}
+
+// compact drop the queued events by their kinds until the budget is not exceeded
+func (b *eventBudget) compact() {
+	if !b.exceeded(atomic.LoadInt64(&b.maxBytes)) {
+		return
+	}
+	b.compactLock.Lock()
+	defer b.compactLock.Unlock()
+
+	maxBytes := atomic.LoadInt64(&b.maxBytes)
+	listeners := b.getListeners()
+	for kind := 0; kind < eventKinds && b.exceeded(maxBytes); kind++ {
+		dropped := 0
+		for _, listener := range listeners {
+			dropped += listener.dropEvents(kind, maxBytes)
+			if !b.exceeded(maxBytes) {
+				break
+			}
+		}
+		if dropped > 0 {
+			atomic.AddUint64(&b.dropped[kind], uint64(dropped))
+			log.WithFields(log.Fields{"dropped": dropped, "kind": eventKindNames[kind], "maxBytes": maxBytes}).Warn("the queued events exceed the memory budget, drop the oldest events")
+		}
+	}
+}
+
+// dropEvents drop the oldest queued events of the kind until the budget is
+// not exceeded, the first event is kept because it may be sent to the listener
+func (el *EventListener) dropEvents(kind int, maxBytes int64) int {
+	el.cond.L.Lock()
+	defer el.cond.L.Unlock()
+
+	dropped := 0
+	front := el.events.Front()
+	if front == nil {
+		return 0
+	}
+	for elem := front.Next(); elem != nil && budget.exceeded(maxBytes); {
+		next := elem.Next()
+		if event := elem.Value.(*queuedEvent); event.kind == kind {
+			el.events.Remove(elem)
+			budget.remove(event)
+			dropped++
+		}
+		elem = next
+	}
+	return dropped
+}
+
+// clear remove all the queued events of the listener
+func (el *EventListener) clear() {
+	el.cond.L.Lock()
+	defer el.cond.L.Unlock()
+
+	for el.events.Len() > 0 {
+		budget.remove(el.events.Remove(el.events.Front()).(*queuedEvent))
+	}
+}
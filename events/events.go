@@ -50,6 +50,7 @@ func (be *BaseEvent) GetType() string {
 
 // EventListenerManager manage the event listeners
 type EventListenerManager struct {
+	lock sync.RWMutex
 	//mapping between the event listener name and the listener
 	namedListeners map[string]*EventListener
 	//mapping between the event name and the event listeners
@@ -79,7 +80,7 @@ func (eps *EventPoolSerial) nextSerial(pool string) uint64 {
 	return r
 }
 
-// EventListener the event listener object
+// EventListener the event listener object, one process of an event listener pool
 type EventListener struct {
 	pool       string
 	server     string
@@ -88,21 +89,27 @@ type EventListener struct {
 	stdin      *bufio.Reader
 	stdout     io.Writer
 	bufferSize int
+	// the times an event failed by the listeners is dispatched again before it is rejected
+	maxRetries int
 }
 
-// NewEventListener create a NewEventListener object
+// NewEventListener create a NewEventListener object. The events are dispatched
+// to one listener of the pool, an event failed by a listener is dispatched to
+// another listener of the pool at most maxRetries times
 func NewEventListener(pool string,
 	server string,
 	stdin io.Reader,
 	stdout io.Writer,
-	bufferSize int) *EventListener {
+	bufferSize int,
+	maxRetries int) *EventListener {
 	evtListener := &EventListener{pool: pool,
 		server:     server,
 		cond:       sync.NewCond(new(sync.Mutex)),
 		events:     list.New(),
 		stdin:      bufio.NewReader(stdin),
 		stdout:     stdout,
-		bufferSize: bufferSize}
+		bufferSize: bufferSize,
+		maxRetries: maxRetries}
 	evtListener.start()
 	return evtListener
 }
@@ -118,9 +125,11 @@ func (el *EventListener) getFirstEvent() ([]byte, bool) {
 
 	if el.events.Len() > 0 {
 		elem := el.events.Front()
-		value := elem.Value
-		b, ok := value.([]byte)
-		return b, ok
+		event, ok := elem.Value.(*queuedEvent)
+		if !ok {
+			return nil, false
+		}
+		return event.data, true
 	}
 	return nil, false
 }
@@ -129,7 +138,7 @@ func (el *EventListener) removeFirstEvent() {
 	el.cond.L.Lock()
 	defer el.cond.L.Unlock()
 	if el.events.Len() > 0 {
-		el.events.Remove(el.events.Front())
+		budget.remove(el.events.Remove(el.events.Front()).(*queuedEvent))
 	}
 }
 
@@ -159,7 +168,8 @@ func (el *EventListener) start() {
 						el.removeFirstEvent()
 						break
 					} else if result == "FAIL" {
-						log.WithFields(log.Fields{"eventListener": el.pool}).Warn("fail to send the event")
+						log.WithFields(log.Fields{"eventListener": el.pool}).Warn("the event listener fails to handle the event")
+						el.retryFirstEvent()
 						break
 					} else {
 						log.WithFields(log.Fields{"eventListener": el.pool, "result": result}).Warn("unknown result from listener")
@@ -216,15 +226,54 @@ func (el *EventListener) readResult() (string, error) {
 
 // HandleEvent handle the emitted event
 func (el *EventListener) HandleEvent(event Event) {
-	encodedEvent := el.encodeEvent(event)
+	el.enqueue(&queuedEvent{data: el.encodeEvent(event), kind: getEventKind(event.GetType()), eventType: event.GetType()})
+}
+
+// add the event at the end of the queue if the queue is not full
+func (el *EventListener) enqueue(event *queuedEvent) {
 	el.cond.L.Lock()
-	defer el.cond.L.Unlock()
 	if el.events.Len() <= el.bufferSize {
-		el.events.PushBack(encodedEvent)
+		el.events.PushBack(event)
+		budget.add(event)
 		el.cond.Signal()
 	} else {
 		log.WithFields(log.Fields{"eventListener": el.pool}).Error("events reaches the bufferSize, discard the events")
 	}
+	el.cond.L.Unlock()
+	// the listener is unlocked because the compaction locks the listeners one by one
+	budget.compact()
+}
+
+// the number of the queued events
+func (el *EventListener) queueLen() int {
+	el.cond.L.Lock()
+	defer el.cond.L.Unlock()
+	return el.events.Len()
+}
+
+// retryFirstEvent dispatch the event failed by the listener to another
+// listener of the pool (or to this one if it is alone), the event is rejected
+// with an EVENT_REJECTED event after maxRetries retries
+func (el *EventListener) retryFirstEvent() {
+	el.cond.L.Lock()
+	if el.events.Len() == 0 {
+		el.cond.L.Unlock()
+		return
+	}
+	event := el.events.Remove(el.events.Front()).(*queuedEvent)
+	budget.remove(event)
+	el.cond.L.Unlock()
+
+	event.retries++
+	if event.retries <= el.maxRetries {
+		eventListenerManager.nextPoolMember(el, event.eventType).enqueue(event)
+		return
+	}
+	log.WithFields(log.Fields{"eventListener": el.pool, "event": event.eventType, "retries": el.maxRetries}).Error("the event is rejected by the event listeners")
+	// the rejection of a rejected event is not notified to not loop
+	if event.eventType != "EVENT_REJECTED" {
+		EmitEvent(createEventRejectedEvent(el.pool, event.eventType, el.maxRetries, event.data))
+	}
 }
 
 func (el *EventListener) encodeEvent(event Event) []byte {
@@ -266,7 +315,11 @@ var eventTypeDerives = map[string][]string{
 	"TICK_60":                          {"EVENT", "TICK"},
 	"TICK_3600":                        {"EVENT", "TICK"},
 	"PROCESS_GROUP_ADDED":              {"EVENT", "PROCESS_GROUP"},
-	"PROCESS_GROUP_REMOVED":            {"EVENT", "PROCESS_GROUP"}}
+	"PROCESS_GROUP_REMOVED":            {"EVENT", "PROCESS_GROUP"},
+	"PROCESS_COREDUMP":                 {"EVENT"},
+	"OPERATOR_ACTION":                  {"EVENT"},
+	"ROLLBACK":                         {"EVENT"},
+	"EVENT_REJECTED":                   {"EVENT"}}
 var eventSerial uint64
 var eventListenerManager = NewEventListenerManager()
 var eventPoolSerial = NewEventPoolSerial()
@@ -313,23 +366,12 @@ func NewEventListenerManager() *EventListenerManager {
 func (em *EventListenerManager) registerEventListener(eventListenerName string,
 	events []string,
 	listener *EventListener) {
+	em.lock.Lock()
+	defer em.lock.Unlock()
 
 	em.namedListeners[eventListenerName] = listener
-	allEvents := make(map[string]bool)
-	for _, event := range events {
-		for k, values := range eventTypeDerives {
-			if event == k { //if it is a final event
-				allEvents[k] = true
-			} else { //if it is an abstract event, add all its derived events
-				for _, val := range values {
-					if val == event {
-						allEvents[k] = true
-					}
-				}
-			}
-		}
-	}
-	for event := range allEvents {
+	budget.addListener(listener)
+	for _, event := range NewEventMatcher(events).EventTypes() {
 		log.WithFields(log.Fields{"eventListener": eventListenerName, "event": event}).Info("register event listener")
 		if _, ok := em.eventListeners[event]; !ok {
 			em.eventListeners[event] = make(map[*EventListener]bool)
@@ -346,9 +388,12 @@ func RegisterEventListener(eventListenerName string,
 }
 
 func (em *EventListenerManager) unregisterEventListener(eventListenerName string) *EventListener {
+	em.lock.Lock()
+	defer em.lock.Unlock()
 	listener, ok := em.namedListeners[eventListenerName]
 	if ok {
 		delete(em.namedListeners, eventListenerName)
+		budget.removeListener(listener)
 		for event, listeners := range em.eventListeners {
 			if _, ok = listeners[listener]; ok {
 				log.WithFields(log.Fields{"eventListener": eventListenerName, "event": event}).Info("unregister event listener")
@@ -366,16 +411,44 @@ func UnregisterEventListener(eventListenerName string) *EventListener {
 	return eventListenerManager.unregisterEventListener(eventListenerName)
 }
 
-// EmitEvent emit an event to all the listeners managed by this manager
+// EmitEvent emit an event to the pools of listeners managed by this manager,
+// the event is sent to the listener with the fewest queued events of each pool
 func (em *EventListenerManager) EmitEvent(event Event) {
-	listeners, ok := em.eventListeners[event.GetType()]
-	if ok {
+	em.lock.RLock()
+	pools := make(map[string]*EventListener)
+	queueLens := make(map[*EventListener]int)
+	for listener := range em.eventListeners[event.GetType()] {
+		queueLens[listener] = listener.queueLen()
+		if selected, ok := pools[listener.pool]; !ok || queueLens[listener] < queueLens[selected] {
+			pools[listener.pool] = listener
+		}
+	}
+	em.lock.RUnlock()
+
+	if len(pools) > 0 {
 		log.WithFields(log.Fields{"event": event.GetType()}).Info("process event")
-		for listener := range listeners {
-			log.WithFields(log.Fields{"eventListener": listener.pool, "event": event.GetType()}).Info("receive event on listener")
-			listener.HandleEvent(event)
+	}
+	for _, listener := range pools {
+		log.WithFields(log.Fields{"eventListener": listener.pool, "event": event.GetType()}).Info("receive event on listener")
+		listener.HandleEvent(event)
+	}
+}
+
+// nextPoolMember get the listener with the fewest queued events among the
+// other listeners of the pool subscribing the event, or the listener itself
+func (em *EventListenerManager) nextPoolMember(listener *EventListener, eventType string) *EventListener {
+	em.lock.RLock()
+	defer em.lock.RUnlock()
+	next, nextLen := listener, -1
+	for member := range em.eventListeners[eventType] {
+		if member == listener || member.pool != listener.pool {
+			continue
+		}
+		if n := member.queueLen(); nextLen < 0 || n < nextLen {
+			next, nextLen = member, n
 		}
 	}
+	return next
 }
 
 // RemoteCommunicationEvent remote communication event definition
@@ -428,6 +501,7 @@ func (p *ProcCommEvent) GetBody() string {
 // EmitEvent emit an event to default event listener manager
 func EmitEvent(event Event) {
 	eventListenerManager.EmitEvent(event)
+	eventSubscribers.emitEvent(event)
 }
 
 // TickEvent the tick event definition
@@ -556,6 +630,13 @@ type ProcessStateEvent struct {
 	tries       int
 	expected    int
 	pid         int
+	data        string
+}
+
+// SetData attach the data, for example the last output of the process, to the event.
+// The data is appended to the event body after the header line
+func (pse *ProcessStateEvent) SetData(data string) {
+	pse.data = data
 }
 
 // CreateProcessStartingEvent create a process starting event
@@ -699,9 +780,86 @@ func (pse *ProcessStateEvent) GetBody() string {
 	if pse.pid != 0 {
 		body = fmt.Sprintf("%s pid:%d", body, pse.pid)
 	}
+	if pse.data != "" {
+		body = fmt.Sprintf("%s\n%s", body, pse.data)
+	}
 	return body
 }
 
+// ProcessCoreDumpEvent the event emitted when a process dumps core
+type ProcessCoreDumpEvent struct {
+	BaseEvent
+	processName string
+	groupName   string
+	pid         int
+	core        string
+}
+
+// CreateProcessCoreDumpEvent create a process core dump event, the core is
+// the location of the core file or the handler the core is piped to
+func CreateProcessCoreDumpEvent(processName string,
+	groupName string,
+	pid int,
+	core string) *ProcessCoreDumpEvent {
+	r := &ProcessCoreDumpEvent{processName: processName,
+		groupName: groupName,
+		pid:       pid,
+		core:      core}
+	r.eventType = "PROCESS_COREDUMP"
+	r.serial = nextEventSerial()
+	return r
+}
+
+// GetBody get the body of process core dump event
+func (pe *ProcessCoreDumpEvent) GetBody() string {
+	return fmt.Sprintf("processname:%s groupname:%s pid:%d core:%s", pe.processName, pe.groupName, pe.pid, pe.core)
+}
+
+// OperatorActionEvent the event emitted when a user shuts supervisord down or
+// stops several programs, with the reason given by the user
+type OperatorActionEvent struct {
+	BaseEvent
+	action   string
+	user     string
+	programs []string
+	reason   string
+}
+
+// CreateOperatorActionEvent create an operator action event
+func CreateOperatorActionEvent(action string, user string, programs []string, reason string) *OperatorActionEvent {
+	r := &OperatorActionEvent{action: action, user: user, programs: programs, reason: reason}
+	r.eventType = "OPERATOR_ACTION"
+	r.serial = nextEventSerial()
+	return r
+}
+
+// GetBody get the body of operator action event, the reason follows the header line
+func (oe *OperatorActionEvent) GetBody() string {
+	return fmt.Sprintf("action:%s user:%s programs:%s\n%s", oe.action, oe.user, strings.Join(oe.programs, ","), oe.reason)
+}
+
+// RollbackEvent the event emitted when the section of a program changed by a
+// reload is restored because the program went FATAL after the reload
+type RollbackEvent struct {
+	BaseEvent
+	processName string
+	groupName   string
+	file        string
+}
+
+// CreateRollbackEvent create a rollback event
+func CreateRollbackEvent(processName string, groupName string, file string) *RollbackEvent {
+	r := &RollbackEvent{processName: processName, groupName: groupName, file: file}
+	r.eventType = "ROLLBACK"
+	r.serial = nextEventSerial()
+	return r
+}
+
+// GetBody get the body of rollback event
+func (re *RollbackEvent) GetBody() string {
+	return fmt.Sprintf("processname:%s groupname:%s file:%s", re.processName, re.groupName, re.file)
+}
+
 // SupervisorStateChangeEvent supervisor state change event
 type SupervisorStateChangeEvent struct {
 	BaseEvent
@@ -773,6 +931,28 @@ func CreateProcessLogStderrEvent(processName string,
 	return r
 }
 
+// EventRejectedEvent the event rejected by all the retries of an event listener pool
+type EventRejectedEvent struct {
+	BaseEvent
+	pool      string
+	eventName string
+	retries   int
+	payload   []byte
+}
+
+// GetBody get the body of the event rejected event, the header line is
+// followed by the header and the body of the rejected event
+func (re *EventRejectedEvent) GetBody() string {
+	return fmt.Sprintf("pool:%s eventname:%s retries:%d\n%s", re.pool, re.eventName, re.retries, re.payload)
+}
+
+func createEventRejectedEvent(pool string, eventName string, retries int, payload []byte) *EventRejectedEvent {
+	r := &EventRejectedEvent{pool: pool, eventName: eventName, retries: retries, payload: payload}
+	r.eventType = "EVENT_REJECTED"
+	r.serial = nextEventSerial()
+	return r
+}
+
 // ProcessGroupEvent the process group event definition
 type ProcessGroupEvent struct {
 	BaseEvent
@@ -57,7 +57,8 @@ func TestEventListener(t *testing.T) {
 		"supervisor",
 		r2,
 		w1,
-		10)
+		10,
+		3)
 	eventListenerManager.registerEventListener("pool-1",
 		[]string{"REMOTE_COMMUNICATION"},
 		listener)
@@ -84,6 +85,103 @@ func TestEventListener(t *testing.T) {
 	eventListenerManager.unregisterEventListener("pool-1")
 }
 
+func TestEventListenerPoolRetry(t *testing.T) {
+	rejected := make(chan Event, 1)
+	Subscribe("test-rejected", []string{"EVENT_REJECTED"}, func(event Event) {
+		rejected <- event
+	})
+	defer Unsubscribe("test-rejected")
+
+	type poolMember struct {
+		listener *EventListener
+		events   *bufio.Reader
+		results  io.Writer
+	}
+	members := make([]poolMember, 2)
+	for i := range members {
+		r1, w1 := io.Pipe()
+		r2, w2 := io.Pipe()
+		defer w1.Close()
+		defer w2.Close()
+		name := fmt.Sprintf("pool-retry-%d", i)
+		members[i] = poolMember{NewEventListener("pool-retry", "supervisor", r2, w1, 10, 1), bufio.NewReader(r1), w2}
+		eventListenerManager.registerEventListener(name, []string{"REMOTE_COMMUNICATION"}, members[i].listener)
+		defer eventListenerManager.unregisterEventListener(name)
+	}
+	EmitEvent(NewRemoteCommunicationEvent("type-1", "retry"))
+	first, second := members[0], members[1]
+	if second.listener.queueLen() == 1 {
+		first, second = second, first
+	}
+	if first.listener.queueLen() != 1 || second.listener.queueLen() != 0 {
+		t.Fatal("fail to dispatch the event to one listener of the pool")
+	}
+	// the event failed by the first listener is dispatched to the second one
+	for _, member := range []poolMember{first, second} {
+		member.results.Write([]byte("READY\n"))
+		if _, body := readEvent(member.events); body != "type:type-1\nretry" {
+			t.Errorf("fail to dispatch the event, get %s", body)
+		}
+		member.results.Write([]byte("RESULT 4\nFAIL"))
+	}
+	select {
+	case event := <-rejected:
+		if !strings.HasPrefix(event.GetBody(), "pool:pool-retry eventname:REMOTE_COMMUNICATION retries:1\nver:3.0") {
+			t.Errorf("fail to notify the rejected event: %s", event.GetBody())
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("fail to reject the event after the retries")
+	}
+}
+
+func TestEventMemoryBudget(t *testing.T) {
+	r1, w1 := io.Pipe()
+	r2, _ := io.Pipe()
+	defer r1.Close()
+	defer r2.Close()
+
+	// the listener is not ready, all the events are queued
+	listener := NewEventListener("pool-budget", "supervisor", r2, w1, 1000, 3)
+	eventListenerManager.registerEventListener("pool-budget", []string{"PROCESS_STATE", "PROCESS_LOG", "TICK"}, listener)
+	defer eventListenerManager.unregisterEventListener("pool-budget")
+	defer SetMemoryBudget(0)
+
+	before := GetMemoryUsage()
+	EmitEvent(CreateProcessStartingEvent("prog-1", "prog-1", "STOPPED", 0))
+	for i := 0; i < 50; i++ {
+		EmitEvent(CreateProcessLogStdoutEvent("prog-1", "prog-1", 100, strings.Repeat("x", 100)))
+		EmitEvent(NewTickEvent("TICK_5", time.Now().Unix()))
+	}
+	EmitEvent(CreateProcessRunningEvent("prog-1", "prog-1", "STARTING", 100))
+	usage := GetMemoryUsage()
+	if usage.QueuedEvents-before.QueuedEvents != 102 {
+		t.Errorf("fail to count the queued events: %d", usage.QueuedEvents-before.QueuedEvents)
+	}
+
+	SetMemoryBudget(1024)
+	usage = GetMemoryUsage()
+	if usage.QueuedBytes > 1024 {
+		t.Errorf("the queued events exceed the memory budget: %d", usage.QueuedBytes)
+	}
+	if usage.DroppedLogEvents-before.DroppedLogEvents != 50 || usage.DroppedStateEvents != before.DroppedStateEvents {
+		t.Error("fail to drop the log events first")
+	}
+	listener.cond.L.Lock()
+	kinds := make([]int, 0)
+	for elem := listener.events.Front(); elem != nil; elem = elem.Next() {
+		kinds = append(kinds, elem.Value.(*queuedEvent).kind)
+	}
+	listener.cond.L.Unlock()
+	if len(kinds) < 2 || kinds[0] != stateEvents || kinds[len(kinds)-1] != stateEvents {
+		t.Errorf("fail to keep the state transitions: %v", kinds)
+	}
+
+	eventListenerManager.unregisterEventListener("pool-budget")
+	if GetMemoryUsage().QueuedEvents != before.QueuedEvents {
+		t.Error("fail to release the events of the unregistered listener")
+	}
+}
+
 func TestProcCommEventCapture(t *testing.T) {
 	r1, w1 := io.Pipe()
 	r2, w2 := io.Pipe()
@@ -100,7 +198,8 @@ func TestProcCommEventCapture(t *testing.T) {
 		"supervisor",
 		r2,
 		w1,
-		10)
+		10,
+		3)
 	eventListenerManager.registerEventListener("pool-1",
 		[]string{"PROCESS_COMMUNICATION"},
 		listener)
@@ -201,3 +300,23 @@ func TestProcessUnknownEvent(t *testing.T) {
 		t.Error("Fail to encode the process unknown event")
 	}
 }
+
+func TestOperatorActionEvent(t *testing.T) {
+	event := CreateOperatorActionEvent("stop", "alice", []string{"web", "db"}, "rolling back the release")
+	if event.GetType() != "OPERATOR_ACTION" {
+		t.Error("Fail to creating the operator action event")
+	}
+	if event.GetBody() != "action:stop user:alice programs:web,db\nrolling back the release" {
+		t.Error("Fail to encode the operator action event")
+	}
+}
+
+func TestRollbackEvent(t *testing.T) {
+	event := CreateRollbackEvent("web", "servers", "/etc/supervisor/conf.d/web.conf")
+	if event.GetType() != "ROLLBACK" {
+		t.Error("Fail to creating the rollback event")
+	}
+	if event.GetBody() != "processname:web groupname:servers file:/etc/supervisor/conf.d/web.conf" {
+		t.Error("Fail to encode the rollback event")
+	}
+}
@@ -0,0 +1,190 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// JournalEntry an event persisted in the journal, the sequence keeps growing
+// across the restarts of supervisord unlike the serial of the events
+type JournalEntry struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	Body string    `json:"body"`
+}
+
+// Journal an append-only file of the events, one JSON entry per line. When
+// the file is bigger than its maximum size the oldest entries are dropped to
+// keep the newest half
+type Journal struct {
+	lock     sync.Mutex
+	fileName string
+	maxBytes int64
+	file     *os.File
+	size     int64
+	seq      uint64
+}
+
+// OpenJournal open the journal file, created if it doesn't exist, and find
+// the last sequence of its entries
+func OpenJournal(fileName string, maxBytes int64) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return nil, err
+	}
+	j := &Journal{fileName: fileName, maxBytes: maxBytes}
+	entries, err := j.read()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		j.seq = entries[len(entries)-1].Seq
+	}
+	if err = j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// open the file to append the entries
+func (j *Journal) open() error {
+	f, err := os.OpenFile(j.fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	j.file, j.size = f, fileInfo.Size()
+	return nil
+}
+
+// read all the entries of the file, the partial or invalid lines (left by a
+// crash in a write) are skipped
+func (j *Journal) read() ([]JournalEntry, error) {
+	b, err := ioutil.ReadFile(j.fileName)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	entries := make([]JournalEntry, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		entry := JournalEntry{}
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.Seq > 0 {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Append write the event to the journal and sync it to the disk before
+// returning, the journal is truncated if it is too big
+func (j *Journal) Append(event Event) (JournalEntry, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	entry := JournalEntry{Seq: j.seq + 1, Time: time.Now(), Type: event.GetType(), Body: event.GetBody()}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+	b = append(b, '\n')
+	if _, err = j.file.Write(b); err != nil {
+		return entry, err
+	}
+	if err = j.file.Sync(); err != nil {
+		return entry, err
+	}
+	j.seq = entry.Seq
+	j.size += int64(len(b))
+	if j.maxBytes > 0 && j.size > j.maxBytes {
+		if err = j.truncate(); err != nil {
+			log.WithFields(log.Fields{"file": j.fileName, log.ErrorKey: err}).Error("fail to truncate the event journal")
+		}
+	}
+	return entry, nil
+}
+
+// drop the oldest entries to keep at most half of the maximum size, the
+// file is replaced atomically. Must be called with the lock hold
+func (j *Journal) truncate() error {
+	entries, err := j.read()
+	if err != nil {
+		return err
+	}
+	lines := make([][]byte, 0, len(entries))
+	size := int64(0)
+	for i := len(entries) - 1; i >= 0; i-- {
+		b, _ := json.Marshal(entries[i])
+		// the last entry is kept for its sequence
+		if len(lines) > 0 && size+int64(len(b))+1 > j.maxBytes/2 {
+			break
+		}
+		lines = append(lines, append(b, '\n'))
+		size += int64(len(b)) + 1
+	}
+	content := make([]byte, 0, size)
+	for i := len(lines) - 1; i >= 0; i-- {
+		content = append(content, lines[i]...)
+	}
+	tmpFile := j.fileName + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, content, 0600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpFile, j.fileName); err != nil {
+		return err
+	}
+	j.file.Close()
+	return j.open()
+}
+
+// Since get at most limit (all if limit <= 0) entries after the sequence
+// afterSeq and not before the time since (if not zero), the oldest first
+func (j *Journal) Since(afterSeq uint64, since time.Time, limit int) ([]JournalEntry, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	entries, err := j.read()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]JournalEntry, 0)
+	for _, entry := range entries {
+		if entry.Seq <= afterSeq || (!since.IsZero() && entry.Time.Before(since)) {
+			continue
+		}
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// LastSeq get the sequence of the last entry, 0 if the journal is empty
+func (j *Journal) LastSeq() uint64 {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.seq
+}
+
+// GetFileName get the file of the journal
+func (j *Journal) GetFileName() string {
+	return j.fileName
+}
+
+// Close close the file of the journal
+func (j *Journal) Close() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.file.Close()
+}
@@ -0,0 +1,80 @@
+package events
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "events", "journal.log")
+	journal, err := OpenJournal(fileName, 0)
+	if err != nil {
+		t.Fatalf("fail to open the journal: %v", err)
+	}
+	for _, name := range []string{"web", "db", "api"} {
+		if _, err = journal.Append(CreateProcessRunningEvent(name, name, "STARTING", 100)); err != nil {
+			t.Fatalf("fail to append the event: %v", err)
+		}
+	}
+	start := time.Now()
+	journal.Append(CreateProcessStoppedEvent("web", "web", "STOPPING", 100))
+	journal.Close()
+
+	// the sequence continues after a restart and the partial line is skipped
+	f, _ := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString(`{"seq":5,"ty`)
+	f.Close()
+	if journal, err = OpenJournal(fileName, 0); err != nil {
+		t.Fatalf("fail to open the journal again: %v", err)
+	}
+	defer journal.Close()
+	if journal.LastSeq() != 4 {
+		t.Errorf("fail to find the last sequence: %d", journal.LastSeq())
+	}
+	entries, _ := journal.Since(1, time.Time{}, 2)
+	if len(entries) != 2 || entries[0].Seq != 2 || entries[1].Seq != 3 || !strings.HasPrefix(entries[0].Body, "processname:db ") {
+		t.Errorf("fail to get the entries after a sequence: %v", entries)
+	}
+	entries, _ = journal.Since(0, start, 0)
+	if len(entries) != 1 || entries[0].Type != "PROCESS_STATE_STOPPED" {
+		t.Errorf("fail to get the entries since a time: %v", entries)
+	}
+}
+
+func TestJournalTruncate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "journal.log")
+	journal, err := OpenJournal(fileName, 1024)
+	if err != nil {
+		t.Fatalf("fail to open the journal: %v", err)
+	}
+	defer journal.Close()
+	for i := 0; i < 50; i++ {
+		journal.Append(CreateProcessRunningEvent("web", "web", "STARTING", i))
+	}
+	if fileInfo, _ := os.Stat(fileName); fileInfo.Size() > 1024 {
+		t.Errorf("fail to truncate the journal: %d bytes", fileInfo.Size())
+	}
+	entries, _ := journal.Since(0, time.Time{}, 0)
+	if len(entries) == 0 || entries[len(entries)-1].Seq != 50 || entries[0].Seq == 1 {
+		t.Errorf("fail to keep the newest entries: %v", entries)
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Seq != entries[i-1].Seq+1 {
+			t.Errorf("fail to keep the entries in order: %v", entries)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package events
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// EventMatcher match the event types subscribed by a listener or a subscriber:
+// the final events like "PROCESS_STATE_EXITED", the abstract events like
+// "PROCESS_STATE" or "EVENT" and the shell patterns like "PROCESS_STATE_*" or
+// "TICK_*" matching the final events
+type EventMatcher struct {
+	types map[string]bool
+}
+
+// NewEventMatcher create an EventMatcher of the events, the events matching no
+// event type are ignored with a warning
+func NewEventMatcher(events []string) *EventMatcher {
+	m := &EventMatcher{types: make(map[string]bool)}
+	for _, event := range events {
+		event = strings.TrimSpace(event)
+		if event == "" {
+			continue
+		}
+		matched := false
+		for k, values := range eventTypeDerives {
+			if matchEventType(event, k, values) {
+				m.types[k] = true
+				matched = true
+			}
+		}
+		if !matched {
+			log.WithFields(log.Fields{"event": event}).Warn("ignore the event which matches no event type")
+		}
+	}
+	return m
+}
+
+// check if the subscribed event matches the final event type or one of its abstract types
+func matchEventType(event string, eventType string, abstractTypes []string) bool {
+	if strings.ContainsAny(event, "*?[") {
+		matched, _ := path.Match(event, eventType)
+		return matched
+	}
+	if event == eventType {
+		return true
+	}
+	for _, abstractType := range abstractTypes {
+		if event == abstractType {
+			return true
+		}
+	}
+	return false
+}
+
+// Match check if the final event type is subscribed
+func (m *EventMatcher) Match(eventType string) bool {
+	return m.types[eventType]
+}
+
+// EventTypes get the subscribed final event types
+func (m *EventMatcher) EventTypes() []string {
+	result := make([]string, 0, len(m.types))
+	for eventType := range m.types {
+		result = append(result, eventType)
+	}
+	sort.Strings(result)
+	return result
+}
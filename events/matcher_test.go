@@ -0,0 +1,44 @@
+package events
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEventMatcher(t *testing.T) {
+	m := NewEventMatcher([]string{"PROCESS_STATE_*", " TICK_60", "PROCESS_LOG", "UNKNOWN_*", ""})
+	for _, eventType := range []string{"PROCESS_STATE_EXITED", "PROCESS_STATE_STARTING", "TICK_60", "PROCESS_LOG_STDERR"} {
+		if !m.Match(eventType) {
+			t.Errorf("fail to match the event %s", eventType)
+		}
+	}
+	for _, eventType := range []string{"TICK_5", "PROCESS_GROUP_ADDED", "PROCESS_STATE"} {
+		if m.Match(eventType) {
+			t.Errorf("fail to reject the event %s", eventType)
+		}
+	}
+	if types := m.EventTypes(); len(types) != 11 || types[0] != "PROCESS_LOG_STDERR" {
+		t.Errorf("fail to get the matched event types: %v", types)
+	}
+	if types := NewEventMatcher([]string{"*_STDERR"}).EventTypes(); strings.Join(types, ",") != "PROCESS_COMMUNICATION_STDERR,PROCESS_LOG_STDERR" {
+		t.Errorf("fail to match the events with a pattern: %v", types)
+	}
+	if !NewEventMatcher([]string{"EVENT"}).Match("PROCESS_COREDUMP") {
+		t.Error("fail to match all the events with EVENT")
+	}
+}
+
+func TestSubscribePattern(t *testing.T) {
+	received := make([]string, 0)
+	Subscribe("test", []string{"PROCESS_STATE_F*", "TICK_5"}, func(event Event) {
+		received = append(received, event.GetType())
+	})
+	defer Unsubscribe("test")
+	EmitEvent(CreateProcessStartingEvent("proc1", "group1", "STOPPED", 0))
+	EmitEvent(CreateProcessFatalEvent("proc1", "group1", "BACKOFF"))
+	EmitEvent(NewTickEvent("TICK_5", 0))
+
+	if strings.Join(received, ",") != "PROCESS_STATE_FATAL,TICK_5" {
+		t.Errorf("fail to receive the events matching the patterns: %v", received)
+	}
+}
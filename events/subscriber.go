@@ -0,0 +1,67 @@
+package events
+
+import (
+	"sync"
+)
+
+// EventHandler the in-process handler of the events. It is called in the
+// goroutine emitting the event, so it must return quickly and must not block
+type EventHandler func(event Event)
+
+// eventSubscriberManager manage the in-process event subscribers
+type eventSubscriberManager struct {
+	lock sync.RWMutex
+	//mapping between the subscriber name and its event types
+	namedSubscribers map[string]map[string]bool
+	//mapping between the event type and the handlers
+	handlers map[string]map[string]EventHandler
+}
+
+var eventSubscribers = &eventSubscriberManager{namedSubscribers: make(map[string]map[string]bool),
+	handlers: make(map[string]map[string]EventHandler)}
+
+// Subscribe subscribe the events in process with a unique name. The events can be final
+// events like "PROCESS_STATE_EXITED", abstract events like "PROCESS_STATE" or "EVENT"
+// or patterns like "PROCESS_STATE_*". The previous subscription with same name is replaced
+func Subscribe(name string, events []string, handler EventHandler) {
+	eventSubscribers.lock.Lock()
+	defer eventSubscribers.lock.Unlock()
+
+	eventSubscribers.unsubscribe(name)
+	allEvents := NewEventMatcher(events).types
+	eventSubscribers.namedSubscribers[name] = allEvents
+	for event := range allEvents {
+		if _, ok := eventSubscribers.handlers[event]; !ok {
+			eventSubscribers.handlers[event] = make(map[string]EventHandler)
+		}
+		eventSubscribers.handlers[event][name] = handler
+	}
+}
+
+// Unsubscribe remove the subscription by its name
+func Unsubscribe(name string) {
+	eventSubscribers.lock.Lock()
+	defer eventSubscribers.lock.Unlock()
+
+	eventSubscribers.unsubscribe(name)
+}
+
+func (esm *eventSubscriberManager) unsubscribe(name string) {
+	for event := range esm.namedSubscribers[name] {
+		delete(esm.handlers[event], name)
+	}
+	delete(esm.namedSubscribers, name)
+}
+
+func (esm *eventSubscriberManager) emitEvent(event Event) {
+	esm.lock.RLock()
+	handlers := make([]EventHandler, 0, len(esm.handlers[event.GetType()]))
+	for _, handler := range esm.handlers[event.GetType()] {
+		handlers = append(handlers, handler)
+	}
+	esm.lock.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,20 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestSubscribe(t *testing.T) {
+	received := make([]string, 0)
+	Subscribe("test", []string{"PROCESS_STATE"}, func(event Event) {
+		received = append(received, event.GetType())
+	})
+	EmitEvent(CreateProcessStartingEvent("proc1", "group1", "STOPPED", 0))
+	EmitEvent(NewTickEvent("TICK_5", 0))
+	Unsubscribe("test")
+	EmitEvent(CreateProcessFatalEvent("proc1", "group1", "BACKOFF"))
+
+	if len(received) != 1 || received[0] != "PROCESS_STATE_STARTING" {
+		t.Error("fail to receive the subscribed events")
+	}
+}
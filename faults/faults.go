@@ -56,6 +56,18 @@ const (
 
 	// CantReRead can't re-read result code
 	CantReRead = 92
+
+	// Busy another conflicting operation is running result code
+	Busy = 93
+
+	// NotAuthorized the user is not allowed to control the program result code
+	NotAuthorized = 94
+
+	// Conflict a conflicting program is running result code
+	Conflict = 95
+
+	// Locked the program is locked and can only be stopped with force result code
+	Locked = 96
 )
 
 // NewFault create a Fault object as xml rpc result
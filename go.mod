@@ -4,7 +4,9 @@ require (
 	github.com/GeertJohan/go.rice v1.0.0
 	github.com/gorilla/mux v1.7.3
 	github.com/gorilla/rpc v1.2.0
+	github.com/graphql-go/graphql v0.8.0
 	github.com/jessevdk/go-flags v1.4.0
+	github.com/kardianos/service v1.2.0
 	github.com/ochinchina/filechangemonitor v0.3.1
 	github.com/ochinchina/go-daemon v0.1.5
 	github.com/ochinchina/go-ini v1.0.1
@@ -14,7 +16,13 @@ require (
 	github.com/robfig/cron/v3 v3.0.1
 	github.com/rogpeppe/go-charset v0.0.0-20190617161244-0dc95cdf6f31 // indirect
 	github.com/sirupsen/logrus v1.4.2
-	golang.org/x/net v0.0.0-20180921000356-2f5d2388922f
+	github.com/tetratelabs/wazero v1.2.1
+	github.com/yuin/gopher-lua v0.0.0-20200816102855-ee81675732da
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
+	golang.org/x/net v0.0.0-20190404232315-eb5bcb51f2a3
+	golang.org/x/sys v0.0.0-20201015000850-e3ed0017c211
+	golang.org/x/term v0.0.0-20201117132131-f5c789dd3221
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 replace github.com/ochinchina/supervisord => ./
@@ -0,0 +1,500 @@
+// +build !nohttp
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	gqlparser "github.com/graphql-go/graphql/language/parser"
+	"github.com/ochinchina/supervisord/events"
+	"github.com/ochinchina/supervisord/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// the max number of state changes waiting to be sent to a subscriber
+const graphQLEventBufferSize = 100
+
+// the serial used to create the unique names of the event subscriptions
+var graphQLSubscriptionSerial uint64
+
+type graphQLRequestKey struct{}
+
+// SupervisorGraphQL the GraphQL interface to query and control the programs
+type SupervisorGraphQL struct {
+	supervisor *Supervisor
+	schema     graphql.Schema
+}
+
+// the GraphQL request posted in json or passed in the url query
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// the process state change sent to the subscribers
+type processStateChange struct {
+	Serial    int    `json:"serial"`
+	Name      string `json:"name"`
+	Group     string `json:"group"`
+	Statename string `json:"statename"`
+	FromState string `json:"fromState"`
+	Pid       int    `json:"pid"`
+}
+
+// NewSupervisorGraphQL create a new SupervisorGraphQL object
+func NewSupervisorGraphQL(supervisor *Supervisor) (*SupervisorGraphQL, error) {
+	sg := &SupervisorGraphQL{supervisor: supervisor}
+	schema, err := sg.createSchema()
+	if err != nil {
+		return nil, err
+	}
+	sg.schema = schema
+	return sg, nil
+}
+
+func (sg *SupervisorGraphQL) createSchema() (graphql.Schema, error) {
+	processType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Process",
+		Fields: graphql.Fields{
+			"name":          &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"group":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"description":   &graphql.Field{Type: graphql.String},
+			"start":         &graphql.Field{Type: graphql.Int, Description: "the unix time the process started"},
+			"stop":          &graphql.Field{Type: graphql.Int, Description: "the unix time the process stopped"},
+			"now":           &graphql.Field{Type: graphql.Int},
+			"state":         &graphql.Field{Type: graphql.Int},
+			"statename":     &graphql.Field{Type: graphql.String},
+			"spawnerr":      &graphql.Field{Type: graphql.String},
+			"exitstatus":    &graphql.Field{Type: graphql.Int},
+			"logfile":       &graphql.Field{Type: graphql.String},
+			"stdoutLogfile": &graphql.Field{Type: graphql.String},
+			"stderrLogfile": &graphql.Field{Type: graphql.String},
+			"pid":           &graphql.Field{Type: graphql.Int},
+			"labels":        &graphql.Field{Type: graphql.NewList(graphql.String), Description: "the key=value labels of the program"},
+			"restarts":      &graphql.Field{Type: graphql.Int, Description: "the restarts after a failure"},
+			"failures":      &graphql.Field{Type: graphql.Int, Description: "the unexpected exits"},
+			"uptime":        &graphql.Field{Type: graphql.Int, Description: "the total running seconds"},
+			"currentUptime": &graphql.Field{Type: graphql.Int, Description: "the seconds the running process has been running, from the monotonic clock"},
+			"mtbf":          &graphql.Field{Type: graphql.Int, Description: "the mean running seconds between failures"},
+		},
+	})
+	processFilterArgs := graphql.FieldConfigArgument{
+		"name":  &graphql.ArgumentConfig{Type: graphql.String, Description: "the program name, shell patterns like \"web*\" are supported"},
+		"state": &graphql.ArgumentConfig{Type: graphql.String, Description: "the state name like RUNNING"},
+		"label": &graphql.ArgumentConfig{Type: graphql.String, Description: "the comma separated labels like \"team=web,tier\" the programs must have"},
+	}
+	groupType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Group",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"processes": &graphql.Field{
+				Type: graphql.NewList(processType),
+				Args: processFilterArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return filterProcessInfos(p.Source.(*processGroup).processes, p.Args), nil
+				},
+			},
+		},
+	})
+	queryArgs := graphql.FieldConfigArgument{
+		"group": &graphql.ArgumentConfig{Type: graphql.String},
+	}
+	for name, arg := range processFilterArgs {
+		queryArgs[name] = arg
+	}
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"processes": &graphql.Field{
+				Type: graphql.NewList(processType),
+				Args: queryArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return filterProcessInfos(sg.getAllProcessInfo(p.Context), p.Args), nil
+				},
+			},
+			"process": &graphql.Field{
+				Type: processType,
+				Args: graphql.FieldConfigArgument{"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					reply := struct{ ProcInfo types.ProcessInfo }{}
+					if err := sg.supervisor.GetProcessInfo(graphQLHTTPRequest(p.Context), &struct{ Name string }{p.Args["name"].(string)}, &reply); err != nil {
+						return nil, err
+					}
+					return reply.ProcInfo, nil
+				},
+			},
+			"groups": &graphql.Field{
+				Type: graphql.NewList(groupType),
+				Args: graphql.FieldConfigArgument{"name": &graphql.ArgumentConfig{Type: graphql.String}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					name, _ := p.Args["name"].(string)
+					return groupProcessInfos(sg.getAllProcessInfo(p.Context), name), nil
+				},
+			},
+		},
+	})
+	controlArgs := graphql.FieldConfigArgument{
+		"name":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "the program name or \"group:*\""},
+		"wait":    &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: true},
+		"timeout": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0, Description: "the maximum seconds to wait, 0 for the max_operation_secs"},
+		"force":   &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false, Description: "stop the locked programs"},
+	}
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"startProcess": &graphql.Field{
+				Type: graphql.NewList(processType),
+				Args: controlArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					args := toStartProcessArgs(p.Args)
+					err := sg.supervisor.StartProcess(graphQLHTTPRequest(p.Context), args, &struct{ Success interface{} }{})
+					return sg.getProcessInfos(p.Context, args.Name, err)
+				},
+			},
+			"stopProcess": &graphql.Field{
+				Type: graphql.NewList(processType),
+				Args: controlArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					args := toStartProcessArgs(p.Args)
+					err := sg.supervisor.StopProcess(graphQLHTTPRequest(p.Context), args, &struct{ Success interface{} }{})
+					return sg.getProcessInfos(p.Context, args.Name, err)
+				},
+			},
+			"signalProcess": &graphql.Field{
+				Type: graphql.NewList(processType),
+				Args: graphql.FieldConfigArgument{
+					"name":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "the program name or \"group:*\""},
+					"signal": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "the signal name like HUP or number"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					args := &types.ProcessSignal{Name: p.Args["name"].(string), Signal: p.Args["signal"].(string)}
+					err := sg.supervisor.SignalProcess(graphQLHTTPRequest(p.Context), args, &struct{ Success bool }{})
+					return sg.getProcessInfos(p.Context, args.Name, err)
+				},
+			},
+		},
+	})
+	stateChangeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ProcessStateChange",
+		Fields: graphql.Fields{
+			"serial":    &graphql.Field{Type: graphql.Int},
+			"name":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"group":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"statename": &graphql.Field{Type: graphql.String, Description: "the new state name"},
+			"fromState": &graphql.Field{Type: graphql.String},
+			"pid":       &graphql.Field{Type: graphql.Int},
+			"process": &graphql.Field{
+				Type:        processType,
+				Description: "the current information of the process",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					proc := sg.supervisor.GetManager().Find(p.Source.(*processStateChange).Name)
+					if proc == nil {
+						return nil, nil
+					}
+					return getProcessInfo(proc), nil
+				},
+			},
+		},
+	})
+	subscription := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Subscription",
+		Fields: graphql.Fields{
+			"processStateChanged": &graphql.Field{
+				Type: stateChangeType,
+				Args: graphql.FieldConfigArgument{
+					"name":  &graphql.ArgumentConfig{Type: graphql.String, Description: "the program name, shell patterns like \"web*\" are supported"},
+					"group": &graphql.ArgumentConfig{Type: graphql.String},
+					"events": &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: "PROCESS_STATE",
+						Description: "the comma separated state events like \"PROCESS_STATE_EXITED,PROCESS_STATE_FATAL\", patterns like \"PROCESS_STATE_*\" are supported"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source, nil
+				},
+				Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+					return sg.subscribeStateChanges(p.Context, p.Args), nil
+				},
+			},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation, Subscription: subscription})
+}
+
+// CreateHandler create the http handler of GraphQL requests. The queries and
+// mutations are posted in json, the subscriptions are sent back as server-sent
+// events if the request accepts "text/event-stream"
+func (sg *SupervisorGraphQL) CreateHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		request, err := readGraphQLRequest(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		isSubscription := getOperationType(request) == ast.OperationTypeSubscription
+		isEventStream := strings.Contains(req.Header.Get("Accept"), "text/event-stream")
+		if isSubscription != isEventStream {
+			http.Error(w, "the subscriptions must be requested with \"Accept: text/event-stream\"", http.StatusNotAcceptable)
+			return
+		}
+		// the mutations are not allowed in GET to prevent the cross site requests
+		if req.Method != http.MethodPost && !isSubscription {
+			http.Error(w, "the queries and mutations must be posted", http.StatusMethodNotAllowed)
+			return
+		}
+		params := graphql.Params{Schema: sg.schema,
+			RequestString:  request.Query,
+			VariableValues: request.Variables,
+			OperationName:  request.OperationName,
+			Context:        context.WithValue(req.Context(), graphQLRequestKey{}, req)}
+		if isSubscription {
+			sg.serveSubscription(w, params)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(graphql.Do(params))
+	})
+}
+
+// send the results of subscription as server-sent events until the client is disconnected
+func (sg *SupervisorGraphQL) serveSubscription(w http.ResponseWriter, params graphql.Params) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithCancel(params.Context)
+	defer cancel()
+	params.Context = ctx
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	// read all the results to let the subscription finish after the client is disconnected
+	for result := range graphql.Subscribe(params) {
+		if ctx.Err() != nil {
+			continue
+		}
+		b, err := json.Marshal(result)
+		if err != nil {
+			continue
+		}
+		if _, err = fmt.Fprintf(w, "event: next\ndata: %s\n\n", b); err != nil {
+			cancel()
+			continue
+		}
+		flusher.Flush()
+	}
+	fmt.Fprint(w, "event: complete\ndata:\n\n")
+	flusher.Flush()
+}
+
+// subscribe the process state events until the context is done, only the
+// state changes of the programs the user is allowed to control and matching
+// the events argument are sent
+func (sg *SupervisorGraphQL) subscribeStateChanges(ctx context.Context, args map[string]interface{}) chan interface{} {
+	name, _ := args["name"].(string)
+	group, _ := args["group"].(string)
+	eventTypes, _ := args["events"].(string)
+	matcher := events.NewEventMatcher(splitList(eventTypes))
+	req := graphQLHTTPRequest(ctx)
+	ch := make(chan interface{}, graphQLEventBufferSize)
+	subscriber := fmt.Sprintf("graphql:%d", atomic.AddUint64(&graphQLSubscriptionSerial, 1))
+	events.Subscribe(subscriber, []string{"PROCESS_STATE"}, func(event events.Event) {
+		if !matcher.Match(event.GetType()) {
+			return
+		}
+		change := toProcessStateChange(event)
+		if !matchName(name, change.Name) || (group != "" && group != change.Group) || !sg.supervisor.canAccessProgram(req, change.Name) {
+			return
+		}
+		select {
+		case ch <- change:
+		default:
+			log.WithFields(log.Fields{"subscriber": subscriber, "event": event.GetType()}).Warn("too many events are waiting for the GraphQL subscriber, drop the event")
+		}
+	})
+	go func() {
+		<-ctx.Done()
+		// the channel is not closed since the event may be emitted in parallel
+		events.Unsubscribe(subscriber)
+	}()
+	return ch
+}
+
+// get the process information of the programs after they are started or stopped
+func (sg *SupervisorGraphQL) getProcessInfos(ctx context.Context, name string, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	req := graphQLHTTPRequest(ctx)
+	if _, _, ok := sg.supervisor.splitNodeName(name); ok {
+		reply := struct{ ProcInfo types.ProcessInfo }{}
+		err = sg.supervisor.GetProcessInfo(req, &struct{ Name string }{name}, &reply)
+		return []types.ProcessInfo{reply.ProcInfo}, err
+	}
+	result := make([]types.ProcessInfo, 0)
+	for _, proc := range sg.supervisor.findMatch(name) {
+		result = append(result, *getProcessInfo(proc))
+	}
+	return result, nil
+}
+
+func (sg *SupervisorGraphQL) getAllProcessInfo(ctx context.Context) []types.ProcessInfo {
+	reply := struct{ AllProcessInfo []types.ProcessInfo }{}
+	sg.supervisor.GetAllProcessInfo(graphQLHTTPRequest(ctx), nil, &reply)
+	return reply.AllProcessInfo
+}
+
+// the processes of one group
+type processGroup struct {
+	Name      string
+	processes []types.ProcessInfo
+}
+
+// group the process information by the group names in the order of processes
+func groupProcessInfos(infos []types.ProcessInfo, name string) []*processGroup {
+	result := make([]*processGroup, 0)
+	groups := make(map[string]*processGroup)
+	for _, info := range infos {
+		if name != "" && name != info.Group {
+			continue
+		}
+		group, ok := groups[info.Group]
+		if !ok {
+			group = &processGroup{Name: info.Group}
+			groups[info.Group] = group
+			result = append(result, group)
+		}
+		group.processes = append(group.processes, info)
+	}
+	return result
+}
+
+// filter the process information by the arguments "name", "group" and "state"
+func filterProcessInfos(infos []types.ProcessInfo, args map[string]interface{}) []types.ProcessInfo {
+	name, _ := args["name"].(string)
+	group, _ := args["group"].(string)
+	state, _ := args["state"].(string)
+	label, _ := args["label"].(string)
+	selectors := splitList(label)
+	result := make([]types.ProcessInfo, 0)
+	for _, info := range infos {
+		if matchName(name, info.Name) && (group == "" || group == info.Group) &&
+			(state == "" || strings.EqualFold(state, info.Statename)) && matchLabels(info.Labels, selectors) {
+			result = append(result, info)
+		}
+	}
+	return result
+}
+
+// check if the name matches the shell pattern, the empty pattern matches all names
+func matchName(pattern string, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, err := path.Match(pattern, name)
+	return err == nil && matched
+}
+
+func toStartProcessArgs(args map[string]interface{}) *StartProcessArgs {
+	result := &StartProcessArgs{Name: args["name"].(string), Wait: true}
+	if wait, ok := args["wait"].(bool); ok {
+		result.Wait = wait
+	}
+	if timeout, ok := args["timeout"].(int); ok {
+		result.Timeout = timeout
+	}
+	if force, ok := args["force"].(bool); ok {
+		result.Force = force
+	}
+	return result
+}
+
+// parse the body of the process state event like "processname:web groupname:web from_state:STARTING pid:1234"
+func toProcessStateChange(event events.Event) *processStateChange {
+	header := event.GetBody()
+	if pos := strings.Index(header, "\n"); pos != -1 {
+		header = header[0:pos]
+	}
+	// use the state names like "Running" of the process information
+	state := strings.TrimPrefix(event.GetType(), "PROCESS_STATE_")
+	change := &processStateChange{Serial: int(event.GetSerial()),
+		Statename: state[0:1] + strings.ToLower(state[1:])}
+	for _, field := range strings.Fields(header) {
+		pos := strings.Index(field, ":")
+		if pos == -1 {
+			continue
+		}
+		value := field[pos+1:]
+		switch field[0:pos] {
+		case "processname":
+			change.Name = value
+		case "groupname":
+			change.Group = value
+		case "from_state":
+			change.FromState = value
+		case "pid":
+			change.Pid, _ = strconv.Atoi(value)
+		}
+	}
+	return change
+}
+
+// read the GraphQL request posted in json or passed by the url parameters
+// "query", "variables" and "operationName"
+func readGraphQLRequest(req *http.Request) (*graphQLRequest, error) {
+	request := &graphQLRequest{}
+	if req.Method == http.MethodPost {
+		defer req.Body.Close()
+		if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+			return nil, fmt.Errorf("not a valid GraphQL request: %v", err)
+		}
+	} else {
+		values := req.URL.Query()
+		request.Query = values.Get("query")
+		request.OperationName = values.Get("operationName")
+		if variables := values.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				return nil, fmt.Errorf("not valid GraphQL variables: %v", err)
+			}
+		}
+	}
+	if request.Query == "" {
+		return nil, fmt.Errorf("no GraphQL query")
+	}
+	return request, nil
+}
+
+// get the type of the operation executed by the request, the validation
+// errors are reported when the request is executed
+func getOperationType(request *graphQLRequest) string {
+	document, err := gqlparser.Parse(gqlparser.ParseParams{Source: request.Query})
+	if err != nil {
+		return ""
+	}
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if request.OperationName == "" || (operation.Name != nil && operation.Name.Value == request.OperationName) {
+			return operation.Operation
+		}
+	}
+	return ""
+}
+
+// get the http request attached to the context of GraphQL resolvers
+func graphQLHTTPRequest(ctx context.Context) *http.Request {
+	req, _ := ctx.Value(graphQLRequestKey{}).(*http.Request)
+	return req
+}
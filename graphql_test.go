@@ -0,0 +1,178 @@
+// +build !windows,!nohttp
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postGraphQL(t *testing.T, handler http.Handler, user *AuthUser, query string) map[string]interface{} {
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"query":`+jsonQuote(query)+`}`))
+	if user != nil {
+		req = withAuthUser(req, user)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	result := make(map[string]interface{})
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("fail to decode the GraphQL response %s: %v", w.Body.String(), err)
+	}
+	return result
+}
+
+func jsonQuote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func createGraphQLHandler(t *testing.T, s *Supervisor) http.Handler {
+	graphQL, err := NewSupervisorGraphQL(s)
+	if err != nil {
+		t.Fatalf("fail to create the GraphQL schema: %v", err)
+	}
+	return graphQL.CreateHandler()
+}
+
+func TestGraphQLQuery(t *testing.T) {
+	s := startACLTestSupervisor(t)
+	handler := createGraphQLHandler(t, s)
+
+	result := postGraphQL(t, handler, nil, `{ processes(state: "stopped", name: "w*") { name statename } groups { name processes { name } } }`)
+	data, _ := json.Marshal(result["data"])
+	if string(data) != `{"groups":[{"name":"db","processes":[{"name":"db"}]},{"name":"web","processes":[{"name":"web"}]}],"processes":[{"name":"web","statename":"Stopped"}]}` {
+		t.Errorf("fail to query the processes and groups: %s", data)
+	}
+
+	alice := &AuthUser{Name: "alice", Teams: []string{"web"}}
+	result = postGraphQL(t, handler, alice, `{ processes { name } }`)
+	data, _ = json.Marshal(result["data"])
+	if string(data) != `{"processes":[{"name":"web"}]}` {
+		t.Errorf("fail to query only the owned programs: %s", data)
+	}
+}
+
+func TestGraphQLMutation(t *testing.T) {
+	s := startACLTestSupervisor(t)
+	handler := createGraphQLHandler(t, s)
+	alice := &AuthUser{Name: "alice", Teams: []string{"web"}}
+
+	result := postGraphQL(t, handler, alice, `mutation { startProcess(name: "web") { name statename } }`)
+	data, _ := json.Marshal(result["data"])
+	if result["errors"] != nil || string(data) != `{"startProcess":[{"name":"web","statename":"Running"}]}` {
+		t.Errorf("fail to start the program: %v", result)
+	}
+	result = postGraphQL(t, handler, alice, `mutation { signalProcess(name: "db", signal: "HUP") { name } }`)
+	if result["errors"] == nil || !strings.Contains(result["errors"].([]interface{})[0].(map[string]interface{})["message"].(string), "NOT_AUTHORIZED") {
+		t.Errorf("fail to reject signaling the program of other owner: %v", result)
+	}
+	result = postGraphQL(t, handler, alice, `mutation { stopProcess(name: "web") { statename } }`)
+	data, _ = json.Marshal(result["data"])
+	if string(data) != `{"stopProcess":[{"statename":"Stopped"}]}` {
+		t.Errorf("fail to stop the program: %v", result)
+	}
+
+	req := httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape(`mutation { startProcess(name: "web") { name } }`), nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Error("fail to reject the mutation in GET")
+	}
+}
+
+func TestGraphQLSubscription(t *testing.T) {
+	s := startACLTestSupervisor(t)
+	server := httptest.NewServer(createGraphQLHandler(t, s))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/graphql?query="+url.QueryEscape(`subscription { processStateChanged(name: "web") { name statename } }`), nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("fail to subscribe: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("fail to stream the subscription: %s", resp.Status)
+	}
+
+	lines := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "data: ") {
+				lines <- scanner.Text()
+			}
+		}
+	}()
+	// the subscription is registered in background, restart the program until the state change is received
+	s.GetManager().Find("db").Start(true)
+	web := s.GetManager().Find("web")
+	deadline := time.After(5 * time.Second)
+	for {
+		web.Start(true)
+		select {
+		case line := <-lines:
+			if !strings.HasPrefix(line, `data: {"data":{"processStateChanged":{"name":"web","statename":"`) {
+				t.Errorf("fail to receive the state change: %s", line)
+			}
+			return
+		case <-deadline:
+			t.Error("fail to receive the state change in time")
+			return
+		case <-time.After(100 * time.Millisecond):
+			web.Stop(true)
+		}
+	}
+}
+
+func TestCtlWatch(t *testing.T) {
+	s := startCtlTestSupervisor(t)
+	server := httptest.NewServer(createGraphQLHandler(t, s))
+	defer server.Close()
+	defer server.CloseClientConnections()
+
+	r, w := io.Pipe()
+	watch := WatchCommand{Events: "PROCESS_STATE_RUNNING,PROCESS_STATE_STOPPED", Alert: "PROCESS_STATE_STOPPED"}
+	go watch.watch(server.URL, map[string]bool{"sleeper": true}, w)
+	lines := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	// the subscription is registered in background, restart the program until the state changes are received
+	sleeper := s.GetManager().Find("sleeper")
+	deadline := time.After(5 * time.Second)
+	for {
+		sleeper.Start(true)
+		select {
+		case line := <-lines:
+			// the stop of the previous try may be received first
+			if !strings.Contains(line, "RUNNING") {
+				continue
+			}
+			if !strings.Contains(line, "sleeper") || strings.HasPrefix(line, "\a") {
+				t.Errorf("fail to show the state change: %q", line)
+			}
+			sleeper.Stop(true)
+			if line = <-lines; !strings.Contains(line, "STOPPED") || !strings.HasPrefix(line, "\a") {
+				t.Errorf("fail to alert the stop: %q", line)
+			}
+			return
+		case <-deadline:
+			t.Error("fail to receive the state change in time")
+			return
+		case <-time.After(100 * time.Millisecond):
+			sleeper.Stop(true)
+		}
+	}
+}
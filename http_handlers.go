@@ -0,0 +1,36 @@
+// +build !nohttp
+
+package main
+
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the [inet_http_server] is supported if the binary is not built with the nohttp tag
+const inetHTTPServerSupported = true
+
+// register the JSON-RPC, REST, logtail, metrics and GraphQL handlers and the REST
+// extensions, they are not built in the binary built with the nohttp tag
+func (p *XMLRPC) registerHTTPHandlers(mux *http.ServeMux, s *Supervisor, protect func(http.Handler) http.Handler) {
+	mux.Handle("/RPC2-json", protect(p.createJSONRPCHandler(s)))
+	progRestHandler := NewSupervisorRestful(s).CreateProgramHandler()
+	mux.Handle("/program/", protect(progRestHandler))
+	supervisorRestHandler := NewSupervisorRestful(s).CreateSupervisorHandler()
+	mux.Handle("/supervisor/", protect(supervisorRestHandler))
+	apiRestHandler := NewSupervisorRestful(s).CreateAPIHandler()
+	mux.Handle("/api/", protect(apiRestHandler))
+	jobRestHandler := NewSupervisorRestful(s).CreateJobHandler()
+	mux.Handle("/jobs/", protect(jobRestHandler))
+	logtailHandler := NewLogtail(s).CreateHandler()
+	mux.Handle("/logtail/", protect(logtailHandler))
+	mux.Handle("/mainlogtail", protect(logtailHandler))
+	registerMetricsHandler(mux, s, protect)
+	if graphQL, err := NewSupervisorGraphQL(s); err == nil {
+		mux.Handle("/graphql", protect(graphQL.CreateHandler()))
+	} else {
+		log.WithFields(log.Fields{log.ErrorKey: err}).Error("fail to create the GraphQL schema")
+	}
+	s.registerRESTExtensions(mux, protect)
+}
@@ -0,0 +1,13 @@
+// +build nohttp
+
+package main
+
+import (
+	"net/http"
+)
+
+// only the XML-RPC on the unix socket is served by the binary built with the nohttp tag
+const inetHTTPServerSupported = false
+
+func (p *XMLRPC) registerHTTPHandlers(mux *http.ServeMux, s *Supervisor, protect func(http.Handler) http.Handler) {
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// IdempotencyKeyHeader the header used by the clients to identify a mutating
+// request, the retried requests with the same key are not executed again
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// the default time to remember the result of a request
+const defaultIdempotencyKeyTTL = 10 * time.Minute
+
+// the result of a request identified by the idempotency key
+type idempotentResult struct {
+	request string // method and path of the request
+	done    bool   // false if the request is still being processed
+	status  int
+	header  http.Header
+	body    []byte
+	expire  time.Time
+}
+
+// IdempotencyStore remember in memory the results of the mutating requests
+// by their idempotency keys until the ttl expires
+type IdempotencyStore struct {
+	sync.Mutex
+	ttl     time.Duration
+	results map[string]*idempotentResult
+}
+
+// NewIdempotencyStore create an empty IdempotencyStore
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{ttl: ttl, results: make(map[string]*idempotentResult)}
+}
+
+// SetTTL set the time to remember the result of a request
+func (is *IdempotencyStore) SetTTL(ttl time.Duration) {
+	is.Lock()
+	defer is.Unlock()
+	is.ttl = ttl
+}
+
+// Wrap create a handler which executes the request only once for the same
+// idempotency key and replays the saved result for the retried requests.
+// The requests without the idempotency key are always executed
+func (is *IdempotencyStore) Wrap(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			handler(w, req)
+			return
+		}
+		request := req.Method + " " + req.URL.String()
+		result, found := is.begin(key, request)
+		if found {
+			is.replay(w, result, request)
+			return
+		}
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler(recorder, req)
+		is.finish(key, result, recorder)
+	}
+}
+
+// find the result of the key or add a new one if the key is not used
+func (is *IdempotencyStore) begin(key string, request string) (*idempotentResult, bool) {
+	is.Lock()
+	defer is.Unlock()
+	is.removeExpired()
+	if result, ok := is.results[key]; ok {
+		return result, true
+	}
+	result := &idempotentResult{request: request, expire: time.Now().Add(is.ttl)}
+	is.results[key] = result
+	return result, false
+}
+
+func (is *IdempotencyStore) finish(key string, result *idempotentResult, recorder *responseRecorder) {
+	is.Lock()
+	defer is.Unlock()
+	result.done = true
+	result.status = recorder.status
+	result.header = recorder.Header().Clone()
+	result.body = recorder.body.Bytes()
+	result.expire = time.Now().Add(is.ttl)
+}
+
+func (is *IdempotencyStore) replay(w http.ResponseWriter, result *idempotentResult, request string) {
+	is.Lock()
+	defer is.Unlock()
+	if result.request != request {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte("the idempotency key is used by another request"))
+		return
+	}
+	if !result.done {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("the request with same idempotency key is being processed"))
+		return
+	}
+	log.WithFields(log.Fields{"request": request}).Debug("replay the result of request with same idempotency key")
+	for k, v := range result.header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(result.status)
+	w.Write(result.body)
+}
+
+func (is *IdempotencyStore) removeExpired() {
+	now := time.Now()
+	for key, result := range is.results {
+		if result.done && now.After(result.expire) {
+			delete(is.results, key)
+		}
+	}
+}
+
+// responseRecorder save the status and body written to the ResponseWriter
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	store := NewIdempotencyStore(time.Minute)
+	calls := 0
+	handler := store.Wrap(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		w.Write([]byte("done"))
+	})
+	send := func(path string, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	send("/program/restart/test", "key-1")
+	w := send("/program/restart/test", "key-1")
+	if calls != 1 || w.Body.String() != "done" || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("fail to replay the request with same idempotency key")
+	}
+	if w = send("/program/stop/test", "key-1"); w.Code != http.StatusUnprocessableEntity || calls != 1 {
+		t.Error("fail to reject the idempotency key used by another request")
+	}
+	send("/program/restart/test", "")
+	send("/program/restart/test", "")
+	if calls != 3 {
+		t.Error("fail to execute the requests without idempotency key")
+	}
+}
+
+func TestIdempotencyStoreExpire(t *testing.T) {
+	store := NewIdempotencyStore(time.Millisecond)
+	calls := 0
+	handler := store.Wrap(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+	})
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/program/start/test", nil)
+		req.Header.Set(IdempotencyKeyHeader, "key-1")
+		handler(httptest.NewRecorder(), req)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if calls != 2 {
+		t.Error("fail to forget the expired idempotency key")
+	}
+}
@@ -0,0 +1,208 @@
+// +build !windows,!nohttp
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ochinchina/supervisord/xmlrpcclient"
+	log "github.com/sirupsen/logrus"
+	"supervisord/internal/testutil"
+)
+
+// the config of the supervisord running the fake programs, the "%[1]s" is the
+// directory of the config file and "%[2]s" is the address of http server
+const integrationConfig = `[supervisord]
+logfile=%[1]s/supervisord.log
+pidfile=%[1]s/supervisord.pid
+
+[inet_http_server]
+port=%[2]s
+
+[program:sleeper]
+command=%[3]s
+startsecs=0
+stdout_logfile=/dev/null
+stderr_logfile=/dev/null
+
+[program:crasher]
+command=%[4]s
+autostart=false
+startsecs=1
+startretries=0
+stdout_logfile=/dev/null
+stderr_logfile=/dev/null
+
+[program:stubborn]
+command=%[5]s
+autostart=false
+startsecs=1
+stopwaitsecs=1
+stdout_logfile=/dev/null
+stderr_logfile=/dev/null
+
+[program:spammer]
+command=%[6]s
+autostart=false
+startsecs=0
+stdout_logfile=%[1]s/spammer.log
+stderr_logfile=/dev/null
+`
+
+// boot a supervisord with the fake programs and return the client connected
+// to it through the XML RPC interface
+func startTestSupervisor(t *testing.T) (*Supervisor, *xmlrpcclient.XMLRPCClient, string) {
+	dir := testutil.TempDir(t)
+	addr := testutil.FreePort(t)
+	content := fmt.Sprintf(integrationConfig, dir, addr,
+		testutil.FakeProgram(t, dir, testutil.Sleep),
+		testutil.FakeProgram(t, dir, testutil.Crash),
+		testutil.FakeProgram(t, dir, testutil.IgnoreTerm),
+		testutil.FakeProgram(t, dir, testutil.SpamLogs))
+	configFile := testutil.WriteFile(t, dir, "supervisord.conf", content)
+
+	s := NewSupervisor(configFile)
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to start supervisord: %v", err)
+	}
+	t.Cleanup(func() {
+		s.GetManager().StopAllProcesses()
+		s.xmlRPC.Stop()
+	})
+	return s, xmlrpcclient.NewXMLRPCClient("http://"+addr, false), addr
+}
+
+func waitForState(t *testing.T, rpcc *xmlrpcclient.XMLRPCClient, name string, state string, timeout time.Duration) {
+	if !testutil.WaitFor(timeout, func() bool {
+		info, err := rpcc.GetProcessInfo(name)
+		return err == nil && info.Statename == state
+	}) {
+		t.Errorf("fail to wait for %s in state %s", name, state)
+	}
+}
+
+func TestIntegration(t *testing.T) {
+	s, rpcc, addr := startTestSupervisor(t)
+
+	t.Run("autostart", func(t *testing.T) {
+		waitForState(t, rpcc, "sleeper", "Running", 5*time.Second)
+	})
+
+	t.Run("stop and start", func(t *testing.T) {
+		if reply, err := rpcc.ChangeProcessState("stop", "sleeper"); err != nil || !reply.Value {
+			t.Error("fail to stop the program")
+		}
+		waitForState(t, rpcc, "sleeper", "Stopped", 5*time.Second)
+		if reply, err := rpcc.ChangeProcessState("start", "sleeper"); err != nil || !reply.Value {
+			t.Error("fail to start the program")
+		}
+		waitForState(t, rpcc, "sleeper", "Running", 5*time.Second)
+	})
+
+	t.Run("process config", func(t *testing.T) {
+		config, err := rpcc.GetProcessConfig("sleeper")
+		if err != nil || !config.Spawned || len(config.Command) != 2 || len(config.Environment) == 0 || config.StdoutLogfile != "/dev/null" {
+			t.Errorf("fail to get the process config: %v %v", config, err)
+		}
+	})
+
+	t.Run("config info", func(t *testing.T) {
+		infos, err := rpcc.GetAllConfigInfo()
+		if err != nil || len(infos) != 4 {
+			t.Fatalf("fail to get the config info: %v %v", infos, err)
+		}
+		for _, info := range infos {
+			if info.Name == "crasher" && (info.Autostart || !info.Inuse || info.Startsecs != 1 || info.Stopsignal != 15 || len(info.Exitcodes) != 2) {
+				t.Errorf("fail to get the config info of the program: %v", info)
+			}
+		}
+	})
+
+	t.Run("crash", func(t *testing.T) {
+		rpcc.ChangeProcessState("start", "crasher")
+		waitForState(t, rpcc, "crasher", "Fatal", 5*time.Second)
+	})
+
+	t.Run("kill the program ignoring TERM", func(t *testing.T) {
+		// wait startsecs for the program to trap TERM
+		rpcc.ChangeProcessState("start", "stubborn")
+		waitForState(t, rpcc, "stubborn", "Running", 5*time.Second)
+		start := time.Now()
+		rpcc.ChangeProcessState("stop", "stubborn")
+		waitForState(t, rpcc, "stubborn", "Stopped", 5*time.Second)
+		if time.Since(start) < time.Second {
+			t.Error("fail to wait stopwaitsecs before killing the program")
+		}
+	})
+
+	t.Run("tail log", func(t *testing.T) {
+		rpcc.ChangeProcessState("start", "spammer")
+		waitForState(t, rpcc, "spammer", "Running", 5*time.Second)
+		client := http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Get("http://" + addr + "/logtail/spammer/stdout")
+		if err != nil {
+			t.Fatalf("fail to tail the log: %v", err)
+		}
+		defer resp.Body.Close()
+		line, err := bufio.NewReader(resp.Body).ReadString('\n')
+		if err != nil || !strings.Contains(line, "log line") {
+			t.Errorf("fail to read the tailed log: %q", line)
+		}
+	})
+
+	t.Run("tail supervisord log", func(t *testing.T) {
+		if data, err := rpcc.ReadLog(-100, 0); err != nil || len(data) == 0 || len(data) > 100 {
+			t.Errorf("fail to read the end of the supervisord log: %q %v", data, err)
+		}
+		// the response starts with the first log written after the client is connected
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(50 * time.Millisecond):
+					log.Info("tail supervisord log marker")
+				}
+			}
+		}()
+		client := http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Get("http://" + addr + "/mainlogtail")
+		if err != nil {
+			t.Fatalf("fail to tail the supervisord log: %v", err)
+		}
+		defer resp.Body.Close()
+		line, err := bufio.NewReader(resp.Body).ReadString('\n')
+		if err != nil || !strings.Contains(line, "tail supervisord log marker") {
+			t.Errorf("fail to read the tailed supervisord log: %q", line)
+		}
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		dir := s.GetConfig().GetConfigFileDir()
+		content := fmt.Sprintf(integrationConfig, dir, addr,
+			"/bin/sh "+filepath.Join(dir, testutil.Sleep+".sh"),
+			"/bin/sh "+filepath.Join(dir, testutil.Crash+".sh"),
+			"/bin/sh "+filepath.Join(dir, testutil.IgnoreTerm+".sh"),
+			"/bin/sh "+filepath.Join(dir, testutil.SpamLogs+".sh"))
+		content = strings.Replace(content, "[program:sleeper]", "[program:added]", 1)
+		testutil.WriteFile(t, dir, "supervisord.conf", content)
+
+		reply, err := rpcc.ReloadConfig()
+		if err != nil || len(reply.AddedGroup) != 1 || reply.AddedGroup[0] != "added" ||
+			len(reply.RemovedGroup) != 1 || reply.RemovedGroup[0] != "sleeper" {
+			t.Errorf("fail to reload the config: %v %v", reply, err)
+		}
+		waitForState(t, rpcc, "added", "Running", 5*time.Second)
+		if _, err := rpcc.GetProcessInfo("sleeper"); err == nil {
+			t.Error("fail to remove the program")
+		}
+	})
+}
@@ -0,0 +1,109 @@
+// Package configio writes the configuration files changed through the APIs
+// of supervisord, like the programs edited in the web GUI or added by REST
+package configio
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// BackupSuffix the suffix of the previous content of a replaced file
+const BackupSuffix = ".bak"
+
+// Validator check the configuration if the file had the content
+type Validator func(fileName string, content []byte) error
+
+// BackupFile get the name of the backup of the file
+func BackupFile(fileName string) string {
+	return fileName + BackupSuffix
+}
+
+// write the content to a new temporary file in the directory of the file,
+// the file is never left partially written
+func writeTempFile(fileName string, content []byte, mode os.FileMode) (string, error) {
+	f, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName)+".tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(content)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), mode)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// WriteFile replace the content of the file atomically. The content is
+// written to a temporary file, read back and checked by validate before the
+// temporary file is renamed to the file. The previous content is kept in the
+// backup file (one generation) for Rollback and the mode of the file is kept
+func WriteFile(fileName string, content []byte, validate Validator) error {
+	mode := os.FileMode(0644)
+	prevContent, err := ioutil.ReadFile(fileName)
+	exists := err == nil
+	if exists {
+		if fileInfo, err := os.Stat(fileName); err == nil {
+			mode = fileInfo.Mode()
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	tmpFile, err := writeTempFile(fileName, content, mode)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile)
+	written, err := ioutil.ReadFile(tmpFile)
+	if err != nil {
+		return err
+	}
+	if validate != nil {
+		if err = validate(fileName, written); err != nil {
+			return err
+		}
+	}
+	if exists {
+		if err = writeBackup(fileName, prevContent, mode); err != nil {
+			return fmt.Errorf("fail to keep the backup of %s: %v", fileName, err)
+		}
+	}
+	return os.Rename(tmpFile, fileName)
+}
+
+// replace the backup of the file with the content
+func writeBackup(fileName string, content []byte, mode os.FileMode) error {
+	backupFile := BackupFile(fileName)
+	tmpFile, err := writeTempFile(backupFile, content, mode)
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmpFile, backupFile); err != nil {
+		os.Remove(tmpFile)
+	}
+	return err
+}
+
+// Rollback restore the content of the file replaced by the last WriteFile,
+// the backup is checked by validate first. The current content becomes the
+// backup so the rollback can be reverted
+func Rollback(fileName string, validate Validator) error {
+	backup, err := ioutil.ReadFile(BackupFile(fileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no backup of %s", fileName)
+		}
+		return err
+	}
+	return WriteFile(fileName, backup, validate)
+}
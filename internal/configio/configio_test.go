@@ -0,0 +1,85 @@
+package configio
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// accept the content with a command
+func validateCommand(fileName string, content []byte) error {
+	if !strings.Contains(string(content), "command=") {
+		return fmt.Errorf("no command in %s", fileName)
+	}
+	return nil
+}
+
+// get the names of the files in the directory
+func listFiles(t *testing.T, dir string) []string {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0)
+	for _, fileInfo := range fileInfos {
+		names = append(names, fileInfo.Name())
+	}
+	return names
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "api.conf")
+
+	if err := WriteFile(fileName, []byte("[program:api]\ncommand=/bin/ls\n"), validateCommand); err != nil {
+		t.Fatalf("fail to write the new file: %v", err)
+	}
+	if names := listFiles(t, dir); len(names) != 1 || names[0] != "api.conf" {
+		t.Errorf("fail to write the new file without backup: %v", names)
+	}
+	os.Chmod(fileName, 0600)
+
+	if err := WriteFile(fileName, []byte("[program:api]\ndirectory=/tmp\n"), validateCommand); err == nil {
+		t.Error("fail to refuse the invalid content")
+	}
+	if content, _ := ioutil.ReadFile(fileName); string(content) != "[program:api]\ncommand=/bin/ls\n" {
+		t.Errorf("fail to keep the file with invalid content: %q", content)
+	}
+	if names := listFiles(t, dir); len(names) != 1 {
+		t.Errorf("fail to remove the temporary file: %v", names)
+	}
+
+	if err := WriteFile(fileName, []byte("[program:api]\ncommand=/bin/ls -l\n"), validateCommand); err != nil {
+		t.Fatalf("fail to replace the file: %v", err)
+	}
+	if fileInfo, err := os.Stat(fileName); err != nil || (runtime.GOOS != "windows" && fileInfo.Mode().Perm() != 0600) {
+		t.Error("fail to keep the mode of the file")
+	}
+	if content, _ := ioutil.ReadFile(BackupFile(fileName)); string(content) != "[program:api]\ncommand=/bin/ls\n" {
+		t.Errorf("fail to keep the previous content in the backup: %q", content)
+	}
+	if names := listFiles(t, dir); len(names) != 2 || names[0] != "api.conf" || names[1] != "api.conf.bak" {
+		t.Errorf("fail to keep only the file and its backup: %v", names)
+	}
+
+	if err := Rollback(fileName, validateCommand); err != nil {
+		t.Fatalf("fail to rollback the file: %v", err)
+	}
+	if content, _ := ioutil.ReadFile(fileName); string(content) != "[program:api]\ncommand=/bin/ls\n" {
+		t.Errorf("fail to restore the backup: %q", content)
+	}
+	if content, _ := ioutil.ReadFile(BackupFile(fileName)); string(content) != "[program:api]\ncommand=/bin/ls -l\n" {
+		t.Errorf("fail to keep the rolled back content in the backup: %q", content)
+	}
+	if err := Rollback(filepath.Join(dir, "web.conf"), validateCommand); err == nil {
+		t.Error("fail to report the file without backup")
+	}
+}
@@ -0,0 +1,89 @@
+// +build !windows
+
+// Package testutil provides the fake programs and helpers to run supervisord
+// end to end in the tests
+package testutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// the behaviors of the fake programs
+const (
+	Sleep      = "sleep"       // run until it is stopped
+	Crash      = "crash"       // print an error and exit with code 3 immediately
+	SpamLogs   = "spam-logs"   // print numbered lines to stdout continuously
+	IgnoreTerm = "ignore-term" // ignore SIGTERM, must be killed
+	Busy       = "busy"        // use all the CPU it gets
+)
+
+var fakePrograms = map[string]string{
+	Sleep:      "exec sleep 1000\n",
+	Crash:      "echo \"crash\" >&2\nexit 3\n",
+	SpamLogs:   "i=0\nwhile true; do\n  i=$((i+1))\n  echo \"log line $i\"\n  sleep 0.01\ndone\n",
+	IgnoreTerm: "trap '' TERM\nwhile true; do\n  sleep 0.1\ndone\n",
+	Busy:       "while true; do\n  :\ndone\n",
+}
+
+// FakeProgram write the script of the fake program with the behavior to the
+// directory and return the command to run it
+func FakeProgram(t testing.TB, dir string, behavior string) string {
+	script, ok := fakePrograms[behavior]
+	if !ok {
+		t.Fatalf("unknown fake program %s", behavior)
+	}
+	fileName := filepath.Join(dir, behavior+".sh")
+	if err := ioutil.WriteFile(fileName, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("fail to write fake program %s: %v", fileName, err)
+	}
+	return "/bin/sh " + fileName
+}
+
+// TempDir create a temporary directory which is removed when the test finishes
+func TempDir(t testing.TB) string {
+	dir, err := ioutil.TempDir("", "supervisord-test")
+	if err != nil {
+		t.Fatal("fail to create temporary directory")
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// WriteFile write the content to the file in the directory and return its path
+func WriteFile(t testing.TB, dir string, name string, content string) string {
+	fileName := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatalf("fail to write file %s: %v", fileName, err)
+	}
+	return fileName
+}
+
+// FreePort find an unused tcp port on the loopback interface and return the
+// address "127.0.0.1:<port>"
+func FreePort(t testing.TB) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("fail to find a free port")
+	}
+	defer listener.Close()
+	return fmt.Sprintf("127.0.0.1:%d", listener.Addr().(*net.TCPAddr).Port)
+}
+
+// WaitFor check the condition periodically until it is true or the timeout
+// expires, return the last result of the condition
+func WaitFor(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return true
+}
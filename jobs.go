@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the time to keep a finished job
+const jobTTL = 10 * time.Minute
+
+// the maximum seconds to wait for a job to be finished in a long-poll request
+const maxJobWait = 60
+
+// the job states
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job an asynchronous start/stop/restart of programs requested through the
+// REST interface, the client polls the job instead of waiting for the programs
+type Job struct {
+	ID       string          `json:"id"`
+	Action   string          `json:"action"`
+	Programs []string        `json:"programs"`
+	State    string          `json:"state"`
+	Done     int             `json:"done"`   // the number of processed programs
+	Total    int             `json:"total"`  // the number of programs
+	Result   map[string]bool `json:"result"` // the success of each processed program
+	Errors   []string        `json:"errors,omitempty"`
+	Created  int64           `json:"created"`
+	Finished int64           `json:"finished,omitempty"`
+
+	finishedCh chan struct{}
+}
+
+// JobManager run and keep the asynchronous jobs
+type JobManager struct {
+	sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewJobManager create an empty JobManager
+func NewJobManager() *JobManager {
+	return &JobManager{jobs: make(map[string]*Job)}
+}
+
+// Submit create a job executing the action on the programs one by one in background
+func (jm *JobManager) Submit(action string, programs []string, execute func(program string) (bool, error)) Job {
+	job := &Job{ID: newJobID(),
+		Action:     action,
+		Programs:   programs,
+		State:      JobRunning,
+		Total:      len(programs),
+		Result:     make(map[string]bool),
+		Created:    time.Now().Unix(),
+		finishedCh: make(chan struct{})}
+
+	jm.Lock()
+	jm.removeExpired()
+	jm.jobs[job.ID] = job
+	snapshot := job.snapshot()
+	jm.Unlock()
+
+	log.WithFields(log.Fields{"job": job.ID, "action": action, "programs": programs}).Info("start job")
+	go func() {
+		for _, program := range programs {
+			success, err := execute(program)
+			jm.Lock()
+			job.Done++
+			job.Result[program] = err == nil && success
+			if err != nil {
+				job.Errors = append(job.Errors, fmt.Sprintf("%s: %v", program, err))
+			}
+			jm.Unlock()
+		}
+		jm.Lock()
+		job.State = JobSucceeded
+		for _, success := range job.Result {
+			if !success {
+				job.State = JobFailed
+			}
+		}
+		job.Finished = time.Now().Unix()
+		jm.Unlock()
+		close(job.finishedCh)
+		log.WithFields(log.Fields{"job": job.ID, "state": job.State}).Info("job is finished")
+	}()
+	return snapshot
+}
+
+// Get get the job by id. If wait is greater than 0, wait at most the duration
+// for the job to be finished
+func (jm *JobManager) Get(id string, wait time.Duration) (Job, bool) {
+	jm.Lock()
+	job, ok := jm.jobs[id]
+	jm.Unlock()
+	if !ok {
+		return Job{}, false
+	}
+	if wait > 0 {
+		select {
+		case <-job.finishedCh:
+		case <-time.After(wait):
+		}
+	}
+	jm.Lock()
+	defer jm.Unlock()
+	return job.snapshot(), true
+}
+
+func (jm *JobManager) removeExpired() {
+	expire := time.Now().Add(-jobTTL).Unix()
+	for id, job := range jm.jobs {
+		if job.State != JobRunning && job.Finished < expire {
+			delete(jm.jobs, id)
+		}
+	}
+}
+
+// copy the job, must be called with the lock of JobManager
+func (job *Job) snapshot() Job {
+	result := *job
+	result.Result = make(map[string]bool)
+	for k, v := range job.Result {
+		result.Result[k] = v
+	}
+	result.Errors = append([]string(nil), job.Errors...)
+	return result
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,301 @@
+// +build !nohttp
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/rpc"
+	xmlrpc "github.com/ochinchina/gorilla-xmlrpc/xml"
+	"github.com/ochinchina/supervisord/faults"
+)
+
+// the error codes defined by JSON-RPC 2.0
+const (
+	jsonRPCParseError     = -32700
+	jsonRPCInvalidRequest = -32600
+	jsonRPCMethodNotFound = -32601
+	jsonRPCInvalidParams  = -32602
+	jsonRPCServerError    = -32000
+)
+
+type jsonRPCRequest struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type jsonRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type jsonRPCResponse struct {
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonRPCError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// jsonRPCCodec the JSON-RPC 2.0 codec of gorilla rpc server. Like the XML-RPC
+// codec, the methods are called with the aliases like "supervisor.getState"
+type jsonRPCCodec struct {
+	aliases map[string]string
+}
+
+// jsonRPCCodecRequest decode a JSON-RPC request and encode its response
+type jsonRPCCodecRequest struct {
+	request *jsonRPCRequest
+	method  string
+	err     error
+}
+
+// jsonRPCHandler serve the single or batch JSON-RPC requests with the rpc
+// server, the invalid requests are answered with the JSON-RPC errors
+type jsonRPCHandler struct {
+	server *rpc.Server
+	codec  *jsonRPCCodec
+}
+
+// create the handler of JSON-RPC 2.0 requests calling the same methods as XML-RPC
+func (p *XMLRPC) createJSONRPCHandler(s *Supervisor) http.Handler {
+	jsonrpcCodec := newJSONRPCCodec()
+	RPC, _ := newRPCServer(s, jsonrpcCodec, "application/json")
+	return &jsonRPCHandler{server: RPC, codec: jsonrpcCodec}
+}
+
+func newJSONRPCCodec() *jsonRPCCodec {
+	return &jsonRPCCodec{aliases: make(map[string]string)}
+}
+
+// RegisterAlias register an alias of the method
+func (c *jsonRPCCodec) RegisterAlias(alias, method string) {
+	c.aliases[alias] = method
+}
+
+func (c *jsonRPCCodec) resolve(method string) string {
+	if realMethod, ok := c.aliases[method]; ok {
+		return realMethod
+	}
+	return method
+}
+
+// NewRequest implements rpc.Codec interface
+func (c *jsonRPCCodec) NewRequest(r *http.Request) rpc.CodecRequest {
+	request := &jsonRPCRequest{}
+	err := json.NewDecoder(r.Body).Decode(request)
+	r.Body.Close()
+	return &jsonRPCCodecRequest{request: request, method: c.resolve(request.Method), err: err}
+}
+
+// Method implements rpc.CodecRequest interface
+func (c *jsonRPCCodecRequest) Method() (string, error) {
+	return c.method, c.err
+}
+
+// ReadRequest implements rpc.CodecRequest interface. The params are either an
+// object with the argument fields or an array of argument fields in order like
+// the XML-RPC params
+func (c *jsonRPCCodecRequest) ReadRequest(args interface{}) error {
+	value := reflect.ValueOf(args).Elem()
+	if value.Kind() != reflect.Struct {
+		return json.Unmarshal(c.request.Params, args)
+	}
+	if err := setDefaultFields(value); err != nil {
+		return err
+	}
+	params := bytes.TrimSpace(c.request.Params)
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if params[0] != '[' {
+		return json.Unmarshal(params, args)
+	}
+	values := make([]json.RawMessage, 0)
+	if err := json.Unmarshal(params, &values); err != nil {
+		return err
+	}
+	if len(values) > value.NumField() {
+		return fmt.Errorf("%s expects at most %d params", c.request.Method, value.NumField())
+	}
+	for i, param := range values {
+		if err := json.Unmarshal(param, value.Field(i).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteResponse implements rpc.CodecRequest interface. The reply with one
+// field is written as the value of the field and the reply with multiple
+// fields is written as an array of the field values like the XML-RPC params
+func (c *jsonRPCCodecRequest) WriteResponse(w http.ResponseWriter, reply interface{}, methodErr error) error {
+	response := &jsonRPCResponse{Version: "2.0", ID: c.request.ID}
+	if methodErr != nil {
+		response.Error = toJSONRPCError(methodErr)
+	} else {
+		value := reflect.ValueOf(reply).Elem()
+		var result interface{} = reply
+		if value.Kind() == reflect.Struct {
+			fields := make([]interface{}, value.NumField())
+			for i := range fields {
+				fields[i] = value.Field(i).Interface()
+			}
+			result = fields
+			if len(fields) == 1 {
+				result = fields[0]
+			}
+		}
+		b, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		response.Result = b
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(response)
+}
+
+// set the fields with "default" tag like the XML-RPC codec
+func setDefaultFields(value reflect.Value) error {
+	for i := 0; i < value.NumField(); i++ {
+		defaultValue := value.Type().Field(i).Tag.Get("default")
+		if defaultValue == "" {
+			continue
+		}
+		field := value.Field(i)
+		switch field.Kind() {
+		case reflect.Bool:
+			b, err := strconv.ParseBool(defaultValue)
+			if err != nil {
+				return err
+			}
+			field.SetBool(b)
+		case reflect.Int:
+			n, err := strconv.Atoi(defaultValue)
+			if err != nil {
+				return err
+			}
+			field.SetInt(int64(n))
+		case reflect.String:
+			field.SetString(defaultValue)
+		}
+	}
+	return nil
+}
+
+// the faults keep their codes, the other errors are reported as server errors
+func toJSONRPCError(err error) *jsonRPCError {
+	var fault *xmlrpc.Fault
+	if errors.As(err, &fault) {
+		return &jsonRPCError{Code: fault.Code, Message: fault.String}
+	}
+	var faultValue xmlrpc.Fault
+	if errors.As(err, &faultValue) {
+		return &jsonRPCError{Code: faultValue.Code, Message: faultValue.String}
+	}
+	return &jsonRPCError{Code: jsonRPCServerError, Message: err.Error()}
+}
+
+func newJSONRPCError(id json.RawMessage, code int, message string) json.RawMessage {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	b, _ := json.Marshal(&jsonRPCResponse{Version: "2.0", Error: &jsonRPCError{Code: code, Message: message}, ID: id})
+	return b
+}
+
+// ServeHTTP serve the JSON-RPC requests, no content is returned if all the
+// requests are notifications
+func (h *jsonRPCHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "rpc: POST method required, received "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '[' {
+		h.writeResponse(w, h.call(r, body))
+		return
+	}
+	batch := make([]json.RawMessage, 0)
+	if err := json.Unmarshal(body, &batch); err != nil {
+		h.writeResponse(w, newJSONRPCError(nil, jsonRPCParseError, "Parse error"))
+		return
+	}
+	if len(batch) == 0 {
+		h.writeResponse(w, newJSONRPCError(nil, jsonRPCInvalidRequest, "Invalid Request"))
+		return
+	}
+	responses := make([]json.RawMessage, 0)
+	for _, request := range batch {
+		if response := h.call(r, request); response != nil {
+			responses = append(responses, response)
+		}
+	}
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	b, _ := json.Marshal(responses)
+	h.writeResponse(w, b)
+}
+
+func (h *jsonRPCHandler) writeResponse(w http.ResponseWriter, response json.RawMessage) {
+	if response == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// call the method of one JSON-RPC request, nil is returned for the notification
+func (h *jsonRPCHandler) call(r *http.Request, body []byte) json.RawMessage {
+	request := &jsonRPCRequest{}
+	if err := json.Unmarshal(body, request); err != nil {
+		if json.Valid(body) {
+			return newJSONRPCError(nil, jsonRPCInvalidRequest, "Invalid Request")
+		}
+		return newJSONRPCError(nil, jsonRPCParseError, "Parse error")
+	}
+	if request.Version != "2.0" || request.Method == "" {
+		return newJSONRPCError(request.ID, jsonRPCInvalidRequest, "Invalid Request")
+	}
+	var response json.RawMessage
+	if !h.server.HasMethod(h.codec.resolve(request.Method)) {
+		response = newJSONRPCError(request.ID, jsonRPCMethodNotFound, "Method not found: "+request.Method)
+	} else if user := getAuthUser(r); !isRPCMethodAllowed(user, request.Method) {
+		response = newJSONRPCError(request.ID, faults.NotAuthorized, fmt.Sprintf("NOT_AUTHORIZED: user %s is not allowed to call %s", user.Name, request.Method))
+	} else {
+		req := r.Clone(r.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := &rpcResponseRecorder{header: make(http.Header)}
+		h.server.ServeHTTP(recorder, req)
+		if recorder.status == 0 || recorder.status == http.StatusOK {
+			response = bytes.TrimSpace(recorder.body.Bytes())
+		} else {
+			// the params can't be decoded to the arguments of method
+			response = newJSONRPCError(request.ID, jsonRPCInvalidParams, strings.TrimSpace(recorder.body.String()))
+		}
+	}
+	if len(request.ID) == 0 {
+		return nil
+	}
+	return response
+}
@@ -0,0 +1,95 @@
+// +build !windows,!nohttp
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postJSONRPC(handler http.Handler, user *AuthUser, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/RPC2-json", strings.NewReader(body))
+	if user != nil {
+		req = withAuthUser(req, user)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func decodeJSONRPCResponse(t *testing.T, w *httptest.ResponseRecorder) *jsonRPCResponse {
+	response := &jsonRPCResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), response); err != nil {
+		t.Fatalf("fail to decode the JSON-RPC response %s: %v", w.Body.String(), err)
+	}
+	return response
+}
+
+func TestJSONRPCCall(t *testing.T) {
+	s := startACLTestSupervisor(t)
+	handler := NewXMLRPC().createJSONRPCHandler(s)
+
+	response := decodeJSONRPCResponse(t, postJSONRPC(handler, nil, `{"jsonrpc":"2.0","method":"supervisor.getVersion","id":1}`))
+	if response.Error != nil || string(response.Result) != `"3.0"` || string(response.ID) != "1" {
+		t.Errorf("fail to get the version: %v", response)
+	}
+	response = decodeJSONRPCResponse(t, postJSONRPC(handler, nil, `{"jsonrpc":"2.0","method":"supervisor.getProcessInfo","params":{"name":"web"},"id":"a"}`))
+	info := make(map[string]interface{})
+	json.Unmarshal(response.Result, &info)
+	if info["name"] != "web" || info["statename"] != "Stopped" || string(response.ID) != `"a"` {
+		t.Errorf("fail to get the process info with named params: %s", response.Result)
+	}
+	response = decodeJSONRPCResponse(t, postJSONRPC(handler, nil, `{"jsonrpc":"2.0","method":"supervisor.startProcess","params":["web"],"id":2}`))
+	if string(response.Result) != "true" || s.GetManager().Find("web").GetState().String() != "Running" {
+		t.Errorf("fail to start the process with positional params: %s", response.Result)
+	}
+	response = decodeJSONRPCResponse(t, postJSONRPC(handler, nil, `{"jsonrpc":"2.0","method":"supervisor.noSuchMethod","id":3}`))
+	if response.Error == nil || response.Error.Code != jsonRPCMethodNotFound {
+		t.Error("fail to report the method not found")
+	}
+	response = decodeJSONRPCResponse(t, postJSONRPC(handler, nil, `{"jsonrpc":"2.0","method":"supervisor.getProcessInfo","params":{"name":"nothing"},"id":4}`))
+	if response.Error == nil || !strings.Contains(response.Error.Message, "nothing") {
+		t.Error("fail to report the error of method")
+	}
+	response = decodeJSONRPCResponse(t, postJSONRPC(handler, nil, `{"jsonrpc":"2.0",`))
+	if response.Error == nil || response.Error.Code != jsonRPCParseError || string(response.ID) != "null" {
+		t.Error("fail to report the parse error")
+	}
+}
+
+func TestJSONRPCBatch(t *testing.T) {
+	s := startACLTestSupervisor(t)
+	handler := NewXMLRPC().createJSONRPCHandler(s)
+
+	w := postJSONRPC(handler, nil, `[{"jsonrpc":"2.0","method":"supervisor.getPID","id":1},{"jsonrpc":"2.0","method":"supervisor.clearLog"},{"jsonrpc":"1.0","method":"supervisor.getPID","id":2}]`)
+	responses := make([]*jsonRPCResponse, 0)
+	if err := json.Unmarshal(w.Body.Bytes(), &responses); err != nil {
+		t.Fatalf("fail to decode the batch response %s: %v", w.Body.String(), err)
+	}
+	if len(responses) != 2 || responses[0].Error != nil || string(responses[1].ID) != "2" || responses[1].Error.Code != jsonRPCInvalidRequest {
+		t.Errorf("fail to call the batch: %s", w.Body.String())
+	}
+	if w = postJSONRPC(handler, nil, `{"jsonrpc":"2.0","method":"supervisor.getPID"}`); w.Code != http.StatusNoContent {
+		t.Error("fail to ignore the response of notification")
+	}
+}
+
+func TestJSONRPCOwners(t *testing.T) {
+	s := startACLTestSupervisor(t)
+	handler := NewXMLRPC().createJSONRPCHandler(s)
+	alice := &AuthUser{Name: "alice", Teams: []string{"web"}}
+
+	response := decodeJSONRPCResponse(t, postJSONRPC(handler, alice, `{"jsonrpc":"2.0","method":"supervisor.stopProcess","params":["db"],"id":1}`))
+	if response.Error == nil || response.Error.Code != 94 {
+		t.Errorf("fail to reject stopping the program of other owner: %v", response.Error)
+	}
+	response = decodeJSONRPCResponse(t, postJSONRPC(handler, alice, `{"jsonrpc":"2.0","method":"supervisor.getAllProcessInfo","id":2}`))
+	infos := make([]map[string]interface{}, 0)
+	json.Unmarshal(response.Result, &infos)
+	if len(infos) != 1 || infos[0]["name"] != "web" {
+		t.Errorf("fail to list only the owned programs: %s", response.Result)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+)
+
+// matchLabels check if the comma separated "key=value" labels match all the
+// selectors, a selector "key=value" requires the label with the value and a
+// selector "key" requires the label with any value
+func matchLabels(labels string, selectors []string) bool {
+	for _, selector := range selectors {
+		if !matchLabel(labels, selector) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchLabel(labels string, selector string) bool {
+	for _, label := range splitList(labels) {
+		if strings.Contains(selector, "=") {
+			if label == selector {
+				return true
+			}
+		} else if strings.HasPrefix(label, selector+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// get the value of the label key, empty if the label is not set
+func getLabelValue(labels string, key string) string {
+	for _, label := range splitList(labels) {
+		if strings.HasPrefix(label, key+"=") {
+			return label[len(key)+1:]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"supervisord/internal/testutil"
+)
+
+// start a supervisord with the programs web and db labelled by team and tier
+// and the program cron without label
+func startLabelTestSupervisor(t *testing.T) *Supervisor {
+	dir := testutil.TempDir(t)
+	command := testutil.FakeProgram(t, dir, testutil.Sleep)
+	content := fmt.Sprintf("[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\nmetrics_labels=team\n\n"+
+		"[program:web]\ncommand=%[2]s\nautostart=false\nlabels=team=web,tier=frontend\n\n"+
+		"[program:db]\ncommand=%[2]s\nautostart=false\nlabels=team=data,tier=\"back end\"\n\n"+
+		"[program:cron]\ncommand=%[2]s\nautostart=false\n",
+		dir, command)
+	s := NewSupervisor(testutil.WriteFile(t, dir, "supervisord.conf", content))
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to start supervisord: %v", err)
+	}
+	t.Cleanup(func() { s.GetManager().StopAllProcesses() })
+	return s
+}
+
+func TestMatchLabels(t *testing.T) {
+	labels := "team=web,tier=frontend"
+	if !matchLabels(labels, nil) || !matchLabels(labels, []string{"team=web"}) || !matchLabels(labels, []string{"team=web", "tier"}) {
+		t.Error("fail to match the labels")
+	}
+	if matchLabels(labels, []string{"team=data"}) || matchLabels(labels, []string{"team=web", "zone"}) || matchLabels(labels, []string{"team=we"}) {
+		t.Error("fail to reject the labels")
+	}
+}
+
+func TestProcessInfoLabels(t *testing.T) {
+	s := startLabelTestSupervisor(t)
+	rpcc := NewXMLRPC().NewInMemoryClient(s)
+	info, err := rpcc.GetProcessInfo("db")
+	if err != nil || info.Labels != "team=data,tier=back end" {
+		t.Errorf("fail to get the labels of the program: %v %v", info.Labels, err)
+	}
+	if info := getProcessInfo(s.GetManager().Find("cron")); info.Labels != "" {
+		t.Errorf("fail to get the program without labels: %q", info.Labels)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LeaderElection implements the active/standby mode. Several supervisord
+// share a lock file and only the one holding the lock (the leader) starts
+// the programs. The standby tries to get the lock periodically and takes
+// over when the leader exits
+type LeaderElection struct {
+	lockFile string
+	interval time.Duration
+	lock     sync.Mutex
+	file     *os.File
+}
+
+// NewLeaderElection create a LeaderElection with the shared lock file and the interval to retry the lock
+func NewLeaderElection(lockFile string, interval time.Duration) *LeaderElection {
+	return &LeaderElection{lockFile: lockFile, interval: interval}
+}
+
+// IsLeader check if the lock is held by this supervisord
+func (le *LeaderElection) IsLeader() bool {
+	le.lock.Lock()
+	defer le.lock.Unlock()
+	return le.file != nil
+}
+
+// try to get the lock, return true if the lock is held
+func (le *LeaderElection) tryLock() bool {
+	le.lock.Lock()
+	defer le.lock.Unlock()
+	if le.file != nil {
+		return true
+	}
+	f, err := os.OpenFile(le.lockFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		log.WithFields(log.Fields{"file": le.lockFile, log.ErrorKey: err}).Error("fail to open the leader lock file")
+		return false
+	}
+	if err = lockFile(f); err != nil {
+		f.Close()
+		return false
+	}
+	f.Truncate(0)
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	f.Sync()
+	le.file = f
+	return true
+}
+
+// Run get the lock and call onLeader when this supervisord becomes the leader.
+// If the lock is held by another supervisord, it runs in the background until the lock is got
+func (le *LeaderElection) Run(onLeader func()) {
+	if le.tryLock() {
+		log.WithFields(log.Fields{"file": le.lockFile}).Info("become the leader")
+		onLeader()
+		return
+	}
+	log.WithFields(log.Fields{"file": le.lockFile}).Info("the lock is held by another supervisord, run in standby mode")
+	go func() {
+		for !le.tryLock() {
+			time.Sleep(le.interval)
+		}
+		log.WithFields(log.Fields{"file": le.lockFile}).Info("the leader is gone, take over and become the leader")
+		onLeader()
+	}()
+}
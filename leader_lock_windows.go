@@ -0,0 +1,12 @@
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func lockFile(f *os.File) error {
+	return fmt.Errorf("leader lock is not supported on windows")
+}
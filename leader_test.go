@@ -0,0 +1,39 @@
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLeaderElection(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "leader")
+	defer os.RemoveAll(dir)
+	lockFile := filepath.Join(dir, "ha.lock")
+
+	leader := NewLeaderElection(lockFile, 10*time.Millisecond)
+	leaderCh := make(chan bool, 1)
+	leader.Run(func() { leaderCh <- true })
+	if !leader.IsLeader() || len(leaderCh) != 1 {
+		t.Error("fail to become the leader")
+	}
+
+	standbyCh := make(chan bool, 1)
+	standby := NewLeaderElection(lockFile, 10*time.Millisecond)
+	standby.Run(func() { standbyCh <- true })
+	if standby.IsLeader() {
+		t.Error("fail to run in standby mode when the lock is held")
+	}
+
+	// release the lock as the leader exits
+	leader.file.Close()
+	select {
+	case <-standbyCh:
+	case <-time.After(2 * time.Second):
+		t.Error("fail to take over when the leader is gone")
+	}
+}
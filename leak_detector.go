@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the number of reloads the goroutines or open files must grow in a row to be
+// reported as a leak
+const leakReloads = 3
+
+// the goroutines and open files of supervisord after a reload
+type resourceSample struct {
+	// the number of goroutines by the function creating them
+	goroutines map[string]int
+	// the number of open files by their path, nil if they can't be listed
+	files map[string]int
+}
+
+// ReloadLeakDetector track the goroutines and the open files of supervisord
+// across the reloads and warn when they grow at every reload, the resources of
+// the previous configuration are likely not released
+type ReloadLeakDetector struct {
+	lock    sync.Mutex
+	samples []resourceSample
+}
+
+// NewReloadLeakDetector create a ReloadLeakDetector without sample
+func NewReloadLeakDetector() *ReloadLeakDetector {
+	return &ReloadLeakDetector{samples: make([]resourceSample, 0)}
+}
+
+// count the goroutines by the function creating them, "main" for the main goroutine
+func countGoroutines() map[string]int {
+	result := make(map[string]int)
+	for _, stack := range strings.Split(dumpGoroutines(), "\n\n") {
+		creator := "main"
+		for _, line := range strings.Split(stack, "\n") {
+			if strings.HasPrefix(line, "created by ") {
+				creator = strings.TrimPrefix(line, "created by ")
+				if pos := strings.Index(creator, " in goroutine "); pos != -1 {
+					creator = creator[0:pos]
+				}
+			}
+		}
+		if strings.TrimSpace(stack) != "" {
+			result[creator]++
+		}
+	}
+	return result
+}
+
+// count the open files of supervisord by their path, nil if the open files
+// can't be listed (only linux is supported)
+func countOpenFiles() map[string]int {
+	dir := "/proc/self/fd"
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	result := make(map[string]int)
+	for _, fileInfo := range fileInfos {
+		// the descriptor used to read the directory is closed and skipped
+		if target, err := os.Readlink(filepath.Join(dir, fileInfo.Name())); err == nil {
+			result[target]++
+		}
+	}
+	return result
+}
+
+// sum the counts
+func sumCounts(counts map[string]int) int {
+	n := 0
+	for _, count := range counts {
+		n += count
+	}
+	return n
+}
+
+// check if the totals of the counts grow at every sample
+func isGrowing(samples []map[string]int) bool {
+	for i := 1; i < len(samples); i++ {
+		if samples[i] == nil || samples[i-1] == nil || sumCounts(samples[i]) <= sumCounts(samples[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// describe the counts grown between two samples, like "process.(*Process).run +2"
+func diffCounts(before map[string]int, after map[string]int) string {
+	diffs := make([]string, 0)
+	for key, count := range after {
+		if count > before[key] {
+			diffs = append(diffs, fmt.Sprintf("%s +%d", key, count-before[key]))
+		}
+	}
+	sort.Strings(diffs)
+	return strings.Join(diffs, ", ")
+}
+
+// record the goroutines and open files after a reload and warn if they grow
+// at every one of the last reloads
+func (d *ReloadLeakDetector) record() {
+	d.add(resourceSample{goroutines: countGoroutines(), files: countOpenFiles()})
+}
+
+// add the sample of the resources after a reload
+func (d *ReloadLeakDetector) add(sample resourceSample) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.samples = append(d.samples, sample)
+	if len(d.samples) > leakReloads+1 {
+		d.samples = d.samples[len(d.samples)-leakReloads-1:]
+	}
+	if len(d.samples) <= leakReloads {
+		return
+	}
+	goroutines := make([]map[string]int, 0, len(d.samples))
+	files := make([]map[string]int, 0, len(d.samples))
+	for _, s := range d.samples {
+		goroutines = append(goroutines, s.goroutines)
+		files = append(files, s.files)
+	}
+	first := d.samples[0]
+	if isGrowing(goroutines) {
+		log.WithFields(log.Fields{"reloads": leakReloads, "before": sumCounts(first.goroutines), "after": sumCounts(sample.goroutines)}).
+			Warnf("the goroutines grow at every reload: %s", diffCounts(first.goroutines, sample.goroutines))
+	}
+	if isGrowing(files) {
+		log.WithFields(log.Fields{"reloads": leakReloads, "before": sumCounts(first.files), "after": sumCounts(sample.files)}).
+			Warnf("the open files grow at every reload: %s", diffCounts(first.files, sample.files))
+	}
+}
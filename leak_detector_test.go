@@ -0,0 +1,57 @@
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"supervisord/internal/testutil"
+
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestReloadLeakDetector(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	d := NewReloadLeakDetector()
+	for i := 0; i <= leakReloads; i++ {
+		d.add(resourceSample{goroutines: map[string]int{"main": 1, "main.(*XMLRPC).startHTTPServer": i},
+			files: map[string]int{"/tmp/supervisord.log": 1}})
+	}
+	warnings := make([]string, 0)
+	for _, entry := range hook.AllEntries() {
+		warnings = append(warnings, entry.Message)
+	}
+	if len(warnings) != 1 || warnings[0] != "the goroutines grow at every reload: main.(*XMLRPC).startHTTPServer +3" {
+		t.Errorf("fail to warn only the goroutines growing at every reload: %v", warnings)
+	}
+	if counts := countGoroutines(); counts["main"] == 0 || sumCounts(counts) < 2 {
+		t.Errorf("fail to count the goroutines: %v", counts)
+	}
+}
+
+func TestReloadReleaseResources(t *testing.T) {
+	if countOpenFiles() == nil {
+		t.Skip("the open files can't be listed")
+	}
+	dir := testutil.TempDir(t)
+	logFile := filepath.Join(dir, "supervisord.log")
+	content := fmt.Sprintf("[supervisord]\nlogfile=%[1]s\npidfile=%[2]s/supervisord.pid\n\n[unix_http_server]\nfile=%[2]s/supervisord.sock\n",
+		logFile, dir)
+	s := NewSupervisor(testutil.WriteFile(t, dir, "supervisord.conf", content))
+	defer s.xmlRPC.Stop()
+	for i := 0; i < 5; i++ {
+		if _, _, _, err := s.Reload(); err != nil {
+			t.Fatalf("fail to reload supervisord: %v", err)
+		}
+	}
+	if n := countOpenFiles()[logFile]; n != 1 {
+		t.Errorf("fail to close the log file of the previous configuration, it is opened %d times", n)
+	}
+	if n := countGoroutines()["main.(*Supervisor).startHTTPServer"]; n > 1 {
+		t.Errorf("fail to stop the http server of the previous configuration, %d are running", n)
+	}
+}
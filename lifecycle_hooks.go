@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ochinchina/supervisord/logger"
+	"github.com/ochinchina/supervisord/process"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// StartHook the hook executed after supervisord is started
+	StartHook = "on_start_command"
+
+	// ReloadHook the hook executed after the configuration is reloaded
+	ReloadHook = "on_reload_command"
+
+	// ShutdownHook the hook executed before supervisord stops all the programs and exits
+	ShutdownHook = "on_shutdown_command"
+)
+
+// the last bytes of the output of a hook command kept to be logged
+const hookOutputBytes = 64 * 1024
+
+// runLifecycleHook run the command configured by the hook key in [supervisord] section
+//
+// The hook command is executed synchronously and at most "hook_timeout" seconds (30 by default),
+// only the last 64KB of its output are logged.
+// Following environment variables are passed to the command:
+//
+//	SUPERVISOR_HOOK       - one of start, reload or shutdown
+//	SUPERVISOR_PID        - the pid of supervisord
+//	SUPERVISOR_IDENTIFIER - the identifier of supervisord
+func (s *Supervisor) runLifecycleHook(hook string) error {
+	supervisordConf, ok := s.config.GetSupervisord()
+	if !ok {
+		return nil
+	}
+	command := supervisordConf.GetString(hook, "")
+	if command == "" {
+		return nil
+	}
+	args, err := process.ParseCommand(command)
+	if err != nil {
+		log.WithFields(log.Fields{"hook": hook, log.ErrorKey: err}).Error("fail to parse the hook command")
+		return err
+	}
+	timeout := time.Duration(supervisordConf.GetInt("hook_timeout", 30)) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	hookName := strings.TrimSuffix(strings.TrimPrefix(hook, "on_"), "_command")
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("SUPERVISOR_HOOK=%s", hookName),
+		fmt.Sprintf("SUPERVISOR_PID=%d", os.Getpid()),
+		fmt.Sprintf("SUPERVISOR_IDENTIFIER=%s", s.GetSupervisorID()))
+	output := logger.NewRingBuffer(hookOutputBytes)
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	log.WithFields(log.Fields{"hook": hook, "command": command}).Info("run lifecycle hook")
+	err = process.RunCommand(cmd)
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("hook is not finished in %v", timeout)
+	}
+	fields := log.Fields{"hook": hook, "output": strings.TrimSpace(output.String())}
+	if err != nil {
+		fields[log.ErrorKey] = err
+		log.WithFields(fields).Error("fail to run lifecycle hook")
+		return err
+	}
+	log.WithFields(fields).Info("lifecycle hook is finished")
+	return nil
+}
@@ -0,0 +1,62 @@
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"supervisord/internal/testutil"
+
+	"github.com/ochinchina/supervisord/types"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestLifecycleHookOutputLimit(t *testing.T) {
+	dir := testutil.TempDir(t)
+	hookCommand := testutil.WriteFile(t, dir, "hook.sh", "#!/bin/sh\nhead -c 1000000 /dev/zero | tr '\\0' x\necho end\n")
+	os.Chmod(hookCommand, 0755)
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	s := startConfSupervisor(t, dir, fmt.Sprintf(testSupervisordSection+"on_reload_command=%s\n", dir, hookCommand))
+	if err := s.runLifecycleHook(ReloadHook); err != nil {
+		t.Fatalf("fail to run the hook: %v", err)
+	}
+	for _, entry := range hook.AllEntries() {
+		if entry.Message != "lifecycle hook is finished" {
+			continue
+		}
+		if output := entry.Data["output"].(string); len(output) != hookOutputBytes-1 || output[len(output)-3:] != "end" {
+			t.Errorf("fail to keep only the last output of the hook: %d bytes", len(output))
+		}
+		return
+	}
+	t.Error("fail to log the output of the hook")
+}
+
+func TestReloadHookAfterOperation(t *testing.T) {
+	dir := testutil.TempDir(t)
+	marker := filepath.Join(dir, "hook.run")
+	hookCommand := testutil.WriteFile(t, dir, "hook.sh", "#!/bin/sh\ntouch "+marker+"\nexec sleep 1\n")
+	os.Chmod(hookCommand, 0755)
+
+	s := startConfSupervisor(t, dir, fmt.Sprintf(testSupervisordSection+"on_reload_command=%s\n", dir, hookCommand))
+	reloaded := make(chan error, 1)
+	go func() { reloaded <- s.ReloadConfig(nil, nil, &types.ReloadConfigResult{}) }()
+	if !testutil.WaitFor(5*time.Second, func() bool {
+		_, err := os.Stat(marker)
+		return err == nil
+	}) {
+		t.Fatal("fail to run the reload hook")
+	}
+	if name, _ := s.operations.Current(); name != "" {
+		t.Errorf("fail to finish the reload before the hook: %s is running", name)
+	}
+	if err := <-reloaded; err != nil {
+		t.Errorf("fail to reload: %v", err)
+	}
+}
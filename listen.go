@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/ochinchina/supervisord/config"
+)
+
+// the options of a listening socket
+type listenOptions struct {
+	// tcp, tcp4, tcp6 or unix
+	network string
+	address string
+	// set SO_REUSEPORT so that several processes can listen on the same port
+	reusePort bool
+	// the network interface the socket is bound to by SO_BINDTODEVICE
+	bindDevice string
+}
+
+// listen on the address with the socket options
+func (o listenOptions) listen() (net.Listener, error) {
+	lc := net.ListenConfig{}
+	if o.reusePort || o.bindDevice != "" {
+		lc.Control = o.control
+	}
+	return lc.Listen(context.Background(), o.network, o.address)
+}
+
+// normalize the listen address like python supervisor accepts it: "9001",
+// "*:9001", ":9001", "host:9001" or "[::]:9001". The host is empty for all
+// the interfaces
+func normalizeListenAddress(addr string) (string, error) {
+	addr = strings.TrimSpace(addr)
+	host, port := "", addr
+	if strings.Contains(addr, ":") {
+		var err error
+		if host, port, err = net.SplitHostPort(addr); err != nil {
+			return "", fmt.Errorf("invalid listen address %s: %v", addr, err)
+		}
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return "", fmt.Errorf("invalid port of the listen address %s", addr)
+	}
+	if host == "*" {
+		host = ""
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// get the network of the listen address: the IPv6 socket of ipv6 accepts
+// the IPv4 connections if dualStack is set, without ipv6 the socket of all
+// the interfaces accepts both IPv4 and IPv6 connections only if dualStack is set
+func getListenNetwork(address string, ipv6 bool, dualStack bool) (string, string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", "", err
+	}
+	ip := net.ParseIP(host)
+	isIPv6 := ip != nil && ip.To4() == nil
+	switch {
+	case ipv6 && ip != nil && !isIPv6:
+		return "", "", fmt.Errorf("the listen address %s is not an IPv6 address", address)
+	case ipv6 && dualStack:
+		if host == "" {
+			host = "::"
+		}
+		return "tcp", net.JoinHostPort(host, port), nil
+	case ipv6:
+		return "tcp6", address, nil
+	case dualStack:
+		return "tcp", address, nil
+	case isIPv6:
+		return "tcp6", address, nil
+	default:
+		return "tcp4", address, nil
+	}
+}
+
+// get the listen options of the inet_http_server section from its port,
+// ipv6, dual_stack, reuseport and bind_device
+func getInetListenOptions(entry *config.Entry) (listenOptions, error) {
+	address, err := normalizeListenAddress(entry.GetString("port", ""))
+	if err != nil {
+		return listenOptions{}, err
+	}
+	network, address, err := getListenNetwork(address, entry.GetBool("ipv6", false), entry.GetBool("dual_stack", true))
+	if err != nil {
+		return listenOptions{}, err
+	}
+	return listenOptions{network: network,
+		address:    address,
+		reusePort:  entry.GetBool("reuseport", false),
+		bindDevice: entry.GetString("bind_device", "")}, nil
+}
@@ -0,0 +1,27 @@
+// +build linux
+
+package main
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// set the socket options before the socket is bound
+func (o listenOptions) control(network string, address string, c syscall.RawConn) error {
+	var err error
+	if controlErr := c.Control(func(fd uintptr) {
+		if o.reusePort {
+			if err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+				return
+			}
+		}
+		if o.bindDevice != "" {
+			err = unix.BindToDevice(int(fd), o.bindDevice)
+		}
+	}); controlErr != nil {
+		return controlErr
+	}
+	return err
+}
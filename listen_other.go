@@ -0,0 +1,12 @@
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func (o listenOptions) control(network string, address string, c syscall.RawConn) error {
+	return fmt.Errorf("reuseport and bind_device are only supported on linux")
+}
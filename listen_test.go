@@ -0,0 +1,70 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestNormalizeListenAddress(t *testing.T) {
+	for addr, expect := range map[string]string{"9001": ":9001",
+		"*:9001":         ":9001",
+		":9001":          ":9001",
+		"127.0.0.1:9001": "127.0.0.1:9001",
+		" [::]:9001 ":    "[::]:9001",
+		"[::1]:9001":     "[::1]:9001",
+		"localhost:9001": "localhost:9001"} {
+		if normalized, err := normalizeListenAddress(addr); err != nil || normalized != expect {
+			t.Errorf("fail to normalize %q: %q %v", addr, normalized, err)
+		}
+	}
+	for _, addr := range []string{"", "abc", "*:http", ":70000", "::1:9001"} {
+		if normalized, err := normalizeListenAddress(addr); err == nil {
+			t.Errorf("the invalid address %q is normalized to %q", addr, normalized)
+		}
+	}
+}
+
+func TestGetListenNetwork(t *testing.T) {
+	for _, test := range []struct {
+		address   string
+		ipv6      bool
+		dualStack bool
+		network   string
+		listen    string
+	}{{":9001", false, true, "tcp", ":9001"},
+		{":9001", false, false, "tcp4", ":9001"},
+		{"[::]:9001", false, false, "tcp6", "[::]:9001"},
+		{":9001", true, true, "tcp", "[::]:9001"},
+		{":9001", true, false, "tcp6", ":9001"},
+		{"127.0.0.1:9001", false, false, "tcp4", "127.0.0.1:9001"}} {
+		network, listen, err := getListenNetwork(test.address, test.ipv6, test.dualStack)
+		if err != nil || network != test.network || listen != test.listen {
+			t.Errorf("wrong network of %v: %s %s %v", test, network, listen, err)
+		}
+	}
+	if _, _, err := getListenNetwork("127.0.0.1:9001", true, true); err == nil {
+		t.Error("fail to refuse the IPv4 address with ipv6")
+	}
+}
+
+func TestListenReusePort(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reuseport is only supported on linux")
+	}
+	options := listenOptions{network: "tcp4", address: "127.0.0.1:0", reusePort: true}
+	first, err := options.listen()
+	if err != nil {
+		t.Fatalf("fail to listen with SO_REUSEPORT: %v", err)
+	}
+	defer first.Close()
+	options.address = first.Addr().String()
+	second, err := options.listen()
+	if err != nil {
+		t.Fatalf("fail to listen on the same port with SO_REUSEPORT: %v", err)
+	}
+	second.Close()
+	if second, err := (listenOptions{network: "tcp4", address: options.address}).listen(); err == nil {
+		second.Close()
+		t.Error("the port is reused without SO_REUSEPORT")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ochinchina/supervisord/xmlrpcclient"
+)
+
+// LoadTestCommand implements flags.Commander interface
+type LoadTestCommand struct {
+	ServerURL string        `short:"s" long:"serverurl" description:"the supervisord server to test, an embedded supervisord with --programs programs is started if it is empty"`
+	User      string        `short:"u" long:"user" description:"the user name" default:"admin"`
+	Password  string        `short:"P" long:"password" description:"the password" default:"admin"`
+	Programs  int           `long:"programs" description:"the number of programs of the embedded supervisord" default:"1000"`
+	Autostart bool          `long:"autostart" description:"start the programs of the embedded supervisord"`
+	Clients   int           `short:"c" long:"clients" description:"the number of clients calling the method in parallel" default:"10"`
+	Duration  time.Duration `short:"d" long:"duration" description:"the duration of the test" default:"10s"`
+	Method    string        `short:"m" long:"method" description:"the method called by the clients" choice:"getAllProcessInfo" choice:"getProcessInfo" choice:"getState" default:"getAllProcessInfo"`
+}
+
+var loadTestCommand LoadTestCommand
+
+// the result of the calls of all the clients
+type loadTestResult struct {
+	sync.Mutex
+	latencies []time.Duration
+	errors    int
+	lastError error
+}
+
+// Execute call the method with the clients in parallel and print the throughput and latencies
+func (x *LoadTestCommand) Execute(args []string) error {
+	return exitOnError(x.run())
+}
+
+func (x *LoadTestCommand) run() error {
+	if x.Clients <= 0 {
+		return fmt.Errorf("invalid number of clients %d", x.Clients)
+	}
+	serverURL := x.ServerURL
+	programs := make([]string, 0)
+	if serverURL == "" {
+		s, url, err := startEmbeddedSupervisor("supervisord-loadtest", x.config)
+		if err != nil {
+			return err
+		}
+		defer s.GetManager().StopAllProcesses()
+		serverURL = url
+	}
+	rpcc := x.newClient(serverURL)
+	infos, err := rpcc.GetAllProcessInfo()
+	if err != nil {
+		return err
+	}
+	for _, info := range infos.Value {
+		programs = append(programs, info.GetFullName())
+	}
+	if x.Method == "getProcessInfo" && len(programs) == 0 {
+		return fmt.Errorf("no program to get the process info")
+	}
+
+	result := &loadTestResult{}
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(x.Duration)
+	for i := 0; i < x.Clients; i++ {
+		wg.Add(1)
+		go func(client int) {
+			defer wg.Done()
+			rpcc := x.newClient(serverURL)
+			latencies := make([]time.Duration, 0)
+			errors := 0
+			var lastError error
+			for n := client; time.Now().Before(deadline); n += x.Clients {
+				start := time.Now()
+				var err error
+				switch x.Method {
+				case "getAllProcessInfo":
+					_, err = rpcc.GetAllProcessInfo()
+				case "getProcessInfo":
+					_, err = rpcc.GetProcessInfo(programs[n%len(programs)])
+				default:
+					_, err = rpcc.GetState()
+				}
+				latencies = append(latencies, time.Since(start))
+				if err != nil {
+					errors++
+					lastError = err
+				}
+			}
+			result.Lock()
+			defer result.Unlock()
+			result.latencies = append(result.latencies, latencies...)
+			result.errors += errors
+			if lastError != nil {
+				result.lastError = lastError
+			}
+		}(i)
+	}
+	wg.Wait()
+	result.write(os.Stdout, x.Method, len(programs), x.Clients, x.Duration)
+	if result.errors > 0 {
+		return fmt.Errorf("%d calls failed, the last error: %v", result.errors, result.lastError)
+	}
+	return nil
+}
+
+func (x *LoadTestCommand) newClient(serverURL string) *xmlrpcclient.XMLRPCClient {
+	rpcc := xmlrpcclient.NewXMLRPCClient(serverURL, false)
+	rpcc.SetUser(x.User)
+	rpcc.SetPassword(x.Password)
+	rpcc.SetTimeout(30 * time.Second)
+	return rpcc
+}
+
+// the configuration of the embedded supervisord with the sleeping programs
+func (x *LoadTestCommand) config(address string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[inet_http_server]\nport=%s\nusername=%s\npassword=%s\n\n", address, x.User, x.Password)
+	for i := 0; i < x.Programs; i++ {
+		fmt.Fprintf(&b, "[program:prog%04d]\ncommand=/bin/sleep 86400\nautostart=%v\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n\n", i, x.Autostart)
+	}
+	return b.String()
+}
+
+// write the throughput and the latency percentiles
+func (r *loadTestResult) write(w io.Writer, method string, programs int, clients int, duration time.Duration) {
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	n := len(r.latencies)
+	fmt.Fprintf(w, "%s with %d programs, %d clients, %v\n", method, programs, clients, duration)
+	fmt.Fprintf(w, "calls: %d, errors: %d, %.1f calls/s\n", n, r.errors, float64(n)/duration.Seconds())
+	if n == 0 {
+		return
+	}
+	percentile := func(p int) time.Duration {
+		return r.latencies[(n-1)*p/100]
+	}
+	fmt.Fprintf(w, "latency p50: %v, p90: %v, p99: %v, max: %v\n", percentile(50), percentile(90), percentile(99), r.latencies[n-1])
+}
+
+func init() {
+	parser.AddCommand("loadtest",
+		"call the XML-RPC methods of supervisord with many clients",
+		"The loadtest subcommand calls getAllProcessInfo, getProcessInfo or getState with many clients in parallel for a duration and reports the throughput and latencies, an embedded supervisord with many programs is tested if no server url is given",
+		&loadTestCommand)
+}
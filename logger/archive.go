@@ -0,0 +1,200 @@
+package logger
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ArchiveSuffix the suffix of the rotated log files waiting to be archived
+const ArchiveSuffix = ".archive-"
+
+// the delay before retrying a failed upload, doubled until maxArchiveRetryDelay
+const archiveRetryDelay = 10 * time.Second
+const maxArchiveRetryDelay = 5 * time.Minute
+
+// ArchiveOptions the object storage where the rotated log files are archived
+type ArchiveOptions struct {
+	// s3://bucket/prefix or gs://bucket/prefix
+	URL string
+	// the endpoint of the S3 compatible API, https://s3.<region>.amazonaws.com
+	// for s3:// and https://storage.googleapis.com for gs:// by default
+	Endpoint     string
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// Archiver upload the rotated log files to the object storage and remove them
+// once they are uploaded. The failed uploads are retried until they succeed
+type Archiver struct {
+	uploader *s3Uploader
+	prefix   string
+	lock     sync.Mutex
+	// the files waiting to be uploaded in order
+	queue   []string
+	pending map[string]bool
+	wake    chan struct{}
+	// the delay before retrying the first failed upload
+	retryDelay time.Duration
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+var archiversLock sync.Mutex
+var archivers = make(map[ArchiveOptions]*Archiver)
+
+// GetArchiver get the archiver uploading to the object storage, the archiver
+// is shared by all the loggers with the same options
+func GetArchiver(options ArchiveOptions) (*Archiver, error) {
+	archiversLock.Lock()
+	defer archiversLock.Unlock()
+	if archiver, ok := archivers[options]; ok {
+		return archiver, nil
+	}
+	archiver, err := newArchiver(options, archiveRetryDelay)
+	if err != nil {
+		return nil, err
+	}
+	archivers[options] = archiver
+	go archiver.run()
+	return archiver, nil
+}
+
+func newArchiver(options ArchiveOptions, retryDelay time.Duration) (*Archiver, error) {
+	u, err := url.Parse(options.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid archive url %s", options.URL)
+	}
+	uploader := &s3Uploader{endpoint: strings.TrimSuffix(options.Endpoint, "/"),
+		bucket:       u.Host,
+		region:       options.Region,
+		accessKey:    options.AccessKey,
+		secretKey:    options.SecretKey,
+		sessionToken: options.SessionToken,
+		client:       &http.Client{Timeout: 5 * time.Minute}}
+	switch u.Scheme {
+	case "s3":
+		if uploader.region == "" {
+			uploader.region = "us-east-1"
+		}
+		if uploader.endpoint == "" {
+			uploader.endpoint = "https://s3." + uploader.region + ".amazonaws.com"
+		}
+	case "gs":
+		if uploader.region == "" {
+			uploader.region = "auto"
+		}
+		if uploader.endpoint == "" {
+			uploader.endpoint = "https://storage.googleapis.com"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported archive url %s, s3:// or gs:// is expected", options.URL)
+	}
+	return &Archiver{uploader: uploader,
+		prefix:     strings.Trim(u.Path, "/"),
+		queue:      make([]string, 0),
+		pending:    make(map[string]bool),
+		wake:       make(chan struct{}, 1),
+		retryDelay: retryDelay,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{})}, nil
+}
+
+// Archive add the file to the upload queue, the file is removed once it is uploaded
+func (a *Archiver) Archive(fileName string) {
+	a.lock.Lock()
+	if !a.pending[fileName] {
+		a.pending[fileName] = true
+		a.queue = append(a.queue, fileName)
+	}
+	a.lock.Unlock()
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (a *Archiver) getKey(fileName string) string {
+	if a.prefix == "" {
+		return filepath.Base(fileName)
+	}
+	return a.prefix + "/" + filepath.Base(fileName)
+}
+
+// get the first file in the queue, empty if the queue is empty
+func (a *Archiver) front() string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if len(a.queue) == 0 {
+		return ""
+	}
+	return a.queue[0]
+}
+
+// remove the first file from the queue and put it at the end if it is not uploaded
+func (a *Archiver) pop(requeue bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	fileName := a.queue[0]
+	a.queue = a.queue[1:]
+	if requeue {
+		a.queue = append(a.queue, fileName)
+	} else {
+		delete(a.pending, fileName)
+	}
+}
+
+// Stop stop uploading the files once the current upload is finished, the
+// files left in the queue are uploaded by the next run
+func (a *Archiver) Stop() {
+	close(a.stop)
+	<-a.done
+}
+
+// upload the files in the queue until they are all uploaded or the archiver
+// is stopped
+func (a *Archiver) run() {
+	defer close(a.done)
+	delay := a.retryDelay
+	for {
+		fileName := a.front()
+		if fileName == "" {
+			select {
+			case <-a.wake:
+			case <-a.stop:
+				return
+			}
+			continue
+		}
+		key := a.getKey(fileName)
+		err := a.uploader.upload(key, fileName)
+		if err == nil || os.IsNotExist(err) {
+			if err == nil {
+				log.WithFields(log.Fields{"file": fileName, "bucket": a.uploader.bucket, "key": key}).Info("the rotated log file is archived")
+				os.Remove(fileName)
+			}
+			a.pop(false)
+			delay = a.retryDelay
+			continue
+		}
+		log.WithFields(log.Fields{"file": fileName, log.ErrorKey: err}).Warn("fail to archive the rotated log file, retry after ", delay)
+		a.pop(true)
+		select {
+		case <-time.After(delay):
+		case <-a.stop:
+			return
+		}
+		if delay *= 2; delay > maxArchiveRetryDelay {
+			delay = maxArchiveRetryDelay
+		}
+	}
+}
@@ -1,14 +1,18 @@
 package logger
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/ochinchina/supervisord/events"
 	"github.com/ochinchina/supervisord/faults"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 //Logger the log interface to log program stdout/stderr logs to file
@@ -33,8 +37,16 @@ type FileLogger struct {
 	backups         int
 	fileSize        int64
 	file            *os.File
+	appendMode      bool // true if the file is opened with O_APPEND
+	noSplice        bool // true if the log file doesn't support splice(2)
 	logEventEmitter LogEventEmitter
 	locker          sync.Locker
+	// the rotated log file is passed to the hook instead of being kept in the backups
+	rotateHook func(fileName string)
+	// the owner (-1 to keep it) and the permissions (0 to keep them) of the opened log files
+	uid  int
+	gid  int
+	mode os.FileMode
 }
 
 // SysLogger log program stdout/stderr to syslog
@@ -42,6 +54,8 @@ type SysLogger struct {
 	NullLogger
 	logWriter       io.WriteCloser
 	logEventEmitter LogEventEmitter
+	// the lines are sent with their severity if the rules are set
+	severityRules SeverityRules
 }
 
 // NullLogger discard the program stdout/stderr log
@@ -53,8 +67,11 @@ type NullLogger struct {
 type NullLocker struct {
 }
 
-// ChanLogger write log message by channel
+// ChanLogger write log message by channel, the message is dropped if the
+// channel is full so a slow reader never blocks the program output
 type ChanLogger struct {
+	// the bytes of the dropped messages, it is the first field for the 64-bit atomic access
+	dropped uint64
 	channel chan []byte
 }
 
@@ -72,7 +89,9 @@ func NewFileLogger(name string, maxSize int64, backups int, logEventEmitter LogE
 		fileSize:        0,
 		file:            nil,
 		logEventEmitter: logEventEmitter,
-		locker:          locker}
+		locker:          locker,
+		uid:             -1,
+		gid:             -1}
 	logger.openFile(false)
 	return logger
 }
@@ -91,15 +110,62 @@ func (l *FileLogger) openFile(trunc bool) error {
 	fileInfo, err := os.Stat(l.name)
 
 	if trunc || err != nil {
+		l.fileSize = 0
+		l.appendMode = false
 		l.file, err = os.Create(l.name)
 	} else {
 		l.fileSize = fileInfo.Size()
+		l.appendMode = true
 		l.file, err = os.OpenFile(l.name, os.O_RDWR|os.O_APPEND, 0666)
 	}
 	if err != nil {
 		fmt.Printf("Fail to open log file --%s-- with error %v\n", l.name, err)
+		return err
+	}
+	l.setFileOwnership()
+	return nil
+}
+
+// change the owner and the permissions of the opened log file
+func (l *FileLogger) setFileOwnership() {
+	if l.file == nil {
+		return
+	}
+	if l.mode != 0 {
+		if err := l.file.Chmod(l.mode); err != nil {
+			fmt.Printf("Fail to change the mode of log file --%s-- with error %v\n", l.name, err)
+		}
+	}
+	if l.uid >= 0 || l.gid >= 0 {
+		if err := l.file.Chown(l.uid, l.gid); err != nil {
+			fmt.Printf("Fail to change the owner of log file --%s-- with error %v\n", l.name, err)
+		}
+	}
+}
+
+// SetFileOwnership set the owner and the permissions of the log file and of
+// the files created by the rotations, -1 keeps the user or the group and 0
+// keeps the permissions
+func (l *FileLogger) SetFileOwnership(uid int, gid int, mode os.FileMode) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+	l.uid, l.gid, l.mode = uid, gid, mode
+	l.setFileOwnership()
+}
+
+// SetFileOwnership set the owner and the permissions of the files of all the
+// file loggers of the logger
+func SetFileOwnership(logger Logger, uid int, gid int, mode os.FileMode) {
+	switch l := logger.(type) {
+	case *FileLogger:
+		l.SetFileOwnership(uid, gid, mode)
+	case *CompositeLogger:
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		for _, logger := range l.loggers {
+			SetFileOwnership(logger, uid, gid, mode)
+		}
 	}
-	return err
 }
 
 func (l *FileLogger) backupFiles() {
@@ -119,7 +185,10 @@ func (l *FileLogger) ClearCurLogFile() error {
 	l.locker.Lock()
 	defer l.locker.Unlock()
 
-	return l.openFile(true)
+	if err := l.openFile(true); err != nil {
+		return faults.NewFault(faults.Failed, err.Error())
+	}
+	return nil
 }
 
 // ClearAllLogFile clear all the log files
@@ -157,7 +226,9 @@ func (l *FileLogger) ReadLog(offset int64, length int64) (string, error) {
 	defer l.locker.Unlock()
 	f, err := os.Open(l.name)
 
-	if err != nil {
+	if os.IsNotExist(err) {
+		return "", faults.NewFault(faults.NoFile, "NO_FILE")
+	} else if err != nil {
 		return "", faults.NewFault(faults.Failed, "FAILED")
 	}
 	defer f.Close()
@@ -261,20 +332,64 @@ func (l *FileLogger) Write(p []byte) (int, error) {
 	}
 	l.logEventEmitter.emitLogEvent(string(p))
 	l.fileSize += int64(n)
+	return n, l.rotateIfFull()
+}
+
+// rotate the log file to the backups if it reaches the max size
+func (l *FileLogger) rotateIfFull() error {
 	if l.fileSize >= l.maxSize {
 		fileInfo, errStat := os.Stat(l.name)
 		if errStat == nil {
 			l.fileSize = fileInfo.Size()
 		} else {
-			return n, errStat
+			return errStat
 		}
 	}
 	if l.fileSize >= l.maxSize {
 		l.Close()
-		l.backupFiles()
+		if l.rotateHook != nil {
+			l.rotateToHook()
+		} else {
+			l.backupFiles()
+		}
 		l.openFile(true)
 	}
-	return n, err
+	return nil
+}
+
+// move the log file to a unique name and pass it to the rotate hook
+func (l *FileLogger) rotateToHook() {
+	dest := l.name + ArchiveSuffix + time.Now().Format("20060102T150405.000000000")
+	if err := os.Rename(l.name, dest); err == nil {
+		l.rotateHook(dest)
+	}
+}
+
+// SetRotateHook pass the rotated log files to the hook instead of keeping
+// them in the backups, the hook takes the ownership of the files. The rotated
+// files left by the previous hook are passed to the hook immediately
+func (l *FileLogger) SetRotateHook(hook func(fileName string)) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+	l.rotateHook = hook
+	files, _ := filepath.Glob(l.name + ArchiveSuffix + "*")
+	for _, f := range files {
+		hook(f)
+	}
+}
+
+// SetRotateHook set the rotate hook of all the file loggers of the logger
+func SetRotateHook(logger Logger, hook func(fileName string)) {
+	switch l := logger.(type) {
+	case *FileLogger:
+		l.SetRotateHook(hook)
+	case *CompositeLogger:
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		for _, logger := range l.loggers {
+			SetRotateHook(logger, hook)
+		}
+	}
 }
 
 // Close close the file logger
@@ -293,7 +408,19 @@ func (sl *SysLogger) Write(b []byte) (int, error) {
 	if sl.logWriter == nil {
 		return 0, errors.New("not connect to syslog server")
 	}
-	return sl.logWriter.Write(b)
+	writer, ok := sl.logWriter.(severityWriter)
+	if len(sl.severityRules) == 0 || !ok {
+		return sl.logWriter.Write(b)
+	}
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if err := writer.writeSeverity(sl.severityRules.Detect(line), line); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
 }
 
 // Close close the logger
@@ -337,7 +464,7 @@ func (l *NullLogger) ReadTailLog(offset int64, length int64) (string, int64, boo
 
 // ClearCurLogFile close current log file, return error
 func (l *NullLogger) ClearCurLogFile() error {
-	return fmt.Errorf("No log")
+	return faults.NewFault(faults.NoFile, "NO_FILE")
 }
 
 // ClearAllLogFile clear all the lof file, return error
@@ -357,10 +484,20 @@ func (l *ChanLogger) SetPid(pid int) {
 
 // Write write the log to channel
 func (l *ChanLogger) Write(p []byte) (int, error) {
-	l.channel <- p
+	// the writer may reuse p after Write returns
+	select {
+	case l.channel <- append([]byte(nil), p...):
+	default:
+		atomic.AddUint64(&l.dropped, uint64(len(p)))
+	}
 	return len(p), nil
 }
 
+// Dropped get the bytes of the messages dropped because the channel is full
+func (l *ChanLogger) Dropped() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
 // Close close the channel
 func (l *ChanLogger) Close() error {
 	defer func() {
@@ -1,18 +1,56 @@
 package logger
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestWriteSingleLog(t *testing.T) {
-	logger := NewFileLogger("test.log", int64(50), 2, NewNullLogEventEmitter(), NewNullLocker())
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger := NewFileLogger(filepath.Join(dir, "test.log"), int64(50), 2, NewNullLogEventEmitter(), NewNullLocker())
 	for i := 0; i < 10; i++ {
 		logger.Write([]byte(fmt.Sprintf("this is a test %d\n", i)))
 	}
 	logger.Close()
 }
 
+func TestSetFileOwnership(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the permissions of the files are not supported")
+	}
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "test.log")
+	logger := NewLogger("test", name, NewNullLocker(), int64(50), 2, NewNullLogEventEmitter())
+	defer logger.Close()
+	SetFileOwnership(logger, os.Getuid(), os.Getgid(), 0640)
+	if info, err := os.Stat(name); err != nil || info.Mode().Perm() != 0640 {
+		t.Fatalf("fail to change the mode of the log file: %v %v", info, err)
+	}
+	for i := 0; i < 10; i++ {
+		logger.Write([]byte(fmt.Sprintf("this is a test %d\n", i)))
+	}
+	for _, f := range []string{name, name + ".1"} {
+		if info, err := os.Stat(f); err != nil || info.Mode().Perm() != 0640 {
+			t.Errorf("fail to keep the mode of the rotated log file %s: %v %v", f, info, err)
+		}
+	}
+}
+
 func TestSplitLogFile(t *testing.T) {
 	files := splitLogFile(" test1.log, /dev/stdout, test2.log ")
 	if len(files) != 3 {
@@ -29,3 +67,128 @@ func TestSplitLogFile(t *testing.T) {
 	}
 
 }
+
+func TestCopyPipeToFileLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "test.log")
+	cl := NewCompositeLogger([]Logger{NewFileLogger(name, int64(1000), 5, NewNullLogEventEmitter(), NewNullLocker())})
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expect bytes.Buffer
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&expect, "this is a test %d\n", i)
+	}
+	go func() {
+		for _, line := range bytes.SplitAfter(expect.Bytes(), []byte("\n")) {
+			w.Write(line)
+		}
+		w.Close()
+	}()
+	n, err := io.Copy(cl, r)
+	cl.Close()
+	if err != nil || n != int64(expect.Len()) {
+		t.Error("fail to copy the pipe to the file logger")
+	}
+	var content []byte
+	for i := 5; i >= 0; i-- {
+		file := name
+		if i > 0 {
+			file = fmt.Sprintf("%s.%d", name, i)
+		}
+		b, err := ioutil.ReadFile(file)
+		if err == nil {
+			if len(b) > 1000 {
+				t.Error("fail to rotate the log file")
+			}
+			content = append(content, b...)
+		}
+	}
+	if !bytes.Equal(content, expect.Bytes()) {
+		t.Error("fail to write the pipe to the log files")
+	}
+}
+
+func TestCopyPipeToAddedLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "test.log")
+	cl := NewCompositeLogger([]Logger{NewFileLogger(name, int64(1024*1024), 1, NewNullLogEventEmitter(), NewNullLocker())})
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		io.Copy(cl, r)
+		close(done)
+	}()
+	w.Write([]byte("first\n"))
+	for i := 0; i < 100; i++ {
+		if b, _ := ioutil.ReadFile(name); len(b) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ch := make(chan []byte, 10)
+	cl.AddLogger(NewChanLogger(ch))
+	w.Write([]byte("second\n"))
+	w.Close()
+	<-done
+	cl.Close()
+
+	if b, _ := ioutil.ReadFile(name); string(b) != "first\nsecond\n" {
+		t.Error("fail to write the pipe to the log file")
+	}
+	if b := <-ch; string(b) != "second\n" {
+		t.Error("fail to write the pipe to the added logger")
+	}
+}
+
+func TestStalledChanLogger(t *testing.T) {
+	ch := make(chan []byte, 2)
+	chanLogger := NewChanLogger(ch)
+	cl := NewCompositeLogger([]Logger{NewNullLogger(NewNullLogEventEmitter()), chanLogger})
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			cl.Write([]byte("0123456789"))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fail to write the log while the channel is full")
+	}
+	if len(ch) != 2 || chanLogger.Dropped() != 30 {
+		t.Error("fail to drop the log messages of the full channel")
+	}
+}
+
+// the file writes are not delayed by a tail subscriber which never reads
+func BenchmarkFileLoggerWithStalledSubscriber(b *testing.B) {
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileLogger := NewFileLogger(filepath.Join(dir, "test.log"), int64(50*1024*1024), 1, NewNullLogEventEmitter(), NewNullLocker())
+	cl := NewCompositeLogger([]Logger{fileLogger, NewChanLogger(make(chan []byte, 100))})
+	defer cl.Close()
+	line := []byte("this is a line of the program output for the benchmark\n")
+	b.SetBytes(int64(len(line)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cl.Write(line)
+	}
+}
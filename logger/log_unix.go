@@ -15,23 +15,58 @@ func NewSysLogger(name string, logEventEmitter LogEventEmitter) *SysLogger {
 	writer, err := syslog.New(syslog.LOG_DEBUG, name)
 	logger := &SysLogger{logEventEmitter: logEventEmitter}
 	if err == nil {
-		logger.logWriter = writer
+		logger.logWriter = &syslogWriter{writer}
 	}
 	return logger
 }
 
+// syslogWriter send the lines with their severity to syslog
+type syslogWriter struct {
+	*syslog.Writer
+}
+
+func (sw *syslogWriter) writeSeverity(severity Severity, line []byte) error {
+	return writeSyslog(sw.Writer, severity, line)
+}
+
+// write the line with the priority of the severity, with the priority of the
+// writer if the severity is unknown
+func writeSyslog(writer *syslog.Writer, severity Severity, line []byte) error {
+	var err error
+	switch severity {
+	case SeverityCritical:
+		err = writer.Crit(string(line))
+	case SeverityError:
+		err = writer.Err(string(line))
+	case SeverityWarning:
+		err = writer.Warning(string(line))
+	case SeverityInfo:
+		err = writer.Info(string(line))
+	case SeverityDebug:
+		err = writer.Debug(string(line))
+	default:
+		_, err = writer.Write(line)
+	}
+	return err
+}
+
 // BackendSysLogWriter a syslog writer to write the log to syslog in background
 type BackendSysLogWriter struct {
 	network    string
 	raddr      string
 	priority   syslog.Priority
 	tag        string
-	logChannel chan []byte
+	logChannel chan syslogMessage
+}
+
+type syslogMessage struct {
+	severity Severity
+	data     []byte
 }
 
 // NewBackendSysLogWriter create a backgroud running syslog writer
 func NewBackendSysLogWriter(network, raddr string, priority syslog.Priority, tag string) *BackendSysLogWriter {
-	bs := &BackendSysLogWriter{network: network, raddr: raddr, priority: priority, tag: tag, logChannel: make(chan []byte)}
+	bs := &BackendSysLogWriter{network: network, raddr: raddr, priority: priority, tag: tag, logChannel: make(chan syslogMessage)}
 	bs.start()
 	return bs
 }
@@ -40,7 +75,7 @@ func (bs *BackendSysLogWriter) start() {
 	go func() {
 		var writer *syslog.Writer = nil
 		for {
-			b, ok := <-bs.logChannel
+			msg, ok := <-bs.logChannel
 			// if channel is closed
 			if !ok {
 				if writer != nil {
@@ -53,7 +88,7 @@ func (bs *BackendSysLogWriter) start() {
 				writer, _ = syslog.Dial(bs.network, bs.raddr, bs.priority, bs.tag)
 			}
 			if writer != nil {
-				writer.Write(b)
+				writeSyslog(writer, msg.severity, msg.data)
 			}
 
 		}
@@ -62,10 +97,15 @@ func (bs *BackendSysLogWriter) start() {
 
 // Write write data to the backend syslog writer
 func (bs *BackendSysLogWriter) Write(b []byte) (int, error) {
-	bs.logChannel <- b
+	bs.logChannel <- syslogMessage{severity: SeverityUnknown, data: b}
 	return len(b), nil
 }
 
+func (bs *BackendSysLogWriter) writeSeverity(severity Severity, line []byte) error {
+	bs.logChannel <- syslogMessage{severity: severity, data: line}
+	return nil
+}
+
 // Close close the backgroup write channel
 func (bs *BackendSysLogWriter) Close() error {
 	close(bs.logChannel)
@@ -135,7 +175,7 @@ func NewRemoteSysLogger(name string, config string, logEventEmitter LogEventEmit
 	writer, err := syslog.Dial(protocol, fmt.Sprintf("%s:%d", host, port), syslog.LOG_LOCAL7|syslog.LOG_DEBUG, name)
 	logger := &SysLogger{logEventEmitter: logEventEmitter}
 	if writer != nil && err == nil {
-		logger.logWriter = writer
+		logger.logWriter = &syslogWriter{writer}
 	} else {
 		logger.logWriter = NewBackendSysLogWriter(protocol, fmt.Sprintf("%s:%d", host, port), syslog.LOG_LOCAL7|syslog.LOG_DEBUG, name)
 	}
@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"sync"
+)
+
+// RingBuffer keeps the last written bytes in memory, the older bytes are
+// overwritten when the buffer is full
+type RingBuffer struct {
+	lock  sync.Mutex
+	buf   []byte
+	start int
+	full  bool
+}
+
+// NewRingBuffer create a RingBuffer object which keeps at most size bytes
+func NewRingBuffer(size int) *RingBuffer {
+	return &RingBuffer{buf: make([]byte, 0, size)}
+}
+
+// Write append the data to the buffer, never fails
+func (rb *RingBuffer) Write(p []byte) (int, error) {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	n := len(p)
+	size := cap(rb.buf)
+	if size <= 0 {
+		return n, nil
+	}
+	// only the last size bytes are interested
+	if len(p) > size {
+		p = p[len(p)-size:]
+	}
+	for len(p) > 0 {
+		if !rb.full {
+			free := size - len(rb.buf)
+			if len(p) <= free {
+				rb.buf = append(rb.buf, p...)
+				return n, nil
+			}
+			rb.buf = append(rb.buf, p[:free]...)
+			p = p[free:]
+			rb.full = true
+			rb.start = 0
+		}
+		copied := copy(rb.buf[rb.start:], p)
+		p = p[copied:]
+		rb.start = (rb.start + copied) % size
+	}
+	return n, nil
+}
+
+// Bytes get a copy of the bytes kept in the buffer in the written order
+func (rb *RingBuffer) Bytes() []byte {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	result := make([]byte, 0, len(rb.buf))
+	if rb.full {
+		result = append(result, rb.buf[rb.start:]...)
+		return append(result, rb.buf[:rb.start]...)
+	}
+	return append(result, rb.buf...)
+}
+
+// String get the content of the buffer as string
+func (rb *RingBuffer) String() string {
+	return string(rb.Bytes())
+}
+
+// Reset discard all the bytes in the buffer
+func (rb *RingBuffer) Reset() {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	rb.buf = rb.buf[:0]
+	rb.start = 0
+	rb.full = false
+}
@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"testing"
+)
+
+func TestRingBufferNotFull(t *testing.T) {
+	rb := NewRingBuffer(10)
+	rb.Write([]byte("hello"))
+	if rb.String() != "hello" {
+		t.Error("fail to keep the written data")
+	}
+}
+
+func TestRingBufferOverwrite(t *testing.T) {
+	rb := NewRingBuffer(10)
+	rb.Write([]byte("0123456789"))
+	rb.Write([]byte("abc"))
+	if rb.String() != "3456789abc" {
+		t.Errorf("fail to overwrite the oldest data, got %s", rb.String())
+	}
+	rb.Write([]byte("defghijklmnopq"))
+	if rb.String() != "hijklmnopq" {
+		t.Errorf("fail to keep the last data, got %s", rb.String())
+	}
+	for i := 0; i < 7; i++ {
+		rb.Write([]byte{byte('r' + i)})
+	}
+	if rb.String() != "opqrstuvwx" {
+		t.Errorf("fail to keep the data written byte by byte, got %s", rb.String())
+	}
+}
+
+func TestRingBufferReset(t *testing.T) {
+	rb := NewRingBuffer(4)
+	rb.Write([]byte("hello"))
+	rb.Reset()
+	if rb.String() != "" {
+		t.Error("fail to reset the buffer")
+	}
+}
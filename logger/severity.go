@@ -0,0 +1,203 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// the longest part of a log line checked by the severity rules, the rest of
+// a longer line is ignored
+const maxSeverityLineLength = 4096
+
+// Severity the level of a log line detected by the severity rules
+type Severity int
+
+// the severities from the lowest to the highest
+const (
+	// SeverityUnknown no severity rule matches the line
+	SeverityUnknown Severity = iota
+	SeverityDebug
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+	SeverityCritical
+	severityLevels
+)
+
+var severityNames = [severityLevels]string{"unknown", "debug", "info", "warning", "error", "critical"}
+
+func (s Severity) String() string {
+	if s < 0 || s >= severityLevels {
+		return severityNames[SeverityUnknown]
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity get the severity by its name, "warn" and "fatal" are accepted
+// for "warning" and "critical"
+func ParseSeverity(name string) (Severity, error) {
+	switch name = strings.ToLower(strings.TrimSpace(name)); name {
+	case "warn":
+		return SeverityWarning, nil
+	case "fatal":
+		return SeverityCritical, nil
+	}
+	for i, severityName := range severityNames {
+		if name == severityName {
+			return Severity(i), nil
+		}
+	}
+	return SeverityUnknown, fmt.Errorf("invalid severity %s", name)
+}
+
+// Severities get the known severities from the highest to the lowest, the
+// order the severity rules are checked
+func Severities() []Severity {
+	return []Severity{SeverityCritical, SeverityError, SeverityWarning, SeverityInfo, SeverityDebug}
+}
+
+// SeverityRule the lines matching the pattern have the severity
+type SeverityRule struct {
+	Severity Severity
+	Pattern  *regexp.Regexp
+}
+
+// SeverityRules the rules detecting the severity of the log lines, the first
+// matching rule wins
+type SeverityRules []SeverityRule
+
+// Detect get the severity of the log line, SeverityUnknown if no rule matches
+func (rules SeverityRules) Detect(line []byte) Severity {
+	if len(line) > maxSeverityLineLength {
+		line = line[:maxSeverityLineLength]
+	}
+	for _, rule := range rules {
+		if rule.Pattern.Match(line) {
+			return rule.Severity
+		}
+	}
+	return SeverityUnknown
+}
+
+// lineSplitter split the written data to lines, the last incomplete line is
+// kept until the next write
+type lineSplitter struct {
+	partial []byte
+	// true if the partial line is longer than maxSeverityLineLength
+	truncated bool
+}
+
+// split call fn with each complete line of the data without the line feed
+func (ls *lineSplitter) split(p []byte, fn func(line []byte)) {
+	for len(p) > 0 {
+		index := bytes.IndexByte(p, '\n')
+		if index < 0 {
+			ls.keep(p)
+			return
+		}
+		if len(ls.partial) > 0 || ls.truncated {
+			ls.keep(p[:index])
+			fn(ls.partial)
+			ls.partial = ls.partial[:0]
+			ls.truncated = false
+		} else {
+			fn(p[:index])
+		}
+		p = p[index+1:]
+	}
+}
+
+func (ls *lineSplitter) keep(p []byte) {
+	if free := maxSeverityLineLength - len(ls.partial); len(p) > free {
+		p = p[:free]
+		ls.truncated = true
+	}
+	ls.partial = append(ls.partial, p...)
+}
+
+// SeverityCounts count the log lines of a program by severity
+type SeverityCounts struct {
+	counts [severityLevels]uint64
+}
+
+// Get get the number of the lines with the severity
+func (sc *SeverityCounts) Get(severity Severity) uint64 {
+	if severity < 0 || severity >= severityLevels {
+		return 0
+	}
+	return atomic.LoadUint64(&sc.counts[severity])
+}
+
+// Writer create a writer counting the severities of the written lines, a
+// writer is created for each output stream of the program
+func (sc *SeverityCounts) Writer(rules SeverityRules) io.Writer {
+	return &severityCountWriter{rules: rules, counts: sc}
+}
+
+type severityCountWriter struct {
+	lineSplitter
+	rules  SeverityRules
+	counts *SeverityCounts
+}
+
+func (w *severityCountWriter) Write(p []byte) (int, error) {
+	w.split(p, func(line []byte) {
+		atomic.AddUint64(&w.counts.counts[w.rules.Detect(line)], 1)
+	})
+	return len(p), nil
+}
+
+// SeverityFilter write only the complete lines with the min severity or a
+// higher one to the underlying writer, the lines longer than 4096 bytes are
+// truncated
+type SeverityFilter struct {
+	lineSplitter
+	writer      io.Writer
+	rules       SeverityRules
+	minSeverity Severity
+}
+
+// NewSeverityFilter create a SeverityFilter object
+func NewSeverityFilter(writer io.Writer, rules SeverityRules, minSeverity Severity) *SeverityFilter {
+	return &SeverityFilter{writer: writer, rules: rules, minSeverity: minSeverity}
+}
+
+// Write write the complete lines of the data with the min severity, the
+// last incomplete line is kept until the next write
+func (sf *SeverityFilter) Write(p []byte) (int, error) {
+	var err error
+	sf.split(p, func(line []byte) {
+		if err == nil && sf.rules.Detect(line) >= sf.minSeverity {
+			// the line is followed by its line feed or is the partial buffer
+			_, err = sf.writer.Write(append(line, '\n'))
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// severityWriter a writer which sends each line with its severity, like syslog
+type severityWriter interface {
+	writeSeverity(severity Severity, line []byte) error
+}
+
+// SetSeverityRules set the rules detecting the severity of the lines sent to
+// syslog by all the syslog loggers of the logger
+func SetSeverityRules(logger Logger, rules SeverityRules) {
+	switch l := logger.(type) {
+	case *SysLogger:
+		l.severityRules = rules
+	case *CompositeLogger:
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		for _, logger := range l.loggers {
+			SetSeverityRules(logger, rules)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// +build !windows
+
+package logger
+
+import (
+	"bytes"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSeverityRules = SeverityRules{{Severity: SeverityError, Pattern: regexp.MustCompile("^ERROR")},
+	{Severity: SeverityWarning, Pattern: regexp.MustCompile("^WARN")}}
+
+func TestSeverityFilter(t *testing.T) {
+	if s, err := ParseSeverity("Warn"); err != nil || s != SeverityWarning {
+		t.Error("fail to parse the severity")
+	}
+	if _, err := ParseSeverity("loud"); err == nil {
+		t.Error("fail to reject the invalid severity")
+	}
+	buf := bytes.Buffer{}
+	filter := NewSeverityFilter(&buf, testSeverityRules, SeverityWarning)
+	filter.Write([]byte("INFO start\nWA"))
+	filter.Write([]byte("RN slow\nERROR " + strings.Repeat("x", 5000)))
+	filter.Write([]byte("\nINFO done\n"))
+	if lines := strings.Split(buf.String(), "\n"); len(lines) != 3 || lines[0] != "WARN slow" || len(lines[1]) != maxSeverityLineLength {
+		t.Errorf("fail to filter the lines by severity: %q", buf.String())
+	}
+}
+
+func TestSysLogSeverity(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("fail to listen udp")
+	}
+	defer conn.Close()
+	logger := NewRemoteSysLogger("web", conn.LocalAddr().String(), NewNullLogEventEmitter())
+	defer logger.Close()
+	SetSeverityRules(NewCompositeLogger([]Logger{logger}), testSeverityRules)
+	logger.Write([]byte("ERROR failed\nstarted\n"))
+
+	buf := make([]byte, 1024)
+	for _, priority := range []string{"<187>", "<191>"} {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil || !strings.HasPrefix(string(buf[:n]), priority) {
+			t.Errorf("fail to send the line with the priority %s: %q", priority, buf[:n])
+		}
+	}
+}
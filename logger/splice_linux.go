@@ -0,0 +1,148 @@
+package logger
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+const (
+	spliceMove     = 0x1
+	spliceNonblock = 0x2
+	// the max bytes moved by one splice(2) call
+	spliceChunkSize = 1024 * 1024
+)
+
+// ReadFrom implements io.ReaderFrom interface. The program output is copied
+// from the pipe with io.Copy by exec.Cmd, if the only logger is a FileLogger
+// without log events the output is moved from the pipe to the log file by
+// splice(2) without copying it through the user space buffers. Otherwise (or if
+// splice(2) is not supported) the output is read and written to the loggers.
+func (cl *CompositeLogger) ReadFrom(r io.Reader) (n int64, err error) {
+	conn, ok := r.(syscall.Conn)
+	if !ok {
+		return io.Copy(compositeWriter{cl}, r)
+	}
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return io.Copy(compositeWriter{cl}, r)
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		var written int64
+		var spliceErr error
+		spliced := false
+		err = rawConn.Read(func(fd uintptr) bool {
+			cl.lock.Lock()
+			defer cl.lock.Unlock()
+
+			fileLogger := cl.spliceTarget()
+			if fileLogger == nil {
+				return true
+			}
+			written, spliceErr = fileLogger.splice(int(fd))
+			if spliceErr == syscall.EAGAIN {
+				// wait until the pipe is readable
+				return false
+			}
+			if spliceErr == syscall.EINVAL || spliceErr == syscall.ENOSYS {
+				// the log file doesn't support splice(2), write it instead
+				fileLogger.noSplice = true
+				return true
+			}
+			spliced = true
+			return true
+		})
+		if err != nil {
+			return n, err
+		}
+		if spliced {
+			if spliceErr != nil {
+				return n, spliceErr
+			}
+			if written == 0 {
+				return n, nil
+			}
+			n += written
+			continue
+		}
+		m, errRead := r.Read(buf)
+		if m > 0 {
+			if _, err = cl.Write(buf[:m]); err != nil {
+				return n, err
+			}
+			n += int64(m)
+		}
+		if errRead == io.EOF {
+			return n, nil
+		}
+		if errRead != nil {
+			return n, errRead
+		}
+	}
+}
+
+// get the FileLogger if it is the only logger and the output can be spliced to it
+func (cl *CompositeLogger) spliceTarget() *FileLogger {
+	if len(cl.loggers) != 1 {
+		return nil
+	}
+	fileLogger, ok := cl.loggers[0].(*FileLogger)
+	if !ok || fileLogger.noSplice {
+		return nil
+	}
+	// the log events need the output in the user space
+	if _, ok := fileLogger.logEventEmitter.(*NullLogEventEmitter); !ok {
+		return nil
+	}
+	return fileLogger
+}
+
+// splice move the data in the pipe fd to the log file and rotate the log
+// file like Write, the error is syscall.EAGAIN if the pipe is empty
+func (l *FileLogger) splice(fd int) (int64, error) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	if l.file == nil {
+		return 0, syscall.EINVAL
+	}
+	if l.appendMode {
+		// splice(2) doesn't write to the file opened with O_APPEND
+		file, err := os.OpenFile(l.name, os.O_RDWR, 0666)
+		if err != nil {
+			return 0, err
+		}
+		if _, err = file.Seek(0, io.SeekEnd); err != nil {
+			file.Close()
+			return 0, err
+		}
+		l.file.Close()
+		l.file = file
+		l.appendMode = false
+	}
+	size := spliceChunkSize
+	if remain := l.maxSize - l.fileSize; remain > 0 && remain < int64(size) {
+		size = int(remain)
+	}
+	for {
+		n, err := syscall.Splice(fd, nil, int(l.file.Fd()), nil, size, spliceMove|spliceNonblock)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || n == 0 {
+			return n, err
+		}
+		l.fileSize += n
+		return n, l.rotateIfFull()
+	}
+}
+
+// compositeWriter hide the ReadFrom of CompositeLogger from io.Copy
+type compositeWriter struct {
+	cl *CompositeLogger
+}
+
+func (w compositeWriter) Write(p []byte) (int, error) {
+	return w.cl.Write(p)
+}
@@ -1,11 +1,21 @@
+// +build !nohttp
+
 package main
 
 import (
+	"fmt"
+	"io"
+	"net/http"
+
 	"github.com/gorilla/mux"
 	logger "github.com/ochinchina/supervisord/logger"
-	"net/http"
+	log "github.com/sirupsen/logrus"
 )
 
+// the max log messages waiting for a tail client, the newer messages are
+// dropped if the client reads slower than the program writes
+const logtailQueueSize = 100
+
 // Logtail tail the process log through http interface
 type Logtail struct {
 	router     *mux.Router
@@ -17,13 +27,30 @@ func NewLogtail(supervisor *Supervisor) *Logtail {
 	return &Logtail{router: mux.NewRouter(), supervisor: supervisor}
 }
 
-// CreateHandler create http handlers to process the program stdout and stderr through http interface
+// CreateHandler create http handlers to process the program stdout and stderr
+// and the supervisord log through http interface
 func (lt *Logtail) CreateHandler() http.Handler {
 	lt.router.HandleFunc("/logtail/{program}/stdout", lt.getStdoutLog).Methods("GET")
 	lt.router.HandleFunc("/logtail/{program}/stderr", lt.getStderrLog).Methods("GET")
+	lt.router.HandleFunc("/mainlogtail", lt.getMainLog).Methods("GET")
 	return lt.router
 }
 
+// getMainLog tail the supervisord log, only the admin can read it
+func (lt *Logtail) getMainLog(w http.ResponseWriter, req *http.Request) {
+	if err := lt.supervisor.checkAdmin(req, "tail the supervisord log"); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	compositeLogger, ok := lt.supervisor.logger.(*logger.CompositeLogger)
+	if !ok {
+		// supervisord doesn't log to a file
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	tailLog(w, req, compositeLogger, nil, log.Fields{"log": "supervisord"})
+}
+
 func (lt *Logtail) getStdoutLog(w http.ResponseWriter, req *http.Request) {
 	lt.getLog("stdout", w, req)
 }
@@ -39,6 +66,8 @@ func (lt *Logtail) getLog(logType string, w http.ResponseWriter, req *http.Reque
 	proc := procMgr.Find(program)
 	if proc == nil {
 		w.WriteHeader(http.StatusBadRequest)
+	} else if !lt.supervisor.canAccess(req, proc) {
+		w.WriteHeader(http.StatusForbidden)
 	} else {
 		var ok bool = false
 		var compositeLogger *logger.CompositeLogger = nil
@@ -48,26 +77,55 @@ func (lt *Logtail) getLog(logType string, w http.ResponseWriter, req *http.Reque
 			compositeLogger, ok = proc.StderrLog.(*logger.CompositeLogger)
 		}
 		if ok {
-			w.Header().Set("Transfer-Encoding", "chunked")
-			w.WriteHeader(http.StatusOK)
-			flusher, _ := w.(http.Flusher)
-			ch := make(chan []byte, 100)
-			chanLogger := logger.NewChanLogger(ch)
-			compositeLogger.AddLogger(chanLogger)
-			for {
-				text, ok := <-ch
-				if !ok {
-					break
-				}
-				_, err := w.Write(text)
-				if err != nil {
-					break
-				}
-				flusher.Flush()
-			}
-			compositeLogger.RemoveLogger(chanLogger)
-			chanLogger.Close()
+			tailLog(w, req, compositeLogger, proc.GetSeverityRules(), log.Fields{"program": program, "log": logType})
 		}
 	}
 
 }
+
+// tailLog send the log written to the compositeLogger until the client closes
+// the connection. With the "severity" parameter, only the lines with this
+// severity or a higher one detected by the rules are sent
+func tailLog(w http.ResponseWriter, req *http.Request, compositeLogger *logger.CompositeLogger, rules logger.SeverityRules, fields log.Fields) {
+	var out io.Writer = w
+	if severity := req.FormValue("severity"); severity != "" && len(rules) > 0 {
+		minSeverity, err := logger.ParseSeverity(severity)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		out = logger.NewSeverityFilter(w, rules, minSeverity)
+	}
+	w.Header().Set("Transfer-Encoding", "chunked")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	ch := make(chan []byte, logtailQueueSize)
+	chanLogger := logger.NewChanLogger(ch)
+	compositeLogger.AddLogger(chanLogger)
+	var dropped uint64
+	for stop := false; !stop; {
+		select {
+		case text, ok := <-ch:
+			if !ok {
+				stop = true
+				break
+			}
+			if n := chanLogger.Dropped(); n > dropped {
+				fmt.Fprintf(w, "\n[supervisord: %d bytes of log dropped for the slow client]\n", n-dropped)
+				dropped = n
+			}
+			if _, err := out.Write(text); err != nil {
+				stop = true
+				break
+			}
+			flusher.Flush()
+		case <-req.Context().Done():
+			stop = true
+		}
+	}
+	compositeLogger.RemoveLogger(chanLogger)
+	chanLogger.Close()
+	if n := chanLogger.Dropped(); n > 0 {
+		log.WithFields(fields).WithField("dropped", n).Warn("the log tail client is too slow, some log is dropped")
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"fmt"
 	"github.com/jessevdk/go-flags"
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/secret"
 	log "github.com/sirupsen/logrus"
 	"os"
 	"os/signal"
@@ -11,14 +13,20 @@ import (
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 	"unicode"
 )
 
 // Options the command line options
 type Options struct {
-	Configuration string `short:"c" long:"configuration" description:"the configuration file"`
-	Daemon        bool   `short:"d" long:"daemon" description:"run as daemon"`
-	EnvFile       string `long:"env-file" description:"the environment file"`
+	Configuration    string   `short:"c" long:"configuration" description:"the configuration file"`
+	Daemon           bool     `short:"d" long:"daemon" description:"run as daemon (not supported on Windows, see the service subcommand)"`
+	ForegroundHidden bool     `long:"foreground-hidden" description:"run in the foreground detached from the console (Windows only)"`
+	EnvFile          string   `long:"env-file" description:"the environment file"`
+	Profile          []string `long:"profile" description:"load only the programs of the profiles (separated by \",\") and the programs without profiles"`
+	Watch            bool     `long:"watch" description:"restart the programs when the files matching their watch globs change"`
+	Procfile         string   `long:"procfile" description:"run the processes of the Procfile instead of a configuration file"`
+	DefaultsFile     string   `long:"defaults-file" description:"the machine-level defaults file merged under the configuration (defaults to /etc/supervisord/defaults.conf)"`
 }
 
 func init() {
@@ -29,6 +37,7 @@ func init() {
 		log.SetFormatter(&log.TextFormatter{DisableColors: false, FullTimestamp: true})
 	}
 	log.SetLevel(log.DebugLevel)
+	log.AddHook(&secret.LogHook{})
 }
 
 func initSignals(s *Supervisor) {
@@ -37,12 +46,22 @@ func initSignals(s *Supervisor) {
 	go func() {
 		sig := <-sigs
 		log.WithFields(log.Fields{"signal": sig}).Info("receive a signal to stop all process & exit")
-		s.procMgr.StopAllProcesses()
+		stopServer(s)
 		os.Exit(-1)
 	}()
 
 }
 
+// stop all the programs before supervisord exits
+func stopServer(s *Supervisor) {
+	s.setState(supervisorShutdown)
+	s.runLifecycleHook(ShutdownHook)
+	s.procMgr.StopAllProcesses()
+}
+
+// the interval to check the files watched by the programs with --watch
+const sourceWatchInterval = time.Second
+
 var options Options
 var parser = flags.NewParser(&options, flags.Default & ^flags.PrintErrors)
 
@@ -86,18 +105,43 @@ func loadEnvFile() {
 	}
 }
 
+// the name of the project-local configuration file
+const projectConfName = ".supervisord.conf"
+
+// find the project-local configuration file in the current directory and its
+// parents, empty if it is not found
+func findProjectConf() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		file := filepath.Join(dir, projectConfName)
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
 // find the supervisord.conf in following order:
 //
 // 1. $CWD/supervisord.conf
 // 2. $CWD/etc/supervisord.conf
-// 3. /etc/supervisord.conf
-// 4. /etc/supervisor/supervisord.conf (since Supervisor 3.3.0)
-// 5. ../etc/supervisord.conf (Relative to the executable)
-// 6. ../supervisord.conf (Relative to the executable)
+// 3. .supervisord.conf in $CWD or its parent directories (the project-local configuration)
+// 4. /etc/supervisord.conf
+// 5. /etc/supervisor/supervisord.conf (since Supervisor 3.3.0)
+// 6. ../etc/supervisord.conf (Relative to the executable)
+// 7. ../supervisord.conf (Relative to the executable)
 func findSupervisordConf() (string, error) {
 	possibleSupervisordConf := []string{options.Configuration,
 		"./supervisord.conf",
 		"./etc/supervisord.conf",
+		findProjectConf(),
 		"/etc/supervisord.conf",
 		"/etc/supervisor/supervisord.conf",
 		"../etc/supervisord.conf",
@@ -117,24 +161,35 @@ func findSupervisordConf() (string, error) {
 }
 
 func runServer() {
-	// infinite loop for handling Restart ('reload' command)
+	startServer().WaitForExit()
+}
+
+// load the configuration and start the supervisor
+func startServer() *Supervisor {
 	loadEnvFile()
-	for true {
-		if len(options.Configuration) <= 0 {
-			options.Configuration, _ = findSupervisordConf()
-		}
-		s := NewSupervisor(options.Configuration)
-		initSignals(s)
-		if _, _, _, sErr := s.Reload(); sErr != nil {
-			panic(sErr)
-		}
-		s.WaitForExit()
+	if len(options.Procfile) > 0 {
+		config.SetProcfile(options.Procfile)
+		options.Configuration = options.Procfile
+	}
+	if len(options.Configuration) <= 0 {
+		options.Configuration, _ = findSupervisordConf()
+	}
+	config.SetActiveProfiles(options.Profile)
+	setDefaultsFile()
+	s := NewSupervisor(options.Configuration)
+	initSignals(s)
+	if _, _, _, sErr := s.Reload(); sErr != nil {
+		// don't crash-loop on a broken configuration, stay DEGRADED until it is fixed
+		go s.reloadUntilLoaded(10 * time.Second)
 	}
+	s.runLifecycleHook(StartHook)
+	if options.Watch {
+		go s.GetManager().WatchSources(sourceWatchInterval)
+	}
+	return s
 }
 
 func main() {
-	ReapZombie()
-
 	if _, err := parser.Parse(); err != nil {
 		flagsErr, ok := err.(*flags.Error)
 		if ok {
@@ -143,9 +198,14 @@ func main() {
 				fmt.Fprintln(os.Stdout, err)
 				os.Exit(0)
 			case flags.ErrCommandRequired:
-				if options.Daemon {
+				switch {
+				case options.Daemon:
 					Deamonize(runServer)
-				} else {
+				case options.ForegroundHidden:
+					runForegroundHidden(runServer)
+				case runsAsService():
+					runService()
+				default:
 					runServer()
 				}
 			default:
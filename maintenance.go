@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/process"
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// the events suppressed by default in the maintenance windows, the ones
+// raising alerts in "ctl watch"
+const defaultSuppressedEvents = "PROCESS_STATE_EXITED,PROCESS_STATE_BACKOFF,PROCESS_STATE_FATAL"
+
+// the interval to check the schedules of the maintenance windows
+const maintenanceCheckInterval = 10 * time.Second
+
+// the maintenance window defined in the [maintenance:<name>] section
+type maintenanceConfig struct {
+	name             string
+	schedule         cron.Schedule // nil if the window is only entered through the API
+	duration         time.Duration
+	groups           []string
+	suppressRestarts bool
+	suppressEvents   []string
+}
+
+// MaintenanceScheduler enter and exit the maintenance windows on their
+// schedule or through the API
+type MaintenanceScheduler struct {
+	lock    sync.Mutex
+	configs map[string]*maintenanceConfig
+	// the windows entered through the API
+	manual map[string]process.MaintenanceWindow
+	// the end of the scheduled windows exited through the API
+	exited map[string]time.Time
+	// the windows in progress, to log the changes
+	active    map[string]bool
+	startOnce sync.Once
+	// expand the groups to their nested groups
+	expandGroup func(group string) []string
+}
+
+// NewMaintenanceScheduler create an empty MaintenanceScheduler
+func NewMaintenanceScheduler() *MaintenanceScheduler {
+	return &MaintenanceScheduler{configs: make(map[string]*maintenanceConfig),
+		manual:      make(map[string]process.MaintenanceWindow),
+		exited:      make(map[string]time.Time),
+		active:      make(map[string]bool),
+		expandGroup: func(group string) []string { return []string{group} }}
+}
+
+// parse the [maintenance:<name>] sections
+func parseMaintenanceConfigs(cfg *config.Config) (map[string]*maintenanceConfig, error) {
+	configs := make(map[string]*maintenanceConfig)
+	for _, entry := range cfg.GetEntries(func(entry *config.Entry) bool { return strings.HasPrefix(entry.Name, "maintenance:") }) {
+		mc := &maintenanceConfig{name: entry.Name[len("maintenance:"):],
+			groups:           splitList(entry.GetString("groups", "")),
+			suppressRestarts: entry.GetBool("suppress_restarts", true),
+			suppressEvents:   splitList(entry.GetString("suppress_events", defaultSuppressedEvents))}
+		var err error
+		if mc.duration, err = time.ParseDuration(entry.GetString("duration", "1h")); err != nil || mc.duration <= 0 {
+			return nil, &config.SectionError{Section: entry.Name, Err: fmt.Errorf("invalid duration %q", entry.GetString("duration", ""))}
+		}
+		if schedule := entry.GetString("schedule", ""); schedule != "" {
+			if mc.schedule, err = cron.ParseStandard(schedule); err != nil {
+				return nil, &config.SectionError{Section: entry.Name, Err: fmt.Errorf("invalid schedule %q: %v", schedule, err)}
+			}
+		}
+		configs[mc.name] = mc
+	}
+	return configs, nil
+}
+
+// load the maintenance windows of the configuration and start checking
+// their schedules
+func (ms *MaintenanceScheduler) load(cfg *config.Config) {
+	configs, err := parseMaintenanceConfigs(cfg)
+	if err != nil {
+		log.WithFields(log.Fields{log.ErrorKey: err}).Error("fail to load the maintenance windows")
+		return
+	}
+	ms.lock.Lock()
+	ms.configs = configs
+	ms.expandGroup = cfg.ProgramGroup.ExpandGroup
+	ms.lock.Unlock()
+	ms.update(time.Now())
+	if len(configs) > 0 {
+		ms.startOnce.Do(func() {
+			go func() {
+				for now := range time.Tick(maintenanceCheckInterval) {
+					ms.update(now)
+				}
+			}()
+		})
+	}
+}
+
+// get the window of the configuration starting at start
+func (ms *MaintenanceScheduler) createWindow(mc *maintenanceConfig, start time.Time, end time.Time, manual bool) process.MaintenanceWindow {
+	groups := make([]string, 0)
+	for _, group := range mc.groups {
+		groups = append(groups, ms.expandGroup(group)...)
+	}
+	return process.MaintenanceWindow{Name: mc.name,
+		Groups:           groups,
+		Start:            start,
+		End:              end,
+		SuppressRestarts: mc.suppressRestarts,
+		SuppressEvents:   mc.suppressEvents,
+		Manual:           manual}
+}
+
+// update the maintenance windows in progress at the time now
+func (ms *MaintenanceScheduler) update(now time.Time) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	windows := make([]process.MaintenanceWindow, 0)
+	for name, window := range ms.manual {
+		if now.Before(window.End) {
+			windows = append(windows, window)
+		} else {
+			delete(ms.manual, name)
+		}
+	}
+	for name, mc := range ms.configs {
+		if _, ok := ms.manual[name]; ok || mc.schedule == nil {
+			continue
+		}
+		// the last start of the window if it is not finished
+		start := mc.schedule.Next(now.Add(-mc.duration))
+		end := start.Add(mc.duration)
+		if start.After(now) {
+			continue
+		}
+		if exitedEnd, ok := ms.exited[name]; ok && !now.After(exitedEnd) {
+			continue
+		}
+		delete(ms.exited, name)
+		windows = append(windows, ms.createWindow(mc, start, end, false))
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].Name < windows[j].Name })
+
+	active := make(map[string]bool)
+	for _, window := range windows {
+		active[window.Name] = true
+		if !ms.active[window.Name] {
+			log.WithFields(log.Fields{"maintenance": window.Name, "groups": strings.Join(window.Groups, ","), "end": window.End.Format(time.RFC3339)}).Info("enter the maintenance window")
+		}
+	}
+	for name := range ms.active {
+		if !active[name] {
+			log.WithFields(log.Fields{"maintenance": name}).Info("exit the maintenance window")
+		}
+	}
+	ms.active = active
+	process.SetMaintenanceWindows(windows)
+}
+
+// enter the maintenance window for the duration, the duration of its
+// configuration is used if it is 0
+func (ms *MaintenanceScheduler) enter(name string, duration time.Duration) (process.MaintenanceWindow, error) {
+	ms.lock.Lock()
+	mc, ok := ms.configs[name]
+	if !ok {
+		ms.lock.Unlock()
+		return process.MaintenanceWindow{}, fmt.Errorf("no maintenance window %s", name)
+	}
+	if duration <= 0 {
+		duration = mc.duration
+	}
+	now := time.Now()
+	window := ms.createWindow(mc, now, now.Add(duration), true)
+	ms.manual[name] = window
+	delete(ms.exited, name)
+	ms.lock.Unlock()
+	ms.update(now)
+	return window, nil
+}
+
+// exit the maintenance window, the scheduled window is entered again at its
+// next schedule
+func (ms *MaintenanceScheduler) exit(name string) error {
+	now := time.Now()
+	ms.lock.Lock()
+	mc, ok := ms.configs[name]
+	if !ok {
+		ms.lock.Unlock()
+		return fmt.Errorf("no maintenance window %s", name)
+	}
+	delete(ms.manual, name)
+	if mc.schedule != nil {
+		if start := mc.schedule.Next(now.Add(-mc.duration)); !start.After(now) {
+			ms.exited[name] = start.Add(mc.duration)
+		}
+	}
+	ms.lock.Unlock()
+	ms.update(now)
+	return nil
+}
+
+// MaintenanceInfo the maintenance window configured and its state
+type MaintenanceInfo struct {
+	Name     string   `json:"name"`
+	Schedule string   `json:"schedule"`
+	Duration string   `json:"duration"`
+	Groups   []string `json:"groups"`
+	// the window in progress, nil if the window is not entered
+	Active *process.MaintenanceWindow `json:"active"`
+}
+
+// list the maintenance windows configured and their state sorted by name
+func (ms *MaintenanceScheduler) list(cfg *config.Config) []MaintenanceInfo {
+	active := make(map[string]process.MaintenanceWindow)
+	for _, window := range process.GetMaintenanceWindows() {
+		active[window.Name] = window
+	}
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	result := make([]MaintenanceInfo, 0)
+	for name, mc := range ms.configs {
+		info := MaintenanceInfo{Name: name, Duration: mc.duration.String(), Groups: mc.groups}
+		if entry := cfg.GetEntries(func(entry *config.Entry) bool { return entry.Name == "maintenance:"+name }); len(entry) > 0 {
+			info.Schedule = entry[0].GetString("schedule", "")
+		}
+		if window, ok := active[name]; ok {
+			info.Active = &window
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
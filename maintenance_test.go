@@ -0,0 +1,72 @@
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"supervisord/internal/testutil"
+
+	"github.com/ochinchina/supervisord/events"
+	"github.com/ochinchina/supervisord/process"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	dir := testutil.TempDir(t)
+	command := testutil.FakeProgram(t, dir, testutil.Crash)
+	content := fmt.Sprintf("[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\n\n"+
+		"[program:db]\ncommand=%[2]s\nautostart=false\nautorestart=true\nstartsecs=0\n\n"+
+		"[maintenance:nightly]\nschedule=* * * * *\nduration=2m\ngroups=web\n\n"+
+		"[maintenance:deploy]\nduration=1h\ngroups=db\n",
+		dir, command)
+	s := NewSupervisor(testutil.WriteFile(t, dir, "supervisord.conf", content))
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to start supervisord: %v", err)
+	}
+	t.Cleanup(func() {
+		s.GetManager().StopAllProcesses()
+		process.SetMaintenanceWindows(nil)
+	})
+
+	windows := process.GetMaintenanceWindows()
+	if len(windows) != 1 || windows[0].Name != "nightly" || windows[0].Manual || windows[0].Groups[0] != "web" {
+		t.Fatalf("fail to enter the scheduled maintenance window: %v", windows)
+	}
+	if err := s.maintenance.exit("nightly"); err != nil || len(process.GetMaintenanceWindows()) != 0 {
+		t.Error("fail to exit the scheduled maintenance window")
+	}
+	if _, err := s.maintenance.enter("unknown", 0); err == nil {
+		t.Error("fail to reject the unknown maintenance window")
+	}
+	window, err := s.maintenance.enter("deploy", time.Minute)
+	if err != nil || !window.Manual || window.End.Sub(window.Start) != time.Minute {
+		t.Fatalf("fail to enter the maintenance window: %v", err)
+	}
+
+	exited := make(chan string, 10)
+	events.Subscribe("test-maintenance", []string{"PROCESS_STATE_EXITED"}, func(event events.Event) { exited <- event.GetBody() })
+	defer events.Unsubscribe("test-maintenance")
+	db := s.GetManager().Find("db")
+	if !db.InMaintenance() {
+		t.Fatal("fail to find the program in maintenance")
+	}
+	db.Start(false)
+	if !testutil.WaitFor(5*time.Second, func() bool { return db.GetState() == process.Exited }) {
+		t.Fatalf("fail to exit the crashed program: %v", db.GetState())
+	}
+	time.Sleep(time.Second)
+	if db.GetState() != process.Exited {
+		t.Error("fail to suppress the restart of the program in maintenance")
+	}
+	select {
+	case body := <-exited:
+		t.Errorf("fail to suppress the event of the program in maintenance: %s", body)
+	default:
+	}
+
+	if err := s.maintenance.exit("deploy"); err != nil || db.InMaintenance() {
+		t.Error("fail to exit the maintenance window")
+	}
+}
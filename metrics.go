@@ -0,0 +1,134 @@
+// +build !nometrics
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ochinchina/supervisord/events"
+	"github.com/ochinchina/supervisord/logger"
+	"github.com/ochinchina/supervisord/process"
+	"github.com/ochinchina/supervisord/types"
+)
+
+// the metrics of the programs exported in the prometheus text format, the
+// metrics named *_total are counters and the others are gauges
+var processMetrics = []struct {
+	name  string
+	help  string
+	value func(info *types.ProcessInfo, proc *process.Process) float64
+}{
+	{"node_supervisord_up", "Process Up", func(info *types.ProcessInfo, proc *process.Process) float64 {
+		if info.State == int(process.Running) {
+			return 1
+		}
+		return 0
+	}},
+	{"node_supervisord_state", "Process State", func(info *types.ProcessInfo, proc *process.Process) float64 { return float64(info.State) }},
+	{"node_supervisord_exit_status", "Process Exit Status", func(info *types.ProcessInfo, proc *process.Process) float64 { return float64(info.Exitstatus) }},
+	{"node_supervisord_start_time_seconds", "Process start time", func(info *types.ProcessInfo, proc *process.Process) float64 { return float64(info.Start) }},
+	{"node_supervisord_log_bytes", "Total size of the current and backup log files", func(info *types.ProcessInfo, proc *process.Process) float64 {
+		if proc == nil {
+			return 0
+		}
+		return float64(proc.GetLogBytes())
+	}},
+	{"node_supervisord_error_log_lines_total", "Log lines detected as error or critical by the log_severity rules", func(info *types.ProcessInfo, proc *process.Process) float64 {
+		if proc == nil {
+			return 0
+		}
+		return float64(proc.GetLogLines(logger.SeverityError) + proc.GetLogLines(logger.SeverityCritical))
+	}},
+	{"node_supervisord_restarts_total", "Restarts of the process after a failure", func(info *types.ProcessInfo, proc *process.Process) float64 { return float64(info.Restarts) }},
+	{"node_supervisord_failures_total", "Unexpected exits of the process", func(info *types.ProcessInfo, proc *process.Process) float64 { return float64(info.Failures) }},
+	{"node_supervisord_uptime_seconds_total", "Total running time of the process", func(info *types.ProcessInfo, proc *process.Process) float64 { return float64(info.Uptime) }},
+	{"node_supervisord_current_uptime_seconds", "Running time of the running process from the monotonic clock", func(info *types.ProcessInfo, proc *process.Process) float64 { return float64(info.CurrentUptime) }},
+	{"node_supervisord_mtbf_seconds", "Mean running time between two failures of the process", func(info *types.ProcessInfo, proc *process.Process) float64 { return float64(info.Mtbf) }},
+}
+
+var metricsLabelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// register the aliases of the methods reporting the metrics of supervisord,
+// they are not built in the binary built with the nometrics tag
+func registerMetricsAliases(codec rpcCodec) {
+	codec.RegisterAlias("supervisor.getEventMemoryUsage", "Supervisor.GetEventMemoryUsage")
+}
+
+// register the prometheus metrics of the programs at /metrics
+func registerMetricsHandler(mux *http.ServeMux, s *Supervisor, protect func(http.Handler) http.Handler) {
+	mux.Handle("/metrics", protect(http.HandlerFunc(s.writeMetrics)))
+}
+
+// GetEventMemoryUsage get the memory used by the events queued for the event
+// listeners and the number of events dropped because of event_buffer_maxbytes
+func (s *Supervisor) GetEventMemoryUsage(r *http.Request, args *struct{}, reply *struct{ Usage events.MemoryUsage }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "get the event memory usage"); err != nil {
+		return err
+	}
+	reply.Usage = events.GetMemoryUsage()
+	return nil
+}
+
+// writeMetrics write the metrics of the programs the user is allowed to
+// control, labelled by the name, the group and the program labels selected
+// by metrics_labels
+func (s *Supervisor) writeMetrics(w http.ResponseWriter, req *http.Request) {
+	reply := struct{ AllProcessInfo []types.ProcessInfo }{}
+	if err := s.GetAllProcessInfo(req, nil, &reply); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	labelKeys := s.getMetricsLabels()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, metric := range processMetrics {
+		metricType := "gauge"
+		if strings.HasSuffix(metric.name, "_total") {
+			metricType = "counter"
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metricType)
+		for i := range reply.AllProcessInfo {
+			info := &reply.AllProcessInfo[i]
+			proc := s.procMgr.Find(info.Name)
+			fmt.Fprintf(w, "%s{%s} %s\n", metric.name, formatMetricsLabels(info, labelKeys), strconv.FormatFloat(metric.value(info, proc), 'g', -1, 64))
+		}
+	}
+}
+
+// get the keys of the program labels exported as the labels of the metrics,
+// the other program labels are not exported to bound the number of series
+func (s *Supervisor) getMetricsLabels() []string {
+	if supervisordConf, ok := s.config.GetSupervisord(); ok {
+		return splitList(supervisordConf.GetString("metrics_labels", ""))
+	}
+	return nil
+}
+
+func formatMetricsLabels(info *types.ProcessInfo, labelKeys []string) string {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, `name="%s",group="%s"`, metricsLabelValueEscaper.Replace(info.Name), metricsLabelValueEscaper.Replace(info.Group))
+	for _, key := range labelKeys {
+		fmt.Fprintf(&b, `,%s="%s"`, toMetricsLabelName(key), metricsLabelValueEscaper.Replace(getLabelValue(info.Labels, key)))
+	}
+	return b.String()
+}
+
+// convert the label key to a valid prometheus label name, the keys "name" and
+// "group" are prefixed with "label_" to not override the name and the group
+func toMetricsLabelName(key string) string {
+	name := []byte(key)
+	for i, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			name[i] = '_'
+		}
+	}
+	if key == "name" || key == "group" || strings.HasPrefix(key, "__") {
+		return "label_" + string(name)
+	}
+	return string(name)
+}
@@ -0,0 +1,24 @@
+// +build nometrics
+
+package main
+
+import (
+	"net/http"
+)
+
+func registerMetricsAliases(codec rpcCodec) {
+}
+
+func registerMetricsHandler(mux *http.ServeMux, s *Supervisor, protect func(http.Handler) http.Handler) {
+}
+
+// StatsdEmitter push nothing in the binary built with the nometrics tag
+type StatsdEmitter struct{}
+
+// NewStatsdEmitter create a StatsdEmitter pushing nothing
+func NewStatsdEmitter() *StatsdEmitter {
+	return &StatsdEmitter{}
+}
+
+func (se *StatsdEmitter) load(s *Supervisor) {
+}
@@ -0,0 +1,53 @@
+// +build !windows,!nometrics
+
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ochinchina/supervisord/events"
+)
+
+func TestGetEventMemoryUsage(t *testing.T) {
+	s := startACLTestSupervisor(t)
+	alice := withAuthUser(httptest.NewRequest("POST", "/RPC2", nil), &AuthUser{Name: "alice", Teams: []string{"web"}})
+	admin := withAuthUser(httptest.NewRequest("POST", "/RPC2", nil), &AuthUser{Name: "admin", Admin: true})
+
+	reply := struct{ Usage events.MemoryUsage }{}
+	if err := s.GetEventMemoryUsage(alice, nil, &reply); err == nil {
+		t.Error("fail to reject getting the event memory usage by user")
+	}
+	if err := s.GetEventMemoryUsage(admin, nil, &reply); err != nil || reply.Usage.MaxBytes != 0 {
+		t.Error("fail to get the event memory usage")
+	}
+}
+
+func TestProcessMetrics(t *testing.T) {
+	s := startLabelTestSupervisor(t)
+	w := httptest.NewRecorder()
+	s.writeMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE node_supervisord_up gauge",
+		`node_supervisord_up{name="web",group="web",team="web"} 0`,
+		`node_supervisord_state{name="db",group="db",team="data"} 0`,
+		`node_supervisord_exit_status{name="cron",group="cron",team=""} 0`,
+		`node_supervisord_log_bytes{name="web",group="web",team="web"} 0`,
+		"# TYPE node_supervisord_error_log_lines_total counter",
+		`node_supervisord_restarts_total{name="db",group="db",team="data"} 0`,
+		"# TYPE node_supervisord_mtbf_seconds gauge",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("fail to export the metric %s", line)
+		}
+	}
+	// only the labels of metrics_labels are exported
+	if strings.Contains(body, "tier=") {
+		t.Error("fail to limit the exported labels")
+	}
+	if toMetricsLabelName("app.kubernetes.io/name") != "app_kubernetes_io_name" || toMetricsLabelName("name") != "label_name" {
+		t.Error("fail to convert the label names")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ochinchina/supervisord/faults"
+	"github.com/ochinchina/supervisord/process"
+	log "github.com/sirupsen/logrus"
+)
+
+// OperationLock serializes the conflicting control operations (reload,
+// start all and stop all) requested by multiple clients. An operation
+// requested while another one is running is refused with a BUSY fault
+type OperationLock struct {
+	sync.Mutex
+	name    string
+	started time.Time
+}
+
+// Begin mark the operation as running or return a BUSY fault if another
+// operation is running
+func (o *OperationLock) Begin(name string) error {
+	o.Lock()
+	defer o.Unlock()
+	if o.name != "" {
+		log.WithFields(log.Fields{"operation": name, "running": o.name}).Warn("refuse the operation because another one is running")
+		return faults.NewFault(faults.Busy, fmt.Sprintf("BUSY: %s is running since %s", o.name, o.started.Format(time.RFC3339)))
+	}
+	o.name = name
+	o.started = time.Now()
+	return nil
+}
+
+// End mark the running operation as finished
+func (o *OperationLock) End() {
+	o.Lock()
+	defer o.Unlock()
+	o.name = ""
+}
+
+// Current get the running operation and its start time, the name is empty
+// if no operation is running
+func (o *OperationLock) Current() (string, time.Time) {
+	o.Lock()
+	defer o.Unlock()
+	return o.name, o.started
+}
+
+// create the context to wait an operation requested by a client. The context
+// is done when the client disconnects or the max_operation_secs is elapsed.
+// The timeout in seconds given by the client is used if it is shorter
+func (s *Supervisor) operationContext(r *http.Request, timeout int) (context.Context, context.CancelFunc) {
+	ctx := context.Background()
+	if r != nil {
+		ctx = r.Context()
+	}
+	maxOperationTime := s.maxOperationTime
+	if timeout > 0 && (maxOperationTime <= 0 || time.Duration(timeout)*time.Second < maxOperationTime) {
+		maxOperationTime = time.Duration(timeout) * time.Second
+	}
+	if maxOperationTime > 0 {
+		return context.WithTimeout(ctx, maxOperationTime)
+	}
+	return context.WithCancel(ctx)
+}
+
+// convert the error of waiting an operation to a fault, the operation itself
+// is not cancelled and goes on in background
+func operationFault(name string, err error) error {
+	if err == context.DeadlineExceeded {
+		log.WithFields(log.Fields{"operation": name}).Warn("stop waiting the operation which is still running")
+		return faults.NewFault(faults.StillRunning, fmt.Sprintf("STILL_RUNNING: %s is still running", name))
+	}
+	if err == context.Canceled {
+		log.WithFields(log.Fields{"operation": name}).Info("stop waiting the operation because the client is disconnected")
+	}
+	return err
+}
+
+// collect the processes finished in the channel until all the n processes are
+// finished or the context is done
+func collectFinishedProcesses(ctx context.Context, finishedProcCh chan *process.Process, n int) ([]*process.Process, error) {
+	procs := make([]*process.Process, 0, n)
+	for i := 0; i < n; i++ {
+		select {
+		case proc := <-finishedProcCh:
+			procs = append(procs, proc)
+		case <-ctx.Done():
+			// receive the processes still being started or stopped
+			go func(remain int) {
+				for ; remain > 0; remain-- {
+					<-finishedProcCh
+				}
+			}(n - i)
+			return procs, ctx.Err()
+		}
+	}
+	return procs, nil
+}
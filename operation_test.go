@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	xmlrpc "github.com/ochinchina/gorilla-xmlrpc/xml"
+	"github.com/ochinchina/supervisord/faults"
+)
+
+func TestOperationLock(t *testing.T) {
+	var operations OperationLock
+	if err := operations.Begin("reload"); err != nil {
+		t.Error("fail to begin the operation")
+	}
+	if name, _ := operations.Current(); name != "reload" {
+		t.Error("fail to get the running operation")
+	}
+	err := operations.Begin("startAllProcesses")
+	if fault, ok := err.(*xmlrpc.Fault); !ok || fault.Code != faults.Busy {
+		t.Error("fail to refuse the conflicting operation")
+	}
+	operations.End()
+	if name, _ := operations.Current(); name != "" {
+		t.Error("fail to end the operation")
+	}
+	if err := operations.Begin("stopAllProcesses"); err != nil {
+		t.Error("fail to begin the operation after the previous one is finished")
+	}
+}
+
+func TestOperationFault(t *testing.T) {
+	fault, ok := operationFault("start test", context.DeadlineExceeded).(*xmlrpc.Fault)
+	if !ok || fault.Code != faults.StillRunning {
+		t.Error("fail to convert the timeout to STILL_RUNNING fault")
+	}
+	if operationFault("start test", context.Canceled) != context.Canceled {
+		t.Error("fail to return the error of cancelled operation")
+	}
+}
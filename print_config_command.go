@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/secret"
+	log "github.com/sirupsen/logrus"
+)
+
+// PrintConfigCommand implements flags.Commander interface
+type PrintConfigCommand struct {
+}
+
+var printConfigCommand PrintConfigCommand
+
+// use the defaults file given on the command line
+func setDefaultsFile() {
+	if options.DefaultsFile != "" {
+		config.SetDefaultsFile(options.DefaultsFile)
+	}
+}
+
+// print the merged values by section with the file each value comes from and
+// the files it overrides, the secret values are masked
+func printValueSources(w io.Writer, sources []config.ValueSource) {
+	section := ""
+	for i, source := range sources {
+		if i == 0 || source.Section != section {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			section = source.Section
+			fmt.Fprintf(w, "[%s]\n", section)
+		}
+		origin := "from " + source.File
+		if len(source.Overridden) > 0 {
+			origin += ", overrides " + strings.Join(source.Overridden, ", ")
+		}
+		fmt.Fprintf(w, "%s ; %s\n", secret.MaskText(source.Key+"="+source.Value), origin)
+	}
+}
+
+// Execute print the configuration merged from the defaults file, the
+// configuration file and its include files
+func (pc *PrintConfigCommand) Execute(args []string) error {
+	// keep the printed configuration apart from the logs of the loading
+	log.SetOutput(os.Stderr)
+	setDefaultsFile()
+	if len(options.Configuration) <= 0 {
+		options.Configuration, _ = findSupervisordConf()
+	}
+	sources, err := config.NewConfig(options.Configuration).GetValueSources()
+	if err != nil {
+		return exitOnError(err)
+	}
+	printValueSources(os.Stdout, sources)
+	return nil
+}
+
+func init() {
+	parser.AddCommand("print-config",
+		"print the merged configuration with the origin of the values",
+		"The print-config subcommand prints the values of the configuration merged from the machine-level defaults file, the configuration file and its include files, with the file setting each value and the files whose value it overrides",
+		&printConfigCommand)
+}
@@ -0,0 +1,32 @@
+package process
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// start the command in the cgroup directory of the program. The command is
+// spawned directly in a cgroup v2 directory when the kernel supports it, so
+// that the processes it forks can't escape the cgroup, otherwise it is moved
+// into the cgroup once it is started
+func startInCgroup(name string, cmd *exec.Cmd, dir string) error {
+	if dir == "" {
+		return cmd.Start()
+	}
+	if f := setCgroupFD(cmd.SysProcAttr, dir); f != nil {
+		defer f.Close()
+		defer clearCgroupFD(cmd.SysProcAttr)
+		return cmd.Start()
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(cmd.Process.Pid)), 0644); err != nil {
+		log.WithFields(log.Fields{"program": name, "cgroup": dir, log.ErrorKey: err}).Warn("fail to move the process to the cgroup of the program")
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// +build linux,go1.20
+
+package process
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+)
+
+const cgroup2SuperMagic = 0x63677270
+
+var cloneIntoCgroupOnce sync.Once
+var cloneIntoCgroup bool
+
+// check if the kernel spawns the processes in a cgroup with clone3
+// (CLONE_INTO_CGROUP, linux 5.7 or later)
+func canCloneIntoCgroup() bool {
+	cloneIntoCgroupOnce.Do(func() {
+		uname := syscall.Utsname{}
+		if syscall.Uname(&uname) != nil {
+			return
+		}
+		release := ""
+		for _, c := range uname.Release {
+			if c == 0 {
+				break
+			}
+			release += string(rune(c))
+		}
+		major, minor := 0, 0
+		if n, _ := fmt.Sscanf(release, "%d.%d", &major, &minor); n == 2 {
+			cloneIntoCgroup = major > 5 || (major == 5 && minor >= 7)
+		}
+	})
+	return cloneIntoCgroup
+}
+
+// set the cgroup v2 directory the command is spawned in, nil is returned if
+// the directory is not a cgroup v2 or the kernel can't spawn in it. The
+// returned directory is closed once the command is started
+func setCgroupFD(attr *syscall.SysProcAttr, dir string) *os.File {
+	fs := syscall.Statfs_t{}
+	if syscall.Statfs(dir, &fs) != nil || fs.Type != cgroup2SuperMagic || !canCloneIntoCgroup() {
+		return nil
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil
+	}
+	attr.UseCgroupFD = true
+	attr.CgroupFD = int(f.Fd())
+	return f
+}
+
+func clearCgroupFD(attr *syscall.SysProcAttr) {
+	attr.UseCgroupFD = false
+	attr.CgroupFD = 0
+}
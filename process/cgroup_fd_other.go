@@ -0,0 +1,16 @@
+// +build !linux !go1.20
+
+package process
+
+import (
+	"os"
+	"syscall"
+)
+
+// the processes can only be spawned in a cgroup on linux with go1.20 or later
+func setCgroupFD(attr *syscall.SysProcAttr, dir string) *os.File {
+	return nil
+}
+
+func clearCgroupFD(attr *syscall.SysProcAttr) {
+}
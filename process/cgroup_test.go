@@ -0,0 +1,28 @@
+// +build !windows
+
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestStartInCgroup(t *testing.T) {
+	// not a cgroup v2, the command is moved into it once it is started
+	dir, _ := ioutil.TempDir("", "cgroup")
+	defer os.RemoveAll(dir)
+	cmd := exec.Command("true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	if err := startInCgroup("test", cmd, dir); err != nil {
+		t.Fatalf("fail to start the command: %v", err)
+	}
+	cmd.Wait()
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "cgroup.procs")); string(b) != strconv.Itoa(cmd.Process.Pid) {
+		t.Errorf("fail to move the command to the cgroup: %q", b)
+	}
+}
@@ -40,6 +40,12 @@ func appendArgument(arg string, args []string) []string {
 	return append(args, arg)
 }
 
+// ParseCommand split the command line into the program and its arguments
+// with same rules used for the "command" of a program
+func ParseCommand(command string) ([]string, error) {
+	return parseCommand(command)
+}
+
 func parseCommand(command string) ([]string, error) {
 	args := make([]string, 0)
 	cmdLen := len(command)
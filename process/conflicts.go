@@ -0,0 +1,110 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ochinchina/supervisord/faults"
+	log "github.com/sirupsen/logrus"
+)
+
+// the policies applied when a program is started while its conflicting programs are running
+const (
+	// refuse to start the program
+	conflictRefuse = "refuse"
+	// stop the conflicting programs before starting the program
+	conflictStop = "stop"
+)
+
+// getConflicts get the program names in the conflicts of the program
+func (p *Process) getConflicts() []string {
+	conflicts := make([]string, 0)
+	for _, name := range p.config.GetStringArray("conflicts", ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			conflicts = append(conflicts, name)
+		}
+	}
+	return conflicts
+}
+
+func (p *Process) getConflictPolicy() string {
+	return strings.ToLower(p.config.GetString("conflict_policy", conflictRefuse))
+}
+
+// isStarted check if the program is started and not stopped yet
+func (p *Process) isStarted() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.inStart
+}
+
+// conflictsWith check if one of the programs declares a conflict with the other
+func (p *Process) conflictsWith(other *Process) bool {
+	if p == other {
+		return false
+	}
+	for _, name := range p.getConflicts() {
+		if name == other.GetName() {
+			return true
+		}
+	}
+	for _, name := range other.getConflicts() {
+		if name == p.GetName() {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConflicts check the conflicts of the program before it is started, the
+// returned function must be called once the program is marked as started
+func (p *Process) checkConflicts(ctx context.Context) (func(), error) {
+	if p.manager == nil {
+		return func() {}, nil
+	}
+	return p.manager.checkConflicts(ctx, p)
+}
+
+// getStartedConflicts get the started programs conflicting with the program
+func (pm *Manager) getStartedConflicts(proc *Process) []*Process {
+	conflicts := make([]*Process, 0)
+	pm.ForEachProcess(func(other *Process) {
+		if proc.conflictsWith(other) && other.isStarted() {
+			conflicts = append(conflicts, other)
+		}
+	})
+	return conflicts
+}
+
+// checkConflicts refuse to start the program or stop its conflicting programs
+// according to its conflict_policy if the conflicting programs are started.
+// The starts are serialized until the returned function is called so two
+// conflicting programs can't be started at the same time
+func (pm *Manager) checkConflicts(ctx context.Context, proc *Process) (func(), error) {
+	pm.conflictLock.Lock()
+	release := pm.conflictLock.Unlock
+	if proc.isStarted() {
+		return release, nil
+	}
+	conflicts := pm.getStartedConflicts(proc)
+	if len(conflicts) == 0 {
+		return release, nil
+	}
+	names := make([]string, 0, len(conflicts))
+	for _, other := range conflicts {
+		names = append(names, other.GetName())
+	}
+	if proc.getConflictPolicy() != conflictStop {
+		release()
+		return nil, faults.NewFault(faults.Conflict, fmt.Sprintf("CONFLICT: %s conflicts with the running programs %s", proc.GetName(), strings.Join(names, ",")))
+	}
+	log.WithFields(log.Fields{"program": proc.GetName(), "conflicts": strings.Join(names, ",")}).Info("stop the conflicting programs")
+	for _, other := range conflicts {
+		if err := other.StopContext(ctx, true); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
@@ -0,0 +1,10 @@
+// +build !windows
+
+package process
+
+import (
+	"syscall"
+)
+
+func setNoConsoleWindow(_ *syscall.SysProcAttr) {
+}
@@ -0,0 +1,20 @@
+// +build windows
+
+package process
+
+import (
+	"syscall"
+)
+
+// CREATE_NO_WINDOW process creation flag
+const createNoWindow = 0x08000000
+
+var getConsoleWindow = syscall.NewLazyDLL("kernel32.dll").NewProc("GetConsoleWindow")
+
+// a console program started by a process without console gets a new console
+// window, don't create it if supervisord is detached from its console
+func setNoConsoleWindow(sysProcAttr *syscall.SysProcAttr) {
+	if hwnd, _, _ := getConsoleWindow.Call(); hwnd == 0 {
+		sysProcAttr.CreationFlags |= createNoWindow
+	}
+}
@@ -0,0 +1,245 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ochinchina/supervisord/events"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	corePatternFile = "/proc/sys/kernel/core_pattern"
+	coreUsesPidFile = "/proc/sys/kernel/core_uses_pid"
+)
+
+// the core file size limit is inherited from supervisord, it is changed with
+// the write lock while a program with "rlimit_core" is started. All the other
+// commands are started with the read lock so that they never inherit it
+var coreLimitLock sync.RWMutex
+
+// StartCommand start a command of supervisord, like a hook or a check script,
+// with the core file size limit of supervisord
+func StartCommand(cmd *exec.Cmd) error {
+	coreLimitLock.RLock()
+	defer coreLimitLock.RUnlock()
+	return cmd.Start()
+}
+
+// RunCommand start a command like StartCommand and wait for it to exit
+func RunCommand(cmd *exec.Cmd) error {
+	if err := StartCommand(cmd); err != nil {
+		return err
+	}
+	return cmd.Wait()
+}
+
+// start the command of the program in its cgroup and with the core file size
+// limit of "rlimit_core" if it is configured, the limit is set before the
+// program is executed so that it applies from its first instruction. Must be
+// called with the lock hold
+func (p *Process) startCommand() error {
+	cgroup := p.config.GetString("cgroup", "")
+	value := strings.TrimSpace(p.config.GetString("rlimit_core", ""))
+	if value == "" {
+		coreLimitLock.RLock()
+		defer coreLimitLock.RUnlock()
+		return startInCgroup(p.GetName(), p.cmd, cgroup)
+	}
+	limit := uint64(0)
+	if value == "unlimited" {
+		limit = ^uint64(0)
+	} else {
+		limit = uint64(p.config.GetBytes("rlimit_core", 0))
+	}
+	coreLimitLock.Lock()
+	defer coreLimitLock.Unlock()
+	restore, err := setInheritedCoreLimit(limit)
+	if err != nil {
+		log.WithFields(log.Fields{"program": p.GetName(), log.ErrorKey: err}).Warn("fail to set the core file size limit")
+		return startInCgroup(p.GetName(), p.cmd, cgroup)
+	}
+	defer restore()
+	return startInCgroup(p.GetName(), p.cmd, cgroup)
+}
+
+// read the kernel core_pattern, "core" is returned if it can't be read
+func readCorePattern() string {
+	b, err := ioutil.ReadFile(corePatternFile)
+	if err != nil || strings.TrimSpace(string(b)) == "" {
+		return "core"
+	}
+	pattern := strings.TrimSpace(string(b))
+	if !strings.HasPrefix(pattern, "|") && !strings.Contains(pattern, "%p") {
+		if b, err = ioutil.ReadFile(coreUsesPidFile); err == nil && strings.TrimSpace(string(b)) == "1" {
+			pattern = pattern + ".%p"
+		}
+	}
+	return pattern
+}
+
+// expand the core_pattern to a glob pattern, the specifiers which
+// can't be known after the program exits are replaced with "*"
+func expandCorePattern(pattern string, pid int, executable string, signal int) string {
+	hostname, _ := os.Hostname()
+	comm := filepath.Base(executable)
+	if len(comm) > 15 {
+		comm = comm[0:15]
+	}
+	result := ""
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 >= len(pattern) {
+			result += string(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case '%':
+			result += "%"
+		case 'p', 'P', 'i', 'I':
+			result += strconv.Itoa(pid)
+		case 'e':
+			result += comm
+		case 'E':
+			result += strings.Replace(executable, "/", "!", -1)
+		case 'h':
+			result += hostname
+		case 's':
+			result += strconv.Itoa(signal)
+		default:
+			result += "*"
+		}
+	}
+	return result
+}
+
+// find the core file written by the kernel for the exited program. Return
+// the core file location or the handler if the core is piped to a program
+func (p *Process) findCoreFile(status syscall.WaitStatus) string {
+	pattern := readCorePattern()
+	if strings.HasPrefix(pattern, "|") {
+		return pattern
+	}
+	dir := p.cmd.Dir
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	pattern = expandCorePattern(pattern, p.cmd.Process.Pid, p.cmd.Path, int(status.Signal()))
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return ""
+	}
+	coreFile := ""
+	var coreTime time.Time
+	for _, file := range files {
+		fileInfo, err := os.Stat(file)
+		if err == nil && !fileInfo.IsDir() && !fileInfo.ModTime().Before(p.startTime) && fileInfo.ModTime().After(coreTime) {
+			coreFile, coreTime = file, fileInfo.ModTime()
+		}
+	}
+	return coreFile
+}
+
+// move the core file to the "core_dir" and keep at most "core_max_files" core files of the program
+func (p *Process) moveCoreFile(coreFile string) string {
+	coreDir := p.config.GetStringExpression("core_dir", "")
+	if coreDir == "" {
+		return coreFile
+	}
+	// the time first orders the core files of the program by their names
+	target := filepath.Join(coreDir, fmt.Sprintf("%s-%s-%d.core", p.GetName(), p.stopTime.Format("20060102T150405"), p.cmd.Process.Pid))
+	err := os.MkdirAll(coreDir, 0755)
+	if err == nil {
+		err = moveFile(coreFile, target)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"program": p.GetName(), "core": coreFile, log.ErrorKey: err}).Error("fail to move core file")
+		return coreFile
+	}
+	maxFiles := p.config.GetInt("core_max_files", 0)
+	if maxFiles > 0 {
+		files := listCoreFiles(coreDir, p.GetName())
+		for i := 0; i < len(files)-maxFiles; i++ {
+			os.Remove(files[i])
+		}
+	}
+	return target
+}
+
+// list the core files of the program in the directory from the oldest, the
+// core files of the programs whose name starts with the same prefix are skipped
+func listCoreFiles(coreDir string, name string) []string {
+	pattern := regexp.MustCompile("^" + regexp.QuoteMeta(name) + `-\d{8}T\d{6}-\d+\.core$`)
+	files := make([]string, 0)
+	fileInfos, _ := ioutil.ReadDir(coreDir)
+	for _, fileInfo := range fileInfos {
+		if !fileInfo.IsDir() && pattern.MatchString(fileInfo.Name()) {
+			files = append(files, filepath.Join(coreDir, fileInfo.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func moveFile(src string, dest string) error {
+	if os.Rename(src, dest) == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dest)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// collect the core file if the exited program dumped core and emit
+// PROCESS_COREDUMP event, must be called with the lock hold
+func (p *Process) collectCoreDump() string {
+	if p.cmd == nil || p.cmd.ProcessState == nil {
+		return ""
+	}
+	status, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok || !status.CoreDump() {
+		return ""
+	}
+	core := p.findCoreFile(status)
+	if core == "" {
+		log.WithFields(log.Fields{"program": p.GetName()}).Warn("program dumped core but the core file is not found")
+		return ""
+	}
+	if !strings.HasPrefix(core, "|") {
+		core = p.moveCoreFile(core)
+	}
+	log.WithFields(log.Fields{"program": p.GetName(), "core": core}).Info("program dumped core")
+	if p.config.IsProgram() {
+		events.EmitEvent(events.CreateProcessCoreDumpEvent(p.GetName(), p.GetGroup(), p.cmd.Process.Pid, core))
+	}
+	return core
+}
@@ -0,0 +1,52 @@
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCoreLimitBeforeExec(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "core")
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "limit.txt")
+	proc := createTestProcesses(t, fmt.Sprintf("[program:test]\ncommand=/bin/sh -c 'grep core /proc/self/limits > %s'\nstartsecs=0\nautorestart=false\nrlimit_core=1MB\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n", output))[0]
+	saved := syscall.Rlimit{}
+	syscall.Getrlimit(syscall.RLIMIT_CORE, &saved)
+	proc.Start(true)
+	defer proc.Stop(true)
+	for i := 0; i < 50; i++ {
+		if b, _ := ioutil.ReadFile(output); len(b) > 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if b, _ := ioutil.ReadFile(output); len(strings.Fields(string(b))) < 5 || strings.Fields(string(b))[4] != "1048576" {
+		t.Errorf("fail to set the core file size limit before executing the program: %q", b)
+	}
+	current := syscall.Rlimit{}
+	if syscall.Getrlimit(syscall.RLIMIT_CORE, &current); current != saved {
+		t.Errorf("fail to restore the core file size limit of supervisord: %v", current)
+	}
+}
+
+func TestStartCommandWhileCoreLimitChanged(t *testing.T) {
+	coreLimitLock.Lock()
+	started := make(chan error, 1)
+	go func() { started <- RunCommand(exec.Command("true")) }()
+	select {
+	case <-started:
+		t.Error("fail to wait for the core file size limit to be restored")
+	case <-time.After(100 * time.Millisecond):
+	}
+	coreLimitLock.Unlock()
+	if err := <-started; err != nil {
+		t.Errorf("fail to run the command: %v", err)
+	}
+}
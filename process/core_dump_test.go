@@ -0,0 +1,30 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandCorePattern(t *testing.T) {
+	hostname, _ := os.Hostname()
+	if expandCorePattern("/var/crash/core.%e.%p.%h.%t", 123, "/usr/bin/my-very-long-program-name", 11) != "/var/crash/core.my-very-long-pr.123."+hostname+".*" {
+		t.Error("fail to expand the core pattern")
+	}
+	if expandCorePattern("core-%s-%%-%E", 5, "/bin/app", 6) != "core-6-%-!bin!app" {
+		t.Error("fail to expand the core pattern")
+	}
+}
+
+func TestListCoreFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "core")
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"web-20240102T030405-9.core", "web-20240101T030405-10.core", "web-1-20240101T000000-1.core", "web-api-20240101T000000-1.core", "web.log"} {
+		ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	files := listCoreFiles(dir, "web")
+	if len(files) != 2 || filepath.Base(files[0]) != "web-20240101T030405-10.core" || filepath.Base(files[1]) != "web-20240102T030405-9.core" {
+		t.Errorf("fail to list the core files of the program from the oldest: %v", files)
+	}
+}
@@ -0,0 +1,25 @@
+// +build linux
+
+package process
+
+import (
+	"syscall"
+)
+
+// set the core file size limit of supervisord inherited by the commands
+// started until the returned function restores the previous limit. The hard
+// limit is only raised, it can't be raised again by an unprivileged user
+func setInheritedCoreLimit(limit uint64) (func(), error) {
+	saved := syscall.Rlimit{}
+	if err := syscall.Getrlimit(syscall.RLIMIT_CORE, &saved); err != nil {
+		return nil, err
+	}
+	rlimit := syscall.Rlimit{Cur: limit, Max: saved.Max}
+	if limit > saved.Max {
+		rlimit.Max = limit
+	}
+	if err := syscall.Setrlimit(syscall.RLIMIT_CORE, &rlimit); err != nil {
+		return nil, err
+	}
+	return func() { syscall.Setrlimit(syscall.RLIMIT_CORE, &saved) }, nil
+}
@@ -0,0 +1,11 @@
+// +build !linux
+
+package process
+
+import (
+	"fmt"
+)
+
+func setInheritedCoreLimit(limit uint64) (func(), error) {
+	return nil, fmt.Errorf("rlimit_core is only supported on linux")
+}
@@ -0,0 +1,203 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ochinchina/supervisord/secret"
+	log "github.com/sirupsen/logrus"
+)
+
+// StateTransition one state change of the process
+type StateTransition struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	Time time.Time `json:"time"`
+}
+
+// CrashReport the information collected when a program exits unexpectedly
+type CrashReport struct {
+	Program      string            `json:"program"`
+	Group        string            `json:"group"`
+	Pid          int               `json:"pid"`
+	State        string            `json:"state"`
+	ExitStatus   int               `json:"exit_status"`
+	StartTime    time.Time         `json:"start_time"`
+	StopTime     time.Time         `json:"stop_time"`
+	Command      []string          `json:"command"`
+	Directory    string            `json:"directory"`
+	Environment  map[string]string `json:"environment"`
+	LastOutput   string            `json:"last_output"`
+	StateHistory []StateTransition `json:"state_history"`
+	CoreDump     string            `json:"core_dump,omitempty"`
+}
+
+// CrashReportInfo the summary of a crash report file
+type CrashReportInfo struct {
+	Name    string    `json:"name"`
+	Program string    `json:"program"`
+	Size    int64     `json:"size"`
+	Time    time.Time `json:"time"`
+}
+
+// the number of state transitions kept for every process
+const maxStateHistory = 20
+
+var crashReportDir = ""
+var crashReportLock sync.RWMutex
+
+// SetCrashReportDir set the directory where the crash reports are written.
+// No crash report is written if the dir is empty
+func SetCrashReportDir(dir string) {
+	crashReportLock.Lock()
+	defer crashReportLock.Unlock()
+	crashReportDir = dir
+}
+
+// GetCrashReportDir get the directory of the crash reports
+func GetCrashReportDir() string {
+	crashReportLock.RLock()
+	defer crashReportLock.RUnlock()
+	return crashReportDir
+}
+
+// ListCrashReports list all the crash reports, the latest one first
+func ListCrashReports() ([]CrashReportInfo, error) {
+	result := make([]CrashReportInfo, 0)
+	dir := GetCrashReportDir()
+	if dir == "" {
+		return result, nil
+	}
+	fileInfos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, fileInfo := range fileInfos {
+		program, ok := parseCrashReportName(fileInfo.Name())
+		if fileInfo.IsDir() || !ok {
+			continue
+		}
+		result = append(result, CrashReportInfo{Name: fileInfo.Name(),
+			Program: program,
+			Size:    fileInfo.Size(),
+			Time:    fileInfo.ModTime()})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Time.After(result[j].Time)
+	})
+	return result, nil
+}
+
+// ReadCrashReport read the content of a crash report by its name
+func ReadCrashReport(name string) ([]byte, error) {
+	dir := GetCrashReportDir()
+	if _, ok := parseCrashReportName(name); dir == "" || !ok || filepath.Base(name) != name {
+		return nil, fmt.Errorf("no such crash report %s", name)
+	}
+	return ioutil.ReadFile(filepath.Join(dir, name))
+}
+
+// the crash report file name is: <program>-<yyyymmddTHHMMSS>-<pid>.crash.json
+func parseCrashReportName(name string) (string, bool) {
+	if !strings.HasSuffix(name, ".crash.json") {
+		return "", false
+	}
+	fields := strings.Split(strings.TrimSuffix(name, ".crash.json"), "-")
+	if len(fields) < 3 {
+		return "", false
+	}
+	return strings.Join(fields[0:len(fields)-2], "-"), true
+}
+
+// MaskEnv replace the value of environment variables which may contain secret with "******"
+// and the secret patterns in other values
+func MaskEnv(env []string) map[string]string {
+	result := make(map[string]string)
+	for _, kv := range env {
+		pos := strings.Index(kv, "=")
+		if pos == -1 {
+			continue
+		}
+		k, v := kv[0:pos], kv[pos+1:]
+		if secret.IsSecretKey(k) {
+			v = secret.Mask
+		} else {
+			v = secret.MaskText(v)
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// record the state change, must be called with the lock hold
+func (p *Process) addStateHistory(from State, to State) {
+	p.stateHistory = append(p.stateHistory, StateTransition{From: from.String(), To: to.String(), Time: time.Now()})
+	if len(p.stateHistory) > maxStateHistory {
+		p.stateHistory = p.stateHistory[len(p.stateHistory)-maxStateHistory:]
+	}
+}
+
+// GetStateHistory get the last state changes of the process
+func (p *Process) GetStateHistory() []StateTransition {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return append([]StateTransition(nil), p.stateHistory...)
+}
+
+// check if the program exits unexpectedly, must be called with the lock hold
+func (p *Process) isUnexpectedExit() bool {
+	if p.stopByUser || p.cmd == nil || p.cmd.ProcessState == nil {
+		return false
+	}
+	if p.state == Backoff || p.state == Fatal {
+		return true
+	}
+	exitCode, err := p.getExitCode()
+	return err != nil || !p.inExitCodes(exitCode)
+}
+
+// write a crash report if the program exits unexpectedly, must be called with the lock hold
+func (p *Process) writeCrashReportIfNeeded() {
+	dir := GetCrashReportDir()
+	if dir == "" || !p.config.IsProgram() || !p.isUnexpectedExit() {
+		return
+	}
+	exitStatus, _ := p.getExitCode()
+	report := CrashReport{Program: p.GetName(),
+		Group:        p.GetGroup(),
+		Pid:          p.cmd.Process.Pid,
+		State:        p.state.String(),
+		ExitStatus:   exitStatus,
+		StartTime:    p.startTime,
+		StopTime:     p.stopTime,
+		Command:      secret.MaskArgs(p.cmd.Args),
+		Directory:    p.cmd.Dir,
+		Environment:  MaskEnv(p.cmd.Env),
+		LastOutput:   p.GetLastOutput(),
+		StateHistory: append([]StateTransition(nil), p.stateHistory...),
+		CoreDump:     p.coreDump}
+
+	go func() {
+		fileName := filepath.Join(dir, fmt.Sprintf("%s-%s-%d.crash.json", report.Program, report.StopTime.Format("20060102T150405"), report.Pid))
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			os.MkdirAll(dir, 0755)
+			err = ioutil.WriteFile(fileName, b, 0600)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"program": report.Program, log.ErrorKey: err}).Error("fail to write crash report")
+		} else {
+			log.WithFields(log.Fields{"program": report.Program, "file": fileName}).Info("crash report is written")
+		}
+	}()
+}
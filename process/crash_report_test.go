@@ -0,0 +1,25 @@
+package process
+
+import (
+	"testing"
+)
+
+func TestMaskEnv(t *testing.T) {
+	env := MaskEnv([]string{"HOME=/root", "DB_PASSWORD=123", "api_key=abc", "GITHUB_TOKEN=xyz", "INVALID"})
+	if len(env) != 4 || env["HOME"] != "/root" {
+		t.Error("fail to parse the environment")
+	}
+	if env["DB_PASSWORD"] != "******" || env["api_key"] != "******" || env["GITHUB_TOKEN"] != "******" {
+		t.Error("fail to mask the secret in environment")
+	}
+}
+
+func TestParseCrashReportName(t *testing.T) {
+	program, ok := parseCrashReportName("my-prog-20200101T101010-123.crash.json")
+	if !ok || program != "my-prog" {
+		t.Error("fail to parse the crash report name")
+	}
+	if _, ok = parseCrashReportName("test.log"); ok {
+		t.Error("fail to reject file which is not crash report")
+	}
+}
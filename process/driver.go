@@ -0,0 +1,391 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/dockerrun"
+	log "github.com/sirupsen/logrus"
+)
+
+// Driver the way the command of a program is executed, selected by its runner
+type Driver interface {
+	// Command get the arguments of the OS process executing the command of the program
+	Command(command string) ([]string, error)
+	// Cleanup release what is left by the previous execution of the program,
+	// called before the program is spawned and after its OS process exits
+	Cleanup()
+}
+
+// getDriver get the driver of the runner of the program, "exec" by default
+func getDriver(entry *config.Entry) (Driver, error) {
+	switch runner := entry.GetString("runner", "exec"); runner {
+	case "exec":
+		return execDriver{}, nil
+	case "docker":
+		return newDockerDriver(entry)
+	case "podman":
+		return newPodmanDriver(entry)
+	case "containerd":
+		return newContainerdDriver(entry)
+	case "wasm":
+		return newWasmDriver(entry)
+	case "ssh":
+		return newSSHDriver(entry)
+	default:
+		return nil, fmt.Errorf("unknown runner %s", runner)
+	}
+}
+
+// execDriver run the command on the host
+type execDriver struct {
+}
+
+func (d execDriver) Command(command string) ([]string, error) {
+	return parseCommand(command)
+}
+
+func (d execDriver) Cleanup() {
+}
+
+// the settings shared by the container runners
+type containerSettings struct {
+	image     string
+	container string
+	volumes   []string
+}
+
+func getContainerSettings(entry *config.Entry) (containerSettings, error) {
+	settings := containerSettings{image: entry.GetString("image", ""),
+		container: entry.GetString("container_name", "supervisord-"+entry.GetProgramName()),
+		volumes:   make([]string, 0)}
+	if settings.image == "" {
+		return settings, fmt.Errorf("no image for the %s runner", entry.GetString("runner", ""))
+	}
+	for _, volume := range entry.GetStringArray("volumes", ",") {
+		if volume = strings.TrimSpace(volume); volume != "" {
+			settings.volumes = append(settings.volumes, volume)
+		}
+	}
+	return settings, nil
+}
+
+// append the command of the program to the arguments running the container,
+// the default command of the image is run if it is empty
+func appendContainerCommand(args []string, command string) ([]string, error) {
+	if strings.TrimSpace(command) == "" {
+		return args, nil
+	}
+	cmd, err := parseCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	return append(args, cmd...), nil
+}
+
+// get the names of the environment of the program, the runners only pass the
+// names on their command line and take the values from their own environment
+// set by supervisord, so the values are not visible in the process list
+func getEnvNames(entry *config.Entry) []string {
+	names := make([]string, 0)
+	for _, env := range entry.GetEnv("environment") {
+		names = append(names, strings.SplitN(env, "=", 2)[0])
+	}
+	return names
+}
+
+// get the podman command line, connected to the REST socket of podman_socket if it is set
+func getPodmanCommand(entry *config.Entry) []string {
+	podman := []string{entry.GetString("runner_command", "podman")}
+	if socket := entry.GetString("podman_socket", ""); socket != "" {
+		if !strings.Contains(socket, "://") {
+			socket = "unix://" + socket
+		}
+		podman = append(podman, "--url", socket)
+	}
+	return podman
+}
+
+// podmanDriver run the command in a container with the podman command line,
+// the container is attached so its output is logged like a host process and
+// the stop signals are forwarded to it
+type podmanDriver struct {
+	containerSettings
+	// the command line with its global options
+	podman []string
+	env    []string
+}
+
+func newPodmanDriver(entry *config.Entry) (*podmanDriver, error) {
+	settings, err := getContainerSettings(entry)
+	if err != nil {
+		return nil, err
+	}
+	// the values of the environment are passed by the environment of the podman command
+	return &podmanDriver{containerSettings: settings, podman: getPodmanCommand(entry), env: getEnvNames(entry)}, nil
+}
+
+func (d *podmanDriver) Command(command string) ([]string, error) {
+	args := append(append([]string{}, d.podman...), "run", "--rm", "-i", "--name", d.container)
+	for _, volume := range d.volumes {
+		args = append(args, "-v", volume)
+	}
+	for _, env := range d.env {
+		args = append(args, "-e", env)
+	}
+	return appendContainerCommand(append(args, d.image), command)
+}
+
+// Cleanup remove the container left running if the podman command is killed
+// or supervisord exits without stopping it
+func (d *podmanDriver) Cleanup() {
+	runCleanup(d.container, append(append([]string{}, d.podman...), "rm", "-f", d.container))
+}
+
+// dockerDriver run the command in a container with the Docker Engine API by
+// the docker-run subcommand of supervisord, the container is attached so its
+// output is logged like a host process and the stop signals are forwarded to it
+type dockerDriver struct {
+	containerSettings
+	// the Engine API host, DOCKER_HOST or the default socket if it is empty
+	host string
+	// the command line of docker-run with its options
+	dockerRun []string
+}
+
+func newDockerDriver(entry *config.Entry) (*dockerDriver, error) {
+	settings, err := getContainerSettings(entry)
+	if err != nil {
+		return nil, err
+	}
+	supervisord, err := getSupervisordCommand(entry)
+	if err != nil {
+		return nil, err
+	}
+	d := &dockerDriver{containerSettings: settings, host: entry.GetString("docker_host", "")}
+	d.dockerRun = []string{supervisord, "docker-run", "--name", d.container, "--image", d.image}
+	if d.host != "" {
+		d.dockerRun = append(d.dockerRun, "--host", d.host)
+	}
+	for _, volume := range d.volumes {
+		d.dockerRun = append(d.dockerRun, "--volume", volume)
+	}
+	// the values of the environment are passed by the environment of docker-run
+	for _, name := range getEnvNames(entry) {
+		d.dockerRun = append(d.dockerRun, "--env", name)
+	}
+	return d, nil
+}
+
+func (d *dockerDriver) Command(command string) ([]string, error) {
+	return appendContainerCommand(append(append([]string{}, d.dockerRun...), "--"), command)
+}
+
+// Cleanup remove the container left running if docker-run is killed or
+// supervisord exits without stopping it
+func (d *dockerDriver) Cleanup() {
+	if err := dockerrun.Remove(d.host, d.container); err != nil {
+		log.WithFields(log.Fields{"container": d.container, "err": err}).Debug("no container to remove")
+	}
+}
+
+// containerdDriver run the command in a containerd container with the ctr
+// command line, the image must be pulled in the namespace before
+type containerdDriver struct {
+	containerSettings
+	// the command line with its global options
+	ctr []string
+	env []string
+	// the file of the environment passed to ctr, removed by Cleanup
+	envFile string
+}
+
+func newContainerdDriver(entry *config.Entry) (*containerdDriver, error) {
+	settings, err := getContainerSettings(entry)
+	if err != nil {
+		return nil, err
+	}
+	ctr := []string{entry.GetString("runner_command", "ctr")}
+	if socket := entry.GetString("containerd_socket", ""); socket != "" {
+		ctr = append(ctr, "--address", socket)
+	}
+	ctr = append(ctr, "--namespace", entry.GetString("containerd_namespace", "default"))
+	return &containerdDriver{containerSettings: settings, ctr: ctr, env: entry.GetEnv("environment")}, nil
+}
+
+func (d *containerdDriver) Command(command string) ([]string, error) {
+	args := append(append([]string{}, d.ctr...), "run", "--rm")
+	for _, volume := range d.volumes {
+		// the volume is "src:dst" or "src:dst:ro" like docker
+		parts := strings.SplitN(volume, ":", 3)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid volume %s", volume)
+		}
+		options := "rbind:rw"
+		if len(parts) == 3 && parts[2] == "ro" {
+			options = "rbind:ro"
+		}
+		args = append(args, "--mount", fmt.Sprintf("type=bind,src=%s,dst=%s,options=%s", parts[0], parts[1], options))
+	}
+	// the values of the environment are kept out of the command line in a
+	// file only readable by the user of supervisord
+	if len(d.env) > 0 {
+		envFile, err := writeEnvFile(d.env)
+		if err != nil {
+			return nil, err
+		}
+		d.envFile = envFile
+		args = append(args, "--env-file", envFile)
+	}
+	return appendContainerCommand(append(args, d.image, d.container), command)
+}
+
+// write the "key=value" environment in a temporary file, one per line
+func writeEnvFile(env []string) (string, error) {
+	for _, e := range env {
+		if strings.ContainsAny(e, "\r\n") {
+			return "", fmt.Errorf("the environment variable %s has a multi-line value", strings.SplitN(e, "=", 2)[0])
+		}
+	}
+	f, err := ioutil.TempFile("", "supervisord-env-")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.WriteString(strings.Join(env, "\n") + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Cleanup remove the environment file, kill the task and remove the container
+// left if the ctr command is killed or supervisord exits without stopping it
+func (d *containerdDriver) Cleanup() {
+	if d.envFile != "" {
+		os.Remove(d.envFile)
+		d.envFile = ""
+	}
+	runCleanup(d.container, append(append([]string{}, d.ctr...), "task", "rm", "-f", d.container))
+	runCleanup(d.container, append(append([]string{}, d.ctr...), "container", "rm", d.container))
+}
+
+// run the command removing the container, it fails if there is no container left
+func runCleanup(container string, args []string) {
+	out := bytes.Buffer{}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := RunCommand(cmd); err != nil {
+		log.WithFields(log.Fields{"container": container, "output": strings.TrimSpace(out.String())}).Debug("no container to remove")
+	}
+}
+
+// wasmDriver run the WebAssembly module of the command in the wazero sandbox
+// with the wasm-run subcommand of supervisord
+type wasmDriver struct {
+	supervisord string
+	maxMemory   int
+	mounts      []string
+	env         []string
+}
+
+// get the supervisord executable running the subcommands of the runners
+func getSupervisordCommand(entry *config.Entry) (string, error) {
+	if supervisord := entry.GetString("runner_command", ""); supervisord != "" {
+		return supervisord, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("fail to find the supervisord executable: %v", err)
+	}
+	return exe, nil
+}
+
+func newWasmDriver(entry *config.Entry) (*wasmDriver, error) {
+	supervisord, err := getSupervisordCommand(entry)
+	if err != nil {
+		return nil, err
+	}
+	d := &wasmDriver{supervisord: supervisord,
+		maxMemory: entry.GetBytes("wasm_max_memory", 0),
+		mounts:    make([]string, 0),
+		// only the environment of the program is visible to the module
+		env: getEnvNames(entry)}
+	for _, volume := range entry.GetStringArray("volumes", ",") {
+		if volume = strings.TrimSpace(volume); volume != "" {
+			d.mounts = append(d.mounts, volume)
+		}
+	}
+	return d, nil
+}
+
+func (d *wasmDriver) Command(command string) ([]string, error) {
+	module, err := parseCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{d.supervisord, "wasm-run"}
+	if d.maxMemory > 0 {
+		args = append(args, "--max-memory", fmt.Sprintf("%d", d.maxMemory))
+	}
+	for _, mount := range d.mounts {
+		args = append(args, "--mount", mount)
+	}
+	for _, env := range d.env {
+		args = append(args, "--env", env)
+	}
+	return append(append(args, "--"), module...), nil
+}
+
+func (d *wasmDriver) Cleanup() {
+}
+
+// sshDriver run the command on a remote machine with the ssh-run subcommand of
+// supervisord, the signals are forwarded to the remote command and its exit
+// code is the exit code of ssh-run
+type sshDriver struct {
+	// the command line of ssh-run with its options
+	sshRun []string
+}
+
+func newSSHDriver(entry *config.Entry) (*sshDriver, error) {
+	host, key := entry.GetString("ssh_host", ""), entry.GetString("ssh_key", "")
+	if host == "" || key == "" {
+		return nil, fmt.Errorf("no ssh_host or ssh_key for the ssh runner")
+	}
+	supervisord, err := getSupervisordCommand(entry)
+	if err != nil {
+		return nil, err
+	}
+	d := &sshDriver{sshRun: []string{supervisord, "ssh-run", "--host", host, "--key", key}}
+	if user := entry.GetString("ssh_user", ""); user != "" {
+		d.sshRun = append(d.sshRun, "--user", user)
+	}
+	if knownHosts := entry.GetString("ssh_known_hosts", ""); knownHosts != "" {
+		d.sshRun = append(d.sshRun, "--known-hosts", knownHosts)
+	}
+	for _, name := range getEnvNames(entry) {
+		d.sshRun = append(d.sshRun, "--env", name)
+	}
+	return d, nil
+}
+
+// Command run the command by the shell of the remote user as it is
+func (d *sshDriver) Command(command string) ([]string, error) {
+	if strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("no command from empty string")
+	}
+	return append(append(append([]string{}, d.sshRun...), "--"), command), nil
+}
+
+func (d *sshDriver) Cleanup() {
+}
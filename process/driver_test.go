@@ -0,0 +1,186 @@
+// +build !windows
+
+package process
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"supervisord/internal/testutil"
+)
+
+func TestPodmanDriver(t *testing.T) {
+	dir := testutil.TempDir(t)
+	calls := filepath.Join(dir, "calls")
+	// the fake podman command records its arguments and runs the container until it is stopped
+	podman := testutil.WriteFile(t, dir, "podman.sh", "#!/bin/sh\necho \"$@\" >> "+calls+"\nif [ \"$1\" = run ]; then exec sleep 1000; fi\n")
+	os.Chmod(podman, 0755)
+
+	proc := createTestProcesses(t, "[program:web]\ncommand=nginx -g \"daemon off;\"\nrunner=podman\nimage=nginx:1.25\nvolumes=/srv/www:/usr/share/nginx/html,/srv/conf:/etc/nginx/conf.d\n"+
+		"environment=MODE=prod\nrunner_command="+podman+"\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n")[0]
+	proc.Start(true)
+	if proc.GetState() != Running {
+		t.Fatal("fail to start the program with the podman runner")
+	}
+	testutil.WaitFor(5*time.Second, func() bool {
+		b, _ := ioutil.ReadFile(calls)
+		return strings.Contains(string(b), "run")
+	})
+	proc.Stop(true)
+	if !testutil.WaitFor(5*time.Second, func() bool {
+		b, _ := ioutil.ReadFile(calls)
+		return strings.Count(string(b), "rm -f supervisord-web") == 2
+	}) {
+		t.Error("fail to remove the container before and after it runs")
+	}
+	b, _ := ioutil.ReadFile(calls)
+	expected := "run --rm -i --name supervisord-web -v /srv/www:/usr/share/nginx/html -v /srv/conf:/etc/nginx/conf.d -e MODE nginx:1.25 nginx -g daemon off;"
+	if lines := strings.Split(string(b), "\n"); len(lines) < 2 || lines[1] != expected {
+		t.Errorf("fail to run the container with the podman command: %q", string(b))
+	}
+
+	if _, err := getDriver(createTestProcesses(t, "[program:web]\ncommand=ls\nrunner=podman\n")[0].config); err == nil {
+		t.Error("fail to refuse the podman runner without image")
+	}
+	if _, err := getDriver(createTestProcesses(t, "[program:web]\ncommand=ls\nrunner=vm\n")[0].config); err == nil {
+		t.Error("fail to refuse the unknown runner")
+	}
+}
+
+func TestDockerDriver(t *testing.T) {
+	dir := testutil.TempDir(t)
+	// the fake Engine API records the removed containers
+	listener, err := net.Listen("unix", filepath.Join(dir, "docker.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed := make(chan string, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		removed <- r.Method + " " + r.URL.String()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	entry := createTestProcesses(t, "[program:web]\ncommand=nginx -g \"daemon off;\"\nrunner=docker\nrunner_command=/usr/bin/supervisord\nimage=nginx:1.25\n"+
+		"docker_host=unix://"+dir+"/docker.sock\nvolumes=/srv/www:/usr/share/nginx/html\nenvironment=MODE=prod\n")[0].config
+	driver, err := getDriver(entry)
+	if err != nil {
+		t.Fatalf("fail to create the docker driver: %v", err)
+	}
+	args, err := driver.Command(entry.GetStringExpression("command", ""))
+	expected := []string{"/usr/bin/supervisord", "docker-run", "--name", "supervisord-web", "--image", "nginx:1.25", "--host", "unix://" + dir + "/docker.sock",
+		"--volume", "/srv/www:/usr/share/nginx/html", "--env", "MODE", "--", "nginx", "-g", "daemon off;"}
+	if err != nil || strings.Join(args, "|") != strings.Join(expected, "|") {
+		t.Errorf("fail to run the container with docker-run: %v %v", args, err)
+	}
+	driver.Cleanup()
+	select {
+	case call := <-removed:
+		if call != "DELETE /v1.40/containers/supervisord-web?force=1" {
+			t.Errorf("fail to remove the container by the Engine API: %s", call)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("fail to remove the container left running")
+	}
+
+	if _, err := getDriver(createTestProcesses(t, "[program:web]\ncommand=ls\nrunner=docker\n")[0].config); err == nil {
+		t.Error("fail to refuse the docker runner without image")
+	}
+}
+
+func TestContainerRunners(t *testing.T) {
+	tests := []struct {
+		config   string
+		expected string
+	}{
+		{"runner=podman\npodman_socket=/run/podman/podman.sock\n",
+			"podman --url unix:///run/podman/podman.sock run --rm -i --name supervisord-web -v /srv/www:/www:ro -e MODE nginx:1.25 nginx -g daemon off;"},
+	}
+	for _, test := range tests {
+		entry := createTestProcesses(t, "[program:web]\ncommand=nginx -g \"daemon off;\"\nimage=nginx:1.25\nvolumes=/srv/www:/www:ro\nenvironment=MODE=prod\n"+test.config)[0].config
+		driver, err := getDriver(entry)
+		if err != nil {
+			t.Fatalf("fail to create the driver: %v", err)
+		}
+		args, err := driver.Command(entry.GetStringExpression("command", ""))
+		if err != nil || strings.Join(args, " ") != test.expected {
+			t.Errorf("fail to run the container: %v %v", args, err)
+		}
+	}
+}
+
+func TestContainerdDriver(t *testing.T) {
+	entry := createTestProcesses(t, "[program:web]\ncommand=nginx -g \"daemon off;\"\nrunner=containerd\ncontainerd_namespace=apps\nimage=nginx:1.25\n"+
+		"volumes=/srv/www:/www:ro\nenvironment=MODE=prod,TOKEN=s3cret\n")[0].config
+	driver, err := getDriver(entry)
+	if err != nil {
+		t.Fatalf("fail to create the containerd driver: %v", err)
+	}
+	args, err := driver.Command(entry.GetStringExpression("command", ""))
+	if err != nil || len(args) != 14 {
+		t.Fatalf("fail to run the container: %v %v", args, err)
+	}
+	envFile := args[8]
+	expected := "ctr --namespace apps run --rm --mount type=bind,src=/srv/www,dst=/www,options=rbind:ro --env-file " + envFile + " nginx:1.25 supervisord-web nginx -g daemon off;"
+	if strings.Join(args, " ") != expected {
+		t.Errorf("fail to run the container with the environment file: %v", args)
+	}
+	info, err := os.Stat(envFile)
+	b, _ := ioutil.ReadFile(envFile)
+	if err != nil || info.Mode().Perm() != 0600 || string(b) != "MODE=prod\nTOKEN=s3cret\n" {
+		t.Errorf("fail to write the environment file: %q %v", string(b), err)
+	}
+	driver.Cleanup()
+	if _, err := os.Stat(envFile); !os.IsNotExist(err) {
+		t.Error("fail to remove the environment file")
+	}
+
+	if _, err := writeEnvFile([]string{"MODE=a\nb"}); err == nil {
+		t.Error("fail to refuse the multi-line environment")
+	}
+}
+
+func TestWasmDriver(t *testing.T) {
+	entry := createTestProcesses(t, "[program:plugin]\ncommand=/opt/plugin.wasm --verbose\nrunner=wasm\nrunner_command=/usr/bin/supervisord\n"+
+		"wasm_max_memory=64MB\nvolumes=/srv/data:/data:ro\nenvironment=MODE=prod,TOKEN=s3cret\n")[0].config
+	driver, err := getDriver(entry)
+	if err != nil {
+		t.Fatalf("fail to create the wasm driver: %v", err)
+	}
+	args, err := driver.Command(entry.GetStringExpression("command", ""))
+	expected := "/usr/bin/supervisord wasm-run --max-memory 67108864 --mount /srv/data:/data:ro --env MODE --env TOKEN -- /opt/plugin.wasm --verbose"
+	if err != nil || strings.Join(args, " ") != expected {
+		t.Errorf("fail to run the module with wasm-run: %v %v", args, err)
+	}
+	for _, arg := range args {
+		if strings.Contains(arg, "prod") || strings.Contains(arg, "s3cret") {
+			t.Errorf("fail to keep the value of the environment out of the command line: %v", args)
+		}
+	}
+}
+
+func TestSSHDriver(t *testing.T) {
+	entry := createTestProcesses(t, "[program:backup]\ncommand=/usr/local/bin/backup --full\nrunner=ssh\nrunner_command=/usr/bin/supervisord\n"+
+		"ssh_host=edge-01:2222\nssh_user=ops\nssh_key=/etc/supervisord/id_ed25519\nenvironment=MODE=prod\n")[0].config
+	driver, err := getDriver(entry)
+	if err != nil {
+		t.Fatalf("fail to create the ssh driver: %v", err)
+	}
+	args, err := driver.Command(entry.GetStringExpression("command", ""))
+	expected := []string{"/usr/bin/supervisord", "ssh-run", "--host", "edge-01:2222", "--key", "/etc/supervisord/id_ed25519", "--user", "ops", "--env", "MODE", "--", "/usr/local/bin/backup --full"}
+	if err != nil || strings.Join(args, "|") != strings.Join(expected, "|") {
+		t.Errorf("fail to run the command with ssh-run: %v %v", args, err)
+	}
+	if _, err := getDriver(createTestProcesses(t, "[program:backup]\ncommand=ls\nrunner=ssh\nssh_host=edge-01\n")[0].config); err == nil {
+		t.Error("fail to refuse the ssh runner without key")
+	}
+}
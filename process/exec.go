@@ -0,0 +1,54 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"syscall"
+)
+
+// Exec run the command in the context of the program without affecting it:
+// with its user, its environment (the one of the running process if it is
+// running), its working directory and in its cgroup. The output and the
+// error of the command are written to output, its exit status is returned
+// (-1 if it is killed because the context is done)
+func (p *Process) Exec(ctx context.Context, command string, output io.Writer) (int, error) {
+	if runner := p.config.GetString("runner", "exec"); runner != "exec" {
+		return 0, fmt.Errorf("the program %s runs with the %s runner, only the programs of the exec runner can be entered", p.GetName(), runner)
+	}
+	args, err := parseCommand(command)
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	if err := p.setCommandUser(cmd); err != nil {
+		return 0, fmt.Errorf("fail to run as the user of %s: %v", p.GetName(), err)
+	}
+	setDeathsig(cmd.SysProcAttr)
+	setNoConsoleWindow(cmd.SysProcAttr)
+	p.lock.RLock()
+	if p.cmd != nil && p.cmd.Process != nil && p.cmd.Env != nil {
+		cmd.Env = append([]string{}, p.cmd.Env...)
+	}
+	p.lock.RUnlock()
+	if cmd.Env == nil {
+		cmd.Env = p.getEnv()
+	}
+	cmd.Dir = p.getDir()
+	cmd.Stdout = output
+	cmd.Stderr = output
+	coreLimitLock.RLock()
+	err = startInCgroup(p.GetName(), cmd, p.config.GetString("cgroup", ""))
+	coreLimitLock.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Wait(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return 0, err
+		}
+	}
+	return cmd.ProcessState.ExitCode(), nil
+}
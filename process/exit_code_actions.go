@@ -0,0 +1,81 @@
+package process
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the actions of the exit codes in exit_code_actions
+const (
+	exitCodeIgnore  = "ignore"  // the exit is expected, the program is not restarted
+	exitCodeFatal   = "fatal"   // the program is put in FATAL state without restart
+	exitCodeRestart = "restart" // the program is restarted, after a delay with "restart-after-60s"
+)
+
+// ExitCodeAction the action taken when the program exits with a code
+type ExitCodeAction struct {
+	Action string
+	// the pause before restarting the program
+	Delay time.Duration
+}
+
+// ParseExitCodeActions parse the exit_code_actions setting like
+// "143:ignore,2:fatal,75:restart-after-60s"
+func ParseExitCodeActions(s string) (map[int]ExitCodeAction, error) {
+	result := make(map[int]ExitCodeAction)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pos := strings.Index(item, ":")
+		if pos == -1 {
+			return nil, fmt.Errorf("invalid exit code action %q, the format is <code>:<action>", item)
+		}
+		code, err := strconv.Atoi(strings.TrimSpace(item[0:pos]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid exit code in %q", item)
+		}
+		action := strings.ToLower(strings.TrimSpace(item[pos+1:]))
+		switch {
+		case action == exitCodeIgnore || action == exitCodeFatal || action == exitCodeRestart:
+			result[code] = ExitCodeAction{Action: action}
+		case strings.HasPrefix(action, exitCodeRestart+"-after-"):
+			delay, err := time.ParseDuration(action[len(exitCodeRestart+"-after-"):])
+			if err != nil || delay < 0 {
+				return nil, fmt.Errorf("invalid restart delay in %q", item)
+			}
+			result[code] = ExitCodeAction{Action: exitCodeRestart, Delay: delay}
+		default:
+			return nil, fmt.Errorf("unknown exit code action %q, must be ignore, fatal, restart or restart-after-<duration>", action)
+		}
+	}
+	return result, nil
+}
+
+// get the action of the exit code in exit_code_actions
+func (p *Process) getExitCodeAction(exitCode int) (ExitCodeAction, bool) {
+	actions, err := ParseExitCodeActions(p.config.GetString("exit_code_actions", ""))
+	if err != nil {
+		log.WithFields(log.Fields{"program": p.GetName(), log.ErrorKey: err}).Error("invalid exit_code_actions")
+		return ExitCodeAction{}, false
+	}
+	action, ok := actions[exitCode]
+	return action, ok
+}
+
+// get the action of the exit code of the exited program, must be called with the lock hold
+func (p *Process) getExitedAction() (ExitCodeAction, bool) {
+	if p.cmd == nil || p.cmd.ProcessState == nil {
+		return ExitCodeAction{}, false
+	}
+	exitCode, err := p.getExitCode()
+	if err != nil {
+		return ExitCodeAction{}, false
+	}
+	return p.getExitCodeAction(exitCode)
+}
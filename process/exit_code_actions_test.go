@@ -0,0 +1,42 @@
+package process
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExitCodeActions(t *testing.T) {
+	actions, err := ParseExitCodeActions("143:ignore, 2:fatal,75:restart-after-60s,1:restart")
+	if err != nil {
+		t.Fatalf("fail to parse the exit code actions: %v", err)
+	}
+	expected := map[int]ExitCodeAction{143: {Action: exitCodeIgnore},
+		2:  {Action: exitCodeFatal},
+		75: {Action: exitCodeRestart, Delay: time.Minute},
+		1:  {Action: exitCodeRestart}}
+	if len(actions) != len(expected) {
+		t.Fatalf("fail to parse all the exit code actions: %v", actions)
+	}
+	for code, action := range expected {
+		if actions[code] != action {
+			t.Errorf("fail to parse the action of exit code %d: %v", code, actions[code])
+		}
+	}
+	for _, s := range []string{"143", "x:ignore", "2:stop", "75:restart-after-1y"} {
+		if _, err := ParseExitCodeActions(s); err == nil {
+			t.Errorf("fail to reject the invalid exit code actions %q", s)
+		}
+	}
+}
+
+func TestExitCodeActions(t *testing.T) {
+	proc := createTestProcesses(t, "[program:test]\ncommand=sh -c \"exit 3\"\nstartsecs=5\nstartretries=10\nexit_code_actions=3:fatal,143:ignore\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n")[0]
+	if !proc.inExitCodes(143) || proc.inExitCodes(3) {
+		t.Error("fail to expect the ignored exit code")
+	}
+	start := time.Now()
+	proc.Start(true)
+	if proc.GetState() != Fatal || time.Since(start) > 2*time.Second {
+		t.Errorf("fail to put the program in FATAL state without retry: %v", proc.GetState())
+	}
+}
@@ -0,0 +1,112 @@
+package process
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ochinchina/supervisord/logger"
+)
+
+// LogFile a log file of the program, the current one, a backup or a rotated
+// file waiting to be archived
+type LogFile struct {
+	Stream  string    `json:"stream"` // stdout or stderr
+	Kind    string    `json:"kind"`   // current, backup or archive
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	// the hex sha256 of the content, empty if it is not computed
+	Checksum string `json:"sha256,omitempty"`
+}
+
+// GetLogFiles get the log files of the stdout and stderr of the program, the
+// current file first and the backups from the latest one. If checksum is true,
+// the sha256 of the files are computed
+func (p *Process) GetLogFiles(checksum bool) []LogFile {
+	stdout, stderr := p.GetLogfilePaths()
+	files := getLogFiles("stdout", stdout)
+	if stderr != "" && stderr != stdout {
+		files = append(files, getLogFiles("stderr", stderr)...)
+	}
+	if checksum {
+		for i := range files {
+			files[i].Checksum, _ = fileChecksum(files[i].Path)
+		}
+	}
+	return files
+}
+
+// GetLogBytes get the total size of the log files of the program
+func (p *Process) GetLogBytes() int64 {
+	var total int64
+	for _, f := range p.GetLogFiles(false) {
+		total += f.Size
+	}
+	return total
+}
+
+// the order of the backups of a log file, the latest backup first
+type logFileOrder struct {
+	file  LogFile
+	kind  int
+	index int
+}
+
+func getLogFiles(stream string, name string) []LogFile {
+	if name == "" {
+		return nil
+	}
+	candidates, _ := filepath.Glob(name + ".*")
+	candidates = append([]string{name}, candidates...)
+	files := make([]logFileOrder, 0)
+	for _, path := range candidates {
+		order := logFileOrder{file: LogFile{Stream: stream, Path: path}}
+		suffix := strings.TrimPrefix(path, name)
+		if suffix == "" {
+			order.file.Kind = "current"
+		} else if n, err := strconv.Atoi(suffix[1:]); err == nil && n > 0 {
+			order.file.Kind, order.kind, order.index = "backup", 1, n
+		} else if strings.HasPrefix(suffix, logger.ArchiveSuffix) {
+			order.file.Kind, order.kind = "archive", 2
+		} else {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		order.file.Size, order.file.ModTime = info.Size(), info.ModTime()
+		files = append(files, order)
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].kind != files[j].kind {
+			return files[i].kind < files[j].kind
+		}
+		return files[i].index < files[j].index
+	})
+	result := make([]LogFile, 0, len(files))
+	for _, f := range files {
+		result = append(result, f.file)
+	}
+	return result
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,122 @@
+package process
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ochinchina/supervisord/logger"
+)
+
+func TestGetLogFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal("fail to create temporary directory")
+	}
+	defer os.RemoveAll(dir)
+	stdout := filepath.Join(dir, "web.log")
+	for name, content := range map[string]string{"web.log": "current\n", "web.log.1": "backup 1\n", "web.log.10": "backup 10\n",
+		"web.log.2": "backup 2\n", "web.log.archive-20260101T000000.000000000": "archive\n", "web.log.lock": "", "web.err": "error\n"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	proc := createTestProcesses(t, "[program:web]\ncommand=ls\nstdout_logfile="+stdout+"\nstderr_logfile="+filepath.Join(dir, "web.err")+"\n")[0]
+
+	files := proc.GetLogFiles(true)
+	expected := []string{"web.log", "web.log.1", "web.log.2", "web.log.10", "web.log.archive-20260101T000000.000000000", "web.err"}
+	if len(files) != len(expected) {
+		t.Fatalf("fail to list the log files: %v", files)
+	}
+	for i, f := range files {
+		if filepath.Base(f.Path) != expected[i] {
+			t.Errorf("fail to list the log file %s at %d: %s", expected[i], i, f.Path)
+		}
+	}
+	if files[0].Kind != "current" || files[0].Size != 8 || files[1].Kind != "backup" || files[4].Kind != "archive" || files[5].Stream != "stderr" {
+		t.Errorf("fail to get the log file information: %v", files)
+	}
+	// sha256 of "current\n"
+	if files[0].Checksum != "48aa6cae8c70abdb28631d22b316e6d9f9d0768ec2911de7090e248b2afe6ca1" || proc.GetLogFiles(false)[0].Checksum != "" {
+		t.Errorf("fail to compute the checksum of the log file: %s", files[0].Checksum)
+	}
+	if proc.GetLogBytes() != 8+9+10+9+8+6 {
+		t.Errorf("fail to get the total size of the log files: %d", proc.GetLogBytes())
+	}
+}
+
+func TestSearchLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal("fail to create temporary directory")
+	}
+	defer os.RemoveAll(dir)
+	stdout := filepath.Join(dir, "web.log")
+	now := time.Now()
+	for i, f := range []struct{ name, content string }{
+		{"web.log.2", "start\nerror: disk full\n"},
+		{"web.log.1", "ok\nerror: timeout\nok\n"},
+		{"web.log", "error: refused\n"},
+	} {
+		ioutil.WriteFile(filepath.Join(dir, f.name), []byte(f.content), 0644)
+		mtime := now.Add(time.Duration(i-2) * time.Hour)
+		os.Chtimes(filepath.Join(dir, f.name), mtime, mtime)
+	}
+	proc := createTestProcesses(t, "[program:web]\ncommand=ls\nstdout_logfile="+stdout+"\n")[0]
+	search := LogSearch{Pattern: regexp.MustCompile("^error"), Stream: "stdout", Limit: 10}
+
+	result := proc.SearchLogs(context.Background(), search)
+	if len(result.Matches) != 3 || result.Truncated {
+		t.Fatalf("fail to search the log files: %v", result)
+	}
+	if m := result.Matches[1]; filepath.Base(m.Path) != "web.log.1" || m.Kind != "backup" || m.Offset != 3 || m.Line != "error: timeout" {
+		t.Errorf("fail to get the matched line in the backup: %v", m)
+	}
+	if filepath.Base(result.Matches[0].Path) != "web.log.2" || filepath.Base(result.Matches[2].Path) != "web.log" {
+		t.Error("fail to search the log files from the oldest one")
+	}
+
+	search.Limit = 2
+	if result = proc.SearchLogs(context.Background(), search); len(result.Matches) != 2 || !result.Truncated {
+		t.Error("fail to limit the matched lines")
+	}
+	search.Limit = 10
+	search.Since, search.Until = now.Add(-90*time.Minute), now.Add(-70*time.Minute)
+	if result = proc.SearchLogs(context.Background(), search); len(result.Matches) != 1 || result.Matches[0].Line != "error: timeout" {
+		t.Errorf("fail to search the log files in the time range: %v", result.Matches)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if result = proc.SearchLogs(ctx, LogSearch{Pattern: search.Pattern, Limit: 10}); len(result.Matches) != 0 || !result.Truncated {
+		t.Error("fail to stop the search when the context is done")
+	}
+}
+
+func TestLogSeverity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal("fail to create temporary directory")
+	}
+	defer os.RemoveAll(dir)
+	stdout := filepath.Join(dir, "web.log")
+	ioutil.WriteFile(stdout, []byte("INFO start\nERROR disk full\nWARN slow\ndone\n"), 0644)
+	proc := createTestProcesses(t, "[program:web]\ncommand=ls\nstdout_logfile="+stdout+
+		"\nlog_severity_error=^(ERROR|FATAL)\nlog_severity_warning=^WARN\nlog_severity_info=^INFO\nlog_severity_debug=(\n")[0]
+	if rules := proc.GetSeverityRules(); len(rules) != 3 || rules[0].Severity != logger.SeverityError {
+		t.Fatalf("fail to get the severity rules: %v", rules)
+	}
+
+	w := proc.withLastOutput(ioutil.Discard)
+	w.Write([]byte("INFO start\nERR"))
+	w.Write([]byte("OR failed\nFATAL crash\nWARN"))
+	if proc.GetLogLines(logger.SeverityError) != 2 || proc.GetLogLines(logger.SeverityInfo) != 1 || proc.GetLogLines(logger.SeverityWarning) != 0 {
+		t.Error("fail to count the log lines by severity")
+	}
+
+	result := proc.SearchLogs(context.Background(), LogSearch{Pattern: regexp.MustCompile("."), Stream: "stdout", Limit: 10, MinSeverity: logger.SeverityWarning})
+	if len(result.Matches) != 2 || result.Matches[0].Severity != "error" || result.Matches[1].Line != "WARN slow" {
+		t.Errorf("fail to search the log lines by severity: %v", result.Matches)
+	}
+}
@@ -0,0 +1,128 @@
+package process
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ochinchina/supervisord/logger"
+)
+
+// the max length of a matched line returned by the search, the longer lines are truncated
+const maxSearchLineLength = 4096
+
+// LogSearch the search of a regular expression in the log files of a program
+type LogSearch struct {
+	Pattern *regexp.Regexp
+	// the stream searched, stdout or stderr
+	Stream string
+	// the files modified before since or created after until are skipped, zero for no limit
+	Since time.Time
+	Until time.Time
+	// the max number of the matched lines
+	Limit int
+	// the lines with a lower severity are skipped, SeverityUnknown for all the lines
+	MinSeverity logger.Severity
+}
+
+// LogMatch a line matching the search
+type LogMatch struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+	// the byte offset of the line in the file
+	Offset int64  `json:"offset"`
+	Line   string `json:"line"`
+	// the severity of the line if the program has severity rules
+	Severity string `json:"severity,omitempty"`
+}
+
+// LogSearchResult the matched lines from the oldest one
+type LogSearchResult struct {
+	Matches []LogMatch `json:"matches"`
+	// true if the search is stopped by the limit or the context
+	Truncated bool `json:"truncated"`
+}
+
+// SearchLogs search the lines matching the regular expression in the rotated
+// and the current log files of the stream from the oldest file. The search
+// stops at the limit of the matched lines or when the context is done
+func (p *Process) SearchLogs(ctx context.Context, search LogSearch) LogSearchResult {
+	stdout, stderr := p.GetLogfilePaths()
+	name := stdout
+	if search.Stream == "stderr" {
+		name = stderr
+	}
+	result := LogSearchResult{Matches: make([]LogMatch, 0)}
+	rules := p.GetSeverityRules()
+	files := getLogFiles(search.Stream, name)
+	// from the oldest file: the archives, the backups from the last one and the current file
+	ordered := make([]LogFile, 0, len(files))
+	for i := len(files) - 1; i >= 0; i-- {
+		if files[i].Kind == "archive" {
+			ordered = append(ordered, files[i])
+		}
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		if files[i].Kind != "archive" {
+			ordered = append(ordered, files[i])
+		}
+	}
+	for i, f := range ordered {
+		// the file is written from the modification time of the previous file to its modification time
+		if !search.Since.IsZero() && f.ModTime.Before(search.Since) {
+			continue
+		}
+		if !search.Until.IsZero() && i > 0 && ordered[i-1].ModTime.After(search.Until) {
+			break
+		}
+		if !searchLogFile(ctx, f, search, rules, &result) {
+			result.Truncated = true
+			break
+		}
+	}
+	return result
+}
+
+// search the lines of the file, return false if the search is stopped
+func searchLogFile(ctx context.Context, f LogFile, search LogSearch, rules logger.SeverityRules, result *LogSearchResult) bool {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return true
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var offset int64
+	for n := 0; ; n++ {
+		// check the context every 1024 lines
+		if n%1024 == 0 && ctx.Err() != nil {
+			return false
+		}
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			text := strings.TrimRight(line, "\r\n")
+			if search.Pattern.MatchString(text) {
+				severity := rules.Detect([]byte(text))
+				if severity >= search.MinSeverity {
+					if len(result.Matches) >= search.Limit {
+						return false
+					}
+					if len(text) > maxSearchLineLength {
+						text = text[:maxSearchLineLength]
+					}
+					match := LogMatch{Path: f.Path, Kind: f.Kind, Offset: offset, Line: text}
+					if len(rules) > 0 {
+						match.Severity = severity.String()
+					}
+					result.Matches = append(result.Matches, match)
+				}
+			}
+			offset += int64(len(line))
+		}
+		if err != nil {
+			return true
+		}
+	}
+}
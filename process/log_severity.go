@@ -0,0 +1,36 @@
+package process
+
+import (
+	"regexp"
+
+	"github.com/ochinchina/supervisord/logger"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetSeverityRules get the rules detecting the severity of the log lines
+// from the log_severity_critical, log_severity_error, log_severity_warning,
+// log_severity_info and log_severity_debug regular expressions, checked from
+// the highest severity. The invalid expressions are ignored
+func (p *Process) GetSeverityRules() logger.SeverityRules {
+	rules := make(logger.SeverityRules, 0)
+	for _, severity := range logger.Severities() {
+		key := "log_severity_" + severity.String()
+		expr := p.config.GetString(key, "")
+		if expr == "" {
+			continue
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			log.WithFields(log.Fields{"program": p.GetName(), "key": key, log.ErrorKey: err}).Error("invalid log severity rule")
+			continue
+		}
+		rules = append(rules, logger.SeverityRule{Severity: severity, Pattern: pattern})
+	}
+	return rules
+}
+
+// GetLogLines get the number of the stdout and stderr lines with the severity
+// since supervisord is started
+func (p *Process) GetLogLines(severity logger.Severity) uint64 {
+	return p.logSeverity.Get(severity)
+}
@@ -0,0 +1,98 @@
+package process
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ochinchina/supervisord/events"
+)
+
+// MaintenanceWindow a maintenance window in progress, the automatic restarts
+// and the alerting events of the programs in its groups can be suppressed
+type MaintenanceWindow struct {
+	Name string `json:"name"`
+	// the groups (with their nested groups) and programs in maintenance, all the programs if empty
+	Groups []string  `json:"groups"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	// the programs exited are not restarted by their autorestart
+	SuppressRestarts bool `json:"suppressRestarts"`
+	// the events of the programs not emitted, like "PROCESS_STATE_FATAL"
+	SuppressEvents []string `json:"suppressEvents"`
+	// entered through the API instead of by its schedule
+	Manual bool `json:"manual"`
+
+	suppressedEvents *events.EventMatcher
+}
+
+var maintenanceWindows = make([]*MaintenanceWindow, 0)
+var maintenanceLock sync.RWMutex
+
+// SetMaintenanceWindows set the maintenance windows in progress
+func SetMaintenanceWindows(windows []MaintenanceWindow) {
+	result := make([]*MaintenanceWindow, 0, len(windows))
+	for i := range windows {
+		window := windows[i]
+		window.suppressedEvents = events.NewEventMatcher(window.SuppressEvents)
+		result = append(result, &window)
+	}
+	maintenanceLock.Lock()
+	defer maintenanceLock.Unlock()
+	maintenanceWindows = result
+}
+
+// GetMaintenanceWindows get the maintenance windows in progress
+func GetMaintenanceWindows() []MaintenanceWindow {
+	maintenanceLock.RLock()
+	defer maintenanceLock.RUnlock()
+	result := make([]MaintenanceWindow, 0, len(maintenanceWindows))
+	for _, window := range maintenanceWindows {
+		result = append(result, *window)
+	}
+	return result
+}
+
+// get the maintenance windows in progress of the program
+func (p *Process) getMaintenanceWindows() []*MaintenanceWindow {
+	maintenanceLock.RLock()
+	defer maintenanceLock.RUnlock()
+	result := make([]*MaintenanceWindow, 0)
+	for _, window := range maintenanceWindows {
+		if len(window.Groups) == 0 {
+			result = append(result, window)
+			continue
+		}
+		for _, group := range window.Groups {
+			if group == p.GetName() || group == p.GetGroup() {
+				result = append(result, window)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// InMaintenance check if the program is in a maintenance window
+func (p *Process) InMaintenance() bool {
+	return len(p.getMaintenanceWindows()) > 0
+}
+
+// check if the automatic restarts of the program are suppressed by a maintenance window
+func (p *Process) isRestartSuppressed() bool {
+	for _, window := range p.getMaintenanceWindows() {
+		if window.SuppressRestarts {
+			return true
+		}
+	}
+	return false
+}
+
+// emit the event of the program unless it is suppressed by a maintenance window
+func (p *Process) emitEvent(event events.Event) {
+	for _, window := range p.getMaintenanceWindows() {
+		if window.suppressedEvents.Match(event.GetType()) {
+			return
+		}
+	}
+	events.EmitEvent(event)
+}
@@ -0,0 +1,13 @@
+// +build !windows
+
+package process
+
+import (
+	"syscall"
+)
+
+// set the nice value of the process group of the program, its children
+// inherit it
+func setNice(pid int, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PGRP, pid, nice)
+}
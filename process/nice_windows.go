@@ -0,0 +1,11 @@
+// +build windows
+
+package process
+
+import (
+	"fmt"
+)
+
+func setNice(pid int, nice int) error {
+	return fmt.Errorf("the nice value is not supported on windows")
+}
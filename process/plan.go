@@ -0,0 +1,77 @@
+package process
+
+import (
+	"github.com/ochinchina/supervisord/types"
+)
+
+var planDescriptions = map[string]string{"start": "to be started", "stop": "to be stopped"}
+
+// PlanStart get the ordered steps to start the processes without starting them.
+// The processes are ordered by priority and dependencies and the running
+// processes are skipped
+func (pm *Manager) PlanStart(procs []*Process) []types.ActionStep {
+	return appendPlan(make([]types.ActionStep, 0), sortProcess(procs), "start")
+}
+
+// PlanStop get the ordered steps to stop the processes without stopping them.
+// The processes are stopped in the reverse order of starting and the processes
+// not running are skipped
+func (pm *Manager) PlanStop(procs []*Process) []types.ActionStep {
+	return appendPlan(make([]types.ActionStep, 0), reverseProcess(sortProcess(procs)), "stop")
+}
+
+// PlanRestart get the ordered steps to stop all the processes and start the autostart ones
+func (pm *Manager) PlanRestart() []types.ActionStep {
+	procs := make([]*Process, 0)
+	pm.ForEachProcess(func(proc *Process) {
+		procs = append(procs, proc)
+	})
+	procs = sortProcess(procs)
+	plan := appendPlan(make([]types.ActionStep, 0), reverseProcess(procs), "stop")
+	// all the processes are stopped before starting the autostart ones
+	for _, proc := range procs {
+		if proc.isAutoStart() {
+			plan = append(plan, createActionStep(len(plan)+1, "start", proc, planDescriptions["start"]))
+		}
+	}
+	return plan
+}
+
+func appendPlan(plan []types.ActionStep, procs []*Process, action string) []types.ActionStep {
+	for _, proc := range procs {
+		running := proc.isRunningState()
+		if action == "start" && running {
+			plan = append(plan, createActionStep(len(plan)+1, "skip", proc, "already running"))
+		} else if action == "stop" && !running {
+			plan = append(plan, createActionStep(len(plan)+1, "skip", proc, "not running"))
+		} else {
+			plan = append(plan, createActionStep(len(plan)+1, action, proc, planDescriptions[action]))
+		}
+	}
+	return plan
+}
+
+func createActionStep(step int, action string, proc *Process, description string) types.ActionStep {
+	return types.ActionStep{Step: step,
+		Action:      action,
+		Name:        proc.GetName(),
+		Group:       proc.GetGroup(),
+		Priority:    proc.GetPriority(),
+		DependsOn:   proc.config.GetString("depends_on", ""),
+		Statename:   proc.GetState().String(),
+		Description: description}
+}
+
+func reverseProcess(procs []*Process) []*Process {
+	result := make([]*Process, 0, len(procs))
+	for i := len(procs) - 1; i >= 0; i-- {
+		result = append(result, procs[i])
+	}
+	return result
+}
+
+// check if the process is in a state which needs to be stopped
+func (p *Process) isRunningState() bool {
+	state := p.GetState()
+	return state == Spawning || state == Starting || state == Running || state == Backoff
+}
@@ -0,0 +1,47 @@
+package process
+
+import (
+	"testing"
+)
+
+func createPlanProcesses(t *testing.T) []*Process {
+	return createTestProcesses(t, "[program:web]\ncommand=/bin/true\npriority=20\ndepends_on=db\n"+
+		"[program:db]\ncommand=/bin/true\npriority=10\n"+
+		"[program:cron]\ncommand=/bin/true\npriority=30\n")
+}
+
+func TestPlanStart(t *testing.T) {
+	procs := createPlanProcesses(t)
+	procs[0].state = Running
+	running := procs[0].GetName()
+
+	plan := NewManager().PlanStart(procs)
+	if len(plan) != 3 || plan[0].Name != "db" || plan[1].Name != "web" || plan[2].Name != "cron" {
+		t.Error("fail to order the start plan by dependencies and priority")
+	}
+	for i, step := range plan {
+		if step.Step != i+1 {
+			t.Error("fail to number the steps of plan")
+		}
+		if (step.Name == running) != (step.Action == "skip") {
+			t.Error("fail to skip the running process")
+		}
+	}
+}
+
+func TestPlanStop(t *testing.T) {
+	procs := createPlanProcesses(t)
+	for _, proc := range procs {
+		proc.state = Running
+	}
+
+	plan := NewManager().PlanStop(procs)
+	if len(plan) != 3 || plan[0].Name != "cron" || plan[1].Name != "web" || plan[2].Name != "db" {
+		t.Error("fail to order the stop plan in reverse order")
+	}
+	for _, step := range plan {
+		if step.Action != "stop" {
+			t.Error("fail to plan stopping the running process")
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package process
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -19,7 +20,9 @@ import (
 	"github.com/ochinchina/supervisord/config"
 	"github.com/ochinchina/supervisord/events"
 	"github.com/ochinchina/supervisord/logger"
+	"github.com/ochinchina/supervisord/secret"
 	"github.com/ochinchina/supervisord/signals"
+	"github.com/ochinchina/supervisord/types"
 	"github.com/robfig/cron/v3"
 	log "github.com/sirupsen/logrus"
 )
@@ -31,6 +34,9 @@ const (
 	// Stopped the stopped state
 	Stopped State = iota
 
+	// Spawning the OS process of the program is being created
+	Spawning = 5
+
 	// Starting the starting state
 	Starting = 10
 
@@ -65,6 +71,8 @@ func (p State) String() string {
 	switch p {
 	case Stopped:
 		return "Stopped"
+	case Spawning:
+		return "Spawning"
 	case Starting:
 		return "Starting"
 	case Running:
@@ -92,6 +100,18 @@ type Process struct {
 	state        State
 	//true if process is starting
 	inStart bool
+	//cancel the goroutine supervising the process
+	cancel context.CancelFunc
+	//closed when the goroutine supervising the process exits
+	done chan struct{}
+	//serialize the spawning of the OS process
+	spawnLock sync.Mutex
+	//true from the OS process is spawned until it is waited, guarded by spawnLock
+	spawned bool
+	//the driver of the last spawned OS process, guarded by spawnLock
+	driver Driver
+	//the state before Spawning, used as the from state of events
+	spawnFrom State
 	//true if the process is stopped by user
 	stopByUser bool
 	retryTimes *int32
@@ -99,6 +119,29 @@ type Process struct {
 	stdin      io.WriteCloser
 	StdoutLog  logger.Logger
 	StderrLog  logger.Logger
+	//the last output of the process kept in memory
+	lastOutput *logger.RingBuffer
+	//the number of the log lines by severity detected by the log_severity_* rules
+	logSeverity *logger.SeverityCounts
+	//the last state changes of the process
+	stateHistory []StateTransition
+	//the core file or core handler of the last exit
+	coreDump string
+	//the resolved configuration of the last spawned process
+	spawnConfig *SpawnConfig
+	//the reason why the program can't be started, cleared when it is spawned
+	spawnErr string
+	//the exit status of the last exited process
+	exitStatus int
+	//the manager enforcing the conflicts of the program, nil if not managed
+	manager *Manager
+	//the throttling in progress, nil if the program is not throttled
+	throttling   *throttling
+	throttleLock sync.Mutex
+	//the resource limits changed at runtime until the next reload, nil if unchanged
+	limitsOverride *types.ResourceLimits
+	//the KEY=VALUE environment overrides of the current start only
+	startEnv []string
 }
 
 // NewProcess create a new Process
@@ -114,6 +157,7 @@ func NewProcess(supervisorID string, config *config.Entry) *Process {
 		retryTimes: new(int32)}
 	proc.config = config
 	proc.cmd = nil
+	proc.logSeverity = &logger.SeverityCounts{}
 	proc.addToCron()
 	return proc
 }
@@ -125,6 +169,10 @@ func (p *Process) addToCron() {
 	if s != "" {
 		log.WithFields(log.Fields{"program": p.GetName()}).Info("try to create cron program with cron expression:", s)
 		scheduler.AddFunc(s, func() {
+			if IsStandby() {
+				log.WithFields(log.Fields{"program": p.GetName()}).Info("Don't start cron program in standby mode")
+				return
+			}
 			log.WithFields(log.Fields{"program": p.GetName()}).Info("start cron program")
 			if !p.isRunning() {
 				p.Start(false)
@@ -138,55 +186,141 @@ func (p *Process) addToCron() {
 // Args:
 //  wait - true, wait the program started or failed
 func (p *Process) Start(wait bool) {
+	p.StartContext(context.Background(), wait)
+}
+
+// StartContext start the process like Start. If wait is true, the waiting
+// ends when the context is done and the error of the context is returned,
+// the process is still being started in background
+func (p *Process) StartContext(ctx context.Context, wait bool) error {
+	return p.StartContextEnv(ctx, wait, nil)
+}
+
+// StartContextEnv start the process like StartContext with the KEY=VALUE
+// environment overrides, they are applied to the spawns of this start and
+// not to the restarts by autorestart. They are ignored if the process is
+// already started
+func (p *Process) StartContextEnv(ctx context.Context, wait bool, env []string) error {
 	log.WithFields(log.Fields{"program": p.GetName()}).Info("try to start program")
+	release, err := p.checkConflicts(ctx)
+	if err != nil {
+		log.WithFields(log.Fields{"program": p.GetName()}).Warn("fail to start program: ", err)
+		return err
+	}
 	p.lock.Lock()
 	if p.inStart {
 		log.WithFields(log.Fields{"program": p.GetName()}).Info("Don't start program again, program is already started")
 		p.lock.Unlock()
-		return
+		release()
+		return nil
 	}
 
 	p.inStart = true
 	p.stopByUser = false
+	p.startEnv = env
+	superviseCtx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.done = make(chan struct{})
+	done := p.done
 	p.lock.Unlock()
+	// the conflicting programs can't be started once this one is marked as started
+	release()
+
+	started := make(chan struct{})
+	var startedOnce sync.Once
+
+	go p.supervise(superviseCtx, done, func() {
+		startedOnce.Do(func() {
+			close(started)
+		})
+	})
 
-	var runCond *sync.Cond
 	if wait {
-		runCond = sync.NewCond(&sync.Mutex{})
-		runCond.L.Lock()
+		return waitContext(ctx, started)
 	}
+	return nil
+}
 
-	go func() {
-
-		for {
-			p.run(func() {
-				if wait {
-					runCond.L.Lock()
-					runCond.Signal()
-					runCond.L.Unlock()
-				}
-			})
-			//avoid print too many logs if fail to start program too quickly
-			if time.Now().Unix()-p.startTime.Unix() < 2 {
-				time.Sleep(5 * time.Second)
-			}
-			if p.stopByUser {
-				log.WithFields(log.Fields{"program": p.GetName()}).Info("Stopped by user, don't start it again")
-				break
-			}
-			if !p.isAutoRestart() {
-				log.WithFields(log.Fields{"program": p.GetName()}).Info("Don't start the stopped program because its autorestart flag is false")
-				break
-			}
-		}
+// supervise run the program and restart it according to its autorestart until
+// the context is cancelled by Stop. Once the program is started, this is the
+// only goroutine changing its state and the done channel is closed when it exits
+func (p *Process) supervise(ctx context.Context, done chan struct{}, startedCb func()) {
+	defer func() {
 		p.lock.Lock()
+		// the program in backoff is not restarted any more
+		if ctx.Err() != nil && p.state == Backoff {
+			p.changeStateTo(Stopped)
+		}
 		p.inStart = false
 		p.lock.Unlock()
+		// the waiter is released even if the program is stopped before started
+		startedCb()
+		close(done)
 	}()
 
-	if wait {
-		runCond.Wait()
-		runCond.L.Unlock()
+	for {
+		p.run(ctx, startedCb)
+		p.lock.Lock()
+		p.startEnv = nil
+		p.lock.Unlock()
+		if ctx.Err() != nil {
+			log.WithFields(log.Fields{"program": p.GetName()}).Info("Stopped by user, don't start it again")
+			return
+		}
+		//avoid print too many logs if fail to start program too quickly
+		if time.Now().Unix()-p.startTime.Unix() < 2 && !sleepContext(ctx, 5*time.Second) {
+			return
+		}
+		p.lock.RLock()
+		action, ok := p.getExitedAction()
+		exited := p.state == Exited
+		p.lock.RUnlock()
+		if ok && exited && action.Action != exitCodeRestart {
+			if action.Action == exitCodeFatal {
+				p.lock.Lock()
+				p.spawnErr = "Exited with an exit code mapped to fatal by exit_code_actions"
+				p.changeStateTo(Fatal)
+				p.lock.Unlock()
+			}
+			log.WithFields(log.Fields{"program": p.GetName(), "action": action.Action}).Info("Don't start the stopped program because of its exit_code_actions")
+			return
+		}
+		if (!ok || !exited) && !p.isAutoRestart() {
+			log.WithFields(log.Fields{"program": p.GetName()}).Info("Don't start the stopped program because its autorestart flag is false")
+			return
+		}
+		if p.isRestartSuppressed() {
+			log.WithFields(log.Fields{"program": p.GetName()}).Info("Don't start the stopped program because it is in a maintenance window")
+			return
+		}
+		if ok && exited && action.Delay > 0 {
+			log.WithFields(log.Fields{"program": p.GetName()}).Info("restart the program after ", action.Delay, " by its exit_code_actions")
+			if !sleepContext(ctx, action.Delay) {
+				return
+			}
+		}
+	}
+}
+
+// wait until the channel is closed or the context is done
+func waitContext(ctx context.Context, ch chan struct{}) error {
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sleep the duration, return false if the context is done before
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
 
@@ -206,40 +340,56 @@ func (p *Process) GetGroup() string {
 	return p.config.Group
 }
 
-// GetDescription get the process status description
+// GetLabels get the "key=value" labels of the program sorted by key
+func (p *Process) GetLabels() []string {
+	return p.config.GetEnv("labels")
+}
+
+// GetDescription get the process status description like python supervisor,
+// for example "pid 123, uptime 0:01:02" if the program is running
 func (p *Process) GetDescription() string {
 	p.lock.RLock()
 	defer p.lock.RUnlock()
-	if p.state == Running {
-		seconds := int(time.Now().Sub(p.startTime).Seconds())
+	switch p.state {
+	case Running:
+		seconds := int(p.uptime().Seconds())
 		minutes := seconds / 60
 		hours := minutes / 60
 		days := hours / 24
-		if days > 0 {
-			return fmt.Sprintf("pid %d, uptime %d days, %d:%02d:%02d", p.cmd.Process.Pid, days, hours%24, minutes%60, seconds%60)
+		uptime := fmt.Sprintf("%d:%02d:%02d", hours%24, minutes%60, seconds%60)
+		if days == 1 {
+			uptime = "1 day, " + uptime
+		} else if days > 1 {
+			uptime = fmt.Sprintf("%d days, %s", days, uptime)
+		}
+		return fmt.Sprintf("pid %d, uptime %s", p.cmd.Process.Pid, uptime)
+	case Fatal, Backoff:
+		if p.spawnErr != "" {
+			return p.spawnErr
+		}
+		return fmt.Sprintf("unknown error (try \"tail %s\")", p.GetName())
+	case Stopped, Exited:
+		if p.startTime.Unix() == 0 {
+			return "Not started"
 		}
-		return fmt.Sprintf("pid %d, uptime %d:%02d:%02d", p.cmd.Process.Pid, hours%24, minutes%60, seconds%60)
-	} else if p.state != Stopped {
-		return p.stopTime.String()
+		return p.stopTime.Format("Jan 02 03:04 PM")
 	}
 	return ""
 }
 
-// GetExitstatus get the exit status of the process if the program exit
-func (p *Process) GetExitstatus() int {
+// GetSpawnErr get the reason why the program can't be started, empty if it is spawned
+func (p *Process) GetSpawnErr() string {
 	p.lock.RLock()
 	defer p.lock.RUnlock()
+	return p.spawnErr
+}
 
-	if p.state == Exited || p.state == Backoff {
-		if p.cmd.ProcessState == nil {
-			return 0
-		}
-		status, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus)
-		if ok {
-			return status.ExitStatus()
-		}
-	}
-	return 0
+// GetExitstatus get the exit status of the last exited process, it is kept
+// after the program is stopped like python supervisor
+func (p *Process) GetExitstatus() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.exitStatus
 }
 
 // GetPid get the pid of running process or 0 it is not in running status
@@ -247,7 +397,7 @@ func (p *Process) GetPid() int {
 	p.lock.RLock()
 	defer p.lock.RUnlock()
 
-	if p.state == Stopped || p.state == Fatal || p.state == Unknown || p.state == Exited || p.state == Backoff {
+	if p.state == Stopped || p.state == Spawning || p.state == Fatal || p.state == Unknown || p.state == Exited || p.state == Backoff {
 		return 0
 	}
 	return p.cmd.Process.Pid
@@ -255,6 +405,8 @@ func (p *Process) GetPid() int {
 
 // GetState Get the process state
 func (p *Process) GetState() State {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
 	return p.state
 }
 
@@ -263,18 +415,33 @@ func (p *Process) GetStartTime() time.Time {
 	return p.startTime
 }
 
-// GetStopTime get the process stop time
-func (p *Process) GetStopTime() time.Time {
-	switch p.state {
-	case Starting:
-		fallthrough
-	case Running:
-		fallthrough
-	case Stopping:
-		return time.Unix(0, 0)
-	default:
-		return p.stopTime
+// GetUptime get the time the running process has been running, 0 if it is
+// not running. It is measured with the monotonic clock so it doesn't jump
+// when the wall clock is stepped
+func (p *Process) GetUptime() time.Duration {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.state != Running {
+		return 0
+	}
+	return p.uptime()
+}
+
+// get the time since the process started, must be called with the lock hold
+func (p *Process) uptime() time.Duration {
+	// time.Since uses the monotonic clock reading of the start time
+	if d := time.Since(p.startTime); d > 0 {
+		return d
 	}
+	return 0
+}
+
+// GetStopTime get the time the process stopped last, it is kept after the
+// program is started again like the laststop of python supervisor
+func (p *Process) GetStopTime() time.Time {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.stopTime
 }
 
 // GetStdoutLogfile get the program stdout log file
@@ -297,6 +464,27 @@ func (p *Process) GetStderrLogfile() string {
 	return expandFile
 }
 
+// GetLogfilePaths get the files which the stdout and stderr are written to,
+// empty if the output is not written to a file or the stderr is redirected
+func (p *Process) GetLogfilePaths() (stdout string, stderr string) {
+	stdout = logfilePath(p.GetStdoutLogfile())
+	if !p.config.GetBool("redirect_stderr", false) {
+		stderr = logfilePath(p.GetStderrLogfile())
+	}
+	return
+}
+
+// get the first file of the comma separated log files
+func logfilePath(logFile string) string {
+	for _, f := range strings.Split(logFile, ",") {
+		f = strings.TrimSpace(f)
+		if f != "" && f != "/dev/null" && !strings.HasPrefix(f, "syslog") && !isInheritedLog(f) {
+			return f
+		}
+	}
+	return ""
+}
+
 func (p *Process) getStartSeconds() int64 {
 	return int64(p.config.GetInt("startsecs", 1))
 }
@@ -360,7 +548,9 @@ func (p *Process) inExitCodes(exitCode int) bool {
 			return true
 		}
 	}
-	return false
+	// the exit codes ignored by exit_code_actions are expected
+	action, ok := p.getExitCodeAction(exitCode)
+	return ok && action.Action == exitCodeIgnore
 }
 
 func (p *Process) getExitCode() (int, error) {
@@ -402,11 +592,20 @@ func (p *Process) isRunning() bool {
 
 // create Command object for the program
 func (p *Process) createProgramCommand() error {
-	args, err := parseCommand(p.config.GetStringExpression("command", ""))
+	driver, err := getDriver(p.config)
+	if err != nil {
+		log.WithFields(log.Fields{"program": p.GetName()}).Error(err)
+		return err
+	}
+	// what is left by the previous execution is released before the command
+	// creates what its execution needs
+	driver.Cleanup()
+	args, err := driver.Command(p.config.GetStringExpression("command", ""))
 
 	if err != nil {
 		return err
 	}
+	p.driver = driver
 	p.cmd = exec.Command(args[0])
 	if len(args) > 1 {
 		p.cmd.Args = args
@@ -414,10 +613,12 @@ func (p *Process) createProgramCommand() error {
 	p.cmd.SysProcAttr = &syscall.SysProcAttr{}
 	if p.setUser() != nil {
 		log.WithFields(log.Fields{"user": p.config.GetString("user", "")}).Error("fail to run as user")
+		p.driver.Cleanup()
 		return fmt.Errorf("fail to set user")
 	}
 	p.setProgramRestartChangeMonitor(args[0])
 	setDeathsig(p.cmd.SysProcAttr)
+	setNoConsoleWindow(p.cmd.SysProcAttr)
 	p.setEnv()
 	p.setDir()
 	p.setLog()
@@ -458,47 +659,168 @@ func (p *Process) setProgramRestartChangeMonitor(programPath string) {
 
 }
 
-// wait for the started program exit
-func (p *Process) waitForExit(startSecs int64) {
-	p.cmd.Wait()
-	if p.cmd.ProcessState != nil {
-		log.WithFields(log.Fields{"program": p.GetName()}).Infof("program stopped with status:%v", p.cmd.ProcessState)
+// wait for the started program exit. The program enters the Running state if
+// it does not exit in startSecs and the stop signals are sent to it after
+// the context is cancelled
+func (p *Process) waitForExit(ctx context.Context, startSecs int64, finishCb func()) {
+	exitCh := make(chan struct{})
+	go func() {
+		p.cmd.Wait()
+		p.spawnLock.Lock()
+		p.driver.Cleanup()
+		p.spawned = false
+		p.spawnLock.Unlock()
+		close(exitCh)
+	}()
+
+	// nil channel is never ready
+	var startTimer <-chan time.Time
+	//Set startsec to 0 to indicate that the program needn't stay
+	//running for any particular amount of time.
+	if startSecs <= 0 {
+		p.setRunning()
+		finishCb()
 	} else {
-		log.WithFields(log.Fields{"program": p.GetName()}).Info("program stopped")
+		timer := time.NewTimer(time.Duration(startSecs) * time.Second)
+		defer timer.Stop()
+		startTimer = timer.C
+	}
+
+	stopCh := ctx.Done()
+	var stopSeq *stopSequence
+	var stopTimer <-chan time.Time
+	for {
+		select {
+		case <-exitCh:
+			if p.cmd.ProcessState != nil {
+				log.WithFields(log.Fields{"program": p.GetName()}).Infof("program stopped with status:%v", p.cmd.ProcessState)
+			} else {
+				log.WithFields(log.Fields{"program": p.GetName()}).Info("program stopped")
+			}
+			p.lock.Lock()
+			defer p.lock.Unlock()
+			p.stopTime = time.Now()
+			if p.cmd.ProcessState != nil {
+				if status, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
+					p.exitStatus = status.ExitStatus()
+				}
+			}
+			p.coreDump = p.collectCoreDump()
+			p.StdoutLog.Close()
+			p.StderrLog.Close()
+			return
+		case <-startTimer:
+			startTimer = nil
+			p.setRunning()
+			finishCb()
+		case <-stopCh:
+			stopCh = nil
+			startTimer = nil
+			p.lock.Lock()
+			p.changeStateTo(Stopping)
+			p.lock.Unlock()
+			stopSeq = p.createStopSequence()
+			stopTimer = p.sendNextStopSignal(stopSeq)
+		case <-stopTimer:
+			stopTimer = p.sendNextStopSignal(stopSeq)
+		}
 	}
+}
+
+// change the state of the started program to Running
+func (p *Process) setRunning() {
 	p.lock.Lock()
 	defer p.lock.Unlock()
-	p.stopTime = time.Now()
-	p.StdoutLog.Close()
-	p.StderrLog.Close()
+	if p.state == Starting {
+		log.WithFields(log.Fields{"program": p.GetName()}).Info("success to start program")
+		p.changeStateTo(Running)
+	}
 }
 
-// fail to start the program
-func (p *Process) failToStartProgram(reason string, finishCb func()) {
-	log.WithFields(log.Fields{"program": p.GetName()}).Errorf(reason)
-	p.changeStateTo(Fatal)
-	finishCb()
+// the signals to stop the program which are sent one by one every stopwaitsecs
+// until the program exits, followed by SIGKILL
+type stopSequence struct {
+	signals     []string
+	waitsecs    time.Duration
+	stopasgroup bool
+	killasgroup bool
+	next        int
 }
 
-// monitor if the program is in running before endTime
-//
-func (p *Process) monitorProgramIsRunning(endTime time.Time, monitorExited *int32, programExited *int32) {
-	// if time is not expired
-	for time.Now().Before(endTime) && atomic.LoadInt32(programExited) == 0 {
-		time.Sleep(time.Duration(100) * time.Millisecond)
+func (p *Process) createStopSequence() *stopSequence {
+	seq := &stopSequence{signals: strings.Fields(p.config.GetString("stopsignal", "TERM")),
+		waitsecs:    time.Duration(p.config.GetInt("stopwaitsecs", 10)) * time.Second,
+		stopasgroup: p.config.GetBool("stopasgroup", false)}
+	seq.killasgroup = p.config.GetBool("killasgroup", seq.stopasgroup)
+	if seq.stopasgroup && !seq.killasgroup {
+		log.WithFields(log.Fields{"program": p.GetName()}).Error("Cannot set stopasgroup=true and killasgroup=false")
 	}
-	atomic.StoreInt32(monitorExited, 1)
+	return seq
+}
 
-	p.lock.Lock()
-	defer p.lock.Unlock()
-	// if the program does not exit
-	if atomic.LoadInt32(programExited) == 0 && p.state == Starting {
-		log.WithFields(log.Fields{"program": p.GetName()}).Info("success to start program")
-		p.changeStateTo(Running)
+// send the next stop signal to the program and return the channel ready when the
+// program should have exited, or nil if the program is already killed
+func (p *Process) sendNextStopSignal(seq *stopSequence) <-chan time.Time {
+	for seq.next < len(seq.signals) {
+		sigName := seq.signals[seq.next]
+		seq.next++
+		sig, err := signals.ToSignal(sigName)
+		if err != nil {
+			log.WithFields(log.Fields{"program": p.GetName(), "signal": sigName}).Warn("skip the unknown stop signal")
+			continue
+		}
+		log.WithFields(log.Fields{"program": p.GetName(), "signal": sigName}).Info("send stop signal to program")
+		p.Signal(sig, seq.stopasgroup)
+		//wait at most "stopwaitsecs" seconds for one signal
+		return time.After(seq.waitsecs)
 	}
+	if seq.next == len(seq.signals) {
+		seq.next++
+		log.WithFields(log.Fields{"program": p.GetName()}).Info("force to kill the program")
+		p.Signal(syscall.SIGKILL, seq.killasgroup)
+	}
+	return nil
 }
 
-func (p *Process) run(finishCb func()) {
+var errAlreadySpawned = fmt.Errorf("the OS process of program is already spawned")
+var errCreateProgram = fmt.Errorf("fail to create program")
+
+// spawn the OS process of the program in the Spawning state. The spawnLock and
+// the check of the previous process guarantee that two OS processes are never
+// spawned for the program, whoever starts it (RPC, autorestart, cron or web UI)
+func (p *Process) spawn() error {
+	p.spawnLock.Lock()
+	defer p.spawnLock.Unlock()
+	if p.state == Spawning || p.spawned {
+		return errAlreadySpawned
+	}
+	p.changeStateTo(Spawning)
+	if err := p.createProgramCommand(); err != nil {
+		return errCreateProgram
+	}
+	err := p.startCommand()
+	p.spawned = err == nil
+	if p.spawned {
+		p.spawnErr = ""
+		p.saveSpawnConfig()
+		p.recordSpawn()
+	} else {
+		p.driver.Cleanup()
+	}
+	return err
+}
+
+// fail to start the program
+func (p *Process) failToStartProgram(reason string, finishCb func()) {
+	log.WithFields(log.Fields{"program": p.GetName()}).Errorf(reason)
+	p.changeStateTo(Fatal)
+	finishCb()
+}
+
+// run the program until it exits, it is started again if it exits before
+// startsecs at most startretries times. The program is stopped when the
+// context is cancelled
+func (p *Process) run(ctx context.Context, finishCb func()) {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
@@ -513,36 +835,37 @@ func (p *Process) run(finishCb func()) {
 	atomic.StoreInt32(p.retryTimes, 0)
 	startSecs := p.getStartSeconds()
 	restartPause := p.getRestartPause()
-	var once sync.Once
 
-	// finishCb can be only called one time
-	finishCbWrapper := func() {
-		once.Do(finishCb)
-	}
-	//process is not expired and not stoped by user
-	for !p.stopByUser {
+	//process is not stoped by user
+	for ctx.Err() == nil {
 		if restartPause > 0 && atomic.LoadInt32(p.retryTimes) != 0 {
 			//pause
 			p.lock.Unlock()
 			log.WithFields(log.Fields{"program": p.GetName()}).Info("don't restart the program, start it after ", restartPause, " seconds")
-			time.Sleep(time.Duration(restartPause) * time.Second)
+			paused := sleepContext(ctx, time.Duration(restartPause)*time.Second)
 			p.lock.Lock()
+			if !paused {
+				break
+			}
 		}
-		endTime := time.Now().Add(time.Duration(startSecs) * time.Second)
-		p.changeStateTo(Starting)
 		atomic.AddInt32(p.retryTimes, 1)
 
-		err := p.createProgramCommand()
-		if err != nil {
-			p.failToStartProgram("fail to create program", finishCbWrapper)
+		err := p.spawn()
+		if err == errAlreadySpawned {
+			log.WithFields(log.Fields{"program": p.GetName()}).Warn("Don't spawn program because its previous process is not exited")
+			finishCb()
+			break
+		}
+		if err == errCreateProgram {
+			p.spawnErr = "fail to create program"
+			p.failToStartProgram("fail to create program", finishCb)
 			break
 		}
-
-		err = p.cmd.Start()
 
 		if err != nil {
+			p.spawnErr = err.Error()
 			if atomic.LoadInt32(p.retryTimes) >= p.getStartRetries() {
-				p.failToStartProgram(fmt.Sprintf("fail to start program with error:%v", err), finishCbWrapper)
+				p.failToStartProgram(fmt.Sprintf("fail to start program with error:%v", err), finishCb)
 				break
 			} else {
 				log.WithFields(log.Fields{"program": p.GetName()}).Info("fail to start program with error:", err)
@@ -550,6 +873,8 @@ func (p *Process) run(finishCb func()) {
 				continue
 			}
 		}
+		p.changeStateTo(Starting)
+		p.setResourceLimits()
 		if p.StdoutLog != nil {
 			p.StdoutLog.SetPid(p.cmd.Process.Pid)
 		}
@@ -557,46 +882,41 @@ func (p *Process) run(finishCb func()) {
 			p.StderrLog.SetPid(p.cmd.Process.Pid)
 		}
 
-		monitorExited := int32(0)
-		programExited := int32(0)
-		//Set startsec to 0 to indicate that the program needn't stay
-		//running for any particular amount of time.
-		if startSecs <= 0 {
-			log.WithFields(log.Fields{"program": p.GetName()}).Info("success to start program")
-			p.changeStateTo(Running)
-			go finishCbWrapper()
-		} else {
-			go func() {
-				p.monitorProgramIsRunning(endTime, &monitorExited, &programExited)
-				finishCbWrapper()
-			}()
-		}
 		log.WithFields(log.Fields{"program": p.GetName()}).Debug("wait program exit")
 		p.lock.Unlock()
-		p.waitForExit(startSecs)
-
-		atomic.StoreInt32(&programExited, 1)
-		// wait for monitor thread exit
-		for atomic.LoadInt32(&monitorExited) == 0 {
-			time.Sleep(time.Duration(10) * time.Millisecond)
-		}
-
+		p.waitForExit(ctx, startSecs, finishCb)
 		p.lock.Lock()
 
+		// the program is stopped by user
+		if ctx.Err() != nil {
+			p.changeStateTo(Stopped)
+			p.recordExit(false)
+			break
+		}
 		// if the program still in running after startSecs
 		if p.state == Running {
 			p.changeStateTo(Exited)
 			log.WithFields(log.Fields{"program": p.GetName()}).Info("program exited")
+			p.recordExit(p.isUnexpectedExit())
+			p.writeCrashReportIfNeeded()
 			break
 		} else {
+			p.spawnErr = "Exited too quickly (process log may have details)"
 			p.changeStateTo(Backoff)
+			p.recordExit(true)
+			p.writeCrashReportIfNeeded()
+			// the program exited with a fatal exit code is not retried
+			if action, ok := p.getExitedAction(); ok && action.Action == exitCodeFatal {
+				p.failToStartProgram("fail to start program because its exit code is mapped to fatal by exit_code_actions", finishCb)
+				break
+			}
 		}
 
 		// The number of serial failure attempts that supervisord will allow when attempting to
 		// start the program before giving up and putting the process into an Fatal state
 		// first start time is not the retry time
 		if atomic.LoadInt32(p.retryTimes) >= p.getStartRetries() {
-			p.failToStartProgram(fmt.Sprintf("fail to start program because retry times is greater than %d", p.getStartRetries()), finishCbWrapper)
+			p.failToStartProgram(fmt.Sprintf("fail to start program because retry times is greater than %d", p.getStartRetries()), finishCb)
 			break
 		}
 	}
@@ -604,32 +924,50 @@ func (p *Process) run(finishCb func()) {
 }
 
 func (p *Process) changeStateTo(procState State) {
+	if procState == Spawning {
+		p.spawnFrom = p.state
+	}
+	// Spawning is not visible in the events
+	fromState := p.state
+	if fromState == Spawning {
+		fromState = p.spawnFrom
+	}
 	if p.config.IsProgram() {
 		progName := p.config.GetProgramName()
 		groupName := p.config.GetGroupName()
 		if procState == Starting {
-			events.EmitEvent(events.CreateProcessStartingEvent(progName, groupName, p.state.String(), int(atomic.LoadInt32(p.retryTimes))))
+			p.emitEvent(events.CreateProcessStartingEvent(progName, groupName, fromState.String(), int(atomic.LoadInt32(p.retryTimes))))
 		} else if procState == Running {
-			events.EmitEvent(events.CreateProcessRunningEvent(progName, groupName, p.state.String(), p.cmd.Process.Pid))
+			p.emitEvent(events.CreateProcessRunningEvent(progName, groupName, fromState.String(), p.cmd.Process.Pid))
 		} else if procState == Backoff {
-			events.EmitEvent(events.CreateProcessBackoffEvent(progName, groupName, p.state.String(), int(atomic.LoadInt32(p.retryTimes))))
+			p.emitEvent(events.CreateProcessBackoffEvent(progName, groupName, fromState.String(), int(atomic.LoadInt32(p.retryTimes))))
 		} else if procState == Stopping {
-			events.EmitEvent(events.CreateProcessStoppingEvent(progName, groupName, p.state.String(), p.cmd.Process.Pid))
+			p.emitEvent(events.CreateProcessStoppingEvent(progName, groupName, fromState.String(), p.cmd.Process.Pid))
 		} else if procState == Exited {
 			exitCode, err := p.getExitCode()
 			expected := 0
 			if err == nil && p.inExitCodes(exitCode) {
 				expected = 1
 			}
-			events.EmitEvent(events.CreateProcessExitedEvent(progName, groupName, p.state.String(), expected, p.cmd.Process.Pid))
+			event := events.CreateProcessExitedEvent(progName, groupName, fromState.String(), expected, p.cmd.Process.Pid)
+			event.SetData(p.GetLastOutput())
+			p.emitEvent(event)
 		} else if procState == Fatal {
-			events.EmitEvent(events.CreateProcessFatalEvent(progName, groupName, p.state.String()))
+			event := events.CreateProcessFatalEvent(progName, groupName, fromState.String())
+			event.SetData(p.GetLastOutput())
+			p.emitEvent(event)
 		} else if procState == Stopped {
-			events.EmitEvent(events.CreateProcessStoppedEvent(progName, groupName, p.state.String(), p.cmd.Process.Pid))
+			pid := 0
+			// the program may be stopped in backoff without process
+			if p.cmd != nil && p.cmd.Process != nil {
+				pid = p.cmd.Process.Pid
+			}
+			p.emitEvent(events.CreateProcessStoppedEvent(progName, groupName, fromState.String(), pid))
 		} else if procState == Unknown {
-			events.EmitEvent(events.CreateProcessUnknownEvent(progName, groupName, p.state.String()))
+			p.emitEvent(events.CreateProcessUnknownEvent(progName, groupName, fromState.String()))
 		}
 	}
+	p.addStateHistory(p.state, procState)
 	p.state = procState
 }
 
@@ -661,60 +999,116 @@ func (p *Process) sendSignal(sig os.Signal, sigChildren bool) error {
 }
 
 func (p *Process) setEnv() {
-	env := p.config.GetEnv("environment")
+	p.cmd.Env = p.getEnv()
+}
+
+// get the environment of the program: the environment of supervisord, the
+// "environment" of the program and the overrides of the current start
+func (p *Process) getEnv() []string {
+	env := append(p.config.GetEnv("environment"), p.startEnv...)
 	if len(env) != 0 {
-		p.cmd.Env = append(os.Environ(), env...)
-	} else {
-		p.cmd.Env = os.Environ()
+		return append(os.Environ(), env...)
 	}
+	return os.Environ()
 }
 
 func (p *Process) setDir() {
-	dir := p.config.GetStringExpression("directory", "")
-	if dir != "" {
-		p.cmd.Dir = dir
+	p.cmd.Dir = p.getDir()
+}
+
+func (p *Process) getDir() string {
+	return p.config.GetStringExpression("directory", "")
+}
+
+// GetLastOutput get the last stdout/stderr output of the process kept in memory.
+// Return empty string if "last_output_maxbytes" is not configured
+func (p *Process) GetLastOutput() string {
+	if p.lastOutput == nil {
+		return ""
 	}
+	return secret.MaskText(p.lastOutput.String())
+}
+
+// check if the stdout or stderr of supervisord is passed to the program so
+// that the output is written directly without pipe, the log file is "INHERIT".
+// The inherited output can't be read, captured or emitted as events
+func isInheritedLog(logFile string) bool {
+	return strings.EqualFold(strings.TrimSpace(logFile), "INHERIT")
+}
+
+// wrap the log writer to keep the last output in memory and to count the
+// log lines by severity also
+func (p *Process) withLastOutput(w io.Writer) io.Writer {
+	if rules := p.GetSeverityRules(); len(rules) > 0 {
+		w = io.MultiWriter(p.logSeverity.Writer(rules), w)
+	}
+	if p.lastOutput == nil {
+		return w
+	}
+	return io.MultiWriter(p.lastOutput, w)
 }
 
 func (p *Process) setLog() {
 	if p.config.IsProgram() {
-		p.StdoutLog = p.createLogger(p.GetStdoutLogfile(),
-			int64(p.config.GetBytes("stdout_logfile_maxbytes", 50*1024*1024)),
-			p.config.GetInt("stdout_logfile_backups", 10),
-			p.createStdoutLogEventEmitter())
-		captureBytes := p.config.GetBytes("stdout_capture_maxbytes", 0)
-		if captureBytes > 0 {
-			log.WithFields(log.Fields{"program": p.config.GetProgramName()}).Info("capture stdout process communication")
-			p.StdoutLog = logger.NewLogCaptureLogger(p.StdoutLog,
-				captureBytes,
-				"PROCESS_COMMUNICATION_STDOUT",
-				p.GetName(),
-				p.GetGroup())
-		}
-
-		p.cmd.Stdout = p.StdoutLog
-
-		if p.config.GetBool("redirect_stderr", false) {
-			p.StderrLog = p.StdoutLog
+		// the last output is the one of the current run only
+		if p.lastOutput != nil {
+			p.lastOutput.Reset()
+		} else if size := p.config.GetBytes("last_output_maxbytes", 0); size > 0 {
+			p.lastOutput = logger.NewRingBuffer(size)
+		}
+		if isInheritedLog(p.GetStdoutLogfile()) {
+			p.StdoutLog = logger.NewNullLogger(logger.NewNullLogEventEmitter())
+			p.cmd.Stdout = os.Stdout
 		} else {
-			p.StderrLog = p.createLogger(p.GetStderrLogfile(),
-				int64(p.config.GetBytes("stderr_logfile_maxbytes", 50*1024*1024)),
-				p.config.GetInt("stderr_logfile_backups", 10),
-				p.createStderrLogEventEmitter())
+			p.StdoutLog = p.createLogger(p.GetStdoutLogfile(),
+				int64(p.config.GetBytes("stdout_logfile_maxbytes", 50*1024*1024)),
+				p.config.GetInt("stdout_logfile_backups", 10),
+				p.createStdoutLogEventEmitter())
+			p.setLogFileOwnership(p.StdoutLog, "stdout")
+			captureBytes := p.config.GetBytes("stdout_capture_maxbytes", 0)
+			if captureBytes > 0 {
+				log.WithFields(log.Fields{"program": p.config.GetProgramName()}).Info("capture stdout process communication")
+				p.StdoutLog = logger.NewLogCaptureLogger(p.StdoutLog,
+					captureBytes,
+					"PROCESS_COMMUNICATION_STDOUT",
+					p.GetName(),
+					p.GetGroup())
+			}
+
+			p.cmd.Stdout = p.withLastOutput(p.StdoutLog)
 		}
 
-		captureBytes = p.config.GetBytes("stderr_capture_maxbytes", 0)
+		redirectStderr := p.config.GetBool("redirect_stderr", false)
+		if redirectStderr && p.cmd.Stdout == os.Stdout {
+			p.StderrLog = p.StdoutLog
+			p.cmd.Stderr = os.Stdout
+		} else if !redirectStderr && isInheritedLog(p.GetStderrLogfile()) {
+			p.StderrLog = logger.NewNullLogger(logger.NewNullLogEventEmitter())
+			p.cmd.Stderr = os.Stderr
+		} else {
+			if redirectStderr {
+				p.StderrLog = p.StdoutLog
+			} else {
+				p.StderrLog = p.createLogger(p.GetStderrLogfile(),
+					int64(p.config.GetBytes("stderr_logfile_maxbytes", 50*1024*1024)),
+					p.config.GetInt("stderr_logfile_backups", 10),
+					p.createStderrLogEventEmitter())
+				p.setLogFileOwnership(p.StderrLog, "stderr")
+			}
 
-		if captureBytes > 0 {
-			log.WithFields(log.Fields{"program": p.config.GetProgramName()}).Info("capture stderr process communication")
-			p.StderrLog = logger.NewLogCaptureLogger(p.StdoutLog,
-				captureBytes,
-				"PROCESS_COMMUNICATION_STDERR",
-				p.GetName(),
-				p.GetGroup())
-		}
+			captureBytes := p.config.GetBytes("stderr_capture_maxbytes", 0)
 
-		p.cmd.Stderr = p.StderrLog
+			if captureBytes > 0 {
+				log.WithFields(log.Fields{"program": p.config.GetProgramName()}).Info("capture stderr process communication")
+				p.StderrLog = logger.NewLogCaptureLogger(p.StdoutLog,
+					captureBytes,
+					"PROCESS_COMMUNICATION_STDERR",
+					p.GetName(),
+					p.GetGroup())
+			}
+
+			p.cmd.Stderr = p.withLastOutput(p.StderrLog)
+		}
 
 	} else if p.config.IsEventListener() {
 		in, err := p.cmd.StdoutPipe()
@@ -762,11 +1156,13 @@ func (p *Process) registerEventListener(eventListenerName string,
 	_events []string,
 	stdin io.Reader,
 	stdout io.Writer) {
-	eventListener := events.NewEventListener(eventListenerName,
+	// the processes of the event listener are the pool
+	eventListener := events.NewEventListener(p.GetGroup(),
 		p.supervisorID,
 		stdin,
 		stdout,
-		p.config.GetInt("buffer_size", 100))
+		p.config.GetInt("buffer_size", 100),
+		p.config.GetInt("event_retries", 3))
 	events.RegisterEventListener(eventListenerName, _events, eventListener)
 }
 
@@ -775,15 +1171,83 @@ func (p *Process) unregisterEventListener(eventListenerName string) {
 }
 
 func (p *Process) createLogger(logFile string, maxBytes int64, backups int, logEventEmitter logger.LogEventEmitter) logger.Logger {
-	return logger.NewLogger(p.GetName(), logFile, logger.NewNullLocker(), maxBytes, backups, logEventEmitter)
+	l := logger.NewLogger(p.GetName(), logFile, logger.NewNullLocker(), maxBytes, backups, logEventEmitter)
+	if archiver := p.getLogArchiver(); archiver != nil {
+		logger.SetRotateHook(l, archiver.Archive)
+	}
+	if rules := p.GetSeverityRules(); len(rules) > 0 {
+		logger.SetSeverityRules(l, rules)
+	}
+	return l
+}
+
+// set the owner and the permissions of the log files from the
+// <stream>_logfile_owner ("user" or "user:group") and <stream>_logfile_mode
+// (octal) of the program, so that the log shippers running as the user of
+// the program can read them
+func (p *Process) setLogFileOwnership(l logger.Logger, stream string) {
+	uid, gid, mode := -1, -1, os.FileMode(0)
+	if owner := p.config.GetString(stream+"_logfile_owner", ""); owner != "" {
+		u, g, err := lookupUser(owner)
+		if err != nil {
+			log.WithFields(log.Fields{"program": p.GetName(), "owner": owner, log.ErrorKey: err}).Error("fail to find the owner of the log file")
+		} else {
+			uid, gid = int(u), int(g)
+		}
+	}
+	if value := p.config.GetString(stream+"_logfile_mode", ""); value != "" {
+		m, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || m > 0777 {
+			log.WithFields(log.Fields{"program": p.GetName(), "mode": value}).Error("invalid mode of the log file")
+		} else {
+			mode = os.FileMode(m)
+		}
+	}
+	if uid >= 0 || mode != 0 {
+		logger.SetFileOwnership(l, uid, gid, mode)
+	}
+}
+
+// get the archiver of the rotated log files, nil if logfile_archive_url is not set
+func (p *Process) getLogArchiver() *logger.Archiver {
+	archiveURL := p.config.GetStringExpression("logfile_archive_url", "")
+	if archiveURL == "" {
+		return nil
+	}
+	archiver, err := logger.GetArchiver(logger.ArchiveOptions{URL: archiveURL,
+		Endpoint:     p.config.GetString("logfile_archive_endpoint", ""),
+		Region:       p.config.GetString("logfile_archive_region", ""),
+		AccessKey:    p.config.GetString("logfile_archive_access_key", os.Getenv("AWS_ACCESS_KEY_ID")),
+		SecretKey:    p.config.GetString("logfile_archive_secret_key", os.Getenv("AWS_SECRET_ACCESS_KEY")),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN")})
+	if err != nil {
+		log.WithFields(log.Fields{"program": p.GetName(), log.ErrorKey: err}).Error("fail to archive the rotated log files")
+		return nil
+	}
+	return archiver
 }
 
 func (p *Process) setUser() error {
+	return p.setCommandUser(p.cmd)
+}
+
+// set the "user" of the program to the command
+func (p *Process) setCommandUser(cmd *exec.Cmd) error {
 	userName := p.config.GetString("user", "")
 	if len(userName) == 0 {
 		return nil
 	}
+	uid, gid, err := lookupUser(userName)
+	if err != nil {
+		return err
+	}
+	setUserID(cmd.SysProcAttr, uid, gid)
+	return nil
+}
 
+// get the uid and the gid of "user" or "user:group", the gid of the user is
+// used if the group is not provided
+func lookupUser(userName string) (uint32, uint32, error) {
 	//check if group is provided
 	pos := strings.Index(userName, ":")
 	groupName := ""
@@ -793,81 +1257,56 @@ func (p *Process) setUser() error {
 	}
 	u, err := user.Lookup(userName)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 	uid, err := strconv.ParseUint(u.Uid, 10, 32)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 	gid, err := strconv.ParseUint(u.Gid, 10, 32)
 	if err != nil && groupName == "" {
-		return err
+		return 0, 0, err
 	}
 	if groupName != "" {
 		g, err := user.LookupGroup(groupName)
 		if err != nil {
-			return err
+			return 0, 0, err
 		}
 		gid, err = strconv.ParseUint(g.Gid, 10, 32)
 		if err != nil {
-			return err
+			return 0, 0, err
 		}
 	}
-	setUserID(p.cmd.SysProcAttr, uint32(uid), uint32(gid))
-	return nil
+	return uint32(uid), uint32(gid), nil
 }
 
 //Stop send signal to process to stop it
 func (p *Process) Stop(wait bool) {
+	p.StopContext(context.Background(), wait)
+}
+
+// StopContext stop the process like Stop. If wait is true, the waiting
+// ends when the context is done and the error of the context is returned,
+// the process is still being stopped in background
+func (p *Process) StopContext(ctx context.Context, wait bool) error {
+	// the frozen program can't handle the stop signal
+	p.Unthrottle()
 	p.lock.Lock()
 	p.stopByUser = true
-	isRunning := p.isRunning()
+	inStart := p.inStart
+	cancel, done := p.cancel, p.done
 	p.lock.Unlock()
-	if !isRunning {
+	if !inStart {
 		log.WithFields(log.Fields{"program": p.GetName()}).Info("program is not running")
-		return
+		return nil
 	}
 	log.WithFields(log.Fields{"program": p.GetName()}).Info("stop the program")
-	sigs := strings.Fields(p.config.GetString("stopsignal", ""))
-	waitsecs := time.Duration(p.config.GetInt("stopwaitsecs", 10)) * time.Second
-	stopasgroup := p.config.GetBool("stopasgroup", false)
-	killasgroup := p.config.GetBool("killasgroup", stopasgroup)
-	if stopasgroup && !killasgroup {
-		log.WithFields(log.Fields{"program": p.GetName()}).Error("Cannot set stopasgroup=true and killasgroup=false")
-	}
-
-	var stopped int32 = 0
-	go func() {
-		for i := 0; i < len(sigs) && atomic.LoadInt32(&stopped) == 0; i++ {
-			// send signal to process
-			sig, err := signals.ToSignal(sigs[i])
-			if err != nil {
-				continue
-			}
-			log.WithFields(log.Fields{"program": p.GetName(), "signal": sigs[i]}).Info("send stop signal to program")
-			p.Signal(sig, stopasgroup)
-			endTime := time.Now().Add(waitsecs)
-			//wait at most "stopwaitsecs" seconds for one signal
-			for endTime.After(time.Now()) {
-				//if it already exits
-				if p.state != Starting && p.state != Running && p.state != Stopping {
-					atomic.StoreInt32(&stopped, 1)
-					break
-				}
-				time.Sleep(10 * time.Millisecond)
-			}
-		}
-		if atomic.LoadInt32(&stopped) == 0 {
-			log.WithFields(log.Fields{"program": p.GetName()}).Info("force to kill the program")
-			p.Signal(syscall.SIGKILL, killasgroup)
-			atomic.StoreInt32(&stopped, 1)
-		}
-	}()
+	// the goroutine supervising the program sends the stop signals
+	cancel()
 	if wait {
-		for atomic.LoadInt32(&stopped) == 0 {
-			time.Sleep(1 * time.Second)
-		}
+		return waitContext(ctx, done)
 	}
+	return nil
 }
 
 // GetStatus get the status of program in string
@@ -2,14 +2,53 @@ package process
 
 import (
 	"fmt"
+	"sync"
+
 	"github.com/ochinchina/filechangemonitor"
+	log "github.com/sirupsen/logrus"
 )
 
-var fileChangeMonitor = filechangemonitor.NewFileChangeMonitor(10)
+// the file change monitor is started when the first file is monitored
+var fileChangeMonitor *filechangemonitor.FileChangeMonitor
+var fileChangeMonitorDisabled bool
+var fileChangeMonitorLock sync.Mutex
+
+// SetFileChangeMonitorEnabled enable or disable the monitor of the program binaries and
+// directories (restart_when_binary_changed and restart_directory_monitor), the running
+// monitor is stopped if it is disabled
+func SetFileChangeMonitorEnabled(enabled bool) {
+	fileChangeMonitorLock.Lock()
+	defer fileChangeMonitorLock.Unlock()
+
+	fileChangeMonitorDisabled = !enabled
+	if fileChangeMonitorDisabled && fileChangeMonitor != nil {
+		fileChangeMonitor.Stop()
+		fileChangeMonitor = nil
+	}
+}
+
+// get the file change monitor, nil if it is disabled
+func getFileChangeMonitor() *filechangemonitor.FileChangeMonitor {
+	fileChangeMonitorLock.Lock()
+	defer fileChangeMonitorLock.Unlock()
+
+	if fileChangeMonitorDisabled {
+		return nil
+	}
+	if fileChangeMonitor == nil {
+		fileChangeMonitor = filechangemonitor.NewFileChangeMonitor(10)
+	}
+	return fileChangeMonitor
+}
 
 // AddProgramChangeMonitor add a program change listener to monitor if the program binary
 func AddProgramChangeMonitor(path string, fileChangeCb func(path string, mode filechangemonitor.FileChangeMode)) {
-	fileChangeMonitor.AddMonitorFile(path,
+	monitor := getFileChangeMonitor()
+	if monitor == nil {
+		log.WithFields(log.Fields{"path": path}).Warn("the file change monitor is disabled by monitor_file_changes, the program binary is not monitored")
+		return
+	}
+	monitor.AddMonitorFile(path,
 		false,
 		filechangemonitor.NewExactFileMatcher(path),
 		filechangemonitor.NewFileChangeCallbackWrapper(fileChangeCb),
@@ -18,8 +57,13 @@ func AddProgramChangeMonitor(path string, fileChangeCb func(path string, mode fi
 
 // AddConfigChangeMonitor add a program change listener to monitor if any one of its configuration files is changed
 func AddConfigChangeMonitor(path string, filePattern string, fileChangeCb func(path string, mode filechangemonitor.FileChangeMode)) {
+	monitor := getFileChangeMonitor()
+	if monitor == nil {
+		log.WithFields(log.Fields{"path": path}).Warn("the file change monitor is disabled by monitor_file_changes, the directory is not monitored")
+		return
+	}
 	fmt.Printf("filePattern=%s\n", filePattern)
-	fileChangeMonitor.AddMonitorFile(path,
+	monitor.AddMonitorFile(path,
 		true,
 		filechangemonitor.NewPatternFileMatcher(filePattern),
 		filechangemonitor.NewFileChangeCallbackWrapper(fileChangeCb),
@@ -0,0 +1,26 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/ochinchina/filechangemonitor"
+)
+
+func TestDisableFileChangeMonitor(t *testing.T) {
+	defer SetFileChangeMonitorEnabled(true)
+
+	SetFileChangeMonitorEnabled(false)
+	AddProgramChangeMonitor("/bin/sh", func(path string, mode filechangemonitor.FileChangeMode) {})
+	if getFileChangeMonitor() != nil {
+		t.Error("fail to disable the file change monitor")
+	}
+	SetFileChangeMonitorEnabled(true)
+	monitor := getFileChangeMonitor()
+	if monitor == nil || getFileChangeMonitor() != monitor {
+		t.Error("fail to start the file change monitor once")
+	}
+	SetFileChangeMonitorEnabled(false)
+	if getFileChangeMonitor() != nil {
+		t.Error("fail to stop the file change monitor")
+	}
+}
@@ -13,7 +13,11 @@ import (
 type Manager struct {
 	procs          map[string]*Process
 	eventListeners map[string]*Process
-	lock           sync.Mutex
+	// the programs in the start order, nil after the programs are changed
+	sortedProcs []*Process
+	lock        sync.RWMutex
+	// serialize the starts of the programs to enforce their conflicts
+	conflictLock sync.Mutex
 }
 
 // NewManager create a new Manager object
@@ -28,6 +32,8 @@ func (pm *Manager) CreateProcess(supervisorID string, config *config.Entry) *Pro
 	pm.lock.Lock()
 	defer pm.lock.Unlock()
 	if config.IsProgram() {
+		// the priority and depends_on of the reloaded config may be changed
+		pm.sortedProcs = nil
 		return pm.createProgram(supervisorID, config)
 	} else if config.IsEventListener() {
 		return pm.createEventListener(supervisorID, config)
@@ -52,6 +58,7 @@ func (pm *Manager) createProgram(supervisorID string, config *config.Entry) *Pro
 
 	if !ok {
 		proc = NewProcess(supervisorID, config)
+		proc.manager = pm
 		pm.procs[procName] = proc
 	}
 	log.Info("create process:", procName)
@@ -76,6 +83,7 @@ func (pm *Manager) Add(name string, proc *Process) {
 	pm.lock.Lock()
 	defer pm.lock.Unlock()
 	pm.procs[name] = proc
+	pm.sortedProcs = nil
 	log.Info("add process:", name)
 }
 
@@ -90,6 +98,7 @@ func (pm *Manager) Remove(name string) *Process {
 	defer pm.lock.Unlock()
 	proc, _ := pm.procs[name]
 	delete(pm.procs, name)
+	pm.sortedProcs = nil
 	log.Info("remove process:", name)
 	return proc
 }
@@ -122,8 +131,8 @@ func (pm *Manager) FindMatch(name string) []*Process {
 			}
 		})
 	} else {
-		pm.lock.Lock()
-		defer pm.lock.Unlock()
+		pm.lock.RLock()
+		defer pm.lock.RUnlock()
 		proc, ok := pm.procs[name]
 		if ok {
 			result = append(result, proc)
@@ -140,13 +149,12 @@ func (pm *Manager) Clear() {
 	pm.lock.Lock()
 	defer pm.lock.Unlock()
 	pm.procs = make(map[string]*Process)
+	pm.sortedProcs = nil
 }
 
-// ForEachProcess process each process in sync mode
+// ForEachProcess process each process in sync mode, the manager is not locked
+// while procFunc is called
 func (pm *Manager) ForEachProcess(procFunc func(p *Process)) {
-	pm.lock.Lock()
-	defer pm.lock.Unlock()
-
 	procs := pm.getAllProcess()
 	for _, proc := range procs {
 		procFunc(proc)
@@ -159,9 +167,6 @@ func (pm *Manager) ForEachProcess(procFunc func(p *Process)) {
 // - done, signal the process is completed
 // Returns: number of total processes
 func (pm *Manager) AsyncForEachProcess(procFunc func(p *Process), done chan *Process) int {
-	pm.lock.Lock()
-	defer pm.lock.Unlock()
-
 	procs := pm.getAllProcess()
 
 	for _, proc := range procs {
@@ -175,12 +180,26 @@ func forOneProcess(proc *Process, action func(p *Process), done chan *Process) {
 	done <- proc
 }
 
+// get the programs in the start order, the sorted programs are kept until the
+// programs are changed. The returned slice is shared and must not be modified
 func (pm *Manager) getAllProcess() []*Process {
-	tmpProcs := make([]*Process, 0)
-	for _, proc := range pm.procs {
-		tmpProcs = append(tmpProcs, proc)
+	pm.lock.RLock()
+	procs := pm.sortedProcs
+	pm.lock.RUnlock()
+	if procs != nil {
+		return procs
+	}
+
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	if pm.sortedProcs == nil {
+		tmpProcs := make([]*Process, 0, len(pm.procs))
+		for _, proc := range pm.procs {
+			tmpProcs = append(tmpProcs, proc)
+		}
+		pm.sortedProcs = sortProcess(tmpProcs)
 	}
-	return sortProcess(tmpProcs)
+	return pm.sortedProcs
 }
 
 // StopAllProcesses stop all the processes managed by this manager
@@ -208,14 +227,14 @@ func sortProcess(procs []*Process) []*Process {
 		}
 	}
 
-	result := make([]*Process, 0)
+	procsByConfig := make(map[*config.Entry][]*Process, len(procs))
+	for _, proc := range procs {
+		procsByConfig[proc.config] = append(procsByConfig[proc.config], proc)
+	}
+	result := make([]*Process, 0, len(procs))
 	p := config.NewProcessSorter()
 	for _, config := range p.SortProgram(progConfigs) {
-		for _, proc := range procs {
-			if proc.config == config {
-				result = append(result, proc)
-			}
-		}
+		result = append(result, procsByConfig[config]...)
 	}
 
 	return result
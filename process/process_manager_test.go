@@ -1,8 +1,12 @@
 package process
 
 import (
-	"github.com/ochinchina/supervisord/config"
+	"context"
 	"testing"
+
+	xmlrpc "github.com/ochinchina/gorilla-xmlrpc/xml"
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/faults"
 )
 
 var procs *Manager = NewManager()
@@ -31,3 +35,39 @@ func TestProcMgrRemove(t *testing.T) {
 		t.Error("fail to remove process")
 	}
 }
+
+// create a manager with the programs in the configuration
+func createTestManager(t *testing.T, content string) *Manager {
+	pm := NewManager()
+	for _, proc := range createTestProcesses(t, content) {
+		proc.manager = pm
+		pm.Add(proc.GetName(), proc)
+	}
+	return pm
+}
+
+func TestProcessConflicts(t *testing.T) {
+	pm := createTestManager(t, "[program:app]\ncommand=sleep 10\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n"+
+		"[program:migration]\ncommand=sleep 10\nstartsecs=0\nconflicts=app\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n"+
+		"[program:backup]\ncommand=sleep 10\nstartsecs=0\nconflicts=app\nconflict_policy=stop\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n")
+	app, migration, backup := pm.Find("app"), pm.Find("migration"), pm.Find("backup")
+
+	app.Start(true)
+	err := migration.StartContext(context.Background(), true)
+	if fault, ok := err.(*xmlrpc.Fault); !ok || fault.Code != faults.Conflict || migration.isStarted() {
+		t.Error("fail to refuse starting the program conflicting with a running program")
+	}
+	// the conflict declared by migration applies to app too
+	app.Stop(true)
+	migration.Start(true)
+	if err := app.StartContext(context.Background(), true); err == nil || app.isStarted() {
+		t.Error("fail to refuse starting the program declared in the conflicts of a running program")
+	}
+	migration.Stop(true)
+
+	app.Start(true)
+	if err := backup.StartContext(context.Background(), true); err != nil || backup.GetState() != Running || app.GetState() != Stopped {
+		t.Error("fail to stop the conflicting program with the stop conflict_policy")
+	}
+	backup.Stop(true)
+}
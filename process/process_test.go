@@ -0,0 +1,194 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ochinchina/supervisord/config"
+)
+
+// create the processes of the programs in the configuration
+func createTestProcesses(t *testing.T, content string) []*Process {
+	f, err := ioutil.TempFile("", "process")
+	if err != nil {
+		t.Fatal("fail to create the config file")
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(content)
+	f.Close()
+
+	cfg := config.NewConfig(f.Name())
+	if _, err := cfg.Load(); err != nil {
+		t.Fatal("fail to load the config file")
+	}
+	procs := make([]*Process, 0)
+	for _, entry := range cfg.GetPrograms() {
+		procs = append(procs, NewProcess("supervisord", entry))
+	}
+	return procs
+}
+
+func TestProcessStartStop(t *testing.T) {
+	proc := createTestProcesses(t, "[program:test]\ncommand=sleep 10\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n")[0]
+	proc.Start(true)
+	if proc.GetState() != Running {
+		t.Error("fail to start the program")
+	}
+	proc.Stop(true)
+	if proc.GetState() != Stopped {
+		t.Error("fail to stop the program")
+	}
+}
+
+func TestProcessLastOutputReset(t *testing.T) {
+	proc := createTestProcesses(t, "[program:test]\ncommand=sh -c \"echo run; exec sleep 10\"\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\nlast_output_maxbytes=1KB\n")[0]
+	for i := 0; i < 2; i++ {
+		proc.Start(true)
+		for deadline := time.Now().Add(5 * time.Second); proc.GetLastOutput() == "" && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+		}
+		proc.Stop(true)
+		if output := proc.GetLastOutput(); output != "run\n" {
+			t.Errorf("fail to keep only the last output of the run %d: %q", i, output)
+		}
+	}
+}
+
+func TestProcessUptime(t *testing.T) {
+	proc := createTestProcesses(t, "[program:test]\ncommand=sleep 10\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n")[0]
+	if proc.GetUptime() != 0 {
+		t.Error("fail to get no uptime for the program not started")
+	}
+	proc.Start(true)
+	defer proc.Stop(true)
+	time.Sleep(100 * time.Millisecond)
+	if uptime := proc.GetUptime(); uptime < 100*time.Millisecond || uptime > 5*time.Second {
+		t.Errorf("fail to get the uptime of the running program: %v", uptime)
+	}
+	// a start time ahead of the wall clock without monotonic reading
+	proc.lock.Lock()
+	proc.startTime = time.Now().Add(time.Hour).Round(0)
+	proc.lock.Unlock()
+	if proc.GetUptime() != 0 {
+		t.Error("fail to get a non negative uptime after the clock is stepped back")
+	}
+}
+
+func TestProcessStopInBackoff(t *testing.T) {
+	proc := createTestProcesses(t, "[program:test]\ncommand=sh -c \"exit 1\"\nstartsecs=1\nstartretries=10\nrestartpause=10\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n")[0]
+	proc.Start(false)
+	for i := 0; i < 50 && proc.GetState() != Backoff; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	start := time.Now()
+	proc.Stop(true)
+	if proc.GetState() != Stopped || time.Since(start) > 2*time.Second {
+		t.Error("fail to stop the program in backoff state")
+	}
+}
+
+func TestProcessConcurrentStart(t *testing.T) {
+	proc := createTestProcesses(t, "[program:test]\ncommand=sleep 10\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n")[0]
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			proc.Start(true)
+		}()
+	}
+	wg.Wait()
+	spawned := 0
+	for _, transition := range proc.GetStateHistory() {
+		if transition.To == State(Spawning).String() {
+			spawned++
+		}
+	}
+	if spawned != 1 || proc.GetState() != Running {
+		t.Error("fail to spawn only one process for concurrent starts")
+	}
+	proc.Stop(true)
+}
+
+func TestProcessSpawnWithLiveProcess(t *testing.T) {
+	proc := createTestProcesses(t, "[program:test]\ncommand=sleep 10\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n")[0]
+	proc.Start(true)
+	proc.lock.Lock()
+	err := proc.spawn()
+	proc.lock.Unlock()
+	if err != errAlreadySpawned {
+		t.Error("fail to refuse spawning a second process")
+	}
+	proc.Stop(true)
+}
+
+func TestGetSpawnConfig(t *testing.T) {
+	proc := createTestProcesses(t, "[program:test]\ncommand=sleep 10\nenvironment=DB_PASSWORD=\"123\",NAME=\"%(program_name)s\"\ndirectory=/tmp\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n")[0]
+	spawnConfig, err := proc.GetSpawnConfig()
+	if err != nil || spawnConfig.Spawned || len(spawnConfig.Command) != 2 || spawnConfig.Directory != "/tmp" {
+		t.Error("fail to resolve the config of the program not spawned")
+	}
+	env := strings.Join(spawnConfig.Environment, "\n")
+	if !strings.Contains(env, "DB_PASSWORD=******") || !strings.Contains(env, "NAME=test") {
+		t.Error("fail to resolve the environment with the secrets masked")
+	}
+	proc.Start(true)
+	defer proc.Stop(true)
+	spawnConfig, err = proc.GetSpawnConfig()
+	if err != nil || !spawnConfig.Spawned || spawnConfig.SpawnTime.IsZero() {
+		t.Error("fail to get the config of the spawned program")
+	}
+}
+
+func TestProcessDescription(t *testing.T) {
+	procs := createTestProcesses(t, "[program:test]\ncommand=sleep 10\nstartsecs=0\nstdout_logfile=/dev/null, /tmp/test.log\nredirect_stderr=true\n\n"+
+		"[program:fail]\ncommand=sh -c \"exit 3\"\nstartsecs=1\nstartretries=0\nautorestart=false\nstdout_logfile=/dev/null\n")
+	proc, fail := procs[0], procs[1]
+	if proc.GetName() != "test" {
+		proc, fail = fail, proc
+	}
+	if proc.GetDescription() != "Not started" {
+		t.Errorf("fail to describe the program not started: %s", proc.GetDescription())
+	}
+	if stdout, stderr := proc.GetLogfilePaths(); stdout != "/tmp/test.log" || stderr != "" {
+		t.Errorf("fail to get the log files: %s %s", stdout, stderr)
+	}
+	proc.Start(true)
+	if !strings.HasPrefix(proc.GetDescription(), "pid ") || !strings.HasSuffix(proc.GetDescription(), ", uptime 0:00:00") {
+		t.Errorf("fail to describe the running program: %s", proc.GetDescription())
+	}
+	proc.Stop(true)
+	if proc.GetDescription() != proc.GetStopTime().Format("Jan 02 03:04 PM") {
+		t.Errorf("fail to describe the stopped program: %s", proc.GetDescription())
+	}
+
+	fail.Start(true)
+	for i := 0; i < 50 && fail.GetState() != Fatal; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if fail.GetSpawnErr() != "Exited too quickly (process log may have details)" || fail.GetDescription() != fail.GetSpawnErr() || fail.GetExitstatus() != 3 {
+		t.Errorf("fail to describe the program failed to start: %s %d", fail.GetDescription(), fail.GetExitstatus())
+	}
+}
+
+func TestProcessInheritLog(t *testing.T) {
+	proc := createTestProcesses(t, "[program:test]\ncommand=sleep 10\nstartsecs=0\nstdout_logfile=INHERIT\nstderr_logfile=inherit\n")[0]
+	proc.Start(true)
+	defer proc.Stop(true)
+	if proc.cmd.Stdout != os.Stdout || proc.cmd.Stderr != os.Stderr {
+		t.Error("fail to pass the stdout and stderr of supervisord to the program")
+	}
+	if _, err := proc.StdoutLog.ReadLog(0, 100); err == nil {
+		t.Error("fail to report the inherited log can't be read")
+	}
+	if stdout, stderr := proc.GetLogfilePaths(); stdout != "" || stderr != "" {
+		t.Errorf("fail to report no log file: %s %s", stdout, stderr)
+	}
+	if _, err := os.Stat("INHERIT"); err == nil {
+		t.Error("fail to ignore the log file INHERIT")
+	}
+}
@@ -0,0 +1,203 @@
+package process
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Reliability the start, restart and failure statistics of a program, they
+// are kept across the restarts of supervisord in the state file
+type Reliability struct {
+	Name  string `json:"name"`
+	Group string `json:"group"`
+	// the number of the spawned OS processes
+	Starts int `json:"starts"`
+	// the number of the OS processes spawned after a failure
+	Restarts int `json:"restarts"`
+	// the number of the unexpected exits
+	Failures int `json:"failures"`
+	// the total running seconds of the OS processes
+	Uptime int64 `json:"uptime"`
+	// the mean running seconds between two failures, 0 without failure
+	MTBF int64 `json:"mtbf"`
+	// the unix time of the last failure, 0 without failure
+	LastFailure int64 `json:"last_failure"`
+}
+
+// the statistics of a program saved in the state file
+type reliabilityRecord struct {
+	Starts   int `json:"starts"`
+	Restarts int `json:"restarts"`
+	Failures int `json:"failures"`
+	// the running seconds of the exited OS processes
+	Uptime      float64 `json:"uptime"`
+	LastFailure int64   `json:"last_failure"`
+	// true if the last OS process failed, the next spawn is a restart
+	Failed bool `json:"failed"`
+	// the spawn time of the running OS process
+	spawnTime time.Time
+}
+
+// the content of the state file
+type stateFileContent struct {
+	Reliability map[string]*reliabilityRecord `json:"reliability"`
+}
+
+// reliabilityStore the statistics of all the programs by name
+type reliabilityStore struct {
+	lock     sync.Mutex
+	fileName string
+	records  map[string]*reliabilityRecord
+	// the clock of the spawn and query times, time.Now if nil
+	clock func() time.Time
+}
+
+func (rs *reliabilityStore) now() time.Time {
+	if rs.clock == nil {
+		return time.Now()
+	}
+	return rs.clock()
+}
+
+var reliabilityState = &reliabilityStore{records: make(map[string]*reliabilityRecord)}
+
+// SetStateFile set the file where the statistics of the programs are saved and
+// load the statistics saved in it. The statistics are only kept in memory if
+// the file name is empty
+func SetStateFile(fileName string) error {
+	return reliabilityState.setFile(fileName)
+}
+
+func (rs *reliabilityStore) setFile(fileName string) error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	if fileName == rs.fileName {
+		return nil
+	}
+	rs.fileName = fileName
+	if fileName == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return rs.save()
+	}
+	if err != nil {
+		return err
+	}
+	content := stateFileContent{}
+	if err = json.Unmarshal(b, &content); err != nil {
+		return err
+	}
+	for name, record := range content.Reliability {
+		if old, ok := rs.records[name]; ok {
+			record.spawnTime = old.spawnTime
+		}
+		rs.records[name] = record
+	}
+	return nil
+}
+
+// save the statistics to the state file, must be called with the lock hold
+func (rs *reliabilityStore) save() error {
+	if rs.fileName == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(stateFileContent{Reliability: rs.records}, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write a temporary file and rename it to never leave a partial state file
+	os.MkdirAll(filepath.Dir(rs.fileName), 0755)
+	tmpFile := rs.fileName + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, rs.fileName)
+}
+
+func (rs *reliabilityStore) getRecord(name string) *reliabilityRecord {
+	record, ok := rs.records[name]
+	if !ok {
+		record = &reliabilityRecord{}
+		rs.records[name] = record
+	}
+	return record
+}
+
+// update the statistics of the program and save them
+func (rs *reliabilityStore) update(name string, updateFunc func(record *reliabilityRecord)) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	updateFunc(rs.getRecord(name))
+	if err := rs.save(); err != nil {
+		log.WithFields(log.Fields{"file": rs.fileName, log.ErrorKey: err}).Error("fail to save the state file")
+	}
+}
+
+func (rs *reliabilityStore) get(name string, now time.Time) Reliability {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	record, ok := rs.records[name]
+	if !ok {
+		return Reliability{Name: name}
+	}
+	uptime := record.Uptime
+	// the times are compared with their monotonic clock readings
+	if !record.spawnTime.IsZero() && now.After(record.spawnTime) {
+		uptime += now.Sub(record.spawnTime).Seconds()
+	}
+	result := Reliability{Name: name,
+		Starts:      record.Starts,
+		Restarts:    record.Restarts,
+		Failures:    record.Failures,
+		Uptime:      int64(uptime),
+		LastFailure: record.LastFailure}
+	if record.Failures > 0 {
+		result.MTBF = int64(uptime) / int64(record.Failures)
+	}
+	return result
+}
+
+// record the spawn of the OS process of the program
+func (p *Process) recordSpawn() {
+	now := reliabilityState.now()
+	reliabilityState.update(p.GetName(), func(record *reliabilityRecord) {
+		record.Starts++
+		if record.Failed {
+			record.Restarts++
+			record.Failed = false
+		}
+		record.spawnTime = now
+	})
+}
+
+// record the exit of the OS process of the program, failure is true if it exits unexpectedly
+func (p *Process) recordExit(failure bool) {
+	reliabilityState.update(p.GetName(), func(record *reliabilityRecord) {
+		if !record.spawnTime.IsZero() {
+			if p.stopTime.After(record.spawnTime) {
+				record.Uptime += p.stopTime.Sub(record.spawnTime).Seconds()
+			}
+			record.spawnTime = time.Time{}
+		}
+		record.Failed = failure
+		if failure {
+			record.Failures++
+			record.LastFailure = p.stopTime.Unix()
+		}
+	})
+}
+
+// GetReliability get the start, restart and failure statistics of the program
+func (p *Process) GetReliability() Reliability {
+	result := reliabilityState.get(p.GetName(), reliabilityState.now())
+	result.Group = p.GetGroup()
+	return result
+}
@@ -0,0 +1,65 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReliability(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal("fail to create temporary directory")
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "supervisord.state")
+	defer func(state *reliabilityStore) { reliabilityState = state }(reliabilityState)
+	reliabilityState = &reliabilityStore{records: make(map[string]*reliabilityRecord)}
+	if err := SetStateFile(stateFile); err != nil {
+		t.Fatalf("fail to create the state file: %v", err)
+	}
+
+	proc := createTestProcesses(t, "[program:flaky]\ncommand=sh -c 'exit 1'\nstartsecs=0\nautorestart=false\n")[0]
+	proc.Start(true)
+	defer proc.Stop(true)
+	for i := 0; i < 50 && proc.GetState() != Exited; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if r := proc.GetReliability(); proc.GetState() != Exited || r.Starts != 1 || r.Restarts != 0 || r.Failures != 1 || r.Uptime > 5 || r.LastFailure == 0 {
+		t.Fatalf("fail to record the start and the failure of the program: %+v", r)
+	}
+
+	// the next runs are recorded with a fake clock
+	now := time.Now()
+	reliabilityState.clock = func() time.Time { return now }
+	for i := 0; i < 2; i++ {
+		proc.recordSpawn()
+		now = now.Add(10 * time.Second)
+		proc.lock.Lock()
+		proc.stopTime = now
+		proc.lock.Unlock()
+		proc.recordExit(true)
+	}
+	proc.recordSpawn()
+	now = now.Add(30 * time.Second)
+	r := proc.GetReliability()
+	if r.Starts != 4 || r.Restarts != 3 || r.Failures != 3 || r.Uptime < 50 || r.Uptime > 55 || r.MTBF != r.Uptime/3 || r.LastFailure != proc.stopTime.Unix() {
+		t.Errorf("fail to count the starts and the failures: %+v", r)
+	}
+	proc.lock.Lock()
+	proc.stopTime = now
+	proc.lock.Unlock()
+	proc.recordExit(false)
+	r = proc.GetReliability()
+
+	// the statistics are loaded from the state file
+	reliabilityState = &reliabilityStore{records: make(map[string]*reliabilityRecord), clock: reliabilityState.clock}
+	if err := SetStateFile(stateFile); err != nil {
+		t.Fatalf("fail to load the state file: %v", err)
+	}
+	if loaded := proc.GetReliability(); loaded != r {
+		t.Errorf("fail to load the statistics from the state file: %+v", loaded)
+	}
+}
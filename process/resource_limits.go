@@ -0,0 +1,262 @@
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ochinchina/supervisord/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// the period of the CPU quota of the cgroup
+const cpuPeriodMicros = 100000
+
+// the limits applied if a program has no configured limit
+var defaultResourceLimits = types.ResourceLimits{Memory: "max", CPU: "max", Nice: "0"}
+
+// parse the memory limit like "512MB", -1 for "max"
+func parseMemoryLimit(value string) (int64, error) {
+	if value == "max" {
+		return -1, nil
+	}
+	factor := int64(1)
+	for suffix, f := range map[string]int64{"KB": 1024, "MB": 1024 * 1024, "GB": 1024 * 1024 * 1024} {
+		if strings.HasSuffix(value, suffix) {
+			value, factor = strings.TrimSuffix(value, suffix), f
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid memory limit %q, a size like 512MB or max", value)
+	}
+	return n * factor, nil
+}
+
+// parse the CPU limit in percent of a CPU like "150", -1 for "max"
+func parseCPULimit(value string) (int, error) {
+	if value == "max" {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid CPU limit %q, a percent of a CPU like 150 or max", value)
+	}
+	return n, nil
+}
+
+// parse the nice value from -20 to 19
+func parseNice(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < -20 || n > 19 {
+		return 0, fmt.Errorf("invalid nice value %q, from -20 to 19", value)
+	}
+	return n, nil
+}
+
+// check the limits which are set
+func validateResourceLimits(limits types.ResourceLimits) error {
+	if limits.Memory != "" {
+		if _, err := parseMemoryLimit(limits.Memory); err != nil {
+			return err
+		}
+	}
+	if limits.CPU != "" {
+		if _, err := parseCPULimit(limits.CPU); err != nil {
+			return err
+		}
+	}
+	if limits.Nice != "" {
+		if _, err := parseNice(limits.Nice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the limits set in override replace the ones in limits
+func mergeResourceLimits(limits types.ResourceLimits, override types.ResourceLimits) types.ResourceLimits {
+	if override.Memory != "" {
+		limits.Memory = override.Memory
+	}
+	if override.CPU != "" {
+		limits.CPU = override.CPU
+	}
+	if override.Nice != "" {
+		limits.Nice = override.Nice
+	}
+	return limits
+}
+
+// write the file of cgroup v2 if it exists in the cgroup directory, the file
+// of cgroup v1 otherwise
+func writeCgroupFile(dir string, v2File string, v2Value string, v1File string, v1Value string) error {
+	fileName := filepath.Join(dir, v2File)
+	if _, err := os.Stat(fileName); err == nil {
+		return ioutil.WriteFile(fileName, []byte(v2Value), 0644)
+	}
+	return ioutil.WriteFile(filepath.Join(dir, v1File), []byte(v1Value), 0644)
+}
+
+// set the memory limit of the cgroup, memory.max of cgroup v2 or
+// memory.limit_in_bytes of cgroup v1
+func setCgroupMemoryLimit(dir string, value string) error {
+	limit, err := parseMemoryLimit(value)
+	if err != nil {
+		return err
+	}
+	v2 := "max"
+	if limit > 0 {
+		v2 = strconv.FormatInt(limit, 10)
+	}
+	return writeCgroupFile(dir, "memory.max", v2, "memory.limit_in_bytes", strconv.FormatInt(limit, 10))
+}
+
+// set the CPU quota of the cgroup, cpu.max of cgroup v2 or cpu.cfs_quota_us
+// of cgroup v1
+func setCgroupCPULimit(dir string, value string) error {
+	percent, err := parseCPULimit(value)
+	if err != nil {
+		return err
+	}
+	quota := int64(-1)
+	if percent > 0 {
+		quota = int64(percent) * cpuPeriodMicros / 100
+	}
+	v2 := fmt.Sprintf("max %d", cpuPeriodMicros)
+	if quota > 0 {
+		v2 = fmt.Sprintf("%d %d", quota, cpuPeriodMicros)
+	}
+	return writeCgroupFile(dir, "cpu.max", v2, "cpu.cfs_quota_us", strconv.FormatInt(quota, 10))
+}
+
+// get the limits configured by memory_limit, cpu_limit_percent and nice
+func (p *Process) getConfiguredResourceLimits() types.ResourceLimits {
+	return types.ResourceLimits{Memory: p.config.GetString("memory_limit", ""),
+		CPU:  p.config.GetString("cpu_limit_percent", ""),
+		Nice: p.config.GetString("nice", "")}
+}
+
+// apply the limits which are set to the OS process of the program, the
+// memory and CPU limits are set on the cgroup of the program
+func (p *Process) applyResourceLimits(pid int, limits types.ResourceLimits) error {
+	dir := p.config.GetString("cgroup", "")
+	if dir == "" && (limits.Memory != "" || limits.CPU != "") {
+		return fmt.Errorf("the program %s has no cgroup to limit its memory and CPU", p.GetName())
+	}
+	if limits.Memory != "" {
+		if err := setCgroupMemoryLimit(dir, limits.Memory); err != nil {
+			return err
+		}
+	}
+	if limits.CPU != "" {
+		if err := setCgroupCPULimit(dir, limits.CPU); err != nil {
+			return err
+		}
+	}
+	if limits.Nice != "" {
+		nice, err := parseNice(limits.Nice)
+		if err != nil {
+			return err
+		}
+		return setNice(pid, nice)
+	}
+	return nil
+}
+
+// apply the limits to the started program, it is already in its cgroup. The
+// override of SetResourceLimits is kept across the restarts. Must be called
+// with the lock hold
+func (p *Process) setResourceLimits() {
+	pid := p.cmd.Process.Pid
+	limits := p.getConfiguredResourceLimits()
+	if p.limitsOverride != nil {
+		limits = mergeResourceLimits(limits, *p.limitsOverride)
+	}
+	if err := p.applyResourceLimits(pid, limits); err != nil {
+		log.WithFields(log.Fields{"program": p.GetName(), log.ErrorKey: err}).Warn("fail to set the resource limits")
+	}
+}
+
+// GetResourceLimits get the limits of the program, the configured limits
+// replaced by the ones changed at runtime, "max" or "0" if not limited
+func (p *Process) GetResourceLimits() types.ResourceLimits {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	limits := mergeResourceLimits(defaultResourceLimits, p.getConfiguredResourceLimits())
+	if p.limitsOverride != nil {
+		limits = mergeResourceLimits(limits, *p.limitsOverride)
+	}
+	return limits
+}
+
+// GetChangedResourceLimits get the limits changed at runtime since the last
+// reload, empty if they are unchanged
+func (p *Process) GetChangedResourceLimits() types.ResourceLimits {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.limitsOverride == nil {
+		return types.ResourceLimits{}
+	}
+	return *p.limitsOverride
+}
+
+// SetResourceLimits change the limits which are set without restarting the
+// program. They are applied to the running program and kept across its
+// restarts until the limits are reset by the next reload
+func (p *Process) SetResourceLimits(limits types.ResourceLimits) error {
+	if err := validateResourceLimits(limits); err != nil {
+		return err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.cmd != nil && p.cmd.Process != nil && (p.state == Starting || p.state == Running) {
+		if err := p.applyResourceLimits(p.cmd.Process.Pid, limits); err != nil {
+			return err
+		}
+	} else if p.config.GetString("cgroup", "") == "" && (limits.Memory != "" || limits.CPU != "") {
+		return fmt.Errorf("the program %s has no cgroup to limit its memory and CPU", p.GetName())
+	}
+	override := limits
+	if p.limitsOverride != nil {
+		override = mergeResourceLimits(*p.limitsOverride, limits)
+	}
+	p.limitsOverride = &override
+	log.WithFields(log.Fields{"program": p.GetName(), "memory": override.Memory, "cpu": override.CPU, "nice": override.Nice}).Warn("the resource limits of the program are changed")
+	return nil
+}
+
+// ResetResourceLimits drop the limits changed at runtime and apply the
+// configured limits again (or no limit) to the running program
+func (p *Process) ResetResourceLimits() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.limitsOverride == nil {
+		return
+	}
+	// only the changed limits are applied again
+	configured := mergeResourceLimits(defaultResourceLimits, p.getConfiguredResourceLimits())
+	limits := types.ResourceLimits{}
+	if p.limitsOverride.Memory != "" {
+		limits.Memory = configured.Memory
+	}
+	if p.limitsOverride.CPU != "" {
+		limits.CPU = configured.CPU
+	}
+	if p.limitsOverride.Nice != "" {
+		limits.Nice = configured.Nice
+	}
+	p.limitsOverride = nil
+	if p.cmd == nil || p.cmd.Process == nil || (p.state != Starting && p.state != Running) {
+		return
+	}
+	if err := p.applyResourceLimits(p.cmd.Process.Pid, limits); err != nil {
+		log.WithFields(log.Fields{"program": p.GetName(), log.ErrorKey: err}).Warn("fail to reset the resource limits")
+	} else {
+		log.WithFields(log.Fields{"program": p.GetName()}).Info("the resource limits of the program are reset to the configuration")
+	}
+}
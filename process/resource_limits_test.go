@@ -0,0 +1,87 @@
+// +build linux
+
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ochinchina/supervisord/types"
+)
+
+// get the nice value of the OS process
+func readProcNice(pid int) string {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return ""
+	}
+	fields := strings.Fields(string(b)[strings.LastIndexByte(string(b), ')')+1:])
+	return fields[16]
+}
+
+func TestProcessResourceLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "memory.max"), []byte("max"), 0644)
+	proc := createTestProcesses(t, fmt.Sprintf("[program:test]\ncommand=sleep 10\nstartsecs=0\ncgroup=%s\nmemory_limit=1GB\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n", dir))[0]
+	proc.Start(true)
+	defer proc.Stop(true)
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "cgroup.procs")); string(b) != fmt.Sprint(proc.GetPid()) {
+		t.Errorf("fail to move the program to its cgroup: %q", b)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "memory.max")); string(b) != "1073741824" {
+		t.Errorf("fail to set the configured memory limit: %q", b)
+	}
+
+	if err := proc.SetResourceLimits(types.ResourceLimits{Nice: "20"}); err == nil {
+		t.Error("fail to refuse the invalid nice value")
+	}
+	if err := proc.SetResourceLimits(types.ResourceLimits{Memory: "512MB", CPU: "150", Nice: "5"}); err != nil {
+		t.Fatalf("fail to change the resource limits: %v", err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "memory.max")); string(b) != "536870912" {
+		t.Errorf("fail to change the memory limit: %q", b)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "cpu.cfs_quota_us")); string(b) != "150000" {
+		t.Errorf("fail to change the CPU limit of cgroup v1: %q", b)
+	}
+	if nice := readProcNice(proc.GetPid()); nice != "5" {
+		t.Errorf("fail to change the nice value: %s", nice)
+	}
+	if limits := proc.GetResourceLimits(); limits != (types.ResourceLimits{Memory: "512MB", CPU: "150", Nice: "5"}) {
+		t.Errorf("fail to get the changed limits: %v", limits)
+	}
+
+	proc.ResetResourceLimits()
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "memory.max")); string(b) != "1073741824" {
+		t.Errorf("fail to reset the memory limit: %q", b)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "cpu.cfs_quota_us")); string(b) != "-1" {
+		t.Errorf("fail to reset the CPU limit: %q", b)
+	}
+	if limits := proc.GetResourceLimits(); limits != (types.ResourceLimits{Memory: "1GB", CPU: "max", Nice: "0"}) {
+		t.Errorf("fail to get the configured limits: %v", limits)
+	}
+}
+
+func TestResourceLimitsWithoutCgroup(t *testing.T) {
+	proc := createTestProcesses(t, "[program:test]\ncommand=sleep 10\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n")[0]
+	if err := proc.SetResourceLimits(types.ResourceLimits{Memory: "512MB"}); err == nil {
+		t.Error("fail to refuse the memory limit without cgroup")
+	}
+	if err := proc.SetResourceLimits(types.ResourceLimits{Nice: "3"}); err != nil {
+		t.Fatalf("fail to change the nice value of the stopped program: %v", err)
+	}
+	proc.Start(true)
+	defer proc.Stop(true)
+	if nice := readProcNice(proc.GetPid()); nice != "3" {
+		t.Errorf("fail to keep the nice value across the start: %s", nice)
+	}
+}
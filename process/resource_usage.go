@@ -0,0 +1,25 @@
+package process
+
+// ResourceUsage the CPU time and the memory used by the running OS process
+// of a program
+type ResourceUsage struct {
+	// the user and system CPU seconds
+	CPUTime float64
+	// the resident memory in bytes
+	RSS int64
+}
+
+// GetResourceUsage get the CPU time and the memory used by the running OS
+// process, zero if the program is not running or the usage is not supported
+// on this system
+func (p *Process) GetResourceUsage() ResourceUsage {
+	pid := p.GetPid()
+	if pid <= 0 {
+		return ResourceUsage{}
+	}
+	usage, err := readResourceUsage(pid)
+	if err != nil {
+		return ResourceUsage{}
+	}
+	return usage
+}
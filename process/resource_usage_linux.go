@@ -0,0 +1,46 @@
+// +build linux
+
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// the clock ticks per second of the CPU times in /proc, USER_HZ is 100 on
+// all the linux architectures
+const clockTicks = 100
+
+func readResourceUsage(pid int) (ResourceUsage, error) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return ResourceUsage{}, err
+	}
+	// the command name in parentheses may contain spaces
+	stat := string(b)
+	index := strings.LastIndexByte(stat, ')')
+	if index < 0 {
+		return ResourceUsage{}, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	// the fields from the 3rd one (state)
+	fields := strings.Fields(stat[index+1:])
+	if len(fields) < 22 {
+		return ResourceUsage{}, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return ResourceUsage{}, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return ResourceUsage{}, err
+	}
+	rss, err := strconv.ParseInt(fields[21], 10, 64)
+	if err != nil {
+		return ResourceUsage{}, err
+	}
+	return ResourceUsage{CPUTime: float64(utime+stime) / clockTicks, RSS: rss * int64(os.Getpagesize())}, nil
+}
@@ -0,0 +1,11 @@
+// +build !linux
+
+package process
+
+import (
+	"fmt"
+)
+
+func readResourceUsage(pid int) (ResourceUsage, error) {
+	return ResourceUsage{}, fmt.Errorf("the resource usage is only supported on linux")
+}
@@ -0,0 +1,147 @@
+package process
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sourceState the files matching the watch globs of a program, compared
+// between two scans
+type sourceState map[string]time.Time
+
+func (s sourceState) equals(other sourceState) bool {
+	if len(s) != len(other) {
+		return false
+	}
+	for file, modTime := range s {
+		if otherTime, ok := other[file]; !ok || !otherTime.Equal(modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// WatchSources check the files matching the watch globs of the programs every
+// interval and restart the running programs whose files are added, removed or
+// modified. It never returns
+func (pm *Manager) WatchSources(interval time.Duration) {
+	states := make(map[*Process]sourceState)
+	for {
+		pm.checkSources(states)
+		time.Sleep(interval)
+	}
+}
+
+// checkSources scan the watched files of the programs, compare them with the
+// states of the previous scan and restart the changed programs
+func (pm *Manager) checkSources(states map[*Process]sourceState) {
+	seen := make(map[*Process]bool)
+	pm.ForEachProcess(func(proc *Process) {
+		globs := proc.config.GetStringArray("watch", ",")
+		if len(globs) == 0 {
+			return
+		}
+		seen[proc] = true
+		state := scanSources(proc.getWatchDir(), globs)
+		prevState, ok := states[proc]
+		states[proc] = state
+		if !ok || state.equals(prevState) {
+			return
+		}
+		if procState := proc.GetState(); procState == Running || procState == Starting || procState == Backoff {
+			log.WithFields(log.Fields{"program": proc.GetName()}).Info("the watched files of the program are changed, restart it")
+			go func() {
+				proc.Stop(true)
+				proc.Start(false)
+			}()
+		}
+	})
+	// forget the removed programs
+	for proc := range states {
+		if !seen[proc] {
+			delete(states, proc)
+		}
+	}
+}
+
+// the directory of the relative watch globs, the directory of the program or
+// the directory of the configuration file
+func (p *Process) getWatchDir() string {
+	if dir := p.config.GetString("directory", ""); dir != "" {
+		return dir
+	}
+	return p.config.ConfigDir
+}
+
+// scanSources get the modification time of the files matching the globs, "**"
+// matches any number of directories. The ".git" directories are skipped
+func scanSources(dir string, globs []string) sourceState {
+	state := make(sourceState)
+	for _, glob := range globs {
+		glob = strings.TrimSpace(glob)
+		if glob == "" {
+			continue
+		}
+		if !filepath.IsAbs(glob) {
+			glob = filepath.Join(dir, glob)
+		}
+		pattern := filepath.ToSlash(glob)
+		filepath.Walk(getGlobBase(glob), func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if info.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if matchGlob(pattern, filepath.ToSlash(file)) {
+				state[file] = info.ModTime()
+			}
+			return nil
+		})
+	}
+	return state
+}
+
+// getGlobBase get the longest directory of the glob without pattern
+func getGlobBase(glob string) string {
+	base := glob
+	for strings.ContainsAny(base, "*?[") {
+		base = filepath.Dir(base)
+	}
+	return base
+}
+
+// matchGlob check if the slash separated path matches the glob, "**" matches
+// zero or more path elements and the other elements are matched by path.Match
+func matchGlob(glob string, name string) bool {
+	return matchGlobElements(strings.Split(glob, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobElements(glob []string, name []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlobElements(glob[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if matched, err := path.Match(glob[0], name[0]); err != nil || !matched {
+			return false
+		}
+		glob, name = glob[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,60 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatchGlob(t *testing.T) {
+	if !matchGlob("/src/**/*.go", "/src/main.go") || !matchGlob("/src/**/*.go", "/src/a/b/main.go") || !matchGlob("/src/*.go", "/src/main.go") {
+		t.Error("fail to match the glob")
+	}
+	if matchGlob("/src/**/*.go", "/src/a/main.js") || matchGlob("/src/*.go", "/src/a/main.go") || matchGlob("/src/**/*.go", "/other/main.go") {
+		t.Error("fail to reject the glob")
+	}
+	if getGlobBase("/src/**/*.go") != "/src" || getGlobBase("/src/main.go") != "/src/main.go" {
+		t.Error("fail to get the base directory of the glob")
+	}
+}
+
+func TestWatchSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal("fail to create temporary directory")
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "src", "pkg"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main"), 0644)
+
+	pm := createTestManager(t, "[program:app]\ncommand=sleep 10\nstartsecs=0\ndirectory="+dir+"\nwatch=src/**/*.go\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n")
+	app := pm.Find("app")
+	app.Start(true)
+	defer app.Stop(true)
+	pid := app.GetPid()
+
+	states := make(map[*Process]sourceState)
+	pm.checkSources(states)
+	if len(states[app]) != 1 {
+		t.Fatalf("fail to scan the watched files: %v", states[app])
+	}
+	// the files not matching the glob are ignored
+	ioutil.WriteFile(filepath.Join(dir, "src", "README"), []byte("readme"), 0644)
+	pm.checkSources(states)
+	time.Sleep(100 * time.Millisecond)
+	if app.GetPid() != pid {
+		t.Error("the program should not be restarted by the files not watched")
+	}
+	ioutil.WriteFile(filepath.Join(dir, "src", "pkg", "lib.go"), []byte("package pkg"), 0644)
+	pm.checkSources(states)
+	restarted := false
+	for i := 0; i < 50 && !restarted; i++ {
+		time.Sleep(100 * time.Millisecond)
+		restarted = app.GetState() == Running && app.GetPid() != pid
+	}
+	if !restarted {
+		t.Error("fail to restart the program when a watched file is added")
+	}
+}
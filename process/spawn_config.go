@@ -0,0 +1,74 @@
+package process
+
+import (
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/ochinchina/supervisord/secret"
+)
+
+// SpawnConfig the resolved configuration used to spawn the program: the
+// command with the expressions evaluated, the full environment and so on
+type SpawnConfig struct {
+	// false if the program is not spawned yet, the config is resolved from the current settings
+	Spawned        bool
+	SpawnTime      time.Time
+	Command        []string // the command arguments with the secrets masked
+	Environment    []string // the "key=value" environment with the secrets masked
+	User           string
+	Directory      string
+	StdoutLogfile  string
+	StderrLogfile  string
+	RedirectStderr bool
+}
+
+// GetSpawnConfig get the configuration used when the program was spawned last
+// time. If the program has never been spawned, the configuration is resolved
+// from the current settings without spawning it
+func (p *Process) GetSpawnConfig() (SpawnConfig, error) {
+	p.lock.RLock()
+	if p.spawnConfig != nil {
+		spawnConfig := *p.spawnConfig
+		p.lock.RUnlock()
+		return spawnConfig, nil
+	}
+	p.lock.RUnlock()
+
+	driver, err := getDriver(p.config)
+	if err != nil {
+		return SpawnConfig{}, err
+	}
+	args, err := driver.Command(p.config.GetStringExpression("command", ""))
+	if err != nil {
+		return SpawnConfig{}, err
+	}
+	cmd := exec.Command(args[0])
+	cmd.Args = args
+	cmd.Env = p.getEnv()
+	cmd.Dir = p.getDir()
+	return p.createSpawnConfig(cmd), nil
+}
+
+func (p *Process) createSpawnConfig(cmd *exec.Cmd) SpawnConfig {
+	dir := cmd.Dir
+	if dir == "" {
+		// the program runs in the working directory of supervisord
+		dir, _ = os.Getwd()
+	}
+	return SpawnConfig{Command: secret.MaskArgs(cmd.Args),
+		Environment:    secret.MaskEnv(cmd.Env),
+		User:           p.config.GetString("user", ""),
+		Directory:      dir,
+		StdoutLogfile:  p.GetStdoutLogfile(),
+		StderrLogfile:  p.GetStderrLogfile(),
+		RedirectStderr: p.config.GetBool("redirect_stderr", false)}
+}
+
+// save the config of the spawned program, must be called with the lock hold
+func (p *Process) saveSpawnConfig() {
+	spawnConfig := p.createSpawnConfig(p.cmd)
+	spawnConfig.Spawned = true
+	spawnConfig.SpawnTime = time.Now()
+	p.spawnConfig = &spawnConfig
+}
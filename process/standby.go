@@ -0,0 +1,25 @@
+package process
+
+import (
+	"sync"
+)
+
+var standbyCheck func() bool
+var standbyLock sync.RWMutex
+
+// SetStandbyCheck set the function checking if supervisord is the standby in
+// active/standby mode, the programs are not started by cron or by the event
+// scripts while it returns true
+func SetStandbyCheck(check func() bool) {
+	standbyLock.Lock()
+	defer standbyLock.Unlock()
+	standbyCheck = check
+}
+
+// IsStandby check if supervisord is the standby in active/standby mode
+func IsStandby() bool {
+	standbyLock.RLock()
+	check := standbyCheck
+	standbyLock.RUnlock()
+	return check != nil && check()
+}
@@ -0,0 +1,162 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ochinchina/supervisord/signals"
+	log "github.com/sirupsen/logrus"
+)
+
+// the period of the freeze and thaw pulses of a throttled program
+const throttlePulsePeriod = 100 * time.Millisecond
+
+// freezer freeze and thaw the OS process of a throttled program
+type freezer interface {
+	freeze() error
+	thaw() error
+}
+
+// freeze the process and its children with SIGSTOP and thaw them with SIGCONT
+type signalFreezer struct {
+	p *Process
+}
+
+func (f *signalFreezer) freeze() error {
+	return f.signal("STOP")
+}
+
+func (f *signalFreezer) thaw() error {
+	return f.signal("CONT")
+}
+
+func (f *signalFreezer) signal(name string) error {
+	sig, err := signals.ToSignal(name)
+	if err != nil {
+		return err
+	}
+	return f.p.Signal(sig, true)
+}
+
+// freeze the processes of the cgroup of the program with the cgroup freezer,
+// cgroup.freeze of cgroup v2 or freezer.state of cgroup v1
+type cgroupFreezer struct {
+	dir string
+}
+
+func (f *cgroupFreezer) freeze() error {
+	return f.write("1", "FROZEN")
+}
+
+func (f *cgroupFreezer) thaw() error {
+	return f.write("0", "THAWED")
+}
+
+func (f *cgroupFreezer) write(v2State string, v1State string) error {
+	fileName := filepath.Join(f.dir, "cgroup.freeze")
+	if _, err := os.Stat(fileName); err == nil {
+		return ioutil.WriteFile(fileName, []byte(v2State), 0644)
+	}
+	return ioutil.WriteFile(filepath.Join(f.dir, "freezer.state"), []byte(v1State), 0644)
+}
+
+// the throttling of a program in progress
+type throttling struct {
+	cancel context.CancelFunc
+	// closed when the program is thawed for the last time
+	done  chan struct{}
+	until time.Time
+}
+
+// get the freezer of the program, the cgroup freezer if throttle_cgroup is set
+func (p *Process) getFreezer() freezer {
+	if dir := p.config.GetString("throttle_cgroup", ""); dir != "" {
+		return &cgroupFreezer{dir: dir}
+	}
+	return &signalFreezer{p: p}
+}
+
+// Throttle freeze and thaw the running program in pulses for the duration
+// instead of killing it, so it leaves the CPU to its neighbors. The program
+// runs dutyPercent of every pulse, the throttling in progress is replaced
+func (p *Process) Throttle(duration time.Duration, dutyPercent int) error {
+	if dutyPercent <= 0 || dutyPercent >= 100 {
+		return fmt.Errorf("the duty percent %d is not between 0 and 100", dutyPercent)
+	}
+	if p.GetState() != Running {
+		return fmt.Errorf("the program %s is not running", p.GetName())
+	}
+	f := p.getFreezer()
+	// check if the freezer is supported before the first pulse
+	if err := f.thaw(); err != nil {
+		return err
+	}
+
+	p.throttleLock.Lock()
+	defer p.throttleLock.Unlock()
+	p.stopThrottling()
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	p.throttling = &throttling{cancel: cancel, done: make(chan struct{}), until: time.Now().Add(duration)}
+	log.WithFields(log.Fields{"program": p.GetName(), "duration": duration.String(), "duty": dutyPercent}).Warn("throttle the program")
+	go p.pulse(ctx, p.throttling, f, dutyPercent)
+	return nil
+}
+
+// freeze and thaw the program until the context is done or the program exits
+func (p *Process) pulse(ctx context.Context, t *throttling, f freezer, dutyPercent int) {
+	defer close(t.done)
+	defer t.cancel()
+	frozen := throttlePulsePeriod * time.Duration(100-dutyPercent) / 100
+	for ctx.Err() == nil && p.GetState() == Running {
+		if err := f.freeze(); err != nil {
+			log.WithFields(log.Fields{"program": p.GetName(), log.ErrorKey: err}).Error("fail to freeze the throttled program")
+			break
+		}
+		sleepContext(ctx, frozen)
+		if err := f.thaw(); err != nil {
+			log.WithFields(log.Fields{"program": p.GetName(), log.ErrorKey: err}).Error("fail to thaw the throttled program")
+			break
+		}
+		sleepContext(ctx, throttlePulsePeriod-frozen)
+	}
+	// the program is never left frozen
+	f.thaw()
+	log.WithFields(log.Fields{"program": p.GetName()}).Info("the program is not throttled any more")
+}
+
+// stop the throttling in progress and wait the program is thawed, the lock
+// of the throttling must be held and the lock of the process must not
+func (p *Process) stopThrottling() {
+	if p.throttling != nil {
+		p.throttling.cancel()
+		<-p.throttling.done
+		p.throttling = nil
+	}
+}
+
+// Unthrottle stop the throttling in progress and thaw the program
+func (p *Process) Unthrottle() {
+	p.throttleLock.Lock()
+	defer p.throttleLock.Unlock()
+	p.stopThrottling()
+}
+
+// ThrottledUntil get the end of the throttling in progress, zero if the
+// program is not throttled
+func (p *Process) ThrottledUntil() time.Time {
+	p.throttleLock.Lock()
+	defer p.throttleLock.Unlock()
+	if p.throttling == nil {
+		return time.Time{}
+	}
+	select {
+	case <-p.throttling.done:
+		return time.Time{}
+	default:
+		return p.throttling.until
+	}
+}
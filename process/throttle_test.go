@@ -0,0 +1,81 @@
+// +build linux
+
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// get the state letter of the OS process, "T" if it is stopped
+func readProcState(pid int) string {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return ""
+	}
+	fields := strings.Fields(string(b)[strings.LastIndexByte(string(b), ')')+1:])
+	return fields[0]
+}
+
+func TestProcessThrottle(t *testing.T) {
+	proc := createTestProcesses(t, "[program:test]\ncommand=sleep 10\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n")[0]
+	if err := proc.Throttle(time.Second, 50); err == nil {
+		t.Error("fail to refuse to throttle the program not running")
+	}
+	proc.Start(true)
+	defer proc.Stop(true)
+	if err := proc.Throttle(time.Second, 100); err == nil {
+		t.Error("fail to refuse the invalid duty percent")
+	}
+	if err := proc.Throttle(time.Minute, 10); err != nil {
+		t.Fatalf("fail to throttle the program: %v", err)
+	}
+	if until := proc.ThrottledUntil(); until.Before(time.Now().Add(50 * time.Second)) {
+		t.Errorf("fail to get the end of the throttling: %v", until)
+	}
+	frozen := false
+	for i := 0; i < 50 && !frozen; i++ {
+		frozen = readProcState(proc.GetPid()) == "T"
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !frozen {
+		t.Error("fail to freeze the throttled program")
+	}
+	proc.Unthrottle()
+	if !proc.ThrottledUntil().IsZero() || readProcState(proc.GetPid()) == "T" {
+		t.Error("fail to thaw the program")
+	}
+
+	proc.Throttle(time.Minute, 10)
+	proc.Stop(true)
+	if proc.GetState() != Stopped || !proc.ThrottledUntil().IsZero() {
+		t.Errorf("fail to stop the throttled program: %v", proc.GetState())
+	}
+}
+
+func TestCgroupFreezer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f := &cgroupFreezer{dir: dir}
+	f.freeze()
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "freezer.state")); string(b) != "FROZEN" {
+		t.Errorf("fail to freeze the cgroup v1: %q", b)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "cgroup.freeze"), []byte("0"), 0644)
+	f.freeze()
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "cgroup.freeze")); string(b) != "1" {
+		t.Errorf("fail to freeze the cgroup v2: %q", b)
+	}
+	f.thaw()
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "cgroup.freeze")); string(b) != "0" {
+		t.Errorf("fail to thaw the cgroup v2: %q", b)
+	}
+}
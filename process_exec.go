@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/ochinchina/supervisord/faults"
+	"github.com/ochinchina/supervisord/logger"
+	"github.com/ochinchina/supervisord/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// the bytes of the output of a command run in the context of a program
+// returned to the client
+const execOutputBytes = 1024 * 1024
+
+// ExecInProcessContext run a command with the user, the environment, the
+// working directory and the cgroup of the program to debug an issue only
+// reproduced in its context, the program itself is not affected. The last
+// bytes of the output of the command and its exit status are returned once
+// it finishes, it is killed after the timeout
+func (s *Supervisor) ExecInProcessContext(r *http.Request, args *types.ExecArgs, reply *struct{ Result types.ExecResult }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "run a command in the context of "+args.Name); err != nil {
+		return err
+	}
+	command, reason := rpcString(args.Command), rpcString(args.Reason)
+	if command == "" {
+		return faults.NewFault(faults.BadArguments, "BAD_ARGUMENTS: no command to run")
+	}
+	proc := s.procMgr.Find(args.Name)
+	if proc == nil {
+		return badName(args.Name)
+	}
+	s.recordAction(r, "exec", []string{proc.GetName()}, reason)
+	log.WithFields(log.Fields{"program": proc.GetName(), "command": command}).Info("run a command in the context of the program")
+	ctx, cancel := s.operationContext(r, args.Timeout)
+	defer cancel()
+	output := logger.NewRingBuffer(execOutputBytes)
+	exitStatus, err := proc.Exec(ctx, command, output)
+	if err != nil {
+		return faults.NewFault(faults.SpawnError, "SPAWN_ERROR: "+err.Error())
+	}
+	reply.Result = types.ExecResult{Output: output.String(), ExitStatus: exitStatus}
+	return nil
+}
@@ -0,0 +1,35 @@
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"supervisord/internal/testutil"
+
+	"github.com/ochinchina/supervisord/types"
+)
+
+func TestExecInProcessContext(t *testing.T) {
+	dir := testutil.TempDir(t)
+	content := fmt.Sprintf(testSupervisordSection+"\n[program:sleeper]\ncommand=%[2]s\nautostart=false\ndirectory=%[1]s\nenvironment=GREETING=hello\n", dir, testutil.FakeProgram(t, dir, testutil.Sleep))
+	s := startConfSupervisor(t, dir, content)
+	rpcc := s.xmlRPC.NewInMemoryClient(s)
+
+	result, err := rpcc.ExecInProcessContext(types.ExecArgs{Name: "sleeper", Command: `/bin/sh -c 'echo "$GREETING"; pwd; exit 4'`})
+	if err != nil || result.Output != "hello\n"+dir+"\n" || result.ExitStatus != 4 {
+		t.Errorf("fail to run the command in the context of the program: %v %v", result, err)
+	}
+	if s.GetManager().Find("sleeper").GetState().String() != "Stopped" {
+		t.Errorf("the program is affected by the command")
+	}
+	_, err = rpcc.ExecInProcessContext(types.ExecArgs{Name: "missing", Command: "true"})
+	if err == nil || !strings.Contains(err.Error(), "BAD_NAME") {
+		t.Errorf("fail to refuse an unknown program: %v", err)
+	}
+	if _, err = rpcc.ExecInProcessContext(types.ExecArgs{Name: "sleeper"}); err == nil || !strings.Contains(err.Error(), "BAD_ARGUMENTS") {
+		t.Errorf("fail to refuse to run without command: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/process"
+)
+
+// ImportProcfileCommand implements flags.Commander interface
+type ImportProcfileCommand struct {
+	OutFile string `short:"o" long:"output" description:"the output configuration file, stdout by default"`
+}
+
+// ExportProcfileCommand implements flags.Commander interface
+type ExportProcfileCommand struct {
+	OutFile string `short:"o" long:"output" description:"the output Procfile, stdout by default"`
+}
+
+var importProcfileCommand ImportProcfileCommand
+var exportProcfileCommand ExportProcfileCommand
+
+// the characters not allowed in the process names of Procfile
+var procfileInvalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// create the output file, stdout if the file name is empty
+func createOutput(fileName string) (io.WriteCloser, error) {
+	if fileName == "" {
+		return os.Stdout, nil
+	}
+	return os.Create(fileName)
+}
+
+// Execute convert the Procfile to the program sections
+func (ic *ImportProcfileCommand) Execute(args []string) error {
+	if len(args) != 1 {
+		return exitOnError(fmt.Errorf("usage: supervisord import-procfile [-o supervisord.conf] Procfile"))
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return exitOnError(err)
+	}
+	defer f.Close()
+	entries, err := config.ParseProcfile(f)
+	if err != nil {
+		return exitOnError(fmt.Errorf("invalid Procfile %s: %v", args[0], err))
+	}
+	dir, err := filepath.Abs(filepath.Dir(args[0]))
+	if err != nil {
+		return exitOnError(err)
+	}
+	out, err := createOutput(ic.OutFile)
+	if err != nil {
+		return exitOnError(err)
+	}
+	defer out.Close()
+	return exitOnError(config.ProcfileToIni(entries, dir, out))
+}
+
+// Execute write the programs of the configuration file as a Procfile
+func (ec *ExportProcfileCommand) Execute(args []string) error {
+	if len(options.Configuration) <= 0 {
+		options.Configuration, _ = findSupervisordConf()
+	}
+	cfg := config.NewConfig(options.Configuration)
+	if _, err := cfg.Load(); err != nil {
+		return exitOnError(err)
+	}
+	out, err := createOutput(ec.OutFile)
+	if err != nil {
+		return exitOnError(err)
+	}
+	defer out.Close()
+	for _, entry := range cfg.GetPrograms() {
+		name := procfileInvalidNameChars.ReplaceAllString(entry.GetProgramName(), "_")
+		fmt.Fprintf(out, "%s: %s\n", name, getShellCommand(entry.GetString("command", "")))
+	}
+	return nil
+}
+
+// get the shell command of "/bin/sh -c <command>" imported from a Procfile,
+// the other commands are returned as is
+func getShellCommand(command string) string {
+	args, err := process.ParseCommand(command)
+	if err == nil && len(args) == 3 && (args[0] == "/bin/sh" || args[0] == "sh") && args[1] == "-c" {
+		return args[2]
+	}
+	return command
+}
+
+func init() {
+	parser.AddCommand("import-procfile",
+		"convert a Procfile to the program sections",
+		"The import-procfile subcommand writes a program section for each process of the Procfile, the command is run by /bin/sh with the PORT environment variable like foreman",
+		&importProcfileCommand)
+	parser.AddCommand("export-procfile",
+		"convert the programs to a Procfile",
+		"The export-procfile subcommand writes the command of each program of the configuration file as a Procfile line",
+		&exportProcfileCommand)
+}
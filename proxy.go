@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/types"
+	"github.com/ochinchina/supervisord/xmlrpcclient"
+	log "github.com/sirupsen/logrus"
+)
+
+// the separator between the program or group name and the node name,
+// for example "web@node1" is the program "web" in the child supervisord "node1"
+const nodeSeparator = "@"
+
+// split the name to the name in child supervisord and the node name.
+// Return false if the name is not in a configured node
+func (s *Supervisor) splitNodeName(name string) (string, *config.Entry, bool) {
+	pos := strings.LastIndex(name, nodeSeparator)
+	if pos == -1 {
+		return name, nil, false
+	}
+	nodeName := name[pos+len(nodeSeparator):]
+	for _, node := range s.config.GetNodes() {
+		if node.GetNodeName() == nodeName {
+			return name[0:pos], node, true
+		}
+	}
+	return name, nil, false
+}
+
+// create the xml rpc client to access the child supervisord
+func createNodeClient(node *config.Entry) *xmlrpcclient.XMLRPCClient {
+	client := xmlrpcclient.NewXMLRPCClient(node.GetString("serverurl", "http://localhost:9001"), false)
+	client.SetUser(node.GetString("username", ""))
+	client.SetPassword(node.GetString("password", ""))
+	client.SetTimeout(time.Duration(node.GetInt("timeout", 5)) * time.Second)
+	return client
+}
+
+// add the node name to the program name and group name of the process information
+func toNodeProcessInfo(procInfo types.ProcessInfo, nodeName string) types.ProcessInfo {
+	procInfo.Name = procInfo.Name + nodeSeparator + nodeName
+	procInfo.Group = procInfo.Group + nodeSeparator + nodeName
+	return procInfo
+}
+
+// get the process information of all the child supervisord nodes concurrently,
+// the node which can't be accessed is ignored
+func (s *Supervisor) getAllNodeProcessInfo() []types.ProcessInfo {
+	result := make([]types.ProcessInfo, 0)
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	for _, node := range s.config.GetNodes() {
+		wg.Add(1)
+		go func(node *config.Entry) {
+			defer wg.Done()
+			reply, err := createNodeClient(node).GetAllProcessInfo()
+			if err != nil {
+				log.WithFields(log.Fields{"node": node.GetNodeName(), log.ErrorKey: err}).Warn("fail to get the process information from node")
+				return
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			for _, procInfo := range reply.Value {
+				result = append(result, toNodeProcessInfo(procInfo, node.GetNodeName()))
+			}
+		}(node)
+	}
+	wg.Wait()
+	return result
+}
+
+// get the process information of the processes in a group of child supervisord node
+func getNodeGroupProcessInfo(node *config.Entry, group string) ([]types.ProcessInfo, error) {
+	reply, err := createNodeClient(node).GetAllProcessInfo()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]types.ProcessInfo, 0)
+	for _, procInfo := range reply.Value {
+		if procInfo.Group == group {
+			result = append(result, toNodeProcessInfo(procInfo, node.GetNodeName()))
+		}
+	}
+	return result, nil
+}
+
+// start or stop the program in the child supervisord node
+func changeNodeProcessState(node *config.Entry, change string, name string) error {
+	reply, err := createNodeClient(node).ChangeProcessState(change, name)
+	if err == nil && !reply.Value {
+		err = fmt.Errorf("fail to %s %s on node %s", change, name, node.GetNodeName())
+	}
+	return err
+}
+
+// start or stop all the programs in a group of child supervisord node
+func changeNodeGroupState(node *config.Entry, change string, group string) ([]types.ProcessInfo, error) {
+	if err := changeNodeProcessState(node, change, group+":*"); err != nil {
+		return nil, err
+	}
+	return getNodeGroupProcessInfo(node, group)
+}
+
+// send signal to the program in the child supervisord node
+func signalNodeProcess(node *config.Entry, signal string, name string) error {
+	reply, err := createNodeClient(node).SignalProcess(signal, name)
+	if err == nil && !reply.Success {
+		err = fmt.Errorf("fail to send signal %s to %s on node %s", signal, name, node.GetNodeName())
+	}
+	return err
+}
+
+// get the process information of the program in the child supervisord node
+func getNodeProcessInfo(node *config.Entry, name string) (types.ProcessInfo, error) {
+	procInfo, err := createNodeClient(node).GetProcessInfo(name)
+	if err != nil {
+		return procInfo, err
+	}
+	return toNodeProcessInfo(procInfo, node.GetNodeName()), nil
+}
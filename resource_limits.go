@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/ochinchina/supervisord/faults"
+	"github.com/ochinchina/supervisord/process"
+	"github.com/ochinchina/supervisord/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// get a string argument of a rpc call, the empty string is decoded as its
+// xml element by the xml codec
+func rpcString(value string) string {
+	if value == "<string></string>" {
+		return ""
+	}
+	return value
+}
+
+// SetProcessResourceLimits change the cgroup memory and CPU limits or the
+// nice value of a program without restarting it, for the mitigation of an
+// incident. The limits which aren't set are unchanged, the changed ones are
+// kept until the next reload and the effective limits are returned
+func (s *Supervisor) SetProcessResourceLimits(r *http.Request, args *types.ResourceLimitsArgs, reply *struct{ Limits types.ResourceLimits }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkNameAccess(r, args.Name); err != nil {
+		return err
+	}
+	proc := s.procMgr.Find(args.Name)
+	if proc == nil {
+		return badName(args.Name)
+	}
+	limits := types.ResourceLimits{Memory: rpcString(args.Memory), CPU: rpcString(args.CPU), Nice: rpcString(args.Nice)}
+	if limits == (types.ResourceLimits{}) {
+		return faults.NewFault(faults.BadArguments, "BAD_ARGUMENTS: no memory, CPU or nice limit to change")
+	}
+	if err := proc.SetResourceLimits(limits); err != nil {
+		return faults.NewFault(faults.Failed, "FAILED: "+err.Error())
+	}
+	reply.Limits = proc.GetResourceLimits()
+	s.recordAction(r, "set-resource-limits", []string{proc.GetName()}, rpcString(args.Reason))
+	return nil
+}
+
+// drop the resource limits changed at runtime, the configured limits of the
+// reloaded programs apply again
+func (s *Supervisor) resetResourceLimits() {
+	s.procMgr.ForEachProcess(func(proc *process.Process) {
+		proc.ResetResourceLimits()
+	})
+	log.Debug("the resource limits changed at runtime are reset")
+}
@@ -0,0 +1,59 @@
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"supervisord/internal/testutil"
+
+	"github.com/ochinchina/supervisord/types"
+)
+
+func TestSetProcessResourceLimits(t *testing.T) {
+	dir := testutil.TempDir(t)
+	cgroup := testutil.TempDir(t)
+	content := testSupervisordSection + "\n" +
+		"[program:web]\ncommand=%[2]s\nautostart=false\nstartsecs=0\ncgroup=%[3]s\ncpu_limit_percent=200\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n"
+	ioutil.WriteFile(filepath.Join(cgroup, "cpu.max"), []byte("max 100000"), 0644)
+	s := startConfSupervisor(t, dir, fmt.Sprintf(content, dir, testutil.FakeProgram(t, dir, testutil.Sleep), cgroup))
+	web := s.GetManager().Find("web")
+	web.Start(true)
+	ctlCommand.rpcc = s.xmlRPC.NewInMemoryClient(s)
+	defer func() { ctlCommand.rpcc = nil }()
+	rpcc := ctlCommand.createRPCClient()
+
+	if _, err := rpcc.SetProcessResourceLimits(types.ResourceLimitsArgs{Name: "db", CPU: "50"}); err == nil {
+		t.Error("fail to refuse the unknown program")
+	}
+	if _, err := rpcc.SetProcessResourceLimits(types.ResourceLimitsArgs{Name: "web"}); err == nil {
+		t.Error("fail to refuse the call without limit")
+	}
+	limits, err := rpcc.SetProcessResourceLimits(types.ResourceLimitsArgs{Name: "web", CPU: "50", Reason: "incident"})
+	if err != nil || limits != (types.ResourceLimits{Memory: "max", CPU: "50", Nice: "0"}) {
+		t.Fatalf("fail to change the CPU limit: %v %v", limits, err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(cgroup, "cpu.max")); string(b) != "50000 100000" {
+		t.Errorf("fail to change the CPU quota: %q", b)
+	}
+
+	limitCommand = LimitCommand{Memory: "256MB"}
+	defer func() { limitCommand = LimitCommand{} }()
+	output := captureOutput(t, func() { limitCommand.Execute([]string{"web"}) })
+	if output != "web: memory=256MB cpu=50 nice=0\n" {
+		t.Errorf("fail to change the limits with ctl: %q", output)
+	}
+
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to reload supervisord: %v", err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(cgroup, "cpu.max")); string(b) != "200000 100000" {
+		t.Errorf("fail to reset the CPU quota on reload: %q", b)
+	}
+	if limits := web.GetResourceLimits(); limits.CPU != "200" || limits.Memory != "max" {
+		t.Errorf("fail to drop the changed limits on reload: %v", limits)
+	}
+}
@@ -1,11 +1,29 @@
+// +build !nohttp
+
 package main
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/events"
+	"github.com/ochinchina/supervisord/logger"
+	"github.com/ochinchina/supervisord/process"
 	"github.com/ochinchina/supervisord/types"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"supervisord/internal/configio"
+	"time"
 )
 
 // SupervisorRestful the restful interface to control the programs defined in configuration file
@@ -22,11 +40,40 @@ func NewSupervisorRestful(supervisor *Supervisor) *SupervisorRestful {
 // CreateProgramHandler create http handler to process program related restful request
 func (sr *SupervisorRestful) CreateProgramHandler() http.Handler {
 	sr.router.HandleFunc("/program/list", sr.ListProgram).Methods("GET")
-	sr.router.HandleFunc("/program/start/{name}", sr.StartProgram).Methods("POST", "PUT")
-	sr.router.HandleFunc("/program/stop/{name}", sr.StopProgram).Methods("POST", "PUT")
+	idempotency := sr.supervisor.idempotency
+	sr.router.HandleFunc("/program/start/{name}", idempotency.Wrap(sr.StartProgram)).Methods("POST", "PUT")
+	sr.router.HandleFunc("/program/stop/{name}", idempotency.Wrap(sr.StopProgram)).Methods("POST", "PUT")
+	sr.router.HandleFunc("/program/restart/{name}", idempotency.Wrap(sr.RestartProgram)).Methods("POST", "PUT")
 	sr.router.HandleFunc("/program/log/{name}/stdout", sr.ReadStdoutLog).Methods("GET")
-	sr.router.HandleFunc("/program/startPrograms", sr.StartPrograms).Methods("POST", "PUT")
-	sr.router.HandleFunc("/program/stopPrograms", sr.StopPrograms).Methods("POST", "PUT")
+	sr.router.HandleFunc("/program/log/{name}/download", sr.DownloadLog).Methods("GET", "HEAD")
+	sr.router.HandleFunc("/program/log/{name}/search", sr.SearchLog).Methods("GET")
+	sr.router.HandleFunc("/program/lastOutput/{name}", sr.LastOutput).Methods("GET")
+	sr.router.HandleFunc("/program/logs/{name}", sr.ListLogFiles).Methods("GET")
+	sr.router.HandleFunc("/program/config/{name}", sr.ProgramConfig).Methods("GET")
+	sr.router.HandleFunc("/program/configInfo", sr.ListConfigInfo).Methods("GET")
+	sr.router.HandleFunc("/program/conf/{name}", sr.ReadProgramConf).Methods("GET")
+	sr.router.HandleFunc("/program/conf/{name}", sr.WriteProgramConf).Methods("PUT", "POST")
+	sr.router.HandleFunc("/program/conf/{name}/rollback", sr.RollbackProgramConf).Methods("PUT", "POST")
+	sr.router.HandleFunc("/program/throttle/{name}", sr.ThrottleProgram).Methods("PUT", "POST")
+	sr.router.HandleFunc("/program/throttle/{name}", sr.UnthrottleProgram).Methods("DELETE")
+	sr.router.HandleFunc("/program/reliability", sr.ListReliability).Methods("GET")
+	sr.router.HandleFunc("/program/crashReports", sr.ListCrashReports).Methods("GET")
+	sr.router.HandleFunc("/program/crashReports/{name}", sr.ReadCrashReport).Methods("GET")
+	sr.router.HandleFunc("/program/startPrograms", idempotency.Wrap(sr.StartPrograms)).Methods("POST", "PUT")
+	sr.router.HandleFunc("/program/run", idempotency.Wrap(sr.RunProgram)).Methods("POST")
+	sr.router.HandleFunc("/program/stopPrograms", idempotency.Wrap(sr.StopPrograms)).Methods("POST", "PUT")
+	return sr.router
+}
+
+// CreateAPIHandler create http rest interface to deploy the programs
+func (sr *SupervisorRestful) CreateAPIHandler() http.Handler {
+	sr.router.HandleFunc("/api/v1/programs", sr.AddPrograms).Methods("POST")
+	return sr.router
+}
+
+// CreateJobHandler create http rest interface to query the asynchronous jobs
+func (sr *SupervisorRestful) CreateJobHandler() http.Handler {
+	sr.router.HandleFunc("/jobs/{id}", sr.GetJob).Methods("GET")
 	return sr.router
 }
 
@@ -34,36 +81,109 @@ func (sr *SupervisorRestful) CreateProgramHandler() http.Handler {
 func (sr *SupervisorRestful) CreateSupervisorHandler() http.Handler {
 	sr.router.HandleFunc("/supervisor/shutdown", sr.Shutdown).Methods("PUT", "POST")
 	sr.router.HandleFunc("/supervisor/reload", sr.Reload).Methods("PUT", "POST")
+	sr.router.HandleFunc("/supervisor/events", sr.ListJournalEvents).Methods("GET")
+	sr.router.HandleFunc("/supervisor/maintenance", sr.ListMaintenance).Methods("GET")
+	sr.router.HandleFunc("/supervisor/maintenance/{name}", sr.EnterMaintenance).Methods("PUT", "POST")
+	sr.router.HandleFunc("/supervisor/maintenance/{name}", sr.ExitMaintenance).Methods("DELETE")
 	return sr.router
 }
 
-// ListProgram list the status of all the programs
+// ListProgram list the status of all the programs. With the query parameter
+// label=key=value (or label=key), only the programs with all the labels are listed
 //
 // json array to present the status of all programs
 func (sr *SupervisorRestful) ListProgram(w http.ResponseWriter, req *http.Request) {
 	result := struct{ AllProcessInfo []types.ProcessInfo }{make([]types.ProcessInfo, 0)}
-	if sr.supervisor.GetAllProcessInfo(nil, nil, &result) == nil {
-		json.NewEncoder(w).Encode(result.AllProcessInfo)
+	if sr.supervisor.GetAllProcessInfo(req, nil, &result) == nil {
+		selectors := make([]string, 0)
+		for _, label := range req.URL.Query()["label"] {
+			selectors = append(selectors, splitList(label)...)
+		}
+		infos := make([]types.ProcessInfo, 0)
+		for _, info := range result.AllProcessInfo {
+			if matchLabels(info.Labels, selectors) {
+				infos = append(infos, info)
+			}
+		}
+		json.NewEncoder(w).Encode(infos)
 	} else {
 		r := map[string]bool{"success": false}
 		json.NewEncoder(w).Encode(r)
 	}
 }
 
-// StartProgram start the given program through restful interface
+// ListReliability list the start, restart and failure statistics of the
+// programs, sorted by name. With the query parameter label=key=value (or
+// label=key), only the programs with all the labels are listed
+//
+// json array of the statistics of the programs
+func (sr *SupervisorRestful) ListReliability(w http.ResponseWriter, req *http.Request) {
+	selectors := make([]string, 0)
+	for _, label := range req.URL.Query()["label"] {
+		selectors = append(selectors, splitList(label)...)
+	}
+	result := make([]process.Reliability, 0)
+	sr.supervisor.GetManager().ForEachProcess(func(proc *process.Process) {
+		if sr.supervisor.canAccess(req, proc) && matchLabels(strings.Join(proc.GetLabels(), ","), selectors) {
+			result = append(result, proc.GetReliability())
+		}
+	})
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	json.NewEncoder(w).Encode(result)
+}
+
+// StartProgram start the given program through restful interface. With the query
+// parameter dryRun=true, the action plan is returned without starting the program.
+// With the query parameter async=true, a job is returned without waiting the program.
+// The query parameters env=KEY=VALUE override the environment of this start only
 func (sr *SupervisorRestful) StartProgram(w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 	params := mux.Vars(req)
-	success, err := sr._startProgram(params["name"])
+	if !sr.authorize(w, req, params["name"]) {
+		return
+	}
+	if isDryRun(req) {
+		startArgs := StartProcessArgs{Name: params["name"], DryRun: true}
+		result := struct{ Success interface{} }{}
+		sr.writePlan(w, sr.supervisor.StartProcess(req, &startArgs, &result), result.Success)
+		return
+	}
+	start := sr._startProgram
+	if env := req.URL.Query()["env"]; len(env) > 0 {
+		if err := checkEnvOverrides(req, env); err != nil {
+			if isNotAuthorized(err) {
+				w.WriteHeader(http.StatusForbidden)
+			} else {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			w.Write([]byte(err.Error()))
+			return
+		}
+		// only the user is kept to record the overrides, the start isn't
+		// cancelled with the request like the starts without overrides
+		user := withAuthUser(req.WithContext(context.Background()), getAuthUser(req))
+		start = func(program string) (bool, error) { return sr.startProgramEnv(user, program, env) }
+	}
+	if isAsync(req) {
+		sr.submitJob(w, "start", []string{params["name"]}, start)
+		return
+	}
+	success, err := start(params["name"])
 	r := map[string]bool{"success": err == nil && success}
 	json.NewEncoder(w).Encode(&r)
 }
 
 func (sr *SupervisorRestful) _startProgram(program string) (bool, error) {
-	startArgs := StartProcessArgs{Name: program, Wait: true}
-	result := struct{ Success bool }{false}
-	err := sr.supervisor.StartProcess(nil, &startArgs, &result)
-	return result.Success, err
+	return sr.startProgramEnv(nil, program, nil)
+}
+
+// start the program with the environment overrides, the request gives the
+// user recorded with the overrides
+func (sr *SupervisorRestful) startProgramEnv(req *http.Request, program string, env []string) (bool, error) {
+	startArgs := StartProcessArgs{Name: program, Wait: true, Env: env}
+	result := struct{ Success interface{} }{false}
+	err := sr.supervisor.StartProcess(req, &startArgs, &result)
+	return result.Success == true, err
 }
 
 // StartPrograms start one or more programs through restful interface
@@ -83,6 +203,13 @@ func (sr *SupervisorRestful) StartPrograms(w http.ResponseWriter, req *http.Requ
 		w.WriteHeader(400)
 		w.Write([]byte("not a valid request"))
 	} else {
+		if !sr.authorize(w, req, programs...) {
+			return
+		}
+		if isAsync(req) {
+			sr.submitJob(w, "start", programs, sr._startProgram)
+			return
+		}
 		for _, program := range programs {
 			sr._startProgram(program)
 		}
@@ -90,21 +217,67 @@ func (sr *SupervisorRestful) StartPrograms(w http.ResponseWriter, req *http.Requ
 	}
 }
 
-// StopProgram stop a program through the restful interface
+// StopProgram stop a program through the restful interface. With the query
+// parameter dryRun=true, the action plan is returned without stopping the program.
+// With the query parameter async=true, a job is returned without waiting the program
 func (sr *SupervisorRestful) StopProgram(w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 
 	params := mux.Vars(req)
+	if !sr.authorize(w, req, params["name"]) {
+		return
+	}
+	if isDryRun(req) {
+		stopArgs := StartProcessArgs{Name: params["name"], DryRun: true}
+		result := struct{ Success interface{} }{}
+		sr.writePlan(w, sr.supervisor.StopProcess(req, &stopArgs, &result), result.Success)
+		return
+	}
+	if !sr.checkLocked(w, req, params["name"]) {
+		return
+	}
+	if isAsync(req) {
+		sr.submitJob(w, "stop", []string{params["name"]}, sr._stopProgram)
+		return
+	}
 	success, err := sr._stopProgram(params["name"])
 	r := map[string]bool{"success": err == nil && success}
 	json.NewEncoder(w).Encode(&r)
 }
 
+// the locked programs are checked by the handlers with checkLocked
 func (sr *SupervisorRestful) _stopProgram(programName string) (bool, error) {
-	stopArgs := StartProcessArgs{Name: programName, Wait: true}
-	result := struct{ Success bool }{false}
+	stopArgs := StartProcessArgs{Name: programName, Wait: true, Force: true}
+	result := struct{ Success interface{} }{false}
 	err := sr.supervisor.StopProcess(nil, &stopArgs, &result)
-	return result.Success, err
+	return result.Success == true, err
+}
+
+// RestartProgram stop the program if it is running and start it again through the restful
+// interface. With the query parameter async=true, a job is returned without waiting the program
+func (sr *SupervisorRestful) RestartProgram(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	params := mux.Vars(req)
+	if !sr.authorize(w, req, params["name"]) {
+		return
+	}
+	if !sr.checkLocked(w, req, params["name"]) {
+		return
+	}
+	if isAsync(req) {
+		sr.submitJob(w, "restart", []string{params["name"]}, sr._restartProgram)
+		return
+	}
+	success, err := sr._restartProgram(params["name"])
+	r := map[string]bool{"success": err == nil && success}
+	json.NewEncoder(w).Encode(&r)
+}
+
+func (sr *SupervisorRestful) _restartProgram(programName string) (bool, error) {
+	// the program may be not running
+	sr._stopProgram(programName)
+	return sr._startProgram(programName)
 }
 
 // StopPrograms stop programs through the restful interface
@@ -124,6 +297,13 @@ func (sr *SupervisorRestful) StopPrograms(w http.ResponseWriter, req *http.Reque
 		w.WriteHeader(400)
 		w.Write([]byte("not a valid request"))
 	} else {
+		if !sr.authorize(w, req, programs...) || !sr.checkLocked(w, req, programs...) || !sr.recordReason(w, req, "stop", programs...) {
+			return
+		}
+		if isAsync(req) {
+			sr.submitJob(w, "stop", programs, sr._stopProgram)
+			return
+		}
 		for _, program := range programs {
 			sr._stopProgram(program)
 		}
@@ -132,16 +312,650 @@ func (sr *SupervisorRestful) StopPrograms(w http.ResponseWriter, req *http.Reque
 
 }
 
+func isDryRun(req *http.Request) bool {
+	return req.URL.Query().Get("dryRun") == "true"
+}
+
+func isAsync(req *http.Request) bool {
+	return req.URL.Query().Get("async") == "true"
+}
+
+// start a job in background and reply the job with its location
+func (sr *SupervisorRestful) submitJob(w http.ResponseWriter, action string, programs []string, execute func(program string) (bool, error)) {
+	job := sr.supervisor.jobs.Submit(action, programs, execute)
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(&job)
+}
+
+// GetJob get the state, progress and result of an asynchronous job. With the query
+// parameter wait=<seconds>, wait at most the seconds for the job to be finished
+func (sr *SupervisorRestful) GetJob(w http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	wait, _ := strconv.Atoi(req.URL.Query().Get("wait"))
+	if wait > maxJobWait {
+		wait = maxJobWait
+	}
+	job, ok := sr.supervisor.jobs.Get(params["id"], time.Duration(wait)*time.Second)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no such job"))
+		return
+	}
+	json.NewEncoder(w).Encode(&job)
+}
+
+// check if the user of request is allowed to control the programs, reply
+// 403 Forbidden if not. The unknown programs are forbidden to the users who
+// are not admin also, so that they can't find the programs of other owners
+func (sr *SupervisorRestful) authorize(w http.ResponseWriter, req *http.Request, programs ...string) bool {
+	for _, program := range programs {
+		err := sr.supervisor.checkNameAccess(req, program)
+		if err == nil && len(sr.supervisor.findMatch(program)) == 0 && !sr.supervisor.canAccessProgram(req, program) {
+			err = notAuthorized(getAuthUser(req), "control "+program)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(err.Error()))
+			return false
+		}
+	}
+	return true
+}
+
+// check if the programs can be stopped, the locked programs need the query
+// parameter force=true. Reply 423 Locked without force or 403 Forbidden if
+// the user is not allowed to force them
+func (sr *SupervisorRestful) checkLocked(w http.ResponseWriter, req *http.Request, programs ...string) bool {
+	force := req.URL.Query().Get("force") == "true"
+	for _, program := range programs {
+		if err := sr.supervisor.checkLocked(req, force, sr.supervisor.findMatch(program)...); err != nil {
+			if force {
+				w.WriteHeader(http.StatusForbidden)
+			} else {
+				w.WriteHeader(http.StatusLocked)
+			}
+			w.Write([]byte(err.Error()))
+			return false
+		}
+	}
+	return true
+}
+
+// record the action with the query parameter reason, reply 400 Bad Request
+// if the reason is missing but required by require_reason
+func (sr *SupervisorRestful) recordReason(w http.ResponseWriter, req *http.Request, action string, programs ...string) bool {
+	reason := strings.TrimSpace(req.URL.Query().Get("reason"))
+	if reason == "" && sr.supervisor.isReasonRequired() {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("a reason is required to " + action))
+		return false
+	}
+	sr.supervisor.recordAction(req, action, programs, reason)
+	return true
+}
+
+// write the action plan in json
+func (sr *SupervisorRestful) writePlan(w http.ResponseWriter, err error, plan interface{}) {
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	json.NewEncoder(w).Encode(plan)
+}
+
 // ReadStdoutLog read the stdout of given program
 func (sr *SupervisorRestful) ReadStdoutLog(w http.ResponseWriter, req *http.Request) {
 }
 
-// Shutdown shutdown the supervisor itself
+// DownloadLog download the log file of the program: the stdout by default,
+// the stderr with "stream=stderr" and the backup n with "backup=n". A range
+// of the file can be downloaded with the Range header, otherwise the file is
+// compressed with gzip if the client accepts it
+func (sr *SupervisorRestful) DownloadLog(w http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	if !sr.authorize(w, req, params["name"]) {
+		return
+	}
+	proc := sr.supervisor.GetManager().Find(params["name"])
+	if proc == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no such program"))
+		return
+	}
+	fileName, _ := proc.GetLogfilePaths()
+	if req.FormValue("stream") == "stderr" {
+		_, fileName = proc.GetLogfilePaths()
+	}
+	if backup := req.FormValue("backup"); backup != "" && fileName != "" {
+		if n, err := strconv.Atoi(backup); err != nil || n <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid backup"))
+			return
+		}
+		fileName = fmt.Sprintf("%s.%s", fileName, backup)
+	}
+	f, err := os.Open(fileName)
+	if fileName == "" || err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no log file"))
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no log file"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(fileName)))
+	w.Header().Set("Vary", "Accept-Encoding")
+	if req.Header.Get("Range") == "" && strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		if req.Method == http.MethodHead {
+			return
+		}
+		gz := gzip.NewWriter(w)
+		io.Copy(gz, f)
+		gz.Close()
+		return
+	}
+	http.ServeContent(w, req, fileName, info.ModTime(), f)
+}
+
+// the limits of the log search
+const (
+	defaultSearchLimit = 1000
+	maxSearchLimit     = 10000
+	searchTimeout      = 10 * time.Second
+)
+
+// SearchLog search the lines matching the regular expression "q" in the
+// current and rotated log files of the program, the stdout by default or the
+// stderr with "stream=stderr". The files modified before "since" or created
+// after "until" (RFC3339 times) are skipped. At most "limit" lines are
+// returned and the search is stopped after 10 seconds. With "severity", the
+// lines with a lower severity detected by the log_severity_* rules are skipped
+//
+// json object of the matched lines with their files and byte offsets
+func (sr *SupervisorRestful) SearchLog(w http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	if !sr.authorize(w, req, params["name"]) {
+		return
+	}
+	proc := sr.supervisor.GetManager().Find(params["name"])
+	if proc == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no such program"))
+		return
+	}
+	search, err := parseLogSearch(req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), searchTimeout)
+	defer cancel()
+	json.NewEncoder(w).Encode(proc.SearchLogs(ctx, search))
+}
+
+func parseLogSearch(req *http.Request) (process.LogSearch, error) {
+	search := process.LogSearch{Stream: "stdout", Limit: defaultSearchLimit}
+	if req.FormValue("q") == "" {
+		return search, fmt.Errorf("no regular expression q")
+	}
+	pattern, err := regexp.Compile(req.FormValue("q"))
+	if err != nil {
+		return search, fmt.Errorf("invalid regular expression: %v", err)
+	}
+	search.Pattern = pattern
+	if req.FormValue("stream") == "stderr" {
+		search.Stream = "stderr"
+	}
+	for param, t := range map[string]*time.Time{"since": &search.Since, "until": &search.Until} {
+		if value := req.FormValue(param); value != "" {
+			if *t, err = time.Parse(time.RFC3339, value); err != nil {
+				return search, fmt.Errorf("invalid %s: %v", param, err)
+			}
+		}
+	}
+	if limit := req.FormValue("limit"); limit != "" {
+		if search.Limit, err = strconv.Atoi(limit); err != nil || search.Limit <= 0 {
+			return search, fmt.Errorf("invalid limit %s", limit)
+		}
+		if search.Limit > maxSearchLimit {
+			search.Limit = maxSearchLimit
+		}
+	}
+	if severity := req.FormValue("severity"); severity != "" {
+		if search.MinSeverity, err = logger.ParseSeverity(severity); err != nil {
+			return search, err
+		}
+	}
+	return search, nil
+}
+
+// LastOutput get the last stdout/stderr output of the program kept in memory
+func (sr *SupervisorRestful) LastOutput(w http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	if !sr.authorize(w, req, params["name"]) {
+		return
+	}
+	proc := sr.supervisor.GetManager().Find(params["name"])
+	if proc == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no such program"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(proc.GetLastOutput()))
+}
+
+// ListLogFiles list the current and backup log files of the program with
+// their sizes, modification times and sha256 checksums. The checksums are
+// not computed with the "checksum=false" parameter
+//
+// json array of the log files
+func (sr *SupervisorRestful) ListLogFiles(w http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	if !sr.authorize(w, req, params["name"]) {
+		return
+	}
+	proc := sr.supervisor.GetManager().Find(params["name"])
+	if proc == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no such program"))
+		return
+	}
+	json.NewEncoder(w).Encode(proc.GetLogFiles(req.FormValue("checksum") != "false"))
+}
+
+// ProgramConfig get the resolved configuration used to spawn the program
+//
+// json object of the command, environment, user, directory and log files
+func (sr *SupervisorRestful) ProgramConfig(w http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	if !sr.authorize(w, req, params["name"]) {
+		return
+	}
+	proc := sr.supervisor.GetManager().Find(params["name"])
+	if proc == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no such program"))
+		return
+	}
+	config, err := getProcessConfig(proc)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	json.NewEncoder(w).Encode(config)
+}
+
+// ThrottleProgram freeze and thaw the running program in pulses instead of
+// killing it, for the query parameter duration (a Go duration) with the
+// program running the query parameter duty percent of the time, they default
+// to throttle_secs and throttle_duty_percent of the program
+//
+// json object of the program name and the end of the throttling
+func (sr *SupervisorRestful) ThrottleProgram(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	name := mux.Vars(req)["name"]
+	if !sr.authorize(w, req, name) {
+		return
+	}
+	proc := sr.supervisor.GetManager().Find(name)
+	if proc == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no such program"))
+		return
+	}
+	duration, duty := sr.supervisor.getThrottleSettings(name)
+	var err error
+	if value := req.URL.Query().Get("duration"); value != "" {
+		if duration, err = time.ParseDuration(value); err != nil || duration <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid duration " + value))
+			return
+		}
+	}
+	if value := req.URL.Query().Get("duty"); value != "" {
+		if duty, err = strconv.Atoi(value); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid duty " + value))
+			return
+		}
+	}
+	if err = proc.Throttle(duration, duty); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	sr.supervisor.recordAction(req, "throttle", []string{name}, req.URL.Query().Get("reason"))
+	json.NewEncoder(w).Encode(map[string]interface{}{"name": name, "throttledUntil": proc.ThrottledUntil()})
+}
+
+// RunProgram run the ad-hoc command of the json body {"command": "...",
+// "directory": "...", "env": ["KEY=VALUE"], "ttl": 600, "reason": "..."} once
+// under supervision and reply its name, the handle of its state and its log
+func (sr *SupervisorRestful) RunProgram(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	if err := sr.supervisor.checkAdmin(req, "run a program"); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	args := types.RunArgs{}
+	if err := json.NewDecoder(req.Body).Decode(&args); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("not a valid request"))
+		return
+	}
+	result := struct{ Name string }{}
+	if err := sr.supervisor.RunProgram(req, &args, &result); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"name": result.Name})
+}
+
+// UnthrottleProgram stop the throttling of the program and thaw it
+func (sr *SupervisorRestful) UnthrottleProgram(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	name := mux.Vars(req)["name"]
+	if !sr.authorize(w, req, name) {
+		return
+	}
+	proc := sr.supervisor.GetManager().Find(name)
+	if proc == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no such program"))
+		return
+	}
+	proc.Unthrottle()
+	sr.supervisor.recordAction(req, "unthrottle", []string{name}, req.URL.Query().Get("reason"))
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// ReadProgramConf read the configuration file with the [program:x] section
+// of the program, the configuration file or one of its include files. The
+// users who are not admin only get the section of the program with its
+// environment and secrets masked, the other sections may have the
+// credentials of supervisord and the settings of the other programs
+//
+// json object of the file name and its content
+func (sr *SupervisorRestful) ReadProgramConf(w http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	if !sr.authorize(w, req, params["name"]) {
+		return
+	}
+	fileName, err := sr.supervisor.config.FindProgramFile(params["name"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if user := getAuthUser(req); user != nil && !user.Admin {
+		content = config.RedactSection(config.GetSection(content, "program:"+params["name"]))
+	}
+	json.NewEncoder(w).Encode(map[string]string{"file": fileName, "content": string(content)})
+}
+
+// WriteProgramConf replace the configuration file with the [program:x]
+// section of the program by the request body. The new content is validated
+// with the other configuration files before it is written, the file is only
+// validated with the query parameter dryRun=true. The configuration must be
+// reloaded to apply it
+//
+// json object with the success flag and the validation error
+func (sr *SupervisorRestful) WriteProgramConf(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	params := mux.Vars(req)
+	if err := sr.supervisor.checkAdmin(req, "edit the configuration"); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	fileName, err := sr.supervisor.config.FindProgramFile(params["name"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	content, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err = sr.supervisor.config.ValidateFile(fileName, content); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	if !isDryRun(req) {
+		if err = configio.WriteFile(fileName, content, sr.supervisor.config.ValidateFile); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// RollbackProgramConf restore the previous content of the configuration file
+// with the [program:x] section of the program, kept when it was replaced by
+// WriteProgramConf. The configuration must be reloaded to apply it
+//
+// json object with the success flag and the validation error
+func (sr *SupervisorRestful) RollbackProgramConf(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	params := mux.Vars(req)
+	if err := sr.supervisor.checkAdmin(req, "edit the configuration"); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	fileName, err := sr.supervisor.config.FindProgramFile(params["name"])
+	if err == nil {
+		_, err = os.Stat(configio.BackupFile(fileName))
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err = configio.Rollback(fileName, sr.supervisor.config.ValidateFile); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// AddPrograms add the programs of the request body, an ini fragment with
+// [program:x] sections or a json definition of a program (with the
+// Content-Type application/json), to a new file of the [include] directory.
+// The programs are validated with the configuration before the file is
+// written, the file is only validated with the query parameter dryRun=true.
+// With the query parameter start=true, the configuration is reloaded and the
+// programs are started
+//
+// json object with the success flag, the file, the added programs and the error
+func (sr *SupervisorRestful) AddPrograms(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	result := map[string]interface{}{"success": false}
+	reply := func(status int, err error) {
+		if err != nil {
+			result["error"] = err.Error()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+	}
+	if err := sr.supervisor.checkAdmin(req, "add programs"); err != nil {
+		reply(http.StatusForbidden, err)
+		return
+	}
+	content, err := ioutil.ReadAll(req.Body)
+	if err == nil && strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		content, err = config.ProgramToIni(content)
+	}
+	if err != nil {
+		reply(http.StatusBadRequest, err)
+		return
+	}
+	names, err := config.ParseProgramFragment(content)
+	if err != nil {
+		reply(http.StatusBadRequest, err)
+		return
+	}
+	result["programs"] = names
+	for _, name := range names {
+		if _, err := sr.supervisor.config.FindProgramFile(name); err == nil {
+			reply(http.StatusConflict, fmt.Errorf("the program %s already exists", name))
+			return
+		}
+	}
+	fileName, err := sr.supervisor.config.NewProgramFile(names[0])
+	if err != nil {
+		reply(http.StatusInternalServerError, err)
+		return
+	}
+	result["file"] = fileName
+	if _, err := os.Stat(fileName); err == nil {
+		reply(http.StatusConflict, fmt.Errorf("the file %s already exists", fileName))
+		return
+	}
+	if err := sr.supervisor.config.ValidateFile(fileName, content); err != nil {
+		reply(http.StatusBadRequest, err)
+		return
+	}
+	if isDryRun(req) {
+		result["success"] = true
+		reply(http.StatusOK, nil)
+		return
+	}
+	if err := configio.WriteFile(fileName, content, sr.supervisor.config.ValidateFile); err != nil {
+		reply(http.StatusInternalServerError, err)
+		return
+	}
+	if req.URL.Query().Get("start") == "true" {
+		reload := types.ReloadConfigResult{}
+		if err := sr.supervisor.ReloadConfig(req, nil, &reload); err != nil {
+			reply(http.StatusInternalServerError, err)
+			return
+		}
+		for _, name := range names {
+			// the programs with autostart are already started by the reload
+			if proc := sr.supervisor.GetManager().Find(name); proc != nil && isRunningState(proc.GetState()) {
+				continue
+			}
+			if success, err := sr._startProgram(name); err != nil || !success {
+				reply(http.StatusInternalServerError, fmt.Errorf("fail to start %s: %v", name, err))
+				return
+			}
+		}
+	}
+	result["success"] = true
+	reply(http.StatusCreated, nil)
+}
+
+// ListConfigInfo list the configuration summary of all the programs like
+// supervisor.getAllConfigInfo
+//
+// json array of the autostart, command, directory, priorities and in use flag of the programs
+func (sr *SupervisorRestful) ListConfigInfo(w http.ResponseWriter, req *http.Request) {
+	result := struct{ AllConfigInfo []types.ConfigInfo }{}
+	if err := sr.supervisor.GetAllConfigInfo(req, nil, &result); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	json.NewEncoder(w).Encode(result.AllConfigInfo)
+}
+
+// ListCrashReports list the crash reports written when programs exit unexpectedly
+//
+// json array of the crash reports, the latest one first
+func (sr *SupervisorRestful) ListCrashReports(w http.ResponseWriter, req *http.Request) {
+	reports, err := process.ListCrashReports()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	result := make([]process.CrashReportInfo, 0)
+	for _, report := range reports {
+		if sr.supervisor.canAccessProgram(req, report.Program) {
+			result = append(result, report)
+		}
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// ReadCrashReport get the content of a crash report
+func (sr *SupervisorRestful) ReadCrashReport(w http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	b, err := process.ReadCrashReport(params["name"])
+	if err == nil && !sr.canReadCrashReport(req, params["name"]) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("NOT_AUTHORIZED"))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no such crash report"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// check if the user of request is allowed to read the crash report of the program
+func (sr *SupervisorRestful) canReadCrashReport(req *http.Request, name string) bool {
+	reports, _ := process.ListCrashReports()
+	for _, report := range reports {
+		if report.Name == name {
+			return sr.supervisor.canAccessProgram(req, report.Program)
+		}
+	}
+	return false
+}
+
+// Shutdown shutdown the supervisor itself. The reason is given by the query
+// parameter reason, required with require_reason=true
 func (sr *SupervisorRestful) Shutdown(w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 
 	reply := struct{ Ret bool }{false}
-	sr.supervisor.Shutdown(nil, nil, &reply)
+	if err := sr.supervisor.checkAdmin(req, "shutdown"); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if !sr.recordReason(w, req, "shutdown") {
+		return
+	}
+	if err := sr.supervisor.Shutdown(req, nil, &reply); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	}
 	w.Write([]byte("Shutdown..."))
 }
 
@@ -150,7 +964,115 @@ func (sr *SupervisorRestful) Reload(w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 
 	reply := struct{ Ret bool }{false}
+	if err := sr.supervisor.checkAdmin(req, "reload config"); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	}
 	sr.supervisor.Reload()
 	r := map[string]bool{"success": reply.Ret}
 	json.NewEncoder(w).Encode(&r)
 }
+
+// ListJournalEvents list the events of the journal after the sequence of the
+// query parameter after and since the RFC3339 time of the query parameter
+// since, at most limit events (defaults to 1000). Truncated is true if events
+// after the sequence were dropped from the journal
+func (sr *SupervisorRestful) ListJournalEvents(w http.ResponseWriter, req *http.Request) {
+	if err := sr.supervisor.checkAdmin(req, "read the event journal"); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	journal := sr.supervisor.getJournal()
+	if journal == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("the event journal is not enabled"))
+		return
+	}
+	query := req.URL.Query()
+	after, limit := uint64(0), 1000
+	var since time.Time
+	var err error
+	if value := query.Get("after"); value != "" {
+		after, err = strconv.ParseUint(value, 10, 64)
+	}
+	if value := query.Get("since"); value != "" && err == nil {
+		since, err = time.Parse(time.RFC3339, value)
+	}
+	if value := query.Get("limit"); value != "" && err == nil {
+		limit, err = strconv.Atoi(value)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	entries, err := journal.Since(after, since, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	json.NewEncoder(w).Encode(struct {
+		Events    []events.JournalEntry `json:"events"`
+		LastSeq   uint64                `json:"last_seq"`
+		Truncated bool                  `json:"truncated"`
+	}{entries, journal.LastSeq(), after > 0 && len(entries) > 0 && entries[0].Seq > after+1 && since.IsZero()})
+}
+
+// ListMaintenance list the maintenance windows configured and the ones in
+// progress
+func (sr *SupervisorRestful) ListMaintenance(w http.ResponseWriter, req *http.Request) {
+	json.NewEncoder(w).Encode(sr.supervisor.maintenance.list(sr.supervisor.config))
+}
+
+// EnterMaintenance enter the maintenance window now, for the duration of the
+// query parameter duration or of the window configuration
+func (sr *SupervisorRestful) EnterMaintenance(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	name := mux.Vars(req)["name"]
+	if err := sr.supervisor.checkAdmin(req, "enter maintenance "+name); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	var duration time.Duration
+	if value := req.URL.Query().Get("duration"); value != "" {
+		var err error
+		if duration, err = time.ParseDuration(value); err != nil || duration <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid duration " + value))
+			return
+		}
+	}
+	window, err := sr.supervisor.maintenance.enter(name, duration)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	sr.supervisor.recordAction(req, "enter maintenance "+name, window.Groups, req.URL.Query().Get("reason"))
+	json.NewEncoder(w).Encode(&window)
+}
+
+// ExitMaintenance exit the maintenance window, a scheduled window is entered
+// again at its next schedule
+func (sr *SupervisorRestful) ExitMaintenance(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	name := mux.Vars(req)["name"]
+	if err := sr.supervisor.checkAdmin(req, "exit maintenance "+name); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err := sr.supervisor.maintenance.exit(name); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	sr.supervisor.recordAction(req, "exit maintenance "+name, nil, req.URL.Query().Get("reason"))
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
@@ -0,0 +1,400 @@
+// +build !windows,!nohttp
+
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"supervisord/internal/testutil"
+
+	"github.com/gorilla/mux"
+	"github.com/ochinchina/supervisord/events"
+	"github.com/ochinchina/supervisord/process"
+	"github.com/ochinchina/supervisord/types"
+)
+
+func TestProgramOwnersREST(t *testing.T) {
+	s := startACLTestSupervisor(t)
+	router := mux.NewRouter()
+	router.HandleFunc("/program/config/{name}", NewSupervisorRestful(s).ProgramConfig)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, withAuthUser(httptest.NewRequest("GET", "/program/config/db", nil), &AuthUser{Name: "alice", Teams: []string{"web"}}))
+	if w.Code != http.StatusForbidden {
+		t.Error("fail to reject reading the config of other owner")
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, withAuthUser(httptest.NewRequest("GET", "/program/config/none", nil), &AuthUser{Name: "alice", Teams: []string{"web"}}))
+	if w.Code != http.StatusForbidden {
+		t.Error("fail to reject reading the config of an unknown program")
+	}
+	w = httptest.NewRecorder()
+	NewSupervisorRestful(s).ListProgram(w, withAuthUser(httptest.NewRequest("GET", "/program/list", nil), &AuthUser{Name: "bob"}))
+	programs := make([]types.ProcessInfo, 0)
+	json.Unmarshal(w.Body.Bytes(), &programs)
+	if len(programs) != 1 || programs[0].Name != "db" {
+		t.Error("fail to list only the owned programs in REST")
+	}
+	w = httptest.NewRecorder()
+	NewSupervisorRestful(s).ListConfigInfo(w, withAuthUser(httptest.NewRequest("GET", "/program/configInfo", nil), &AuthUser{Name: "bob"}))
+	configs := make([]types.ConfigInfo, 0)
+	json.Unmarshal(w.Body.Bytes(), &configs)
+	if len(configs) != 1 || configs[0].Name != "db" || !configs[0].Inuse {
+		t.Errorf("fail to list only the config info of the owned programs in REST: %v", configs)
+	}
+}
+
+func TestListProgramLabels(t *testing.T) {
+	s := startLabelTestSupervisor(t)
+	list := func(url string) []string {
+		w := httptest.NewRecorder()
+		NewSupervisorRestful(s).ListProgram(w, httptest.NewRequest("GET", url, nil))
+		programs := make([]types.ProcessInfo, 0)
+		json.Unmarshal(w.Body.Bytes(), &programs)
+		names := make([]string, 0)
+		for _, program := range programs {
+			names = append(names, program.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	if names := list("/program/list"); len(names) != 3 {
+		t.Errorf("fail to list all the programs: %v", names)
+	}
+	if names := list("/program/list?label=tier"); len(names) != 2 || names[0] != "db" || names[1] != "web" {
+		t.Errorf("fail to list the programs with the label: %v", names)
+	}
+	if names := list("/program/list?label=team=web&label=tier=frontend"); len(names) != 1 || names[0] != "web" {
+		t.Errorf("fail to list the programs with all the labels: %v", names)
+	}
+	if names := list("/program/list?label=team=data,tier=frontend"); len(names) != 0 {
+		t.Errorf("fail to filter out the programs without all the labels: %v", names)
+	}
+}
+
+func TestListReliabilityREST(t *testing.T) {
+	s := startLabelTestSupervisor(t)
+	s.GetManager().Find("web").Start(true)
+	router := NewSupervisorRestful(s).CreateProgramHandler()
+	list := func(url string) []process.Reliability {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		result := make([]process.Reliability, 0)
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return result
+	}
+	if result := list("/program/reliability"); len(result) != 3 || result[0].Name != "cron" || result[2].Name != "web" || result[2].Starts == 0 {
+		t.Errorf("fail to list the reliability of the programs: %v", result)
+	}
+	if result := list("/program/reliability?label=tier"); len(result) != 2 || result[0].Name != "db" {
+		t.Errorf("fail to list the reliability of the programs with the label: %v", result)
+	}
+}
+
+func TestListLogFilesREST(t *testing.T) {
+	s := startLabelTestSupervisor(t)
+	router := NewSupervisorRestful(s).CreateProgramHandler()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/program/logs/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Error("fail to report the unknown program")
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/program/logs/web?checksum=false", nil))
+	files := make([]process.LogFile, 0)
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &files) != nil || len(files) != 0 {
+		t.Errorf("fail to list the log files of the program without log file: %s", w.Body.String())
+	}
+}
+
+// start supervisord with the program web logging to web.log and its backup web.log.1
+func startLogTestSupervisor(t *testing.T) *Supervisor {
+	dir := testutil.TempDir(t)
+	logFile := testutil.WriteFile(t, dir, "web.log", "0123456789\n")
+	testutil.WriteFile(t, dir, "web.log.1", "backup\n")
+	content := fmt.Sprintf("[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\n\n[program:web]\ncommand=%[2]s\nautostart=false\nstdout_logfile=%[3]s\n",
+		dir, testutil.FakeProgram(t, dir, testutil.Sleep), logFile)
+	s := NewSupervisor(testutil.WriteFile(t, dir, "supervisord.conf", content))
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to start supervisord: %v", err)
+	}
+	return s
+}
+
+func TestDownloadLog(t *testing.T) {
+	router := NewSupervisorRestful(startLogTestSupervisor(t)).CreateProgramHandler()
+	download := func(url string, header string, value string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set(header, value)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := download("/program/log/web/download", "Range", "bytes=2-4")
+	if w.Code != http.StatusPartialContent || w.Body.String() != "234" {
+		t.Errorf("fail to download the range of the log: %d %q", w.Code, w.Body.String())
+	}
+	w = download("/program/log/web/download", "Accept-Encoding", "gzip, deflate")
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("fail to compress the log with gzip")
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal("fail to read the compressed log")
+	}
+	if b, _ := ioutil.ReadAll(gz); string(b) != "0123456789\n" {
+		t.Errorf("fail to download the compressed log: %q", string(b))
+	}
+	if w = download("/program/log/web/download?backup=1", "", ""); w.Body.String() != "backup\n" {
+		t.Errorf("fail to download the backup of the log: %q", w.Body.String())
+	}
+	if w = download("/program/log/web/download?stream=stderr", "", ""); w.Code != http.StatusNotFound {
+		t.Error("fail to report the missing log file")
+	}
+}
+
+func TestSearchLogREST(t *testing.T) {
+	router := NewSupervisorRestful(startLogTestSupervisor(t)).CreateProgramHandler()
+	for _, url := range []string{"/program/log/web/search", "/program/log/web/search?q=(", "/program/log/web/search?q=a&since=yesterday", "/program/log/web/search?q=a&limit=0"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("fail to refuse the invalid search %s", url)
+		}
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/program/log/web/search?q=^(back|012)", nil))
+	result := process.LogSearchResult{}
+	if json.Unmarshal(w.Body.Bytes(), &result) != nil || len(result.Matches) != 2 || result.Matches[0].Line != "backup" {
+		t.Errorf("fail to search the log files: %s", w.Body.String())
+	}
+}
+
+func TestProgramConfREST(t *testing.T) {
+	s := startACLTestSupervisor(t)
+	router := NewSupervisorRestful(s).CreateProgramHandler()
+	request := func(method string, url string, body string, user *AuthUser) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withAuthUser(httptest.NewRequest(method, url, strings.NewReader(body)), user))
+		return w
+	}
+	admin := &AuthUser{Name: "admin", Admin: true}
+	w := request("GET", "/program/conf/web", "", admin)
+	conf := make(map[string]string)
+	json.Unmarshal(w.Body.Bytes(), &conf)
+	if w.Code != http.StatusOK || conf["file"] != s.config.GetConfigFile() || !strings.Contains(conf["content"], "[program:web]") {
+		t.Fatalf("fail to read the configuration file of the program: %d %v", w.Code, conf)
+	}
+	owned := make(map[string]string)
+	w = request("GET", "/program/conf/web", "", &AuthUser{Name: "alice", Teams: []string{"web"}})
+	json.Unmarshal(w.Body.Bytes(), &owned)
+	if w.Code != http.StatusOK || !strings.HasPrefix(owned["content"], "[program:web]\n") || strings.Contains(owned["content"], "[program:db]") || strings.Contains(owned["content"], "password") {
+		t.Errorf("fail to read only the section of the owned program: %d %q", w.Code, owned["content"])
+	}
+	if w := request("GET", "/program/conf/db", "", &AuthUser{Name: "alice", Teams: []string{"web"}}); w.Code != http.StatusForbidden {
+		t.Error("fail to reject reading the configuration file of other owner")
+	}
+	if w := request("GET", "/program/conf/none", "", admin); w.Code != http.StatusNotFound {
+		t.Error("fail to reply 404 for the unknown program")
+	}
+	if w := request("GET", "/program/conf/none", "", &AuthUser{Name: "alice", Teams: []string{"web"}}); w.Code != http.StatusForbidden {
+		t.Error("fail to reject the unknown program before checking it exists")
+	}
+
+	content := strings.Replace(conf["content"], "autostart=false\nowners=web", "autostart=false\nowners=web\nstartsecs=0", 1)
+	if w := request("PUT", "/program/conf/web", content, &AuthUser{Name: "alice", Teams: []string{"web"}}); w.Code != http.StatusForbidden {
+		t.Error("fail to reject the configuration edited by a user who is not admin")
+	}
+	invalid := strings.Replace(conf["content"], "[program:web]\ncommand=", "[program:web]\nfoo=", 1)
+	if w := request("PUT", "/program/conf/web", invalid, admin); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "program:web") {
+		t.Errorf("fail to refuse the invalid configuration: %d %s", w.Code, w.Body.String())
+	}
+	if w := request("PUT", "/program/conf/web?dryRun=true", content, admin); w.Code != http.StatusOK {
+		t.Errorf("fail to validate the configuration: %s", w.Body.String())
+	}
+	if b, _ := ioutil.ReadFile(conf["file"]); string(b) != conf["content"] {
+		t.Error("fail to keep the file unchanged with dryRun")
+	}
+	if w := request("PUT", "/program/conf/web", content, admin); w.Code != http.StatusOK {
+		t.Errorf("fail to write the configuration: %s", w.Body.String())
+	}
+	if b, _ := ioutil.ReadFile(conf["file"]); string(b) != content {
+		t.Error("fail to write the configuration file")
+	}
+	if _, _, _, err := s.Reload(); err != nil || s.config.GetProgram("web").GetInt("startsecs", 1) != 0 {
+		t.Errorf("fail to apply the written configuration: %v", err)
+	}
+	if w := request("POST", "/program/conf/web/rollback", "", admin); w.Code != http.StatusOK {
+		t.Errorf("fail to rollback the configuration: %d %s", w.Code, w.Body.String())
+	}
+	if b, _ := ioutil.ReadFile(conf["file"]); string(b) != conf["content"] {
+		t.Error("fail to restore the previous configuration file")
+	}
+}
+
+func TestAddProgramsREST(t *testing.T) {
+	dir := testutil.TempDir(t)
+	command := testutil.FakeProgram(t, dir, testutil.Sleep)
+	os.Mkdir(filepath.Join(dir, "conf.d"), 0755)
+	content := fmt.Sprintf("[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\n\n"+
+		"[include]\nfiles=conf.d/*.conf\n\n[program:web]\ncommand=%[2]s\nautostart=false\n", dir, command)
+	s := NewSupervisor(testutil.WriteFile(t, dir, "supervisord.conf", content))
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to start supervisord: %v", err)
+	}
+	t.Cleanup(func() { s.GetManager().StopAllProcesses() })
+	router := NewSupervisorRestful(s).CreateAPIHandler()
+	add := func(url string, contentType string, body string, user *AuthUser) (*httptest.ResponseRecorder, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", url, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		router.ServeHTTP(w, withAuthUser(req, user))
+		result := make(map[string]interface{})
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return w, result
+	}
+	admin := &AuthUser{Name: "admin", Admin: true}
+	fragment := fmt.Sprintf("[program:api]\ncommand=%s\nautostart=false\nstartsecs=0\n", command)
+
+	if w, _ := add("/api/v1/programs", "text/plain", fragment, &AuthUser{Name: "alice"}); w.Code != http.StatusForbidden {
+		t.Error("fail to reject the programs added by a user who is not admin")
+	}
+	if w, _ := add("/api/v1/programs", "text/plain", "[program:web]\ncommand=/bin/ls\n", admin); w.Code != http.StatusConflict {
+		t.Error("fail to refuse adding an existing program")
+	}
+	if w, result := add("/api/v1/programs", "text/plain", "[program:worker]\nautostart=false\n", admin); w.Code != http.StatusBadRequest || result["success"] != false {
+		t.Errorf("fail to refuse the invalid program: %d %v", w.Code, result)
+	}
+	if w, _ := add("/api/v1/programs?dryRun=true", "text/plain", fragment, admin); w.Code != http.StatusOK {
+		t.Errorf("fail to validate the program: %s", w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "conf.d", "api.conf")); !os.IsNotExist(err) {
+		t.Error("fail to keep the include directory unchanged with dryRun")
+	}
+	w, result := add("/api/v1/programs?start=true", "text/plain", fragment, admin)
+	if w.Code != http.StatusCreated || result["file"] != filepath.Join(dir, "conf.d", "api.conf") {
+		t.Fatalf("fail to add the program: %d %s", w.Code, w.Body.String())
+	}
+	if proc := s.GetManager().Find("api"); proc == nil || proc.GetState() != process.Running {
+		t.Error("fail to start the added program")
+	}
+
+	definition := fmt.Sprintf(`{"name": "worker", "command": %q, "autostart": false}`, command)
+	if w, _ := add("/api/v1/programs", "application/json", definition, admin); w.Code != http.StatusCreated {
+		t.Errorf("fail to add the json program: %s", w.Body.String())
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "conf.d", "worker.conf")); err != nil || !strings.Contains(string(b), "[program:worker]\nautostart=false\n") {
+		t.Errorf("fail to write the json program: %s", b)
+	}
+	if s.GetManager().Find("worker") != nil {
+		t.Error("fail to add the program only at the next reload without start=true")
+	}
+}
+
+func TestRequireReasonREST(t *testing.T) {
+	dir := testutil.TempDir(t)
+	content := fmt.Sprintf("[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\nrequire_reason=true\n\n[program:web]\ncommand=%[2]s\nautostart=false\n",
+		dir, testutil.FakeProgram(t, dir, testutil.Sleep))
+	s := NewSupervisor(testutil.WriteFile(t, dir, "supervisord.conf", content))
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to start supervisord: %v", err)
+	}
+	received := make(chan string, 1)
+	events.Subscribe("test-operator-action", []string{"OPERATOR_ACTION"}, func(event events.Event) { received <- event.GetBody() })
+	defer events.Unsubscribe("test-operator-action")
+	router := NewSupervisorRestful(s).CreateProgramHandler()
+	stop := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withAuthUser(httptest.NewRequest("POST", url, strings.NewReader(`["web"]`)), &AuthUser{Name: "admin", Admin: true}))
+		return w
+	}
+	if w := stop("/program/stopPrograms"); w.Code != http.StatusBadRequest {
+		t.Errorf("fail to require the reason: %d", w.Code)
+	}
+	if w := stop("/program/stopPrograms?reason=" + url.QueryEscape("disk full")); w.Code != http.StatusOK {
+		t.Errorf("fail to stop the programs with a reason: %d %s", w.Code, w.Body.String())
+	}
+	select {
+	case body := <-received:
+		if body != "action:stop user:admin programs:web\ndisk full" {
+			t.Errorf("fail to emit the reason in the event: %q", body)
+		}
+	case <-time.After(time.Second):
+		t.Error("fail to emit the operator action event")
+	}
+
+	w := httptest.NewRecorder()
+	NewSupervisorRestful(s).Shutdown(w, withAuthUser(httptest.NewRequest("POST", "/supervisor/shutdown", nil), &AuthUser{Name: "admin", Admin: true}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("fail to require the reason of the shutdown: %d", w.Code)
+	}
+}
+
+func TestMaintenanceREST(t *testing.T) {
+	dir := testutil.TempDir(t)
+	content := fmt.Sprintf("[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\n\n[maintenance:deploy]\nduration=1h\ngroups=web\n", dir)
+	s := NewSupervisor(testutil.WriteFile(t, dir, "supervisord.conf", content))
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to start supervisord: %v", err)
+	}
+	defer process.SetMaintenanceWindows(nil)
+	router := NewSupervisorRestful(s).CreateSupervisorHandler()
+	send := func(method string, url string, user *AuthUser) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withAuthUser(httptest.NewRequest(method, url, nil), user))
+		return w
+	}
+	admin := &AuthUser{Name: "admin", Admin: true}
+
+	if w := send("POST", "/supervisor/maintenance/deploy", &AuthUser{Name: "alice"}); w.Code != http.StatusForbidden {
+		t.Errorf("fail to refuse the maintenance to the user not admin: %d", w.Code)
+	}
+	if w := send("POST", "/supervisor/maintenance/unknown", admin); w.Code != http.StatusNotFound {
+		t.Errorf("fail to refuse the unknown maintenance window: %d", w.Code)
+	}
+	if w := send("POST", "/supervisor/maintenance/deploy?duration=10m", admin); w.Code != http.StatusOK {
+		t.Fatalf("fail to enter the maintenance window: %d %s", w.Code, w.Body.String())
+	}
+	infos := make([]MaintenanceInfo, 0)
+	if err := json.NewDecoder(send("GET", "/supervisor/maintenance", admin).Body).Decode(&infos); err != nil || len(infos) != 1 || infos[0].Active == nil || !infos[0].Active.Manual {
+		t.Fatalf("fail to list the maintenance window in progress: %v %v", err, infos)
+	}
+	if infos[0].Active.End.Sub(infos[0].Active.Start) != 10*time.Minute {
+		t.Errorf("fail to enter the maintenance window for the duration: %v", infos[0].Active)
+	}
+	if w := send("DELETE", "/supervisor/maintenance/deploy", admin); w.Code != http.StatusOK || len(process.GetMaintenanceWindows()) != 0 {
+		t.Errorf("fail to exit the maintenance window: %d", w.Code)
+	}
+}
+
+func TestLockedProgramsREST(t *testing.T) {
+	s, alice, oncall := startLockedTestSupervisor(t)
+
+	router := NewSupervisorRestful(s).CreateProgramHandler()
+	stop := func(url string, user *AuthUser) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withAuthUser(httptest.NewRequest("POST", url, nil), user))
+		return w.Code
+	}
+	if code := stop("/program/stop/db", getAuthUser(oncall)); code != http.StatusLocked {
+		t.Errorf("fail to reply 423 for the locked program: %d", code)
+	}
+	if code := stop("/program/restart/db?force=true", getAuthUser(alice)); code != http.StatusForbidden {
+		t.Errorf("fail to reply 403 for forcing without permission: %d", code)
+	}
+	if code := stop("/program/stop/db?force=true", getAuthUser(oncall)); code != http.StatusOK || s.GetManager().Find("db").GetState() == process.Running {
+		t.Errorf("fail to force stopping the locked program: %d", code)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/events"
+	"supervisord/internal/configio"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the default seconds the programs changed by a reload are watched
+const defaultUpdateRollbackSecs = 60
+
+// UpdateRollback restore the sections of the programs changed by a reload
+// when they go FATAL within the grace period after the reload
+type UpdateRollback struct {
+	lock sync.Mutex
+	// the configuration files and the settings of the programs at the last load
+	files    map[string][]byte
+	settings map[string]string
+	// the programs changed by the last reload and not rolled back yet
+	watched map[string]bool
+	// the configuration files before the last reload
+	prevFiles map[string][]byte
+	deadline  time.Time
+	// the reload of a rollback isn't watched
+	restoring bool
+	// serialize the rollbacks
+	rollbackLock sync.Mutex
+}
+
+// NewUpdateRollback create an UpdateRollback without loaded configuration
+func NewUpdateRollback() *UpdateRollback {
+	return &UpdateRollback{watched: make(map[string]bool)}
+}
+
+// record the configuration files and the settings of the programs just
+// loaded, return the programs changed since the previous load and the
+// configuration files before this load
+func (u *UpdateRollback) loaded(files map[string][]byte, settings map[string]string) ([]string, map[string][]byte) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	prevFiles, prevSettings := u.files, u.settings
+	u.files, u.settings = files, settings
+	changed := make([]string, 0)
+	if u.restoring {
+		return changed, prevFiles
+	}
+	for name, setting := range settings {
+		if prevSetting, ok := prevSettings[name]; ok && prevSetting != setting {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed, prevFiles
+}
+
+// watch the programs until the end of the grace period, replacing the
+// programs of the previous reload
+func (u *UpdateRollback) watch(programs []string, prevFiles map[string][]byte, grace time.Duration) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.watched = make(map[string]bool)
+	for _, name := range programs {
+		u.watched[name] = true
+	}
+	u.prevFiles = prevFiles
+	u.deadline = time.Now().Add(grace)
+}
+
+// mark the reloads as caused by a rollback
+func (u *UpdateRollback) setRestoring(restoring bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.restoring = restoring
+}
+
+// stop watching the program, return the configuration files before the
+// reload if the program is watched and the grace period isn't elapsed
+func (u *UpdateRollback) take(program string) (map[string][]byte, bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if !u.watched[program] || time.Now().After(u.deadline) {
+		return nil, false
+	}
+	delete(u.watched, program)
+	return u.prevFiles, true
+}
+
+// find the text of the section in the configuration files before the reload
+func findPrevSection(files map[string][]byte, section string) []byte {
+	fileNames := make([]string, 0, len(files))
+	for fileName := range files {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	for _, fileName := range fileNames {
+		if text := config.GetSection(files[fileName], section); text != nil {
+			return text
+		}
+	}
+	return nil
+}
+
+// get the value of a field, like "processname:web", in the body of an event
+func eventBodyField(body string, field string) string {
+	for _, token := range strings.Fields(strings.SplitN(body, "\n", 2)[0]) {
+		if strings.HasPrefix(token, field+":") {
+			return token[len(field)+1:]
+		}
+	}
+	return ""
+}
+
+// watch the programs changed by the reload if update_rollback is set, they
+// are rolled back if they go FATAL within update_rollback_secs
+func (s *Supervisor) watchUpdate() {
+	files, err := s.config.ReadFiles()
+	if err != nil {
+		log.WithFields(log.Fields{log.ErrorKey: err}).Error("fail to read the configuration files for the rollback")
+		return
+	}
+	changed, prevFiles := s.rollback.loaded(files, s.config.ProgramSettings())
+	supervisordConf, ok := s.config.GetSupervisord()
+	if !ok || !supervisordConf.GetBool("update_rollback", false) || len(changed) == 0 || prevFiles == nil {
+		return
+	}
+	grace := supervisordConf.GetInt("update_rollback_secs", defaultUpdateRollbackSecs)
+	if grace <= 0 {
+		grace = defaultUpdateRollbackSecs
+	}
+	log.WithFields(log.Fields{"programs": strings.Join(changed, ","), "seconds": grace}).Info("watch the programs changed by the reload")
+	s.rollback.watch(changed, prevFiles, time.Duration(grace)*time.Second)
+	events.Subscribe("update-rollback", []string{"PROCESS_STATE_FATAL"}, func(event events.Event) {
+		program := eventBodyField(event.GetBody(), "processname")
+		if prevFiles, ok := s.rollback.take(program); ok {
+			// the event is emitted with the lock of the process held
+			go s.rollbackProgram(program, prevFiles)
+		}
+	})
+}
+
+// restore the section of the program in the configuration files before the
+// reload, reload the configuration and start the program again
+func (s *Supervisor) rollbackProgram(program string, prevFiles map[string][]byte) {
+	s.rollback.rollbackLock.Lock()
+	defer s.rollback.rollbackLock.Unlock()
+
+	entry := s.config.GetProgram(program)
+	if entry == nil {
+		return
+	}
+	fileName, err := s.restoreSection(entry.Section, prevFiles)
+	if err != nil {
+		log.WithFields(log.Fields{"program": program, log.ErrorKey: err}).Error("fail to roll back the program")
+		return
+	}
+	log.WithFields(log.Fields{"program": program, "file": fileName}).Warn("the program went FATAL after the reload, its previous configuration is restored")
+	events.EmitEvent(events.CreateRollbackEvent(program, entry.Group, fileName))
+
+	s.rollback.setRestoring(true)
+	_, _, _, err = s.Reload()
+	s.rollback.setRestoring(false)
+	if err != nil {
+		log.WithFields(log.Fields{"program": program, log.ErrorKey: err}).Error("fail to reload the restored configuration")
+		return
+	}
+	if proc := s.procMgr.Find(program); proc != nil {
+		// the FATAL program may still be supervised, waiting to give up
+		proc.Stop(true)
+		proc.Start(false)
+	}
+}
+
+// replace the section in its configuration file with its text before the
+// reload, the file is unchanged if the section is already restored (by the
+// rollback of another process of the program)
+func (s *Supervisor) restoreSection(section string, prevFiles map[string][]byte) (string, error) {
+	prevSection := findPrevSection(prevFiles, section)
+	if prevSection == nil {
+		return "", fmt.Errorf("no section %s before the reload", section)
+	}
+	fileName, err := s.config.FindProgramFile(strings.TrimPrefix(section, "program:"))
+	if err != nil {
+		return "", err
+	}
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return "", err
+	}
+	restored, err := config.ReplaceSection(content, section, prevSection)
+	if err != nil || string(restored) == string(content) {
+		return fileName, err
+	}
+	return fileName, configio.WriteFile(fileName, restored, s.config.ValidateFile)
+}
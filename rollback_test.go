@@ -0,0 +1,62 @@
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"supervisord/internal/testutil"
+
+	"github.com/ochinchina/supervisord/events"
+	"github.com/ochinchina/supervisord/process"
+)
+
+func TestUpdateRollback(t *testing.T) {
+	dir := testutil.TempDir(t)
+	command := testutil.FakeProgram(t, dir, testutil.Sleep)
+	os.Mkdir(filepath.Join(dir, "conf.d"), 0755)
+	content := fmt.Sprintf("[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\nupdate_rollback=true\n\n"+
+		"[include]\nfiles=conf.d/*.conf\n", dir)
+	webSection := fmt.Sprintf("[program:web]\ncommand=%s\nautostart=false\nstartsecs=0\nstartretries=0\n", command)
+	webFile := testutil.WriteFile(t, filepath.Join(dir, "conf.d"), "web.conf", "; web server\n"+webSection+"\n[program:api]\ncommand=/bin/ls\nautostart=false\n")
+	s := NewSupervisor(testutil.WriteFile(t, dir, "supervisord.conf", content))
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to start supervisord: %v", err)
+	}
+	t.Cleanup(func() { s.GetManager().StopAllProcesses() })
+
+	rollbacks := make(chan string, 10)
+	events.Subscribe("test-rollback", []string{"ROLLBACK"}, func(event events.Event) { rollbacks <- event.GetBody() })
+	defer events.Unsubscribe("test-rollback")
+
+	ioutil.WriteFile(webFile, []byte("; web server\n[program:web]\ncommand=/nonexistent/web\nautostart=false\nstartsecs=0\nstartretries=0\n\n[program:api]\ncommand=/bin/ls\nautostart=false\n"), 0644)
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to reload supervisord: %v", err)
+	}
+	web := s.GetManager().Find("web")
+	web.Start(false)
+	select {
+	case body := <-rollbacks:
+		if body != "processname:web groupname:web file:"+webFile {
+			t.Errorf("fail to emit the rollback event: %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fail to roll back the program going FATAL after the reload")
+	}
+	if !testutil.WaitFor(5*time.Second, func() bool { return web.GetState() == process.Running }) {
+		t.Errorf("fail to start the rolled back program: %v", web.GetState())
+	}
+	restored, _ := ioutil.ReadFile(webFile)
+	if !strings.HasPrefix(string(restored), "; web server\n"+webSection+"\n[program:api]\n") {
+		t.Errorf("fail to restore the previous section of the program: %q", restored)
+	}
+	if s.GetConfig().GetProgram("web").GetString("command", "") != command {
+		t.Error("fail to reload the restored configuration")
+	}
+}
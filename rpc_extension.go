@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/rpcinterface"
+	log "github.com/sirupsen/logrus"
+)
+
+// rpcExtension the instance of a registered rpcinterface.Extension
+type rpcExtension struct {
+	namespace string
+	service   interface{}
+	handler   http.Handler
+}
+
+// get the settings of the extension in the [rpcinterface:<namespace>] section
+func (s *Supervisor) getRPCExtensionSettings(namespace string) *config.Entry {
+	entries := s.config.GetEntries(func(entry *config.Entry) bool {
+		return entry.Name == "rpcinterface:"+namespace
+	})
+	if len(entries) > 0 {
+		return entries[0]
+	}
+	return config.NewEntry(s.config.GetConfigFileDir())
+}
+
+// create the instances of all the registered extensions only once
+func (s *Supervisor) getRPCExtensions() []*rpcExtension {
+	s.rpcExtensionsOnce.Do(func() {
+		for _, ext := range rpcinterface.Extensions() {
+			settings := s.getRPCExtensionSettings(ext.Namespace)
+			instance := &rpcExtension{namespace: ext.Namespace}
+			var err error
+			if ext.NewService != nil {
+				instance.service, err = ext.NewService(settings, s.procMgr)
+			}
+			if err == nil && ext.NewHandler != nil {
+				instance.handler, err = ext.NewHandler(settings, s.procMgr)
+			}
+			if err != nil {
+				log.WithFields(log.Fields{"namespace": ext.Namespace, log.ErrorKey: err}).Error("fail to create rpc extension")
+				continue
+			}
+			log.WithFields(log.Fields{"namespace": ext.Namespace}).Info("load rpc extension")
+			s.rpcExtensions = append(s.rpcExtensions, instance)
+		}
+	})
+	return s.rpcExtensions
+}
+
+// register the rpc services of the extensions. Every method can be called with
+// "<namespace>.<Method>" or "<namespace>.<method>" (first letter in lower case)
+func (s *Supervisor) registerRPCExtensions(system *rpcSystem, codec rpcCodec) {
+	for _, ext := range s.getRPCExtensions() {
+		if ext.service == nil {
+			continue
+		}
+		if err := system.registerService(ext.service, ext.namespace); err != nil {
+			log.WithFields(log.Fields{"namespace": ext.namespace, log.ErrorKey: err}).Error("fail to register rpc extension")
+			continue
+		}
+		serviceType := reflect.TypeOf(ext.service)
+		for i := 0; i < serviceType.NumMethod(); i++ {
+			name := serviceType.Method(i).Name
+			codec.RegisterAlias(ext.namespace+"."+strings.ToLower(name[0:1])+name[1:], ext.namespace+"."+name)
+		}
+	}
+}
+
+// add the REST handlers of the extensions to the path "/<namespace>/", the
+// handlers are protected by the auth and only the admin is allowed. The path
+// already served by another handler is skipped instead of panicking
+func (s *Supervisor) registerRESTExtensions(mux *http.ServeMux, protect func(http.Handler) http.Handler) {
+	for _, ext := range s.getRPCExtensions() {
+		if ext.handler == nil {
+			continue
+		}
+		pattern := "/" + ext.namespace + "/"
+		if _, served := mux.Handler(&http.Request{Method: "GET", URL: &url.URL{Path: pattern}}); served == pattern {
+			log.WithFields(log.Fields{"namespace": ext.namespace}).Error("fail to register rest extension, the path is already served")
+			continue
+		}
+		mux.Handle(pattern, protect(adminOnly(ext.handler)))
+	}
+}
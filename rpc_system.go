@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/rpc"
+	"github.com/ochinchina/supervisord/faults"
+)
+
+// rpcSystem the introspection methods in the "system" namespace like the
+// system.listMethods, system.methodHelp and system.methodSignature of python supervisor
+type rpcSystem struct {
+	server *rpc.Server
+	// the service receivers by the service name like "Supervisor"
+	services map[string]interface{}
+	// the methods like "Supervisor.GetState" by the method name like "supervisor.getState"
+	methods map[string]string
+	// true if system.multicall is served in front of the rpc server
+	multicall bool
+}
+
+// systemCodec record the method aliases registered to the codec for introspection
+type systemCodec struct {
+	rpcCodec
+	system *rpcSystem
+}
+
+func newRPCSystem(server *rpc.Server) *rpcSystem {
+	return &rpcSystem{server: server, services: make(map[string]interface{}), methods: make(map[string]string)}
+}
+
+// RegisterAlias implements rpcCodec interface
+func (c *systemCodec) RegisterAlias(alias, method string) {
+	c.system.methods[alias] = method
+	c.rpcCodec.RegisterAlias(alias, method)
+}
+
+// register the service to the rpc server and keep it for introspection
+func (sys *rpcSystem) registerService(receiver interface{}, name string) error {
+	if err := sys.server.RegisterService(receiver, name); err != nil {
+		return err
+	}
+	if name == "" {
+		name = reflect.Indirect(reflect.ValueOf(receiver)).Type().Name()
+	}
+	sys.services[name] = receiver
+	return nil
+}
+
+// find the method of the service receiver by the method name like "supervisor.getState"
+func (sys *rpcSystem) findMethod(name string) (reflect.Method, bool) {
+	method, ok := sys.methods[name]
+	if !ok {
+		return reflect.Method{}, false
+	}
+	pos := strings.LastIndex(method, ".")
+	receiver, ok := sys.services[method[:pos]]
+	if !ok {
+		return reflect.Method{}, false
+	}
+	return reflect.TypeOf(receiver).MethodByName(method[pos+1:])
+}
+
+// ListMethods list the names of all the methods
+func (sys *rpcSystem) ListMethods(r *http.Request, args *struct{}, reply *struct{ Methods []string }) error {
+	reply.Methods = make([]string, 0)
+	for name := range sys.methods {
+		reply.Methods = append(reply.Methods, name)
+	}
+	if sys.multicall {
+		reply.Methods = append(reply.Methods, "system.multicall")
+	}
+	sort.Strings(reply.Methods)
+	return nil
+}
+
+// MethodHelp get the usage of the method like "supervisor.startProcess(string name, boolean wait, ...) => boolean"
+func (sys *rpcSystem) MethodHelp(r *http.Request, args *struct{ Name string }, reply *struct{ Help string }) error {
+	if args.Name == "system.multicall" && sys.multicall {
+		reply.Help = "system.multicall(array calls) => array\nProcess an array of calls like {\"methodName\": string, \"params\": array}, the result of every call is an array with one value or a fault struct"
+		return nil
+	}
+	method, ok := sys.findMethod(args.Name)
+	if !ok {
+		return faults.NewFault(faults.SignatureUnsupported, "SIGNATURE_UNSUPPORTED: "+args.Name)
+	}
+	params := make([]string, 0)
+	argsType := method.Type.In(2).Elem()
+	if argsType.Kind() == reflect.Struct {
+		for i := 0; i < argsType.NumField(); i++ {
+			field := argsType.Field(i)
+			params = append(params, xmlrpcTypeName(field.Type)+" "+strings.ToLower(field.Name[0:1])+field.Name[1:])
+		}
+	}
+	reply.Help = fmt.Sprintf("%s(%s) => %s", args.Name, strings.Join(params, ", "), xmlrpcReplyTypeName(method.Type.In(3).Elem()))
+	return nil
+}
+
+// MethodSignature get the signature of the method, an array of the return type and the param types
+func (sys *rpcSystem) MethodSignature(r *http.Request, args *struct{ Name string }, reply *struct{ Signatures [][]string }) error {
+	if args.Name == "system.multicall" && sys.multicall {
+		reply.Signatures = [][]string{{"array", "array"}}
+		return nil
+	}
+	method, ok := sys.findMethod(args.Name)
+	if !ok {
+		return faults.NewFault(faults.SignatureUnsupported, "SIGNATURE_UNSUPPORTED: "+args.Name)
+	}
+	signature := []string{xmlrpcReplyTypeName(method.Type.In(3).Elem())}
+	argsType := method.Type.In(2).Elem()
+	if argsType.Kind() == reflect.Struct {
+		for i := 0; i < argsType.NumField(); i++ {
+			signature = append(signature, xmlrpcTypeName(argsType.Field(i).Type))
+		}
+	}
+	reply.Signatures = [][]string{signature}
+	return nil
+}
+
+// the XML-RPC type of the reply, the reply with several fields is an array of the field values
+func xmlrpcReplyTypeName(t reflect.Type) string {
+	if t.Kind() == reflect.Struct && t.NumField() == 1 {
+		return xmlrpcTypeName(t.Field(0).Type)
+	}
+	if t.Kind() == reflect.Struct && t.NumField() > 1 {
+		return "array"
+	}
+	return xmlrpcTypeName(t)
+}
+
+// the XML-RPC type name of the go type
+func xmlrpcTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return xmlrpcTypeName(t.Elem())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Float32, reflect.Float64:
+		return "double"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "base64"
+		}
+		return "array"
+	case reflect.Struct, reflect.Map:
+		if t.String() == "time.Time" {
+			return "dateTime.iso8601"
+		}
+		return "struct"
+	}
+	return "undef"
+}
+
+// xmlrpcMulticallHandler serve system.multicall by calling every method in the
+// array with the rpc server, the other requests are passed to the rpc server
+type xmlrpcMulticallHandler struct {
+	server *rpc.Server
+	system *rpcSystem
+}
+
+// the XML of a value without the <value> element
+type xmlrpcRawValue struct {
+	XML string `xml:",innerxml"`
+}
+
+type xmlrpcMulticallRequest struct {
+	Method string `xml:"methodName"`
+	Calls  []struct {
+		Members []struct {
+			Name  string         `xml:"name"`
+			Value xmlrpcRawValue `xml:"value"`
+		} `xml:"struct>member"`
+	} `xml:"params>param>value>array>data>value"`
+}
+
+type xmlrpcRawResponse struct {
+	Params []xmlrpcRawValue `xml:"params>param>value"`
+	Fault  *xmlrpcRawValue  `xml:"fault>value"`
+}
+
+// ServeHTTP serve the system.multicall and pass the other requests to the rpc server
+func (h *xmlrpcMulticallHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.server.ServeHTTP(w, r)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "not a valid request", http.StatusBadRequest)
+		return
+	}
+	request := xmlrpcMulticallRequest{}
+	if xml.Unmarshal(body, &request) != nil || request.Method != "system.multicall" {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		h.server.ServeHTTP(w, r)
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0"?><methodResponse><params><param><value><array><data>`)
+	for _, call := range request.Calls {
+		var method string
+		params := make([]xmlrpcRawValue, 0)
+		for _, member := range call.Members {
+			if member.Name == "methodName" {
+				method = decodeXMLRPCString(member.Value)
+			} else if member.Name == "params" {
+				values := struct {
+					Values []xmlrpcRawValue `xml:"array>data>value"`
+				}{}
+				xml.Unmarshal([]byte("<value>"+member.Value.XML+"</value>"), &values)
+				params = values.Values
+			}
+		}
+		buf.WriteString(h.call(r, method, params))
+	}
+	buf.WriteString(`</data></array></value></param></params></methodResponse>`)
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// call one method of the multicall, the result is an array with the returned
+// values or the fault struct
+func (h *xmlrpcMulticallHandler) call(r *http.Request, method string, params []xmlrpcRawValue) string {
+	if method == "system.multicall" {
+		return xmlrpcFaultValue(faults.IncorrectParameters, "INCORRECT_PARAMETERS: recursive system.multicall forbidden")
+	}
+	if _, ok := h.system.methods[method]; !ok && !h.server.HasMethod(method) {
+		return xmlrpcFaultValue(faults.UnknownMethod, "UNKNOWN_METHOD: "+method)
+	}
+	if user := getAuthUser(r); !isRPCMethodAllowed(user, method) {
+		return xmlrpcFaultValue(faults.NotAuthorized, fmt.Sprintf("NOT_AUTHORIZED: user %s is not allowed to call %s", user.Name, method))
+	}
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?><methodCall><methodName>`)
+	xml.EscapeText(&body, []byte(method))
+	body.WriteString("</methodName><params>")
+	for _, param := range params {
+		body.WriteString("<param><value>" + param.XML + "</value></param>")
+	}
+	body.WriteString("</params></methodCall>")
+
+	req := r.Clone(r.Context())
+	req.Body = ioutil.NopCloser(&body)
+	req.ContentLength = int64(body.Len())
+	req.Header.Set("Content-Type", "text/xml")
+	recorder := &rpcResponseRecorder{header: make(http.Header)}
+	h.server.ServeHTTP(recorder, req)
+	response := xmlrpcRawResponse{}
+	if recorder.status != http.StatusOK || xml.Unmarshal(recorder.body.Bytes(), &response) != nil {
+		return xmlrpcFaultValue(faults.IncorrectParameters, "INCORRECT_PARAMETERS: "+strings.TrimSpace(recorder.body.String()))
+	}
+	if response.Fault != nil {
+		return "<value>" + response.Fault.XML + "</value>"
+	}
+	var result strings.Builder
+	result.WriteString("<value><array><data>")
+	for _, param := range response.Params {
+		result.WriteString("<value>" + param.XML + "</value>")
+	}
+	result.WriteString("</data></array></value>")
+	return result.String()
+}
+
+// decode the string value with or without the <string> element
+func decodeXMLRPCString(value xmlrpcRawValue) string {
+	s := struct {
+		String *string `xml:"string"`
+		Raw    string  `xml:",chardata"`
+	}{}
+	xml.Unmarshal([]byte("<value>"+value.XML+"</value>"), &s)
+	if s.String != nil {
+		return *s.String
+	}
+	return strings.TrimSpace(s.Raw)
+}
+
+func xmlrpcFaultValue(code int, desc string) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<value><struct><member><name>faultCode</name><value><int>%d</int></value></member>"+
+		"<member><name>faultString</name><value><string>", code)
+	xml.EscapeText(&buf, []byte(desc))
+	buf.WriteString("</string></value></member></struct></value>")
+	return buf.String()
+}
+
+// keep the response of rpc server in memory
+type rpcResponseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *rpcResponseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *rpcResponseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+func (r *rpcResponseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
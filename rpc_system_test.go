@@ -0,0 +1,116 @@
+// +build !windows
+
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ochinchina/gorilla-xmlrpc/xml"
+	"github.com/ochinchina/supervisord/conformance"
+	"github.com/ochinchina/supervisord/types"
+	"github.com/ochinchina/supervisord/xmlrpcclient"
+)
+
+func TestRPCIntrospection(t *testing.T) {
+	s := startACLTestSupervisor(t)
+	server := httptest.NewServer(NewXMLRPC().createRPCServer(s))
+	defer server.Close()
+	client := conformance.NewClient(server.URL, "", "")
+
+	result, err := client.Call("system.listMethods")
+	methods, _ := result.([]interface{})
+	if err != nil || len(methods) == 0 || methods[len(methods)-1] != "system.multicall" {
+		t.Errorf("fail to list the methods: %v %v", result, err)
+	}
+	result, err = client.Call("system.methodSignature", "supervisor.readProcessStdoutLog")
+	if !reflect.DeepEqual(result, []interface{}{[]interface{}{"string", "string", "int", "int"}}) {
+		t.Errorf("fail to get the method signature: %v %v", result, err)
+	}
+	result, err = client.Call("system.methodHelp", "supervisor.getProcessInfo")
+	if result != "supervisor.getProcessInfo(string name) => struct" {
+		t.Errorf("fail to get the method help: %v %v", result, err)
+	}
+	if _, err = client.Call("system.methodHelp", "supervisor.nothing"); err == nil || err.(*conformance.Fault).Code != 4 {
+		t.Errorf("fail to report the unknown method: %v", err)
+	}
+}
+
+func TestRPCMulticall(t *testing.T) {
+	s := startACLTestSupervisor(t)
+	server := httptest.NewServer(NewXMLRPC().createRPCServer(s))
+	defer server.Close()
+	client := conformance.NewClient(server.URL, "", "")
+
+	calls := []interface{}{
+		"supervisor.getAPIVersion", []interface{}{},
+		"supervisor.getProcessInfo", []interface{}{"nothing"},
+		"supervisor.noSuchMethod", []interface{}{},
+		"system.multicall", []interface{}{[]interface{}{}},
+	}
+	result, err := client.Call("system.multicall", multicallParams(calls...))
+	results, _ := result.([]interface{})
+	if err != nil || len(results) != 4 {
+		t.Fatalf("fail to call the methods in multicall: %v %v", result, err)
+	}
+	if !reflect.DeepEqual(results[0], []interface{}{"3.0"}) {
+		t.Errorf("fail to get the result of the call: %v", results[0])
+	}
+	for i, code := range []int{10, 1, 2} {
+		fault, _ := results[i+1].(map[string]interface{})
+		if fault["faultCode"] != code {
+			t.Errorf("fail to get the fault %d of the call: %v", code, results[i+1])
+		}
+	}
+
+	// the owners are checked for every call
+	alice := &AuthUser{Name: "alice", Teams: []string{"web"}}
+	body := `<?xml version="1.0"?><methodCall><methodName>system.multicall</methodName><params><param><value><array><data>` +
+		`<value><struct><member><name>methodName</name><value>supervisor.stopProcess</value></member><member><name>params</name><value><array><data><value><string>db</string></value></data></array></value></member></struct></value>` +
+		`</data></array></value></param></params></methodCall>`
+	req := withAuthUser(httptest.NewRequest("POST", "/RPC2", strings.NewReader(body)), alice)
+	w := httptest.NewRecorder()
+	NewXMLRPC().createRPCServer(s).ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "<int>94</int>") {
+		t.Errorf("fail to reject the call of other owner in multicall: %s", w.Body.String())
+	}
+}
+
+func multicallParams(calls ...interface{}) []interface{} {
+	params := make([]interface{}, 0)
+	for i := 0; i < len(calls); i += 2 {
+		params = append(params, map[string]interface{}{"methodName": calls[i], "params": calls[i+1]})
+	}
+	return params
+}
+
+func TestXMLRPCClientMulticall(t *testing.T) {
+	s := startACLTestSupervisor(t)
+	rpcc := NewXMLRPC().NewInMemoryClient(s)
+
+	calls := make([]xmlrpcclient.MulticallRequest, 0)
+	for i := 0; i < 20; i++ {
+		calls = append(calls, xmlrpcclient.MulticallRequest{Method: "supervisor.getProcessInfo", Args: &struct{ Name string }{"web"}})
+	}
+	calls = append(calls, xmlrpcclient.MulticallRequest{Method: "supervisor.getProcessInfo", Args: &struct{ Name string }{"nothing"}})
+	calls = append(calls, xmlrpcclient.MulticallRequest{Method: "supervisor.getState", Args: &struct{}{}})
+	results, err := rpcc.Multicall(calls)
+	if err != nil || len(results) != len(calls) {
+		t.Fatalf("fail to call the methods in one request: %v", err)
+	}
+	for _, result := range results[:20] {
+		reply := struct{ Reply types.ProcessInfo }{}
+		if err = result.Decode(&reply); err != nil || reply.Reply.Name != "web" {
+			t.Errorf("fail to decode the process info: %v", err)
+		}
+	}
+	if fault, ok := results[20].Err.(xml.Fault); !ok || fault.Code != 10 {
+		t.Errorf("fail to get the fault of the call: %v", results[20].Err)
+	}
+	state := xmlrpcclient.StateReply{}
+	if err = results[21].Decode(&state); err != nil || state.Value.Statename != "RUNNING" {
+		t.Errorf("fail to decode the state: %v", err)
+	}
+}
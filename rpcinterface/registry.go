@@ -0,0 +1,107 @@
+package rpcinterface
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/process"
+)
+
+// Extension an extension of the supervisord XML-RPC and REST interface, like
+// the [rpcinterface:x] of python supervisor. The extension is registered at
+// compile time, usually in the init() of the package implementing it
+type Extension struct {
+	// Namespace the namespace of the XML-RPC methods and the REST routes, for
+	// example the method "GetAPIVersion" of the service is called with
+	// "twiddler.getAPIVersion" or "twiddler.GetAPIVersion" if the Namespace is "twiddler"
+	Namespace string
+
+	// NewService create the XML-RPC service. All the exported methods with
+	// signature func(r *http.Request, args *Args, reply *Reply) error of the service
+	// are registered. The settings are the items in the [rpcinterface:<Namespace>]
+	// section, they are empty if the section does not exist. Optional
+	NewService func(settings *config.Entry, procMgr *process.Manager) (interface{}, error)
+
+	// NewHandler create the REST handler which serves the requests with path
+	// "/<Namespace>/". Optional
+	NewHandler func(settings *config.Entry, procMgr *process.Manager) (http.Handler, error)
+}
+
+// the namespaces used by supervisord itself
+var reservedNamespaces = map[string]bool{"supervisor": true,
+	"system":     true,
+	"program":    true,
+	"logtail":    true,
+	"RPC2":       true,
+	"Supervisor": true}
+
+// the patterns of the http handlers of supervisord, the REST handler of an
+// extension is served at "/<Namespace>/" on the same mux
+var servedPatterns = map[string]bool{"/": true,
+	"/RPC2":        true,
+	"/RPC2-json":   true,
+	"/program/":    true,
+	"/supervisor/": true,
+	"/api/":        true,
+	"/jobs/":       true,
+	"/logtail/":    true,
+	"/mainlogtail": true,
+	"/graphql":     true,
+	"/metrics":     true,
+	"/login":       true,
+	"/logout":      true}
+
+// check if the path "/<namespace>" or "/<namespace>/" is served by
+// supervisord itself
+func isServed(namespace string) bool {
+	return servedPatterns["/"+namespace] || servedPatterns["/"+namespace+"/"]
+}
+
+var extensions = make(map[string]Extension)
+var lock sync.Mutex
+
+// Register register an extension, the namespace must be unique
+func Register(ext Extension) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if ext.Namespace == "" {
+		return fmt.Errorf("the namespace of extension is empty")
+	}
+	if _, ok := reservedNamespaces[ext.Namespace]; ok || isServed(ext.Namespace) {
+		return fmt.Errorf("the namespace %s is reserved by supervisord", ext.Namespace)
+	}
+	if _, ok := extensions[ext.Namespace]; ok {
+		return fmt.Errorf("the extension with namespace %s is already registered", ext.Namespace)
+	}
+	if ext.NewService == nil && ext.NewHandler == nil {
+		return fmt.Errorf("the extension %s provides neither XML-RPC service nor REST handler", ext.Namespace)
+	}
+	extensions[ext.Namespace] = ext
+	return nil
+}
+
+// MustRegister register an extension and panic if fail to register it
+func MustRegister(ext Extension) {
+	if err := Register(ext); err != nil {
+		panic(err)
+	}
+}
+
+// Extensions get all the registered extensions sorted by namespace
+func Extensions() []Extension {
+	lock.Lock()
+	defer lock.Unlock()
+
+	result := make([]Extension, 0, len(extensions))
+	for _, ext := range extensions {
+		result = append(result, ext)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Namespace < result[j].Namespace
+	})
+	return result
+}
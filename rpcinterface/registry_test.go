@@ -0,0 +1,44 @@
+package rpcinterface
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/process"
+)
+
+type testService struct {
+}
+
+func newTestService(settings *config.Entry, procMgr *process.Manager) (interface{}, error) {
+	return &testService{}, nil
+}
+
+func TestRegister(t *testing.T) {
+	if Register(Extension{Namespace: "test", NewService: newTestService}) != nil {
+		t.Error("fail to register extension")
+	}
+	if Register(Extension{Namespace: "test", NewService: newTestService}) == nil {
+		t.Error("fail to reject the extension with same namespace")
+	}
+	if Register(Extension{Namespace: "supervisor", NewService: newTestService}) == nil {
+		t.Error("fail to reject the extension with reserved namespace")
+	}
+	if Register(Extension{Namespace: "api", NewService: newTestService}) == nil {
+		t.Error("fail to reject the extension with a path served by supervisord")
+	}
+	if Register(Extension{Namespace: "empty"}) == nil {
+		t.Error("fail to reject the extension without service and handler")
+	}
+	handler := func(settings *config.Entry, procMgr *process.Manager) (http.Handler, error) {
+		return http.NotFoundHandler(), nil
+	}
+	if Register(Extension{Namespace: "a-test", NewHandler: handler}) != nil {
+		t.Error("fail to register extension")
+	}
+	exts := Extensions()
+	if len(exts) != 2 || exts[0].Namespace != "a-test" || exts[1].Namespace != "test" {
+		t.Error("fail to get the registered extensions")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/faults"
+	"github.com/ochinchina/supervisord/process"
+	"github.com/ochinchina/supervisord/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// the default seconds a finished ad-hoc program is kept
+const defaultRunTTLSecs = 3600
+
+// the bytes of the last output kept in memory for an ad-hoc program
+const runLastOutputBytes = 64 * 1024
+
+// get the directory of the logs of the ad-hoc programs and the seconds they
+// are kept by default, from run_logdir and run_ttl_secs
+func (s *Supervisor) getRunSettings() (string, int) {
+	logDir, ttl := filepath.Join(os.TempDir(), "supervisord-runs"), defaultRunTTLSecs
+	if supervisordConf, ok := s.config.GetSupervisord(); ok {
+		logDir = supervisordConf.GetStringExpression("run_logdir", logDir)
+		ttl = supervisordConf.GetInt("run_ttl_secs", ttl)
+	}
+	return logDir, ttl
+}
+
+// RunProgram run an ad-hoc command once under supervision, like a program
+// without autorestart which isn't in the configuration files. Its name is
+// returned as the handle to query its state and its log with the methods of
+// the programs, it is removed with its log TTL seconds after it finishes
+func (s *Supervisor) RunProgram(r *http.Request, args *types.RunArgs, reply *struct{ Name string }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "run a program"); err != nil {
+		return err
+	}
+	command, directory, reason := rpcString(args.Command), rpcString(args.Directory), rpcString(args.Reason)
+	if command == "" {
+		return faults.NewFault(faults.BadArguments, "BAD_ARGUMENTS: no command to run")
+	}
+	if err := checkEnvOverrides(r, args.Env); err != nil {
+		return err
+	}
+	if s.isStandby() {
+		return errStandby
+	}
+	logDir, ttl := s.getRunSettings()
+	if args.TTL > 0 {
+		ttl = args.TTL
+	}
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return faults.NewFault(faults.Failed, "FAILED: "+err.Error())
+	}
+	name := fmt.Sprintf("run-%s-%d", time.Now().Format("20060102150405"), atomic.AddUint32(&s.runSeq, 1))
+	if s.config.GetProgram(name) != nil || s.procMgr.Find(name) != nil {
+		return faults.NewFault(faults.Failed, "FAILED: the program "+name+" already exists")
+	}
+	entry := config.NewProgramEntry(name, s.config.GetConfigFileDir(), map[string]string{"command": command,
+		"directory":              directory,
+		"autostart":              "false",
+		"autorestart":            "false",
+		"startsecs":              "0",
+		"startretries":           "0",
+		"redirect_stderr":        "true",
+		"stdout_logfile":         filepath.Join(logDir, name+".log"),
+		"stdout_logfile_backups": "0",
+		"last_output_maxbytes":   strconv.Itoa(runLastOutputBytes)})
+	proc := s.procMgr.CreateProcess(s.GetSupervisorID(), entry)
+	if err := proc.StartContextEnv(context.Background(), false, args.Env); err != nil {
+		s.procMgr.Remove(name)
+		return faults.NewFault(faults.SpawnError, "SPAWN_ERROR: "+err.Error())
+	}
+	log.WithFields(log.Fields{"program": name, "command": command, "ttl": ttl}).Info("run the ad-hoc program")
+	s.recordAction(r, "run", []string{name}, reason)
+	s.scheduleRunCleanup(name, time.Duration(ttl)*time.Second)
+	reply.Name = name
+	return nil
+}
+
+// remove the ad-hoc program and its log TTL after it is finished, the check
+// is scheduled again while it runs
+func (s *Supervisor) scheduleRunCleanup(name string, ttl time.Duration) {
+	s.scheduleRunCheck(name, ttl, ttl)
+}
+
+func (s *Supervisor) scheduleRunCheck(name string, delay time.Duration, ttl time.Duration) {
+	time.AfterFunc(delay, func() {
+		proc := s.procMgr.Find(name)
+		if proc == nil || s.config.GetProgram(name) != nil {
+			return
+		}
+		if state := proc.GetState(); isRunningState(state) || state == process.Stopping {
+			s.scheduleRunCheck(name, ttl, ttl)
+			return
+		}
+		if stopTime := proc.GetStopTime(); !stopTime.IsZero() && time.Since(stopTime) < ttl {
+			s.scheduleRunCheck(name, ttl-time.Since(stopTime), ttl)
+			return
+		}
+		s.procMgr.Remove(name)
+		os.Remove(proc.GetStdoutLogfile())
+		log.WithFields(log.Fields{"program": name}).Info("the finished ad-hoc program is removed")
+	})
+}
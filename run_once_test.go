@@ -0,0 +1,57 @@
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"supervisord/internal/testutil"
+
+	"github.com/ochinchina/supervisord/types"
+)
+
+func TestRunProgram(t *testing.T) {
+	dir := testutil.TempDir(t)
+	content := fmt.Sprintf(testSupervisordSection+"run_logdir=%[1]s/runs\n", dir)
+	s := startConfSupervisor(t, dir, content)
+	rpcc := s.xmlRPC.NewInMemoryClient(s)
+
+	if _, err := rpcc.RunProgram(types.RunArgs{}); err == nil || !strings.Contains(err.Error(), "BAD_ARGUMENTS") {
+		t.Errorf("fail to refuse to run without command: %v", err)
+	}
+	name, err := rpcc.RunProgram(types.RunArgs{Command: `/bin/sh -c 'echo "hello $WHO"; exit 3'`, Env: []string{"WHO=world"}, TTL: 2})
+	if err != nil || !strings.HasPrefix(name, "run-") {
+		t.Fatalf("fail to run the command: %q %v", name, err)
+	}
+	var info types.ProcessInfo
+	if !testutil.WaitFor(5*time.Second, func() bool {
+		info, err = rpcc.GetProcessInfo(name)
+		return err == nil && info.Statename == "Exited"
+	}) || info.Exitstatus != 3 {
+		t.Fatalf("fail to get the exit status of the command: %v %v", info, err)
+	}
+	logFile := filepath.Join(dir, "runs", name+".log")
+	if b, _ := ioutil.ReadFile(logFile); string(b) != "hello world\n" {
+		t.Errorf("fail to capture the output of the command: %q", b)
+	}
+	if !testutil.WaitFor(5*time.Second, func() bool { return s.GetManager().Find(name) == nil }) {
+		t.Errorf("fail to remove the finished program after its TTL")
+	}
+	if _, err := os.Stat(logFile); !os.IsNotExist(err) {
+		t.Errorf("fail to remove the log of the removed program: %v", err)
+	}
+}
+
+func TestQuoteRunArgument(t *testing.T) {
+	for arg, quoted := range map[string]string{"echo": "echo", "a b": "'a b'", "it's": `"it's"`, "": "''"} {
+		if q := quoteRunArgument(arg); q != quoted {
+			t.Errorf("the argument %q is quoted as %s", arg, q)
+		}
+	}
+}
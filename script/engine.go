@@ -0,0 +1,247 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ochinchina/supervisord/events"
+	"github.com/ochinchina/supervisord/process"
+	"github.com/ochinchina/supervisord/signals"
+	log "github.com/sirupsen/logrus"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// the max number of events waiting to be handled by the script
+const eventQueueSize = 1024
+
+// the max time to load the script or to handle an event, the script is
+// interrupted after it
+const callTimeout = 30 * time.Second
+
+// the functions of the base library reading the files or the modules
+var unsafeBaseFunctions = []string{"dofile", "loadfile", "require", "module"}
+
+// the programs are only started by the leader in active/standby mode
+var errStandby = fmt.Errorf("supervisord is in standby mode, the programs can only be started by the leader")
+
+// Engine run a lua script which reacts to the events. The script defines
+// the function on_event(event) and optionally the global table "events"
+// with the event types it is interested in, for example:
+//
+//	events = {"PROCESS_STATE_EXITED", "PROCESS_LOG_STDOUT"}
+//
+//	function on_event(event)
+//	    if event.type == "PROCESS_LOG_STDOUT" and string.find(event.data, "out of memory") then
+//	        supervisor.restart("worker")
+//	    end
+//	end
+//
+// The event is a table with the fields "type", "serial", "body", "data" (the
+// body after the header line) and "headers" (the key:value pairs of the header line)
+type Engine struct {
+	file    string
+	procMgr *process.Manager
+	state   *lua.LState
+	eventCh chan events.Event
+	stopCh  chan struct{}
+	// the max time of a call of the script
+	timeout time.Duration
+}
+
+// NewEngine load the lua script file
+func NewEngine(file string, procMgr *process.Manager) (*Engine, error) {
+	e := &Engine{file: file,
+		procMgr: procMgr,
+		state:   newSandboxState(),
+		eventCh: make(chan events.Event, eventQueueSize),
+		stopCh:  make(chan struct{}),
+		timeout: callTimeout}
+	e.state.SetGlobal("supervisor", e.createSupervisorModule())
+	fn, err := e.state.LoadFile(file)
+	if err == nil {
+		err = e.call(fn)
+	}
+	if err != nil {
+		e.state.Close()
+		return nil, err
+	}
+	if _, ok := e.state.GetGlobal("on_event").(*lua.LFunction); !ok {
+		e.state.Close()
+		return nil, fmt.Errorf("function on_event is not defined in script %s", file)
+	}
+	return e, nil
+}
+
+// create the lua state with only the base (without the file and module
+// loading), string, table and math libraries, the scripts can't access the
+// files or run commands
+func newSandboxState() *lua.LState {
+	state := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{{lua.BaseLibName, lua.OpenBase},
+		{lua.StringLibName, lua.OpenString},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.MathLibName, lua.OpenMath}} {
+		state.Push(state.NewFunction(lib.open))
+		state.Push(lua.LString(lib.name))
+		state.Call(1, 0)
+	}
+	for _, name := range unsafeBaseFunctions {
+		state.SetGlobal(name, lua.LNil)
+	}
+	return state
+}
+
+// call the lua function, it is interrupted after the timeout
+func (e *Engine) call(fn lua.LValue, args ...lua.LValue) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	e.state.SetContext(ctx)
+	defer e.state.RemoveContext()
+	return e.state.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, args...)
+}
+
+// get the event types in the global "events" table of the script, "EVENT" if not defined
+func (e *Engine) getEventTypes() []string {
+	result := make([]string, 0)
+	if table, ok := e.state.GetGlobal("events").(*lua.LTable); ok {
+		table.ForEach(func(key lua.LValue, value lua.LValue) {
+			result = append(result, value.String())
+		})
+	}
+	if len(result) == 0 {
+		result = append(result, "EVENT")
+	}
+	return result
+}
+
+// Start subscribe the events and handle them in the background
+func (e *Engine) Start() {
+	events.Subscribe("script:"+e.file, e.getEventTypes(), func(event events.Event) {
+		select {
+		case e.eventCh <- event:
+		default:
+			log.WithFields(log.Fields{"script": e.file, "event": event.GetType()}).Warn("too many events are waiting for the script, drop the event")
+		}
+	})
+	go func() {
+		for {
+			select {
+			case event := <-e.eventCh:
+				e.handleEvent(event)
+			case <-e.stopCh:
+				e.state.Close()
+				return
+			}
+		}
+	}()
+}
+
+// Stop stop handling the events
+func (e *Engine) Stop() {
+	events.Unsubscribe("script:" + e.file)
+	close(e.stopCh)
+}
+
+func (e *Engine) handleEvent(event events.Event) {
+	err := e.call(e.state.GetGlobal("on_event"), e.toLuaEvent(event))
+	if err != nil {
+		log.WithFields(log.Fields{"script": e.file, "event": event.GetType(), log.ErrorKey: err}).Error("fail to handle event in script")
+	}
+}
+
+// convert the event to lua table
+func (e *Engine) toLuaEvent(event events.Event) *lua.LTable {
+	body := event.GetBody()
+	header, data := body, ""
+	if pos := strings.Index(body, "\n"); pos != -1 {
+		header, data = body[0:pos], body[pos+1:]
+	}
+	headers := e.state.NewTable()
+	for _, field := range strings.Fields(header) {
+		if pos := strings.Index(field, ":"); pos != -1 {
+			headers.RawSetString(field[0:pos], lua.LString(field[pos+1:]))
+		}
+	}
+	result := e.state.NewTable()
+	result.RawSetString("type", lua.LString(event.GetType()))
+	result.RawSetString("serial", lua.LNumber(event.GetSerial()))
+	result.RawSetString("body", lua.LString(body))
+	result.RawSetString("data", lua.LString(data))
+	result.RawSetString("headers", headers)
+	return result
+}
+
+// create the "supervisor" table with the functions to control the programs
+func (e *Engine) createSupervisorModule() *lua.LTable {
+	return e.state.SetFuncs(e.state.NewTable(), map[string]lua.LGFunction{
+		"start": func(L *lua.LState) int {
+			return e.withProcess(L, func(proc *process.Process) error {
+				if process.IsStandby() {
+					return errStandby
+				}
+				proc.Start(false)
+				return nil
+			})
+		},
+		"stop": func(L *lua.LState) int {
+			return e.withProcess(L, func(proc *process.Process) error {
+				proc.Stop(true)
+				return nil
+			})
+		},
+		"restart": func(L *lua.LState) int {
+			return e.withProcess(L, func(proc *process.Process) error {
+				if process.IsStandby() {
+					return errStandby
+				}
+				proc.Stop(true)
+				proc.Start(false)
+				return nil
+			})
+		},
+		"signal": func(L *lua.LState) int {
+			sig, err := signals.ToSignal(L.CheckString(2))
+			return e.withProcess(L, func(proc *process.Process) error {
+				if err != nil {
+					return err
+				}
+				return proc.Signal(sig, false)
+			})
+		},
+		"state": func(L *lua.LState) int {
+			proc := e.procMgr.Find(L.CheckString(1))
+			if proc == nil {
+				L.Push(lua.LNil)
+			} else {
+				L.Push(lua.LString(proc.GetState().String()))
+			}
+			return 1
+		},
+		"log": func(L *lua.LState) int {
+			log.WithFields(log.Fields{"script": e.file}).Info(L.CheckString(1))
+			return 0
+		},
+	})
+}
+
+// call the action on the process named by the first argument, return true or false and error message to lua
+func (e *Engine) withProcess(L *lua.LState, action func(proc *process.Process) error) int {
+	name := L.CheckString(1)
+	proc := e.procMgr.Find(name)
+	err := fmt.Errorf("no process named %s", name)
+	if proc != nil {
+		err = action(proc)
+	}
+	if err != nil {
+		L.Push(lua.LFalse)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LTrue)
+	return 1
+}
@@ -0,0 +1,108 @@
+package script
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/events"
+	"github.com/ochinchina/supervisord/process"
+)
+
+func createEngine(t *testing.T, content string) (*Engine, error) {
+	f, err := ioutil.TempFile("", "script*.lua")
+	if err != nil {
+		t.Fatal("fail to create script file")
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(content)
+	f.Close()
+	return NewEngine(f.Name(), process.NewManager())
+}
+
+func TestHandleEvent(t *testing.T) {
+	engine, err := createEngine(t, `
+events = {"PROCESS_STATE_FATAL"}
+function on_event(event)
+    name = event.headers.processname
+    ok, message = supervisor.start(name)
+end`)
+	if err != nil {
+		t.Error("fail to load the script")
+		return
+	}
+	eventTypes := engine.getEventTypes()
+	if len(eventTypes) != 1 || eventTypes[0] != "PROCESS_STATE_FATAL" {
+		t.Error("fail to get the event types of the script")
+	}
+	engine.handleEvent(events.CreateProcessFatalEvent("test", "test", "BACKOFF"))
+	if engine.state.GetGlobal("name").String() != "test" {
+		t.Error("fail to pass the event to the script")
+	}
+	if engine.state.GetGlobal("ok").String() != "false" || engine.state.GetGlobal("message").String() != "no process named test" {
+		t.Error("fail to get the result of supervisor.start")
+	}
+}
+
+func TestScriptWithoutOnEvent(t *testing.T) {
+	if _, err := createEngine(t, `x = 1`); err == nil {
+		t.Error("fail to reject the script without on_event function")
+	}
+}
+
+func TestStandbyDoesNotStart(t *testing.T) {
+	f, err := ioutil.TempFile("", "supervisord*.conf")
+	if err != nil {
+		t.Fatal("fail to create config file")
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("[program:worker]\ncommand=sleep 10\nautostart=false\n")
+	f.Close()
+	cfg := config.NewConfig(f.Name())
+	if _, err := cfg.Load(); err != nil {
+		t.Fatal("fail to load the config file")
+	}
+	procMgr := process.NewManager()
+	procMgr.CreateProcess("supervisord", cfg.GetProgram("worker"))
+	engine, err := createEngine(t, `
+function on_event(event)
+    ok, message = supervisor.restart("worker")
+end`)
+	if err != nil {
+		t.Fatal("fail to load the script")
+	}
+	engine.procMgr = procMgr
+	process.SetStandbyCheck(func() bool { return true })
+	defer process.SetStandbyCheck(nil)
+	engine.handleEvent(events.CreateProcessFatalEvent("worker", "worker", "BACKOFF"))
+	if engine.state.GetGlobal("ok").String() != "false" || procMgr.Find("worker").GetState() != process.Stopped {
+		t.Errorf("fail to refuse restarting the program in standby mode: %s", engine.state.GetGlobal("message"))
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	engine, err := createEngine(t, `
+function on_event(event)
+    libs = tostring(os) .. tostring(io) .. tostring(dofile) .. tostring(require) .. tostring(load ~= nil)
+    upper = string.upper(event.headers.processname) .. math.max(1, 2) .. table.concat({"a", "b"})
+    while event.headers.processname == "loop" do end
+end`)
+	if err != nil {
+		t.Fatalf("fail to load the script: %v", err)
+	}
+	engine.timeout = 100 * time.Millisecond
+	start := time.Now()
+	engine.handleEvent(events.CreateProcessFatalEvent("loop", "loop", "BACKOFF"))
+	if time.Since(start) > 5*time.Second {
+		t.Error("fail to interrupt the script after the timeout")
+	}
+	engine.handleEvent(events.CreateProcessFatalEvent("test", "test", "BACKOFF"))
+	if libs := engine.state.GetGlobal("libs").String(); libs != "nilnilnilniltrue" {
+		t.Errorf("fail to open only the safe libraries: %s", libs)
+	}
+	if upper := engine.state.GetGlobal("upper").String(); upper != "TEST2ab" {
+		t.Errorf("fail to open the string, math and table libraries: %s", upper)
+	}
+}
@@ -0,0 +1,189 @@
+package secret
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// EncryptedPrefix the prefix of the encrypted values in the configuration
+const EncryptedPrefix = "enc:"
+
+const (
+	privateKeyPrefix = "SUPERVISORD-SECRET-KEY-"
+	publicKeyPrefix  = "SUPERVISORD-PUBLIC-KEY-"
+	keySize          = 32
+	encryptionInfo   = "supervisord.encryption/v1/X25519"
+)
+
+var encoding = base64.RawURLEncoding
+
+// match the encrypted values, they may be embedded in other values like environment
+var encryptedValuePattern = regexp.MustCompile(regexp.QuoteMeta(EncryptedPrefix) + `[A-Za-z0-9_-]+`)
+
+// Key the X25519 private key used to decrypt the encrypted values
+type Key struct {
+	privateKey []byte
+	publicKey  []byte
+}
+
+// GenerateKey generate a new random private key
+func GenerateKey() (*Key, error) {
+	privateKey := make([]byte, keySize)
+	if _, err := rand.Read(privateKey); err != nil {
+		return nil, err
+	}
+	return newKey(privateKey)
+}
+
+func newKey(privateKey []byte) (*Key, error) {
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{privateKey: privateKey, publicKey: publicKey}, nil
+}
+
+// ParseKey parse the private key in "SUPERVISORD-SECRET-KEY-..." format
+func ParseKey(s string) (*Key, error) {
+	if !strings.HasPrefix(s, privateKeyPrefix) {
+		return nil, errors.New("not a supervisord secret key")
+	}
+	privateKey, err := encoding.DecodeString(s[len(privateKeyPrefix):])
+	if err != nil || len(privateKey) != keySize {
+		return nil, errors.New("malformed supervisord secret key")
+	}
+	return newKey(privateKey)
+}
+
+// LoadKeyFile load the private key from file, the empty lines and the
+// comment lines starting with "#" are ignored
+func LoadKeyFile(fileName string) (*Key, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := ParseKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("fail to load key file %s: %v", fileName, err)
+		}
+		return key, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no secret key in file %s", fileName)
+}
+
+// String get the private key in "SUPERVISORD-SECRET-KEY-..." format
+func (k *Key) String() string {
+	return privateKeyPrefix + encoding.EncodeToString(k.privateKey)
+}
+
+// PublicKey get the public key in "SUPERVISORD-PUBLIC-KEY-..." format used to encrypt the values
+func (k *Key) PublicKey() string {
+	return publicKeyPrefix + encoding.EncodeToString(k.publicKey)
+}
+
+// Encrypt encrypt the value with the public key and return the encrypted
+// value starting with "enc:". Like the X25519 recipient of age, a new
+// ephemeral key is generated for every value and the AES-GCM key is derived
+// from the shared secret with HKDF-SHA256
+func Encrypt(publicKey string, value string) (string, error) {
+	if !strings.HasPrefix(publicKey, publicKeyPrefix) {
+		return "", errors.New("not a supervisord public key")
+	}
+	recipient, err := encoding.DecodeString(publicKey[len(publicKeyPrefix):])
+	if err != nil || len(recipient) != keySize {
+		return "", errors.New("malformed supervisord public key")
+	}
+	ephemeral, err := GenerateKey()
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(ephemeral.privateKey, recipient, ephemeral.publicKey, recipient)
+	if err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(append([]byte(nil), ephemeral.publicKey...), make([]byte, aead.NonceSize()), []byte(value), nil)
+	return EncryptedPrefix + encoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypt the value starting with "enc:"
+func (k *Key) Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, EncryptedPrefix) {
+		return "", errors.New("not an encrypted value")
+	}
+	b, err := encoding.DecodeString(value[len(EncryptedPrefix):])
+	if err != nil || len(b) < keySize {
+		return "", errors.New("malformed encrypted value")
+	}
+	ephemeralKey := b[0:keySize]
+	aead, err := newAEAD(k.privateKey, ephemeralKey, ephemeralKey, k.publicKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := aead.Open(nil, make([]byte, aead.NonceSize()), b[keySize:], nil)
+	if err != nil {
+		return "", errors.New("fail to decrypt the value, it may be encrypted with another key")
+	}
+	return string(plaintext), nil
+}
+
+// DecryptText decrypt all the encrypted values in the text, the decrypted
+// values are masked in the logs, events and APIs
+func (k *Key) DecryptText(text string) (string, error) {
+	var decryptErr error
+	result := encryptedValuePattern.ReplaceAllStringFunc(text, func(value string) string {
+		plaintext, err := k.Decrypt(value)
+		if err != nil {
+			decryptErr = err
+			return value
+		}
+		AddValue(plaintext)
+		return plaintext
+	})
+	return result, decryptErr
+}
+
+// IsEncrypted check if there is any encrypted value in the text
+func IsEncrypted(text string) bool {
+	return encryptedValuePattern.MatchString(text)
+}
+
+// create the AES-GCM cipher with the key derived from the X25519 shared secret
+func newAEAD(privateKey []byte, peerKey []byte, ephemeralKey []byte, recipient []byte) (cipher.AEAD, error) {
+	shared, err := curve25519.X25519(privateKey, peerKey)
+	if err != nil {
+		return nil, err
+	}
+	salt := append(append([]byte(nil), ephemeralKey...), recipient...)
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(encryptionInfo)), key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
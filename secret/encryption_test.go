@@ -0,0 +1,66 @@
+package secret
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal("fail to generate the key")
+	}
+	encrypted, err := Encrypt(key.PublicKey(), "p@ss word")
+	if err != nil || !IsEncrypted(encrypted) {
+		t.Fatal("fail to encrypt the value")
+	}
+	if value, err := key.Decrypt(encrypted); err != nil || value != "p@ss word" {
+		t.Error("fail to decrypt the value")
+	}
+	other, _ := GenerateKey()
+	if _, err := other.Decrypt(encrypted); err == nil {
+		t.Error("fail to reject the value encrypted with another key")
+	}
+	if _, err := key.Decrypt(encrypted[0 : len(encrypted)-2]); err == nil {
+		t.Error("fail to reject the truncated value")
+	}
+}
+
+func TestDecryptText(t *testing.T) {
+	key, _ := GenerateKey()
+	encrypted, _ := Encrypt(key.PublicKey(), "s3cr3t")
+	text, err := key.DecryptText("DSN=\"mysql://root:" + encrypted + "@db\",HOME=/root")
+	if err != nil || text != "DSN=\"mysql://root:s3cr3t@db\",HOME=/root" {
+		t.Error("fail to decrypt the text:", text)
+	}
+	if MaskText("connect with s3cr3t") != "connect with "+Mask {
+		t.Error("fail to mask the decrypted value")
+	}
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	key, _ := GenerateKey()
+	f, _ := ioutil.TempFile("", "key")
+	f.WriteString("# public key: " + key.PublicKey() + "\n\n" + key.String() + "\n")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	loaded, err := LoadKeyFile(f.Name())
+	if err != nil || loaded.PublicKey() != key.PublicKey() {
+		t.Error("fail to load the key file")
+	}
+	if _, err := ParseKey(key.PublicKey()); err == nil {
+		t.Error("fail to reject the public key as secret key")
+	}
+}
+
+func TestDecryptKnownValue(t *testing.T) {
+	key, err := ParseKey("SUPERVISORD-SECRET-KEY-AQIDBAUGBwgJCgsMDQ4PEBESExQVFhcYGRobHB0eHyA")
+	if err != nil || key.PublicKey() != "SUPERVISORD-PUBLIC-KEY-B6N8vBQgk8i3VdwbEOhstCY3StFqqFPtC9_AsrhtHHw" {
+		t.Fatalf("fail to derive the public key: %v", err)
+	}
+	if value, err := key.Decrypt("enc:xhz44zoCvPbl_2opla0itslZL6bAl6T7dylnZpq680Vj8ohqwoA7MnFCIKP7AXiOvQSmTAk"); err != nil || value != "hello" {
+		t.Errorf("fail to decrypt the value encrypted by a previous version: %q %v", value, err)
+	}
+}
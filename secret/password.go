@@ -0,0 +1,102 @@
+package secret
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// the prefixes of the password hash schemes
+const (
+	SHAScheme      = "{SHA}"
+	BcryptScheme   = "{bcrypt}"
+	Argon2idScheme = "{argon2id}"
+)
+
+// the default argon2id parameters recommended by RFC 9106
+const (
+	argon2idTime    = 1
+	argon2idMemory  = 64 * 1024
+	argon2idThreads = 4
+	argon2idKeyLen  = 32
+	argon2idSaltLen = 16
+)
+
+// VerifyPassword check if the password matches the configured one, which is
+// either a hash like "{bcrypt}$2a$10$...", "{argon2id}$argon2id$v=19$...",
+// "{SHA}<hex sha1>" or the plaintext password
+func VerifyPassword(configured string, password string) bool {
+	switch {
+	case strings.HasPrefix(configured, SHAScheme):
+		hash := sha1.Sum([]byte(password))
+		return constantTimeEqual(strings.ToLower(configured[len(SHAScheme):]), hex.EncodeToString(hash[:]))
+	case strings.HasPrefix(configured, BcryptScheme):
+		return bcrypt.CompareHashAndPassword([]byte(configured[len(BcryptScheme):]), []byte(password)) == nil
+	case strings.HasPrefix(configured, Argon2idScheme):
+		return verifyArgon2id(configured[len(Argon2idScheme):], password)
+	default:
+		return constantTimeEqual(configured, password)
+	}
+}
+
+// HashPassword hash the password with scheme "bcrypt" or "argon2id" and
+// return it with the scheme prefix used in the configuration
+func HashPassword(scheme string, password string) (string, error) {
+	switch scheme {
+	case "bcrypt":
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", err
+		}
+		return BcryptScheme + string(hash), nil
+	case "argon2id":
+		salt := make([]byte, argon2idSaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, argon2idTime, argon2idMemory, argon2idThreads, argon2idKeyLen)
+		return fmt.Sprintf("%s$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2idScheme, argon2.Version,
+			argon2idMemory, argon2idTime, argon2idThreads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+	return "", fmt.Errorf("unsupported password hash scheme %s", scheme)
+}
+
+// verify the password with the argon2id hash in PHC string format:
+// $argon2id$v=19$m=65536,t=1,p=4$<base64 salt>$<base64 hash>
+func verifyArgon2id(encoded string, password string) bool {
+	fields := strings.Split(encoded, "$")
+	if len(fields) != 6 || fields[1] != "argon2id" {
+		return false
+	}
+	var version int
+	if _, err := fmt.Sscanf(fields[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil || time == 0 || threads == 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(fields[4])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(fields[5])
+	if err != nil || len(hash) == 0 {
+		return false
+	}
+	key := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(hash)))
+	return subtle.ConstantTimeCompare(key, hash) == 1
+}
+
+func constantTimeEqual(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,35 @@
+package secret
+
+import (
+	"testing"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	if !VerifyPassword("{SHA}82ab876d1387bfafe46cc1c8a2ef074eae50cb1d", "thepassword") ||
+		VerifyPassword("{SHA}82ab876d1387bfafe46cc1c8a2ef074eae50cb1d", "password") {
+		t.Error("fail to verify the SHA password")
+	}
+	if !VerifyPassword("123", "123") || VerifyPassword("123", "1234") || VerifyPassword("123", "") {
+		t.Error("fail to verify the plaintext password")
+	}
+	if VerifyPassword("{argon2id}$argon2id$v=19$m=65536,t=0,p=4$c2FsdA$aGFzaA", "123") ||
+		VerifyPassword("{bcrypt}$2a$10$invalid", "123") {
+		t.Error("fail to reject the malformed hash")
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	for _, scheme := range []string{"bcrypt", "argon2id"} {
+		hash, err := HashPassword(scheme, "p@ss")
+		if err != nil {
+			t.Error("fail to hash the password with", scheme)
+			continue
+		}
+		if !VerifyPassword(hash, "p@ss") || VerifyPassword(hash, "pass") {
+			t.Error("fail to verify the password hashed with", scheme, hash)
+		}
+	}
+	if _, err := HashPassword("md5", "p@ss"); err == nil {
+		t.Error("fail to reject the unsupported scheme")
+	}
+}
@@ -0,0 +1,201 @@
+// Package secret redacts the secrets in the environment, command lines and
+// texts before they are shown in the logs, events and APIs
+package secret
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Mask the replacement of the secret values
+const Mask = "******"
+
+// the names of environment variables and options whose values are secret by default
+var defaultKeys = []string{"PASSWORD", "PASSWD", "SECRET", "TOKEN", "CREDENTIAL", "PRIVATE", "API[_-]?KEY"}
+
+type masker struct {
+	// match the names whose values are secret
+	keys *regexp.Regexp
+	// match the "name=value" in the texts whose name matches keys
+	keyValues *regexp.Regexp
+	// match the secret fragments in the texts
+	patterns []*regexp.Regexp
+}
+
+var current *masker
+var lock sync.RWMutex
+
+// the secret values known by supervisord like the decrypted values in configuration
+var values = make(map[string]bool)
+
+func init() {
+	current = newMasker(nil, nil)
+}
+
+func newMasker(keys []string, patterns []*regexp.Regexp) *masker {
+	keyPattern := "(?i)(" + strings.Join(append(append([]string(nil), defaultKeys...), keys...), "|") + ")"
+	return &masker{keys: regexp.MustCompile(keyPattern),
+		keyValues: regexp.MustCompile(`([\w.-]*` + keyPattern + `[\w.-]*)=("[^"]*"|'[^']*'|[^\s,;&"']+)`),
+		patterns:  patterns}
+}
+
+// Configure set the extra patterns of the secret names and the secret
+// fragments in addition to the default names (password, secret, token...).
+// The keys are the regular expressions matching the names of environment
+// variables and options, the patterns are the regular expressions matching the
+// secrets in any text; if a pattern has a group only the group is masked
+func Configure(keys []string, patterns []string) {
+	validKeys := make([]string, 0)
+	for _, key := range keys {
+		if _, err := regexp.Compile(key); err != nil || key == "" {
+			log.WithFields(log.Fields{"key": key}).Error("invalid secret key pattern")
+			continue
+		}
+		validKeys = append(validKeys, key)
+	}
+	validPatterns := make([]*regexp.Regexp, 0)
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil || pattern == "" {
+			log.WithFields(log.Fields{"pattern": pattern}).Error("invalid secret value pattern")
+			continue
+		}
+		validPatterns = append(validPatterns, re)
+	}
+	m := newMasker(validKeys, validPatterns)
+	lock.Lock()
+	defer lock.Unlock()
+	current = m
+}
+
+func getMasker() *masker {
+	lock.RLock()
+	defer lock.RUnlock()
+	return current
+}
+
+// AddValue add a secret value masked in any text, it is kept after Configure
+func AddValue(value string) {
+	if value == "" {
+		return
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	values[value] = true
+}
+
+func getValues() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+	result := make([]string, 0, len(values))
+	for value := range values {
+		result = append(result, value)
+	}
+	// replace the longer values at first if a value contains another
+	sort.Slice(result, func(i, j int) bool { return len(result[i]) > len(result[j]) })
+	return result
+}
+
+// IsSecretKey check if the value of environment variable or option is secret
+func IsSecretKey(key string) bool {
+	return getMasker().keys.MatchString(key)
+}
+
+// MaskEnv mask the values of the secret variables in the "key=value"
+// environment, the order of environment is kept
+func MaskEnv(env []string) []string {
+	m := getMasker()
+	result := make([]string, 0, len(env))
+	for _, kv := range env {
+		pos := strings.Index(kv, "=")
+		if pos != -1 && m.keys.MatchString(kv[0:pos]) {
+			kv = kv[0:pos+1] + Mask
+		} else {
+			kv = m.maskPatterns(kv)
+		}
+		result = append(result, kv)
+	}
+	return result
+}
+
+// MaskArgs mask the secrets in the command line arguments, both the secret
+// options like "--password=xxx", "--password xxx" and the secret patterns
+func MaskArgs(args []string) []string {
+	m := getMasker()
+	result := make([]string, 0, len(args))
+	maskNext := false
+	for _, arg := range args {
+		switch {
+		case maskNext:
+			arg = Mask
+			maskNext = false
+		case strings.HasPrefix(arg, "-") && !strings.Contains(arg, "=") && m.keys.MatchString(arg):
+			maskNext = true
+		default:
+			arg = m.maskText(arg)
+		}
+		result = append(result, arg)
+	}
+	return result
+}
+
+// MaskText mask the "key=value" whose key is secret and the secret patterns in the text
+func MaskText(text string) string {
+	return getMasker().maskText(text)
+}
+
+func (m *masker) maskText(text string) string {
+	// the regular expression of "name=value" is slow on the long texts without "="
+	if strings.Contains(text, "=") {
+		text = m.keyValues.ReplaceAllString(text, "${1}="+Mask)
+	}
+	return m.maskPatterns(text)
+}
+
+func (m *masker) maskPatterns(text string) string {
+	for _, value := range getValues() {
+		text = strings.Replace(text, value, Mask, -1)
+	}
+	for _, pattern := range m.patterns {
+		if pattern.NumSubexp() == 0 {
+			text = pattern.ReplaceAllString(text, Mask)
+			continue
+		}
+		// only mask the first group
+		text = pattern.ReplaceAllStringFunc(text, func(s string) string {
+			loc := pattern.FindStringSubmatchIndex(s)
+			if loc == nil || loc[2] < 0 {
+				return s
+			}
+			return s[0:loc[2]] + Mask + s[loc[3]:]
+		})
+	}
+	return text
+}
+
+// LogHook the logrus hook masking the secrets in the message and fields of logs
+type LogHook struct {
+}
+
+// Levels implements logrus.Hook interface
+func (h *LogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements logrus.Hook interface
+func (h *LogHook) Fire(entry *log.Entry) error {
+	m := getMasker()
+	entry.Message = m.maskText(entry.Message)
+	for k, v := range entry.Data {
+		if m.keys.MatchString(k) {
+			entry.Data[k] = Mask
+		} else if s, ok := v.(string); ok {
+			entry.Data[k] = m.maskText(s)
+		}
+	}
+	return nil
+}
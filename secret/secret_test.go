@@ -0,0 +1,43 @@
+package secret
+
+import (
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestMaskEnv(t *testing.T) {
+	defer Configure(nil, nil)
+	Configure([]string{"^DSN$"}, nil)
+	env := MaskEnv([]string{"HOME=/root", "DB_PASSWORD=123", "DSN=mysql://root:123@db", "INVALID"})
+	if strings.Join(env, " ") != "HOME=/root DB_PASSWORD=****** DSN=****** INVALID" {
+		t.Error("fail to mask the secret environment:", env)
+	}
+}
+
+func TestMaskArgs(t *testing.T) {
+	args := MaskArgs([]string{"server", "--password", "123", "--api-key=abc", "token=xyz", "--port", "80"})
+	if strings.Join(args, " ") != "server --password ****** --api-key=****** token=****** --port 80" {
+		t.Error("fail to mask the secret arguments:", args)
+	}
+}
+
+func TestMaskTextWithPatterns(t *testing.T) {
+	defer Configure(nil, nil)
+	Configure(nil, []string{`mysql://[^:]+:([^@]+)@`, `sk-[a-z0-9]+`, "("})
+	text := MaskText("connect mysql://root:123@db with sk-abc123 and secret='a b'")
+	if text != "connect mysql://root:******@db with ****** and secret=******" {
+		t.Error("fail to mask the secret patterns:", text)
+	}
+}
+
+func TestLogHook(t *testing.T) {
+	entry := log.WithFields(log.Fields{"token": "abc", "command": "run --password=123", "pid": 1})
+	entry.Message = "start with password=123"
+	(&LogHook{}).Fire(entry)
+	if entry.Message != "start with password=******" || entry.Data["token"] != Mask ||
+		entry.Data["command"] != "run --password=******" || entry.Data["pid"] != 1 {
+		t.Error("fail to mask the secrets in log:", entry.Message, entry.Data)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ochinchina/supervisord/secret"
+)
+
+// KeygenCommand implements flags.Commander interface
+type KeygenCommand struct {
+	OutFile string `short:"o" long:"output" description:"the output key file" required:"true"`
+}
+
+// EncryptCommand implements flags.Commander interface
+type EncryptCommand struct {
+	KeyFile   string `short:"k" long:"key-file" description:"the key file generated by keygen"`
+	PublicKey string `short:"p" long:"public-key" description:"the public key printed by keygen"`
+}
+
+// HashPasswordCommand implements flags.Commander interface
+type HashPasswordCommand struct {
+	Scheme string `short:"s" long:"scheme" description:"the hash scheme" choice:"bcrypt" choice:"argon2id" default:"bcrypt"`
+}
+
+var keygenCommand KeygenCommand
+var encryptCommand EncryptCommand
+var hashPasswordCommand HashPasswordCommand
+
+// exit with error since the errors returned by commands are not reported
+func exitOnError(err error) error {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return nil
+}
+
+// Execute generate a new key file and print the public key
+func (x *KeygenCommand) Execute(args []string) error {
+	return exitOnError(x.generate())
+}
+
+func (x *KeygenCommand) generate() error {
+	key, err := secret.GenerateKey()
+	if err != nil {
+		return err
+	}
+	// never overwrite the key used by the encrypted values
+	f, err := os.OpenFile(x.OutFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "# created: %s\n# public key: %s\n%s\n", time.Now().Format(time.RFC3339), key.PublicKey(), key.String())
+	if err != nil {
+		return err
+	}
+	fmt.Println(key.PublicKey())
+	return nil
+}
+
+// Execute encrypt the values in arguments or the lines read from stdin
+func (x *EncryptCommand) Execute(args []string) error {
+	return exitOnError(x.encrypt(args))
+}
+
+func (x *EncryptCommand) encrypt(args []string) error {
+	publicKey := x.PublicKey
+	if x.KeyFile != "" {
+		key, err := secret.LoadKeyFile(x.KeyFile)
+		if err != nil {
+			return err
+		}
+		publicKey = key.PublicKey()
+	}
+	if publicKey == "" {
+		return errors.New("the key file or the public key is required")
+	}
+	for _, value := range readValues(args) {
+		encrypted, err := secret.Encrypt(publicKey, value)
+		if err != nil {
+			return err
+		}
+		fmt.Println(encrypted)
+	}
+	return nil
+}
+
+// Execute hash the passwords in arguments or the lines read from stdin
+func (x *HashPasswordCommand) Execute(args []string) error {
+	return exitOnError(x.hash(args))
+}
+
+func (x *HashPasswordCommand) hash(args []string) error {
+	for _, password := range readValues(args) {
+		hash, err := secret.HashPassword(x.Scheme, password)
+		if err != nil {
+			return err
+		}
+		fmt.Println(hash)
+	}
+	return nil
+}
+
+// get the values in arguments or read them from stdin if no argument
+func readValues(args []string) []string {
+	if len(args) > 0 {
+		return args
+	}
+	// read the values from stdin to keep them out of the shell history
+	values := make([]string, 0)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		values = append(values, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	return values
+}
+
+func init() {
+	parser.AddCommand("keygen",
+		"generate the key to encrypt the configuration values",
+		"The keygen subcommand writes a new secret key to the key file and prints its public key",
+		&keygenCommand)
+	parser.AddCommand("encrypt",
+		"encrypt the configuration values",
+		"The encrypt subcommand encrypts the values in arguments or the lines in stdin to \"enc:...\" used in configuration",
+		&encryptCommand)
+	parser.AddCommand("hash-password",
+		"hash the password of http server",
+		"The hash-password subcommand hashes the passwords in arguments or the lines in stdin to \"{bcrypt}...\" or \"{argon2id}...\" used in configuration",
+		&hashPasswordCommand)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/kardianos/service"
+	log "github.com/sirupsen/logrus"
+)
+
+// the name of the service if it is not set by --name
+const defaultServiceName = "go-supervisord"
+
+// the messages of the service actions
+var serviceActionDone = map[string]string{"start": "started",
+	"stop":      "stopped",
+	"restart":   "restarted",
+	"install":   "installed",
+	"uninstall": "uninstalled"}
+
+// ServiceCommand implements flags.Commander interface
+type ServiceCommand struct {
+	Name string `short:"n" long:"name" description:"the name of the service" default:"go-supervisord"`
+}
+
+var serviceCommand ServiceCommand
+
+// serviceProgram start and stop the supervisor when the service manager
+// starts and stops the service
+type serviceProgram struct {
+	supervisor chan *Supervisor
+}
+
+// Start start the supervisor in background, the service manager expects Start to return quickly
+func (p *serviceProgram) Start(s service.Service) error {
+	go func() {
+		p.supervisor <- startServer()
+	}()
+	return nil
+}
+
+// Stop stop all the programs
+func (p *serviceProgram) Stop(s service.Service) error {
+	stopServer(<-p.supervisor)
+	return nil
+}
+
+// the arguments of supervisord started by the service manager, the paths are
+// absolute because the working directory of a service is not the current one
+func getServiceArguments() []string {
+	args := make([]string, 0)
+	configuration := options.Configuration
+	if len(configuration) <= 0 {
+		configuration, _ = findSupervisordConf()
+	}
+	if len(configuration) > 0 {
+		if absFile, err := filepath.Abs(configuration); err == nil {
+			configuration = absFile
+		}
+		args = append(args, "--configuration="+configuration)
+	}
+	if len(options.EnvFile) > 0 {
+		envFile, err := filepath.Abs(options.EnvFile)
+		if err != nil {
+			envFile = options.EnvFile
+		}
+		args = append(args, "--env-file="+envFile)
+	}
+	if len(options.Procfile) > 0 {
+		if procfile, err := filepath.Abs(options.Procfile); err == nil {
+			args = append(args, "--procfile="+procfile)
+		}
+	}
+	for _, profile := range options.Profile {
+		args = append(args, "--profile="+profile)
+	}
+	if options.Watch {
+		args = append(args, "--watch")
+	}
+	return args
+}
+
+func newService(name string) (service.Service, error) {
+	return service.New(&serviceProgram{supervisor: make(chan *Supervisor, 1)}, &service.Config{Name: name,
+		DisplayName: name,
+		Description: "Supervisord service in golang",
+		Arguments:   getServiceArguments()})
+}
+
+// runService run supervisord under the control of the service manager
+func runService() {
+	// the name is not needed by the Windows service manager to run the service
+	s, err := newService(defaultServiceName)
+	if err == nil {
+		err = s.Run()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{log.ErrorKey: err}).Fatal("fail to run as service")
+	}
+}
+
+// Execute implement Execute() method defined in flags.Commander interface, executes the given command
+func (sc ServiceCommand) Execute(args []string) error {
+	if len(args) != 1 {
+		return exitOnError(fmt.Errorf("usage: supervisord service <%s>", strings.Join(service.ControlAction[:], "|")))
+	}
+	s, err := newService(sc.Name)
+	if err != nil {
+		return exitOnError(err)
+	}
+	action := strings.ToLower(args[0])
+	if err = service.Control(s, action); err != nil {
+		return exitOnError(err)
+	}
+	fmt.Printf("the service %s is %s\n", sc.Name, serviceActionDone[action])
+	return nil
+}
+
+func init() {
+	parser.AddCommand("service",
+		"install and control supervisord as a system service",
+		"The service subcommand installs, uninstalls, starts, stops and restarts supervisord as a Windows service (or a systemd, launchd... service), the arguments of the service are the current configuration file and environment file",
+		&serviceCommand)
+}
@@ -0,0 +1,150 @@
+// +build !nogui,!nohttp
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the name of the cookie keeping the session id of the web UI
+const sessionCookieName = "supervisord_session"
+
+// the default time a session is kept without any request
+const defaultSessionTimeout = 30 * time.Minute
+
+// SessionStore keep in memory the sessions of the users logged in the web UI,
+// a session expires if there is no request in the idle timeout
+type SessionStore struct {
+	sync.Mutex
+	idleTimeout time.Duration
+	// the sessions by their ids
+	sessions map[string]*session
+}
+
+type session struct {
+	user       *AuthUser
+	lastAccess time.Time
+}
+
+// NewSessionStore create an empty SessionStore
+func NewSessionStore(idleTimeout time.Duration) *SessionStore {
+	if idleTimeout <= 0 {
+		idleTimeout = defaultSessionTimeout
+	}
+	return &SessionStore{idleTimeout: idleTimeout, sessions: make(map[string]*session)}
+}
+
+// create a new session of the user and return its id
+func (ss *SessionStore) create(user *AuthUser) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	ss.Lock()
+	defer ss.Unlock()
+	now := time.Now()
+	for sessionID, sess := range ss.sessions {
+		if now.Sub(sess.lastAccess) > ss.idleTimeout {
+			delete(ss.sessions, sessionID)
+		}
+	}
+	ss.sessions[id] = &session{user: user, lastAccess: now}
+	return id, nil
+}
+
+// GetUser get the logged in user of the request, nil if the request has no
+// session or the session is expired. The idle timeout of the session is restarted
+func (ss *SessionStore) GetUser(r *http.Request) *AuthUser {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil
+	}
+	ss.Lock()
+	defer ss.Unlock()
+	sess, ok := ss.sessions[cookie.Value]
+	if !ok {
+		return nil
+	}
+	if time.Since(sess.lastAccess) > ss.idleTimeout {
+		delete(ss.sessions, cookie.Value)
+		return nil
+	}
+	sess.lastAccess = time.Now()
+	return sess.user
+}
+
+func (ss *SessionStore) remove(r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		ss.Lock()
+		defer ss.Unlock()
+		delete(ss.sessions, cookie.Value)
+	}
+}
+
+// CreateLoginHandler create the handler of the login page, the user name and
+// password posted by the login form are verified like the basic auth
+func (ss *SessionStore) CreateLoginHandler(auth *authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.isRequired() {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		if r.Method != http.MethodPost {
+			r.URL.Path = "/login.html"
+			http.FileServer(HTTP).ServeHTTP(w, r)
+			return
+		}
+		username := r.PostFormValue("username")
+		user, ok := auth.authenticate(username, r.PostFormValue("password"))
+		if !ok {
+			log.WithFields(log.Fields{"user": username, "addr": r.RemoteAddr}).Warn("fail to login the web UI")
+			http.Redirect(w, r, "/login?error=1", http.StatusSeeOther)
+			return
+		}
+		id, err := ss.create(user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookieName,
+			Value:    id,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// CreateLogoutHandler create the handler removing the session and showing the login page
+func (ss *SessionStore) CreateLogoutHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ss.remove(r)
+		http.SetCookie(w, &http.Cookie{Name: sessionCookieName,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode})
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	}
+}
+
+// check if the request is sent by the browser without basic auth, the
+// browsers are asked to login instead of prompting for the basic auth
+func isBrowserRequest(r *http.Request) bool {
+	if r.Header.Get("Authorization") != "" {
+		return false
+	}
+	return r.Header.Get("X-Requested-With") == "XMLHttpRequest" ||
+		(r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html"))
+}
@@ -0,0 +1,103 @@
+// +build !nogui,!nohttp
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionLogin(t *testing.T) {
+	sessions := NewSessionStore(time.Minute)
+	authenticator := newAuthenticator("user", "{SHA}82ab876d1387bfafe46cc1c8a2ef074eae50cb1d", nil)
+	login := sessions.CreateLoginHandler(authenticator)
+	auth := newHTTPBasicAuth(authenticator, sessions,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }))
+	post := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(url.Values{"username": {"user"}, "password": {password}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		login(w, req)
+		return w
+	}
+	get := func(header string, value string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/program/list", nil)
+		req.Header.Set(header, value)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		auth.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post("wrong"); w.Header().Get("Location") != "/login?error=1" || len(w.Result().Cookies()) != 0 {
+		t.Error("fail to reject the wrong password")
+	}
+	if w := get("Accept", "text/html"); w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login" {
+		t.Error("fail to redirect the browser to the login page")
+	}
+	if w := get("X-Requested-With", "XMLHttpRequest"); w.Code != 401 || w.Header().Get("WWW-Authenticate") != "" {
+		t.Error("fail to reject the ajax request without basic auth prompt")
+	}
+	if w := get("Accept", "*/*"); w.Code != 401 || w.Header().Get("WWW-Authenticate") == "" {
+		t.Error("fail to ask for the basic auth")
+	}
+
+	cookies := post("thepassword").Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatal("fail to create the session cookie")
+	}
+	if w := get("Accept", "text/html", cookies...); w.Body.String() != "ok" {
+		t.Error("fail to accept the logged in request")
+	}
+
+	req := httptest.NewRequest("POST", "/logout", nil)
+	req.AddCookie(cookies[0])
+	sessions.CreateLogoutHandler()(httptest.NewRecorder(), req)
+	if w := get("Accept", "text/html", cookies...); w.Code != http.StatusSeeOther {
+		t.Error("fail to logout")
+	}
+}
+
+func TestSessionIdleTimeout(t *testing.T) {
+	sessions := NewSessionStore(50 * time.Millisecond)
+	id, _ := sessions.create(&AuthUser{Name: "user", Admin: true})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: id})
+	time.Sleep(30 * time.Millisecond)
+	if sessions.GetUser(req) == nil {
+		t.Error("fail to keep the session in idle timeout")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if sessions.GetUser(req) == nil {
+		t.Error("fail to restart the idle timeout")
+	}
+	time.Sleep(80 * time.Millisecond)
+	if sessions.GetUser(req) != nil {
+		t.Error("fail to expire the idle session")
+	}
+}
+
+func TestLoginPageAssets(t *testing.T) {
+	mux := http.NewServeMux()
+	registerWebgui(mux, nil, newAuthenticator("user", "pass", nil), NewSessionStore(time.Minute), func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusUnauthorized) })
+	})
+	for _, asset := range loginPageAssets {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", asset, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("fail to serve %s to the login page", asset)
+		}
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/js/jquery-3.3.1.min.js", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Error("the other files of the web GUI should be protected")
+	}
+}
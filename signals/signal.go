@@ -3,29 +3,39 @@
 package signals
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"syscall"
 )
 
-// ToSignal convert a signal name to signal
+// ToSignal convert a signal name like "HUP", "SIGHUP" or a signal number to signal
 func ToSignal(signalName string) (os.Signal, error) {
-	if signalName == "HUP" {
+	if n, err := strconv.Atoi(signalName); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	name := strings.TrimPrefix(strings.ToUpper(signalName), "SIG")
+	if name == "HUP" {
 		return syscall.SIGHUP, nil
-	} else if signalName == "INT" {
+	} else if name == "INT" {
 		return syscall.SIGINT, nil
-	} else if signalName == "QUIT" {
+	} else if name == "QUIT" {
 		return syscall.SIGQUIT, nil
-	} else if signalName == "KILL" {
+	} else if name == "KILL" {
 		return syscall.SIGKILL, nil
-	} else if signalName == "USR1" {
+	} else if name == "USR1" {
 		return syscall.SIGUSR1, nil
-	} else if signalName == "USR2" {
+	} else if name == "USR2" {
 		return syscall.SIGUSR2, nil
-	} else {
+	} else if name == "TERM" {
 		return syscall.SIGTERM, nil
-
+	} else if name == "STOP" {
+		return syscall.SIGSTOP, nil
+	} else if name == "CONT" {
+		return syscall.SIGCONT, nil
 	}
-
+	return nil, fmt.Errorf("unknown signal %s", signalName)
 }
 
 // Kill send signal to the process
@@ -8,30 +8,31 @@ import (
 	log "github.com/sirupsen/logrus"
 	"os"
 	"os/exec"
+	"strings"
 	"syscall"
 )
 
 //convert a signal name to signal
 func ToSignal(signalName string) (os.Signal, error) {
-	if signalName == "HUP" {
+	name := strings.TrimPrefix(strings.ToUpper(signalName), "SIG")
+	if name == "HUP" {
 		return syscall.SIGHUP, nil
-	} else if signalName == "INT" {
+	} else if name == "INT" {
 		return syscall.SIGINT, nil
-	} else if signalName == "QUIT" {
+	} else if name == "QUIT" {
 		return syscall.SIGQUIT, nil
-	} else if signalName == "KILL" {
+	} else if name == "KILL" {
 		return syscall.SIGKILL, nil
-	} else if signalName == "USR1" {
+	} else if name == "USR1" {
 		log.Warn("signal USR1 is not supported in windows")
 		return nil, errors.New("signal USR1 is not supported in windows")
-	} else if signalName == "USR2" {
+	} else if name == "USR2" {
 		log.Warn("signal USR2 is not supported in windows")
 		return nil, errors.New("signal USR2 is not supported in windows")
-	} else {
+	} else if name == "TERM" {
 		return syscall.SIGTERM, nil
-
 	}
-
+	return nil, fmt.Errorf("unknown signal %s", signalName)
 }
 
 //
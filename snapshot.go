@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/ochinchina/supervisord/process"
+	"github.com/ochinchina/supervisord/types"
+)
+
+// GetRuntimeSnapshot get the runtime state of the programs the user can
+// access: if they are running and their resource limits changed at runtime,
+// to restore it after a reprovisioning or on another identical host
+func (s *Supervisor) GetRuntimeSnapshot(r *http.Request, args *struct{}, reply *struct{ Programs []types.ProgramSnapshot }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	reply.Programs = make([]types.ProgramSnapshot, 0)
+	s.procMgr.ForEachProcess(func(proc *process.Process) {
+		if s.canAccess(r, proc) {
+			reply.Programs = append(reply.Programs, types.ProgramSnapshot{Name: proc.GetName(),
+				Group:   proc.GetGroup(),
+				Running: isRunningState(proc.GetState()),
+				Limits:  proc.GetChangedResourceLimits()})
+		}
+	})
+	return nil
+}
@@ -0,0 +1,77 @@
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"supervisord/internal/testutil"
+
+	"github.com/ochinchina/supervisord/process"
+	"github.com/ochinchina/supervisord/types"
+)
+
+func TestRuntimeSnapshot(t *testing.T) {
+	dir := testutil.TempDir(t)
+	program := "command=%[2]s\nautostart=false\nstartsecs=0\nautorestart=false\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n"
+	content := testSupervisordSection + "\n" +
+		"[program:web]\n" + program + "\n[program:db]\n" + program
+	s := startConfSupervisor(t, dir, fmt.Sprintf(content, dir, testutil.FakeProgram(t, dir, testutil.Sleep)))
+	web, db := s.GetManager().Find("web"), s.GetManager().Find("db")
+	web.Start(true)
+	web.SetResourceLimits(types.ResourceLimits{Nice: "5"})
+	ctlCommand.rpcc = s.xmlRPC.NewInMemoryClient(s)
+	defer func() { ctlCommand.rpcc = nil }()
+
+	snapshotFile := filepath.Join(dir, "snapshot.json")
+	output := captureOutput(t, func() { snapshotSaveCommand.Execute([]string{snapshotFile}) })
+	if output != "Saved the state of 2 programs to "+snapshotFile+"\n" {
+		t.Fatalf("fail to save the snapshot: %q", output)
+	}
+	snapshot, err := readSnapshot(snapshotFile)
+	if err != nil || len(snapshot.Programs) != 2 {
+		t.Fatalf("fail to read the snapshot: %v %v", snapshot, err)
+	}
+	for _, program := range snapshot.Programs {
+		if program.Name == "web" && (!program.Running || program.Limits != (types.ResourceLimits{Nice: "5"})) {
+			t.Errorf("fail to save the running program: %v", program)
+		}
+		if program.Name == "db" && (program.Running || program.Limits != (types.ResourceLimits{})) {
+			t.Errorf("fail to save the stopped program: %v", program)
+		}
+	}
+
+	web.Stop(true)
+	db.Start(true)
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to reload supervisord: %v", err)
+	}
+	output = captureOutput(t, func() {
+		if err := snapshotRestoreCommand.Execute([]string{snapshotFile}); err != nil {
+			t.Errorf("fail to restore the snapshot: %v", err)
+		}
+	})
+	if !strings.Contains(output, "web: started\n") || !strings.Contains(output, "db: stopped\n") {
+		t.Errorf("fail to report the restored programs: %q", output)
+	}
+	if web.GetState() != process.Running || db.GetState() != process.Stopped {
+		t.Errorf("fail to restore the states: %v %v", web.GetState(), db.GetState())
+	}
+	if limits := web.GetChangedResourceLimits(); limits != (types.ResourceLimits{Nice: "5"}) {
+		t.Errorf("fail to restore the changed limits: %v", limits)
+	}
+
+	s.config.RemoveProgram("db")
+	s.GetManager().Remove("db")
+	output = captureOutput(t, func() {
+		if err := snapshotRestoreCommand.Execute([]string{snapshotFile}); err == nil {
+			t.Error("fail to report the missing program")
+		}
+	})
+	if !strings.Contains(output, "db: not found\n") || !strings.Contains(output, "web: unchanged\n") {
+		t.Errorf("fail to restore the snapshot on another host: %q", output)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/ochinchina/supervisord/signals"
+	"github.com/ochinchina/supervisord/sshrun"
+)
+
+// SSHRunCommand implements flags.Commander interface, it runs the command of a
+// program with the ssh runner on the remote machine
+type SSHRunCommand struct {
+	Host           string        `long:"host" description:"the remote machine host or host:port" required:"true"`
+	User           string        `long:"user" description:"the remote user"`
+	KeyFile        string        `long:"key" description:"the private key file" required:"true"`
+	KnownHostsFile string        `long:"known-hosts" description:"the known_hosts file verifying the host key"`
+	ConnectTimeout time.Duration `long:"connect-timeout" description:"the timeout to connect to the remote machine" default:"10s"`
+	Env            []string      `long:"env" description:"the name of the environment variable passed to the command"`
+}
+
+var sshRunCommand SSHRunCommand
+
+// the signals forwarded to the remote command
+var forwardedSignals = []string{"HUP", "INT", "QUIT", "TERM", "USR1", "USR2"}
+
+// get the names of the forwarded signals received by supervisord
+func notifyForwardedSignals() <-chan string {
+	names := make(map[os.Signal]string)
+	sigs := make(chan os.Signal, 1)
+	for _, name := range forwardedSignals {
+		if sig, err := signals.ToSignal(name); err == nil {
+			names[sig] = name
+			signal.Notify(sigs, sig)
+		}
+	}
+	remoteSigs := make(chan string, 1)
+	go func() {
+		for sig := range sigs {
+			remoteSigs <- names[sig]
+		}
+	}()
+	return remoteSigs
+}
+
+// Execute implement Execute() method defined in flags.Commander interface, executes the given command
+func (sc SSHRunCommand) Execute(args []string) error {
+	env := make([]string, 0)
+	for _, name := range sc.Env {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	code, err := sshrun.Run(sshrun.Options{Host: sc.Host,
+		User:           sc.User,
+		KeyFile:        sc.KeyFile,
+		KnownHostsFile: sc.KnownHostsFile,
+		ConnectTimeout: sc.ConnectTimeout,
+		Command:        strings.Join(args, " "),
+		Env:            env,
+		Signals:        notifyForwardedSignals(),
+		Stdin:          os.Stdin,
+		Stdout:         os.Stdout,
+		Stderr:         os.Stderr})
+	exitOnError(err)
+	os.Exit(code)
+	return nil
+}
+
+func init() {
+	cmd, _ := parser.AddCommand("ssh-run",
+		"run a command on a remote machine",
+		"The ssh-run subcommand runs the command of a program with the ssh runner on the remote machine over SSH",
+		&sshRunCommand)
+	cmd.Hidden = true
+}
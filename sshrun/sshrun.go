@@ -0,0 +1,175 @@
+// Package sshrun runs the command of the programs with the ssh runner on a
+// remote machine
+package sshrun
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// the exit code if the connection is closed without the exit status of the command
+const exitCodeNoStatus = 255
+
+// Options the options of the command run on the remote machine
+type Options struct {
+	// the remote machine "host" or "host:port"
+	Host string
+	// the remote user, the current user by default
+	User string
+	// the private key file used to authenticate the user
+	KeyFile string
+	// the known_hosts file used to verify the host key, ~/.ssh/known_hosts by default
+	KnownHostsFile string
+	ConnectTimeout time.Duration
+	// the command run by the shell of the remote user
+	Command string
+	// the "key=value" environment set in the command
+	Env []string
+	// the names of the signals (TERM, HUP...) forwarded to the command
+	Signals <-chan string
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+}
+
+func (o *Options) getAddress() string {
+	if _, _, err := net.SplitHostPort(o.Host); err == nil {
+		return o.Host
+	}
+	return net.JoinHostPort(o.Host, "22")
+}
+
+func (o *Options) getUser() (string, error) {
+	if o.User != "" {
+		return o.User, nil
+	}
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return u.Username, nil
+}
+
+func (o *Options) getKnownHostsFile() string {
+	if o.KnownHostsFile != "" {
+		return o.KnownHostsFile
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+func (o *Options) createClientConfig() (*ssh.ClientConfig, error) {
+	username, err := o.getUser()
+	if err != nil {
+		return nil, fmt.Errorf("fail to get the remote user: %v", err)
+	}
+	key, err := ioutil.ReadFile(o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read the key file: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("fail to parse the key file %s: %v", o.KeyFile, err)
+	}
+	hostKeyCallback, err := knownhosts.New(o.getKnownHostsFile())
+	if err != nil {
+		return nil, fmt.Errorf("fail to read the known hosts: %v", err)
+	}
+	return &ssh.ClientConfig{User: username,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         o.ConnectTimeout}, nil
+}
+
+// quote the value for the POSIX shell
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "'\\''", -1) + "'"
+}
+
+// get the command with the environment assigned before it, the environment
+// sent by ssh is refused by most of the ssh servers
+func (o *Options) getCommand() string {
+	buf := strings.Builder{}
+	for _, env := range o.Env {
+		if pos := strings.Index(env, "="); pos > 0 {
+			fmt.Fprintf(&buf, "%s=%s ", env[:pos], quote(env[pos+1:]))
+		}
+	}
+	buf.WriteString(o.Command)
+	return buf.String()
+}
+
+// Run run the command on the remote machine until it exits and return its exit
+// code, 128 + the signal number if it is killed by a signal like the shell
+func Run(options Options) (int, error) {
+	clientConfig, err := options.createClientConfig()
+	if err != nil {
+		return 0, err
+	}
+	client, err := ssh.Dial("tcp", options.getAddress(), clientConfig)
+	if err != nil {
+		return 0, fmt.Errorf("fail to connect to %s: %v", options.Host, err)
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+	session.Stdin = options.Stdin
+	session.Stdout = options.Stdout
+	session.Stderr = options.Stderr
+	if err := session.Start(options.getCommand()); err != nil {
+		return 0, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case name := <-options.Signals:
+				session.Signal(ssh.Signal(name))
+			case <-done:
+				return
+			}
+		}
+	}()
+	return getExitCode(session.Wait())
+}
+
+// the numbers of the signals in RFC 4254 which are the same on all the POSIX systems
+var signalNumbers = map[string]int{"ABRT": 6, "ALRM": 14, "FPE": 8, "HUP": 1, "ILL": 4, "INT": 2, "KILL": 9,
+	"PIPE": 13, "QUIT": 3, "SEGV": 11, "TERM": 15}
+
+func getExitCode(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		if sig := exitErr.Signal(); sig != "" {
+			if n, ok := signalNumbers[sig]; ok {
+				return 128 + n, nil
+			}
+			return exitCodeNoStatus, nil
+		}
+		return exitErr.ExitStatus(), nil
+	}
+	var missingErr *ssh.ExitMissingError
+	if errors.As(err, &missingErr) {
+		return exitCodeNoStatus, nil
+	}
+	return 0, err
+}
@@ -0,0 +1,127 @@
+package sshrun
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// start the ssh server which prints the command and exits with the status 3,
+// or waits for a signal and exits with it if the command is "wait"
+func startTestServer(t *testing.T, clientKey ssh.PublicKey) (string, ssh.PublicKey) {
+	hostKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("fail to generate the host key")
+	}
+	hostSigner, _ := ssh.NewSignerFromKey(hostKey)
+	config := &ssh.ServerConfig{PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		if !bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+			return nil, os.ErrPermission
+		}
+		return nil, nil
+	}}
+	config.AddHostKey(hostSigner)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("fail to listen")
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestConn(conn, config)
+		}
+	}()
+	return listener.Addr().String(), hostSigner.PublicKey()
+}
+
+func serveTestConn(conn net.Conn, config *ssh.ServerConfig) {
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		for req := range requests {
+			switch req.Type {
+			case "exec":
+				var exec struct{ Command string }
+				ssh.Unmarshal(req.Payload, &exec)
+				req.Reply(true, nil)
+				channel.Write([]byte(exec.Command))
+				if exec.Command != "wait" {
+					channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{3}))
+					channel.Close()
+				}
+			case "signal":
+				var sig struct{ Signal string }
+				ssh.Unmarshal(req.Payload, &sig)
+				channel.SendRequest("exit-signal", false, ssh.Marshal(struct {
+					Signal     string
+					CoreDumped bool
+					Error      string
+					Lang       string
+				}{Signal: sig.Signal}))
+				channel.Close()
+			default:
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshrun")
+	if err != nil {
+		t.Fatal("fail to create temporary directory")
+	}
+	defer os.RemoveAll(dir)
+	clientKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("fail to generate the client key")
+	}
+	keyFile := filepath.Join(dir, "id_rsa")
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(clientKey)}), 0600)
+	clientSigner, _ := ssh.NewSignerFromKey(clientKey)
+	addr, hostKey := startTestServer(t, clientSigner.PublicKey())
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	ioutil.WriteFile(knownHostsFile, []byte(knownhosts.Line([]string{addr}, hostKey)+"\n"), 0600)
+
+	stdout := &bytes.Buffer{}
+	code, err := Run(Options{Host: addr, User: "test", KeyFile: keyFile, KnownHostsFile: knownHostsFile,
+		Command: "exit3", Env: []string{"NAME=it's"}, Stdout: stdout, Stderr: ioutil.Discard})
+	if err != nil || code != 3 || stdout.String() != `NAME='it'\''s' exit3` {
+		t.Errorf("fail to run the command on the remote machine: %d %v %q", code, err, stdout.String())
+	}
+
+	sigs := make(chan string, 1)
+	sigs <- "TERM"
+	code, err = Run(Options{Host: addr, User: "test", KeyFile: keyFile, KnownHostsFile: knownHostsFile,
+		Command: "wait", Signals: sigs, Stdout: ioutil.Discard, Stderr: ioutil.Discard})
+	if err != nil || code != 128+15 {
+		t.Errorf("fail to forward the signal to the remote command: %d %v", code, err)
+	}
+
+	ioutil.WriteFile(knownHostsFile, []byte{}, 0600)
+	if _, err := Run(Options{Host: addr, User: "test", KeyFile: keyFile, KnownHostsFile: knownHostsFile, Command: "exit3"}); err == nil {
+		t.Error("fail to refuse the unknown host key")
+	}
+}
@@ -0,0 +1,197 @@
+// +build !nometrics
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/events"
+	"github.com/ochinchina/supervisord/process"
+	log "github.com/sirupsen/logrus"
+)
+
+// the default seconds between two flushes of the gauges
+const defaultStatsdFlushSecs = 10
+
+// the maximum size of a UDP packet of metrics, below the usual MTU
+const statsdMaxPacketSize = 1432
+
+// the [statsd] section pushing the metrics to a statsd or DogStatsD server
+type statsdConfig struct {
+	address   string
+	prefix    string
+	tags      string
+	dogstatsd bool
+	interval  time.Duration
+}
+
+// StatsdEmitter push the state transitions, the restarts and the uptime of
+// the programs to a statsd or DogStatsD server
+type StatsdEmitter struct {
+	lock   sync.Mutex
+	config *statsdConfig
+	conn   net.Conn
+	// the restarts of the programs at the last flush
+	restarts map[string]int
+	// closed to stop the flushes with the previous configuration
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewStatsdEmitter create a StatsdEmitter pushing nothing
+func NewStatsdEmitter() *StatsdEmitter {
+	return &StatsdEmitter{restarts: make(map[string]int)}
+}
+
+// parse the [statsd] section, nil if there is no address
+func parseStatsdConfig(cfg *config.Config) *statsdConfig {
+	entries := cfg.GetEntries(func(entry *config.Entry) bool { return entry.Name == "statsd" })
+	if len(entries) == 0 || entries[0].GetString("address", "") == "" {
+		return nil
+	}
+	entry := entries[0]
+	interval := entry.GetInt("flush_interval_secs", defaultStatsdFlushSecs)
+	if interval <= 0 {
+		interval = defaultStatsdFlushSecs
+	}
+	return &statsdConfig{address: entry.GetString("address", ""),
+		prefix:    entry.GetString("prefix", "supervisord."),
+		tags:      strings.Join(splitList(entry.GetString("tags", "")), ","),
+		dogstatsd: entry.GetBool("dogstatsd", true),
+		interval:  time.Duration(interval) * time.Second}
+}
+
+// format a metric with its tags, the tags are dropped for a plain statsd
+func (cfg *statsdConfig) format(name string, value string, metricType string, tags ...string) string {
+	line := fmt.Sprintf("%s%s:%s|%s", cfg.prefix, name, value, metricType)
+	if !cfg.dogstatsd {
+		return line
+	}
+	if cfg.tags != "" {
+		tags = append(tags, cfg.tags)
+	}
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+// start, restart or stop pushing the metrics if the [statsd] section is changed
+func (se *StatsdEmitter) load(s *Supervisor) {
+	cfg := parseStatsdConfig(s.config)
+	se.lock.Lock()
+	if cfg == se.config || (cfg != nil && se.config != nil && *cfg == *se.config) {
+		se.lock.Unlock()
+		return
+	}
+	stop, done, conn := se.stop, se.done, se.conn
+	se.config, se.stop, se.done, se.conn = nil, nil, nil, nil
+	se.lock.Unlock()
+	// the flush in progress takes the lock
+	if stop != nil {
+		events.Unsubscribe("statsd")
+		close(stop)
+		<-done
+		conn.Close()
+	}
+	if cfg == nil {
+		return
+	}
+	conn, err := net.Dial("udp", cfg.address)
+	if err != nil {
+		log.WithFields(log.Fields{"address": cfg.address, log.ErrorKey: err}).Error("fail to connect to the statsd server")
+		return
+	}
+	log.WithFields(log.Fields{"address": cfg.address, "interval": cfg.interval.String()}).Info("push the metrics to the statsd server")
+	se.lock.Lock()
+	defer se.lock.Unlock()
+	se.config, se.conn = cfg, conn
+	se.stop, se.done = make(chan struct{}), make(chan struct{})
+	events.Subscribe("statsd", []string{"PROCESS_STATE"}, func(event events.Event) { se.onStateChange(s, event) })
+	go se.run(s, cfg, se.stop, se.done)
+}
+
+// send the metrics in as few packets as possible, must be called with the lock hold
+func (se *StatsdEmitter) send(lines []string) {
+	packet := ""
+	for _, line := range lines {
+		if packet != "" && len(packet)+1+len(line) > statsdMaxPacketSize {
+			se.conn.Write([]byte(packet))
+			packet = ""
+		}
+		if packet != "" {
+			packet += "\n"
+		}
+		packet += line
+	}
+	if packet != "" {
+		se.conn.Write([]byte(packet))
+	}
+}
+
+// count the state transitions of the programs, the event is emitted with the
+// lock of the process held so only its body and the configuration are used
+func (se *StatsdEmitter) onStateChange(s *Supervisor, event events.Event) {
+	body := event.GetBody()
+	program, group := eventBodyField(body, "processname"), eventBodyField(body, "groupname")
+	if entry := s.config.GetProgram(program); group == "" && entry != nil {
+		group = entry.Group
+	}
+	se.lock.Lock()
+	defer se.lock.Unlock()
+	if se.config == nil {
+		return
+	}
+	tags := []string{"program:" + program,
+		"group:" + group,
+		"state:" + strings.TrimPrefix(event.GetType(), "PROCESS_STATE_"),
+		"from_state:" + strings.ToUpper(eventBodyField(body, "from_state"))}
+	se.send([]string{se.config.format("process.transition", "1", "c", tags...)})
+}
+
+// flush the gauges now and at every interval until stop is closed
+func (se *StatsdEmitter) run(s *Supervisor, cfg *statsdConfig, stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(cfg.interval)
+	defer ticker.Stop()
+	for {
+		se.flush(s)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// push the up and uptime gauges and the restarts since the last flush
+func (se *StatsdEmitter) flush(s *Supervisor) {
+	infos := s.getLocalProcessInfos()
+	se.lock.Lock()
+	defer se.lock.Unlock()
+	if se.config == nil {
+		return
+	}
+	lines := make([]string, 0, 3*len(infos))
+	restarts := make(map[string]int)
+	for _, info := range infos {
+		tags := []string{"program:" + info.Name, "group:" + info.Group}
+		up := "0"
+		if info.State == int(process.Running) {
+			up = "1"
+		}
+		lines = append(lines, se.config.format("process.up", up, "g", tags...),
+			se.config.format("process.uptime", fmt.Sprint(info.CurrentUptime), "g", tags...))
+		restarts[info.GetFullName()] = info.Restarts
+		if prev, ok := se.restarts[info.GetFullName()]; ok && info.Restarts > prev {
+			lines = append(lines, se.config.format("process.restarts", fmt.Sprint(info.Restarts-prev), "c", tags...))
+		}
+	}
+	se.restarts = restarts
+	se.send(lines)
+}
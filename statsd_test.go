@@ -0,0 +1,70 @@
+// +build !windows,!nometrics
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"supervisord/internal/testutil"
+)
+
+func TestStatsdEmitter(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	lines := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, _, err := server.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			for _, line := range strings.Split(string(buf[:n]), "\n") {
+				lines <- line
+			}
+		}
+	}()
+	waitLine := func(expected string) bool {
+		timeout := time.After(3 * time.Second)
+		for {
+			select {
+			case line := <-lines:
+				if line == expected {
+					return true
+				}
+			case <-timeout:
+				return false
+			}
+		}
+	}
+
+	dir := testutil.TempDir(t)
+	content := testSupervisordSection + "\n" +
+		"[program:web]\ncommand=%[2]s\nautostart=false\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n\n" +
+		"[statsd]\naddress=%[3]s\ntags=env:test\nflush_interval_secs=1\n"
+	s := startConfSupervisor(t, dir, fmt.Sprintf(content, dir, testutil.FakeProgram(t, dir, testutil.Sleep), server.LocalAddr()))
+	if !waitLine("supervisord.process.up:0|g|#program:web,group:web,env:test") {
+		t.Error("fail to push the gauge of the stopped program")
+	}
+	s.GetManager().Find("web").Start(true)
+	if !waitLine("supervisord.process.transition:1|c|#program:web,group:web,state:RUNNING,from_state:STARTING,env:test") {
+		t.Error("fail to push the state transition")
+	}
+	if !waitLine("supervisord.process.up:1|g|#program:web,group:web,env:test") {
+		t.Error("fail to push the gauge of the running program")
+	}
+
+	s.statsd.load(s)
+	cfg := parseStatsdConfig(s.config)
+	cfg.dogstatsd = false
+	if line := cfg.format("process.up", "1", "g", "program:web"); line != "supervisord.process.up:1|g" {
+		t.Errorf("fail to drop the tags for statsd: %s", line)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ochinchina/supervisord/config"
+	"github.com/ochinchina/supervisord/process"
+	"github.com/ochinchina/supervisord/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// the default seconds between two exports of the status
+const defaultStatusExportSecs = 30
+
+// the [status_export] section writing the status of the programs to a file
+type statusExportConfig struct {
+	file     string
+	interval time.Duration
+}
+
+// StatusExporter write the status of the programs (like getAllProcessInfo)
+// to a JSON file periodically, for the integrations which read files only
+type StatusExporter struct {
+	lock   sync.Mutex
+	config *statusExportConfig
+	// closed to stop the export with the previous configuration
+	stop chan struct{}
+	// closed when the export with the previous configuration is stopped
+	done chan struct{}
+}
+
+// NewStatusExporter create a StatusExporter exporting nothing
+func NewStatusExporter() *StatusExporter {
+	return &StatusExporter{}
+}
+
+// parse the [status_export] section, nil if there is no file to export to
+func parseStatusExportConfig(cfg *config.Config) *statusExportConfig {
+	entries := cfg.GetEntries(func(entry *config.Entry) bool { return entry.Name == "status_export" })
+	if len(entries) == 0 || entries[0].GetString("file", "") == "" {
+		return nil
+	}
+	interval := entries[0].GetInt("interval_secs", defaultStatusExportSecs)
+	if interval <= 0 {
+		interval = defaultStatusExportSecs
+	}
+	return &statusExportConfig{file: entries[0].GetStringExpression("file", ""), interval: time.Duration(interval) * time.Second}
+}
+
+// start, restart or stop the export if the [status_export] section is changed
+func (se *StatusExporter) load(s *Supervisor) {
+	cfg := parseStatusExportConfig(s.config)
+	se.lock.Lock()
+	defer se.lock.Unlock()
+	if cfg == se.config || (cfg != nil && se.config != nil && *cfg == *se.config) {
+		return
+	}
+	if se.stop != nil {
+		close(se.stop)
+		<-se.done
+		se.stop, se.done = nil, nil
+	}
+	se.config = cfg
+	if cfg == nil {
+		return
+	}
+	log.WithFields(log.Fields{"file": cfg.file, "interval": cfg.interval.String()}).Info("export the status of the programs")
+	se.stop, se.done = make(chan struct{}), make(chan struct{})
+	go se.run(s, cfg, se.stop, se.done)
+}
+
+// export the status now and at every interval until stop is closed
+func (se *StatusExporter) run(s *Supervisor, cfg *statusExportConfig, stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(cfg.interval)
+	defer ticker.Stop()
+	for {
+		if err := writeStatusFile(cfg.file, s.getLocalProcessInfos()); err != nil {
+			log.WithFields(log.Fields{"file": cfg.file, log.ErrorKey: err}).Error("fail to export the status of the programs")
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// get the information of the programs supervised by this supervisord
+func (s *Supervisor) getLocalProcessInfos() []types.ProcessInfo {
+	infos := make([]types.ProcessInfo, 0)
+	s.procMgr.ForEachProcess(func(proc *process.Process) {
+		infos = append(infos, *getProcessInfo(proc))
+	})
+	types.SortProcessInfos(infos)
+	return infos
+}
+
+// write the status to a temporary file renamed to the file, the readers
+// never see a partial status
+func writeStatusFile(fileName string, infos []types.ProcessInfo) error {
+	b, err := json.MarshalIndent(infos, "", "  ")
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Dir(fileName), 0755)
+	tmpFile := fileName + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, fileName)
+}
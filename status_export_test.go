@@ -0,0 +1,55 @@
+// +build !windows
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"supervisord/internal/testutil"
+
+	"github.com/ochinchina/supervisord/types"
+)
+
+func TestStatusExport(t *testing.T) {
+	dir := testutil.TempDir(t)
+	statusFile := filepath.Join(dir, "status", "status.json")
+	content := testSupervisordSection + "\n" +
+		"[program:web]\ncommand=%[2]s\nautostart=false\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n"
+	base := fmt.Sprintf(content, dir, testutil.FakeProgram(t, dir, testutil.Sleep))
+	s := startConfSupervisor(t, dir, base+"\n[status_export]\nfile="+statusFile+"\ninterval_secs=1\n")
+
+	readStatus := func() []types.ProcessInfo {
+		infos := make([]types.ProcessInfo, 0)
+		b, err := ioutil.ReadFile(statusFile)
+		if err != nil || json.Unmarshal(b, &infos) != nil {
+			return nil
+		}
+		return infos
+	}
+	if !testutil.WaitFor(time.Second, func() bool { return len(readStatus()) == 1 }) {
+		t.Fatal("fail to export the status at the load")
+	}
+	if infos := readStatus(); infos[0].Name != "web" || infos[0].Statename != "Stopped" {
+		t.Errorf("fail to export the status of the program: %v", infos[0])
+	}
+	s.GetManager().Find("web").Start(true)
+	if !testutil.WaitFor(3*time.Second, func() bool { infos := readStatus(); return len(infos) == 1 && infos[0].Statename == "Running" }) {
+		t.Error("fail to export the status periodically")
+	}
+
+	ioutil.WriteFile(s.GetConfig().GetConfigFile(), []byte(base+"\n[status_export]\nfile=\n"), 0644)
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to reload supervisord: %v", err)
+	}
+	os.Remove(statusFile)
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(statusFile); err == nil {
+		t.Error("fail to stop the export without file")
+	}
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/ochinchina/supervisord/config"
@@ -13,6 +19,8 @@ import (
 	"github.com/ochinchina/supervisord/faults"
 	"github.com/ochinchina/supervisord/logger"
 	"github.com/ochinchina/supervisord/process"
+	"github.com/ochinchina/supervisord/script"
+	"github.com/ochinchina/supervisord/secret"
 	"github.com/ochinchina/supervisord/signals"
 	"github.com/ochinchina/supervisord/types"
 	"github.com/ochinchina/supervisord/util"
@@ -25,6 +33,16 @@ const (
 	SupervisorVersion = "3.0"
 )
 
+// the states of supervisord like python supervisor
+const (
+	supervisorRunning    = 1
+	supervisorRestarting = 0
+	supervisorShutdown   = -1
+)
+
+var errStandby = fmt.Errorf("supervisord is in standby mode, the programs can only be started by the leader")
+var errNodeDryRun = fmt.Errorf("dry run is not supported for the programs of child supervisord nodes")
+
 // Supervisor manage all the processes defined in the supervisor configuration file.
 // All the supervisor public interface is defined in this class
 type Supervisor struct {
@@ -32,13 +50,49 @@ type Supervisor struct {
 	procMgr    *process.Manager // process manager
 	xmlRPC     *XMLRPC          // XMLRPC interface
 	logger     logger.Logger    // logger manager
-	restarting bool             // if supervisor is in restarting state
+	state      int32            // the supervisor state: RUNNING, RESTARTING or SHUTDOWN
+	leader     *LeaderElection  // the leader election in active/standby mode
+	operations OperationLock    // serialize the reload, start all and stop all operations
+
+	configErr     error // the error of the last failed configuration load, DEGRADED if it is not nil
+	configErrLock sync.Mutex
+
+	rpcExtensions     []*rpcExtension // the loaded rpc extensions
+	rpcExtensionsOnce sync.Once
+	eventScripts      []*script.Engine      // the scripts reacting to the events
+	idempotency       *IdempotencyStore     // the results of the REST requests with idempotency key
+	jobs              *JobManager           // the asynchronous jobs started by REST requests
+	maintenance       *MaintenanceScheduler // the maintenance windows suppressing the restarts and alerts
+	watchdog          *Watchdog             // detect the deadlocks of supervisord, nil if disabled
+	leaks             *ReloadLeakDetector   // warn when the goroutines or open files grow at every reload
+	rollback          *UpdateRollback       // roll back the programs going FATAL after a reload
+	chaos             *ChaosDrills          // kill or delay the programs for the resilience drills
+	throttler         *CPUThrottler         // throttle the programs using too much CPU
+	statusExporter    *StatusExporter       // write the status of the programs to a file periodically
+	statsd            *StatsdEmitter        // push the metrics of the programs to a statsd server
+	journal           *events.Journal       // the events persisted for the consumers catching up, nil if disabled
+	journalLock       sync.Mutex
+	runSeq            uint32                // the sequence of the names of the ad-hoc programs
+	maxOperationTime  time.Duration         // the maximum time to wait a start/stop operation
 }
 
 // StartProcessArgs arguments for starting a process
 type StartProcessArgs struct {
-	Name string // program name
-	Wait bool   `default:"true"` // Wait the program starting finished
+	Name    string // program name
+	Wait    bool   `default:"true"` // Wait the program starting finished
+	DryRun  bool   // return the action plan without executing it
+	Timeout int    // the maximum seconds to wait, 0 for the max_operation_secs
+	Force   bool   // stop the locked programs
+	// the KEY=VALUE environment overrides of this start only
+	Env []string
+}
+
+// StartAllProcessesArgs arguments for starting or stopping all the processes
+type StartAllProcessesArgs struct {
+	Wait    bool `default:"true"` // Wait the program starting finished
+	DryRun  bool // return the action plan without executing it
+	Timeout int  // the maximum seconds to wait, 0 for the max_operation_secs
+	Force   bool // stop the locked programs
 }
 
 //ProcessStdin  process stdin from client
@@ -57,6 +111,9 @@ type RemoteCommEvent struct {
 type StateInfo struct {
 	Statecode int    `xml:"statecode"`
 	Statename string `xml:"statename"`
+	Operation string `xml:"operation"` // the running reload, start all or stop all operation
+	Since     int    `xml:"since"`     // the start time of the running operation
+	Error     string `xml:"error"`     // the error of the failed configuration load in DEGRADED state
 }
 
 // RPCTaskResult result of some remote commands
@@ -90,9 +147,18 @@ type ProcessTailLog struct {
 // NewSupervisor create a Supervisor object with supervisor configuration file
 func NewSupervisor(configFile string) *Supervisor {
 	return &Supervisor{config: config.NewConfig(configFile),
-		procMgr:    process.NewManager(),
-		xmlRPC:     NewXMLRPC(),
-		restarting: false}
+		procMgr:        process.NewManager(),
+		xmlRPC:         NewXMLRPC(),
+		idempotency:    NewIdempotencyStore(defaultIdempotencyKeyTTL),
+		jobs:           NewJobManager(),
+		maintenance:    NewMaintenanceScheduler(),
+		leaks:          NewReloadLeakDetector(),
+		rollback:       NewUpdateRollback(),
+		chaos:          NewChaosDrills(),
+		throttler:      NewCPUThrottler(),
+		statusExporter: NewStatusExporter(),
+		statsd:         NewStatsdEmitter(),
+		state:          supervisorRunning}
 }
 
 // GetConfig get the loaded superisor configuration
@@ -102,18 +168,27 @@ func (s *Supervisor) GetConfig() *config.Config {
 
 // GetVersion get the version of supervisor
 func (s *Supervisor) GetVersion(r *http.Request, args *struct{}, reply *struct{ Version string }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
 	reply.Version = SupervisorVersion
 	return nil
 }
 
 // GetSupervisorVersion get the supervisor version
 func (s *Supervisor) GetSupervisorVersion(r *http.Request, args *struct{}, reply *struct{ Version string }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
 	reply.Version = SupervisorVersion
 	return nil
 }
 
 // GetIdentification get the supervisor identifier configured in the file
 func (s *Supervisor) GetIdentification(r *http.Request, args *struct{}, reply *struct{ ID string }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
 	reply.ID = s.GetSupervisorID()
 	return nil
 }
@@ -135,7 +210,36 @@ func (s *Supervisor) GetState(r *http.Request, args *struct{}, reply *struct{ St
 	// 1            RUNNING
 	// 0            RESTARTING
 	// -1           SHUTDOWN
+	// 3            STANDBY
+	// 4            DEGRADED
 	log.Debug("Get state")
+	if name, started := s.operations.Current(); name != "" {
+		reply.StateInfo.Operation = name
+		reply.StateInfo.Since = int(started.Unix())
+	}
+	// the state is reported while restarting or shutting down, the other
+	// methods return the SHUTDOWN_STATE fault
+	switch atomic.LoadInt32(&s.state) {
+	case supervisorRestarting:
+		reply.StateInfo.Statecode = supervisorRestarting
+		reply.StateInfo.Statename = "RESTARTING"
+		return nil
+	case supervisorShutdown:
+		reply.StateInfo.Statecode = supervisorShutdown
+		reply.StateInfo.Statename = "SHUTDOWN"
+		return nil
+	}
+	if err := s.getConfigError(); err != nil {
+		reply.StateInfo.Statecode = 4
+		reply.StateInfo.Statename = "DEGRADED"
+		reply.StateInfo.Error = err.Error()
+		return nil
+	}
+	if s.isStandby() {
+		reply.StateInfo.Statecode = 3
+		reply.StateInfo.Statename = "STANDBY"
+		return nil
+	}
 	reply.StateInfo.Statecode = 1
 	reply.StateInfo.Statename = "RUNNING"
 	return nil
@@ -150,28 +254,60 @@ func (s *Supervisor) GetPrograms() []string {
 
 // GetPID get the pid of supervisor
 func (s *Supervisor) GetPID(r *http.Request, args *struct{}, reply *struct{ Pid int }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
 	reply.Pid = os.Getpid()
 	return nil
 }
 
-// ReadLog read the log of supervisor
+// ReadLog read length bytes of the supervisord log from offset. If length is
+// 0, the log is read to the end, and a negative offset with 0 length reads the
+// last -offset bytes. NO_FILE is returned if supervisord doesn't log to a file
 func (s *Supervisor) ReadLog(r *http.Request, args *LogReadInfo, reply *struct{ Log string }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "read the supervisord log"); err != nil {
+		return err
+	}
+	if s.logger == nil {
+		return noFile("supervisord log")
+	}
 	data, err := s.logger.ReadLog(int64(args.Offset), int64(args.Length))
 	reply.Log = data
 	return err
 }
 
-// ClearLog clear the supervisor log
+// ClearLog clear the current supervisord log file, the rotated backups are
+// kept like python supervisor
 func (s *Supervisor) ClearLog(r *http.Request, args *struct{}, reply *struct{ Ret bool }) error {
-	err := s.logger.ClearAllLogFile()
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "clear the supervisord log"); err != nil {
+		return err
+	}
+	if s.logger == nil {
+		return noFile("supervisord log")
+	}
+	err := s.logger.ClearCurLogFile()
 	reply.Ret = err == nil
 	return err
 }
 
 // Shutdown shutdown the supervisor
 func (s *Supervisor) Shutdown(r *http.Request, args *struct{}, reply *struct{ Ret bool }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "shutdown"); err != nil {
+		return err
+	}
 	reply.Ret = true
 	log.Info("received rpc request to stop all processes & exit")
+	s.setState(supervisorShutdown)
+	s.runLifecycleHook(ShutdownHook)
 	s.procMgr.StopAllProcesses()
 	go func() {
 		time.Sleep(1 * time.Second)
@@ -180,20 +316,102 @@ func (s *Supervisor) Shutdown(r *http.Request, args *struct{}, reply *struct{ Re
 	return nil
 }
 
-// Restart restart the supervisor
-func (s *Supervisor) Restart(r *http.Request, args *struct{}, reply *struct{ Ret bool }) error {
+// check if the shutdown and the stop of several programs need a reason
+func (s *Supervisor) isReasonRequired() bool {
+	entry, ok := s.config.GetSupervisord()
+	return ok && entry.GetBool("require_reason", false)
+}
+
+// record who shut supervisord down or stopped the programs and why in the
+// log and with an OPERATOR_ACTION event
+func (s *Supervisor) recordAction(r *http.Request, action string, programs []string, reason string) {
+	userName := ""
+	if user := getAuthUser(r); user != nil {
+		userName = user.Name
+	}
+	log.WithFields(log.Fields{"action": action, "user": userName, "programs": strings.Join(programs, ","), "reason": reason}).Info("operator action")
+	events.EmitEvent(events.CreateOperatorActionEvent(action, userName, programs, reason))
+}
+
+// Restart restart the supervisor in place and return once it is serving
+// again. If DryRun is true, the plan to stop all the programs and start the
+// autostart ones is returned without restarting
+func (s *Supervisor) Restart(r *http.Request, args *struct{ DryRun bool }, reply *struct{ Ret interface{} }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "restart"); err != nil {
+		return err
+	}
+	if args != nil && args.DryRun {
+		reply.Ret = s.procMgr.PlanRestart()
+		return nil
+	}
+	// the programs are stopped by the restart, check the configuration first
+	// to keep them running if it can't be loaded
+	newConfig := config.NewConfig(s.config.GetConfigFile())
+	if _, err := newConfig.Load(); err != nil {
+		s.setConfigError(err)
+		return err
+	}
+	keepPrograms := false
+	if supervisordConf, ok := newConfig.GetSupervisord(); ok {
+		keepPrograms = supervisordConf.GetBool("keep_programs_on_restart", false)
+	}
+	if err := s.operations.Begin("restart"); err != nil {
+		return err
+	}
+	defer s.operations.End()
 	log.Info("Receive instruction to restart")
-	s.restarting = true
+	if err := s.restart(keepPrograms); err != nil {
+		return err
+	}
 	reply.Ret = true
 	return nil
 }
 
+// restart tear down the listeners, stop the programs unless keepPrograms is
+// true, then load the configuration again and start the listeners and the
+// autostart programs like a new supervisord
+func (s *Supervisor) restart(keepPrograms bool) error {
+	s.setState(supervisorRestarting)
+	defer s.setState(supervisorRunning)
+
+	s.xmlRPC.Stop()
+	if !keepPrograms {
+		s.procMgr.StopAllProcesses()
+	}
+	if _, _, _, err := s.Reload(); err != nil {
+		return err
+	}
+	s.runLifecycleHook(StartHook)
+	log.Info("supervisord is restarted")
+	return nil
+}
+
 // IsRestarting check if supervisor is in restarting state
 func (s *Supervisor) IsRestarting() bool {
-	return s.restarting
+	return atomic.LoadInt32(&s.state) == supervisorRestarting
+}
+
+// set the state of supervisord, the SHUTDOWN state is not left
+func (s *Supervisor) setState(state int32) {
+	atomic.StoreInt32(&s.state, state)
+}
+
+// checkState return the SHUTDOWN_STATE fault if supervisord is restarting or
+// shutting down, like python supervisor the RPC methods are refused in these states
+func (s *Supervisor) checkState() error {
+	if atomic.LoadInt32(&s.state) < supervisorRunning {
+		return faults.NewFault(faults.ShutdownState, "SHUTDOWN_STATE")
+	}
+	return nil
 }
 
 func getProcessInfo(proc *process.Process) *types.ProcessInfo {
+	stdoutLogfile, stderrLogfile := proc.GetLogfilePaths()
+	reliability := proc.GetReliability()
+	usage := proc.GetResourceUsage()
 	return &types.ProcessInfo{Name: proc.GetName(),
 		Group:         proc.GetGroup(),
 		Description:   proc.GetDescription(),
@@ -202,169 +420,634 @@ func getProcessInfo(proc *process.Process) *types.ProcessInfo {
 		Now:           int(time.Now().Unix()),
 		State:         int(proc.GetState()),
 		Statename:     proc.GetState().String(),
-		Spawnerr:      "",
+		Spawnerr:      proc.GetSpawnErr(),
 		Exitstatus:    proc.GetExitstatus(),
-		Logfile:       proc.GetStdoutLogfile(),
-		StdoutLogfile: proc.GetStdoutLogfile(),
-		StderrLogfile: proc.GetStderrLogfile(),
-		Pid:           proc.GetPid()}
+		Logfile:       stdoutLogfile,
+		StdoutLogfile: stdoutLogfile,
+		StderrLogfile: stderrLogfile,
+		Pid:           proc.GetPid(),
+		Labels:        strings.Join(proc.GetLabels(), ","),
+		Restarts:      reliability.Restarts,
+		Failures:      reliability.Failures,
+		Uptime:        int(reliability.Uptime),
+		CurrentUptime: int(proc.GetUptime().Seconds()),
+		Mtbf:          int(reliability.MTBF),
+		Cputime:       usage.CPUTime,
+		Rss:           int(usage.RSS / 1024)}
 
 }
 
 // GetAllProcessInfo get all the program informations managed by supervisor
 func (s *Supervisor) GetAllProcessInfo(r *http.Request, args *struct{}, reply *struct{ AllProcessInfo []types.ProcessInfo }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
 	reply.AllProcessInfo = make([]types.ProcessInfo, 0)
 	s.procMgr.ForEachProcess(func(proc *process.Process) {
-		procInfo := getProcessInfo(proc)
-		reply.AllProcessInfo = append(reply.AllProcessInfo, *procInfo)
+		if s.canAccess(r, proc) {
+			procInfo := getProcessInfo(proc)
+			reply.AllProcessInfo = append(reply.AllProcessInfo, *procInfo)
+		}
 	})
+	if s.checkAdmin(r, "") == nil {
+		reply.AllProcessInfo = append(reply.AllProcessInfo, s.getAllNodeProcessInfo()...)
+	}
 	types.SortProcessInfos(reply.AllProcessInfo)
 	return nil
 }
 
 // GetProcessInfo get the process information of one program
 func (s *Supervisor) GetProcessInfo(r *http.Request, args *struct{ Name string }, reply *struct{ ProcInfo types.ProcessInfo }) error {
-	log.Info("Get process info of: ", args.Name)
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkNameAccess(r, args.Name); err != nil {
+		return err
+	}
+	log.Debug("Get process info of: ", args.Name)
+	if name, node, ok := s.splitNodeName(args.Name); ok {
+		procInfo, err := getNodeProcessInfo(node, name)
+		reply.ProcInfo = procInfo
+		return err
+	}
 	proc := s.procMgr.Find(args.Name)
 	if proc == nil {
-		return fmt.Errorf("no process named %s", args.Name)
+		return badName(args.Name)
 	}
 
 	reply.ProcInfo = *getProcessInfo(proc)
 	return nil
 }
 
-// StartProcess start the given program
-func (s *Supervisor) StartProcess(r *http.Request, args *StartProcessArgs, reply *struct{ Success bool }) error {
-	procs := s.procMgr.FindMatch(args.Name)
+// GetProcessConfig get the resolved command, environment, user, directory and
+// log files used when the program was spawned
+func (s *Supervisor) GetProcessConfig(r *http.Request, args *struct{ Name string }, reply *struct{ Config types.ProcessConfig }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkNameAccess(r, args.Name); err != nil {
+		return err
+	}
+	proc := s.procMgr.Find(args.Name)
+	if proc == nil {
+		return badName(args.Name)
+	}
+	config, err := getProcessConfig(proc)
+	if err != nil {
+		return err
+	}
+	reply.Config = config
+	return nil
+}
+
+func getProcessConfig(proc *process.Process) (types.ProcessConfig, error) {
+	spawnConfig, err := proc.GetSpawnConfig()
+	if err != nil {
+		return types.ProcessConfig{}, err
+	}
+	spawnTime := 0
+	if spawnConfig.Spawned {
+		spawnTime = int(spawnConfig.SpawnTime.Unix())
+	}
+	return types.ProcessConfig{Name: proc.GetName(),
+		Group:          proc.GetGroup(),
+		Spawned:        spawnConfig.Spawned,
+		SpawnTime:      spawnTime,
+		Command:        spawnConfig.Command,
+		Environment:    spawnConfig.Environment,
+		User:           spawnConfig.User,
+		Directory:      spawnConfig.Directory,
+		StdoutLogfile:  spawnConfig.StdoutLogfile,
+		StderrLogfile:  spawnConfig.StderrLogfile,
+		RedirectStderr: spawnConfig.RedirectStderr}, nil
+}
+
+// GetAllConfigInfo get the configuration summary of all the configured
+// programs, Inuse is true if a process of the program is managed. The programs
+// of the configuration file which are not in service (like the groups removed
+// by supervisor.removeProcessGroup) follow with Inuse false
+func (s *Supervisor) GetAllConfigInfo(r *http.Request, args *struct{}, reply *struct{ AllConfigInfo []types.ConfigInfo }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	reply.AllConfigInfo = make([]types.ConfigInfo, 0)
+	s.appendConfigInfo(r, s.config, &reply.AllConfigInfo, func(name string) bool { return true })
+	if cfg, err := s.readConfigFile(); err == nil {
+		s.appendConfigInfo(r, cfg, &reply.AllConfigInfo, func(name string) bool { return s.config.GetProgram(name) == nil })
+	}
+	return nil
+}
+
+// append the configuration summary of the programs of the configuration
+// selected by the filter
+func (s *Supervisor) appendConfigInfo(r *http.Request, cfg *config.Config, infos *[]types.ConfigInfo, filter func(name string) bool) {
+	groupPrios := make(map[string]int)
+	for _, group := range cfg.GetGroups() {
+		groupPrios[group.GetGroupName()] = group.GetInt("priority", 999)
+	}
+	for _, entry := range cfg.GetPrograms() {
+		name := entry.GetProgramName()
+		if !filter(name) || !s.canAccessProgram(r, name) {
+			continue
+		}
+		groupPrio, ok := groupPrios[entry.Group]
+		if !ok {
+			groupPrio = entry.GetInt("priority", 999)
+		}
+		*infos = append(*infos, getConfigInfo(entry, groupPrio, s.procMgr.Find(name) != nil))
+	}
+}
+
+func getConfigInfo(entry *config.Entry, groupPrio int, inuse bool) types.ConfigInfo {
+	exitcodes := make([]int, 0)
+	for _, code := range strings.Split(entry.GetString("exitcodes", "0,2"), ",") {
+		if i, err := strconv.Atoi(strings.TrimSpace(code)); err == nil {
+			exitcodes = append(exitcodes, i)
+		}
+	}
+	// the number of the first stop signal
+	stopsignal := 0
+	if names := strings.Fields(entry.GetString("stopsignal", "TERM")); len(names) > 0 {
+		if sig, err := signals.ToSignal(names[0]); err == nil {
+			if sig, ok := sig.(syscall.Signal); ok {
+				stopsignal = int(sig)
+			}
+		}
+	}
+	stopasgroup := entry.GetBool("stopasgroup", false)
+	return types.ConfigInfo{Name: entry.GetProgramName(),
+		Group:          entry.Group,
+		Inuse:          inuse,
+		Autostart:      entry.GetString("autostart", "true") == "true",
+		Autorestart:    entry.GetString("autorestart", "unexpected"),
+		Command:        entry.GetString("command", ""),
+		Directory:      entry.GetString("directory", ""),
+		Exitcodes:      exitcodes,
+		GroupPrio:      groupPrio,
+		ProcessPrio:    entry.GetInt("priority", 999),
+		Startsecs:      entry.GetInt("startsecs", 1),
+		Startretries:   entry.GetInt("startretries", 3),
+		Stopsignal:     stopsignal,
+		Stopwaitsecs:   entry.GetInt("stopwaitsecs", 10),
+		Stopasgroup:    stopasgroup,
+		Killasgroup:    entry.GetBool("killasgroup", stopasgroup),
+		RedirectStderr: entry.GetBool("redirect_stderr", false),
+		StdoutLogfile:  entry.GetString("stdout_logfile", ""),
+		StderrLogfile:  entry.GetString("stderr_logfile", "")}
+}
+
+// StartProcess start the given program. If DryRun is true, the action plan
+// ([]types.ActionStep) is returned instead of success flag. The KEY=VALUE
+// overrides of Env are added to the environment of this start only and are
+// recorded with an OPERATOR_ACTION event
+func (s *Supervisor) StartProcess(r *http.Request, args *StartProcessArgs, reply *struct{ Success interface{} }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkNameAccess(r, args.Name); err != nil {
+		return err
+	}
+	if name, node, ok := s.splitNodeName(args.Name); ok {
+		if args.DryRun {
+			return errNodeDryRun
+		}
+		if len(args.Env) > 0 {
+			return faults.NewFault(faults.BadArguments, "BAD_ARGUMENTS: the environment overrides are not supported by the child nodes")
+		}
+		err := changeNodeProcessState(node, "start", name)
+		reply.Success = err == nil
+		return err
+	}
+	if s.isStandby() && !args.DryRun {
+		return errStandby
+	}
+	procs := s.findMatch(args.Name)
 
 	if len(procs) <= 0 {
-		return fmt.Errorf("fail to find process %s", args.Name)
+		return badName(args.Name)
+	}
+	if args.DryRun {
+		reply.Success = s.procMgr.PlanStart(procs)
+		return nil
+	}
+	if err := checkEnvOverrides(r, args.Env); err != nil {
+		return err
+	}
+	// like python supervisor, a single program must not be started twice
+	single := !strings.HasSuffix(args.Name, ":*")
+	if single && isRunningState(procs[0].GetState()) {
+		return faults.NewFault(faults.AlreadyStated, "ALREADY_STARTED: "+args.Name)
 	}
+	if len(args.Env) > 0 {
+		names := make([]string, 0, len(procs))
+		for _, proc := range procs {
+			names = append(names, proc.GetName())
+		}
+		s.recordAction(r, "start-with-env", names, strings.Join(envKeys(args.Env), " "))
+	}
+	ctx, cancel := s.operationContext(r, args.Timeout)
+	defer cancel()
 	for _, proc := range procs {
-		proc.Start(args.Wait)
+		if err := proc.StartContextEnv(ctx, args.Wait, args.Env); err != nil {
+			return operationFault("start "+args.Name, err)
+		}
+	}
+	if single && args.Wait && procs[0].GetState() == process.Fatal {
+		return faults.NewFault(faults.SpawnError, "SPAWN_ERROR: "+args.Name)
 	}
 	reply.Success = true
 	return nil
 }
 
-// StartAllProcesses start all the programs
-func (s *Supervisor) StartAllProcesses(r *http.Request, args *struct {
-	Wait bool `default:"true"`
-}, reply *struct{ RPCTaskResults []RPCTaskResult }) error {
+// the variables changing the libraries loaded or the commands looked up by
+// the programs, only the admin can override them
+var protectedEnvKeys = map[string]bool{
+	"PATH":              true,
+	"IFS":               true,
+	"BASH_ENV":          true,
+	"ENV":               true,
+	"PYTHONPATH":        true,
+	"PYTHONSTARTUP":     true,
+	"PERL5LIB":          true,
+	"PERL5OPT":          true,
+	"RUBYLIB":           true,
+	"RUBYOPT":           true,
+	"NODE_OPTIONS":      true,
+	"JAVA_TOOL_OPTIONS": true,
+}
+
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// check if the environment variable is only overridden by the admin
+func isProtectedEnvKey(key string) bool {
+	upper := strings.ToUpper(key)
+	return protectedEnvKeys[upper] || strings.HasPrefix(upper, "LD_") || strings.HasPrefix(upper, "DYLD_")
+}
+
+// check the environment overrides are KEY=VALUE with an identifier as KEY,
+// the loader variables and PATH are only overridden by the admin
+func checkEnvOverrides(r *http.Request, env []string) error {
+	for _, kv := range env {
+		key := strings.SplitN(kv, "=", 2)[0]
+		if key == kv || !envKeyPattern.MatchString(key) {
+			return faults.NewFault(faults.BadArguments, fmt.Sprintf("BAD_ARGUMENTS: the environment override of %q is not KEY=VALUE with an identifier as KEY", key))
+		}
+		if user := getAuthUser(r); user != nil && !user.Admin && isProtectedEnvKey(key) {
+			return notAuthorized(user, "override the environment variable "+key)
+		}
+	}
+	return nil
+}
+
+// get the keys of the KEY=VALUE environment overrides, the values are not
+// recorded because they may be secrets
+func envKeys(env []string) []string {
+	keys := make([]string, 0, len(env))
+	for _, kv := range env {
+		if pos := strings.Index(kv, "="); pos >= 0 {
+			kv = kv[0:pos]
+		}
+		keys = append(keys, kv)
+	}
+	return keys
+}
+
+// StartAllProcesses start all the programs. If DryRun is true, the action
+// plan ([]types.ActionStep) is returned instead of the results
+func (s *Supervisor) StartAllProcesses(r *http.Request, args *StartAllProcessesArgs, reply *struct{ RPCTaskResults interface{} }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "start all processes"); err != nil {
+		return err
+	}
+	if args.DryRun {
+		reply.RPCTaskResults = s.procMgr.PlanStart(s.getAllProcesses())
+		return nil
+	}
+	if s.isStandby() {
+		return errStandby
+	}
+	if err := s.operations.Begin("startAllProcesses"); err != nil {
+		return err
+	}
+	defer s.operations.End()
+	ctx, cancel := s.operationContext(r, args.Timeout)
+	defer cancel()
 
 	finishedProcCh := make(chan *process.Process)
 
 	n := s.procMgr.AsyncForEachProcess(func(proc *process.Process) {
-		proc.Start(args.Wait)
+		proc.StartContext(ctx, args.Wait)
 	}, finishedProcCh)
 
-	for i := 0; i < n; i++ {
-		proc, ok := <-finishedProcCh
-		if ok {
-			processInfo := *getProcessInfo(proc)
-			reply.RPCTaskResults = append(reply.RPCTaskResults, RPCTaskResult{
-				Name:        processInfo.Name,
-				Group:       processInfo.Group,
-				Status:      faults.Success,
-				Description: "OK",
-			})
-		}
+	procs, err := collectFinishedProcesses(ctx, finishedProcCh, n)
+	if err != nil {
+		return operationFault("startAllProcesses", err)
+	}
+	results := make([]RPCTaskResult, 0)
+	for _, proc := range procs {
+		processInfo := *getProcessInfo(proc)
+		results = append(results, RPCTaskResult{
+			Name:        processInfo.Name,
+			Group:       processInfo.Group,
+			Status:      faults.Success,
+			Description: "OK",
+		})
 	}
+	reply.RPCTaskResults = results
 	return nil
 }
 
-// StartProcessGroup start all the processes in one group
-func (s *Supervisor) StartProcessGroup(r *http.Request, args *StartProcessArgs, reply *struct{ AllProcessInfo []types.ProcessInfo }) error {
+// StartProcessGroup start all the processes in one group. If DryRun is true,
+// the action plan ([]types.ActionStep) is returned instead of the process information
+func (s *Supervisor) StartProcessGroup(r *http.Request, args *StartProcessArgs, reply *struct{ AllProcessInfo interface{} }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkGroupAccess(r, args.Name); err != nil {
+		return err
+	}
 	log.WithFields(log.Fields{"group": args.Name}).Info("start process group")
+	if group, node, ok := s.splitNodeName(args.Name); ok {
+		if args.DryRun {
+			return errNodeDryRun
+		}
+		procInfos, err := changeNodeGroupState(node, "start", group)
+		reply.AllProcessInfo = procInfos
+		return err
+	}
+	if len(s.getGroupProcesses(args.Name)) == 0 {
+		return badName(args.Name)
+	}
+	inGroup := s.groupMatcher(args.Name)
+	if args.DryRun {
+		reply.AllProcessInfo = s.procMgr.PlanStart(s.getGroupProcesses(args.Name))
+		return nil
+	}
+	if s.isStandby() {
+		return errStandby
+	}
+	ctx, cancel := s.operationContext(r, args.Timeout)
+	defer cancel()
 	finishedProcCh := make(chan *process.Process)
 
 	n := s.procMgr.AsyncForEachProcess(func(proc *process.Process) {
-		if proc.GetGroup() == args.Name {
-			proc.Start(args.Wait)
+		if inGroup(proc) {
+			proc.StartContext(ctx, args.Wait)
 		}
 	}, finishedProcCh)
 
-	for i := 0; i < n; i++ {
-		proc, ok := <-finishedProcCh
-		if ok && proc.GetGroup() == args.Name {
-			reply.AllProcessInfo = append(reply.AllProcessInfo, *getProcessInfo(proc))
+	procs, err := collectFinishedProcesses(ctx, finishedProcCh, n)
+	if err != nil {
+		return operationFault("start group "+args.Name, err)
+	}
+	procInfos := make([]types.ProcessInfo, 0)
+	for _, proc := range procs {
+		if inGroup(proc) {
+			procInfos = append(procInfos, *getProcessInfo(proc))
 		}
 	}
+	reply.AllProcessInfo = procInfos
 
 	return nil
 }
 
-// StopProcess stop given program
-func (s *Supervisor) StopProcess(r *http.Request, args *StartProcessArgs, reply *struct{ Success bool }) error {
+// StopProcess stop given program. If DryRun is true, the action plan
+// ([]types.ActionStep) is returned instead of success flag
+func (s *Supervisor) StopProcess(r *http.Request, args *StartProcessArgs, reply *struct{ Success interface{} }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkNameAccess(r, args.Name); err != nil {
+		return err
+	}
 	log.WithFields(log.Fields{"program": args.Name}).Info("stop process")
-	procs := s.procMgr.FindMatch(args.Name)
+	if name, node, ok := s.splitNodeName(args.Name); ok {
+		if args.DryRun {
+			return errNodeDryRun
+		}
+		err := changeNodeProcessState(node, "stop", name)
+		reply.Success = err == nil
+		return err
+	}
+	procs := s.findMatch(args.Name)
 	if len(procs) <= 0 {
-		return fmt.Errorf("fail to find process %s", args.Name)
+		return badName(args.Name)
+	}
+	if args.DryRun {
+		reply.Success = s.procMgr.PlanStop(procs)
+		return nil
+	}
+	if err := s.checkLocked(r, args.Force, procs...); err != nil {
+		return err
 	}
+	if !strings.HasSuffix(args.Name, ":*") && !isRunningState(procs[0].GetState()) {
+		return notRunning(args.Name)
+	}
+	ctx, cancel := s.operationContext(r, args.Timeout)
+	defer cancel()
 	for _, proc := range procs {
-		proc.Stop(args.Wait)
+		if err := proc.StopContext(ctx, args.Wait); err != nil {
+			return operationFault("stop "+args.Name, err)
+		}
 	}
 	reply.Success = true
 	return nil
 }
 
-// StopProcessGroup stop all processes in one group
-func (s *Supervisor) StopProcessGroup(r *http.Request, args *StartProcessArgs, reply *struct{ AllProcessInfo []types.ProcessInfo }) error {
+// StopProcessGroup stop all processes in one group. If DryRun is true, the
+// action plan ([]types.ActionStep) is returned instead of the process information
+func (s *Supervisor) StopProcessGroup(r *http.Request, args *StartProcessArgs, reply *struct{ AllProcessInfo interface{} }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkGroupAccess(r, args.Name); err != nil {
+		return err
+	}
 	log.WithFields(log.Fields{"group": args.Name}).Info("stop process group")
+	if group, node, ok := s.splitNodeName(args.Name); ok {
+		if args.DryRun {
+			return errNodeDryRun
+		}
+		procInfos, err := changeNodeGroupState(node, "stop", group)
+		reply.AllProcessInfo = procInfos
+		return err
+	}
+	if len(s.getGroupProcesses(args.Name)) == 0 {
+		return badName(args.Name)
+	}
+	inGroup := s.groupMatcher(args.Name)
+	if args.DryRun {
+		reply.AllProcessInfo = s.procMgr.PlanStop(s.getGroupProcesses(args.Name))
+		return nil
+	}
+	if err := s.checkLocked(r, args.Force, s.getGroupProcesses(args.Name)...); err != nil {
+		return err
+	}
+	ctx, cancel := s.operationContext(r, args.Timeout)
+	defer cancel()
 	finishedProcCh := make(chan *process.Process)
 	n := s.procMgr.AsyncForEachProcess(func(proc *process.Process) {
-		if proc.GetGroup() == args.Name {
-			proc.Stop(args.Wait)
+		if inGroup(proc) {
+			proc.StopContext(ctx, args.Wait)
 		}
 	}, finishedProcCh)
 
-	for i := 0; i < n; i++ {
-		proc, ok := <-finishedProcCh
-		if ok && proc.GetGroup() == args.Name {
-			reply.AllProcessInfo = append(reply.AllProcessInfo, *getProcessInfo(proc))
+	procs, err := collectFinishedProcesses(ctx, finishedProcCh, n)
+	if err != nil {
+		return operationFault("stop group "+args.Name, err)
+	}
+	procInfos := make([]types.ProcessInfo, 0)
+	for _, proc := range procs {
+		if inGroup(proc) {
+			procInfos = append(procInfos, *getProcessInfo(proc))
 		}
 	}
+	reply.AllProcessInfo = procInfos
 	return nil
 }
 
-// StopAllProcesses stop all programs managed by supervisor
-func (s *Supervisor) StopAllProcesses(r *http.Request, args *struct {
-	Wait bool `default:"true"`
-}, reply *struct{ RPCTaskResults []RPCTaskResult }) error {
+// StopAllProcesses stop all programs managed by supervisor. If DryRun is true,
+// the action plan ([]types.ActionStep) is returned instead of the results
+func (s *Supervisor) StopAllProcesses(r *http.Request, args *StartAllProcessesArgs, reply *struct{ RPCTaskResults interface{} }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "stop all processes"); err != nil {
+		return err
+	}
+	if args.DryRun {
+		reply.RPCTaskResults = s.procMgr.PlanStop(s.getAllProcesses())
+		return nil
+	}
+	if err := s.checkLocked(r, args.Force, s.getAllProcesses()...); err != nil {
+		return err
+	}
+	if err := s.operations.Begin("stopAllProcesses"); err != nil {
+		return err
+	}
+	defer s.operations.End()
+	ctx, cancel := s.operationContext(r, args.Timeout)
+	defer cancel()
+
 	finishedProcCh := make(chan *process.Process)
 
 	n := s.procMgr.AsyncForEachProcess(func(proc *process.Process) {
-		proc.Stop(args.Wait)
+		proc.StopContext(ctx, args.Wait)
 	}, finishedProcCh)
 
-	for i := 0; i < n; i++ {
-		proc, ok := <-finishedProcCh
-		if ok {
-			processInfo := *getProcessInfo(proc)
-			reply.RPCTaskResults = append(reply.RPCTaskResults, RPCTaskResult{
-				Name:        processInfo.Name,
-				Group:       processInfo.Group,
-				Status:      faults.Success,
-				Description: "OK",
-			})
-		}
+	procs, err := collectFinishedProcesses(ctx, finishedProcCh, n)
+	if err != nil {
+		return operationFault("stopAllProcesses", err)
+	}
+	results := make([]RPCTaskResult, 0)
+	for _, proc := range procs {
+		processInfo := *getProcessInfo(proc)
+		results = append(results, RPCTaskResult{
+			Name:        processInfo.Name,
+			Group:       processInfo.Group,
+			Status:      faults.Success,
+			Description: "OK",
+		})
 	}
+	reply.RPCTaskResults = results
 	return nil
 }
 
+// get all the processes
+func (s *Supervisor) getAllProcesses() []*process.Process {
+	procs := make([]*process.Process, 0)
+	s.procMgr.ForEachProcess(func(proc *process.Process) {
+		procs = append(procs, proc)
+	})
+	return procs
+}
+
+// get the processes in the group
+func (s *Supervisor) getGroupProcesses(group string) []*process.Process {
+	inGroup := s.groupMatcher(group)
+	procs := make([]*process.Process, 0)
+	s.procMgr.ForEachProcess(func(proc *process.Process) {
+		if inGroup(proc) {
+			procs = append(procs, proc)
+		}
+	})
+	return procs
+}
+
+// groupMatcher get the function checking if a process belongs to the group or
+// to one of its nested groups
+func (s *Supervisor) groupMatcher(group string) func(proc *process.Process) bool {
+	groups := make(map[string]bool)
+	for _, g := range s.config.ProgramGroup.ExpandGroup(group) {
+		groups[g] = true
+	}
+	return func(proc *process.Process) bool {
+		return groups[proc.GetGroup()]
+	}
+}
+
+// findMatch find the processes by name like process.Manager.FindMatch, the
+// name "group:*" includes the processes of the nested groups
+func (s *Supervisor) findMatch(name string) []*process.Process {
+	if strings.HasSuffix(name, ":*") {
+		if procs := s.getGroupProcesses(strings.TrimSuffix(name, ":*")); len(procs) > 0 {
+			return procs
+		}
+	}
+	return s.procMgr.FindMatch(name)
+}
+
+// check if the program is started, like the RUNNING_STATES of python supervisor
+func isRunningState(state process.State) bool {
+	return state == process.Spawning || state == process.Starting || state == process.Running || state == process.Backoff
+}
+
+// the faults with the same codes and descriptions as python supervisor
+func badName(name string) error {
+	return faults.NewFault(faults.BadName, "BAD_NAME: "+name)
+}
+
+func badSignal(signal string) error {
+	return faults.NewFault(faults.BadSignal, "BAD_SIGNAL: "+signal)
+}
+
+func noFile(name string) error {
+	return faults.NewFault(faults.NoFile, "NO_FILE: "+name)
+}
+
+func notRunning(name string) error {
+	return faults.NewFault(faults.NotRunning, "NOT_RUNNING: "+name)
+}
+
 // SignalProcess send a signal to running program
 func (s *Supervisor) SignalProcess(r *http.Request, args *types.ProcessSignal, reply *struct{ Success bool }) error {
-	procs := s.procMgr.FindMatch(args.Name)
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkNameAccess(r, args.Name); err != nil {
+		return err
+	}
+	if name, node, ok := s.splitNodeName(args.Name); ok {
+		err := signalNodeProcess(node, args.Signal, name)
+		reply.Success = err == nil
+		return err
+	}
+	procs := s.findMatch(args.Name)
 	if len(procs) <= 0 {
 		reply.Success = false
-		return fmt.Errorf("No process named %s", args.Name)
+		return badName(args.Name)
 	}
 	sig, err := signals.ToSignal(args.Signal)
-	if err == nil {
-		for _, proc := range procs {
-			proc.Signal(sig, false)
-		}
+	if err != nil {
+		return badSignal(args.Signal)
+	}
+	if !strings.HasSuffix(args.Name, ":*") && !isRunningState(procs[0].GetState()) {
+		return notRunning(args.Name)
+	}
+	for _, proc := range procs {
+		proc.Signal(sig, false)
 	}
 	reply.Success = true
 	return nil
@@ -372,17 +1055,28 @@ func (s *Supervisor) SignalProcess(r *http.Request, args *types.ProcessSignal, r
 
 // SignalProcessGroup send signal to all processes in one group
 func (s *Supervisor) SignalProcessGroup(r *http.Request, args *types.ProcessSignal, reply *struct{ AllProcessInfo []types.ProcessInfo }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkGroupAccess(r, args.Name); err != nil {
+		return err
+	}
+	if len(s.getGroupProcesses(args.Name)) == 0 {
+		return badName(args.Name)
+	}
+	inGroup := s.groupMatcher(args.Name)
+	sig, err := signals.ToSignal(args.Signal)
+	if err != nil {
+		return badSignal(args.Signal)
+	}
 	s.procMgr.ForEachProcess(func(proc *process.Process) {
-		if proc.GetGroup() == args.Name {
-			sig, err := signals.ToSignal(args.Signal)
-			if err == nil {
-				proc.Signal(sig, false)
-			}
+		if inGroup(proc) {
+			proc.Signal(sig, false)
 		}
 	})
 
 	s.procMgr.ForEachProcess(func(proc *process.Process) {
-		if proc.GetGroup() == args.Name {
+		if inGroup(proc) {
 			reply.AllProcessInfo = append(reply.AllProcessInfo, *getProcessInfo(proc))
 		}
 	})
@@ -391,11 +1085,18 @@ func (s *Supervisor) SignalProcessGroup(r *http.Request, args *types.ProcessSign
 
 // SignalAllProcesses send signal to all the processes in the supervisor
 func (s *Supervisor) SignalAllProcesses(r *http.Request, args *types.ProcessSignal, reply *struct{ AllProcessInfo []types.ProcessInfo }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "signal all processes"); err != nil {
+		return err
+	}
+	sig, err := signals.ToSignal(args.Signal)
+	if err != nil {
+		return badSignal(args.Signal)
+	}
 	s.procMgr.ForEachProcess(func(proc *process.Process) {
-		sig, err := signals.ToSignal(args.Signal)
-		if err == nil {
-			proc.Signal(sig, false)
-		}
+		proc.Signal(sig, false)
 	})
 	s.procMgr.ForEachProcess(func(proc *process.Process) {
 		reply.AllProcessInfo = append(reply.AllProcessInfo, *getProcessInfo(proc))
@@ -405,14 +1106,20 @@ func (s *Supervisor) SignalAllProcesses(r *http.Request, args *types.ProcessSign
 
 // SendProcessStdin send data to program through stdin
 func (s *Supervisor) SendProcessStdin(r *http.Request, args *ProcessStdin, reply *struct{ Success bool }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkNameAccess(r, args.Name); err != nil {
+		return err
+	}
 	proc := s.procMgr.Find(args.Name)
 	if proc == nil {
 		log.WithFields(log.Fields{"program": args.Name}).Error("program does not exist")
-		return fmt.Errorf("NOT_RUNNING")
+		return badName(args.Name)
 	}
 	if proc.GetState() != process.Running {
 		log.WithFields(log.Fields{"program": args.Name}).Error("program does not run")
-		return fmt.Errorf("NOT_RUNNING")
+		return notRunning(args.Name)
 	}
 	err := proc.SendProcessStdin(args.Chars)
 	if err == nil {
@@ -425,6 +1132,12 @@ func (s *Supervisor) SendProcessStdin(r *http.Request, args *ProcessStdin, reply
 
 // SendRemoteCommEvent emit a remote communication event
 func (s *Supervisor) SendRemoteCommEvent(r *http.Request, args *RemoteCommEvent, reply *struct{ Success bool }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "send remote communication event"); err != nil {
+		return err
+	}
 	events.EmitEvent(events.NewRemoteCommunicationEvent(args.Type, args.Data))
 	reply.Success = true
 	return nil
@@ -439,6 +1152,12 @@ func (s *Supervisor) Reload() (addedGroup []string, changedGroup []string, remov
 	prevProgGroup := s.config.ProgramGroup.Clone()
 
 	loadedPrograms, err := s.config.Load()
+	if err != nil {
+		// keep the programs of the previous configuration
+		s.setConfigError(err)
+		return nil, nil, nil, err
+	}
+	s.setConfigError(nil)
 
 	if checkErr := s.checkRequiredResources(); checkErr != nil {
 		log.Error(checkErr)
@@ -447,10 +1166,15 @@ func (s *Supervisor) Reload() (addedGroup []string, changedGroup []string, remov
 	}
 	if err == nil {
 		s.setSupervisordInfo()
+		s.setBackgroundSubsystems()
 		s.startEventListeners()
 		s.createPrograms(prevPrograms)
+		s.startEventScripts()
 		s.startHTTPServer()
 		s.startAutoStartPrograms()
+		s.leaks.record()
+		s.watchUpdate()
+		s.resetResourceLimits()
 	}
 	removedPrograms := util.Sub(prevPrograms, loadedPrograms)
 	for _, removedProg := range removedPrograms {
@@ -467,17 +1191,46 @@ func (s *Supervisor) Reload() (addedGroup []string, changedGroup []string, remov
 
 }
 
-// WaitForExit wait the superisor to exit
-func (s *Supervisor) WaitForExit() {
-	for {
-		if s.IsRestarting() {
-			s.procMgr.StopAllProcesses()
-			break
+// set the error of the configuration load, supervisord is DEGRADED until the
+// configuration is loaded successfully
+func (s *Supervisor) setConfigError(err error) {
+	s.configErrLock.Lock()
+	defer s.configErrLock.Unlock()
+
+	if err != nil && (s.configErr == nil || s.configErr.Error() != err.Error()) {
+		fields := log.Fields{"file": s.config.GetConfigFile(), log.ErrorKey: err}
+		var sectionErr *config.SectionError
+		if errors.As(err, &sectionErr) {
+			fields["section"] = sectionErr.Section
 		}
-		time.Sleep(10 * time.Second)
+		log.WithFields(fields).Error("fail to load the configuration, supervisord is DEGRADED and the running programs are kept")
+	} else if err == nil && s.configErr != nil {
+		log.Info("the configuration is loaded, supervisord is not DEGRADED any more")
+	}
+	s.configErr = err
+}
+
+func (s *Supervisor) getConfigError() error {
+	s.configErrLock.Lock()
+	defer s.configErrLock.Unlock()
+	return s.configErr
+}
+
+// reloadUntilLoaded load the configuration periodically until it is loaded, if
+// supervisord is started with a configuration which can't be loaded
+func (s *Supervisor) reloadUntilLoaded(interval time.Duration) {
+	for !s.IsRestarting() && s.getConfigError() != nil {
+		time.Sleep(interval)
+		s.Reload()
 	}
 }
 
+// WaitForExit wait the superisor to exit, supervisord exits on shutdown
+// and the restart is done in place
+func (s *Supervisor) WaitForExit() {
+	select {}
+}
+
 func (s *Supervisor) createPrograms(prevPrograms []string) {
 
 	programs := s.config.GetProgramNames()
@@ -491,7 +1244,40 @@ func (s *Supervisor) createPrograms(prevPrograms []string) {
 }
 
 func (s *Supervisor) startAutoStartPrograms() {
-	s.procMgr.StartAutoStartPrograms()
+	if s.leader == nil {
+		s.leader = s.createLeaderElection()
+		if s.leader != nil {
+			process.SetStandbyCheck(s.isStandby)
+			s.leader.Run(s.procMgr.StartAutoStartPrograms)
+			return
+		}
+	}
+	if !s.isStandby() {
+		s.procMgr.StartAutoStartPrograms()
+	}
+}
+
+// create the leader election if "ha_lock_file" is configured in the supervisord section
+func (s *Supervisor) createLeaderElection() *LeaderElection {
+	supervisordConf, ok := s.config.GetSupervisord()
+	if !ok {
+		return nil
+	}
+	env := config.NewStringExpression("here", s.config.GetConfigFileDir())
+	lockFile, err := env.Eval(supervisordConf.GetString("ha_lock_file", ""))
+	if err != nil || lockFile == "" {
+		return nil
+	}
+	interval := supervisordConf.GetInt("ha_lock_interval", 5)
+	if interval <= 0 {
+		interval = 5
+	}
+	return NewLeaderElection(lockFile, time.Duration(interval)*time.Second)
+}
+
+// check if this supervisord is the standby in active/standby mode
+func (s *Supervisor) isStandby() bool {
+	return s.leader != nil && !s.leader.IsLeader()
 }
 
 func (s *Supervisor) startEventListeners() {
@@ -506,18 +1292,50 @@ func (s *Supervisor) startEventListeners() {
 	}
 }
 
+// load the lua scripts configured by "event_script" in supervisord section, the
+// scripts loaded before are stopped
+func (s *Supervisor) startEventScripts() {
+	for _, engine := range s.eventScripts {
+		engine.Stop()
+	}
+	s.eventScripts = nil
+	supervisordConf, ok := s.config.GetSupervisord()
+	if !ok {
+		return
+	}
+	env := config.NewStringExpression("here", s.config.GetConfigFileDir())
+	for _, file := range strings.Split(supervisordConf.GetString("event_script", ""), ",") {
+		file, err := env.Eval(strings.TrimSpace(file))
+		if err != nil || file == "" {
+			continue
+		}
+		engine, err := script.NewEngine(file, s.procMgr)
+		if err != nil {
+			log.WithFields(log.Fields{"script": file, log.ErrorKey: err}).Error("fail to load event script")
+			continue
+		}
+		log.WithFields(log.Fields{"script": file}).Info("load event script")
+		engine.Start()
+		s.eventScripts = append(s.eventScripts, engine)
+	}
+}
+
 func (s *Supervisor) startHTTPServer() {
 	httpServerConfig, ok := s.config.GetInetHTTPServer()
 	s.xmlRPC.Stop()
-	if ok {
-		addr := httpServerConfig.GetString("port", "")
-		if addr != "" {
+	if ok && !inetHTTPServerSupported {
+		log.Warn("the inet_http_server is not supported by the supervisord built with the nohttp tag, use the unix_http_server")
+	} else if ok && httpServerConfig.GetString("port", "") != "" {
+		if options, err := getInetListenOptions(httpServerConfig); err != nil {
+			log.WithFields(log.Fields{log.ErrorKey: err}).Error("fail to start the inet_http_server")
+		} else {
 			cond := sync.NewCond(&sync.Mutex{})
 			cond.L.Lock()
 			defer cond.L.Unlock()
 			go s.xmlRPC.StartInetHTTPServer(httpServerConfig.GetString("username", ""),
 				httpServerConfig.GetString("password", ""),
-				addr,
+				time.Duration(httpServerConfig.GetInt("session_timeout", 0))*time.Second,
+				options,
 				s,
 				func() {
 					cond.L.Lock()
@@ -538,6 +1356,7 @@ func (s *Supervisor) startHTTPServer() {
 			defer cond.L.Unlock()
 			go s.xmlRPC.StartUnixHTTPServer(httpServerConfig.GetString("username", ""),
 				httpServerConfig.GetString("password", ""),
+				time.Duration(httpServerConfig.GetInt("session_timeout", 0))*time.Second,
 				sockFile,
 				s,
 				func() {
@@ -551,12 +1370,91 @@ func (s *Supervisor) startHTTPServer() {
 
 }
 
+// start the zombie reaper and enable the file change monitor of the programs unless
+// they are disabled by reap_zombies=false or monitor_file_changes=false, for example
+// if supervisord runs in a container with another init system
+func (s *Supervisor) setBackgroundSubsystems() {
+	reapZombies := true
+	monitorFileChanges := true
+	if supervisordConf, ok := s.config.GetSupervisord(); ok {
+		reapZombies = supervisordConf.GetBool("reap_zombies", true)
+		monitorFileChanges = supervisordConf.GetBool("monitor_file_changes", true)
+	}
+	if reapZombies {
+		ReapZombie()
+	} else {
+		log.Info("the zombie reaper is disabled by reap_zombies")
+	}
+	process.SetFileChangeMonitorEnabled(monitorFileChanges)
+	s.maintenance.load(s.config)
+	s.throttler.load(s)
+	s.statusExporter.load(s)
+	s.statsd.load(s)
+	s.loadJournal()
+	if s.watchdog == nil {
+		s.watchdog = s.createWatchdog()
+		if s.watchdog != nil {
+			s.watchdog.Run()
+		}
+	}
+}
+
+// create the watchdog if "watchdog_timeout_secs" is configured in the supervisord section
+func (s *Supervisor) createWatchdog() *Watchdog {
+	supervisordConf, ok := s.config.GetSupervisord()
+	if !ok {
+		return nil
+	}
+	timeout := supervisordConf.GetInt("watchdog_timeout_secs", 0)
+	if timeout <= 0 {
+		return nil
+	}
+	interval := supervisordConf.GetInt("watchdog_interval_secs", 10)
+	if interval <= 0 {
+		interval = 10
+	}
+	wd := NewWatchdog(time.Duration(interval)*time.Second, time.Duration(timeout)*time.Second, supervisordConf.GetBool("watchdog_exit", false))
+	wd.AddProbe("process manager", func() { s.procMgr.ForEachProcess(func(proc *process.Process) {}) })
+	client := s.xmlRPC.NewInMemoryClient(s)
+	wd.AddProbe("rpc handler", func() { client.GetState() })
+	return wd
+}
+
 func (s *Supervisor) setSupervisordInfo() {
 	supervisordConf, ok := s.config.GetSupervisord()
 	if ok {
 		//set supervisord log
 
 		env := config.NewStringExpression("here", s.config.GetConfigFileDir())
+		//set the directory of the crash reports
+		crashReportDir, err := env.Eval(supervisordConf.GetString("crash_report_dir", ""))
+		if err == nil && crashReportDir != "" {
+			crashReportDir, err = process.PathExpand(crashReportDir)
+		}
+		if err == nil {
+			process.SetCrashReportDir(crashReportDir)
+		}
+		//set the file keeping the restart counters of the programs
+		stateFile, err := env.Eval(supervisordConf.GetString("state_file", ""))
+		if err == nil && stateFile != "" {
+			stateFile, err = process.PathExpand(stateFile)
+		}
+		if err == nil {
+			err = process.SetStateFile(stateFile)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"file": stateFile, log.ErrorKey: err}).Error("fail to load the state file")
+		}
+		//set the time to remember the results of REST requests with idempotency key
+		ttl := supervisordConf.GetInt("idempotency_key_ttl", int(defaultIdempotencyKeyTTL/time.Second))
+		s.idempotency.SetTTL(time.Duration(ttl) * time.Second)
+		//set the names and patterns of the secrets masked in the logs, events and APIs
+		secret.Configure(splitList(supervisordConf.GetString("secret_keys", "")),
+			splitList(supervisordConf.GetString("secret_patterns", "")))
+		//set the memory budget of the events queued for the event listeners
+		events.SetMemoryBudget(int64(supervisordConf.GetBytes("event_buffer_maxbytes", 0)))
+		//set the maximum time to wait a start/stop operation requested by client
+		s.maxOperationTime = time.Duration(supervisordConf.GetInt("max_operation_secs", 0)) * time.Second
 		logFile, err := env.Eval(supervisordConf.GetString("logfile", "supervisord.log"))
 		if err != nil {
 			logFile, err = process.PathExpand(logFile)
@@ -565,6 +1463,7 @@ func (s *Supervisor) setSupervisordInfo() {
 			return
 		}
 		logEventEmitter := logger.NewNullLogEventEmitter()
+		prevLogger := s.logger
 		s.logger = logger.NewNullLogger(logEventEmitter)
 		if err == nil {
 			logfileMaxbytes := int64(supervisordConf.GetBytes("logfileMaxbytes", 50*1024*1024))
@@ -575,6 +1474,10 @@ func (s *Supervisor) setSupervisordInfo() {
 			log.SetFormatter(&log.TextFormatter{DisableColors: true, FullTimestamp: true})
 			log.SetOutput(s.logger)
 		}
+		// the log file of the previous configuration is not written any more
+		if prevLogger != nil {
+			prevLogger.Close()
+		}
 		//set the pid
 		pidfile, err := env.Eval(supervisordConf.GetString("pidfile", "supervisord.pid"))
 		if err == nil {
@@ -587,6 +1490,17 @@ func (s *Supervisor) setSupervisordInfo() {
 	}
 }
 
+// split the comma separated list, the empty items are ignored
+func splitList(s string) []string {
+	result := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
 func toLogLevel(level string) log.Level {
 	switch strings.ToLower(level) {
 	case "critical":
@@ -604,8 +1518,18 @@ func toLogLevel(level string) log.Level {
 
 // ReloadConfig reload the supervisor configuration file
 func (s *Supervisor) ReloadConfig(r *http.Request, args *struct{}, reply *types.ReloadConfigResult) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "reload config"); err != nil {
+		return err
+	}
+	if err := s.operations.Begin("reloadConfig"); err != nil {
+		return err
+	}
 	log.Info("start to reload config")
 	addedGroup, changedGroup, removedGroup, err := s.Reload()
+	s.operations.End()
 	if len(addedGroup) > 0 {
 		log.WithFields(log.Fields{"groups": strings.Join(addedGroup, ",")}).Info("added groups")
 	}
@@ -620,26 +1544,140 @@ func (s *Supervisor) ReloadConfig(r *http.Request, args *struct{}, reply *types.
 	reply.AddedGroup = addedGroup
 	reply.ChangedGroup = changedGroup
 	reply.RemovedGroup = removedGroup
+	// the hook is run once the reload is finished, so the other operations
+	// are not refused while it runs and it can call supervisord
+	if err == nil {
+		s.runLifecycleHook(ReloadHook)
+	}
 	return err
 }
 
-// AddProcessGroup add a process group to the supervisor
+// RereadConfig read the supervisor configuration file and report the groups
+// added, changed or removed since it was loaded without applying them. The
+// added groups are brought into service by supervisor.addProcessGroup
+func (s *Supervisor) RereadConfig(r *http.Request, args *struct{}, reply *types.ReloadConfigResult) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "reread config"); err != nil {
+		return err
+	}
+	cfg, err := s.readConfigFile()
+	if err != nil {
+		return err
+	}
+	reply.AddedGroup, reply.ChangedGroup, reply.RemovedGroup = cfg.ProgramGroup.Sub(s.config.ProgramGroup)
+	sort.Strings(reply.AddedGroup)
+	sort.Strings(reply.ChangedGroup)
+	sort.Strings(reply.RemovedGroup)
+	return nil
+}
+
+// load the configuration file in a new configuration, the running one is
+// unchanged
+func (s *Supervisor) readConfigFile() (*config.Config, error) {
+	cfg := config.NewConfig(s.config.GetConfigFile())
+	if _, err := cfg.Load(); err != nil {
+		return nil, faults.NewFault(faults.CantReRead, "CANT_REREAD: "+err.Error())
+	}
+	return cfg, nil
+}
+
+// AddProcessGroup bring a group of the configuration file which is not in
+// service into service, its autostart programs are started
 func (s *Supervisor) AddProcessGroup(r *http.Request, args *struct{ Name string }, reply *struct{ Success bool }) error {
-	reply.Success = false
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "add process group"); err != nil {
+		return err
+	}
+	if err := s.operations.Begin("addProcessGroup"); err != nil {
+		return err
+	}
+	defer s.operations.End()
+	if len(s.getGroupPrograms(args.Name)) > 0 {
+		return faults.NewFault(faults.AlreadyAdded, "ALREADY_ADDED: "+args.Name)
+	}
+	cfg, err := s.readConfigFile()
+	if err != nil {
+		return err
+	}
+	programs := s.config.AddGroup(cfg, args.Name)
+	if len(programs) == 0 {
+		return badName(args.Name)
+	}
+	for _, name := range programs {
+		entry := s.config.GetProgram(name)
+		proc := s.procMgr.CreateProcess(s.GetSupervisorID(), entry)
+		if proc != nil && entry.GetString("autostart", "true") == "true" && !s.isStandby() {
+			proc.Start(false)
+		}
+	}
+	log.WithFields(log.Fields{"group": args.Name, "programs": strings.Join(programs, ",")}).Info("the process group is added")
+	s.recordAction(r, "add-group", programs, "")
+	reply.Success = true
 	return nil
 }
 
-// RemoveProcessGroup remove a process group from the supervisor
+// RemoveProcessGroup take a group whose programs are all stopped out of
+// service until it is added again or the configuration is reloaded
 func (s *Supervisor) RemoveProcessGroup(r *http.Request, args *struct{ Name string }, reply *struct{ Success bool }) error {
-	reply.Success = false
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "remove process group"); err != nil {
+		return err
+	}
+	if err := s.operations.Begin("removeProcessGroup"); err != nil {
+		return err
+	}
+	defer s.operations.End()
+	programs := s.getGroupPrograms(args.Name)
+	if len(programs) == 0 {
+		return badName(args.Name)
+	}
+	for _, name := range programs {
+		if proc := s.procMgr.Find(name); proc != nil && isRunningState(proc.GetState()) {
+			return faults.NewFault(faults.StillRunning, "STILL_RUNNING: "+args.Name)
+		}
+	}
+	for _, name := range programs {
+		s.config.RemoveProgram(name)
+		s.procMgr.Remove(name)
+	}
+	log.WithFields(log.Fields{"group": args.Name, "programs": strings.Join(programs, ",")}).Info("the process group is removed")
+	s.recordAction(r, "remove-group", programs, "")
+	reply.Success = true
 	return nil
 }
 
+// get the names of the programs of the group in service
+func (s *Supervisor) getGroupPrograms(group string) []string {
+	programs := make([]string, 0)
+	for _, entry := range s.config.GetPrograms() {
+		if entry.Group == group {
+			programs = append(programs, entry.GetProgramName())
+		}
+	}
+	return programs
+}
+
 // ReadProcessStdoutLog read the stdout log of a given program
 func (s *Supervisor) ReadProcessStdoutLog(r *http.Request, args *ProcessLogReadInfo, reply *struct{ LogData string }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkNameAccess(r, args.Name); err != nil {
+		return err
+	}
 	proc := s.procMgr.Find(args.Name)
 	if proc == nil {
-		return fmt.Errorf("No such process %s", args.Name)
+		return badName(args.Name)
+	}
+	if proc.StdoutLog == nil {
+		// the log is created when the program is started
+		return noFile(args.Name)
 	}
 	var err error
 	reply.LogData, err = proc.StdoutLog.ReadLog(int64(args.Offset), int64(args.Length))
@@ -648,9 +1686,19 @@ func (s *Supervisor) ReadProcessStdoutLog(r *http.Request, args *ProcessLogReadI
 
 // ReadProcessStderrLog read the stderr log of a given program
 func (s *Supervisor) ReadProcessStderrLog(r *http.Request, args *ProcessLogReadInfo, reply *struct{ LogData string }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkNameAccess(r, args.Name); err != nil {
+		return err
+	}
 	proc := s.procMgr.Find(args.Name)
 	if proc == nil {
-		return fmt.Errorf("No such process %s", args.Name)
+		return badName(args.Name)
+	}
+	if proc.StderrLog == nil {
+		// the log is created when the program is started
+		return noFile(args.Name)
 	}
 	var err error
 	reply.LogData, err = proc.StderrLog.ReadLog(int64(args.Offset), int64(args.Length))
@@ -659,9 +1707,19 @@ func (s *Supervisor) ReadProcessStderrLog(r *http.Request, args *ProcessLogReadI
 
 // TailProcessStdoutLog tail the stdout of a program
 func (s *Supervisor) TailProcessStdoutLog(r *http.Request, args *ProcessLogReadInfo, reply *ProcessTailLog) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkNameAccess(r, args.Name); err != nil {
+		return err
+	}
 	proc := s.procMgr.Find(args.Name)
 	if proc == nil {
-		return fmt.Errorf("No such process %s", args.Name)
+		return badName(args.Name)
+	}
+	if proc.StdoutLog == nil {
+		// the log is created when the program is started
+		return noFile(args.Name)
 	}
 	var err error
 	reply.LogData, reply.Offset, reply.Overflow, err = proc.StdoutLog.ReadTailLog(int64(args.Offset), int64(args.Length))
@@ -670,9 +1728,19 @@ func (s *Supervisor) TailProcessStdoutLog(r *http.Request, args *ProcessLogReadI
 
 // TailProcessStderrLog tail the stderr of a program
 func (s *Supervisor) TailProcessStderrLog(r *http.Request, args *ProcessLogReadInfo, reply *ProcessTailLog) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkNameAccess(r, args.Name); err != nil {
+		return err
+	}
 	proc := s.procMgr.Find(args.Name)
 	if proc == nil {
-		return fmt.Errorf("No such process %s", args.Name)
+		return badName(args.Name)
+	}
+	if proc.StderrLog == nil {
+		// the log is created when the program is started
+		return noFile(args.Name)
 	}
 	var err error
 	reply.LogData, reply.Offset, reply.Overflow, err = proc.StderrLog.ReadTailLog(int64(args.Offset), int64(args.Length))
@@ -681,9 +1749,15 @@ func (s *Supervisor) TailProcessStderrLog(r *http.Request, args *ProcessLogReadI
 
 // ClearProcessLogs clear the log of a given program
 func (s *Supervisor) ClearProcessLogs(r *http.Request, args *struct{ Name string }, reply *struct{ Success bool }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkNameAccess(r, args.Name); err != nil {
+		return err
+	}
 	proc := s.procMgr.Find(args.Name)
 	if proc == nil {
-		return fmt.Errorf("No such process %s", args.Name)
+		return badName(args.Name)
 	}
 	err1 := proc.StdoutLog.ClearAllLogFile()
 	err2 := proc.StderrLog.ClearAllLogFile()
@@ -696,6 +1770,12 @@ func (s *Supervisor) ClearProcessLogs(r *http.Request, args *struct{ Name string
 
 // ClearAllProcessLogs clear the logs of all programs
 func (s *Supervisor) ClearAllProcessLogs(r *http.Request, args *struct{}, reply *struct{ RPCTaskResults []RPCTaskResult }) error {
+	if err := s.checkState(); err != nil {
+		return err
+	}
+	if err := s.checkAdmin(r, "clear all process logs"); err != nil {
+		return err
+	}
 
 	s.procMgr.ForEachProcess(func(proc *process.Process) {
 		proc.StdoutLog.ClearAllLogFile()
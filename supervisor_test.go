@@ -0,0 +1,285 @@
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"supervisord/internal/testutil"
+
+	"github.com/ochinchina/gorilla-xmlrpc/xml"
+	"github.com/ochinchina/supervisord/faults"
+	"github.com/ochinchina/supervisord/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// the [supervisord] section of the test configurations, the log and the pid
+// file are written in the directory "%[1]s"
+const testSupervisordSection = "[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\n"
+
+// start a supervisord with the configuration written to supervisord.conf in
+// the directory, the programs are stopped at the end of the test
+func startConfSupervisor(t testing.TB, dir string, content string) *Supervisor {
+	s := NewSupervisor(testutil.WriteFile(t, dir, "supervisord.conf", content))
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to start supervisord: %v", err)
+	}
+	t.Cleanup(func() { s.GetManager().StopAllProcesses() })
+	return s
+}
+
+func TestDegradedOnConfigError(t *testing.T) {
+	dir := testutil.TempDir(t)
+	command := testutil.FakeProgram(t, dir, testutil.Sleep)
+	good := fmt.Sprintf("[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\n\n[program:web]\ncommand=%[2]s\nstartsecs=0\n", dir, command)
+	// the encrypted value can't be decrypted without secret_key_file
+	bad := good + fmt.Sprintf("\n[program:db]\ncommand=%s\nenvironment=PASSWORD=enc:invalid\n", command)
+	configFile := testutil.WriteFile(t, dir, "supervisord.conf", bad)
+
+	s := NewSupervisor(configFile)
+	t.Cleanup(func() { s.GetManager().StopAllProcesses() })
+	if _, _, _, err := s.Reload(); err == nil {
+		t.Fatal("fail to report the configuration error")
+	}
+	state := struct{ StateInfo StateInfo }{}
+	s.GetState(nil, nil, &state)
+	if state.StateInfo.Statename != "DEGRADED" || state.StateInfo.Statecode != 4 || state.StateInfo.Error == "" {
+		t.Errorf("fail to report the DEGRADED state: %+v", state.StateInfo)
+	}
+
+	// the configuration is loaded again until it is fixed
+	go s.reloadUntilLoaded(100 * time.Millisecond)
+	testutil.WriteFile(t, dir, "supervisord.conf", good)
+	if !testutil.WaitFor(5*time.Second, func() bool { return s.getConfigError() == nil }) {
+		t.Fatal("fail to load the fixed configuration")
+	}
+	if !testutil.WaitFor(5*time.Second, func() bool { return s.GetManager().Find("web").GetState().String() == "Running" }) {
+		t.Error("fail to start the program of the fixed configuration")
+	}
+
+	// the restart is refused and the running program is kept if the configuration is broken
+	testutil.WriteFile(t, dir, "supervisord.conf", bad)
+	if err := s.Restart(nil, nil, &struct{ Ret interface{} }{}); err == nil || s.IsRestarting() {
+		t.Error("fail to refuse the restart with the broken configuration")
+	}
+	s.GetState(nil, nil, &state)
+	if state.StateInfo.Statename != "DEGRADED" || s.GetManager().Find("web").GetState().String() != "Running" {
+		t.Error("fail to keep the running program")
+	}
+}
+
+func TestSupervisorStates(t *testing.T) {
+	s := startACLTestSupervisor(t)
+	state := struct{ StateInfo StateInfo }{}
+	s.GetState(nil, nil, &state)
+	if state.StateInfo.Statecode != 1 || state.StateInfo.Statename != "RUNNING" {
+		t.Errorf("fail to report the RUNNING state: %+v", state.StateInfo)
+	}
+	s.setState(supervisorRestarting)
+	s.GetState(nil, nil, &state)
+	if state.StateInfo.Statecode != 0 || state.StateInfo.Statename != "RESTARTING" {
+		t.Errorf("fail to report the RESTARTING state: %+v", state.StateInfo)
+	}
+	var fault *xml.Fault
+	err := s.GetProcessInfo(nil, &struct{ Name string }{"web"}, &struct{ ProcInfo types.ProcessInfo }{})
+	if !errors.As(err, &fault) || fault.Code != faults.ShutdownState {
+		t.Errorf("fail to return the SHUTDOWN_STATE fault while restarting: %v", err)
+	}
+
+	s.setState(supervisorShutdown)
+	s.GetState(nil, nil, &state)
+	if state.StateInfo.Statecode != -1 || state.StateInfo.Statename != "SHUTDOWN" {
+		t.Errorf("fail to report the SHUTDOWN state: %+v", state.StateInfo)
+	}
+	if err := s.StartProcess(nil, &StartProcessArgs{Name: "web"}, &struct{ Success interface{} }{}); !errors.As(err, &fault) || fault.Code != faults.ShutdownState {
+		t.Errorf("fail to return the SHUTDOWN_STATE fault while shutting down: %v", err)
+	}
+}
+
+func TestRestartInPlace(t *testing.T) {
+	dir := testutil.TempDir(t)
+	command := testutil.FakeProgram(t, dir, testutil.Sleep)
+	content := "[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\n%[3]s\n" +
+		"[unix_http_server]\nfile=%[1]s/supervisord.sock\n\n[program:web]\ncommand=%[2]s\nstartsecs=0\n"
+	configFile := testutil.WriteFile(t, dir, "supervisord.conf", fmt.Sprintf(content, dir, command, ""))
+	s := NewSupervisor(configFile)
+	t.Cleanup(func() {
+		s.xmlRPC.Stop()
+		s.GetManager().StopAllProcesses()
+	})
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to start supervisord: %v", err)
+	}
+	web := s.GetManager().Find("web")
+	if !testutil.WaitFor(5*time.Second, func() bool { return web.GetState().String() == "Running" }) {
+		t.Fatal("fail to start the program")
+	}
+	pid := web.GetPid()
+
+	// the programs are stopped and started again, the restart returns once supervisord is serving
+	if err := s.Restart(nil, nil, &struct{ Ret interface{} }{}); err != nil || s.IsRestarting() {
+		t.Fatalf("fail to restart supervisord: %v", err)
+	}
+	conn, err := net.Dial("unix", dir+"/supervisord.sock")
+	if err != nil {
+		t.Fatalf("fail to listen again after the restart: %v", err)
+	}
+	conn.Close()
+	if !testutil.WaitFor(5*time.Second, func() bool { return web.GetState().String() == "Running" }) || web.GetPid() == pid {
+		t.Error("fail to stop and start the program again")
+	}
+
+	// the running programs are kept with keep_programs_on_restart
+	testutil.WriteFile(t, dir, "supervisord.conf", fmt.Sprintf(content, dir, command, "keep_programs_on_restart=true\n"))
+	pid = web.GetPid()
+	if err := s.Restart(nil, nil, &struct{ Ret interface{} }{}); err != nil {
+		t.Fatalf("fail to restart supervisord: %v", err)
+	}
+	if web.GetState().String() != "Running" || web.GetPid() != pid {
+		t.Error("fail to keep the running program")
+	}
+}
+
+func TestReadAndClearLog(t *testing.T) {
+	var fault *xml.Fault
+	reply := struct{ Log string }{}
+	s := NewSupervisor("")
+	if err := s.ReadLog(nil, &LogReadInfo{}, &reply); !errors.As(err, &fault) || fault.Code != faults.NoFile {
+		t.Errorf("fail to return NO_FILE without log file: %v", err)
+	}
+
+	s = startACLTestSupervisor(t)
+	log.Info("TestReadAndClearLog marker")
+	if err := s.ReadLog(nil, &LogReadInfo{Offset: 0, Length: 0}, &reply); err != nil || !strings.Contains(reply.Log, "TestReadAndClearLog marker") {
+		t.Errorf("fail to read the supervisord log: %v", err)
+	}
+	if err := s.ReadLog(nil, &LogReadInfo{Offset: -10, Length: 0}, &reply); err != nil || len(reply.Log) != 10 {
+		t.Errorf("fail to read the tail of the supervisord log: %v %q", err, reply.Log)
+	}
+	if err := s.ReadLog(nil, &LogReadInfo{Offset: -10, Length: 5}, &reply); !errors.As(err, &fault) || fault.Code != faults.BadArguments {
+		t.Errorf("fail to return BAD_ARGUMENTS: %v", err)
+	}
+
+	if err := s.ClearLog(nil, nil, &struct{ Ret bool }{}); err != nil {
+		t.Fatalf("fail to clear the supervisord log: %v", err)
+	}
+	if err := s.ReadLog(nil, &LogReadInfo{}, &reply); err != nil || strings.Contains(reply.Log, "TestReadAndClearLog marker") {
+		t.Errorf("fail to clear the supervisord log: %v", err)
+	}
+	os.Remove(s.config.GetConfigFileDir() + "/supervisord.log")
+	if err := s.ReadLog(nil, &LogReadInfo{}, &reply); !errors.As(err, &fault) || fault.Code != faults.NoFile {
+		t.Errorf("fail to return NO_FILE for the removed log file: %v", err)
+	}
+}
+
+func TestNestedGroupOperations(t *testing.T) {
+	dir := testutil.TempDir(t)
+	command := testutil.FakeProgram(t, dir, testutil.Sleep)
+	content := fmt.Sprintf("[supervisord]\nlogfile=%[1]s/supervisord.log\npidfile=%[1]s/supervisord.pid\n\n"+
+		"[program:web]\ncommand=%[2]s\nstartsecs=0\n\n[program:api]\ncommand=%[2]s\nstartsecs=0\n\n"+
+		"[program:worker]\ncommand=%[2]s\nstartsecs=0\n\n[program:batch]\ncommand=%[2]s\nstartsecs=0\n\n"+
+		"[group:frontend]\nprograms=web,api\n\n[group:customer-facing]\nprograms=frontend,worker\n",
+		dir, command)
+	s := NewSupervisor(testutil.WriteFile(t, dir, "supervisord.conf", content))
+	if _, _, _, err := s.Reload(); err != nil {
+		t.Fatalf("fail to start supervisord: %v", err)
+	}
+	t.Cleanup(func() { s.GetManager().StopAllProcesses() })
+	running := func(name string) bool { return s.GetManager().Find(name).GetState().String() == "Running" }
+	if !testutil.WaitFor(5*time.Second, func() bool { return running("web") && running("api") && running("worker") && running("batch") }) {
+		t.Fatal("fail to start the programs")
+	}
+
+	reply := struct{ AllProcessInfo interface{} }{}
+	if err := s.StopProcessGroup(nil, &StartProcessArgs{Name: "customer-facing", Wait: true}, &reply); err != nil {
+		t.Fatalf("fail to stop the nested groups: %v", err)
+	}
+	if infos := reply.AllProcessInfo.([]types.ProcessInfo); len(infos) != 3 || running("web") || running("api") || running("worker") || !running("batch") {
+		t.Errorf("fail to stop only the programs of the nested groups: %v", infos)
+	}
+	if err := s.StartProcess(nil, &StartProcessArgs{Name: "customer-facing:*", Wait: true}, &struct{ Success interface{} }{}); err != nil {
+		t.Fatalf("fail to start the nested groups by name: %v", err)
+	}
+	if !running("web") || !running("api") || !running("worker") {
+		t.Error("fail to start the programs of the nested groups")
+	}
+}
+
+func TestFindProjectConf(t *testing.T) {
+	dir := testutil.TempDir(t)
+	conf := testutil.WriteFile(t, dir, ".supervisord.conf", "[supervisord]\n")
+	subDir := dir + "/src/pkg"
+	os.MkdirAll(subDir, 0755)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(subDir)
+	if file := findProjectConf(); file != conf {
+		t.Errorf("fail to find the project-local configuration in the parent directory: %s", file)
+	}
+	if file, err := findSupervisordConf(); err != nil || file != conf {
+		t.Errorf("fail to use the project-local configuration: %s %v", file, err)
+	}
+}
+
+func TestStartProcessEnv(t *testing.T) {
+	dir := testutil.TempDir(t)
+	script := testutil.WriteFile(t, dir, "env.sh", fmt.Sprintf("#!/bin/sh\necho \"$DEBUG $KEEP\" > %s/env.txt\nexec sleep 1000\n", dir))
+	content := fmt.Sprintf(testSupervisordSection+"\n"+
+		"[program:web]\ncommand=/bin/sh %[2]s\nautostart=false\nstartsecs=0\nenvironment=DEBUG=\"0\",KEEP=\"1\"\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n", dir, script)
+	s := startConfSupervisor(t, dir, content)
+	readEnv := func() string {
+		b, _ := ioutil.ReadFile(dir + "/env.txt")
+		return string(b)
+	}
+
+	rpcc := s.xmlRPC.NewInMemoryClient(s)
+	if err := rpcc.StartProcessWait("web", 0, "DEBUG"); err == nil || !strings.Contains(err.Error(), "BAD_ARGUMENTS") {
+		t.Errorf("fail to refuse the override without value: %v", err)
+	}
+	if err := rpcc.StartProcessWait("web", 0, "DEBUG=1"); err != nil {
+		t.Fatalf("fail to start the program with the overrides: %v", err)
+	}
+	if !testutil.WaitFor(5*time.Second, func() bool { return readEnv() == "1 1\n" }) {
+		t.Errorf("fail to override the environment of the start: %q", readEnv())
+	}
+	s.GetManager().Find("web").Stop(true)
+	os.Remove(dir + "/env.txt")
+	if err := rpcc.StartProcessWait("web", 0); err != nil {
+		t.Fatalf("fail to start the program: %v", err)
+	}
+	if !testutil.WaitFor(5*time.Second, func() bool { return readEnv() == "0 1\n" }) {
+		t.Errorf("fail to forget the overrides of the previous start: %q", readEnv())
+	}
+}
+
+func TestCheckEnvOverrides(t *testing.T) {
+	owner := withAuthUser(httptest.NewRequest("POST", "/RPC2", nil), &AuthUser{Name: "alice", Teams: []string{"web"}})
+	admin := withAuthUser(httptest.NewRequest("POST", "/RPC2", nil), &AuthUser{Name: "root", Admin: true})
+	if err := checkEnvOverrides(owner, []string{"DEBUG=1", "log_level=a=b"}); err != nil {
+		t.Errorf("fail to accept the overrides: %v", err)
+	}
+	for _, kv := range []string{"DEBUG", "=1", "1DEBUG=1", "DEBUG-LEVEL=1", "A B=1"} {
+		if err := checkEnvOverrides(admin, []string{kv}); err == nil || !strings.Contains(err.Error(), "BAD_ARGUMENTS") {
+			t.Errorf("fail to refuse the override %q: %v", kv, err)
+		}
+	}
+	for _, kv := range []string{"LD_PRELOAD=/tmp/x.so", "ld_library_path=/tmp", "PATH=/tmp", "DYLD_INSERT_LIBRARIES=/tmp/x"} {
+		if err := checkEnvOverrides(owner, []string{kv}); !isNotAuthorized(err) {
+			t.Errorf("fail to refuse the override %q to the owner: %v", kv, err)
+		}
+		if err := checkEnvOverrides(admin, []string{kv}); err != nil {
+			t.Errorf("fail to accept the override %q of the admin: %v", kv, err)
+		}
+	}
+	if keys := strings.Join(envKeys([]string{"TOKEN=secret", "DEBUG=1"}), " "); keys != "TOKEN DEBUG" {
+		t.Errorf("fail to get the keys of the overrides: %s", keys)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ochinchina/supervisord/process"
+	log "github.com/sirupsen/logrus"
+)
+
+// the interval to check the CPU usage of the programs with throttle_cpu_percent
+const throttleCheckInterval = 5 * time.Second
+
+// the CPU seconds used by the OS process of a program at a check
+type cpuSample struct {
+	pid     int
+	cpuTime float64
+	time    time.Time
+}
+
+// CPUThrottler throttle the programs using more CPU than their
+// throttle_cpu_percent instead of killing them
+type CPUThrottler struct {
+	lock sync.Mutex
+	// the last sample by program name
+	samples   map[string]cpuSample
+	startOnce sync.Once
+}
+
+// NewCPUThrottler create a CPUThrottler without sample
+func NewCPUThrottler() *CPUThrottler {
+	return &CPUThrottler{samples: make(map[string]cpuSample)}
+}
+
+// start checking the CPU usage of the programs periodically once a program
+// has throttle_cpu_percent
+func (ct *CPUThrottler) load(s *Supervisor) {
+	enabled := false
+	for _, entry := range s.config.GetPrograms() {
+		enabled = enabled || entry.GetInt("throttle_cpu_percent", 0) > 0
+	}
+	if !enabled {
+		return
+	}
+	ct.startOnce.Do(func() {
+		go func() {
+			for now := range time.Tick(throttleCheckInterval) {
+				ct.check(s, now)
+			}
+		}()
+	})
+}
+
+// get the throttling duration and duty percent of the program, from its
+// throttle_secs and throttle_duty_percent
+func (s *Supervisor) getThrottleSettings(name string) (time.Duration, int) {
+	duration, duty := 30, 50
+	if entry := s.config.GetProgram(name); entry != nil {
+		duration = entry.GetInt("throttle_secs", duration)
+		duty = entry.GetInt("throttle_duty_percent", duty)
+	}
+	return time.Duration(duration) * time.Second, duty
+}
+
+// throttle the running programs which used more CPU than their
+// throttle_cpu_percent since the previous check
+func (ct *CPUThrottler) check(s *Supervisor, now time.Time) {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+	samples := make(map[string]cpuSample)
+	s.procMgr.ForEachProcess(func(proc *process.Process) {
+		entry := s.config.GetProgram(proc.GetName())
+		if entry == nil || proc.GetState() != process.Running {
+			return
+		}
+		threshold := entry.GetInt("throttle_cpu_percent", 0)
+		if threshold <= 0 {
+			return
+		}
+		sample := cpuSample{pid: proc.GetPid(), cpuTime: proc.GetResourceUsage().CPUTime, time: now}
+		samples[proc.GetName()] = sample
+		prev, ok := ct.samples[proc.GetName()]
+		if !ok || prev.pid != sample.pid || !sample.time.After(prev.time) || !proc.ThrottledUntil().IsZero() {
+			return
+		}
+		percent := (sample.cpuTime - prev.cpuTime) / sample.time.Sub(prev.time).Seconds() * 100
+		if percent <= float64(threshold) {
+			return
+		}
+		duration, duty := s.getThrottleSettings(proc.GetName())
+		fields := log.Fields{"program": proc.GetName(), "cpu": int(percent), "throttle_cpu_percent": threshold}
+		if err := proc.Throttle(duration, duty); err != nil {
+			fields[log.ErrorKey] = err
+			log.WithFields(fields).Error("fail to throttle the program using too much CPU")
+		} else {
+			log.WithFields(fields).Warn("the program uses too much CPU and is throttled")
+		}
+	})
+	ct.samples = samples
+}
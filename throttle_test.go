@@ -0,0 +1,62 @@
+// +build linux,!nohttp
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"supervisord/internal/testutil"
+)
+
+func TestCPUThrottler(t *testing.T) {
+	dir := testutil.TempDir(t)
+	content := fmt.Sprintf(testSupervisordSection+"\n"+
+		"[program:batch]\ncommand=%[2]s\nautostart=false\nstartsecs=0\nthrottle_cpu_percent=20\nthrottle_secs=60\nthrottle_duty_percent=25\n\n"+
+		"[program:api]\ncommand=%[2]s\nautostart=false\nstartsecs=0\n",
+		dir, testutil.FakeProgram(t, dir, testutil.Busy))
+	s := startConfSupervisor(t, dir, content)
+	batch, api := s.GetManager().Find("batch"), s.GetManager().Find("api")
+	batch.Start(true)
+	api.Start(true)
+
+	ct := NewCPUThrottler()
+	ct.check(s, time.Now())
+	if !batch.ThrottledUntil().IsZero() {
+		t.Fatal("fail to wait the second sample to throttle the program")
+	}
+	time.Sleep(500 * time.Millisecond)
+	ct.check(s, time.Now())
+	if until := batch.ThrottledUntil(); until.Before(time.Now().Add(50 * time.Second)) {
+		t.Errorf("fail to throttle the program for throttle_secs: %v", until)
+	}
+	if !api.ThrottledUntil().IsZero() {
+		t.Error("fail to spare the program without throttle_cpu_percent")
+	}
+
+	router := NewSupervisorRestful(s).CreateProgramHandler()
+	send := func(method string, url string, user *AuthUser) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withAuthUser(httptest.NewRequest(method, url, nil), user))
+		return w
+	}
+	admin := &AuthUser{Name: "admin", Admin: true}
+	if w := send("DELETE", "/program/throttle/batch", admin); w.Code != http.StatusOK || !batch.ThrottledUntil().IsZero() {
+		t.Errorf("fail to unthrottle the program: %d", w.Code)
+	}
+	if w := send("POST", "/program/throttle/api?duration=10s&duty=50", &AuthUser{Name: "alice"}); w.Code != http.StatusForbidden {
+		t.Errorf("fail to refuse the throttling to the user not owner: %d", w.Code)
+	}
+	if w := send("POST", "/program/throttle/api?duty=100", admin); w.Code != http.StatusBadRequest {
+		t.Errorf("fail to refuse the invalid duty: %d", w.Code)
+	}
+	if w := send("POST", "/program/throttle/api?duration=10s&duty=50", admin); w.Code != http.StatusOK {
+		t.Fatalf("fail to throttle the program: %d %s", w.Code, w.Body.String())
+	}
+	if until := api.ThrottledUntil(); until.IsZero() || until.After(time.Now().Add(10*time.Second)) {
+		t.Errorf("fail to throttle the program for the duration: %v", until)
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ochinchina/supervisord/types"
+	"github.com/ochinchina/supervisord/xmlrpcclient"
+	"golang.org/x/term"
+)
+
+// TopCommand show the programs and the log of the selected program in a
+// terminal UI refreshed periodically
+type TopCommand struct {
+	ServerURL string        `short:"s" long:"serverurl" description:"URL on which supervisord server is listening"`
+	User      string        `short:"u" long:"user" description:"the user name"`
+	Password  string        `short:"P" long:"password" description:"the password"`
+	Interval  time.Duration `short:"i" long:"interval" default:"2s" description:"the refresh interval"`
+}
+
+var topCommand TopCommand
+
+// the bytes of the last log lines read from the selected program
+const topLogBytes = 16 * 1024
+
+const topHelp = "q:quit up/down:select s:start x:stop r:restart e:stdout/stderr"
+
+// the keys of the terminal UI
+const (
+	keyNone = iota
+	keyQuit
+	keyUp
+	keyDown
+	keyStart
+	keyStop
+	keyRestart
+	keySwitchLog
+)
+
+// topView the state of the terminal UI
+type topView struct {
+	serverURL string
+	processes []types.ProcessInfo
+	// the CPU percent of the programs since the previous refresh
+	cpu map[string]float64
+	// the CPU time and pid of the programs at the previous refresh
+	lastCputime map[string]float64
+	lastPid     map[string]int
+	lastRefresh time.Time
+	selected    int
+	// show the stderr log of the selected program instead of the stdout
+	stderr  bool
+	log     string
+	message string
+}
+
+func newTopView(serverURL string) *topView {
+	return &topView{serverURL: serverURL,
+		cpu:         make(map[string]float64),
+		lastCputime: make(map[string]float64),
+		lastPid:     make(map[string]int)}
+}
+
+// update set the programs and compute their CPU percent since the previous update
+func (v *topView) update(processes []types.ProcessInfo, now time.Time) {
+	elapsed := now.Sub(v.lastRefresh).Seconds()
+	cpu := make(map[string]float64)
+	cputime := make(map[string]float64)
+	pid := make(map[string]int)
+	for _, info := range processes {
+		name := v.getFullName(&info)
+		cputime[name] = info.Cputime
+		pid[name] = info.Pid
+		// the CPU time of a new OS process restarts from 0
+		if info.Pid != 0 && info.Pid == v.lastPid[name] && elapsed > 0 {
+			cpu[name] = (info.Cputime - v.lastCputime[name]) * 100 / elapsed
+		}
+	}
+	name := v.getSelected()
+	v.processes = processes
+	v.cpu, v.lastCputime, v.lastPid, v.lastRefresh = cpu, cputime, pid, now
+	// keep the same program selected if the programs are changed
+	v.selected = 0
+	for i := range processes {
+		if v.getFullName(&processes[i]) == name {
+			v.selected = i
+		}
+	}
+}
+
+func (v *topView) getFullName(info *types.ProcessInfo) string {
+	if info.Group == "" || info.Group == info.Name {
+		return info.Name
+	}
+	return info.Group + ":" + info.Name
+}
+
+// getSelected get the full name of the selected program, empty without program
+func (v *topView) getSelected() string {
+	if v.selected < 0 || v.selected >= len(v.processes) {
+		return ""
+	}
+	return v.getFullName(&v.processes[v.selected])
+}
+
+func (v *topView) move(delta int) {
+	v.selected += delta
+	if v.selected >= len(v.processes) {
+		v.selected = len(v.processes) - 1
+	}
+	if v.selected < 0 {
+		v.selected = 0
+	}
+}
+
+// render draw the whole screen, the programs on the top and the last lines of
+// the log of the selected program below
+func (v *topView) render(w io.Writer, width int, height int, now time.Time) {
+	lines := make([]string, 0, height)
+	lines = append(lines, fmt.Sprintf("supervisord top - %s - %s", v.serverURL, now.Format("15:04:05")))
+	lines = append(lines, topHelp)
+	lines = append(lines, v.message)
+	lines = append(lines, fmt.Sprintf("%-30s %-9s %7s %10s %6s %10s", "NAME", "STATE", "PID", "UPTIME", "CPU%", "RSS"))
+
+	// the programs use at most half of the screen, scrolled to the selected one
+	rows := len(v.processes)
+	if max := (height - len(lines)) / 2; rows > max {
+		rows = max
+	}
+	first := 0
+	if v.selected >= rows {
+		first = v.selected - rows + 1
+	}
+	for i := first; i < first+rows; i++ {
+		info := &v.processes[i]
+		name := v.getFullName(info)
+		line := fmt.Sprintf("%-30s %-9s %7s %10s %6s %10s", name, info.Statename,
+			formatPid(info.Pid),
+			formatUptime(info),
+			fmt.Sprintf("%.1f", v.cpu[name]),
+			formatRss(info.Rss))
+		if i == v.selected {
+			line = "\x1b[7m" + truncateLine(line, width) + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+
+	stream := "stdout"
+	if v.stderr {
+		stream = "stderr"
+	}
+	lines = append(lines, fmt.Sprintf("--- %s of %s ---", stream, v.getSelected()))
+	logLines := strings.Split(strings.TrimRight(v.log, "\n"), "\n")
+	if max := height - len(lines); len(logLines) > max {
+		if max < 0 {
+			max = 0
+		}
+		logLines = logLines[len(logLines)-max:]
+	}
+	lines = append(lines, logLines...)
+
+	buf := bytes.NewBufferString("\x1b[H\x1b[2J")
+	for i, line := range lines {
+		if i > 0 {
+			buf.WriteString("\r\n")
+		}
+		if !strings.HasPrefix(line, "\x1b[7m") {
+			line = truncateLine(sanitizeLine(line), width)
+		}
+		buf.WriteString(line)
+	}
+	w.Write(buf.Bytes())
+}
+
+func formatPid(pid int) string {
+	if pid == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d", pid)
+}
+
+func formatUptime(info *types.ProcessInfo) string {
+	if info.Statename != "RUNNING" || info.Start == 0 {
+		return "-"
+	}
+	// the monotonic uptime doesn't jump when the clock of the host is stepped,
+	// the servers without it (like python supervisor) only have the wall times
+	seconds := info.CurrentUptime
+	if seconds == 0 && info.Now > info.Start {
+		seconds = info.Now - info.Start
+	}
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+func formatRss(rss int) string {
+	if rss >= 1024*1024 {
+		return fmt.Sprintf("%.1fG", float64(rss)/(1024*1024))
+	}
+	if rss >= 1024 {
+		return fmt.Sprintf("%.1fM", float64(rss)/1024)
+	}
+	return fmt.Sprintf("%dK", rss)
+}
+
+// sanitizeLine replace the tabs and remove the control characters of the log
+// line, they would break the screen
+func sanitizeLine(line string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return ' '
+		}
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, line)
+}
+
+func truncateLine(line string, width int) string {
+	runes := []rune(line)
+	if width > 0 && len(runes) > width {
+		return string(runes[:width])
+	}
+	return line
+}
+
+// parseKeys get the keys of the terminal input, the arrow keys are escape sequences
+func parseKeys(input []byte) []int {
+	keys := make([]int, 0)
+	for i := 0; i < len(input); i++ {
+		key := keyNone
+		switch input[i] {
+		case 'q', 'Q', 3:
+			key = keyQuit
+		case 'k':
+			key = keyUp
+		case 'j':
+			key = keyDown
+		case 's':
+			key = keyStart
+		case 'x':
+			key = keyStop
+		case 'r':
+			key = keyRestart
+		case 'e':
+			key = keySwitchLog
+		case 0x1b:
+			if i+2 < len(input) && input[i+1] == '[' {
+				switch input[i+2] {
+				case 'A':
+					key = keyUp
+				case 'B':
+					key = keyDown
+				}
+				i += 2
+			}
+		}
+		if key != keyNone {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// refresh get the programs and the log of the selected program
+func (v *topView) refresh(rpcc *xmlrpcclient.XMLRPCClient) {
+	reply, err := rpcc.GetAllProcessInfo()
+	if err != nil {
+		v.message = fmt.Sprintf("fail to get the programs: %v", err)
+		return
+	}
+	v.update(reply.Value, time.Now())
+	v.log = ""
+	if name := v.getSelected(); name != "" {
+		if v.log, err = rpcc.ReadProcessLog(name, v.stderr, -topLogBytes, 0); err != nil {
+			v.log = fmt.Sprintf("fail to read the log: %v", err)
+		}
+	}
+}
+
+// changeState start, stop or restart the program and return the result message
+func changeState(rpcc *xmlrpcclient.XMLRPCClient, key int, name string) string {
+	verbs := []string{"start"}
+	if key == keyStop {
+		verbs = []string{"stop"}
+	} else if key == keyRestart {
+		verbs = []string{"stop", "start"}
+	}
+	for _, verb := range verbs {
+		reply, err := rpcc.ChangeProcessState(verb, name)
+		if err != nil {
+			return fmt.Sprintf("fail to %s %s: %v", verb, name, err)
+		}
+		if !reply.Value && verb == "start" {
+			return fmt.Sprintf("fail to start %s", name)
+		}
+	}
+	return fmt.Sprintf("%s %s done", strings.Join(verbs, "+"), name)
+}
+
+// Execute implement Execute() method defined in flags.Commander interface, executes the given command
+func (tc *TopCommand) Execute(args []string) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return exitOnError(fmt.Errorf("the top command needs a terminal"))
+	}
+	ctl := CtlCommand{ServerURL: tc.ServerURL, User: tc.User, Password: tc.Password}
+	rpcc := ctl.createRPCClient()
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return exitOnError(err)
+	}
+	defer func() {
+		term.Restore(fd, oldState)
+		fmt.Println()
+	}()
+
+	keys := make(chan int, 16)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				keys <- keyQuit
+				return
+			}
+			for _, key := range parseKeys(buf[:n]) {
+				keys <- key
+			}
+		}
+	}()
+	messages := make(chan string, 1)
+	ticker := time.NewTicker(tc.Interval)
+	defer ticker.Stop()
+
+	view := newTopView(rpcc.URL())
+	for {
+		view.refresh(rpcc)
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+		view.render(os.Stdout, width, height, time.Now())
+		select {
+		case key := <-keys:
+			switch key {
+			case keyQuit:
+				return nil
+			case keyUp:
+				view.move(-1)
+			case keyDown:
+				view.move(1)
+			case keySwitchLog:
+				view.stderr = !view.stderr
+			case keyStart, keyStop, keyRestart:
+				if name := view.getSelected(); name != "" {
+					view.message = fmt.Sprintf("%s...", name)
+					// stopping a program may take stopwaitsecs, keep the screen refreshed
+					go func(key int) {
+						messages <- changeState(rpcc, key, name)
+					}(key)
+				}
+			}
+		case view.message = <-messages:
+		case <-ticker.C:
+		}
+	}
+}
+
+func init() {
+	parser.AddCommand("top",
+		"show the programs in a terminal UI",
+		"The top subcommand shows the state, CPU and memory of the programs refreshed periodically and the last lines of the log of the selected program. The selected program can be started, stopped and restarted",
+		&topCommand)
+}
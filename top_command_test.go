@@ -0,0 +1,71 @@
+// +build !windows
+
+package main
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ochinchina/supervisord/types"
+
+	"supervisord/internal/testutil"
+)
+
+func TestTopView(t *testing.T) {
+	view := newTopView("http://localhost:9001")
+	now := time.Now()
+	processes := []types.ProcessInfo{{Name: "web", Group: "web", Statename: "RUNNING", Pid: 100, Start: 10, Now: 3733, Cputime: 1, Rss: 2048},
+		{Name: "db", Group: "back", Statename: "STOPPED"}}
+	view.update(processes, now)
+	view.move(1)
+	processes[0].Cputime = 2
+	view.update(processes, now.Add(2*time.Second))
+	if view.cpu["web"] != 50 || view.getSelected() != "back:db" {
+		t.Errorf("fail to update the programs: %v %s", view.cpu, view.getSelected())
+	}
+	view.move(-5)
+	view.log = "line1\n\x1b[31mline2\n"
+	buf := bytes.NewBuffer(nil)
+	view.render(buf, 80, 24, now)
+	screen := buf.String()
+	if !strings.Contains(screen, "\x1b[7mweb ") || !strings.Contains(screen, "1:02:03") || !strings.Contains(screen, "50.0") ||
+		!strings.Contains(screen, "2.0M") || !strings.Contains(screen, "--- stdout of web ---\r\nline1\r\n[31mline2") {
+		t.Errorf("fail to render the screen: %q", screen)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys([]byte("j\x1b[A\x1b[Bsxreq"))
+	expected := []int{keyDown, keyUp, keyDown, keyStart, keyStop, keyRestart, keySwitchLog, keyQuit}
+	if len(keys) != len(expected) {
+		t.Fatalf("fail to parse the keys: %v", keys)
+	}
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Errorf("fail to parse the keys: %v", keys)
+		}
+	}
+}
+
+func TestTopRefresh(t *testing.T) {
+	startCtlTestSupervisor(t)
+	rpcc := ctlCommand.createRPCClient()
+	view := newTopView(rpcc.URL())
+	if message := changeState(rpcc, keyStart, "sleeper"); message != "start sleeper done" {
+		t.Fatalf("fail to start the program: %s", message)
+	}
+	view.refresh(rpcc)
+	if len(view.processes) != 1 || view.processes[0].Pid == 0 || view.message != "" {
+		t.Fatalf("fail to refresh the programs: %v %s", view.processes, view.message)
+	}
+	// the memory is not accounted until the OS process executes the program
+	if runtime.GOOS == "linux" && !testutil.WaitFor(2*time.Second, func() bool {
+		view.refresh(rpcc)
+		return view.processes[0].Rss > 0
+	}) {
+		t.Error("fail to get the memory of the program")
+	}
+}
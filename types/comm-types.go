@@ -6,20 +6,82 @@ import (
 
 // ProcessInfo the running process information
 type ProcessInfo struct {
-	Name          string `xml:"name" json:"name"`
-	Group         string `xml:"group" json:"group"`
-	Description   string `xml:"description" json:"description"`
-	Start         int    `xml:"start" json:"start"`
-	Stop          int    `xml:"stop" json:"stop"`
-	Now           int    `xml:"now" json:"now"`
-	State         int    `xml:"state" json:"state"`
-	Statename     string `xml:"statename" json:"statename"`
-	Spawnerr      string `xml:"spawnerr" json:"spawnerr"`
-	Exitstatus    int    `xml:"exitstatus" json:"exitstatus"`
-	Logfile       string `xml:"logfile" json:"logfile"`
-	StdoutLogfile string `xml:"stdout_logfile" json:"stdout_logfile"`
-	StderrLogfile string `xml:"stderr_logfile" json:"stderr_logfile"`
-	Pid           int    `xml:"pid" json:"pid"`
+	Name          string  `xml:"name" json:"name"`
+	Group         string  `xml:"group" json:"group"`
+	Description   string  `xml:"description" json:"description"`
+	Start         int     `xml:"start" json:"start"`
+	Stop          int     `xml:"stop" json:"stop"`
+	Now           int     `xml:"now" json:"now"`
+	State         int     `xml:"state" json:"state"`
+	Statename     string  `xml:"statename" json:"statename"`
+	Spawnerr      string  `xml:"spawnerr" json:"spawnerr"`
+	Exitstatus    int     `xml:"exitstatus" json:"exitstatus"`
+	Logfile       string  `xml:"logfile" json:"logfile"`
+	StdoutLogfile string  `xml:"stdout_logfile" json:"stdout_logfile"`
+	StderrLogfile string  `xml:"stderr_logfile" json:"stderr_logfile"`
+	Pid           int     `xml:"pid" json:"pid"`
+	Labels        string  `xml:"labels" json:"labels"`                 // comma separated key=value labels of the program
+	Restarts      int     `xml:"restarts" json:"restarts"`             // the restarts after a failure, kept in the state file
+	Failures      int     `xml:"failures" json:"failures"`             // the unexpected exits, kept in the state file
+	Uptime        int     `xml:"uptime" json:"uptime"`                 // the total running seconds, kept in the state file
+	CurrentUptime int     `xml:"current_uptime" json:"current_uptime"` // the seconds the running process has been running, from the monotonic clock
+	Mtbf          int     `xml:"mtbf" json:"mtbf"`                     // the mean running seconds between failures, 0 without failure
+	Cputime       float64 `xml:"cputime" json:"cputime"`               // the CPU seconds used by the running OS process (linux only)
+	Rss           int     `xml:"rss" json:"rss"`                       // the resident memory of the running OS process in KB (linux only)
+}
+
+// ProcessConfig the resolved configuration used to spawn a program. The xml
+// names are the field names so that the client can decode them
+type ProcessConfig struct {
+	Name           string   `xml:"name" json:"name"`
+	Group          string   `xml:"group" json:"group"`
+	Spawned        bool     `xml:"spawned" json:"spawned"`      // false if the program is never spawned
+	SpawnTime      int      `xml:"spawnTime" json:"spawn_time"` // 0 if the program is never spawned
+	Command        []string `xml:"command" json:"command"`
+	Environment    []string `xml:"environment" json:"environment"` // "key=value" with the secrets masked
+	User           string   `xml:"user" json:"user"`
+	Directory      string   `xml:"directory" json:"directory"`
+	StdoutLogfile  string   `xml:"stdoutLogfile" json:"stdout_logfile"`
+	StderrLogfile  string   `xml:"stderrLogfile" json:"stderr_logfile"`
+	RedirectStderr bool     `xml:"redirectStderr" json:"redirect_stderr"`
+}
+
+// ConfigInfo the configuration summary of a program returned by
+// supervisor.getAllConfigInfo, with the names of Python Supervisor. The
+// xmlrpcclient decodes the members by their capitalized names, so the members
+// with "_" are left empty by it and the last member must not have one
+type ConfigInfo struct {
+	Name           string `xml:"name" json:"name"`
+	Group          string `xml:"group" json:"group"`
+	GroupPrio      int    `xml:"group_prio" json:"group_prio"`
+	ProcessPrio    int    `xml:"process_prio" json:"process_prio"`
+	RedirectStderr bool   `xml:"redirect_stderr" json:"redirect_stderr"`
+	StdoutLogfile  string `xml:"stdout_logfile" json:"stdout_logfile"`
+	StderrLogfile  string `xml:"stderr_logfile" json:"stderr_logfile"`
+	Inuse          bool   `xml:"inuse" json:"inuse"` // true if a process of the program is managed
+	Autostart      bool   `xml:"autostart" json:"autostart"`
+	Autorestart    string `xml:"autorestart" json:"autorestart"` // true, false or unexpected
+	Command        string `xml:"command" json:"command"`
+	Directory      string `xml:"directory" json:"directory"`
+	Exitcodes      []int  `xml:"exitcodes" json:"exitcodes"`
+	Startsecs      int    `xml:"startsecs" json:"startsecs"`
+	Startretries   int    `xml:"startretries" json:"startretries"`
+	Stopsignal     int    `xml:"stopsignal" json:"stopsignal"`
+	Stopasgroup    bool   `xml:"stopasgroup" json:"stopasgroup"`
+	Killasgroup    bool   `xml:"killasgroup" json:"killasgroup"`
+	Stopwaitsecs   int    `xml:"stopwaitsecs" json:"stopwaitsecs"`
+}
+
+// ActionStep one step of the ordered action plan returned by the start/stop calls in dry run mode
+type ActionStep struct {
+	Step        int    `xml:"step" json:"step"`
+	Action      string `xml:"action" json:"action"` // start, stop or skip
+	Name        string `xml:"name" json:"name"`
+	Group       string `xml:"group" json:"group"`
+	Priority    int    `xml:"priority" json:"priority"`
+	DependsOn   string `xml:"depends_on" json:"depends_on"`
+	Statename   string `xml:"statename" json:"statename"` // the current state of the program
+	Description string `xml:"description" json:"description"`
 }
 
 // ReloadConfigResult the result of supervisor configuration reloading
@@ -35,6 +97,71 @@ type ProcessSignal struct {
 	Signal string
 }
 
+// ChaosArgs the arguments of a chaos drill killing or delaying the processes
+type ChaosArgs struct {
+	Action   string // kill or delay
+	Name     string // the pattern of the targeted programs, like "web_*" or "db:*", "*" for all the targets allowed
+	Count    int    // the number of processes picked randomly
+	Duration int    // the seconds the delayed processes are paused
+	Reason   string
+}
+
+// ChaosAction a process killed or delayed by a chaos drill
+type ChaosAction struct {
+	Action string `xml:"action" json:"action"`
+	Name   string `xml:"name" json:"name"`
+	Group  string `xml:"group" json:"group"`
+	Pid    int    `xml:"pid" json:"pid"`
+}
+
+// ResourceLimits the cgroup limits and the nice value of a program, an empty
+// limit is unchanged. The fields are sent with their names by the xml codec
+type ResourceLimits struct {
+	Memory string `json:"memory"` // a size like 512MB, max for no limit
+	CPU    string `json:"cpu"`    // a percent of a CPU like 150, max for no limit
+	Nice   string `json:"nice"`   // from -20 to 19
+}
+
+// ResourceLimitsArgs the arguments to change the resource limits of a running program
+type ResourceLimitsArgs struct {
+	Name   string
+	Memory string
+	CPU    string
+	Nice   string
+	Reason string
+}
+
+// RunArgs the arguments to run an ad-hoc command once under supervision
+type RunArgs struct {
+	Command   string   `json:"command"`
+	Directory string   `json:"directory"`
+	TTL       int      `json:"ttl"` // the seconds the finished program is kept, 0 for run_ttl_secs
+	Reason    string   `json:"reason"`
+	Env       []string `json:"env"` // KEY=VALUE, the last argument as an empty array can't be sent
+}
+
+// ExecArgs the arguments to run a command in the context of a program
+type ExecArgs struct {
+	Name    string
+	Command string
+	Timeout int // the maximum seconds the command runs, 0 for the max_operation_secs
+	Reason  string
+}
+
+// ExecResult the result of a command run in the context of a program
+type ExecResult struct {
+	Output     string `json:"output"` // the last bytes of the stdout and stderr of the command
+	ExitStatus int    `json:"exitstatus"`
+}
+
+// ProgramSnapshot the runtime state of a program saved in a snapshot
+type ProgramSnapshot struct {
+	Name    string         `json:"name"`
+	Group   string         `json:"group"`
+	Running bool           `json:"running"`
+	Limits  ResourceLimits `json:"limits"` // the limits changed at runtime
+}
+
 // BooleanReply any rpc result with BooleanReply type
 type BooleanReply struct {
 	Success bool
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ochinchina/supervisord/config"
+)
+
+// ImportUnitCommand implements flags.Commander interface
+type ImportUnitCommand struct {
+	OutFile string `short:"o" long:"output" description:"the output configuration file, stdout by default"`
+	Name    string `short:"n" long:"name" description:"the program name, the unit name without .service by default"`
+}
+
+var importUnitCommand ImportUnitCommand
+
+// Execute convert the systemd unit file to the program section
+func (ic *ImportUnitCommand) Execute(args []string) error {
+	if len(args) != 1 {
+		return exitOnError(fmt.Errorf("usage: supervisord import-unit [-o supervisord.conf] [-n name] foo.service"))
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return exitOnError(err)
+	}
+	defer f.Close()
+	unit, err := config.ParseSystemdUnit(f)
+	if err != nil {
+		return exitOnError(fmt.Errorf("invalid unit file %s: %v", args[0], err))
+	}
+	name := ic.Name
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(args[0]), ".service")
+	}
+	out, err := createOutput(ic.OutFile)
+	if err != nil {
+		return exitOnError(err)
+	}
+	defer out.Close()
+	if err = config.SystemdUnitToIni(name, unit, out); err != nil {
+		return exitOnError(fmt.Errorf("unit file %s: %v", args[0], err))
+	}
+	return nil
+}
+
+func init() {
+	parser.AddCommand("import-unit",
+		"convert a systemd unit file to a program section",
+		"The import-unit subcommand writes the program section of the ExecStart, Environment, User, Group, Restart and WorkingDirectory of the systemd service, the other directives are written as comments",
+		&importUnitCommand)
+}
@@ -31,15 +31,13 @@ func StringArrayToInterfacArray(arr []string) []interface{} {
 
 // Sub return all the element in arr1 but not in arr2
 func Sub(arr1 []string, arr2 []string) []string {
+	exists := make(map[string]bool, len(arr2))
+	for _, s2 := range arr2 {
+		exists[s2] = true
+	}
 	result := make([]string, 0)
 	for _, s := range arr1 {
-		exist := false
-		for _, s2 := range arr2 {
-			if s == s2 {
-				exist = true
-			}
-		}
-		if !exist {
+		if !exists[s] {
 			result = append(result, s)
 		}
 	}
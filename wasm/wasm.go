@@ -0,0 +1,88 @@
+// Package wasm runs the WebAssembly modules of the programs with the wasm
+// runner in the wazero sandbox
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// the size of a WebAssembly memory page
+const pageSize = 65536
+
+// Options the options of the module run in the sandbox
+type Options struct {
+	// the file of the module
+	Module string
+	// the arguments of the module, the first one is the program name
+	Args []string
+	// the "key=value" environment of the module, the environment of the host is not visible
+	Env []string
+	// the host directories visible to the module "host:guest" or "host:guest:ro"
+	Mounts []string
+	// the max memory of the module in bytes, 0 for the limit of wazero (4GB)
+	MaxMemory int
+	Stdin     io.Reader
+	Stdout    io.Writer
+	Stderr    io.Writer
+}
+
+// Run run the WASI module until it exits or the context is done and return its
+// exit code. The module can only access the mounted directories and its stdio
+func Run(ctx context.Context, options Options) (int, error) {
+	code, err := ioutil.ReadFile(options.Module)
+	if err != nil {
+		return 0, err
+	}
+	runtimeConfig := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if options.MaxMemory > 0 {
+		pages := options.MaxMemory / pageSize
+		if pages == 0 {
+			pages = 1
+		}
+		runtimeConfig = runtimeConfig.WithMemoryLimitPages(uint32(pages))
+	}
+	r := wazero.NewRuntimeWithConfig(ctx, runtimeConfig)
+	defer r.Close(context.Background())
+	wasi_snapshot_preview1.MustInstantiate(ctx, r)
+
+	fsConfig := wazero.NewFSConfig()
+	for _, mount := range options.Mounts {
+		parts := strings.SplitN(mount, ":", 3)
+		if len(parts) < 2 {
+			return 0, fmt.Errorf("invalid mount %s", mount)
+		}
+		if len(parts) == 3 && parts[2] == "ro" {
+			fsConfig = fsConfig.WithReadOnlyDirMount(parts[0], parts[1])
+		} else {
+			fsConfig = fsConfig.WithDirMount(parts[0], parts[1])
+		}
+	}
+	moduleConfig := wazero.NewModuleConfig().WithArgs(options.Args...).
+		WithFSConfig(fsConfig).
+		WithSysWalltime().WithSysNanotime().WithSysNanosleep().
+		WithStdin(options.Stdin).WithStdout(options.Stdout).WithStderr(options.Stderr)
+	for _, env := range options.Env {
+		if pos := strings.Index(env, "="); pos > 0 {
+			moduleConfig = moduleConfig.WithEnv(env[:pos], env[pos+1:])
+		}
+	}
+
+	_, err = r.InstantiateWithConfig(ctx, code, moduleConfig)
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return int(exitErr.ExitCode()), nil
+	}
+	return 0, err
+}
@@ -0,0 +1,63 @@
+package wasm
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// write the WASI module whose _start runs the body with the memory of pages
+func writeModule(t *testing.T, pages byte, body []byte) string {
+	wasi := "wasi_snapshot_preview1"
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+		// the types (i32) -> () and () -> ()
+		0x01, 0x08, 0x02, 0x60, 0x01, 0x7f, 0x00, 0x60, 0x00, 0x00,
+		// import proc_exit
+		0x02, byte(14 + len(wasi)), 0x01, byte(len(wasi))}
+	module = append(module, wasi...)
+	module = append(module, 0x09)
+	module = append(module, "proc_exit"...)
+	module = append(module, 0x00, 0x00,
+		// the _start function, the memory and their exports
+		0x03, 0x02, 0x01, 0x01,
+		0x05, 0x03, 0x01, 0x00, pages,
+		0x07, 0x13, 0x02, 0x06, '_', 's', 't', 'a', 'r', 't', 0x00, 0x01, 0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+		0x0a, byte(len(body)+3), 0x01, byte(len(body)+1), 0x00)
+	module = append(module, body...)
+
+	dir, err := ioutil.TempDir("", "wasm")
+	if err != nil {
+		t.Fatal("fail to create temporary directory")
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	file := filepath.Join(dir, "test.wasm")
+	if err := ioutil.WriteFile(file, module, 0644); err != nil {
+		t.Fatal("fail to write the module")
+	}
+	return file
+}
+
+func TestRun(t *testing.T) {
+	// i32.const 3, call proc_exit
+	exit := []byte{0x41, 0x03, 0x10, 0x00, 0x0b}
+	code, err := Run(context.Background(), Options{Module: writeModule(t, 1, exit), Args: []string{"test"}})
+	if err != nil || code != 3 {
+		t.Errorf("fail to get the exit code of the module: %d %v", code, err)
+	}
+
+	// the module needs 2 pages of memory
+	if _, err := Run(context.Background(), Options{Module: writeModule(t, 2, exit), MaxMemory: pageSize}); err == nil {
+		t.Error("fail to limit the memory of the module")
+	}
+
+	// loop forever until the context is done
+	loop := []byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := Run(ctx, Options{Module: writeModule(t, 1, loop)}); err != context.DeadlineExceeded {
+		t.Errorf("fail to stop the module when the context is done: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ochinchina/supervisord/wasm"
+)
+
+// WasmRunCommand implements flags.Commander interface, it runs the module of a
+// program with the wasm runner
+type WasmRunCommand struct {
+	MaxMemory int      `long:"max-memory" description:"the max memory of the module in bytes"`
+	Mounts    []string `long:"mount" description:"the host directory visible to the module, host:guest or host:guest:ro"`
+	Env       []string `long:"env" description:"the name of the environment variable passed to the module"`
+}
+
+var wasmRunCommand WasmRunCommand
+
+// Execute implement Execute() method defined in flags.Commander interface, executes the given command
+func (wc WasmRunCommand) Execute(args []string) error {
+	if len(args) == 0 {
+		return exitOnError(fmt.Errorf("no module to run"))
+	}
+	env := make([]string, 0)
+	for _, name := range wc.Env {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the stop signal of supervisord closes the module
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	exitCode := 0
+	go func() {
+		sig := <-sigs
+		exitCode = 128 + int(sig.(syscall.Signal))
+		cancel()
+	}()
+
+	code, err := wasm.Run(ctx, wasm.Options{Module: args[0],
+		Args:      args,
+		Env:       env,
+		Mounts:    wc.Mounts,
+		MaxMemory: wc.MaxMemory,
+		Stdin:     os.Stdin,
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr})
+	if ctx.Err() != nil {
+		os.Exit(exitCode)
+	}
+	exitOnError(err)
+	os.Exit(code)
+	return nil
+}
+
+func init() {
+	cmd, _ := parser.AddCommand("wasm-run",
+		"run a WebAssembly module",
+		"The wasm-run subcommand runs the WebAssembly module of a program with the wasm runner in the wazero sandbox",
+		&wasmRunCommand)
+	cmd.Hidden = true
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Watchdog detects the deadlocks of supervisord. It calls the probes, like
+// getting the lock of the process manager, periodically and if a probe doesn't
+// return in the timeout, the stacks of all the goroutines are written to the
+// log. If exitOnStall is true, supervisord exits so that its service manager
+// (like systemd) restarts it
+type Watchdog struct {
+	interval    time.Duration
+	timeout     time.Duration
+	exitOnStall bool
+	probes      map[string]func()
+	lock        sync.Mutex
+	// the probes not returned yet
+	pending map[string]*probeRun
+	// called to exit supervisord, os.Exit by default
+	exit func(code int)
+}
+
+// a probe not returned yet
+type probeRun struct {
+	start    time.Time
+	done     chan struct{}
+	reported bool
+}
+
+// NewWatchdog create a Watchdog calling the probes every interval, a probe is
+// stalled if it doesn't return in the timeout
+func NewWatchdog(interval time.Duration, timeout time.Duration, exitOnStall bool) *Watchdog {
+	return &Watchdog{interval: interval,
+		timeout:     timeout,
+		exitOnStall: exitOnStall,
+		probes:      make(map[string]func()),
+		pending:     make(map[string]*probeRun),
+		exit:        os.Exit}
+}
+
+// AddProbe add the probe checked by the watchdog, the probe must not block
+// unless supervisord is stalled
+func (wd *Watchdog) AddProbe(name string, probe func()) {
+	wd.lock.Lock()
+	defer wd.lock.Unlock()
+	wd.probes[name] = probe
+}
+
+// start the probe unless it is still running, must be called with the lock hold
+func (wd *Watchdog) startProbe(name string, probe func(), now time.Time) *probeRun {
+	if run, ok := wd.pending[name]; ok {
+		return run
+	}
+	run := &probeRun{start: now, done: make(chan struct{})}
+	wd.pending[name] = run
+	go func() {
+		probe()
+		wd.lock.Lock()
+		delete(wd.pending, name)
+		wd.lock.Unlock()
+		close(run.done)
+	}()
+	return run
+}
+
+// call the probes and wait them at most the timeout, return the names of the
+// stalled probes not reported before
+func (wd *Watchdog) check() []string {
+	now := time.Now()
+	wd.lock.Lock()
+	runs := make(map[string]*probeRun)
+	for name, probe := range wd.probes {
+		runs[name] = wd.startProbe(name, probe, now)
+	}
+	wd.lock.Unlock()
+
+	stalled := make([]string, 0)
+	for name, run := range runs {
+		timer := time.NewTimer(wd.timeout - time.Since(run.start))
+		select {
+		case <-run.done:
+		case <-timer.C:
+			// the probe may have returned while another one was waited
+			select {
+			case <-run.done:
+				continue
+			default:
+			}
+			wd.lock.Lock()
+			if !run.reported {
+				run.reported = true
+				stalled = append(stalled, name)
+			}
+			wd.lock.Unlock()
+		}
+		timer.Stop()
+	}
+	sort.Strings(stalled)
+	return stalled
+}
+
+// get the stacks of all the goroutines
+func dumpGoroutines() string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return string(buf[:n])
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+}
+
+// Run check the probes periodically in the background
+func (wd *Watchdog) Run() {
+	log.WithFields(log.Fields{"interval": wd.interval, "timeout": wd.timeout, "exit": wd.exitOnStall}).Info("start the watchdog")
+	go func() {
+		for range time.Tick(wd.interval) {
+			stalled := wd.check()
+			if len(stalled) == 0 {
+				continue
+			}
+			log.WithFields(log.Fields{"probes": stalled, "timeout": wd.timeout}).Errorf("supervisord is stalled, the goroutines are:\n%s", dumpGoroutines())
+			if wd.exitOnStall {
+				log.Error("exit because supervisord is stalled")
+				wd.exit(1)
+			}
+		}
+	}()
+}
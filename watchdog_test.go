@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	wd := NewWatchdog(time.Hour, 50*time.Millisecond, false)
+	release := make(chan struct{})
+	wd.AddProbe("fast", func() {})
+	wd.AddProbe("locked", func() { <-release })
+
+	if stalled := wd.check(); len(stalled) != 1 || stalled[0] != "locked" {
+		t.Fatalf("fail to detect the stalled probe: %v", stalled)
+	}
+	if stalled := wd.check(); len(stalled) != 0 {
+		t.Errorf("fail to report the stalled probe once: %v", stalled)
+	}
+	close(release)
+	time.Sleep(10 * time.Millisecond)
+	if stalled := wd.check(); len(stalled) != 0 {
+		t.Errorf("fail to detect the probe returned: %v", stalled)
+	}
+	if dump := dumpGoroutines(); !strings.Contains(dump, "TestWatchdog") {
+		t.Error("fail to dump the goroutines")
+	}
+}
+
+func TestWatchdogExit(t *testing.T) {
+	wd := NewWatchdog(10*time.Millisecond, 10*time.Millisecond, true)
+	exited := make(chan int, 1)
+	wd.exit = func(code int) { exited <- code }
+	wd.AddProbe("locked", func() { select {} })
+	wd.Run()
+	select {
+	case code := <-exited:
+		if code == 0 {
+			t.Error("fail to exit with an error code")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("fail to exit when supervisord is stalled")
+	}
+}
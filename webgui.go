@@ -1,7 +1,10 @@
+// +build !nogui,!nohttp
+
 package main
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -18,6 +21,25 @@ func NewSupervisorWebgui(supervisor *Supervisor) *SupervisorWebgui {
 	return &SupervisorWebgui{router: router, supervisor: supervisor}
 }
 
+// create the store of the sessions of the users logged in the web GUI
+func newWebguiSessions(idleTimeout time.Duration) *SessionStore {
+	return NewSessionStore(idleTimeout)
+}
+
+// the assets of the web GUI used by the login page, served without login
+var loginPageAssets = []string{"/js/i18n.js", "/js/theme.js", "/css/theme.css"}
+
+// register the web GUI and its login and logout pages
+func registerWebgui(mux *http.ServeMux, s *Supervisor, auth *authenticator, sessions *SessionStore, protect func(http.Handler) http.Handler) {
+	mux.Handle("/login", sessions.CreateLoginHandler(auth))
+	mux.Handle("/logout", sessions.CreateLogoutHandler())
+	for _, asset := range loginPageAssets {
+		mux.Handle(asset, http.FileServer(HTTP))
+	}
+	webguiHandler := NewSupervisorWebgui(s).CreateHandler()
+	mux.Handle("/", protect(webguiHandler))
+}
+
 // CreateHandler create a http handler to process the request from WEBGUI
 func (sw *SupervisorWebgui) CreateHandler() http.Handler {
 	sw.router.PathPrefix("/").Handler(http.FileServer(HTTP))
@@ -0,0 +1,259 @@
+// the language packs of the web GUI, the language is selected by the
+// settings toggle (kept in the localStorage) or by the languages of the
+// browser, which are sent as its Accept-Language header
+var i18nPacks = {
+    "en": {
+        "name": "English",
+        "programs": "Programs",
+        "program": "Program",
+        "state": "State",
+        "description": "Description",
+        "labels": "Labels",
+        "action": "Action",
+        "start": "Start",
+        "stop": "Stop",
+        "log": "Log",
+        "start-select": "Start Select",
+        "stop-select": "Stop Select",
+        "reload": "Reload",
+        "shutdown": "Shutdown",
+        "logout": "Logout",
+        "theme": "Theme",
+        "login": "Login",
+        "username": "User name",
+        "password": "Password",
+        "invalid-login": "Invalid user name or password",
+        "label-filter": "labels, e.g. team=web,tier",
+        "cancel": "Cancel",
+        "ok": "Ok",
+        "information": "Information",
+        "confirmation": "Confirmation",
+        "stop-confirmation": "Stop confirmation",
+        "stop-question": "Do you really want to stop program?",
+        "shutdown-confirmation": "Shutdown confirmation",
+        "shutdown-question": "Do you really want to shutdown supervisor?",
+        "reload-confirmation": "Reload confirmation",
+        "reload-question": "Do you really want to reload supervisor?",
+        "start-failed": "Fail to start program, please check the log of supervisord to find reason",
+        "start-unreachable": "Fail to start program, please check if supervisord is started or not",
+        "stop-failed": "Fail to stop program, please check the log of supervisord",
+        "stop-unreachable": "Fail to stop program, please check if supervisord is running",
+        "no-selection": "no program selected",
+        "list-failed": "Fail to list the programs",
+        "reason": "Reason",
+        "stop-select-question": "Do you really want to stop the selected programs?",
+        "locked-confirmation": "Locked program",
+        "locked-question": "The program is locked to protect it from accidental stops, do you really want to force it to stop?",
+        "force-stop": "Force stop",
+        "config": "Config",
+        "validate": "Validate",
+        "save": "Save",
+        "save-apply": "Save and apply",
+        "config-load-failed": "Fail to load the configuration file",
+        "config-valid": "The configuration is valid",
+        "config-invalid": "Invalid configuration",
+        "config-saved": "The configuration is saved, it is applied by Reload",
+        "config-apply-failed": "Fail to reload the configuration",
+        "state.STOPPED": "Stopped",
+        "state.STARTING": "Starting",
+        "state.RUNNING": "Running",
+        "state.BACKOFF": "Backoff",
+        "state.STOPPING": "Stopping",
+        "state.EXITED": "Exited",
+        "state.FATAL": "Fatal",
+        "state.UNKNOWN": "Unknown"
+    },
+    "zh": {
+        "name": "中文",
+        "programs": "程序",
+        "program": "程序",
+        "state": "状态",
+        "description": "描述",
+        "labels": "标签",
+        "action": "操作",
+        "start": "启动",
+        "stop": "停止",
+        "log": "日志",
+        "start-select": "启动所选",
+        "stop-select": "停止所选",
+        "reload": "重新加载",
+        "shutdown": "关闭",
+        "logout": "退出",
+        "theme": "主题",
+        "login": "登录",
+        "username": "用户名",
+        "password": "密码",
+        "invalid-login": "用户名或密码错误",
+        "label-filter": "标签，例如 team=web,tier",
+        "cancel": "取消",
+        "ok": "确定",
+        "information": "信息",
+        "confirmation": "确认",
+        "stop-confirmation": "停止确认",
+        "stop-question": "确定要停止程序吗？",
+        "shutdown-confirmation": "关闭确认",
+        "shutdown-question": "确定要关闭 supervisor 吗？",
+        "reload-confirmation": "重新加载确认",
+        "reload-question": "确定要重新加载 supervisor 吗？",
+        "start-failed": "启动程序失败，请查看 supervisord 的日志以找到原因",
+        "start-unreachable": "启动程序失败，请检查 supervisord 是否已启动",
+        "stop-failed": "停止程序失败，请查看 supervisord 的日志",
+        "stop-unreachable": "停止程序失败，请检查 supervisord 是否正在运行",
+        "no-selection": "未选择程序",
+        "list-failed": "获取程序列表失败",
+        "reason": "原因",
+        "stop-select-question": "确定要停止所选程序吗？",
+        "locked-confirmation": "程序已锁定",
+        "locked-question": "该程序已锁定以防止误停止，确定要强制停止吗？",
+        "force-stop": "强制停止",
+        "config": "配置",
+        "validate": "验证",
+        "save": "保存",
+        "save-apply": "保存并应用",
+        "config-load-failed": "加载配置文件失败",
+        "config-valid": "配置有效",
+        "config-invalid": "配置无效",
+        "config-saved": "配置已保存，重新加载后生效",
+        "config-apply-failed": "重新加载配置失败",
+        "state.STOPPED": "已停止",
+        "state.STARTING": "启动中",
+        "state.RUNNING": "运行中",
+        "state.BACKOFF": "退避中",
+        "state.STOPPING": "停止中",
+        "state.EXITED": "已退出",
+        "state.FATAL": "致命错误",
+        "state.UNKNOWN": "未知"
+    },
+    "fr": {
+        "name": "Français",
+        "programs": "Programmes",
+        "program": "Programme",
+        "state": "État",
+        "description": "Description",
+        "labels": "Étiquettes",
+        "action": "Action",
+        "start": "Démarrer",
+        "stop": "Arrêter",
+        "log": "Journal",
+        "start-select": "Démarrer la sélection",
+        "stop-select": "Arrêter la sélection",
+        "reload": "Recharger",
+        "shutdown": "Éteindre",
+        "logout": "Déconnexion",
+        "theme": "Thème",
+        "login": "Connexion",
+        "username": "Nom d'utilisateur",
+        "password": "Mot de passe",
+        "invalid-login": "Nom d'utilisateur ou mot de passe invalide",
+        "label-filter": "étiquettes, par ex. team=web,tier",
+        "cancel": "Annuler",
+        "ok": "Ok",
+        "information": "Information",
+        "confirmation": "Confirmation",
+        "stop-confirmation": "Confirmation de l'arrêt",
+        "stop-question": "Voulez-vous vraiment arrêter le programme ?",
+        "shutdown-confirmation": "Confirmation de l'extinction",
+        "shutdown-question": "Voulez-vous vraiment éteindre supervisor ?",
+        "reload-confirmation": "Confirmation du rechargement",
+        "reload-question": "Voulez-vous vraiment recharger supervisor ?",
+        "start-failed": "Échec du démarrage du programme, consultez le journal de supervisord pour en trouver la raison",
+        "start-unreachable": "Échec du démarrage du programme, vérifiez que supervisord est démarré",
+        "stop-failed": "Échec de l'arrêt du programme, consultez le journal de supervisord",
+        "stop-unreachable": "Échec de l'arrêt du programme, vérifiez que supervisord est en cours d'exécution",
+        "no-selection": "aucun programme sélectionné",
+        "list-failed": "Échec de la liste des programmes",
+        "reason": "Raison",
+        "stop-select-question": "Voulez-vous vraiment arrêter les programmes sélectionnés ?",
+        "locked-confirmation": "Programme verrouillé",
+        "locked-question": "Le programme est verrouillé pour éviter les arrêts accidentels, voulez-vous vraiment forcer son arrêt ?",
+        "force-stop": "Forcer l'arrêt",
+        "config": "Config",
+        "validate": "Valider",
+        "save": "Enregistrer",
+        "save-apply": "Enregistrer et appliquer",
+        "config-load-failed": "Échec du chargement du fichier de configuration",
+        "config-valid": "La configuration est valide",
+        "config-invalid": "Configuration invalide",
+        "config-saved": "La configuration est enregistrée, elle est appliquée par Recharger",
+        "config-apply-failed": "Échec du rechargement de la configuration",
+        "state.STOPPED": "Arrêté",
+        "state.STARTING": "Démarrage",
+        "state.RUNNING": "En cours",
+        "state.BACKOFF": "Nouvel essai",
+        "state.STOPPING": "Arrêt",
+        "state.EXITED": "Terminé",
+        "state.FATAL": "Erreur fatale",
+        "state.UNKNOWN": "Inconnu"
+    }
+};
+
+// get the language of the settings toggle, or the first language of the
+// browser with a language pack, or English
+function i18nLanguage() {
+    var language = window.localStorage ? window.localStorage.getItem( "language" ) : null;
+    if( language && i18nPacks.hasOwnProperty( language ) ) {
+        return language;
+    }
+    var languages = navigator.languages || [ navigator.language || "en" ];
+    for( var i = 0; i < languages.length; i++ ) {
+        language = languages[i].toLowerCase().split( "-" )[0];
+        if( i18nPacks.hasOwnProperty( language ) ) {
+            return language;
+        }
+    }
+    return "en";
+}
+
+// translate the key in the selected language, the English text is used if
+// the key is missing in the language pack
+function t( key ) {
+    var pack = i18nPacks[i18nLanguage()];
+    if( pack.hasOwnProperty( key ) ) {
+        return pack[key];
+    }
+    return i18nPacks["en"].hasOwnProperty( key ) ? i18nPacks["en"][key] : key;
+}
+
+// translate the state name of a program like "Running" or "RUNNING"
+function translateState( statename ) {
+    var key = "state." + statename.toUpperCase();
+    return i18nPacks["en"].hasOwnProperty( key ) ? t( key ) : statename;
+}
+
+// translate the elements with the data-i18n attribute (their text), the
+// data-i18n-placeholder attribute and the data-i18n-value attribute
+function translatePage() {
+    document.documentElement.lang = i18nLanguage();
+    var elements = document.querySelectorAll( "[data-i18n]" );
+    for( var i = 0; i < elements.length; i++ ) {
+        elements[i].textContent = t( elements[i].getAttribute( "data-i18n" ) );
+    }
+    elements = document.querySelectorAll( "[data-i18n-placeholder]" );
+    for( i = 0; i < elements.length; i++ ) {
+        elements[i].placeholder = t( elements[i].getAttribute( "data-i18n-placeholder" ) );
+    }
+    elements = document.querySelectorAll( "[data-i18n-value]" );
+    for( i = 0; i < elements.length; i++ ) {
+        elements[i].value = t( elements[i].getAttribute( "data-i18n-value" ) );
+    }
+}
+
+// fill the settings toggle with the language packs, the selected language
+// is kept in the localStorage and the page is translated again by onchange
+// (translatePage by default)
+function initLanguageSelect( select, onchange ) {
+    var current = i18nLanguage();
+    for( var language in i18nPacks ) {
+        var option = document.createElement( "option" );
+        option.value = language;
+        option.textContent = i18nPacks[language]["name"];
+        option.selected = language == current;
+        select.appendChild( option );
+    }
+    select.onchange = function() {
+        if( window.localStorage ) {
+            window.localStorage.setItem( "language", select.value );
+        }
+        ( onchange || translatePage )();
+    };
+}
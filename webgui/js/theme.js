@@ -0,0 +1,28 @@
+// the dark theme of the web GUI, kept in the localStorage, or the theme of
+// the system if it is never toggled. It is applied before the page is shown
+// to avoid a flash of the light theme
+function isDarkTheme() {
+    var theme = window.localStorage ? window.localStorage.getItem( "theme" ) : null;
+    if( theme ) {
+        return theme == "dark";
+    }
+    return window.matchMedia && window.matchMedia( "(prefers-color-scheme: dark)" ).matches;
+}
+
+function applyTheme() {
+    if( isDarkTheme() ) {
+        document.documentElement.classList.add( "dark" );
+    } else {
+        document.documentElement.classList.remove( "dark" );
+    }
+}
+
+// switch between the dark and the light theme
+function toggleTheme() {
+    if( window.localStorage ) {
+        window.localStorage.setItem( "theme", isDarkTheme() ? "light" : "dark" );
+    }
+    applyTheme();
+}
+
+applyTheme();
@@ -0,0 +1,29 @@
+// +build nogui nohttp
+
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// no web GUI and no sessions in the binary built with the nogui or nohttp tag,
+// the clients use the basic auth only
+func newWebguiSessions(idleTimeout time.Duration) *SessionStore {
+	return nil
+}
+
+func registerWebgui(mux *http.ServeMux, s *Supervisor, auth *authenticator, sessions *SessionStore, protect func(http.Handler) http.Handler) {
+}
+
+// SessionStore the sessions are not supported without the web GUI
+type SessionStore struct{}
+
+// GetUser get the logged in user of the request, always nil without the web GUI
+func (ss *SessionStore) GetUser(r *http.Request) *AuthUser {
+	return nil
+}
+
+func isBrowserRequest(r *http.Request) bool {
+	return false
+}
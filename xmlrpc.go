@@ -1,162 +1,298 @@
 package main
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
-	"io"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
 	"net"
 	"net/http"
 	"os"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/rpc"
 	"github.com/ochinchina/gorilla-xmlrpc/xml"
+	"github.com/ochinchina/supervisord/secret"
+	"github.com/ochinchina/supervisord/xmlrpcclient"
 	log "github.com/sirupsen/logrus"
 )
 
 // XMLRPC mange the XML RPC servers
 // start XML RPC servers to accept the XML RPC request from client side
 type XMLRPC struct {
+	lock sync.Mutex
 	// all the listeners to accept the XML RPC request
 	listeners map[string]net.Listener
+	// the http servers of the listeners
+	servers map[string]*http.Server
 }
 
-type httpBasicAuth struct {
+// authenticator verify the user name and password of the http server user,
+// who is the admin, or of the users defined in the [user:<name>] sections
+type authenticator struct {
 	user     string
 	password string
-	handler  http.Handler
+	users    map[string]*aclUser
+	// the users verified by the sha256 of user name and password, the slow
+	// bcrypt or argon2id hash is not computed again for every request
+	lock     sync.Mutex
+	verified map[[sha256.Size]byte]*AuthUser
+}
+
+func newAuthenticator(user string, password string, users map[string]*aclUser) *authenticator {
+	return &authenticator{user: user, password: password, users: users, verified: make(map[[sha256.Size]byte]*AuthUser)}
+}
+
+// check if the authentication is required, no authentication if the user or password of http server is not set
+func (a *authenticator) isRequired() bool {
+	return a.user != "" && a.password != ""
+}
+
+// authenticate verify the user name and password with the configured plaintext password or hash
+func (a *authenticator) authenticate(username string, password string) (*AuthUser, bool) {
+	key := sha256.Sum256([]byte(username + "\x00" + password))
+	a.lock.Lock()
+	user, ok := a.verified[key]
+	a.lock.Unlock()
+	if ok {
+		return user, true
+	}
+	if subtle.ConstantTimeCompare([]byte(username), []byte(a.user)) == 1 {
+		if !secret.VerifyPassword(a.password, password) {
+			return nil, false
+		}
+		user = &AuthUser{Name: username, Admin: true}
+	} else if aclUser, ok := a.users[username]; ok && secret.VerifyPassword(aclUser.password, password) {
+		user = &AuthUser{Name: username, Teams: aclUser.teams, ForceLocked: aclUser.forceLocked}
+	} else {
+		return nil, false
+	}
+	a.lock.Lock()
+	a.verified[key] = user
+	a.lock.Unlock()
+	return user, true
 }
 
-// create a new HttpBasicAuth oject with user name, password and the http request handler
-func newHTTPBasicAuth(user string, password string, handler http.Handler) *httpBasicAuth {
-	if user != "" && password != "" {
+type httpBasicAuth struct {
+	auth    *authenticator
+	handler http.Handler
+	// the sessions of the web UI, the logged in users don't need the basic auth
+	sessions *SessionStore
+}
+
+// create a new HttpBasicAuth oject with the authenticator, the web UI sessions and the http request handler
+func newHTTPBasicAuth(auth *authenticator, sessions *SessionStore, handler http.Handler) *httpBasicAuth {
+	if auth.isRequired() {
 		log.Debug("require authentication")
 	}
-	return &httpBasicAuth{user: user, password: password, handler: handler}
+	return &httpBasicAuth{auth: auth, handler: handler, sessions: sessions}
 }
 
 func (h *httpBasicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if h.user == "" || h.password == "" {
+	if !h.auth.isRequired() {
 		log.Debug("no auth required")
 		h.handler.ServeHTTP(w, r)
 		return
 	}
-	username, password, ok := r.BasicAuth()
-	if ok && username == h.user {
-		if strings.HasPrefix(h.password, "{SHA}") {
-			log.Debug("auth with SHA")
-			hash := sha1.New()
-			io.WriteString(hash, password)
-			if hex.EncodeToString(hash.Sum(nil)) == h.password[5:] {
-				h.handler.ServeHTTP(w, r)
-				return
-			}
-		} else if password == h.password {
-			log.Debug("Auth with normal password")
-			h.handler.ServeHTTP(w, r)
+	if h.sessions != nil {
+		if user := h.sessions.GetUser(r); user != nil {
+			h.handler.ServeHTTP(w, withAuthUser(r, user))
+			return
+		}
+	}
+	if username, password, ok := r.BasicAuth(); ok {
+		if user, ok := h.auth.authenticate(username, password); ok {
+			h.handler.ServeHTTP(w, withAuthUser(r, user))
 			return
 		}
 	}
+	if h.sessions != nil && isBrowserRequest(r) {
+		// let the web UI show the login page instead of the basic auth prompt
+		if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+			w.WriteHeader(401)
+		} else {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		}
+		return
+	}
 	w.Header().Set("WWW-Authenticate", "Basic realm=\"supervisor\"")
 	w.WriteHeader(401)
 }
 
 // NewXMLRPC create a new XML RPC object
 func NewXMLRPC() *XMLRPC {
-	return &XMLRPC{listeners: make(map[string]net.Listener)}
+	return &XMLRPC{listeners: make(map[string]net.Listener), servers: make(map[string]*http.Server)}
 }
 
-// Stop stop network listening
+// Stop stop network listening, the connections kept alive are closed once
+// their requests are served
 func (p *XMLRPC) Stop() {
 	log.Info("stop listening")
-	for _, listener := range p.listeners {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for protocol, listener := range p.listeners {
 		listener.Close()
+		// don't wait, the request being served may be the one stopping the listeners
+		if server, ok := p.servers[protocol]; ok {
+			go server.Shutdown(context.Background())
+		}
 	}
 	p.listeners = make(map[string]net.Listener)
+	p.servers = make(map[string]*http.Server)
 }
 
 // StartUnixHTTPServer start http server on unix domain socket with path listenAddr. If both user and password are not empty, the user
 // must provide user and password for basic authentication when making a XML RPC request.
-func (p *XMLRPC) StartUnixHTTPServer(user string, password string, listenAddr string, s *Supervisor, startedCb func()) {
+func (p *XMLRPC) StartUnixHTTPServer(user string, password string, sessionTimeout time.Duration, listenAddr string, s *Supervisor, startedCb func()) {
 	os.Remove(listenAddr)
-	p.startHTTPServer(user, password, "unix", listenAddr, s, startedCb)
+	p.startHTTPServer(user, password, sessionTimeout, "unix", listenOptions{network: "unix", address: listenAddr}, s, startedCb)
 }
 
-// StartInetHTTPServer start http server on tcp with path listenAddr. If both user and password are not empty, the user
+// StartInetHTTPServer start http server on tcp with the listen options. If both user and password are not empty, the user
 // must provide user and password for basic authentication when making a XML RPC request.
-func (p *XMLRPC) StartInetHTTPServer(user string, password string, listenAddr string, s *Supervisor, startedCb func()) {
-	p.startHTTPServer(user, password, "tcp", listenAddr, s, startedCb)
+func (p *XMLRPC) StartInetHTTPServer(user string, password string, sessionTimeout time.Duration, options listenOptions, s *Supervisor, startedCb func()) {
+	p.startHTTPServer(user, password, sessionTimeout, "tcp", options, s, startedCb)
 }
 
 func (p *XMLRPC) isHTTPServerStartedOnProtocol(protocol string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	_, ok := p.listeners[protocol]
 	return ok
 }
 
-func (p *XMLRPC) startHTTPServer(user string, password string, protocol string, listenAddr string, s *Supervisor, startedCb func()) {
+func (p *XMLRPC) startHTTPServer(user string, password string, sessionTimeout time.Duration, protocol string, options listenOptions, s *Supervisor, startedCb func()) {
 	if p.isHTTPServerStartedOnProtocol(protocol) {
 		startedCb()
 		return
 	}
 	mux := http.NewServeMux()
-	mux.Handle("/RPC2", newHTTPBasicAuth(user, password, p.createRPCServer(s)))
-	progRestHandler := NewSupervisorRestful(s).CreateProgramHandler()
-	mux.Handle("/program/", newHTTPBasicAuth(user, password, progRestHandler))
-	supervisorRestHandler := NewSupervisorRestful(s).CreateSupervisorHandler()
-	mux.Handle("/supervisor/", newHTTPBasicAuth(user, password, supervisorRestHandler))
-	logtailHandler := NewLogtail(s).CreateHandler()
-	mux.Handle("/logtail/", newHTTPBasicAuth(user, password, logtailHandler))
-	webguiHandler := NewSupervisorWebgui(s).CreateHandler()
-	mux.Handle("/", newHTTPBasicAuth(user, password, webguiHandler))
-	listener, err := net.Listen(protocol, listenAddr)
+	auth := newAuthenticator(user, password, loadACLUsers(s.config))
+	// no sessions if the web GUI is not built in
+	sessions := newWebguiSessions(sessionTimeout)
+	protect := func(handler http.Handler) http.Handler {
+		return newHTTPBasicAuth(auth, sessions, handler)
+	}
+	mux.Handle("/RPC2", protect(restrictRPCExtensions(p.createRPCServer(s))))
+	p.registerHTTPHandlers(mux, s, protect)
+	registerWebgui(mux, s, auth, sessions, protect)
+	listener, err := options.listen()
 	if err == nil {
-		log.WithFields(log.Fields{"addr": listenAddr, "protocol": protocol}).Info("success to listen on address")
+		log.WithFields(log.Fields{"addr": options.address, "protocol": options.network}).Info("success to listen on address")
+		server := &http.Server{Handler: mux}
+		p.lock.Lock()
 		p.listeners[protocol] = listener
+		p.servers[protocol] = server
+		p.lock.Unlock()
 		startedCb()
-		http.Serve(listener, mux)
+		server.Serve(listener)
 	} else {
 		startedCb()
-		log.WithFields(log.Fields{"addr": listenAddr, "protocol": protocol}).Fatal("fail to listen on address")
+		log.WithFields(log.Fields{"addr": options.address, "protocol": options.network, log.ErrorKey: err}).Fatal("fail to listen on address")
+	}
+
+}
+// NewInMemoryClient create a XML RPC client calling the supervisor in the same
+// process without network, the basic authentication is not required
+func (p *XMLRPC) NewInMemoryClient(s *Supervisor) *xmlrpcclient.XMLRPCClient {
+	mux := http.NewServeMux()
+	mux.Handle("/RPC2", p.createRPCServer(s))
+	return xmlrpcclient.NewInMemoryXMLRPCClient(mux, false)
+}
+
+func (p *XMLRPC) createRPCServer(s *Supervisor) http.Handler {
+	RPC, system := newRPCServer(s, &xmlrpcCodec{xml.NewCodec()}, "text/xml")
+	system.multicall = true
+	return &xmlrpcMulticallHandler{server: RPC, system: system}
+}
+
+// xmlrpcCodec the XML-RPC codec writing the faults created by faults.NewFault
+// with their codes, the gorilla codec reports the fault pointers as application errors
+type xmlrpcCodec struct {
+	*xml.Codec
+}
+
+type xmlrpcCodecRequest struct {
+	rpc.CodecRequest
+}
+
+// NewRequest implements rpc.Codec interface
+func (c *xmlrpcCodec) NewRequest(r *http.Request) rpc.CodecRequest {
+	return &xmlrpcCodecRequest{c.Codec.NewRequest(r)}
+}
+
+// WriteResponse implements rpc.CodecRequest interface
+func (c *xmlrpcCodecRequest) WriteResponse(w http.ResponseWriter, reply interface{}, methodErr error) error {
+	var fault *xml.Fault
+	if errors.As(methodErr, &fault) {
+		methodErr = *fault
 	}
+	return c.CodecRequest.WriteResponse(w, reply, methodErr)
+}
 
+// rpcCodec the codec of rpc server supporting the method aliases
+type rpcCodec interface {
+	rpc.Codec
+	RegisterAlias(alias, method string)
 }
-func (p *XMLRPC) createRPCServer(s *Supervisor) *rpc.Server {
+
+// create the rpc server with the methods of supervisor, the extensions and the
+// introspection, the XML-RPC and JSON-RPC servers are created by it to provide
+// the same methods
+func newRPCServer(s *Supervisor, codec rpcCodec, contentType string) (*rpc.Server, *rpcSystem) {
 	RPC := rpc.NewServer()
-	xmlrpcCodec := xml.NewCodec()
-	RPC.RegisterCodec(xmlrpcCodec, "text/xml")
-	RPC.RegisterService(s, "")
-
-	xmlrpcCodec.RegisterAlias("supervisor.getVersion", "Supervisor.GetVersion")
-	xmlrpcCodec.RegisterAlias("supervisor.getAPIVersion", "Supervisor.GetVersion")
-	xmlrpcCodec.RegisterAlias("supervisor.getIdentification", "Supervisor.GetIdentification")
-	xmlrpcCodec.RegisterAlias("supervisor.getState", "Supervisor.GetState")
-	xmlrpcCodec.RegisterAlias("supervisor.getPID", "Supervisor.GetPID")
-	xmlrpcCodec.RegisterAlias("supervisor.readLog", "Supervisor.ReadLog")
-	xmlrpcCodec.RegisterAlias("supervisor.clearLog", "Supervisor.ClearLog")
-	xmlrpcCodec.RegisterAlias("supervisor.shutdown", "Supervisor.Shutdown")
-	xmlrpcCodec.RegisterAlias("supervisor.restart", "Supervisor.Restart")
-	xmlrpcCodec.RegisterAlias("supervisor.getProcessInfo", "Supervisor.GetProcessInfo")
-	xmlrpcCodec.RegisterAlias("supervisor.getSupervisorVersion", "Supervisor.GetVersion")
-	xmlrpcCodec.RegisterAlias("supervisor.getAllProcessInfo", "Supervisor.GetAllProcessInfo")
-	xmlrpcCodec.RegisterAlias("supervisor.startProcess", "Supervisor.StartProcess")
-	xmlrpcCodec.RegisterAlias("supervisor.startAllProcesses", "Supervisor.StartAllProcesses")
-	xmlrpcCodec.RegisterAlias("supervisor.startProcessGroup", "Supervisor.StartProcessGroup")
-	xmlrpcCodec.RegisterAlias("supervisor.stopProcess", "Supervisor.StopProcess")
-	xmlrpcCodec.RegisterAlias("supervisor.stopProcessGroup", "Supervisor.StopProcessGroup")
-	xmlrpcCodec.RegisterAlias("supervisor.stopAllProcesses", "Supervisor.StopAllProcesses")
-	xmlrpcCodec.RegisterAlias("supervisor.signalProcess", "Supervisor.SignalProcess")
-	xmlrpcCodec.RegisterAlias("supervisor.signalProcessGroup", "Supervisor.SignalProcessGroup")
-	xmlrpcCodec.RegisterAlias("supervisor.signalAllProcesses", "Supervisor.SignalAllProcesses")
-	xmlrpcCodec.RegisterAlias("supervisor.sendProcessStdin", "Supervisor.SendProcessStdin")
-	xmlrpcCodec.RegisterAlias("supervisor.sendRemoteCommEvent", "Supervisor.SendRemoteCommEvent")
-	xmlrpcCodec.RegisterAlias("supervisor.reloadConfig", "Supervisor.ReloadConfig")
-	xmlrpcCodec.RegisterAlias("supervisor.addProcessGroup", "Supervisor.AddProcessGroup")
-	xmlrpcCodec.RegisterAlias("supervisor.removeProcessGroup", "Supervisor.RemoveProcessGroup")
-	xmlrpcCodec.RegisterAlias("supervisor.readProcessStdoutLog", "Supervisor.ReadProcessStdoutLog")
-	xmlrpcCodec.RegisterAlias("supervisor.readProcessStderrLog", "Supervisor.ReadProcessStderrLog")
-	xmlrpcCodec.RegisterAlias("supervisor.tailProcessStdoutLog", "Supervisor.TailProcessStdoutLog")
-	xmlrpcCodec.RegisterAlias("supervisor.tailProcessStderrLog", "Supervisor.TailProcessStderrLog")
-	xmlrpcCodec.RegisterAlias("supervisor.clearProcessLogs", "Supervisor.ClearProcessLogs")
-	xmlrpcCodec.RegisterAlias("supervisor.clearAllProcessLogs", "Supervisor.ClearAllProcessLogs")
-	return RPC
+	RPC.RegisterCodec(codec, contentType)
+	system := newRPCSystem(RPC)
+	codec = &systemCodec{rpcCodec: codec, system: system}
+	system.registerService(s, "")
+	system.registerService(system, "system")
+
+	codec.RegisterAlias("system.listMethods", "system.ListMethods")
+	codec.RegisterAlias("system.methodHelp", "system.MethodHelp")
+	codec.RegisterAlias("system.methodSignature", "system.MethodSignature")
+
+	codec.RegisterAlias("supervisor.getVersion", "Supervisor.GetVersion")
+	codec.RegisterAlias("supervisor.getAPIVersion", "Supervisor.GetVersion")
+	codec.RegisterAlias("supervisor.getIdentification", "Supervisor.GetIdentification")
+	codec.RegisterAlias("supervisor.getState", "Supervisor.GetState")
+	codec.RegisterAlias("supervisor.getPID", "Supervisor.GetPID")
+	codec.RegisterAlias("supervisor.readLog", "Supervisor.ReadLog")
+	codec.RegisterAlias("supervisor.clearLog", "Supervisor.ClearLog")
+	codec.RegisterAlias("supervisor.shutdown", "Supervisor.Shutdown")
+	codec.RegisterAlias("supervisor.restart", "Supervisor.Restart")
+	codec.RegisterAlias("supervisor.getProcessInfo", "Supervisor.GetProcessInfo")
+	codec.RegisterAlias("supervisor.getProcessConfig", "Supervisor.GetProcessConfig")
+	codec.RegisterAlias("supervisor.getSupervisorVersion", "Supervisor.GetVersion")
+	codec.RegisterAlias("supervisor.getAllProcessInfo", "Supervisor.GetAllProcessInfo")
+	codec.RegisterAlias("supervisor.getAllConfigInfo", "Supervisor.GetAllConfigInfo")
+	codec.RegisterAlias("supervisor.startProcess", "Supervisor.StartProcess")
+	codec.RegisterAlias("supervisor.startAllProcesses", "Supervisor.StartAllProcesses")
+	codec.RegisterAlias("supervisor.startProcessGroup", "Supervisor.StartProcessGroup")
+	codec.RegisterAlias("supervisor.stopProcess", "Supervisor.StopProcess")
+	codec.RegisterAlias("supervisor.stopProcessGroup", "Supervisor.StopProcessGroup")
+	codec.RegisterAlias("supervisor.stopAllProcesses", "Supervisor.StopAllProcesses")
+	codec.RegisterAlias("supervisor.signalProcess", "Supervisor.SignalProcess")
+	codec.RegisterAlias("supervisor.signalProcessGroup", "Supervisor.SignalProcessGroup")
+	codec.RegisterAlias("supervisor.signalAllProcesses", "Supervisor.SignalAllProcesses")
+	codec.RegisterAlias("supervisor.chaos", "Supervisor.Chaos")
+	codec.RegisterAlias("supervisor.setProcessResourceLimits", "Supervisor.SetProcessResourceLimits")
+	codec.RegisterAlias("supervisor.runProgram", "Supervisor.RunProgram")
+	codec.RegisterAlias("supervisor.execInProcessContext", "Supervisor.ExecInProcessContext")
+	codec.RegisterAlias("supervisor.getRuntimeSnapshot", "Supervisor.GetRuntimeSnapshot")
+	codec.RegisterAlias("supervisor.sendProcessStdin", "Supervisor.SendProcessStdin")
+	codec.RegisterAlias("supervisor.sendRemoteCommEvent", "Supervisor.SendRemoteCommEvent")
+	codec.RegisterAlias("supervisor.reloadConfig", "Supervisor.ReloadConfig")
+	codec.RegisterAlias("supervisor.rereadConfig", "Supervisor.RereadConfig")
+	codec.RegisterAlias("supervisor.addProcessGroup", "Supervisor.AddProcessGroup")
+	codec.RegisterAlias("supervisor.removeProcessGroup", "Supervisor.RemoveProcessGroup")
+	codec.RegisterAlias("supervisor.readProcessStdoutLog", "Supervisor.ReadProcessStdoutLog")
+	codec.RegisterAlias("supervisor.readProcessStderrLog", "Supervisor.ReadProcessStderrLog")
+	codec.RegisterAlias("supervisor.tailProcessStdoutLog", "Supervisor.TailProcessStdoutLog")
+	codec.RegisterAlias("supervisor.tailProcessStderrLog", "Supervisor.TailProcessStderrLog")
+	codec.RegisterAlias("supervisor.clearProcessLogs", "Supervisor.ClearProcessLogs")
+	codec.RegisterAlias("supervisor.clearAllProcessLogs", "Supervisor.ClearAllProcessLogs")
+	registerMetricsAliases(codec)
+	s.registerRPCExtensions(system, codec)
+	return RPC, system
 }
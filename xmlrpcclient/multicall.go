@@ -0,0 +1,143 @@
+package xmlrpcclient
+
+import (
+	"bytes"
+	encxml "encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/ochinchina/gorilla-xmlrpc/xml"
+)
+
+// MulticallRequest one method call of system.multicall
+type MulticallRequest struct {
+	Method string
+	// the args like the args of the single call, for example &struct{ Name string }{"web"}
+	Args interface{}
+}
+
+// MulticallResult the result of one method call of system.multicall
+type MulticallResult struct {
+	// the fault of the call, nil if the call succeeds
+	Err error
+	// the XML of the values returned by the call
+	params string
+}
+
+// the request body which is posted without encoding
+type rawRequest []byte
+
+// the XML of a value without the <value> element
+type rawValue struct {
+	XML string `xml:",innerxml"`
+}
+
+type multicallValue struct {
+	Values  []rawValue `xml:"array>data>value"`
+	Members []struct {
+		Name  string   `xml:"name"`
+		Value rawValue `xml:"value"`
+	} `xml:"struct>member"`
+}
+
+type multicallResponse struct {
+	Results []multicallValue `xml:"params>param>value>array>data>value"`
+	Fault   *multicallValue  `xml:"fault>value"`
+}
+
+// Decode decode the values returned by the call to the reply like the reply of the single call
+func (m *MulticallResult) Decode(reply interface{}) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	return xml.DecodeClientResponse(strings.NewReader(`<?xml version="1.0"?><methodResponse><params>`+m.params+`</params></methodResponse>`), reply)
+}
+
+// Multicall call the methods in one request with system.multicall, the results
+// are in the order of the calls and a failed call doesn't affect the others
+func (r *XMLRPCClient) Multicall(calls []MulticallRequest) (results []MulticallResult, err error) {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0"?><methodCall><methodName>system.multicall</methodName><params><param><value><array><data>`)
+	for _, call := range calls {
+		request, err := xml.EncodeClientRequest(call.Method, call.Args)
+		if err != nil {
+			return nil, err
+		}
+		params := struct {
+			Values []rawValue `xml:"params>param>value"`
+		}{}
+		if err = encxml.Unmarshal(request, &params); err != nil {
+			return nil, err
+		}
+		buf.WriteString("<value><struct><member><name>methodName</name><value><string>")
+		encxml.EscapeText(&buf, []byte(call.Method))
+		buf.WriteString("</string></value></member><member><name>params</name><value><array><data>")
+		for _, value := range params.Values {
+			buf.WriteString("<value>" + value.XML + "</value>")
+		}
+		buf.WriteString("</data></array></value></member></struct></value>")
+	}
+	buf.WriteString(`</data></array></value></param></params></methodCall>`)
+
+	r.post("system.multicall", rawRequest(buf.Bytes()), func(body io.ReadCloser, procError error) {
+		err = procError
+		if err == nil {
+			results, err = decodeMulticallResponse(body)
+		}
+	})
+	return
+}
+
+func decodeMulticallResponse(body io.Reader) ([]MulticallResult, error) {
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	response := multicallResponse{}
+	if err = encxml.Unmarshal(b, &response); err != nil {
+		return nil, err
+	}
+	if response.Fault != nil {
+		return nil, response.Fault.toFault()
+	}
+	results := make([]MulticallResult, 0)
+	for _, result := range response.Results {
+		if len(result.Members) > 0 {
+			results = append(results, MulticallResult{Err: result.toFault()})
+			continue
+		}
+		var params strings.Builder
+		for _, value := range result.Values {
+			params.WriteString("<param><value>" + value.XML + "</value></param>")
+		}
+		results = append(results, MulticallResult{params: params.String()})
+	}
+	return results, nil
+}
+
+// convert the fault struct to xml.Fault
+func (v *multicallValue) toFault() error {
+	fault := xml.Fault{}
+	for _, member := range v.Members {
+		value := struct {
+			Int    string `xml:"int"`
+			I4     string `xml:"i4"`
+			String string `xml:"string"`
+			Raw    string `xml:",chardata"`
+		}{}
+		encxml.Unmarshal([]byte("<value>"+member.Value.XML+"</value>"), &value)
+		switch member.Name {
+		case "faultCode":
+			fault.Code, _ = strconv.Atoi(strings.TrimSpace(value.Int + value.I4))
+		case "faultString":
+			fault.String = value.String + strings.TrimSpace(value.Raw)
+		}
+	}
+	if fault.Code == 0 && fault.String == "" {
+		return fmt.Errorf("not a valid fault")
+	}
+	return fault
+}
@@ -0,0 +1,65 @@
+package xmlrpcclient
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// the server url of the XMLRPCClient using the in-memory transport
+const inMemoryURL = "http://in-memory"
+
+// inMemoryTransport serve the http requests with the handler in the same
+// process instead of sending them through the network
+type inMemoryTransport struct {
+	handler http.Handler
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (t *inMemoryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the handler expects a request received by the server
+	serverReq := req.Clone(req.Context())
+	serverReq.RemoteAddr = "in-memory"
+	serverReq.RequestURI = req.URL.RequestURI()
+	if serverReq.Body == nil {
+		serverReq.Body = http.NoBody
+	}
+
+	recorder := &responseRecorder{header: make(http.Header)}
+	t.handler.ServeHTTP(recorder, serverReq)
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	return &http.Response{Status: fmt.Sprintf("%d %s", recorder.status, http.StatusText(recorder.status)),
+		StatusCode:    recorder.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorder.header,
+		Body:          ioutil.NopCloser(bytes.NewReader(recorder.body.Bytes())),
+		ContentLength: int64(recorder.body.Len()),
+		Request:       req}, nil
+}
+
+// responseRecorder keep the response written by the handler in memory
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
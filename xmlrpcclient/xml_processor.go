@@ -1,6 +1,7 @@
 package xmlrpcclient
 
 import (
+	"bytes"
 	"encoding/xml"
 	"io"
 	"strings"
@@ -115,13 +116,18 @@ func (xpm *XMLProcessorManager) ProcessXML(reader io.Reader) {
 			curData = nil
 		case xml.CharData:
 			data, _ := tk.(xml.CharData)
-			curData = data.Copy()
+			// ignore the whitespaces between the elements
+			if curData != nil || len(bytes.TrimSpace(data)) > 0 {
+				curData = data.Copy()
+			}
 		case xml.EndElement:
 			if curData != nil {
 				xpm.ProcessLeafNode(curPath.String(), string(curData))
 			} else {
 				xpm.ProcessNonLeafNode(curPath.String())
 			}
+			// the parent of this element is not a leaf
+			curData = nil
 			curPath.RemoveLast()
 		}
 	}
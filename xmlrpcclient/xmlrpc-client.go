@@ -24,6 +24,7 @@ type XMLRPCClient struct {
 	password  string
 	timeout   time.Duration
 	verbose   bool
+	transport http.RoundTripper // the transport to send the requests, nil for the default
 }
 
 // VersionReply the version reply message from supervisor
@@ -31,6 +32,17 @@ type VersionReply struct {
 	Value string
 }
 
+// StateReply the supervisor state reply message
+type StateReply struct {
+	Value struct {
+		Statecode int    `xml:"statecode"`
+		Statename string `xml:"statename"`
+		Operation string `xml:"operation"` // the running reload, start all or stop all operation
+		Since     int    `xml:"since"`     // the start time of the running operation, 0 if no operation
+		Error     string `xml:"error"`     // the error of the failed configuration load in DEGRADED state
+	}
+}
+
 // StartStopReply the program start/stop reply message from supervisor
 type StartStopReply struct {
 	Value bool
@@ -56,6 +68,16 @@ func NewXMLRPCClient(serverurl string, verbose bool) *XMLRPCClient {
 	return &XMLRPCClient{serverurl: serverurl, timeout: 0, verbose: verbose}
 }
 
+// NewInMemoryXMLRPCClient create a XMLRPCClient which sends the requests to the
+// handler in the same process instead of through the network, e.g. the XML RPC
+// handler of supervisord
+func NewInMemoryXMLRPCClient(handler http.Handler, verbose bool) *XMLRPCClient {
+	return &XMLRPCClient{serverurl: inMemoryURL,
+		timeout:   0,
+		verbose:   verbose,
+		transport: &inMemoryTransport{handler: handler}}
+}
+
 // SetUser set the user for basic http auth
 func (r *XMLRPCClient) SetUser(user string) {
 	r.user = user
@@ -77,7 +99,10 @@ func (r *XMLRPCClient) URL() string {
 }
 
 func (r *XMLRPCClient) createHTTPRequest(method string, url string, data interface{}) (*http.Request, error) {
-	buf, _ := xml.EncodeClientRequest(method, data)
+	buf, ok := data.(rawRequest)
+	if !ok {
+		buf, _ = xml.EncodeClientRequest(method, data)
+	}
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(buf))
 	if err != nil {
 		if r.verbose {
@@ -111,6 +136,7 @@ func (r *XMLRPCClient) processResponse(resp *http.Response, processBody func(io.
 func (r *XMLRPCClient) postInetHTTP(method string, url string, data interface{}, processBody func(io.ReadCloser, error)) {
 	req, err := r.createHTTPRequest(method, url, data)
 	if err != nil {
+		processBody(emptyReader, err)
 		return
 	}
 
@@ -120,11 +146,16 @@ func (r *XMLRPCClient) postInetHTTP(method string, url string, data interface{},
 		req = req.WithContext(ctx)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	client := http.DefaultClient
+	if r.transport != nil {
+		client = &http.Client{Transport: r.transport}
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		if r.verbose {
 			fmt.Println("Fail to send request to supervisord:", err)
 		}
+		processBody(emptyReader, err)
 		return
 	}
 	r.processResponse(resp, processBody)
@@ -143,18 +174,21 @@ func (r *XMLRPCClient) postUnixHTTP(method string, path string, data interface{}
 		if r.verbose {
 			fmt.Printf("Fail to connect unix socket path: %s\n", r.serverurl)
 		}
+		processBody(emptyReader, err)
 		return
 	}
 	defer conn.Close()
 
 	if r.timeout > 0 {
 		if err := conn.SetDeadline(time.Now().Add(r.timeout)); err != nil {
+			processBody(emptyReader, err)
 			return
 		}
 	}
 	req, err := r.createHTTPRequest(method, "/RPC2", data)
 
 	if err != nil {
+		processBody(emptyReader, err)
 		return
 	}
 	err = req.Write(conn)
@@ -162,6 +196,7 @@ func (r *XMLRPCClient) postUnixHTTP(method string, path string, data interface{}
 		if r.verbose {
 			fmt.Printf("Fail to write to unix socket %s\n", r.serverurl)
 		}
+		processBody(emptyReader, err)
 		return
 	}
 	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
@@ -169,6 +204,7 @@ func (r *XMLRPCClient) postUnixHTTP(method string, path string, data interface{}
 		if r.verbose {
 			fmt.Printf("Fail to read response %s\n", err)
 		}
+		processBody(emptyReader, err)
 		return
 	}
 	r.processResponse(resp, processBody)
@@ -178,6 +214,7 @@ func (r *XMLRPCClient) post(method string, data interface{}, processBody func(io
 	url, err := url.Parse(r.serverurl)
 	if err != nil {
 		fmt.Printf("Malform url:%s\n", url)
+		processBody(emptyReader, err)
 		return
 	}
 	if url.Scheme == "http" || url.Scheme == "https" {
@@ -186,6 +223,7 @@ func (r *XMLRPCClient) post(method string, data interface{}, processBody func(io
 		r.postUnixHTTP(method, url.Path, data, processBody)
 	} else {
 		fmt.Printf("Unsupported URL scheme:%s\n", url.Scheme)
+		processBody(emptyReader, fmt.Errorf("unsupported URL scheme %s", url.Scheme))
 	}
 
 }
@@ -202,6 +240,59 @@ func (r *XMLRPCClient) GetVersion() (reply VersionReply, err error) {
 	return
 }
 
+// GetState get the state of supervisor and its running operation
+func (r *XMLRPCClient) GetState() (reply StateReply, err error) {
+	ins := struct{}{}
+	r.post("supervisor.getState", &ins, func(body io.ReadCloser, procError error) {
+		err = procError
+		if err == nil {
+			err = xml.DecodeClientResponse(body, &reply)
+		}
+	})
+	return
+}
+
+// ReadLog read length bytes of the supervisord log from offset, a negative
+// offset with 0 length reads the last -offset bytes
+func (r *XMLRPCClient) ReadLog(offset int, length int) (data string, err error) {
+	ins := struct {
+		Offset int
+		Length int
+	}{offset, length}
+	result := struct{ Log string }{}
+	r.post("supervisor.readLog", &ins, func(body io.ReadCloser, procError error) {
+		err = procError
+		if err == nil {
+			err = xml.DecodeClientResponse(body, &result)
+			data = result.Log
+		}
+	})
+	return
+}
+
+// ReadProcessLog read length bytes of the stdout or stderr log of the
+// program from offset, a negative offset with 0 length reads the last -offset bytes
+func (r *XMLRPCClient) ReadProcessLog(process string, stderr bool, offset int, length int) (data string, err error) {
+	method := "supervisor.readProcessStdoutLog"
+	if stderr {
+		method = "supervisor.readProcessStderrLog"
+	}
+	ins := struct {
+		Name   string
+		Offset int
+		Length int
+	}{process, offset, length}
+	result := struct{ LogData string }{}
+	r.post(method, &ins, func(body io.ReadCloser, procError error) {
+		err = procError
+		if err == nil {
+			err = xml.DecodeClientResponse(body, &result)
+			data = result.LogData
+		}
+	})
+	return
+}
+
 // GetAllProcessInfo get all the processes of superisor
 func (r *XMLRPCClient) GetAllProcessInfo() (reply AllProcessInfoReply, err error) {
 	ins := struct{}{}
@@ -233,6 +324,82 @@ func (r *XMLRPCClient) ChangeProcessState(change string, processName string) (re
 	return
 }
 
+// StartProcessWait start the process and wait until it is running or fails to
+// start, the processName "all" is for all the processes. If timeout is greater
+// than 0 the supervisord stops waiting after it with a STILL_RUNNING fault.
+// The KEY=VALUE env overrides the environment of this start of the process
+func (r *XMLRPCClient) StartProcessWait(processName string, timeout time.Duration, env ...string) (err error) {
+	seconds := int((timeout + time.Second - 1) / time.Second)
+	var ins interface{} = &struct {
+		Name    string
+		Wait    bool
+		DryRun  bool
+		Timeout int
+	}{processName, true, false, seconds}
+	if len(env) > 0 {
+		ins = &struct {
+			Name    string
+			Wait    bool
+			DryRun  bool
+			Timeout int
+			Force   bool
+			Env     []string
+		}{processName, true, false, seconds, false, env}
+	}
+	method := "supervisor.startProcess"
+	if processName == "all" {
+		ins = &struct {
+			Wait    bool
+			DryRun  bool
+			Timeout int
+		}{true, false, seconds}
+		method = "supervisor.startAllProcesses"
+	}
+	var reply interface{} = &StartStopReply{}
+	if processName == "all" {
+		reply = &AllProcessInfoReply{}
+	}
+	r.post(method, ins, func(body io.ReadCloser, procError error) {
+		err = procError
+		if err == nil {
+			err = xml.DecodeClientResponse(body, reply)
+		}
+	})
+	return
+}
+
+// PlanProcessState get the action plan to change the process state without changing it,
+// the processName "all" is for all the processes
+func (r *XMLRPCClient) PlanProcessState(change string, processName string) (plan []types.ActionStep, err error) {
+	if !(change == "start" || change == "stop") {
+		err = fmt.Errorf("Incorrect required state")
+		return
+	}
+
+	var ins interface{} = &struct {
+		Name   string
+		Wait   bool
+		DryRun bool
+	}{processName, true, true}
+	method := fmt.Sprintf("supervisor.%sProcess", change)
+	if processName == "all" {
+		ins = &struct {
+			Wait   bool
+			DryRun bool
+		}{true, true}
+		method = fmt.Sprintf("supervisor.%sAllProcesses", change)
+	}
+	reply := struct{ Value []types.ActionStep }{}
+	r.post(method, ins, func(body io.ReadCloser, procError error) {
+		err = procError
+		if err == nil {
+			err = xml.DecodeClientResponse(body, &reply)
+		}
+	})
+	plan = reply.Value
+	return
+}
+
 // ChangeAllProcessState change all the program to same state( start/stop )
 func (r *XMLRPCClient) ChangeAllProcessState(change string) (reply AllProcessInfoReply, err error) {
 	if !(change == "start" || change == "stop") {
@@ -265,24 +432,29 @@ func (r *XMLRPCClient) Shutdown() (reply ShutdownReply, err error) {
 
 // ReloadConfig ask supervisor reload the configuration
 func (r *XMLRPCClient) ReloadConfig() (reply types.ReloadConfigResult, err error) {
+	return r.getChangedGroups("supervisor.reloadConfig")
+}
+
+// RereadConfig get the groups changed in the configuration file without
+// applying them
+func (r *XMLRPCClient) RereadConfig() (reply types.ReloadConfigResult, err error) {
+	return r.getChangedGroups("supervisor.rereadConfig")
+}
+
+// call the method replying the added, changed and removed groups
+func (r *XMLRPCClient) getChangedGroups(method string) (reply types.ReloadConfigResult, err error) {
 	ins := struct{}{}
 
 	xmlProcMgr := NewXMLProcessorManager()
 	reply.AddedGroup = make([]string, 0)
 	reply.ChangedGroup = make([]string, 0)
 	reply.RemovedGroup = make([]string, 0)
-	i := -1
-	hasValue := false
-	xmlProcMgr.AddNonLeafProcessor("methodResponse/params/param/value/array/data", func() {
-		if hasValue {
-			hasValue = false
-		} else {
-			i++
-		}
-	})
-	xmlProcMgr.AddLeafProcessor("methodResponse/params/param/value/array/data/value", func(value string) {
-		hasValue = true
+	// the reply has three params: added, changed and removed groups
+	i := 0
+	xmlProcMgr.AddNonLeafProcessor("methodResponse/params/param", func() {
 		i++
+	})
+	addGroup := func(value string) {
 		switch i {
 		case 0:
 			reply.AddedGroup = append(reply.AddedGroup, value)
@@ -291,8 +463,10 @@ func (r *XMLRPCClient) ReloadConfig() (reply types.ReloadConfigResult, err error
 		case 2:
 			reply.RemovedGroup = append(reply.RemovedGroup, value)
 		}
-	})
-	r.post("supervisor.reloadConfig", &ins, func(body io.ReadCloser, procError error) {
+	}
+	xmlProcMgr.AddLeafProcessor("methodResponse/params/param/value/array/data/value", addGroup)
+	xmlProcMgr.AddLeafProcessor("methodResponse/params/param/value/array/data/value/string", addGroup)
+	r.post(method, &ins, func(body io.ReadCloser, procError error) {
 		err = procError
 		if err == nil {
 			xmlProcMgr.ProcessXML(body)
@@ -301,6 +475,27 @@ func (r *XMLRPCClient) ReloadConfig() (reply types.ReloadConfigResult, err error
 	return
 }
 
+// AddProcessGroup bring the group of the configuration file into service
+func (r *XMLRPCClient) AddProcessGroup(name string) (reply types.BooleanReply, err error) {
+	return r.changeProcessGroup("supervisor.addProcessGroup", name)
+}
+
+// RemoveProcessGroup take the stopped group out of service
+func (r *XMLRPCClient) RemoveProcessGroup(name string) (reply types.BooleanReply, err error) {
+	return r.changeProcessGroup("supervisor.removeProcessGroup", name)
+}
+
+func (r *XMLRPCClient) changeProcessGroup(method string, name string) (reply types.BooleanReply, err error) {
+	ins := struct{ Name string }{name}
+	r.post(method, &ins, func(body io.ReadCloser, procError error) {
+		err = procError
+		if err == nil {
+			err = xml.DecodeClientResponse(body, &reply)
+		}
+	})
+	return
+}
+
 // SignalProcess send signal to program
 func (r *XMLRPCClient) SignalProcess(signal string, name string) (reply types.BooleanReply, err error) {
 	ins := types.ProcessSignal{Name: name, Signal: signal}
@@ -313,6 +508,84 @@ func (r *XMLRPCClient) SignalProcess(signal string, name string) (reply types.Bo
 	return
 }
 
+// Chaos kill or delay the processes picked randomly for a chaos drill
+func (r *XMLRPCClient) Chaos(args types.ChaosArgs) (actions []types.ChaosAction, err error) {
+	reply := struct{ Actions []types.ChaosAction }{}
+	r.post("supervisor.chaos", &args, func(body io.ReadCloser, procError error) {
+		err = procError
+		if err == nil {
+			err = xml.DecodeClientResponse(body, &reply)
+		}
+	})
+	actions = reply.Actions
+	return
+}
+
+// SetProcessResourceLimits change the resource limits of a running program
+// until the next reload, return the effective limits
+func (r *XMLRPCClient) SetProcessResourceLimits(args types.ResourceLimitsArgs) (limits types.ResourceLimits, err error) {
+	reply := struct{ Limits types.ResourceLimits }{}
+	r.post("supervisor.setProcessResourceLimits", &args, func(body io.ReadCloser, procError error) {
+		err = procError
+		if err == nil {
+			err = xml.DecodeClientResponse(body, &reply)
+		}
+	})
+	limits = reply.Limits
+	return
+}
+
+// RunProgram run an ad-hoc command once under supervision and get the name
+// of its program
+func (r *XMLRPCClient) RunProgram(args types.RunArgs) (name string, err error) {
+	reply := struct{ Name string }{}
+	var ins interface{} = &args
+	if len(args.Env) == 0 {
+		ins = &struct {
+			Command   string
+			Directory string
+			TTL       int
+			Reason    string
+		}{args.Command, args.Directory, args.TTL, args.Reason}
+	}
+	r.post("supervisor.runProgram", ins, func(body io.ReadCloser, procError error) {
+		err = procError
+		if err == nil {
+			err = xml.DecodeClientResponse(body, &reply)
+		}
+	})
+	name = reply.Name
+	return
+}
+
+// ExecInProcessContext run a command in the context of a program and get its
+// output and exit status
+func (r *XMLRPCClient) ExecInProcessContext(args types.ExecArgs) (result types.ExecResult, err error) {
+	reply := struct{ Result types.ExecResult }{}
+	r.post("supervisor.execInProcessContext", &args, func(body io.ReadCloser, procError error) {
+		err = procError
+		if err == nil {
+			err = xml.DecodeClientResponse(body, &reply)
+		}
+	})
+	result = reply.Result
+	return
+}
+
+// GetRuntimeSnapshot get the runtime state of the programs
+func (r *XMLRPCClient) GetRuntimeSnapshot() (programs []types.ProgramSnapshot, err error) {
+	reply := struct{ Programs []types.ProgramSnapshot }{}
+	ins := struct{}{}
+	r.post("supervisor.getRuntimeSnapshot", &ins, func(body io.ReadCloser, procError error) {
+		err = procError
+		if err == nil {
+			err = xml.DecodeClientResponse(body, &reply)
+		}
+	})
+	programs = reply.Programs
+	return
+}
+
 // SignalAll send signal to all the programs
 func (r *XMLRPCClient) SignalAll(signal string) (reply AllProcessInfoReply, err error) {
 	ins := struct{ Signal string }{signal}
@@ -344,3 +617,35 @@ func (r *XMLRPCClient) GetProcessInfo(process string) (reply types.ProcessInfo,
 
 	return
 }
+
+// GetAllConfigInfo get the configuration summary of all the programs
+func (r *XMLRPCClient) GetAllConfigInfo() (reply []types.ConfigInfo, err error) {
+	ins := struct{}{}
+	result := struct{ Reply []types.ConfigInfo }{}
+	r.post("supervisor.getAllConfigInfo", &ins, func(body io.ReadCloser, procError error) {
+		err = procError
+		if err == nil {
+			err = xml.DecodeClientResponse(body, &result)
+			if err == nil {
+				reply = result.Reply
+			}
+		}
+	})
+	return
+}
+
+// GetProcessConfig get the resolved configuration used to spawn the program
+func (r *XMLRPCClient) GetProcessConfig(process string) (reply types.ProcessConfig, err error) {
+	ins := struct{ Name string }{process}
+	result := struct{ Reply types.ProcessConfig }{}
+	r.post("supervisor.getProcessConfig", &ins, func(body io.ReadCloser, procError error) {
+		err = procError
+		if err == nil {
+			err = xml.DecodeClientResponse(body, &result)
+			if err == nil {
+				reply = result.Reply
+			}
+		}
+	})
+	return
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/ochinchina/supervisord/types"
+	"github.com/ochinchina/supervisord/xmlrpcclient"
+)
+
+// ZabbixCommand the Zabbix low-level discovery and items of the programs
+type ZabbixCommand struct {
+	ServerURL string `short:"s" long:"serverurl" description:"URL on which supervisord server is listening"`
+	User      string `short:"u" long:"user" description:"the user name"`
+	Password  string `short:"P" long:"password" description:"the password"`
+}
+
+// ZabbixDiscoveryCommand print the low-level discovery JSON of the programs or groups
+type ZabbixDiscoveryCommand struct {
+	Groups bool `long:"groups" description:"discover the groups instead of the programs"`
+}
+
+// ZabbixItemCommand print the value of an item of a program
+type ZabbixItemCommand struct{}
+
+var zabbixCommand ZabbixCommand
+var zabbixDiscoveryCommand ZabbixDiscoveryCommand
+var zabbixItemCommand ZabbixItemCommand
+
+// the keys of the items of a program and their values
+var zabbixItems = map[string]func(info types.ProcessInfo) string{
+	"state":        func(info types.ProcessInfo) string { return strconv.Itoa(info.State) },
+	"statename":    func(info types.ProcessInfo) string { return info.Statename },
+	"pid":          func(info types.ProcessInfo) string { return strconv.Itoa(info.Pid) },
+	"uptime":       func(info types.ProcessInfo) string { return strconv.Itoa(info.CurrentUptime) },
+	"restarts":     func(info types.ProcessInfo) string { return strconv.Itoa(info.Restarts) },
+	"failures":     func(info types.ProcessInfo) string { return strconv.Itoa(info.Failures) },
+	"exitstatus":   func(info types.ProcessInfo) string { return strconv.Itoa(info.Exitstatus) },
+	"cputime":      func(info types.ProcessInfo) string { return strconv.FormatFloat(info.Cputime, 'f', 2, 64) },
+	"rss":          func(info types.ProcessInfo) string { return strconv.Itoa(info.Rss) },
+	"total_uptime": func(info types.ProcessInfo) string { return strconv.Itoa(info.Uptime) },
+	"mtbf":         func(info types.ProcessInfo) string { return strconv.Itoa(info.Mtbf) },
+}
+
+func (zc *ZabbixCommand) createRPCClient() *xmlrpcclient.XMLRPCClient {
+	ctl := CtlCommand{ServerURL: zc.ServerURL, User: zc.User, Password: zc.Password}
+	return ctl.createRPCClient()
+}
+
+// get the low-level discovery JSON of the programs, {#PROGRAM} is the name
+// used by the items, or of their groups
+func zabbixDiscovery(infos []types.ProcessInfo, groups bool) ([]byte, error) {
+	data := make([]map[string]string, 0)
+	seen := make(map[string]bool)
+	for _, info := range infos {
+		if groups && !seen[info.Group] {
+			seen[info.Group] = true
+			data = append(data, map[string]string{"{#GROUP}": info.Group})
+		} else if !groups {
+			data = append(data, map[string]string{"{#PROGRAM}": info.Name, "{#GROUP}": info.Group})
+		}
+	}
+	sort.SliceStable(data, func(i, j int) bool { return data[i]["{#GROUP}"] < data[j]["{#GROUP}"] })
+	return json.Marshal(map[string]interface{}{"data": data})
+}
+
+// get the value of the item of the program
+func zabbixItem(infos []types.ProcessInfo, name string, key string) (string, error) {
+	item, ok := zabbixItems[key]
+	if !ok {
+		return "", fmt.Errorf("unknown item %s", key)
+	}
+	for _, info := range infos {
+		if info.Name == name || info.GetFullName() == name {
+			return item(info), nil
+		}
+	}
+	return "", fmt.Errorf("no program %s", name)
+}
+
+// Execute print the low-level discovery JSON
+func (dc *ZabbixDiscoveryCommand) Execute(args []string) error {
+	reply, err := zabbixCommand.createRPCClient().GetAllProcessInfo()
+	if err != nil {
+		return exitOnError(err)
+	}
+	b, err := zabbixDiscovery(reply.Value, dc.Groups)
+	if err != nil {
+		return exitOnError(err)
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+// Execute print the value of the item of the program, the state by default
+func (ic *ZabbixItemCommand) Execute(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return exitOnError(fmt.Errorf("usage: supervisord zabbix item <program> [state|statename|pid|uptime|restarts|...]"))
+	}
+	key := "state"
+	if len(args) == 2 {
+		key = args[1]
+	}
+	info, err := zabbixCommand.createRPCClient().GetProcessInfo(args[0])
+	if err != nil {
+		return exitOnError(err)
+	}
+	value, err := zabbixItem([]types.ProcessInfo{info}, args[0], key)
+	if err != nil {
+		return exitOnError(err)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+func init() {
+	cmd, _ := parser.AddCommand("zabbix",
+		"Zabbix low-level discovery and items of the programs",
+		"The zabbix subcommand prints the low-level discovery JSON of the programs or groups and the values of the items of a program, for the UserParameter of the Zabbix agent",
+		&zabbixCommand)
+	cmd.AddCommand("discovery",
+		"print the low-level discovery JSON",
+		"print the low-level discovery JSON of the programs ({#PROGRAM} and {#GROUP}) or of the groups with --groups",
+		&zabbixDiscoveryCommand)
+	cmd.AddCommand("item",
+		"print the value of an item of a program",
+		"print the value of the item (state by default, statename, pid, uptime, restarts, failures, exitstatus, cputime, rss, total_uptime or mtbf) of the program",
+		&zabbixItemCommand)
+}
@@ -0,0 +1,50 @@
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"supervisord/internal/testutil"
+)
+
+func TestZabbixDiscovery(t *testing.T) {
+	dir := testutil.TempDir(t)
+	program := "command=%[2]s\nautostart=false\nstartsecs=0\nstdout_logfile=/dev/null\nstderr_logfile=/dev/null\n"
+	content := testSupervisordSection + "\n" +
+		"[program:web]\n" + program + "\n[program:api]\n" + program + "\n[program:db]\n" + program + "\n[group:front]\nprograms=web,api\n"
+	s := startConfSupervisor(t, dir, fmt.Sprintf(content, dir, testutil.FakeProgram(t, dir, testutil.Sleep)))
+	web := s.GetManager().Find("web")
+	web.Start(true)
+	reply, err := s.xmlRPC.NewInMemoryClient(s).GetAllProcessInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := zabbixDiscovery(reply.Value, false)
+	expected := `{"data":[{"{#GROUP}":"db","{#PROGRAM}":"db"},{"{#GROUP}":"front","{#PROGRAM}":"api"},{"{#GROUP}":"front","{#PROGRAM}":"web"}]}`
+	if string(b) != expected {
+		t.Errorf("fail to discover the programs: %s", b)
+	}
+	b, _ = zabbixDiscovery(reply.Value, true)
+	if string(b) != `{"data":[{"{#GROUP}":"db"},{"{#GROUP}":"front"}]}` {
+		t.Errorf("fail to discover the groups: %s", b)
+	}
+
+	if value, err := zabbixItem(reply.Value, "web", "state"); err != nil || value != "20" {
+		t.Errorf("fail to get the state of the program: %s %v", value, err)
+	}
+	if value, err := zabbixItem(reply.Value, "front:web", "pid"); err != nil || value != fmt.Sprint(web.GetPid()) {
+		t.Errorf("fail to get the pid of the program: %s %v", value, err)
+	}
+	if value, err := zabbixItem(reply.Value, "db", "statename"); err != nil || value != "Stopped" {
+		t.Errorf("fail to get the state name of the program: %s %v", value, err)
+	}
+	if _, err := zabbixItem(reply.Value, "cache", "state"); err == nil {
+		t.Error("fail to refuse the unknown program")
+	}
+	if _, err := zabbixItem(reply.Value, "web", "color"); err == nil {
+		t.Error("fail to refuse the unknown item")
+	}
+}
@@ -3,10 +3,17 @@
 package main
 
 import (
+	"sync"
+
 	reaper "github.com/ochinchina/go-reaper"
 )
 
-// ReapZombie reap the zombie child process
+var reapZombieOnce sync.Once
+
+// ReapZombie reap the zombie child process, the reaper is started only once
+// and works only if supervisord is the init process (pid 1)
 func ReapZombie() {
-	go reaper.Reap()
+	reapZombieOnce.Do(func() {
+		go reaper.Reap()
+	})
 }